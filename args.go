@@ -0,0 +1,107 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/yarpc/yab/encoding"
+)
+
+var errArgsEncoding = errors.New("--arg can only be used with the Thrift or JSON encodings")
+
+// positionalArg matches positional arguments that set a request argument,
+// such as id=5, rather than the service, method, headers or request.
+var positionalArg = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+
+// splitPositionalArgs separates name=value arguments from the other
+// positional arguments, so yab svc Service::method id=5 name=foo works.
+// Arguments are only taken after the service and method, and only for
+// encodings that support --arg, so raw bodies such as user=bob&x=1 are
+// still sent as the request.
+func splitPositionalArgs(remaining []string, opts RequestOptions) (positional, args []string) {
+	method := opts.MethodName
+	if len(remaining) > 1 && remaining[1] != "" {
+		method = remaining[1]
+	}
+	if len(remaining) <= 2 || !argsSupported(opts.Encoding, method) {
+		return remaining, nil
+	}
+
+	positional = append(positional, remaining[:2]...)
+	for _, arg := range remaining[2:] {
+		if positionalArg.MatchString(arg) {
+			args = append(args, arg)
+		} else {
+			positional = append(positional, arg)
+		}
+	}
+	return positional, args
+}
+
+// argsSupported returns whether requests for method with the encoding can
+// set arguments, which uses the same encoding detection as NewSerializer.
+func argsSupported(e encoding.Encoding, method string) bool {
+	switch e {
+	case encoding.Thrift, encoding.JSON:
+		return true
+	case encoding.UnspecifiedEncoding:
+		return strings.Contains(method, "::")
+	}
+	return false
+}
+
+// applyArgs sets the name=value arguments as top-level fields of the request
+// input, so simple requests don't need JSON quoted for the shell.
+func applyArgs(serializer encoding.Serializer, reqInput []byte, args []string) ([]byte, error) {
+	codec, ok := newRequestCodec(serializer)
+	if !ok {
+		return nil, errArgsEncoding
+	}
+
+	req, err := codec.unmarshal(reqInput)
+	if err != nil {
+		return nil, fmt.Errorf("cannot set arguments of the request: %v", err)
+	}
+	if req == nil {
+		req = make(map[string]interface{})
+	}
+
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid argument %q, expected name=value", arg)
+		}
+
+		name, value := parts[0], parts[1]
+		if encoding.IsStringArg(serializer, name) {
+			req[name] = value
+			continue
+		}
+		if req[name], err = codec.parseValue(value); err != nil {
+			return nil, fmt.Errorf("invalid argument %q: %v", arg, err)
+		}
+	}
+	return codec.marshal(req)
+}
@@ -0,0 +1,217 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yarpc/yab/encoding"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitPositionalArgs(t *testing.T) {
+	tests := []struct {
+		msg            string
+		remaining      []string
+		opts           RequestOptions
+		wantPositional []string
+		wantArgs       []string
+	}{
+		{
+			msg:            "Thrift method",
+			remaining:      []string{"keyvalue", "KeyValue::get", "key=foo", `{"a": "b=c"}`, "user_id=5", "=x"},
+			wantPositional: []string{"keyvalue", "KeyValue::get", `{"a": "b=c"}`, "=x"},
+			wantArgs:       []string{"key=foo", "user_id=5"},
+		},
+		{
+			msg:            "JSON encoding",
+			remaining:      []string{"svc", "method", "id=5"},
+			opts:           RequestOptions{Encoding: encoding.JSON},
+			wantPositional: []string{"svc", "method"},
+			wantArgs:       []string{"id=5"},
+		},
+		{
+			msg:            "method from flags",
+			remaining:      []string{"svc", "", "id=5"},
+			opts:           RequestOptions{MethodName: "Svc::method"},
+			wantPositional: []string{"svc", ""},
+			wantArgs:       []string{"id=5"},
+		},
+		{
+			msg:            "raw body containing =",
+			remaining:      []string{"svc", "method", "user=bob&x=1"},
+			opts:           RequestOptions{Encoding: encoding.Raw},
+			wantPositional: []string{"svc", "method", "user=bob&x=1"},
+		},
+		{
+			msg:            "unspecified encoding without a Thrift method",
+			remaining:      []string{"svc", "method", "user=bob"},
+			wantPositional: []string{"svc", "method", "user=bob"},
+		},
+		{
+			msg:            "service and method are not arguments",
+			remaining:      []string{"svc=a", "Svc::method=b"},
+			wantPositional: []string{"svc=a", "Svc::method=b"},
+		},
+	}
+
+	for _, tt := range tests {
+		positional, args := splitPositionalArgs(tt.remaining, tt.opts)
+		assert.Equal(t, tt.wantPositional, positional, "%v: unexpected positional arguments", tt.msg)
+		assert.Equal(t, tt.wantArgs, args, "%v: unexpected request arguments", tt.msg)
+	}
+}
+
+func TestRawBodyWithEquals(t *testing.T) {
+	origArgs := os.Args
+	defer func() { os.Args = origArgs }()
+
+	// A raw body that looks like name=value is still sent as the body.
+	os.Args = []string{
+		"yab",
+		"-e", "raw",
+		"foo", fooMethod,
+		"user=bob&x=1",
+		"-p", echoServer(t, fooMethod, nil),
+	}
+
+	var errBuf, outBuf bytes.Buffer
+	out := testOutput{
+		Buffer: &outBuf,
+		fatalf: func(format string, args ...interface{}) {
+			errBuf.WriteString(fmt.Sprintf(format, args...))
+		},
+	}
+
+	runComplete := make(chan struct{})
+	go func() {
+		defer close(runComplete)
+		parseAndRun(out)
+	}()
+	<-runComplete
+
+	assert.Empty(t, errBuf.String(), "raw call should not fail")
+	// Raw bodies are rendered as base64 in the JSON output.
+	wantBody := base64.StdEncoding.EncodeToString([]byte("user=bob&x=1"))
+	assert.Contains(t, outBuf.String(), wantBody, "raw body should be echoed")
+}
+
+func TestApplyArgsThrift(t *testing.T) {
+	dir, err := ioutil.TempDir("", "args")
+	require.NoError(t, err, "TempDir failed")
+	defer os.RemoveAll(dir)
+
+	thriftFile := filepath.Join(dir, "args.thrift")
+	require.NoError(t, ioutil.WriteFile(thriftFile, []byte(`
+		typedef string UUID
+		struct Filter {
+			1: string name
+		}
+		service Users {
+			void find(1: i64 id, 2: string name, 3: UUID uuid, 4: bool active, 5: list<i32> ids, 6: Filter filter)
+		}
+	`), 0644), "WriteFile failed")
+
+	serializer, err := NewSerializer(RequestOptions{ThriftFile: thriftFile, MethodName: "Users::find"})
+	require.NoError(t, err, "Failed to create serializer")
+
+	tests := []struct {
+		msg      string
+		reqInput string
+		args     []string
+		want     string
+		wantErr  string
+	}{
+		{
+			msg:  "scalars",
+			args: []string{"id=5", "name=foo", "active=true"},
+			want: `{"id": 5, "name": "foo", "active": true}`,
+		},
+		{
+			msg:  "string arguments are not parsed",
+			args: []string{"name=5", "uuid=true"},
+			want: `{"name": "5", "uuid": "true"}`,
+		},
+		{
+			msg:  "lists and structs",
+			args: []string{"ids=[1, 2]", "filter={name: bar}"},
+			want: `{"ids": [1, 2], "filter": {"name": "bar"}}`,
+		},
+		{
+			msg:      "overrides request",
+			reqInput: `{"id": 1, "name": "foo"}`,
+			args:     []string{"id=2", "name=a=b"},
+			want:     `{"id": 2, "name": "a=b"}`,
+		},
+		{
+			msg:      "constant request",
+			reqInput: "SomeConst",
+			args:     []string{"id=2"},
+			wantErr:  "cannot set arguments of the request",
+		},
+		{
+			msg:     "invalid value",
+			args:    []string{"ids=[1"},
+			wantErr: `invalid argument "ids=[1"`,
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := applyArgs(serializer, []byte(tt.reqInput), tt.args)
+		if tt.wantErr != "" {
+			if assert.Error(t, err, "%v: expected error", tt.msg) {
+				assert.Contains(t, err.Error(), tt.wantErr, "%v: unexpected error", tt.msg)
+			}
+			continue
+		}
+		require.NoError(t, err, "%v: applyArgs failed", tt.msg)
+
+		gotReq, err := serializer.Request(got)
+		require.NoError(t, err, "%v: failed to serialize request %s", tt.msg, got)
+		wantReq, err := serializer.Request([]byte(tt.want))
+		require.NoError(t, err, "%v: failed to serialize expected request", tt.msg)
+		assert.Equal(t, wantReq.Body, gotReq.Body, "%v: unexpected request %s", tt.msg, got)
+	}
+}
+
+func TestApplyArgsJSON(t *testing.T) {
+	serializer := encoding.NewJSON("method")
+
+	got, err := applyArgs(serializer, []byte(`{"a": 1, "b": {"c": true}}`), []string{"a=2", "d=foo", "e=[1,2]", `f="5"`, "g=1 2"})
+	require.NoError(t, err, "applyArgs failed")
+	assert.JSONEq(t, `{"a": 2, "b": {"c": true}, "d": "foo", "e": [1, 2], "f": "5", "g": "1 2"}`, string(got), "Unexpected request")
+
+	_, err = applyArgs(serializer, []byte("{"), []string{"a=1"})
+	assert.Error(t, err, "Expected invalid JSON request to fail")
+}
+
+func TestApplyArgsRaw(t *testing.T) {
+	_, err := applyArgs(encoding.NewRaw("method"), nil, []string{"a=1"})
+	assert.Equal(t, errArgsEncoding, err, "Expected raw encoding to fail")
+}
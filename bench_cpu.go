@@ -0,0 +1,114 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxCPU is the number of CPUs that can be used with --cpu-affinity, which
+// matches the size of glibc's cpu_set_t.
+const maxCPU = 1024
+
+var (
+	errCPUAffinityUnsupported = errors.New("only supported on Linux")
+	errNiceUnsupported        = errors.New("not supported on Windows")
+	errNiceRange              = errors.New("--nice must be between -20 and 19")
+)
+
+// parseCPUList parses a list of CPUs in the format used by taskset and
+// /sys/devices/system/cpu, e.g. 0-3,8,10-11.
+func parseCPUList(s string) ([]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var (
+		cpus []int
+		seen = make(map[int]bool)
+	)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		from, to := part, part
+		if i := strings.Index(part, "-"); i >= 0 {
+			from, to = part[:i], part[i+1:]
+		}
+
+		first, err := parseCPU(from)
+		if err != nil {
+			return nil, err
+		}
+		last, err := parseCPU(to)
+		if err != nil {
+			return nil, err
+		}
+		if last < first {
+			return nil, fmt.Errorf("invalid CPU range %q", part)
+		}
+
+		for cpu := first; cpu <= last; cpu++ {
+			if !seen[cpu] {
+				seen[cpu] = true
+				cpus = append(cpus, cpu)
+			}
+		}
+	}
+	return cpus, nil
+}
+
+func parseCPU(s string) (int, error) {
+	cpu, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || cpu < 0 {
+		return 0, fmt.Errorf("invalid CPU %q", s)
+	}
+	if cpu >= maxCPU {
+		return 0, fmt.Errorf("CPU %v is out of range, must be less than %v", cpu, maxCPU)
+	}
+	return cpu, nil
+}
+
+// setScheduling pins yab to the --cpu-affinity CPUs and sets its niceness,
+// so a benchmark sharing a host with other workloads has stable results.
+// It returns the pinned CPUs, if any.
+func (o BenchmarkOptions) setScheduling() ([]int, error) {
+	cpus, err := parseCPUList(o.CPUAffinity)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --cpu-affinity: %v", err)
+	}
+	if len(cpus) > 0 {
+		if err := setCPUAffinity(cpus); err != nil {
+			return nil, fmt.Errorf("--cpu-affinity: %v", err)
+		}
+	}
+
+	if o.Nice != 0 {
+		if o.Nice < -20 || o.Nice > 19 {
+			return nil, errNiceRange
+		}
+		if err := setNice(o.Nice); err != nil {
+			return nil, fmt.Errorf("--nice: %v", err)
+		}
+	}
+	return cpus, nil
+}
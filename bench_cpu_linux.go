@@ -0,0 +1,109 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+// setCPUAffinity pins every thread of the process to the given CPUs.
+func setCPUAffinity(cpus []int) error {
+	var mask [maxCPU / 64]uint64
+	for _, cpu := range cpus {
+		mask[cpu/64] |= 1 << uint(cpu%64)
+	}
+
+	return forEachThread(func(tid int) error {
+		_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY,
+			uintptr(tid), uintptr(len(mask)*8), uintptr(unsafe.Pointer(&mask[0])))
+		if errno != 0 {
+			return errno
+		}
+		return nil
+	})
+}
+
+// setNice sets the niceness of every thread of the process.
+func setNice(nice int) error {
+	return forEachThread(func(tid int) error {
+		return syscall.Setpriority(syscall.PRIO_PROCESS, tid, nice)
+	})
+}
+
+// forEachThread calls f for each thread of the process, since Linux
+// applies CPU affinity and niceness to threads rather than processes. New
+// threads inherit these from the thread that created them, so the threads
+// are listed until there are no new threads.
+func forEachThread(f func(tid int) error) error {
+	done := make(map[int]bool)
+	for {
+		tids, err := threadIDs()
+		if err != nil {
+			return err
+		}
+
+		updated := false
+		for _, tid := range tids {
+			if done[tid] {
+				continue
+			}
+			if err := f(tid); err != nil {
+				// The thread may have exited since it was listed.
+				if err == syscall.ESRCH {
+					continue
+				}
+				return err
+			}
+			done[tid] = true
+			updated = true
+		}
+		if !updated {
+			return nil
+		}
+	}
+}
+
+func threadIDs() ([]int, error) {
+	dir, err := os.Open("/proc/self/task")
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+
+	names, err := dir.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+
+	tids := make([]int, 0, len(names))
+	for _, name := range names {
+		if tid, err := strconv.Atoi(name); err == nil {
+			tids = append(tids, tid)
+		}
+	}
+	return tids, nil
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"syscall"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getCPUAffinity(t *testing.T, tid int) []int {
+	var mask [maxCPU / 64]uint64
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_GETAFFINITY,
+		uintptr(tid), uintptr(len(mask)*8), uintptr(unsafe.Pointer(&mask[0])))
+	require.Equal(t, syscall.Errno(0), errno, "sched_getaffinity failed")
+
+	var cpus []int
+	for cpu := 0; cpu < maxCPU; cpu++ {
+		if mask[cpu/64]&(1<<uint(cpu%64)) != 0 {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus
+}
+
+func TestSetCPUAffinity(t *testing.T) {
+	allowed := getCPUAffinity(t, 0)
+	require.NotEmpty(t, allowed, "No CPUs allowed")
+
+	// Restore the original affinity so other tests aren't affected.
+	defer func() {
+		assert.NoError(t, setCPUAffinity(allowed), "Failed to restore CPU affinity")
+	}()
+
+	pinned := allowed[:1]
+	require.NoError(t, setCPUAffinity(pinned), "setCPUAffinity failed")
+
+	tids, err := threadIDs()
+	require.NoError(t, err, "threadIDs failed")
+	assert.NotEmpty(t, tids, "Expected threads")
+	for _, tid := range tids {
+		assert.Equal(t, pinned, getCPUAffinity(t, tid), "Thread %v is not pinned", tid)
+	}
+}
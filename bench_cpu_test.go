@@ -0,0 +1,77 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCPUList(t *testing.T) {
+	tests := []struct {
+		list    string
+		want    []int
+		wantErr string
+	}{
+		{list: "", want: nil},
+		{list: "0", want: []int{0}},
+		{list: "0-3,8", want: []int{0, 1, 2, 3, 8}},
+		{list: " 2 , 0-1, 1-2 ", want: []int{2, 0, 1}},
+		{list: "1023", want: []int{1023}},
+		{list: "a", wantErr: `invalid CPU "a"`},
+		{list: "-1", wantErr: `invalid CPU ""`},
+		{list: "1,", wantErr: `invalid CPU ""`},
+		{list: "3-1", wantErr: `invalid CPU range "3-1"`},
+		{list: "0-1024", wantErr: "CPU 1024 is out of range, must be less than 1024"},
+	}
+
+	for _, tt := range tests {
+		got, err := parseCPUList(tt.list)
+		if tt.wantErr != "" {
+			assert.EqualError(t, err, tt.wantErr, "parseCPUList(%q) error mismatch", tt.list)
+			continue
+		}
+		if assert.NoError(t, err, "parseCPUList(%q) failed", tt.list) {
+			assert.Equal(t, tt.want, got, "parseCPUList(%q) mismatch", tt.list)
+		}
+	}
+}
+
+func TestSetSchedulingErrors(t *testing.T) {
+	tests := []struct {
+		opts    BenchmarkOptions
+		wantErr string
+	}{
+		{BenchmarkOptions{CPUAffinity: "x"}, `invalid --cpu-affinity: invalid CPU "x"`},
+		{BenchmarkOptions{Nice: 20}, "--nice must be between -20 and 19"},
+		{BenchmarkOptions{Nice: -21}, "--nice must be between -20 and 19"},
+	}
+
+	for _, tt := range tests {
+		_, err := tt.opts.setScheduling()
+		assert.EqualError(t, err, tt.wantErr, "setScheduling(%+v) error mismatch", tt.opts)
+	}
+
+	cpus, err := BenchmarkOptions{}.setScheduling()
+	assert.NoError(t, err, "setScheduling without options failed")
+	assert.Empty(t, cpus, "Expected no pinned CPUs")
+}
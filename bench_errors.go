@@ -0,0 +1,180 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yarpc/yab/transport"
+)
+
+// errorSamples saves the first failed calls of a benchmark to a directory,
+// so failures that are only seen under load can be reproduced afterwards.
+// Each run saves its samples to a new directory named after the time it
+// started, and each sample is saved to a numbered directory within it
+// containing the serialized request, the response body if there was a
+// response, and the details of the call in sample.json.
+type errorSamples struct {
+	dir   string
+	limit int64
+	count int64
+
+	mu       sync.Mutex
+	saved    int
+	writeErr error
+}
+
+// errorSample is the details of a failed call saved in sample.json.
+type errorSample struct {
+	Target          string            `json:"target"`
+	Method          string            `json:"method"`
+	Peer            string            `json:"peer,omitempty"`
+	Time            time.Time         `json:"time"`
+	LatencyMs       float64           `json:"latencyMs"`
+	TimeoutMs       float64           `json:"timeoutMs"`
+	Error           string            `json:"error"`
+	RequestHeaders  map[string]string `json:"requestHeaders,omitempty"`
+	ResponseHeaders map[string]string `json:"responseHeaders,omitempty"`
+	Truncated       bool              `json:"truncated,omitempty"`
+}
+
+// newErrorSamples returns errorSamples that saves up to limit samples to a
+// new directory in dir, or nil if samples are disabled. Using a directory per
+// run means samples from earlier runs are never mixed with or overwritten by
+// this run's samples.
+func newErrorSamples(dir string, limit int) (*errorSamples, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create error samples directory: %v", err)
+	}
+	runDir, err := ioutil.TempDir(dir, time.Now().Format("20060102-150405-"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create error samples directory: %v", err)
+	}
+	return &errorSamples{dir: runDir, limit: int64(limit)}, nil
+}
+
+// forTarget returns the errorSampler used by the workers for a target.
+func (s *errorSamples) forTarget(name string) *errorSampler {
+	if s == nil {
+		return nil
+	}
+	return &errorSampler{s, name}
+}
+
+// print prints the number of samples saved, and any error saving them. The
+// run's directory is removed if no samples were saved.
+func (s *errorSamples) print(logger *logger) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.writeErr != nil {
+		logger.Warnf("failed to save error samples: %v", s.writeErr)
+	}
+	if s.saved > 0 {
+		logger.Infof("saved %v error samples to %v", s.saved, s.dir)
+		return
+	}
+	os.Remove(s.dir)
+}
+
+// errorSampler saves error samples for a single target.
+type errorSampler struct {
+	*errorSamples
+	target string
+}
+
+// record saves a sample for the failed call to peer, unless the limit has
+// been reached. The peer is recorded even if the call failed without a
+// response. It must be called before the response is released.
+func (s *errorSampler) record(req *transport.Request, peer string, res *transport.Response, latency time.Duration, callErr error) {
+	if s == nil {
+		return
+	}
+
+	n := atomic.AddInt64(&s.count, 1)
+	if n > s.limit {
+		return
+	}
+
+	sample := errorSample{
+		Target:         s.target,
+		Method:         req.Method,
+		Peer:           peer,
+		Time:           time.Now(),
+		LatencyMs:      float64(latency) / float64(time.Millisecond),
+		TimeoutMs:      float64(req.Timeout) / float64(time.Millisecond),
+		Error:          callErr.Error(),
+		RequestHeaders: secrets.redactHeaders(req.Headers),
+	}
+	if res != nil {
+		if res.Peer != "" {
+			sample.Peer = res.Peer
+		}
+		sample.ResponseHeaders = res.Headers
+		sample.Truncated = res.Truncated
+	}
+
+	err := s.write(filepath.Join(s.dir, fmt.Sprintf("%04d", n)), sample, req, res)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		if s.writeErr == nil {
+			s.writeErr = err
+		}
+		return
+	}
+	s.saved++
+}
+
+func (s *errorSampler) write(dir string, sample errorSample, req *transport.Request, res *transport.Response) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	details, err := json.MarshalIndent(sample, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "sample.json"), details, 0644); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "request.bin"), req.Body, 0644); err != nil {
+		return err
+	}
+	if res != nil {
+		return ioutil.WriteFile(filepath.Join(dir, "response.bin"), res.Body, 0644)
+	}
+	return nil
+}
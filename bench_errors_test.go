@@ -0,0 +1,154 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yarpc/yab/transport"
+)
+
+func TestBenchmarkErrorSamples(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yab-errors")
+	require.NoError(t, err, "TempDir failed")
+	defer os.RemoveAll(dir)
+
+	// Fail every call after the warm up requests.
+	const connections = 2
+	var requests int32
+	s := newServer(t)
+	defer s.shutdown()
+	s.register(fooMethod, methods.errorIf(func() bool {
+		return atomic.AddInt32(&requests, 1) > connections*warmupRequests
+	}))
+
+	m := benchmarkMethodForTest(t, fooMethod)
+	buf, out := getOutput(t)
+	runBenchmark(out, Options{
+		ROpts: RequestOptions{MethodName: fooMethod},
+		BOpts: BenchmarkOptions{
+			MaxRequests:     20,
+			MaxDuration:     time.Second,
+			Connections:     connections,
+			Concurrency:     1,
+			ErrorSamples:    3,
+			ErrorSamplesDir: dir,
+		},
+		TOpts: s.transportOpts(),
+	}, m)
+
+	runs, err := ioutil.ReadDir(dir)
+	require.NoError(t, err, "ReadDir failed")
+	require.Len(t, runs, 1, "samples should be saved to a directory for the run")
+	runDir := filepath.Join(dir, runs[0].Name())
+	assert.Contains(t, buf.String(), "Note: saved 3 error samples to "+runDir+"\n")
+
+	samples, err := ioutil.ReadDir(runDir)
+	require.NoError(t, err, "ReadDir failed")
+	require.Len(t, samples, 3, "unexpected number of samples")
+	for i, name := range []string{"0001", "0002", "0003"} {
+		assert.Equal(t, name, samples[i].Name(), "unexpected sample directory")
+
+		details, err := ioutil.ReadFile(filepath.Join(runDir, name, "sample.json"))
+		require.NoError(t, err, "failed to read sample.json")
+		var sample errorSample
+		require.NoError(t, json.Unmarshal(details, &sample), "failed to parse sample.json")
+		assert.Equal(t, fooMethod, sample.Target, "unexpected target")
+		assert.Equal(t, fooMethod, sample.Method, "unexpected method")
+		assert.Contains(t, sample.Error, "error", "unexpected error")
+		assert.Equal(t, float64(1000), sample.TimeoutMs, "unexpected timeout")
+		assert.Equal(t, s.hostPort(), sample.Peer, "unexpected peer")
+
+		body, err := ioutil.ReadFile(filepath.Join(runDir, name, "request.bin"))
+		require.NoError(t, err, "failed to read request.bin")
+		assert.Equal(t, m.req.Body, body, "unexpected request body")
+	}
+}
+
+func TestErrorSampler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yab-errors")
+	require.NoError(t, err, "TempDir failed")
+	defer os.RemoveAll(dir)
+
+	samples, err := newErrorSamples(dir, 2)
+	require.NoError(t, err, "newErrorSamples failed")
+	sampler := samples.forTarget("target")
+
+	req := &transport.Request{Method: "Svc::m", Body: []byte{1, 2}, Timeout: time.Second}
+	res := &transport.Response{Body: []byte{3}, Headers: map[string]string{"k": "v"}, Peer: "1.1.1.1:1"}
+	sampler.record(req, "1.1.1.1:1", res, 1500*time.Microsecond, errors.New("app error"))
+	sampler.record(req, "2.2.2.2:2", nil, time.Millisecond, errors.New("connection refused"))
+	sampler.record(req, "1.1.1.1:1", res, time.Millisecond, errors.New("over the limit"))
+
+	details, err := ioutil.ReadFile(filepath.Join(samples.dir, "0001", "sample.json"))
+	require.NoError(t, err, "failed to read sample.json")
+	var sample errorSample
+	require.NoError(t, json.Unmarshal(details, &sample), "failed to parse sample.json")
+	assert.Equal(t, "target", sample.Target, "unexpected target")
+	assert.Equal(t, "1.1.1.1:1", sample.Peer, "unexpected peer")
+	assert.Equal(t, 1.5, sample.LatencyMs, "unexpected latency")
+	assert.Equal(t, "app error", sample.Error, "unexpected error")
+	assert.Equal(t, map[string]string{"k": "v"}, sample.ResponseHeaders, "unexpected response headers")
+
+	body, err := ioutil.ReadFile(filepath.Join(samples.dir, "0001", "response.bin"))
+	require.NoError(t, err, "failed to read response.bin")
+	assert.Equal(t, []byte{3}, body, "unexpected response body")
+
+	// The peer is saved for calls that failed without a response.
+	details, err = ioutil.ReadFile(filepath.Join(samples.dir, "0002", "sample.json"))
+	require.NoError(t, err, "failed to read sample.json")
+	sample = errorSample{}
+	require.NoError(t, json.Unmarshal(details, &sample), "failed to parse sample.json")
+	assert.Equal(t, "2.2.2.2:2", sample.Peer, "unexpected peer for a transport error")
+	assert.Equal(t, "connection refused", sample.Error, "unexpected error")
+	_, err = os.Stat(filepath.Join(samples.dir, "0002", "response.bin"))
+	assert.True(t, os.IsNotExist(err), "response.bin should not be saved without a response")
+
+	_, err = os.Stat(filepath.Join(samples.dir, "0003"))
+	assert.True(t, os.IsNotExist(err), "samples over the limit should not be saved")
+
+	// Each run saves samples to a new directory.
+	next, err := newErrorSamples(dir, 1)
+	require.NoError(t, err, "newErrorSamples failed")
+	assert.NotEqual(t, samples.dir, next.dir, "each run should use a new directory")
+	assert.Equal(t, dir, filepath.Dir(next.dir), "run directories should be in the samples directory")
+
+	// The run's directory is removed if no samples were saved.
+	_, out := getOutput(t)
+	next.print(newLogger(Options{}, out))
+	_, err = os.Stat(next.dir)
+	assert.True(t, os.IsNotExist(err), "empty run directory should be removed")
+
+	// Samples are disabled by default.
+	disabled, err := newErrorSamples(dir, 0)
+	require.NoError(t, err, "newErrorSamples failed")
+	assert.Nil(t, disabled.forTarget("target"), "disabled samples should return a nil sampler")
+	disabled.forTarget("target").record(req, "", res, time.Millisecond, errors.New("ignored"))
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// lagCheckInterval is how often the number of requests sent is compared
+// with the number the requested RPS should have sent.
+const lagCheckInterval = time.Second
+
+// minCalibratedRPS is the lowest rate that --auto-calibrate lowers the RPS to.
+const minCalibratedRPS = 1
+
+// generatorLag tracks how far the workers are behind the schedule set by
+// --rps while the benchmark is running. If the workers fall behind, it warns,
+// or with --auto-calibrate, lowers the RPS to the rate that was achieved.
+type generatorLag struct {
+	// scale is the float64 bits of the fraction of the requested RPS that
+	// the limiters use. It is only lowered when auto-calibrating.
+	scale uint64
+
+	rps       float64
+	calibrate bool
+	logger    *logger
+	workers   []*workerToken
+	stopped   chan struct{}
+	done      chan struct{}
+
+	// The remaining fields are only used by the watch goroutine.
+	lastSent int64
+	behind   time.Duration
+	warned   bool
+}
+
+// newGeneratorLag returns a generatorLag for the requested RPS, or nil if the
+// RPS is not limited, as there is no schedule to fall behind.
+func newGeneratorLag(rps int, calibrate bool, logger *logger) *generatorLag {
+	if rps <= 0 {
+		return nil
+	}
+
+	return &generatorLag{
+		scale:     math.Float64bits(1),
+		rps:       float64(rps),
+		calibrate: calibrate,
+		logger:    logger,
+		stopped:   make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// track adds a worker whose requests are counted. It must be called
+// before start.
+func (g *generatorLag) track(w *workerToken) {
+	if g != nil {
+		g.workers = append(g.workers, w)
+	}
+}
+
+// rate returns a rate for ratelimit.NewVariable that is the given share of
+// the requested RPS, scaled down when auto-calibrating.
+func (g *generatorLag) rate(rps int) func(time.Duration) float64 {
+	return func(time.Duration) float64 {
+		return float64(rps) * g.getScale()
+	}
+}
+
+func (g *generatorLag) getScale() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&g.scale))
+}
+
+func (g *generatorLag) start() {
+	if g != nil {
+		go g.watch()
+	}
+}
+
+func (g *generatorLag) watch() {
+	defer close(g.done)
+
+	ticker := time.NewTicker(lagCheckInterval)
+	defer ticker.Stop()
+
+	last := time.Now()
+	for {
+		select {
+		case <-g.stopped:
+			return
+		case now := <-ticker.C:
+			g.check(g.sent(), now.Sub(last))
+			last = now
+		}
+	}
+}
+
+// sent returns the number of requests that the workers have sent.
+func (g *generatorLag) sent() int64 {
+	var sent int64
+	for _, w := range g.workers {
+		sent += atomic.LoadInt64(&w.sent)
+	}
+	return sent
+}
+
+// check compares the requests sent during the last interval with the number
+// that should have been sent, and adds the difference to the time that the
+// workers are behind schedule.
+func (g *generatorLag) check(sent int64, interval time.Duration) {
+	rps := g.rps * g.getScale()
+	want := rps * interval.Seconds()
+	got := float64(sent - g.lastSent)
+	g.lastSent = sent
+
+	g.behind += time.Duration((want - got) / rps * float64(time.Second))
+	if g.behind < 0 {
+		g.behind = 0
+	}
+	if got >= minAchievedRPSRatio*want {
+		return
+	}
+
+	achieved := got / interval.Seconds()
+	if g.calibrate {
+		calibrated := math.Max(achieved, minCalibratedRPS)
+		atomic.StoreUint64(&g.scale, math.Float64bits(calibrated/g.rps))
+		g.behind = 0
+		g.logger.Warnf("only sent %.2f RPS of the requested %.2f RPS, lowering the rate to %.2f RPS", achieved, rps, calibrated)
+		return
+	}
+
+	if !g.warned {
+		g.warned = true
+		g.logger.Warnf("the client is %v behind schedule, and only sent %.2f RPS of the requested %.2f RPS, "+
+			"so latencies may be misleading. Try increasing --connections or --concurrency, lowering --rps, "+
+			"or using --auto-calibrate.", g.behind, achieved, rps)
+	}
+}
+
+// stop stops watching the workers, and returns the RPS the limiters were
+// using at the end of the run.
+func (g *generatorLag) stop() float64 {
+	if g == nil {
+		return 0
+	}
+
+	close(g.stopped)
+	<-g.done
+	return g.rps * g.getScale()
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeneratorLagNoRPS(t *testing.T) {
+	_, out := getOutput(t)
+	lag := newGeneratorLag(0, true, newLogger(Options{}, out))
+	assert.Nil(t, lag, "Expected no lag tracking without --rps")
+
+	// A nil generatorLag should be safe to use.
+	lag.track(&workerToken{})
+	lag.start()
+	assert.Equal(t, 0.0, lag.stop(), "Expected no calibrated RPS")
+}
+
+func TestGeneratorLagWarns(t *testing.T) {
+	buf, out := getOutput(t)
+	lag := newGeneratorLag(100, false, newLogger(Options{}, out))
+
+	lag.check(95, time.Second)
+	assert.Empty(t, buf.String(), "Unexpected warning when keeping up")
+
+	lag.check(145, time.Second)
+	assert.Equal(t, 550*time.Millisecond, lag.behind, "Lag should accumulate across ticks")
+	assert.Contains(t, buf.String(), "the client is 550ms behind schedule, and only sent 50.00 RPS of the requested 100.00 RPS",
+		"Expected warning while running")
+
+	buf.Reset()
+	lag.check(150, time.Second)
+	assert.Empty(t, buf.String(), "Should only warn once")
+	assert.Equal(t, 1.0, lag.getScale(), "RPS should not change without --auto-calibrate")
+}
+
+func TestGeneratorLagCalibrates(t *testing.T) {
+	buf, out := getOutput(t)
+	lag := newGeneratorLag(1000, true, newLogger(Options{}, out))
+	rate := lag.rate(250)
+
+	lag.check(400, time.Second)
+	assert.Contains(t, buf.String(), "only sent 400.00 RPS of the requested 1000.00 RPS, lowering the rate to 400.00 RPS",
+		"Expected calibration warning")
+	assert.InDelta(t, 100, rate(0), 0.001, "Shard rate should be scaled down")
+	assert.Equal(t, time.Duration(0), lag.behind, "Lag should reset after calibrating")
+
+	// The calibrated rate is the new schedule.
+	buf.Reset()
+	lag.check(800, time.Second)
+	assert.Empty(t, buf.String(), "Unexpected warning after calibrating")
+
+	lag.check(800, time.Second)
+	assert.Contains(t, buf.String(), "lowering the rate to 1.00 RPS", "RPS should not be calibrated below the minimum")
+	assert.InDelta(t, 0.001, lag.getScale(), 1e-9, "Unexpected calibrated RPS")
+}
+
+func TestGeneratorLagCountsWorkers(t *testing.T) {
+	_, out := getOutput(t)
+	lag := newGeneratorLag(100, false, newLogger(Options{}, out))
+
+	rt := newRunToken(10, 2, time.Hour)
+	workers := []*workerToken{
+		{run: rt, limiter: newLimiters(0, 1)[0]},
+		{run: rt, limiter: newLimiters(0, 1)[0]},
+	}
+	for _, w := range workers {
+		lag.track(w)
+	}
+
+	for i := 0; i < 3; i++ {
+		for _, w := range workers {
+			assert.True(t, w.More(), "Expected more requests")
+		}
+	}
+	assert.EqualValues(t, 6, lag.sent(), "Expected requests sent by all workers to be counted")
+
+	lag.start()
+	assert.Equal(t, 100.0, lag.stop(), "Expected the requested RPS")
+}
@@ -33,6 +33,40 @@ const warmupRequests = 10
 type benchmarkMethod struct {
 	serializer encoding.Serializer
 	req        *transport.Request
+
+	// timeout picks the timeout for each call, if set, instead of using the
+	// request's timeout.
+	timeout func() time.Duration
+
+	// template renders the requests, if set. Workers set nextRequest to
+	// return requests from a pool of rendered requests, or to render each
+	// request as it is sent.
+	template    *requestTemplate
+	nextRequest func() (*transport.Request, error)
+
+	// success are checked against each decoded response, in addition to
+	// the serializer's checks.
+	success []successCriterion
+
+	// validate returns whether to decode and validate a response, if set.
+	// Otherwise, every response is validated.
+	validate func() bool
+
+	// idempotencyKey is sent in idempotencyHeader with each logical request,
+	// if set, and is either a fixed key or auto.
+	idempotencyKey    string
+	idempotencyHeader string
+
+	// jwt adds a signed token to each logical request, if set.
+	jwt *jwtSigner
+
+	// clockAudit measures latencies using the monotonic clock, and records
+	// samples whose wall clock latency differs.
+	clockAudit bool
+
+	// serverTimingHeader is the response header that server-reported
+	// durations are read from, if set.
+	serverTimingHeader string
 }
 
 // WarmTransport warms up a transport and returns it. The transport is warmed
@@ -45,23 +79,77 @@ func (m benchmarkMethod) WarmTransport(opts TransportOptions) (transport.Transpo
 	}
 
 	for i := 0; i < warmupRequests; i++ {
-		_, err := makeRequest(transport, m.req)
+		res, err := makeRequest(transport, m.req)
 		if err != nil {
 			return nil, err
 		}
+		res.Release()
 	}
 
 	return transport, nil
 }
 
-func (m benchmarkMethod) call(t transport.Transport) (time.Duration, error) {
+// request returns the request for the next logical call, which is used for
+// every attempt of the call, so retries and shadow calls share its timeout
+// and idempotency key.
+func (m benchmarkMethod) request() (*transport.Request, error) {
+	req := m.req
+	if m.nextRequest != nil {
+		var err error
+		if req, err = m.nextRequest(); err != nil {
+			return nil, err
+		}
+	}
+	if m.timeout != nil {
+		timeoutReq := *req
+		timeoutReq.Timeout = m.timeout()
+		req = &timeoutReq
+	}
+	if m.idempotencyKey != "" {
+		req = withHeader(req, m.idempotencyHeader, newIdempotencyKey(m.idempotencyKey))
+	}
+	if m.jwt != nil {
+		return m.jwt.apply(req)
+	}
+	return req, nil
+}
+
+// call makes a call for the next request and checks whether the response is
+// a success. The response should be released once it is no longer used.
+func (m benchmarkMethod) call(t transport.Transport) (time.Duration, *transport.Response, error) {
+	req, err := m.request()
+	if err != nil {
+		return 0, nil, err
+	}
+	d, _, res, err := m.callRequest(t, req)
+	return d, res, err
+}
+
+// callRequest makes a call using req and checks whether the response is a
+// success. It also returns the peer chosen for the call, which is known
+// even if the call fails without a response.
+func (m benchmarkMethod) callRequest(t transport.Transport, req *transport.Request) (time.Duration, string, *transport.Response, error) {
 	start := time.Now()
-	res, err := makeRequest(t, m.req)
+	res, peer, err := makeRequestPeer(t, req)
 	duration := time.Since(start)
 
-	if err == nil {
-		err = m.serializer.CheckSuccess(res)
+	if err != nil || (m.validate != nil && !m.validate()) {
+		return duration, peer, res, err
 	}
+
+	if err = m.serializer.CheckSuccess(res); err == nil && len(m.success) > 0 {
+		err = checkSuccessCriteria(m.success, m.serializer, res)
+	}
+	return duration, peer, res, err
+}
+
+// callShadow makes a call but only checks for transport errors, since
+// shadow responses are not validated.
+func (m benchmarkMethod) callShadow(t transport.Transport, req *transport.Request) (time.Duration, error) {
+	start := time.Now()
+	res, err := makeRequest(t, req)
+	duration := time.Since(start)
+	res.Release()
 	return duration, err
 }
 
@@ -21,6 +21,9 @@
 package main
 
 import (
+	"math/rand"
+	"strconv"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -29,7 +32,9 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel-go/raw"
 	"github.com/uber/tchannel-go/testutils"
+	"golang.org/x/net/context"
 )
 
 func benchmarkMethodForTest(t *testing.T, methodString string) benchmarkMethod {
@@ -45,7 +50,7 @@ func benchmarkMethodForTest(t *testing.T, methodString string) benchmarkMethod {
 	require.NoError(t, err, "Failed to serialize Thrift body")
 
 	req.Timeout = time.Second
-	return benchmarkMethod{serializer, req}
+	return benchmarkMethod{serializer: serializer, req: req}
 }
 
 func TestBenchmarkMethodWarmTransport(t *testing.T) {
@@ -151,7 +156,7 @@ func TestBenchmarkMethodCall(t *testing.T) {
 			m.req.Method = tt.reqMethod
 		}
 
-		d, err := m.call(transport)
+		d, res, err := m.call(transport)
 		if tt.wantErr != "" {
 			if assert.Error(t, err, "call should fail") {
 				assert.Contains(t, err.Error(), tt.wantErr, "call should return 0 duration")
@@ -161,6 +166,7 @@ func TestBenchmarkMethodCall(t *testing.T) {
 
 		assert.NoError(t, err, "call should not fail")
 		assert.True(t, d > time.Microsecond, "duration was too short, got %v", d)
+		assert.Equal(t, s.hostPort(), res.Peer, "Unexpected peer")
 	}
 }
 
@@ -203,3 +209,65 @@ func TestBenchmarkMethodWarmTransportsError(t *testing.T) {
 		assert.Error(t, err, "WarmTransports should fail")
 	}
 }
+
+func TestValidateSampler(t *testing.T) {
+	validate := validateSampler(0.25, rand.New(rand.NewSource(1)))
+
+	validated := 0
+	for i := 0; i < 10000; i++ {
+		if validate() {
+			validated++
+		}
+	}
+	assert.InDelta(t, 2500, validated, 250, "Unexpected number of validated responses")
+}
+
+func TestBenchmarkValidateSampleRate(t *testing.T) {
+	var requests int32
+	s := newServer(t)
+	defer s.shutdown()
+
+	// Responses after the warm up are invalid, and fail validation.
+	s.register(fooMethod, func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		if atomic.AddInt32(&requests, 1) <= 10*warmupRequests {
+			return &raw.Res{Arg2: args.Arg2, Arg3: args.Arg3}, nil
+		}
+		return &raw.Res{Arg2: args.Arg2, Arg3: []byte{1, 1}}, nil
+	})
+
+	tests := []struct {
+		rate          sampleRate
+		wantMinErrors int
+		wantMaxErrors int
+	}{
+		{rate: 0, wantMinErrors: 200, wantMaxErrors: 200},
+		{rate: 1, wantMinErrors: 200, wantMaxErrors: 200},
+		{rate: 0.1, wantMinErrors: 1, wantMaxErrors: 60},
+	}
+
+	for _, tt := range tests {
+		atomic.StoreInt32(&requests, 0)
+
+		m := benchmarkMethodForTest(t, fooMethod)
+		buf, out := getOutput(t)
+		runBenchmark(out, Options{
+			BOpts: BenchmarkOptions{
+				MaxRequests:        200,
+				MaxDuration:        time.Second,
+				Connections:        10,
+				Concurrency:        1,
+				ValidateSampleRate: tt.rate,
+			},
+			TOpts: s.transportOpts(),
+		}, m)
+
+		var errors int
+		for _, line := range strings.Split(buf.String(), "\n") {
+			if strings.HasPrefix(line, "Total errors: ") {
+				errors, _ = strconv.Atoi(strings.TrimPrefix(line, "Total errors: "))
+			}
+		}
+		assert.True(t, errors >= tt.wantMinErrors && errors <= tt.wantMaxErrors,
+			"rate %v: got %v errors, expected between %v and %v", tt.rate, errors, tt.wantMinErrors, tt.wantMaxErrors)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/yarpc/yab/sorted"
+)
+
+// peerGroupKeys are the peer metadata keys that benchmark results are grouped by.
+var peerGroupKeys = []string{"zone", "dc"}
+
+// peerGroups contains the metadata for each peer, used to group benchmark results.
+type peerGroups struct {
+	// metadata is a map from the peer's host:port to its metadata.
+	metadata map[string]map[string]string
+
+	// keys are the group keys that are set on at least one peer.
+	keys []string
+}
+
+// getPeerGroups returns the peerGroups for the peer list, or nil if
+// none of the peers have metadata that results can be grouped by.
+func getPeerGroups(opts TransportOptions) *peerGroups {
+	if opts.HostPortFile == "" {
+		return nil
+	}
+
+	// Errors are ignored since the peer list has already been validated
+	// when creating the transport.
+	peers, err := parsePeerFile(opts.HostPortFile)
+	if err != nil {
+		return nil
+	}
+	peers, err = filterPeers(peers, opts.PeerFilters)
+	if err != nil || len(peers) == 0 {
+		return nil
+	}
+
+	// Transports report the peer after it has been normalized.
+	hostPorts, err := normalizeHostPorts(protocolFor(peers[0].HostPort), peerHostPorts(peers), opts)
+	if err != nil {
+		return nil
+	}
+
+	groups := &peerGroups{metadata: make(map[string]map[string]string)}
+	for i, p := range peers {
+		groups.metadata[hostPorts[i]] = p.Metadata
+	}
+
+	for _, key := range peerGroupKeys {
+		for _, p := range peers {
+			if _, ok := p.Metadata[key]; ok {
+				groups.keys = append(groups.keys, key)
+				break
+			}
+		}
+	}
+
+	if len(groups.keys) == 0 {
+		return nil
+	}
+	return groups
+}
+
+func (g *peerGroups) print(out output, peerLatencies map[string][]time.Duration) {
+	printLatencyGroups(out, "peer", peerLatencies)
+
+	for _, key := range g.keys {
+		grouped := make(map[string][]time.Duration)
+		for peer, latencies := range peerLatencies {
+			group, ok := g.metadata[peer][key]
+			if !ok {
+				group = "unknown"
+			}
+			grouped[group] = append(grouped[group], latencies...)
+		}
+		printLatencyGroups(out, key, grouped)
+	}
+}
+
+func printLatencyGroups(out output, groupName string, groups map[string][]time.Duration) {
+	out.Printf("Latencies by %v:\n", groupName)
+	for _, group := range sorted.MapKeys(groups) {
+		state := &benchmarkState{latencies: groups[group]}
+		sort.Sort(byDuration(state.latencies))
+		out.Printf("  %v: %v requests, p50: %v, p90: %v, p99: %v\n", group, len(state.latencies),
+			state.getQuantile(0.5), state.getQuantile(0.9), state.getQuantile(0.99))
+	}
+}
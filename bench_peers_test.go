@@ -0,0 +1,112 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetPeerGroups(t *testing.T) {
+	tests := []struct {
+		opts     TransportOptions
+		wantKeys []string
+	}{
+		{
+			opts: TransportOptions{HostPorts: []string{"1.1.1.1:1"}},
+		},
+		{
+			opts: TransportOptions{HostPortFile: "testdata/valid_peerlist.json"},
+		},
+		{
+			opts:     TransportOptions{HostPortFile: "testdata/valid_peerlist.csv"},
+			wantKeys: []string{"dc"},
+		},
+		{
+			opts:     TransportOptions{HostPortFile: "testdata/valid_peerlist_metadata.yaml"},
+			wantKeys: []string{"zone", "dc"},
+		},
+		{
+			opts: TransportOptions{HostPortFile: "testdata/valid_peerlist.csv", PeerFilters: []string{"dc=phx2"}},
+		},
+	}
+
+	for _, tt := range tests {
+		groups := getPeerGroups(tt.opts)
+		if tt.wantKeys == nil {
+			assert.Nil(t, groups, "getPeerGroups(%+v) should not have groups", tt.opts)
+			continue
+		}
+
+		if assert.NotNil(t, groups, "getPeerGroups(%+v) should have groups", tt.opts) {
+			assert.Equal(t, tt.wantKeys, groups.keys, "getPeerGroups(%+v) keys mismatch", tt.opts)
+		}
+	}
+}
+
+func TestPeerGroupsPrint(t *testing.T) {
+	groups := getPeerGroups(TransportOptions{HostPortFile: "testdata/valid_peerlist_metadata.yaml"})
+	require.NotNil(t, groups, "Expected peer groups")
+
+	buf, out := getOutput(t)
+	groups.print(out, map[string][]time.Duration{
+		"1.1.1.1:1": {time.Millisecond, 2 * time.Millisecond},
+		"2.2.2.2:2": {3 * time.Millisecond},
+		"3.3.3.3:3": {4 * time.Millisecond},
+	})
+
+	output := buf.String()
+	assert.Contains(t, output, "Latencies by peer:\n  1.1.1.1:1: 2 requests")
+	assert.Contains(t, output, "Latencies by zone:\n  a: 2 requests")
+	assert.Contains(t, output, "  unknown: 2 requests")
+	assert.Contains(t, output, "Latencies by dc:\n  dca1: 1 requests, p50: 3ms")
+	assert.Contains(t, output, "  sjc1: 2 requests")
+}
+
+func TestBenchmarkPeerGroups(t *testing.T) {
+	s := newServer(t)
+	defer s.shutdown()
+	s.register(fooMethod, methods.echo())
+
+	peerList := writeFile(t, "peers", "- hostPort: "+s.hostPort()+"\n  zone: z1\n")
+	defer os.Remove(peerList)
+
+	m := benchmarkMethodForTest(t, fooMethod)
+	buf, out := getOutput(t)
+	runBenchmark(out, Options{
+		BOpts: BenchmarkOptions{
+			MaxRequests: 100,
+			MaxDuration: time.Second,
+			Connections: 2,
+			Concurrency: 2,
+		},
+		TOpts: TransportOptions{
+			ServiceName:  "foo",
+			HostPortFile: peerList,
+		},
+	}, m)
+
+	assert.Contains(t, buf.String(), "Latencies by zone:\n  z1: 100 requests")
+}
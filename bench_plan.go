@@ -0,0 +1,200 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yarpc/yab/statsd"
+
+	"gopkg.in/yaml.v2"
+)
+
+var errNoPhases = errors.New("plan file must contain at least one phase")
+
+// phaseConfig is a single phase in a plan file. The method and request are
+// specified the same way as in a targets file, but headers override the
+// command line headers rather than replacing them, so phases can compare
+// cold and warm caches using headers such as Cache-Control.
+type phaseConfig struct {
+	targetConfig `yaml:",inline"`
+
+	Duration    string `yaml:"duration"`
+	RPS         int    `yaml:"rps"`
+	Connections int    `yaml:"connections"`
+	Concurrency int    `yaml:"concurrency"`
+	MaxRequests int    `yaml:"maxRequests"`
+}
+
+// benchmarkPhase is a benchmark run as part of a plan.
+type benchmarkPhase struct {
+	name   string
+	opts   Options
+	target benchmarkTarget
+}
+
+// loadPlan parses the YAML or JSON plan file at path, and returns the phases
+// to run. Any fields that are not specified for a phase use the values from
+// opts, phases without a request use the request from opts, and phase
+// headers are merged with the headers from opts.
+func loadPlan(path string, opts Options) ([]benchmarkPhase, error) {
+	contents, err := readFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open plan file: %v", err)
+	}
+
+	var configs []phaseConfig
+	if err := yaml.Unmarshal(contents, &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse plan file: %v", err)
+	}
+	if len(configs) == 0 {
+		return nil, errNoPhases
+	}
+
+	var request interface{}
+	if opts.ROpts.RequestJSON != "" || opts.ROpts.RequestFile != "" {
+		reqInput, err := getRequestInput(opts.ROpts.RequestJSON, opts.ROpts.RequestFile, opts.ROpts.RequestChecksum)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(reqInput, &request); err != nil {
+			return nil, fmt.Errorf("failed to parse request: %v", err)
+		}
+	}
+
+	headers, err := getHeaders(opts.ROpts.HeadersJSON, opts.ROpts.HeadersFile)
+	if err != nil {
+		return nil, err
+	}
+
+	phases := make([]benchmarkPhase, len(configs))
+	for i, config := range configs {
+		if config.Name == "" {
+			config.Name = fmt.Sprintf("phase %v", i+1)
+		}
+		phases[i], err = newBenchmarkPhase(config, opts, request, headers)
+		if err != nil {
+			return nil, fmt.Errorf("invalid phase %q: %v", config.Name, err)
+		}
+	}
+	return phases, nil
+}
+
+func newBenchmarkPhase(config phaseConfig, opts Options, request interface{}, headers map[string]string) (benchmarkPhase, error) {
+	if config.RPS < 0 || config.Connections < 0 || config.Concurrency < 0 || config.MaxRequests < 0 {
+		return benchmarkPhase{}, errors.New("rps, connections, concurrency and maxRequests must not be negative")
+	}
+
+	bOpts := &opts.BOpts
+	if config.Duration != "" {
+		d, err := time.ParseDuration(config.Duration)
+		if err != nil {
+			return benchmarkPhase{}, fmt.Errorf("invalid duration: %v", err)
+		}
+		bOpts.MaxDuration = d
+	}
+	if bOpts.MaxDuration <= 0 {
+		return benchmarkPhase{}, errors.New("duration must be set for the phase, or using --maxDuration")
+	}
+	if config.RPS > 0 {
+		bOpts.RPS = config.RPS
+	}
+	if config.Connections > 0 {
+		bOpts.Connections = config.Connections
+	}
+	if config.Concurrency > 0 {
+		bOpts.Concurrency = config.Concurrency
+	}
+	if config.MaxRequests > 0 {
+		bOpts.MaxRequests = config.MaxRequests
+	}
+
+	if config.Method == "" {
+		config.Method = opts.ROpts.MethodName
+	}
+	if config.Request == nil && config.RequestFile == "" {
+		config.Request = request
+	}
+	if config.Headers != nil {
+		config.Headers = mergePhaseHeaders(headers, config.Headers)
+	}
+
+	target, err := newBenchmarkTarget(config.targetConfig, opts)
+	if err != nil {
+		return benchmarkPhase{}, err
+	}
+	return benchmarkPhase{
+		name:   config.Name,
+		opts:   opts,
+		target: target,
+	}, nil
+}
+
+// mergePhaseHeaders returns the headers with the phase's overrides applied.
+// An empty value removes the header, e.g. to stop sending Cache-Control.
+func mergePhaseHeaders(headers, overrides map[string]string) map[string]string {
+	merged := make(map[string]string, len(headers)+len(overrides))
+	for k, v := range headers {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		if v == "" {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = v
+	}
+	return merged
+}
+
+// runPlan runs each phase of the plan in order, and prints a table comparing
+// the phases, and the combined results of all phases.
+func runPlan(out output, opts Options) {
+	var err error
+	opts.ROpts.ThriftFile, err = registryThriftFile(opts.ROpts, opts.TOpts.ServiceName)
+	if err != nil {
+		out.Fatalf("Failed while fetching IDL from registry: %v\n", err)
+	}
+
+	phases, err := loadPlan(opts.BOpts.PlanFile, opts)
+	if err != nil {
+		out.Fatalf("Failed while loading plan: %v\n", err)
+	}
+
+	combined := newBenchmarkState(statsd.Noop)
+	var combinedTotal time.Duration
+	results := make([]sweepResult, 0, len(phases)+1)
+	for _, phase := range phases {
+		out.Printf("Phase %v:\n", phase.name)
+		state, total := runBenchmarkTargets(out, phase.opts, []benchmarkTarget{phase.target})
+		out.Printf("\n")
+
+		combined.merge(state)
+		combinedTotal += total
+		results = append(results, newSweepResult(phase.name, state, total))
+	}
+	results = append(results, newSweepResult("combined", combined, combinedTotal))
+
+	out.Printf("Phase results:\n")
+	printResultsTable(out, "Phase", results)
+}
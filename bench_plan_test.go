@@ -0,0 +1,202 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadPlan(t *testing.T) {
+	planFile := writeFile(t, "plan", `
+- name: warmup
+  duration: 2s
+  rps: 10
+- method: echo
+  encoding: raw
+  request: hello
+  connections: 4
+  concurrency: 2
+  maxRequests: 50
+`)
+	defer os.Remove(planFile)
+
+	opts := Options{
+		ROpts: RequestOptions{ThriftFile: validThrift, MethodName: fooMethod, RequestJSON: "{}"},
+		TOpts: TransportOptions{ServiceName: "foo"},
+		BOpts: BenchmarkOptions{MaxDuration: time.Second, RPS: 100, Connections: 1, Concurrency: 1, MaxRequests: 1000},
+	}
+	phases, err := loadPlan(planFile, opts)
+	require.NoError(t, err, "loadPlan failed")
+	require.Len(t, phases, 2, "Unexpected number of phases")
+
+	assert.Equal(t, "warmup", phases[0].name, "Name mismatch")
+	assert.Equal(t, BenchmarkOptions{MaxDuration: 2 * time.Second, RPS: 10, Connections: 1, Concurrency: 1, MaxRequests: 1000},
+		phases[0].opts.BOpts, "Unexpected options for the first phase")
+	assert.Equal(t, fooMethod, phases[0].target.methodName, "Method should default to --method")
+
+	assert.Equal(t, "phase 2", phases[1].name, "Name should default to the phase number")
+	assert.Equal(t, BenchmarkOptions{MaxDuration: time.Second, RPS: 100, Connections: 4, Concurrency: 2, MaxRequests: 50},
+		phases[1].opts.BOpts, "Unexpected options for the second phase")
+	assert.Equal(t, "hello\n", string(phases[1].target.method.req.Body), "Request body mismatch")
+}
+
+func TestLoadPlanHeaders(t *testing.T) {
+	planFile := writeFile(t, "plan", `
+- name: cold
+  headers:
+    Cache-Control: no-cache
+- name: warm
+  headers:
+    Cache-Control: ""
+    X-Phase: warm
+- name: default
+`)
+	defer os.Remove(planFile)
+
+	opts := Options{
+		ROpts: RequestOptions{
+			ThriftFile:  validThrift,
+			MethodName:  fooMethod,
+			HeadersJSON: `{"Cache-Control": "max-age=60", "X-Caller": "yab"}`,
+		},
+		BOpts: BenchmarkOptions{MaxDuration: time.Second},
+	}
+	phases, err := loadPlan(planFile, opts)
+	require.NoError(t, err, "loadPlan failed")
+	require.Len(t, phases, 3, "Unexpected number of phases")
+
+	assert.Equal(t, map[string]string{"Cache-Control": "no-cache", "X-Caller": "yab"},
+		phases[0].target.method.req.Headers, "Phase headers should override the command line headers")
+	assert.Equal(t, map[string]string{"X-Caller": "yab", "X-Phase": "warm"},
+		phases[1].target.method.req.Headers, "Empty phase headers should remove the header")
+	assert.Equal(t, map[string]string{"Cache-Control": "max-age=60", "X-Caller": "yab"},
+		phases[2].target.method.req.Headers, "Phases without headers should use the command line headers")
+}
+
+func TestLoadPlanErrors(t *testing.T) {
+	tests := []struct {
+		contents string
+		noDur    bool
+		errMsg   string
+	}{
+		{contents: `[]`, errMsg: errNoPhases.Error()},
+		{contents: `{`, errMsg: "failed to parse plan file"},
+		{contents: `[{duration: 1 minute}]`, errMsg: `invalid phase "phase 1": invalid duration`},
+		{contents: `[{rps: -1}]`, errMsg: "must not be negative"},
+		{contents: `[{name: slow}]`, noDur: true, errMsg: `invalid phase "slow": duration must be set`},
+		{contents: `[{method: "Simple::unknown"}]`, errMsg: `invalid phase "phase 1"`},
+	}
+
+	for _, tt := range tests {
+		planFile := writeFile(t, "plan", tt.contents)
+		defer os.Remove(planFile)
+
+		opts := Options{ROpts: RequestOptions{ThriftFile: validThrift, MethodName: fooMethod}}
+		if !tt.noDur {
+			opts.BOpts.MaxDuration = time.Second
+		}
+		_, err := loadPlan(planFile, opts)
+		if assert.Error(t, err, "loadPlan(%v) should fail", tt.contents) {
+			assert.Contains(t, err.Error(), tt.errMsg, "Unexpected error for %v", tt.contents)
+		}
+	}
+
+	_, err := loadPlan("/fake/file", Options{})
+	assert.Error(t, err, "loadPlan should fail for a missing file")
+}
+
+func TestRunPlan(t *testing.T) {
+	var fooRequests, echoRequests int32
+	s := newServer(t)
+	defer s.shutdown()
+	s.register(fooMethod, methods.errorIf(func() bool {
+		atomic.AddInt32(&fooRequests, 1)
+		return false
+	}))
+	s.register("echo", methods.errorIf(func() bool {
+		atomic.AddInt32(&echoRequests, 1)
+		return false
+	}))
+
+	planFile := writeFile(t, "plan", `
+- name: low
+  maxRequests: 10
+- name: high
+  method: echo
+  encoding: raw
+  maxRequests: 30
+  connections: 2
+`)
+	defer os.Remove(planFile)
+
+	buf, out := getOutput(t)
+	runWithOptions(Options{
+		ROpts: RequestOptions{ThriftFile: validThrift, MethodName: fooMethod},
+		TOpts: s.transportOpts(),
+		BOpts: BenchmarkOptions{
+			PlanFile:    planFile,
+			MaxRequests: 100,
+			MaxDuration: time.Second,
+			Connections: 1,
+			Concurrency: 1,
+		},
+	}, out)
+
+	output := buf.String()
+	assert.Contains(t, output, "Phase low:\nBenchmark parameters:")
+	assert.Contains(t, output, "Phase high:\nBenchmark parameters:")
+	assert.EqualValues(t, 10+warmupRequests, atomic.LoadInt32(&fooRequests), "Unexpected foo requests")
+	assert.EqualValues(t, 30+2*warmupRequests, atomic.LoadInt32(&echoRequests), "Unexpected echo requests")
+
+	table := output[strings.Index(output, "Phase results"):]
+	lines := strings.Split(strings.TrimSpace(table), "\n")
+	require.Len(t, lines, 6, "Unexpected table: %v", table)
+	assert.Regexp(t, `^  low\s+10\s+0\s`, lines[3], "Phases should be in order")
+	assert.Regexp(t, `^  high\s+30\s+0\s`, lines[4], "Unexpected result for the second phase")
+	assert.Regexp(t, `^  combined\s+40\s+0\s`, lines[5], "Unexpected combined result")
+}
+
+func TestRunPlanWithTargets(t *testing.T) {
+	buf, out := getOutput(t)
+	var fatal string
+	out = testOutput{
+		Buffer: buf,
+		fatalf: func(format string, args ...interface{}) {
+			fatal = format
+		},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runWithOptions(Options{BOpts: BenchmarkOptions{PlanFile: "plan.yaml", TargetsFile: "targets.yaml"}}, out)
+	}()
+	<-done
+
+	assert.Equal(t, "Cannot use --plan with --targets\n", fatal)
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"time"
+)
+
+// cpuSaturatedPercent is the CPU usage above which yab warns that results
+// may be limited by the client rather than the server.
+const cpuSaturatedPercent = 90
+
+// generatorProfile captures profiles and resource usage of yab itself
+// while running a benchmark.
+type generatorProfile struct {
+	cpuFile  *os.File
+	memPath  string
+	numCPUs  int
+	started  time.Time
+	cpuStart time.Duration
+	memStart runtime.MemStats
+}
+
+// startGeneratorProfile starts profiling yab, writing a CPU profile to
+// cpuPath if set.
+func startGeneratorProfile(cpuPath, memPath string, numCPUs int) (*generatorProfile, error) {
+	p := &generatorProfile{
+		memPath: memPath,
+		numCPUs: numCPUs,
+	}
+
+	if cpuPath != "" {
+		f, err := os.Create(cpuPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create CPU profile: %v", err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to start CPU profile: %v", err)
+		}
+		p.cpuFile = f
+	}
+
+	runtime.ReadMemStats(&p.memStart)
+	p.cpuStart = processCPUTime()
+	p.started = time.Now()
+	return p, nil
+}
+
+// generatorStats is the resource usage of yab during a benchmark.
+type generatorStats struct {
+	// cpuPercent is the percentage of the available CPUs used, or -1 if unknown.
+	cpuPercent float64
+	numCPUs    int
+	numGC      uint32
+	gcPause    time.Duration
+}
+
+// stop stops profiling, writes the memory profile if requested, and returns
+// the resource usage since the profile was started.
+func (p *generatorProfile) stop() (generatorStats, error) {
+	elapsed := time.Since(p.started)
+	cpuUsed := processCPUTime() - p.cpuStart
+
+	var memEnd runtime.MemStats
+	runtime.ReadMemStats(&memEnd)
+
+	stats := generatorStats{
+		cpuPercent: -1,
+		numCPUs:    p.numCPUs,
+		numGC:      memEnd.NumGC - p.memStart.NumGC,
+		gcPause:    time.Duration(memEnd.PauseTotalNs - p.memStart.PauseTotalNs),
+	}
+	if cpuUsed >= 0 && elapsed > 0 && p.numCPUs > 0 {
+		stats.cpuPercent = 100 * float64(cpuUsed) / float64(elapsed) / float64(p.numCPUs)
+	}
+
+	if p.cpuFile != nil {
+		pprof.StopCPUProfile()
+		if err := p.cpuFile.Close(); err != nil {
+			return stats, fmt.Errorf("failed to write CPU profile: %v", err)
+		}
+	}
+
+	if p.memPath != "" {
+		if err := writeHeapProfile(p.memPath); err != nil {
+			return stats, err
+		}
+	}
+
+	return stats, nil
+}
+
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create memory profile: %v", err)
+	}
+	defer f.Close()
+
+	// Run a GC so the profile reflects the live heap.
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		return fmt.Errorf("failed to write memory profile: %v", err)
+	}
+	return nil
+}
+
+func (s generatorStats) print(out output, logger *logger) {
+	out.Printf("Generator stats:\n")
+	if s.cpuPercent >= 0 {
+		out.Printf("  CPU usage:       %.1f%% of %v CPUs\n", s.cpuPercent, s.numCPUs)
+	}
+	out.Printf("  GC pauses:       %v (total %v)\n", s.numGC, s.gcPause)
+
+	if s.cpuPercent >= cpuSaturatedPercent {
+		logger.Warnf("yab used %.1f%% of its CPUs, so results may be limited by the client rather than the server.", s.cpuPercent)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeneratorProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yab-profile")
+	require.NoError(t, err, "Failed to create temp dir")
+	defer os.RemoveAll(dir)
+
+	cpuPath := filepath.Join(dir, "cpu.pprof")
+	memPath := filepath.Join(dir, "mem.pprof")
+
+	profile, err := startGeneratorProfile(cpuPath, memPath, 1)
+	require.NoError(t, err, "Failed to start profile")
+
+	// Use some CPU so there is something to profile.
+	deadline := time.Now().Add(20 * time.Millisecond)
+	for time.Now().Before(deadline) {
+	}
+
+	stats, err := profile.stop()
+	require.NoError(t, err, "Failed to stop profile")
+	assert.Equal(t, 1, stats.numCPUs, "numCPUs mismatch")
+
+	for _, path := range []string{cpuPath, memPath} {
+		info, err := os.Stat(path)
+		if assert.NoError(t, err, "Missing profile %v", path) {
+			assert.NotZero(t, info.Size(), "Profile %v is empty", path)
+		}
+	}
+}
+
+func TestGeneratorProfileErrors(t *testing.T) {
+	_, err := startGeneratorProfile("/fake/dir/cpu.pprof", "", 1)
+	assert.Error(t, err, "Expected error when the CPU profile cannot be created")
+
+	profile, err := startGeneratorProfile("", "/fake/dir/mem.pprof", 1)
+	require.NoError(t, err, "Failed to start profile")
+	_, err = profile.stop()
+	assert.Error(t, err, "Expected error when the memory profile cannot be created")
+}
+
+func TestGeneratorStatsPrint(t *testing.T) {
+	tests := []struct {
+		stats       generatorStats
+		contains    []string
+		notContains []string
+	}{
+		{
+			stats:       generatorStats{cpuPercent: 25, numCPUs: 4, numGC: 3, gcPause: time.Millisecond},
+			contains:    []string{"CPU usage:       25.0% of 4 CPUs", "GC pauses:       3 (total 1ms)"},
+			notContains: []string{"Warning"},
+		},
+		{
+			stats:       generatorStats{cpuPercent: -1, numCPUs: 4},
+			notContains: []string{"CPU usage", "Warning"},
+		},
+		{
+			stats:    generatorStats{cpuPercent: 95, numCPUs: 2},
+			contains: []string{"Warning: yab used 95.0% of its CPUs"},
+		},
+	}
+
+	for _, tt := range tests {
+		buf, out := getOutput(t)
+		tt.stats.print(out, newLogger(Options{}, out))
+		for _, s := range tt.contains {
+			assert.Contains(t, buf.String(), s, "Missing output for %+v", tt.stats)
+		}
+		for _, s := range tt.notContains {
+			assert.NotContains(t, buf.String(), s, "Unexpected output for %+v", tt.stats)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/yarpc/yab/statsd"
+)
+
+// runMetric is a metric of a benchmark run that is compared across runs.
+type runMetric struct {
+	name   string
+	value  func(sweepResult) float64
+	format func(float64) string
+}
+
+func formatCount(v float64) string         { return fmt.Sprintf("%.2f", v) }
+func formatDurationValue(v float64) string { return time.Duration(v).String() }
+
+var runMetrics = []runMetric{
+	{"Requests", func(r sweepResult) float64 { return float64(r.requests) }, formatCount},
+	{"Errors", func(r sweepResult) float64 { return float64(r.errors) }, formatCount},
+	{"RPS", func(r sweepResult) float64 { return r.rps }, formatCount},
+	{"p50", func(r sweepResult) float64 { return float64(r.p50) }, formatDurationValue},
+	{"p90", func(r sweepResult) float64 { return float64(r.p90) }, formatDurationValue},
+	{"p99", func(r sweepResult) float64 { return float64(r.p99) }, formatDurationValue},
+}
+
+// runStats are the statistics of a metric across runs.
+type runStats struct {
+	mean   float64
+	stddev float64
+	min    float64
+	max    float64
+}
+
+// newRunStats returns the statistics of the values, using the sample
+// standard deviation, since the runs are a sample of possible runs.
+func newRunStats(values []float64) runStats {
+	if len(values) == 0 {
+		return runStats{}
+	}
+
+	stats := runStats{min: values[0], max: values[0]}
+	var sum float64
+	for _, v := range values {
+		sum += v
+		stats.min = math.Min(stats.min, v)
+		stats.max = math.Max(stats.max, v)
+	}
+	stats.mean = sum / float64(len(values))
+
+	if len(values) > 1 {
+		var squares float64
+		for _, v := range values {
+			squares += (v - stats.mean) * (v - stats.mean)
+		}
+		stats.stddev = math.Sqrt(squares / float64(len(values)-1))
+	}
+	return stats
+}
+
+// runBenchmarkTargets benchmarks the targets, repeating the benchmark with
+// new connections for each of --runs, and returns the merged state of all
+// the runs, and how long the runs took in total.
+func runBenchmarkTargets(out output, allOpts Options, targets []benchmarkTarget) (*benchmarkState, time.Duration) {
+	runs := allOpts.BOpts.Runs
+	if runs <= 1 {
+		return runBenchmarkOnce(out, allOpts, targets)
+	}
+
+	combined := newBenchmarkState(statsd.Noop)
+	var combinedTotal time.Duration
+	results := make([]sweepResult, 0, runs)
+	for i := 1; i <= runs; i++ {
+		out.Printf("Run %v of %v:\n", i, runs)
+		state, total := runBenchmarkOnce(out, allOpts, targets)
+		if state == nil {
+			return nil, 0
+		}
+		out.Printf("\n")
+
+		combined.merge(state)
+		combinedTotal += total
+		results = append(results, newSweepResult(fmt.Sprint(i), state, total))
+	}
+
+	out.Printf("Run results:\n")
+	printResultsTable(out, "Run", results)
+	out.Printf("\n")
+	printRunStats(out, results)
+	return combined, combinedTotal
+}
+
+// printRunStats prints the mean, standard deviation, min and max of each
+// metric across the runs.
+func printRunStats(out output, results []sweepResult) {
+	out.Printf("Statistics across %v runs:\n", len(results))
+	out.Printf("  %-8v  %14v  %14v  %14v  %14v\n", "Metric", "Mean", "Stddev", "Min", "Max")
+	out.Printf("  %v\n", strings.Repeat("-", 8+4*16))
+
+	values := make([]float64, len(results))
+	for _, m := range runMetrics {
+		for i, r := range results {
+			values[i] = m.value(r)
+		}
+		stats := newRunStats(values)
+		out.Printf("  %-8v  %14v  %14v  %14v  %14v\n", m.name,
+			m.format(stats.mean), m.format(stats.stddev), m.format(stats.min), m.format(stats.max))
+	}
+}
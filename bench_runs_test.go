@@ -0,0 +1,96 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRunStats(t *testing.T) {
+	tests := []struct {
+		values []float64
+		want   runStats
+	}{
+		{values: nil, want: runStats{}},
+		{values: []float64{5}, want: runStats{mean: 5, min: 5, max: 5}},
+		{values: []float64{2, 4, 4, 4, 5, 5, 7, 9}, want: runStats{mean: 5, stddev: math.Sqrt(32.0 / 7), min: 2, max: 9}},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, newRunStats(tt.values), "newRunStats(%v) mismatch", tt.values)
+	}
+}
+
+func TestPrintRunStats(t *testing.T) {
+	buf, out := getOutput(t)
+	printRunStats(out, []sweepResult{
+		{name: "1", requests: 100, errors: 0, rps: 100, p50: time.Millisecond, p90: 2 * time.Millisecond, p99: 4 * time.Millisecond},
+		{name: "2", requests: 110, errors: 2, rps: 110, p50: 3 * time.Millisecond, p90: 4 * time.Millisecond, p99: 8 * time.Millisecond},
+	})
+	assert.Equal(t, `Statistics across 2 runs:
+  Metric              Mean          Stddev             Min             Max
+  ------------------------------------------------------------------------
+  Requests          105.00            7.07          100.00          110.00
+  Errors              1.00            1.41            0.00            2.00
+  RPS               105.00            7.07          100.00          110.00
+  p50                  2ms      1.414213ms             1ms             3ms
+  p90                  3ms      1.414213ms             2ms             4ms
+  p99                  6ms      2.828427ms             4ms             8ms
+`, buf.String())
+}
+
+func TestBenchmarkRuns(t *testing.T) {
+	var requests int32
+	s := newServer(t)
+	defer s.shutdown()
+	s.register(fooMethod, methods.errorIf(func() bool {
+		atomic.AddInt32(&requests, 1)
+		return false
+	}))
+
+	m := benchmarkMethodForTest(t, fooMethod)
+	buf, out := getOutput(t)
+
+	runBenchmark(out, Options{
+		BOpts: BenchmarkOptions{
+			MaxRequests: 100,
+			MaxDuration: time.Second,
+			Connections: 5,
+			Concurrency: 2,
+			Runs:        3,
+		},
+		TOpts: s.transportOpts(),
+	}, m)
+
+	bufStr := buf.String()
+	for _, want := range []string{"Run 1 of 3:", "Run 2 of 3:", "Run 3 of 3:", "Run results:", "Statistics across 3 runs:"} {
+		assert.Contains(t, bufStr, want, "Missing output")
+	}
+	assert.NotContains(t, bufStr, "Errors:")
+
+	// Each run creates and warms up new connections.
+	assert.EqualValues(t, 3*(100+10*5), requests, "Invalid number of requests")
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yarpc/yab/statsd"
+	"github.com/yarpc/yab/transport"
+)
+
+// defaultShadowConcurrency is the number of shadow calls each worker can
+// have in flight if --shadow-concurrency is not set.
+const defaultShadowConcurrency = 16
+
+// shadowWorker mirrors a worker's requests to a shadow transport.
+// A nil shadowWorker does not mirror any requests.
+type shadowWorker struct {
+	t  transport.Transport
+	wg sync.WaitGroup
+
+	// inFlight limits the number of outstanding shadow calls, so a slow
+	// shadow doesn't slow down the primary, or accumulate calls.
+	inFlight chan struct{}
+	dropped  int64
+
+	// mu protects state, which is updated by concurrent shadow calls.
+	mu    sync.Mutex
+	state *benchmarkState
+}
+
+func newShadowWorker(t transport.Transport, concurrency int) *shadowWorker {
+	if concurrency <= 0 {
+		concurrency = defaultShadowConcurrency
+	}
+	return &shadowWorker{
+		t:        t,
+		inFlight: make(chan struct{}, concurrency),
+		state:    newBenchmarkState(statsd.Noop),
+	}
+}
+
+// shadowTransportOptions returns the transport options to use for the shadow
+// peers, which are the same as the primary, except for the peers.
+func shadowTransportOptions(opts TransportOptions, peerList string) TransportOptions {
+	opts.HostPorts = nil
+	opts.HostPortFile = peerList
+
+	// Connection events are only reported for the primary peers.
+	opts.connectionEvent = nil
+	opts.tlsHandshake = nil
+	return opts
+}
+
+// start makes the shadow call for req in the background so that the shadow
+// receives the same request at the same time as the primary. If the shadow
+// already has the maximum number of calls in flight, the request is dropped
+// rather than waiting for the shadow.
+func (s *shadowWorker) start(m benchmarkMethod, req *transport.Request) {
+	if s == nil {
+		return
+	}
+
+	select {
+	case s.inFlight <- struct{}{}:
+	default:
+		atomic.AddInt64(&s.dropped, 1)
+		return
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() { <-s.inFlight }()
+
+		latency, err := m.callShadow(s.t, req)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err != nil {
+			s.state.recordError(err)
+			return
+		}
+
+		s.state.recordLatency(latency)
+	}()
+}
+
+// wait waits for any outstanding shadow calls to complete.
+func (s *shadowWorker) wait() {
+	if s == nil {
+		return
+	}
+
+	s.wg.Wait()
+}
+
+func printShadowResults(out output, shadows []*shadowWorker, total time.Duration) {
+	overall := newBenchmarkState(statsd.Noop)
+	var dropped int64
+	for _, s := range shadows {
+		overall.merge(s.state)
+		dropped += atomic.LoadInt64(&s.dropped)
+	}
+
+	out.Printf("\nShadow results:\n")
+	overall.printErrors(out)
+	overall.printLatencies(out)
+	out.Printf("Total requests:    %v\n", len(overall.latencies))
+	if dropped > 0 {
+		out.Printf("Dropped requests:  %v (shadow could not keep up)\n", dropped)
+	}
+	out.Printf("RPS:               %.2f\n", float64(len(overall.latencies))/total.Seconds())
+}
@@ -32,13 +32,39 @@ import (
 type benchmarkState struct {
 	statter   statsd.Client
 	errors    map[string]int
+	throttled map[string]int
 	latencies []time.Duration
+
+	// redirected counts successful calls that followed redirects, and
+	// redirects counts the redirects they followed.
+	redirected int
+	redirects  int
+
+	// replayed counts responses the service marked as replayed for an
+	// idempotency key that was already used.
+	replayed int
+
+	// serverTimings are the durations of each server-reported metric, and
+	// serverTimes and networkTimes split the latency of the responses that
+	// reported timings into the server's time and the remainder.
+	serverTimings map[string][]time.Duration
+	serverTimes   []time.Duration
+	networkTimes  []time.Duration
+
+	// skewed counts samples whose wall clock latency differed from the
+	// monotonic latency, which are only checked by --clock-audit.
+	skewed  int
+	maxSkew time.Duration
+
+	// peerLatencies is only tracked if trackPeers is called.
+	peerLatencies map[string][]time.Duration
 }
 
 func newBenchmarkState(statter statsd.Client) *benchmarkState {
 	return &benchmarkState{
-		statter: statter,
-		errors:  make(map[string]int),
+		statter:   statter,
+		errors:    make(map[string]int),
+		throttled: make(map[string]int),
 	}
 }
 
@@ -52,11 +78,110 @@ func (s *benchmarkState) recordError(err error) {
 	s.statter.Inc("error")
 }
 
+// recordThrottled records a call that the service rejected as it is rate
+// limiting the caller or is overloaded, which is not counted as an error.
+func (s *benchmarkState) recordThrottled(err error) {
+	msg := errorToMessage(err)
+	s.throttled[msg]++
+	s.statter.Inc("throttled")
+}
+
+func (s *benchmarkState) recordRedirects(n int) {
+	if n == 0 {
+		return
+	}
+
+	s.redirected++
+	s.redirects += n
+	s.statter.Inc("redirected")
+}
+
+// recordReplayed records a response that the service marked as a replay of
+// the response to an earlier request with the same idempotency key.
+func (s *benchmarkState) recordReplayed() {
+	s.replayed++
+	s.statter.Inc("replayed")
+}
+
+// recordClockSkew records a sample whose latency would be wrong if it were
+// measured using the wall clock, which was adjusted during the request.
+func (s *benchmarkState) recordClockSkew(skew time.Duration) {
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew <= clockSkewTolerance {
+		return
+	}
+
+	s.skewed++
+	if skew > s.maxSkew {
+		s.maxSkew = skew
+	}
+	s.statter.Inc("clock_skewed")
+}
+
+// recordServerTiming records the metrics a response reported, attributing
+// the rest of the latency to the network.
+func (s *benchmarkState) recordServerTiming(metrics []serverTimingMetric, latency time.Duration) {
+	if len(metrics) == 0 {
+		return
+	}
+
+	if s.serverTimings == nil {
+		s.serverTimings = make(map[string][]time.Duration)
+	}
+	for _, m := range metrics {
+		s.serverTimings[m.name] = append(s.serverTimings[m.name], m.dur)
+	}
+
+	server := serverTime(metrics)
+	network := latency - server
+	if network < 0 {
+		// The server's clock or reporting doesn't match ours.
+		network = 0
+	}
+	s.serverTimes = append(s.serverTimes, server)
+	s.networkTimes = append(s.networkTimes, network)
+	s.statter.Timing("server", server)
+	s.statter.Timing("network", network)
+}
+
+// trackPeers enables tracking latencies for each peer.
+func (s *benchmarkState) trackPeers() {
+	s.peerLatencies = make(map[string][]time.Duration)
+}
+
 func (s *benchmarkState) merge(other *benchmarkState) {
 	for k, v := range other.errors {
 		s.errors[k] += v
 	}
+	for k, v := range other.throttled {
+		s.throttled[k] += v
+	}
 	s.latencies = append(s.latencies, other.latencies...)
+	s.redirected += other.redirected
+	s.redirects += other.redirects
+	s.replayed += other.replayed
+
+	s.skewed += other.skewed
+	if other.maxSkew > s.maxSkew {
+		s.maxSkew = other.maxSkew
+	}
+	s.serverTimes = append(s.serverTimes, other.serverTimes...)
+	s.networkTimes = append(s.networkTimes, other.networkTimes...)
+	if other.serverTimings != nil && s.serverTimings == nil {
+		s.serverTimings = make(map[string][]time.Duration)
+	}
+	for name, timings := range other.serverTimings {
+		s.serverTimings[name] = append(s.serverTimings[name], timings...)
+	}
+
+	if other.peerLatencies != nil && s.peerLatencies == nil {
+		s.trackPeers()
+	}
+	for peer, latencies := range other.peerLatencies {
+		s.peerLatencies[peer] = append(s.peerLatencies[peer], latencies...)
+	}
 }
 
 func (s *benchmarkState) recordLatency(d time.Duration) {
@@ -65,6 +190,14 @@ func (s *benchmarkState) recordLatency(d time.Duration) {
 	s.statter.Timing("latency", d)
 }
 
+func (s *benchmarkState) recordPeerLatency(peer string, d time.Duration) {
+	if s.peerLatencies == nil {
+		return
+	}
+
+	s.peerLatencies[peer] = append(s.peerLatencies[peer], d)
+}
+
 func (s *benchmarkState) printLatencies(out output) {
 	// TODO JSON output?
 	sort.Sort(byDuration(s.latencies))
@@ -74,6 +207,21 @@ func (s *benchmarkState) printLatencies(out output) {
 	}
 }
 
+// printSlow prints the number of responses that took longer than threshold.
+func (s *benchmarkState) printSlow(out output, threshold time.Duration) {
+	slow := 0
+	for _, l := range s.latencies {
+		if l > threshold {
+			slow++
+		}
+	}
+	if slow == 0 {
+		return
+	}
+
+	out.Printf("Slow responses (> %v): %v (%.2f%%)\n", threshold, slow, 100*float64(slow)/float64(len(s.latencies)))
+}
+
 func (s *benchmarkState) printErrors(out output) {
 	if len(s.errors) == 0 {
 		return
@@ -88,17 +236,95 @@ func (s *benchmarkState) printErrors(out output) {
 	out.Printf("Total errors: %v\n", total)
 }
 
+func (s *benchmarkState) printThrottled(out output) {
+	if len(s.throttled) == 0 {
+		return
+	}
+	out.Printf("Throttled:\n")
+	total := 0
+	for _, k := range sorted.MapKeys(s.throttled) {
+		v := s.throttled[k]
+		out.Printf("  %4d: %v\n", v, k)
+		total += v
+	}
+	out.Printf("Total throttled: %v\n", total)
+}
+
+func (s *benchmarkState) printRedirects(out output) {
+	if s.redirected == 0 {
+		return
+	}
+	out.Printf("Redirected: %v requests followed %v redirects\n", s.redirected, s.redirects)
+}
+
+func (s *benchmarkState) printReplayed(out output) {
+	if s.replayed == 0 {
+		return
+	}
+	out.Printf("Replayed: %v responses were duplicates of an earlier request with the same idempotency key\n", s.replayed)
+}
+
+// printClockAudit prints the adjustments to the wall clock during the
+// benchmark, and the samples they affected.
+func (s *benchmarkState) printClockAudit(out output, adjustments []clockAdjustment) {
+	if len(adjustments) == 0 && s.skewed == 0 {
+		out.Printf("Clock audit: no wall clock adjustments\n")
+		return
+	}
+
+	out.Printf("Clock audit: %v wall clock adjustments\n", len(adjustments))
+	for _, adj := range adjustments {
+		sign := "+"
+		if adj.offset < 0 {
+			sign = ""
+		}
+		out.Printf("  %v: %v%v\n", adj.at.Format("15:04:05.000"), sign, adj.offset)
+	}
+	if s.skewed > 0 {
+		out.Printf("  %v of %v samples were affected (by up to %v), and use monotonic latencies\n",
+			s.skewed, len(s.latencies), s.maxSkew)
+	}
+}
+
+// printServerTiming prints the server-reported metrics, and the split of
+// latency between the server and the network.
+func (s *benchmarkState) printServerTiming(out output) {
+	if len(s.serverTimes) == 0 {
+		return
+	}
+
+	out.Printf("Server timing (%v of %v responses):\n", len(s.serverTimes), len(s.latencies))
+	printTiming := func(name string, timings []time.Duration) {
+		sort.Sort(byDuration(timings))
+		out.Printf("  %-10v average: %v, p50: %v, p90: %v, p99: %v\n", name+":", averageDuration(timings),
+			quantile(timings, 0.5), quantile(timings, 0.9), quantile(timings, 0.99))
+	}
+	for _, name := range sorted.MapKeys(s.serverTimings) {
+		if name != serverTimingTotal {
+			printTiming(name, s.serverTimings[name])
+		}
+	}
+	printTiming("server", s.serverTimes)
+	printTiming("network", s.networkTimes)
+}
+
 func (s *benchmarkState) getQuantile(q float64) time.Duration {
+	return quantile(s.latencies, q)
+}
+
+// quantile returns the q quantile of the sorted latencies, interpolating
+// between the closest latencies.
+func quantile(latencies []time.Duration, q float64) time.Duration {
 	if q < 0 || q > 1 {
 		panic(fmt.Sprintf("got unexpected quantile: %v, must be in range [0, 1]", q))
 	}
 
-	numLatencies := len(s.latencies)
+	numLatencies := len(latencies)
 	switch numLatencies {
 	case 0:
 		return 0
 	case 1:
-		return s.latencies[0]
+		return latencies[0]
 	}
 
 	lastIndex := numLatencies - 1
@@ -106,14 +332,26 @@ func (s *benchmarkState) getQuantile(q float64) time.Duration {
 	exactIdx := q * float64(lastIndex)
 	leftIdx := int(exactIdx)
 	if leftIdx >= lastIndex {
-		return s.latencies[lastIndex]
+		return latencies[lastIndex]
 	}
 
 	rightIdx := leftIdx + 1
 	rightBias := exactIdx - float64(leftIdx)
 	leftBias := 1 - rightBias
 
-	return time.Duration(float64(s.latencies[leftIdx])*leftBias + float64(s.latencies[rightIdx])*rightBias)
+	return time.Duration(float64(latencies[leftIdx])*leftBias + float64(latencies[rightIdx])*rightBias)
+}
+
+func averageDuration(durations []time.Duration) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+
+	var sum time.Duration
+	for _, d := range durations {
+		sum += d
+	}
+	return sum / time.Duration(len(durations))
 }
 
 type byDuration []time.Duration
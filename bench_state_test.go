@@ -142,6 +142,37 @@ func TestBenchmarkStateMergeLatencies(t *testing.T) {
 	}
 }
 
+func TestBenchmarkStatePrintSlow(t *testing.T) {
+	state := newBenchmarkState(statsd.Noop)
+	for _, ms := range []int{10, 20, 150, 30, 200} {
+		state.recordLatency(time.Duration(ms) * time.Millisecond)
+	}
+
+	buf, out := getOutput(t)
+	state.printSlow(out, time.Second)
+	assert.Empty(t, buf.String(), "No output expected without slow responses")
+
+	state.printSlow(out, 100*time.Millisecond)
+	assert.Equal(t, "Slow responses (> 100ms): 2 (40.00%)\n", buf.String(), "Slow output mismatch")
+}
+
+func TestBenchmarkStatePrintRedirects(t *testing.T) {
+	state1 := newBenchmarkState(statsd.Noop)
+	state2 := newBenchmarkState(statsd.Noop)
+
+	buf, out := getOutput(t)
+	state1.recordRedirects(0)
+	state1.printRedirects(out)
+	assert.Empty(t, buf.String(), "No output expected without redirects")
+
+	state1.recordRedirects(1)
+	state2.recordRedirects(2)
+	state2.recordRedirects(0)
+	state1.merge(state2)
+	state1.printRedirects(out)
+	assert.Equal(t, "Redirected: 2 requests followed 3 redirects\n", buf.String(), "Redirect output mismatch")
+}
+
 func TestErrorToMessage(t *testing.T) {
 	tests := []struct {
 		err  error
@@ -214,3 +245,77 @@ func TestBenchmarkStateGetQuantileSuccess(t *testing.T) {
 		assert.Equal(t, tt.want, got, "P%v of %v mismatch", tt.q, tt.latencies)
 	}
 }
+
+func TestBenchmarkStateServerTiming(t *testing.T) {
+	stats := newFakeStatsClient()
+	state1 := newBenchmarkState(stats)
+	state2 := newBenchmarkState(statsd.Noop)
+
+	for _, s := range []*benchmarkState{state1, state2} {
+		s.recordLatency(100 * time.Millisecond)
+		s.recordServerTiming([]serverTimingMetric{{"db", 20 * time.Millisecond}, {"app", 50 * time.Millisecond}}, 100*time.Millisecond)
+
+		// The server's time can exceed the latency, which is not negative network time.
+		s.recordLatency(10 * time.Millisecond)
+		s.recordServerTiming([]serverTimingMetric{{"db", 5 * time.Millisecond}, {"total", 15 * time.Millisecond}}, 10*time.Millisecond)
+
+		// Responses without timings are not included.
+		s.recordLatency(time.Second)
+		s.recordServerTiming(nil, time.Second)
+	}
+	assert.Equal(t, map[string][]time.Duration{
+		"latency": {100 * time.Millisecond, 10 * time.Millisecond, time.Second},
+		"server":  {70 * time.Millisecond, 15 * time.Millisecond},
+		"network": {30 * time.Millisecond, 0},
+	}, stats.Timers, "Statsd timers mismatch")
+
+	state1.merge(state2)
+	buf, out := getOutput(t)
+	state1.printServerTiming(out)
+	assert.Equal(t, `Server timing (4 of 6 responses):
+  app:       average: 50ms, p50: 50ms, p90: 50ms, p99: 50ms
+  db:        average: 12.5ms, p50: 12.5ms, p90: 20ms, p99: 20ms
+  server:    average: 42.5ms, p50: 42.5ms, p90: 70ms, p99: 70ms
+  network:   average: 15ms, p50: 15ms, p90: 30ms, p99: 30ms
+`, buf.String())
+}
+
+func TestBenchmarkStateNoServerTiming(t *testing.T) {
+	state := newBenchmarkState(statsd.Noop)
+	state.recordLatency(time.Millisecond)
+
+	buf, out := getOutput(t)
+	state.printServerTiming(out)
+	assert.Equal(t, 0, buf.Len(), "Expected no output without server timings, got: %s", buf.String())
+}
+
+func TestBenchmarkStateClockAudit(t *testing.T) {
+	stats := newFakeStatsClient()
+	state1 := newBenchmarkState(stats)
+	state2 := newBenchmarkState(statsd.Noop)
+
+	buf, out := getOutput(t)
+	state1.printClockAudit(out, nil)
+	assert.Equal(t, "Clock audit: no wall clock adjustments\n", buf.String())
+
+	for _, skew := range []time.Duration{0, time.Microsecond, -clockSkewTolerance, 2 * time.Second} {
+		state1.recordLatency(time.Millisecond)
+		state1.recordClockSkew(skew)
+	}
+	state2.recordLatency(time.Millisecond)
+	state2.recordClockSkew(-3 * time.Second)
+	state1.merge(state2)
+	assert.Equal(t, 1, stats.Counters["clock_skewed"], "Statsd counter mismatch")
+
+	at := time.Date(2016, 1, 2, 15, 4, 5, 6000000, time.UTC)
+	buf, out = getOutput(t)
+	state1.printClockAudit(out, []clockAdjustment{
+		{at: at, offset: 2 * time.Second},
+		{at: at.Add(time.Second), offset: -3 * time.Second},
+	})
+	assert.Equal(t, `Clock audit: 2 wall clock adjustments
+  15:04:05.006: +2s
+  15:04:06.006: -3s
+  2 of 5 samples were affected (by up to 3s), and use monotonic latencies
+`, buf.String())
+}
@@ -0,0 +1,181 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+)
+
+// benchmarkSummary is the summary of a target's results, which is printed
+// as a markdown table with --summary-markdown, and saved with --summary-save
+// to be compared against as a --summary-baseline.
+type benchmarkSummary struct {
+	Target   string  `json:"target"`
+	Requests int     `json:"requests"`
+	Errors   int     `json:"errors"`
+	RPS      float64 `json:"rps"`
+	P50Ms    float64 `json:"p50Ms"`
+	P90Ms    float64 `json:"p90Ms"`
+	P99Ms    float64 `json:"p99Ms"`
+	MaxMs    float64 `json:"maxMs"`
+}
+
+func newBenchmarkSummary(target string, s *benchmarkState, total time.Duration) benchmarkSummary {
+	sort.Sort(byDuration(s.latencies))
+	ms := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Millisecond)
+	}
+	return benchmarkSummary{
+		Target:   target,
+		Requests: len(s.latencies),
+		Errors:   countMessages(s.errors),
+		RPS:      float64(len(s.latencies)) / total.Seconds(),
+		P50Ms:    ms(s.getQuantile(0.5)),
+		P90Ms:    ms(s.getQuantile(0.9)),
+		P99Ms:    ms(s.getQuantile(0.99)),
+		MaxMs:    ms(s.getQuantile(1)),
+	}
+}
+
+// errorRate returns the percentage of requests that failed.
+func (s benchmarkSummary) errorRate() float64 {
+	if total := s.Requests + s.Errors; total > 0 {
+		return 100 * float64(s.Errors) / float64(total)
+	}
+	return 0
+}
+
+// benchmarkSummaries returns the summary of each target, and the overall
+// summary with the target "all" if there are multiple targets.
+func benchmarkSummaries(targets []benchmarkTarget, states []*benchmarkState, overall *benchmarkState, total time.Duration) []benchmarkSummary {
+	summaries := make([]benchmarkSummary, 0, len(targets)+1)
+	for i, target := range targets {
+		summaries = append(summaries, newBenchmarkSummary(target.name, states[i], total))
+	}
+	if len(targets) > 1 {
+		summaries = append(summaries, newBenchmarkSummary("all", overall, total))
+	}
+	return summaries
+}
+
+func readSummaries(file string) ([]benchmarkSummary, error) {
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var summaries []benchmarkSummary
+	if err := json.Unmarshal(contents, &summaries); err != nil {
+		return nil, fmt.Errorf("failed to parse %v: %v", file, err)
+	}
+	return summaries, nil
+}
+
+func writeSummaries(file string, summaries []benchmarkSummary) error {
+	contents, err := json.MarshalIndent(summaries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append(contents, '\n'), 0644)
+}
+
+// summaryMarkdown returns a markdown table of the summaries. If there is a
+// baseline for a target, the change from the baseline is included.
+func summaryMarkdown(summaries, baseline []benchmarkSummary) string {
+	baselines := make(map[string]benchmarkSummary, len(baseline))
+	for _, s := range baseline {
+		baselines[s.Target] = s
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "| Target | Requests | RPS | p50 | p90 | p99 | Max | Error rate |\n")
+	fmt.Fprintf(buf, "| --- | ---: | ---: | ---: | ---: | ---: | ---: | ---: |\n")
+	for _, s := range summaries {
+		base, hasBase := baselines[s.Target]
+		value := func(cur, prev float64, format string) string {
+			v := fmt.Sprintf(format, cur)
+			if hasBase && prev != 0 {
+				v += fmt.Sprintf(" (%+.1f%%)", 100*(cur-prev)/prev)
+			}
+			return v
+		}
+
+		errorRate := fmt.Sprintf("%.2f%%", s.errorRate())
+		if hasBase {
+			// Error rates are compared in percentage points, as the baseline is often 0.
+			errorRate += fmt.Sprintf(" (%+.2fpp)", s.errorRate()-base.errorRate())
+		}
+
+		fmt.Fprintf(buf, "| %v | %v | %v | %v | %v | %v | %v | %v |\n",
+			markdownEscape(s.Target), s.Requests,
+			value(s.RPS, base.RPS, "%.2f"),
+			value(s.P50Ms, base.P50Ms, "%.3fms"),
+			value(s.P90Ms, base.P90Ms, "%.3fms"),
+			value(s.P99Ms, base.P99Ms, "%.3fms"),
+			value(s.MaxMs, base.MaxMs, "%.3fms"),
+			errorRate)
+	}
+	return buf.String()
+}
+
+// markdownEscape escapes characters that would break a markdown table cell.
+func markdownEscape(s string) string {
+	buf := &bytes.Buffer{}
+	for _, r := range s {
+		switch r {
+		case '|', '\\', '`', '*', '_':
+			buf.WriteRune('\\')
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+// printSummaries prints the summaries as markdown with --summary-markdown,
+// and saves them with --summary-save.
+func printSummaries(out output, logger *logger, opts BenchmarkOptions, summaries []benchmarkSummary) {
+	if opts.SummaryMarkdown {
+		var baseline []benchmarkSummary
+		if opts.SummaryBaseline != "" {
+			var err error
+			baseline, err = readSummaries(opts.SummaryBaseline)
+			if os.IsNotExist(err) {
+				// The first run in CI won't have a baseline yet.
+				logger.Infof("no summary baseline at %v, printing the summary without changes", opts.SummaryBaseline)
+			} else if err != nil {
+				logger.Warnf("failed to read summary baseline: %v", err)
+			}
+		}
+		out.Printf("\n%s", summaryMarkdown(summaries, baseline))
+	}
+
+	if opts.SummarySave != "" {
+		if err := writeSummaries(opts.SummarySave, summaries); err != nil {
+			logger.Warnf("failed to save summary: %v", err)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yarpc/yab/statsd"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewBenchmarkSummary(t *testing.T) {
+	s := newBenchmarkState(statsd.Noop)
+	for _, ms := range []int{4, 1, 3, 2} {
+		s.recordLatency(time.Duration(ms) * time.Millisecond)
+	}
+	s.recordError(assert.AnError)
+
+	summary := newBenchmarkSummary("t", s, 2*time.Second)
+	assert.Equal(t, benchmarkSummary{
+		Target:   "t",
+		Requests: 4,
+		Errors:   1,
+		RPS:      2,
+		P50Ms:    2.5,
+		P90Ms:    3.7,
+		P99Ms:    3.97,
+		MaxMs:    4,
+	}, summary)
+	assert.Equal(t, 20.0, summary.errorRate(), "Unexpected error rate")
+	assert.Equal(t, 0.0, benchmarkSummary{}.errorRate(), "No requests should have no error rate")
+}
+
+func TestSummaryMarkdown(t *testing.T) {
+	summaries := []benchmarkSummary{
+		{Target: "Svc::a|b", Requests: 990, Errors: 10, RPS: 110, P50Ms: 1, P90Ms: 2, P99Ms: 3, MaxMs: 4},
+		{Target: "new", Requests: 100, RPS: 10, P50Ms: 1, P90Ms: 1, P99Ms: 1, MaxMs: 1},
+	}
+	baseline := []benchmarkSummary{
+		{Target: "Svc::a|b", Requests: 1000, RPS: 100, P50Ms: 1, P90Ms: 2.5, P99Ms: 0, MaxMs: 2},
+		{Target: "removed", Requests: 1},
+	}
+
+	assert.Equal(t, strings.Join([]string{
+		"| Target | Requests | RPS | p50 | p90 | p99 | Max | Error rate |",
+		"| --- | ---: | ---: | ---: | ---: | ---: | ---: | ---: |",
+		`| Svc::a\|b | 990 | 110.00 | 1.000ms | 2.000ms | 3.000ms | 4.000ms | 1.00% |`,
+		"| new | 100 | 10.00 | 1.000ms | 1.000ms | 1.000ms | 1.000ms | 0.00% |",
+		"",
+	}, "\n"), summaryMarkdown(summaries, nil), "Unexpected summary without a baseline")
+
+	assert.Equal(t, strings.Join([]string{
+		"| Target | Requests | RPS | p50 | p90 | p99 | Max | Error rate |",
+		"| --- | ---: | ---: | ---: | ---: | ---: | ---: | ---: |",
+		`| Svc::a\|b | 990 | 110.00 (+10.0%) | 1.000ms (+0.0%) | 2.000ms (-20.0%) | 3.000ms | 4.000ms (+100.0%) | 1.00% (+1.00pp) |`,
+		"| new | 100 | 10.00 | 1.000ms | 1.000ms | 1.000ms | 1.000ms | 0.00% |",
+		"",
+	}, "\n"), summaryMarkdown(summaries, baseline), "Unexpected summary with a baseline")
+}
+
+func TestMarkdownEscape(t *testing.T) {
+	assert.Equal(t, "Svc::get\\_user \\| \\*all\\* \\\\ \\`x\\`", markdownEscape("Svc::get_user | *all* \\ `x`"))
+}
+
+func TestReadSummariesErrors(t *testing.T) {
+	_, err := readSummaries(filepath.Join("does", "not", "exist.json"))
+	assert.True(t, os.IsNotExist(err), "Expected not exist error, got %v", err)
+
+	f := writeFile(t, "summary", "{}")
+	defer os.Remove(f)
+	_, err = readSummaries(f)
+	if assert.Error(t, err, "Expected parse error") {
+		assert.Contains(t, err.Error(), "failed to parse "+f)
+	}
+}
+
+func TestBenchmarkSummaryMarkdown(t *testing.T) {
+	s := newServer(t)
+	defer s.shutdown()
+	s.register(fooMethod, methods.echo())
+
+	dir, err := ioutil.TempDir("", "yab-summary")
+	require.NoError(t, err, "TempDir failed")
+	defer os.RemoveAll(dir)
+	summaryFile := filepath.Join(dir, "summary.json")
+
+	run := func() string {
+		m := benchmarkMethodForTest(t, fooMethod)
+		buf, out := getOutput(t)
+		runBenchmark(out, Options{
+			ROpts: RequestOptions{MethodName: fooMethod},
+			BOpts: BenchmarkOptions{
+				MaxRequests:     100,
+				MaxDuration:     time.Second,
+				Connections:     1,
+				Concurrency:     1,
+				SummaryMarkdown: true,
+				SummaryBaseline: summaryFile,
+				SummarySave:     summaryFile,
+			},
+			TOpts: s.transportOpts(),
+		}, m)
+		return buf.String()
+	}
+
+	output := run()
+	assert.Contains(t, output, "Note: no summary baseline at "+summaryFile)
+	assert.Contains(t, output, "\n| Target | Requests | RPS | p50 | p90 | p99 | Max | Error rate |\n")
+	assert.Contains(t, output, "| Simple::foo | 100 | ")
+	assert.Contains(t, output, " | 0.00% |\n", "Expected no changes without a baseline")
+
+	summaries, err := readSummaries(summaryFile)
+	require.NoError(t, err, "Failed to read saved summary")
+	require.Len(t, summaries, 1, "Unexpected summaries")
+	assert.Equal(t, fooMethod, summaries[0].Target)
+	assert.Equal(t, 100, summaries[0].Requests)
+
+	output = run()
+	assert.NotContains(t, output, "no summary baseline")
+	assert.Contains(t, output, " | 0.00% (+0.00pp) |\n", "Expected changes from the baseline")
+}
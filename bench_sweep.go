@@ -0,0 +1,209 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yarpc/yab/thrift"
+
+	"github.com/thriftrw/thriftrw-go/compile"
+	"gopkg.in/yaml.v2"
+)
+
+var errAllMethodsThrift = errors.New("--all-methods requires a Thrift file")
+
+// sweepResult is the result of benchmarking a single method in a sweep,
+// or a single phase of a plan.
+type sweepResult struct {
+	name     string
+	requests int
+	errors   int
+	rps      float64
+	p50      time.Duration
+	p90      time.Duration
+	p99      time.Duration
+}
+
+// sweepMethods returns the methods to benchmark in turn, which are either
+// the --method flags, or with --all-methods, the methods of the service
+// specified by --method, or of every service in the Thrift file.
+func sweepMethods(opts Options, module *compile.Module) ([]string, error) {
+	if !opts.BOpts.AllMethods {
+		return opts.ROpts.Methods, nil
+	}
+	if module == nil {
+		return nil, errAllMethodsThrift
+	}
+
+	svcName, _, err := thrift.SplitMethod(opts.ROpts.MethodName)
+	if err != nil {
+		return nil, err
+	}
+
+	var methods []string
+	for _, svc := range thrift.Services(module) {
+		if svcName != "" && svc.Name != svcName {
+			continue
+		}
+		methods = append(methods, svc.Methods()...)
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("no methods found for service %q", svcName)
+	}
+	return methods, nil
+}
+
+// findFunction returns the spec for a Service::method, including methods
+// inherited from parent services, or nil if it is not found.
+func findFunction(module *compile.Module, fullMethod string) *compile.FunctionSpec {
+	svcName, methodName, err := thrift.SplitMethod(fullMethod)
+	if err != nil {
+		return nil
+	}
+	svc, err := thrift.LookupService(module, svcName)
+	if err != nil {
+		return nil
+	}
+	for ; svc != nil; svc = svc.Parent {
+		if f, ok := svc.Functions[methodName]; ok {
+			return f
+		}
+	}
+	return nil
+}
+
+// runSweep benchmarks each method in turn, and prints a table comparing
+// the methods, with the slowest methods first. Each method uses the request
+// from --request or --file, or for Thrift, a minimal request.
+func runSweep(out output, opts Options) {
+	if opts.BOpts.MaxDuration == 0 {
+		out.Fatalf("Benchmarking multiple methods requires --maxDuration\n")
+	}
+
+	var err error
+	opts.ROpts.ThriftFile, err = registryThriftFile(opts.ROpts, opts.TOpts.ServiceName)
+	if err != nil {
+		out.Fatalf("Failed while fetching IDL from registry: %v\n", err)
+	}
+
+	var module *compile.Module
+	if opts.ROpts.ThriftFile != "" {
+		thriftFile, err := localFile(opts.ROpts.ThriftFile, opts.ROpts.ThriftChecksum)
+		if err != nil {
+			out.Fatalf("Failed while loading Thrift file: %v\n", err)
+		}
+		if module, err = thrift.Parse(thriftFile); err != nil {
+			out.Fatalf("Failed while parsing Thrift file: %v\n", err)
+		}
+		opts.ROpts.ThriftFile = thriftFile
+	}
+
+	methods, err := sweepMethods(opts, module)
+	if err != nil {
+		out.Fatalf("Failed while parsing options: %v\n", err)
+	}
+
+	var request interface{}
+	if opts.ROpts.RequestJSON != "" || opts.ROpts.RequestFile != "" {
+		reqInput, err := getRequestInput(opts.ROpts.RequestJSON, opts.ROpts.RequestFile, opts.ROpts.RequestChecksum)
+		if err != nil {
+			out.Fatalf("Failed while loading body input: %v\n", err)
+		}
+		if err := yaml.Unmarshal(reqInput, &request); err != nil {
+			out.Fatalf("Failed while parsing body input: %v\n", err)
+		}
+	}
+
+	results := make([]sweepResult, 0, len(methods))
+	for _, method := range methods {
+		config := targetConfig{Method: method, Request: request}
+		if request == nil && module != nil {
+			if f := findFunction(module, method); f != nil {
+				config.Request = thrift.MinimalRequest(f)
+			}
+		}
+
+		target, err := newBenchmarkTarget(config, opts)
+		if err != nil {
+			out.Fatalf("Failed while creating request for %v: %v\n", method, err)
+		}
+
+		out.Printf("Method %v:\n", method)
+		state, total := runBenchmarkTargets(out, opts, []benchmarkTarget{target})
+		out.Printf("\n")
+		results = append(results, newSweepResult(method, state, total))
+	}
+
+	printSweepResults(out, results)
+}
+
+func newSweepResult(name string, state *benchmarkState, total time.Duration) sweepResult {
+	sort.Sort(byDuration(state.latencies))
+	numErrors := 0
+	for _, n := range state.errors {
+		numErrors += n
+	}
+	return sweepResult{
+		name:     name,
+		requests: len(state.latencies),
+		errors:   numErrors,
+		rps:      float64(len(state.latencies)) / total.Seconds(),
+		p50:      state.getQuantile(0.5),
+		p90:      state.getQuantile(0.9),
+		p99:      state.getQuantile(0.99),
+	}
+}
+
+// printSweepResults prints a table of the results, with the slowest methods first.
+func printSweepResults(out output, results []sweepResult) {
+	sort.Stable(byP99(results))
+
+	out.Printf("Method results (slowest p99 first):\n")
+	printResultsTable(out, "Method", results)
+}
+
+// printResultsTable prints a row for each result, with the name in the given column.
+func printResultsTable(out output, column string, results []sweepResult) {
+	width := len(column)
+	for _, r := range results {
+		if len(r.name) > width {
+			width = len(r.name)
+		}
+	}
+
+	out.Printf("  %-*v  %10v  %8v  %10v  %12v  %12v  %12v\n", width, column, "Requests", "Errors", "RPS", "p50", "p90", "p99")
+	out.Printf("  %v\n", strings.Repeat("-", width+76))
+	for _, r := range results {
+		out.Printf("  %-*v  %10v  %8v  %10.2f  %12v  %12v  %12v\n", width, r.name, r.requests, r.errors, r.rps, r.p50, r.p90, r.p99)
+	}
+}
+
+// byP99 sorts sweep results by their p99 latency, slowest first.
+type byP99 []sweepResult
+
+func (p byP99) Len() int           { return len(p) }
+func (p byP99) Less(i, j int) bool { return p[i].p99 > p[j].p99 }
+func (p byP99) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
@@ -0,0 +1,167 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel-go/raw"
+	"github.com/yarpc/yab/thrift"
+	"golang.org/x/net/context"
+)
+
+func TestSweepMethods(t *testing.T) {
+	module, err := thrift.Parse(validThrift)
+	require.NoError(t, err, "failed to parse Thrift file")
+
+	tests := []struct {
+		msg      string
+		opts     Options
+		noThrift bool
+		want     []string
+		wantErr  string
+	}{
+		{
+			msg:  "method flags",
+			opts: Options{ROpts: RequestOptions{Methods: []string{"Simple::foo", "Simple::bar"}}},
+			want: []string{"Simple::foo", "Simple::bar"},
+		},
+		{
+			msg: "all methods of a service",
+			opts: Options{
+				ROpts: RequestOptions{MethodName: "Simple"},
+				BOpts: BenchmarkOptions{AllMethods: true},
+			},
+			want: []string{"Simple::bar", "Simple::foo", "Simple::thriftEx"},
+		},
+		{
+			msg:  "all methods of every service",
+			opts: Options{BOpts: BenchmarkOptions{AllMethods: true}},
+			want: []string{"Simple::bar", "Simple::foo", "Simple::thriftEx"},
+		},
+		{
+			msg: "unknown service",
+			opts: Options{
+				ROpts: RequestOptions{MethodName: "Unknown"},
+				BOpts: BenchmarkOptions{AllMethods: true},
+			},
+			wantErr: `no methods found for service "Unknown"`,
+		},
+		{
+			msg:      "all methods without Thrift",
+			opts:     Options{BOpts: BenchmarkOptions{AllMethods: true}},
+			noThrift: true,
+			wantErr:  errAllMethodsThrift.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		m := module
+		if tt.noThrift {
+			m = nil
+		}
+		got, err := sweepMethods(tt.opts, m)
+		if tt.wantErr != "" {
+			if assert.Error(t, err, "%v: expected error", tt.msg) {
+				assert.Contains(t, err.Error(), tt.wantErr, "%v: unexpected error", tt.msg)
+			}
+			continue
+		}
+		if assert.NoError(t, err, "%v: unexpected error", tt.msg) {
+			assert.Equal(t, tt.want, got, "%v: unexpected methods", tt.msg)
+		}
+	}
+}
+
+func TestRunSweep(t *testing.T) {
+	var fooRequests, barRequests int32
+	s := newServer(t)
+	defer s.shutdown()
+	s.register(fooMethod, methods.errorIf(func() bool {
+		atomic.AddInt32(&fooRequests, 1)
+		return false
+	}))
+	bar := methods.customArg3([]byte{
+		8,    /* i32 */
+		0, 0, /* field ID */
+		0, 0, 0, 1,
+		0, /* STOP */
+	})
+	s.register("Simple::bar", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		atomic.AddInt32(&barRequests, 1)
+		time.Sleep(time.Millisecond)
+		return bar(ctx, args)
+	})
+
+	buf, out := getOutput(t)
+	runWithOptions(Options{
+		ROpts: RequestOptions{
+			ThriftFile: validThrift,
+			Methods:    []string{fooMethod, "Simple::bar"},
+			MethodName: fooMethod,
+		},
+		TOpts: s.transportOpts(),
+		BOpts: BenchmarkOptions{
+			MaxRequests: 20,
+			MaxDuration: time.Second,
+			Connections: 1,
+			Concurrency: 1,
+		},
+	}, out)
+
+	output := buf.String()
+	assert.Contains(t, output, "Method Simple::foo:\nBenchmark parameters:")
+	assert.Contains(t, output, "Method Simple::bar:\nBenchmark parameters:")
+	assert.EqualValues(t, 20+warmupRequests, atomic.LoadInt32(&fooRequests), "unexpected foo requests")
+	assert.EqualValues(t, 20+warmupRequests, atomic.LoadInt32(&barRequests), "unexpected bar requests")
+
+	table := output[strings.Index(output, "Method results"):]
+	lines := strings.Split(strings.TrimSpace(table), "\n")
+	require.Len(t, lines, 5, "unexpected table: %v", table)
+	assert.Contains(t, lines[1], "Method")
+	assert.Regexp(t, `^  Simple::bar\s+20\s+0\s`, lines[3], "the slowest method should be first")
+	assert.Regexp(t, `^  Simple::foo\s+20\s+0\s`, lines[4], "unexpected result for foo")
+}
+
+func TestRunSweepRequiresDuration(t *testing.T) {
+	buf, out := getOutput(t)
+	var fatal string
+	out = testOutput{
+		Buffer: buf,
+		fatalf: func(format string, args ...interface{}) {
+			fatal = format
+		},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runSweep(out, Options{ROpts: RequestOptions{Methods: []string{"a", "b"}}})
+	}()
+	<-done
+
+	assert.Equal(t, "Benchmarking multiple methods requires --maxDuration\n", fatal)
+}
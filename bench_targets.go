@@ -0,0 +1,152 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+var errNoTargets = errors.New("targets file must contain at least one target")
+
+// targetConfig is a single target in a targets file.
+type targetConfig struct {
+	Name        string            `yaml:"name"`
+	Service     string            `yaml:"service"`
+	Method      string            `yaml:"method"`
+	Thrift      string            `yaml:"thrift"`
+	Encoding    string            `yaml:"encoding"`
+	Request     interface{}       `yaml:"request"`
+	RequestFile string            `yaml:"requestFile"`
+	Headers     map[string]string `yaml:"headers"`
+	Weight      int               `yaml:"weight"`
+}
+
+// loadTargets parses the YAML or JSON targets file at path, and returns the
+// benchmark targets. Any fields that are not specified for a target use the
+// values from opts.
+func loadTargets(path string, opts Options) ([]benchmarkTarget, error) {
+	contents, err := readFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open targets file: %v", err)
+	}
+
+	var configs []targetConfig
+	if err := yaml.Unmarshal(contents, &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse targets file: %v", err)
+	}
+	if len(configs) == 0 {
+		return nil, errNoTargets
+	}
+
+	targets := make([]benchmarkTarget, len(configs))
+	for i, config := range configs {
+		targets[i], err = newBenchmarkTarget(config, opts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target %v: %v", i, err)
+		}
+	}
+
+	return targets, nil
+}
+
+func newBenchmarkTarget(config targetConfig, opts Options) (benchmarkTarget, error) {
+	rOpts := opts.ROpts
+	rOpts.Health = false
+	rOpts.MethodName = config.Method
+	if config.Thrift != "" {
+		rOpts.ThriftFile = config.Thrift
+	}
+	if config.Encoding != "" {
+		if err := rOpts.Encoding.UnmarshalFlag(config.Encoding); err != nil {
+			return benchmarkTarget{}, err
+		}
+	}
+
+	tOpts := opts.TOpts
+	if config.Service != "" {
+		tOpts.ServiceName = config.Service
+	}
+
+	if config.Weight < 0 {
+		return benchmarkTarget{}, fmt.Errorf("weight must not be negative, got %v", config.Weight)
+	}
+	if config.Weight == 0 {
+		config.Weight = 1
+	}
+	if config.Name == "" {
+		config.Name = config.Method
+	}
+
+	var reqInput []byte
+	if config.Request != nil {
+		var err error
+		if reqInput, err = yaml.Marshal(config.Request); err != nil {
+			return benchmarkTarget{}, fmt.Errorf("failed to marshal request: %v", err)
+		}
+	} else if config.RequestFile != "" {
+		var err error
+		if reqInput, err = getRequestInput("", config.RequestFile, ""); err != nil {
+			return benchmarkTarget{}, err
+		}
+	}
+
+	serializer, err := NewSerializer(rOpts)
+	if err != nil {
+		return benchmarkTarget{}, err
+	}
+
+	req, err := serializer.Request(reqInput)
+	if err != nil {
+		return benchmarkTarget{}, fmt.Errorf("failed to parse request: %v", err)
+	}
+
+	if tOpts.HashField != "" {
+		if req.ShardKey, err = getShardKey(reqInput, tOpts.HashField); err != nil {
+			return benchmarkTarget{}, err
+		}
+	}
+
+	if req.Headers, err = secrets.resolveHeaders(config.Headers); err != nil {
+		return benchmarkTarget{}, err
+	}
+	if req.Headers == nil {
+		if req.Headers, err = getHeaders(rOpts.HeadersJSON, rOpts.HeadersFile); err != nil {
+			return benchmarkTarget{}, err
+		}
+	}
+
+	req.Timeout = rOpts.Timeout.Duration()
+	if req.Timeout == 0 {
+		req.Timeout = time.Second
+	}
+
+	return benchmarkTarget{
+		name:       config.Name,
+		methodName: config.Method,
+		weight:     config.Weight,
+		method:     benchmarkMethod{serializer: serializer, req: req},
+		tOpts:      tOpts,
+	}, nil
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yarpc/yab/encoding"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadTargets(t *testing.T) {
+	targetsFile := writeFile(t, "targets", `
+- method: Simple::foo
+  weight: 3
+- name: echo
+  service: other
+  method: echo
+  encoding: raw
+  request: hello
+  headers: {k: v}
+`)
+	defer os.Remove(targetsFile)
+
+	opts := Options{
+		ROpts: RequestOptions{ThriftFile: validThrift},
+		TOpts: TransportOptions{ServiceName: "foo"},
+	}
+	targets, err := loadTargets(targetsFile, opts)
+	require.NoError(t, err, "loadTargets failed")
+	require.Len(t, targets, 2, "Unexpected number of targets")
+
+	assert.Equal(t, "Simple::foo", targets[0].name, "Name should default to the method")
+	assert.Equal(t, 3, targets[0].weight, "Weight mismatch")
+	assert.Equal(t, "foo", targets[0].tOpts.ServiceName, "Service should default to --service")
+	assert.Equal(t, encoding.Thrift, targets[0].method.serializer.Encoding(), "Encoding mismatch")
+	assert.Equal(t, time.Second, targets[0].method.req.Timeout, "Timeout mismatch")
+
+	assert.Equal(t, "echo", targets[1].name, "Name mismatch")
+	assert.Equal(t, 1, targets[1].weight, "Weight should default to 1")
+	assert.Equal(t, "other", targets[1].tOpts.ServiceName, "Service mismatch")
+	assert.Equal(t, encoding.Raw, targets[1].method.serializer.Encoding(), "Encoding mismatch")
+	assert.Equal(t, "hello\n", string(targets[1].method.req.Body), "Request body mismatch")
+	assert.Equal(t, map[string]string{"k": "v"}, targets[1].method.req.Headers, "Headers mismatch")
+}
+
+func TestLoadTargetsErrors(t *testing.T) {
+	tests := []struct {
+		contents string
+		errMsg   string
+	}{
+		{contents: `[]`, errMsg: errNoTargets.Error()},
+		{contents: `{`, errMsg: "failed to parse targets file"},
+		{contents: `[{method: ""}]`, errMsg: errMissingMethodName.Error()},
+		{contents: `[{method: "Simple::foo", weight: -1}]`, errMsg: "weight must not be negative"},
+		{contents: `[{method: "Simple::unknown"}]`, errMsg: "invalid target 0"},
+		{contents: `[{method: "echo", encoding: "unknown"}]`, errMsg: "invalid target 0"},
+	}
+
+	for _, tt := range tests {
+		targetsFile := writeFile(t, "targets", tt.contents)
+		defer os.Remove(targetsFile)
+
+		_, err := loadTargets(targetsFile, Options{ROpts: RequestOptions{ThriftFile: validThrift}})
+		if assert.Error(t, err, "loadTargets(%v) should fail", tt.contents) {
+			assert.Contains(t, err.Error(), tt.errMsg, "Unexpected error for %v", tt.contents)
+		}
+	}
+
+	_, err := loadTargets("/fake/file", Options{})
+	assert.Error(t, err, "loadTargets should fail for a missing file")
+}
+
+func TestBenchmarkTargets(t *testing.T) {
+	var fooRequests, echoRequests int32
+	s := newServer(t)
+	defer s.shutdown()
+	s.register(fooMethod, methods.errorIf(func() bool {
+		atomic.AddInt32(&fooRequests, 1)
+		return false
+	}))
+	s.register("echo", methods.errorIf(func() bool {
+		atomic.AddInt32(&echoRequests, 1)
+		return false
+	}))
+
+	targetsFile := writeFile(t, "targets", `
+- method: Simple::foo
+  weight: 3
+- method: echo
+  encoding: raw
+`)
+	defer os.Remove(targetsFile)
+
+	buf, out := getOutput(t)
+	runWithOptions(Options{
+		ROpts: RequestOptions{ThriftFile: validThrift},
+		TOpts: s.transportOpts(),
+		BOpts: BenchmarkOptions{
+			TargetsFile: targetsFile,
+			MaxRequests: 100,
+			MaxDuration: time.Second,
+			Connections: 4,
+			Concurrency: 2,
+		},
+	}, out)
+
+	bufStr := buf.String()
+	assert.Contains(t, bufStr, "Targets:         2")
+	assert.Contains(t, bufStr, "Target results:")
+	assert.Contains(t, bufStr, "Simple::foo (weight 3): 75 requests")
+	assert.Contains(t, bufStr, "echo (weight 1): 25 requests")
+
+	// Each connection makes warm up requests, and foo has 3 of the 4 connections.
+	assert.EqualValues(t, 75+3*warmupRequests, fooRequests, "Unexpected number of foo requests")
+	assert.EqualValues(t, 25+warmupRequests, echoRequests, "Unexpected number of echo requests")
+}
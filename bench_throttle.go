@@ -0,0 +1,127 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/yarpc/yab/transport"
+
+	"github.com/uber/tchannel-go"
+)
+
+// throttledRetryAfter returns whether the call was rejected as the service is
+// rate limiting the caller or is overloaded, such as a HTTP 429 or a TChannel
+// busy error, and how long the service asked the caller to wait, if at all.
+func throttledRetryAfter(err error) (time.Duration, bool) {
+	if te, ok := err.(transport.ThrottledError); ok {
+		return te.RetryAfter, true
+	}
+	if tchannel.GetSystemErrorCode(err) == tchannel.ErrCodeBusy {
+		return 0, true
+	}
+	return 0, false
+}
+
+// defaultMaxRetryAfter is the longest pause for a throttled response if
+// --max-retry-after is not set.
+const defaultMaxRetryAfter = 10 * time.Second
+
+// throttlePause pauses all the workers of a target when the service asks
+// the caller to retry later, so the benchmark slows down rather than
+// sending requests that will be throttled.
+type throttlePause struct {
+	// until is the time in Unix nanoseconds that workers are paused until.
+	until int64
+
+	// max is the longest pause, so a large Retry-After doesn't stall the
+	// benchmark, and capped counts the pauses that were shortened to max.
+	max    time.Duration
+	capped int64
+}
+
+func newThrottlePause(max time.Duration) *throttlePause {
+	if max <= 0 {
+		max = defaultMaxRetryAfter
+	}
+	return &throttlePause{max: max}
+}
+
+// pause pauses the workers for d, unless they are already paused for longer.
+// Pauses longer than the maximum are capped.
+func (p *throttlePause) pause(d time.Duration) {
+	if p == nil || d <= 0 {
+		return
+	}
+	if p.max > 0 && d > p.max {
+		atomic.AddInt64(&p.capped, 1)
+		d = p.max
+	}
+
+	until := time.Now().Add(d).UnixNano()
+	for {
+		cur := atomic.LoadInt64(&p.until)
+		if cur >= until || atomic.CompareAndSwapInt64(&p.until, cur, until) {
+			return
+		}
+	}
+}
+
+// wait blocks while the workers are paused, or until done is closed.
+func (p *throttlePause) wait(done <-chan struct{}) {
+	if p == nil {
+		return
+	}
+
+	d := time.Duration(atomic.LoadInt64(&p.until) - time.Now().UnixNano())
+	if d <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-done:
+	}
+}
+
+// printThrottlePauses prints the number of pauses that were capped, so it's
+// clear when the benchmark didn't wait as long as the service asked.
+func printThrottlePauses(out output, pauses []*throttlePause) {
+	var capped int64
+	var max time.Duration
+	for _, p := range pauses {
+		if p == nil {
+			continue
+		}
+		if n := atomic.LoadInt64(&p.capped); n > 0 {
+			capped += n
+			max = p.max
+		}
+	}
+	if capped == 0 {
+		return
+	}
+
+	out.Printf("Retry-After pauses capped at %v: %v\n", max, capped)
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yarpc/yab/encoding"
+	"github.com/yarpc/yab/transport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel-go"
+	"github.com/uber/tchannel-go/raw"
+	"golang.org/x/net/context"
+)
+
+func TestThrottledRetryAfter(t *testing.T) {
+	tests := []struct {
+		msg            string
+		err            error
+		wantRetryAfter time.Duration
+		wantThrottled  bool
+	}{
+		{
+			msg: "no error",
+		},
+		{
+			msg: "other error",
+			err: errors.New("failed"),
+		},
+		{
+			msg:            "HTTP 429",
+			err:            transport.ThrottledError{Message: "429", RetryAfter: time.Second},
+			wantRetryAfter: time.Second,
+			wantThrottled:  true,
+		},
+		{
+			msg:           "TChannel busy",
+			err:           tchannel.NewSystemError(tchannel.ErrCodeBusy, "busy"),
+			wantThrottled: true,
+		},
+		{
+			msg: "TChannel timeout",
+			err: tchannel.NewSystemError(tchannel.ErrCodeTimeout, "timeout"),
+		},
+	}
+
+	for _, tt := range tests {
+		retryAfter, throttled := throttledRetryAfter(tt.err)
+		assert.Equal(t, tt.wantThrottled, throttled, "%v: throttled mismatch", tt.msg)
+		assert.Equal(t, tt.wantRetryAfter, retryAfter, "%v: Retry-After mismatch", tt.msg)
+	}
+}
+
+func TestThrottlePause(t *testing.T) {
+	var nilPause *throttlePause
+	nilPause.pause(time.Hour)
+	nilPause.wait(nil)
+
+	p := &throttlePause{}
+	start := time.Now()
+	p.wait(nil)
+	assert.True(t, time.Since(start) < 50*time.Millisecond, "Expected no wait before pausing")
+
+	p.pause(100 * time.Millisecond)
+	// A shorter pause doesn't shorten the existing pause.
+	p.pause(time.Millisecond)
+	p.wait(nil)
+	assert.True(t, time.Since(start) >= 100*time.Millisecond, "Expected wait until the end of the pause")
+
+	p.pause(time.Hour)
+	done := make(chan struct{})
+	close(done)
+	p.wait(done)
+}
+
+func TestThrottlePauseCapped(t *testing.T) {
+	p := newThrottlePause(50 * time.Millisecond)
+	start := time.Now()
+	p.pause(time.Hour)
+	p.pause(10 * time.Millisecond)
+	p.wait(nil)
+	assert.True(t, time.Since(start) < time.Second, "Expected the pause to be capped")
+	assert.EqualValues(t, 1, p.capped, "Expected one capped pause")
+
+	buf, out := getOutput(t)
+	printThrottlePauses(out, []*throttlePause{nil, p})
+	assert.Equal(t, "Retry-After pauses capped at 50ms: 1\n", buf.String())
+
+	buf, out = getOutput(t)
+	printThrottlePauses(out, []*throttlePause{nil, newThrottlePause(0)})
+	assert.Empty(t, buf.String(), "Expected no output without capped pauses")
+	assert.Equal(t, defaultMaxRetryAfter, newThrottlePause(0).max, "Expected the default maximum")
+}
+
+func TestBenchmarkThrottledTChannel(t *testing.T) {
+	var requests int32
+	s := newServer(t)
+	defer s.shutdown()
+	s.register(fooMethod, func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		// Succeed for warm up requests, and then every other request is busy.
+		if n := atomic.AddInt32(&requests, 1); n > warmupRequests && n%2 == 0 {
+			return nil, tchannel.ErrServerBusy
+		}
+		return &raw.Res{Arg2: args.Arg2, Arg3: args.Arg3}, nil
+	})
+
+	m := benchmarkMethodForTest(t, fooMethod)
+	buf, out := getOutput(t)
+	runBenchmark(out, Options{
+		BOpts: BenchmarkOptions{
+			MaxRequests: 100,
+			MaxDuration: time.Second,
+			Connections: 1,
+			Concurrency: 1,
+		},
+		TOpts: s.transportOpts(),
+	}, m)
+
+	assert.NotContains(t, buf.String(), "Errors:", "Busy responses should not be errors")
+	assert.Contains(t, buf.String(), "Throttled:", "Expected throttled responses")
+	assert.Contains(t, buf.String(), "Total throttled: 50", "Unexpected number of throttled responses")
+	assert.Contains(t, buf.String(), "Total requests:    50", "Unexpected number of successful responses")
+}
+
+func TestBenchmarkHonorRetryAfter(t *testing.T) {
+	var requests int32
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= warmupRequests {
+			io.WriteString(w, "{}")
+			return
+		}
+		w.Header().Set("Retry-After", "10")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer svr.Close()
+
+	serializer := encoding.NewJSON("method")
+	req, err := serializer.Request([]byte("{}"))
+	require.NoError(t, err, "Failed to serialize request")
+	req.Timeout = time.Second
+
+	tests := []struct {
+		honor         bool
+		wantThrottled string
+	}{
+		{honor: true, wantThrottled: "Total throttled: 1\n"},
+		{honor: false, wantThrottled: "Total throttled: 100\n"},
+	}
+
+	for _, tt := range tests {
+		atomic.StoreInt32(&requests, 0)
+
+		buf, out := getOutput(t)
+		start := time.Now()
+		runBenchmark(out, Options{
+			BOpts: BenchmarkOptions{
+				MaxRequests:     100,
+				MaxDuration:     500 * time.Millisecond,
+				Connections:     1,
+				Concurrency:     1,
+				HonorRetryAfter: tt.honor,
+			},
+			TOpts: TransportOptions{ServiceName: "foo", HostPorts: []string{svr.URL}},
+		}, benchmarkMethod{serializer: serializer, req: req})
+
+		assert.True(t, time.Since(start) < time.Second, "honor %v: benchmark should stop at the duration", tt.honor)
+		assert.Contains(t, buf.String(), tt.wantThrottled, "honor %v: unexpected throttled responses", tt.honor)
+	}
+}
@@ -21,7 +21,11 @@
 package main
 
 import (
+	"fmt"
+	"io"
+	"math/rand"
 	"runtime"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -31,11 +35,13 @@ import (
 	"github.com/yarpc/yab/transport"
 )
 
-// setGoMaxProcs sets runtime.GOMAXPROCS if the option is set
-// and returns the number of GOMAXPROCS configured.
-func (o BenchmarkOptions) setGoMaxProcs() int {
+// setGoMaxProcs sets runtime.GOMAXPROCS if the option is set, or to the
+// number of pinned CPUs, and returns the number of GOMAXPROCS configured.
+func (o BenchmarkOptions) setGoMaxProcs(pinnedCPUs int) int {
 	if o.NumCPUs > 0 {
 		runtime.GOMAXPROCS(o.NumCPUs)
+	} else if pinnedCPUs > 0 {
+		runtime.GOMAXPROCS(pinnedCPUs)
 	}
 	return runtime.GOMAXPROCS(-1)
 }
@@ -49,116 +55,779 @@ func (o BenchmarkOptions) getNumConnections(goMaxProcs int) int {
 	return goMaxProcs * 2
 }
 
+// maxRunBatch is the maximum number of requests a worker claims at once.
+const maxRunBatch = 100
+
+// minShardRPS is the minimum RPS for each shard when the rate limit is sharded.
+// Below this, a single limiter is shared so the rate remains accurate.
+const minShardRPS = 1000
+
+// minAchievedRPSRatio is the minimum ratio of the requested RPS that must be
+// achieved, below which the client is considered to be saturated.
+const minAchievedRPSRatio = 0.9
+
+// runToken tracks the number of requests left across all workers. To avoid
+// contention on the shared count, workers claim requests in batches.
 type runToken struct {
 	requestsLeft int64
-	limiter      ratelimit.Limiter
+	stopped      int32
+	batchSize    int64
+
+	// done is closed when the run is stopped.
+	done chan struct{}
+}
+
+func newRunToken(maxRequests, numWorkers int, maxDuration time.Duration) *runToken {
+	batchSize := int64(maxRequests / (numWorkers * 10))
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	if batchSize > maxRunBatch {
+		batchSize = maxRunBatch
+	}
+
+	t := &runToken{
+		requestsLeft: int64(maxRequests),
+		batchSize:    batchSize,
+		done:         make(chan struct{}),
+	}
+	time.AfterFunc(maxDuration, t.stop)
+
+	return t
+}
+
+// claim claims up to a batch of requests, and returns the number claimed.
+func (t *runToken) claim() int64 {
+	for {
+		left := atomic.LoadInt64(&t.requestsLeft)
+		if left <= 0 {
+			return 0
+		}
+
+		n := t.batchSize
+		if n > left {
+			n = left
+		}
+		if atomic.CompareAndSwapInt64(&t.requestsLeft, left, left-n) {
+			return n
+		}
+	}
+}
+
+func (t *runToken) stop() {
+	if atomic.CompareAndSwapInt32(&t.stopped, 0, 1) {
+		close(t.done)
+	}
+}
+
+// workerToken is used by a single worker to check whether it should make
+// more requests, so it does not need to be synchronized.
+type workerToken struct {
+	// sent is the number of requests sent, which is read by generatorLag.
+	sent int64
+
+	run      *runToken
+	limiter  ratelimit.Limiter
+	throttle *throttlePause
+	claimed  int64
 }
 
-func (t *runToken) More() bool {
+func (t *workerToken) More() bool {
 	t.limiter.Take()
-	return atomic.AddInt64(&t.requestsLeft, -1) >= 0
+	t.throttle.wait(t.run.done)
+	if atomic.LoadInt32(&t.run.stopped) != 0 {
+		return false
+	}
+
+	if t.claimed == 0 {
+		if t.claimed = t.run.claim(); t.claimed == 0 {
+			return false
+		}
+	}
+	t.claimed--
+	atomic.AddInt64(&t.sent, 1)
+	return true
 }
 
-func (t *runToken) Next() *runToken {
-	return t
+// validateSampler returns a function that returns true for the given fraction
+// of calls, using r, which must only be used by a single worker.
+func validateSampler(rate float64, r *rand.Rand) func() bool {
+	return func() bool {
+		return r.Float64() < rate
+	}
 }
 
-func newRunToken(maxRequests, rps int, maxDuration time.Duration) *runToken {
-	limiter := ratelimit.NewInfinite()
-	if rps > 0 {
-		limiter = ratelimit.New(rps)
+// newLimiters returns the rate limiters for numShards shards, which share the
+// total RPS. If the RPS is too low to shard, a single limiter is returned.
+func newLimiters(rps, numShards int) []ratelimit.Limiter {
+	if rps <= 0 {
+		return []ratelimit.Limiter{ratelimit.NewInfinite()}
 	}
 
-	t := &runToken{
-		requestsLeft: int64(maxRequests),
-		limiter:      limiter,
+	shards := shardRates(rps, numShards)
+	limiters := make([]ratelimit.Limiter, len(shards))
+	for i, shardRPS := range shards {
+		limiters[i] = ratelimit.New(shardRPS)
 	}
-	time.AfterFunc(maxDuration, func() {
-		atomic.StoreInt64(&t.requestsLeft, 0)
-	})
+	return limiters
+}
 
-	return t
+// newCalibratedLimiters is like newLimiters, but the limiters use the rate
+// from lag, which is lowered if the client cannot sustain the RPS.
+func newCalibratedLimiters(rps, numShards int, lag *generatorLag, done <-chan struct{}) []ratelimit.Limiter {
+	shards := shardRates(rps, numShards)
+	limiters := make([]ratelimit.Limiter, len(shards))
+	for i, shardRPS := range shards {
+		limiters[i] = ratelimit.NewVariable(lag.rate(shardRPS), done)
+	}
+	return limiters
+}
+
+// shardRates splits the RPS across at most numShards shards.
+func shardRates(rps, numShards int) []int {
+	if numShards > rps/minShardRPS {
+		numShards = rps / minShardRPS
+	}
+	if numShards < 1 {
+		numShards = 1
+	}
+
+	shards := make([]int, numShards)
+	for i := range shards {
+		shards[i] = rps / numShards
+		if i < rps%numShards {
+			shards[i]++
+		}
+	}
+	return shards
 }
 
-func runWorker(t transport.Transport, m benchmarkMethod, s *benchmarkState, run *runToken) {
-	for cur := run; cur.More(); cur = cur.Next() {
-		latency, err := m.call(t)
+func runWorker(t transport.Transport, m benchmarkMethod, s *benchmarkState, run *workerToken, shadow *shadowWorker, sampler *errorSampler, outliers *outlierRecorder) {
+	// retry is a throttled request to retry with the same idempotency key.
+	var retry *transport.Request
+	for run.More() {
+		req := retry
+		retry = nil
+		var err error
+		if req == nil {
+			req, err = m.request()
+		}
+		if err == errReplayStopped {
+			return
+		}
+
+		var latency, skew time.Duration
+		var res *transport.Response
+		var peer string
+		if err == nil {
+			shadow.start(m, req)
+			var clock clockReading
+			if m.clockAudit {
+				clock = readClock()
+			}
+			latency, peer, res, err = m.callRequest(t, req)
+			if m.clockAudit {
+				latency, skew = clock.since()
+			}
+		}
+		if retryAfter, ok := throttledRetryAfter(err); ok {
+			res.Release()
+			s.recordThrottled(err)
+			run.throttle.pause(retryAfter)
+			if m.idempotencyKey != "" {
+				retry = req
+			}
+			continue
+		}
 		if err != nil {
+			if req == nil {
+				// The request couldn't be created, so record the base request.
+				req = m.req
+			}
+			sampler.record(req, peer, res, latency, err)
+			res.Release()
 			s.recordError(err)
 			continue
 		}
 
 		s.recordLatency(latency)
+		s.recordPeerLatency(res.Peer, latency)
+		s.recordClockSkew(skew)
+		s.recordRedirects(len(res.Redirects))
+		if isReplayed(res) {
+			s.recordReplayed()
+		}
+		if m.serverTimingHeader != "" {
+			s.recordServerTiming(parseServerTiming(res.Headers, m.serverTimingHeader), latency)
+		}
+		outliers.record(req, res, latency)
+		res.Release()
+	}
+}
+
+// benchmarkParam is a parameter of the benchmark, which is printed before
+// the benchmark starts.
+type benchmarkParam struct {
+	name  string
+	value interface{}
+}
+
+// benchmarkTarget is a method to benchmark, which receives a share of the
+// benchmark's connections and requests based on its weight.
+type benchmarkTarget struct {
+	name       string
+	methodName string
+	weight     int
+	method     benchmarkMethod
+	tOpts      TransportOptions
+}
+
+// targetWorkers are the workers and their state for a single target.
+type targetWorkers struct {
+	target      benchmarkTarget
+	connections []transport.Transport
+	states      []*benchmarkState
+	shadows     []*shadowWorker
+	run         *runToken
+	limiters    []ratelimit.Limiter
+
+	// throttle is only set if workers honor the service's Retry-After.
+	throttle *throttlePause
+
+	// payloads are the rendered requests for templated requests.
+	payloads []*transport.Request
+
+	// replay returns the captured requests, if a capture is replayed.
+	replay *replaySchedule
+}
+
+// weightedShare returns the share of total for the given weight, which is at least 1.
+func weightedShare(total, weight, totalWeight int) int {
+	if share := total * weight / totalWeight; share > 0 {
+		return share
 	}
+	return 1
 }
 
 func runBenchmark(out output, allOpts Options, m benchmarkMethod) {
+	runBenchmarkTargets(out, allOpts, []benchmarkTarget{{
+		name:       allOpts.ROpts.MethodName,
+		methodName: allOpts.ROpts.MethodName,
+		weight:     1,
+		method:     m,
+		tOpts:      allOpts.TOpts,
+	}})
+}
+
+// runBenchmarkOnce benchmarks the targets concurrently, and returns the
+// merged state of all the targets, and how long the benchmark took.
+func runBenchmarkOnce(out output, allOpts Options, targets []benchmarkTarget) (*benchmarkState, time.Duration) {
 	opts := allOpts.BOpts
 
 	// By default, benchmarks are disabled. At least MaxDuration needs to
 	// be set to enable them.
 	if opts.MaxDuration == 0 {
-		return
+		return nil, 0
+	}
+
+	if opts.Concurrency < 1 {
+		out.Fatalf("--concurrency must be positive\n")
+	}
+
+	if opts.Burst > 0 {
+		if opts.RPS > 0 {
+			out.Fatalf("Cannot use --burst with --rps\n")
+		}
+		if opts.BurstInterval <= 0 {
+			out.Fatalf("--burst-interval must be positive\n")
+		}
+	}
+
+	var timeouts *timeoutDistribution
+	if opts.TimeoutDistribution != "" {
+		dist, err := parseTimeoutDistribution(opts.TimeoutDistribution)
+		if err != nil {
+			out.Fatalf("Failed to parse --timeout-distribution: %v\n", err)
+		}
+		timeouts = &dist
 	}
 
-	goMaxProcs := opts.setGoMaxProcs()
+	success, err := parseSuccessCriteria(opts.Success)
+	if err != nil {
+		out.Fatalf("Failed to parse --success: %v\n", err)
+	}
+
+	replayPace, err := parseReplayPace(opts.ReplayPace)
+	if err != nil {
+		out.Fatalf("Failed to parse --replay-pace: %v\n", err)
+	}
+	if replayPace > 0 {
+		if opts.ReplayFile == "" {
+			out.Fatalf("--replay-pace requires --replay\n")
+		}
+		if opts.RPS > 0 || opts.Burst > 0 || opts.LoadProfile != "" {
+			out.Fatalf("Cannot use --replay-pace with --rps, --burst or --load-profile\n")
+		}
+	}
+
+	var rpsProfile loadProfile
+	if opts.LoadProfile != "" {
+		if opts.RPS > 0 || opts.Burst > 0 {
+			out.Fatalf("Cannot use --load-profile with --rps or --burst\n")
+		}
+
+		var err error
+		if rpsProfile, err = parseLoadProfile(opts.LoadProfile); err != nil {
+			out.Fatalf("Failed to load the load profile: %v\n", err)
+		}
+	}
+
+	pinnedCPUs, err := opts.setScheduling()
+	if err != nil {
+		out.Fatalf("Failed to set up scheduling: %v\n", err)
+	}
+
+	goMaxProcs := opts.setGoMaxProcs(len(pinnedCPUs))
 	numConns := opts.getNumConnections(goMaxProcs)
+	params := []benchmarkParam{
+		{"CPUs", goMaxProcs},
+		{"Connections", numConns},
+		{"Concurrency", opts.Concurrency},
+		{"Max requests", opts.MaxRequests},
+		{"Max duration", opts.MaxDuration},
+		{"Max RPS", opts.RPS},
+		{"Seed", allOpts.Seed},
+	}
+	if opts.CPUAffinity != "" {
+		params = append(params, benchmarkParam{"CPU affinity", opts.CPUAffinity})
+	}
+	if opts.Nice != 0 {
+		params = append(params, benchmarkParam{"Nice", opts.Nice})
+	}
+	if opts.Burst > 0 {
+		params = append(params, benchmarkParam{"Burst", fmt.Sprintf("%v every %v", opts.Burst, opts.BurstInterval)})
+	}
+	if opts.LoadProfile != "" {
+		params = append(params, benchmarkParam{"Load profile", opts.LoadProfile})
+	}
+	if opts.AutoCalibrate && opts.RPS > 0 {
+		params = append(params, benchmarkParam{"Auto-calibrate", true})
+	}
+	if timeouts != nil {
+		params = append(params, benchmarkParam{"Timeouts", timeouts})
+	}
+	if opts.PayloadPool > 0 && len(targets) == 1 && targets[0].method.template != nil {
+		params = append(params, benchmarkParam{"Payload pool", opts.PayloadPool})
+	}
+	for _, c := range success {
+		params = append(params, benchmarkParam{"Success", c.expr})
+	}
+	if rate := opts.ValidateSampleRate.fraction(); rate < 1 {
+		params = append(params, benchmarkParam{"Validated", fmt.Sprintf("%v%% of responses", 100*rate)})
+	}
+	if opts.ShadowPeerList != "" {
+		params = append(params, benchmarkParam{"Shadow peers", opts.ShadowPeerList})
+	}
+	if opts.ReplayFile != "" {
+		params = append(params, benchmarkParam{"Replay", opts.ReplayFile})
+	}
+	if opts.ReplayPace != "" {
+		params = append(params, benchmarkParam{"Replay pace", opts.ReplayPace})
+	}
+	if key := allOpts.ROpts.IdempotencyKey; key != "" {
+		params = append(params, benchmarkParam{"Idempotency key", fmt.Sprintf("%v: %v", allOpts.ROpts.IdempotencyHeader, key)})
+	}
+	if jwt := allOpts.ROpts.jwt; jwt != nil {
+		params = append(params, benchmarkParam{"JWT", jwt.String()})
+	}
+	if opts.ServerPprof != "" {
+		params = append(params, benchmarkParam{"Server pprof", opts.ServerPprof})
+	}
+	for _, slo := range opts.SLO {
+		params = append(params, benchmarkParam{"SLO", slo})
+	}
+	if len(targets) > 1 {
+		params = append(params, benchmarkParam{"Targets", len(targets)})
+	}
 	out.Printf("Benchmark parameters:\n")
-	out.Printf("  CPUs:            %v\n", goMaxProcs)
-	out.Printf("  Connections:     %v\n", numConns)
-	out.Printf("  Concurrency:     %v\n", opts.Concurrency)
-	out.Printf("  Max requests:    %v\n", opts.MaxRequests)
-	out.Printf("  Max duration:    %v\n", opts.MaxDuration)
-	out.Printf("  Max RPS:         %v\n", opts.RPS)
-
-	// Warm up number of connections.
-	connections, err := m.WarmTransports(numConns, allOpts.TOpts)
+	for _, p := range params {
+		out.Printf("  %-17v%v\n", p.name+":", p.value)
+	}
+
+	totalWeight := 0
+	for _, target := range targets {
+		totalWeight += target.weight
+	}
+
+	// Workers are split into shards, one per CPU, which each have their own
+	// statsd client and rate limiter to avoid contention between CPUs.
+	// Each worker records stats to its own state, which are merged at the end.
+	numShards := goMaxProcs
+
+	// If the peers have metadata, track latencies per peer so they can be grouped.
+	peerGroups := getPeerGroups(allOpts.TOpts)
+
+	samples, err := newErrorSamples(opts.ErrorSamplesDir, opts.ErrorSamples)
 	if err != nil {
-		out.Fatalf("Failed to create connections: %v", err)
+		out.Fatalf("Failed to set up error samples: %v", err)
 	}
+	outliers := newOutliers(opts.OutlierThreshold)
 
-	statter, err := statsd.NewClient(opts.StatsdHostPort, allOpts.TOpts.ServiceName, allOpts.ROpts.MethodName)
+	var report *benchmarkReport
+	if opts.Report != "" {
+		report = &benchmarkReport{}
+	}
+
+	logger := newLogger(allOpts, out)
+	slos, err := newSLOMonitor(opts, logger)
+	if err != nil {
+		out.Fatalf("Failed to parse --slo: %v\n", err)
+	}
+	exporter, err := newResultsExporter(opts, logger, report, slos)
 	if err != nil {
-		out.Fatalf("Failed to create statsd client: %v", err)
+		out.Fatalf("Failed to set up results export: %v\n", err)
 	}
+	lag := newGeneratorLag(opts.RPS, opts.AutoCalibrate, logger)
 
-	var wg sync.WaitGroup
-	states := make([]*benchmarkState, len(connections)*opts.Concurrency)
-	for i := range states {
-		states[i] = newBenchmarkState(statter)
+	// Each target gets a share of the connections, requests and RPS based on its weight.
+	bufferPool := transport.NewBufferPool()
+	connEvents := &connectionEvents{}
+	handshakes := &tlsHandshakes{}
+	allWorkers := make([]*targetWorkers, len(targets))
+	for i, target := range targets {
+		tOpts := target.tOpts
+		tOpts.maxBufferedBytes = opts.ResponseBuffer
+		if len(success) > 0 {
+			// Success criteria decode the whole response.
+			tOpts.maxBufferedBytes = 0
+		}
+		tOpts.bufferPool = bufferPool
+
+		// Warm up using a captured request, as the replay may be the only request.
+		var replayEntries []replayEntry
+		if opts.ReplayFile != "" {
+			replayEntries, err = loadReplay(opts.ReplayFile, target.method.serializer, target.method.req)
+			if err != nil {
+				out.Fatalf("Failed to load the replay capture: %v\n", err)
+			}
+			target.method.req = replayEntries[0].req
+		}
+		tOpts.connectionEvent = connEvents.record
+		tOpts.tlsHandshake = handshakes.record
+		if opts.OutlierThreshold > 0 {
+			tOpts.traceSampleRate = opts.OutlierTraceRate
+		}
+
+		// Warm up number of connections.
+		connections, err := target.method.WarmTransports(weightedShare(numConns, target.weight, totalWeight), tOpts)
+		if err != nil {
+			out.Fatalf("Failed to create connections: %v", err)
+		}
+
+		var shadowConnections []transport.Transport
+		if opts.ShadowPeerList != "" {
+			shadowConnections, err = target.method.WarmTransports(len(connections), shadowTransportOptions(tOpts, opts.ShadowPeerList))
+			if err != nil {
+				out.Fatalf("Failed to create shadow connections: %v", err)
+			}
+		}
+
+		statters := make([]statsd.Client, numShards)
+		for j := range statters {
+			statters[j], err = statsd.NewClient(opts.StatsdHostPort, tOpts.ServiceName, target.methodName)
+			if err != nil {
+				out.Fatalf("Failed to create statsd client: %v", err)
+			}
+			statters[j] = exporter.statter(target.name, statters[j])
+		}
+
+		states := make([]*benchmarkState, len(connections)*opts.Concurrency)
+		for j := range states {
+			states[j] = newBenchmarkState(statters[j%numShards])
+			if peerGroups != nil || report != nil {
+				states[j].trackPeers()
+			}
+		}
+
+		// Shadow calls are not reported to statsd, as the metrics are for the primary.
+		shadows := make([]*shadowWorker, len(states))
+		if shadowConnections != nil {
+			for j := range shadows {
+				shadows[j] = newShadowWorker(shadowConnections[j/opts.Concurrency], opts.ShadowConcurrency)
+			}
+		}
+
+		rps := opts.RPS
+		if rps > 0 {
+			rps = weightedShare(opts.RPS, target.weight, totalWeight)
+		}
+
+		run := newRunToken(weightedShare(opts.MaxRequests, target.weight, totalWeight), len(states), opts.MaxDuration)
+		limiters := newLimiters(rps, numShards)
+		if lag != nil && opts.AutoCalibrate {
+			limiters = newCalibratedLimiters(rps, numShards, lag, run.done)
+		}
+		if opts.Burst > 0 {
+			// Bursts use a single limiter, so each burst is the requested size.
+			burst := weightedShare(opts.Burst, target.weight, totalWeight)
+			limiters = []ratelimit.Limiter{ratelimit.NewBurst(burst, opts.BurstInterval, run.done)}
+		}
+		if rpsProfile != nil {
+			limiters = []ratelimit.Limiter{ratelimit.NewVariable(rpsProfile.scaled(target.weight, totalWeight), run.done)}
+		}
+
+		allWorkers[i] = &targetWorkers{
+			target:      target,
+			connections: connections,
+			states:      states,
+			shadows:     shadows,
+			run:         run,
+			limiters:    limiters,
+		}
+		if opts.HonorRetryAfter {
+			allWorkers[i].throttle = newThrottlePause(opts.MaxRetryAfter)
+		}
+		if replayEntries != nil {
+			allWorkers[i].replay, err = newReplaySchedule(replayEntries, replayPace, run.done)
+			if err != nil {
+				out.Fatalf("Failed to replay the capture: %v\n", err)
+			}
+		} else if target.method.template != nil && opts.PayloadPool > 0 {
+			allWorkers[i].payloads, err = target.method.template.pool(opts.PayloadPool)
+			if err != nil {
+				out.Fatalf("Failed to render the payload pool: %v\n", err)
+			}
+		}
+	}
+
+	profile, err := startGeneratorProfile(opts.ProfileCPU, opts.ProfileMem, goMaxProcs)
+	if err != nil {
+		out.Fatalf("Failed to start profiling: %v", err)
+	}
+
+	serverProfile, err := newServerProfiler(opts.ServerPprof, opts.ServerPprofDir)
+	if err != nil {
+		out.Fatalf("Failed to parse --server-pprof: %v\n", err)
+	}
+	if err := serverProfile.start(opts.MaxDuration); err != nil {
+		out.Fatalf("Failed to profile the server: %v\n", err)
 	}
 
-	rt := newRunToken(opts.MaxRequests, opts.RPS, opts.MaxDuration)
+	if slos != nil && opts.AbortOnBreach {
+		slos.abort = func() {
+			for _, w := range allWorkers {
+				w.run.stop()
+			}
+		}
+	}
 
+	var clockWatcher *clockWatcher
+	if opts.ClockAudit {
+		clockWatcher = newClockWatcher(clockWatchInterval)
+		clockWatcher.start()
+	}
+
+	var wg sync.WaitGroup
 	start := time.Now()
-	for i, c := range connections {
-		for j := 0; j < opts.Concurrency; j++ {
-			state := states[i*opts.Concurrency+j]
+	exporter.start()
+	for _, w := range allWorkers {
+		if w.replay != nil {
+			w.replay.start = start
+		}
+	}
+
+	// Each worker has its own source of randomness, derived from the seed.
+	workerSeed := allOpts.Seed
+	for _, w := range allWorkers {
+		sampler := samples.forTarget(w.target.name)
+		outlierRecorder := outliers.forTarget(w.target.name)
+		for i, c := range w.connections {
+			for j := 0; j < opts.Concurrency; j++ {
+				worker := i*opts.Concurrency + j
+				state := w.states[worker]
+				shadow := w.shadows[worker]
+				run := &workerToken{run: w.run, limiter: w.limiters[worker%len(w.limiters)], throttle: w.throttle}
+				lag.track(run)
+				m := w.target.method
+				m.success = success
+				m.idempotencyKey = allOpts.ROpts.IdempotencyKey
+				m.idempotencyHeader = allOpts.ROpts.IdempotencyHeader
+				m.jwt = allOpts.ROpts.jwt
+				m.serverTimingHeader = opts.ServerTimingHeader
+				m.clockAudit = opts.ClockAudit
+				if w.replay != nil {
+					m.nextRequest = w.replay.next
+				} else if w.payloads != nil {
+					// Workers start at different offsets, so they send different requests.
+					m.nextRequest = cycleRequests(w.payloads, worker*len(w.payloads)/len(w.states))
+				} else if m.template != nil {
+					m.nextRequest = m.template.forWorker(worker).next
+				}
+				r := rand.New(rand.NewSource(workerSeed))
+				workerSeed++
+				if timeouts != nil {
+					m.timeout = timeouts.sampler(r)
+				}
+				if rate := opts.ValidateSampleRate.fraction(); rate < 1 {
+					m.validate = validateSampler(rate, r)
+				}
 
-			wg.Add(1)
-			go func(c transport.Transport) {
-				defer wg.Done()
-				runWorker(c, m, state, rt)
-			}(c)
+				wg.Add(1)
+				go func(c transport.Transport, m benchmarkMethod) {
+					defer wg.Done()
+					runWorker(c, m, state, run, shadow, sampler, outlierRecorder)
+				}(c, m)
+			}
 		}
 	}
 
-	// TODO: Support streaming updates.
+	// Once every worker is tracked, watch whether they keep up with the RPS.
+	lag.start()
 
 	// Wait for all the worker goroutines to end.
 	wg.Wait()
 	total := time.Since(start)
+	calibratedRPS := lag.stop()
+	for _, w := range allWorkers {
+		for _, s := range w.shadows {
+			s.wait()
+		}
+	}
+	for _, w := range allWorkers {
+		closeTransports(w.connections)
+	}
+	var clockAdjustments []clockAdjustment
+	if clockWatcher != nil {
+		clockAdjustments = clockWatcher.stop()
+	}
+
+	genStats, err := profile.stop()
+	if err != nil {
+		out.Fatalf("Failed to stop profiling: %v", err)
+	}
+	serverProfile.stop(logger)
 
-	// Merge all the states into 0
-	overall := states[0]
-	for _, s := range states[1:] {
-		overall.merge(s)
+	// Merge all the states for each target, and across all targets.
+	overall := newBenchmarkState(statsd.Noop)
+	targetStates := make([]*benchmarkState, len(allWorkers))
+	var shadows []*shadowWorker
+	var throttles []*throttlePause
+	for i, w := range allWorkers {
+		throttles = append(throttles, w.throttle)
+		targetStates[i] = newBenchmarkState(statsd.Noop)
+		for _, s := range w.states {
+			targetStates[i].merge(s)
+		}
+		overall.merge(targetStates[i])
+
+		if len(w.shadows) > 0 && w.shadows[0] != nil {
+			shadows = append(shadows, w.shadows...)
+		}
 	}
 
+	exporter.finish(targets, targetStates, overall, total)
+
+	slos.print(out)
 	overall.printErrors(out)
+	overall.printThrottled(out)
+	printThrottlePauses(out, throttles)
+	overall.printRedirects(out)
+	overall.printReplayed(out)
+	samples.print(logger)
+	connEvents.print(out)
+	handshakes.print(out)
+	if opts.ClockAudit {
+		overall.printClockAudit(out, clockAdjustments)
+	}
 	overall.printLatencies(out)
+	overall.printServerTiming(out)
+	if slow := allOpts.ROpts.SlowWarn; slow > 0 {
+		overall.printSlow(out, slow)
+	}
+	outliers.write(opts.OutliersFile, logger)
+	if peerGroups != nil {
+		peerGroups.print(out, overall.peerLatencies)
+	}
 
 	out.Printf("Elapsed time:      %v\n", (total / time.Millisecond * time.Millisecond))
 	out.Printf("Total requests:    %v\n", len(overall.latencies))
-	out.Printf("RPS:               %.2f\n", float64(len(overall.latencies))/total.Seconds())
+	rps := float64(len(overall.latencies)) / total.Seconds()
+	out.Printf("RPS:               %.2f\n", rps)
+	if opts.AutoCalibrate && calibratedRPS > 0 {
+		out.Printf("Calibrated RPS:    %.2f\n", calibratedRPS)
+	}
+	genStats.print(out, logger)
+	if !opts.AutoCalibrate {
+		warnSaturated(logger, opts.RPS, rps)
+	}
+
+	if len(targets) > 1 {
+		printTargetResults(out, targets, targetStates, total)
+	}
+
+	if shadows != nil {
+		printShadowResults(out, shadows, total)
+	}
+
+	if allOpts.junit != nil {
+		allOpts.junit.addSuite("yab benchmark", start, total, benchmarkJUnitCases(targets, targetStates, success, slos, total))
+	}
+
+	if report != nil {
+		report.writeFile(opts.Report, logger, reportResults{
+			service: allOpts.TOpts.ServiceName,
+			params:  params,
+			targets: targets,
+			states:  targetStates,
+			overall: overall,
+			total:   total,
+			groups:  peerGroups,
+		})
+	}
+
+	if opts.SummaryMarkdown || opts.SummarySave != "" {
+		printSummaries(out, logger, opts, benchmarkSummaries(targets, targetStates, overall, total))
+	}
+	return overall, total
+}
+
+// printTargetResults prints a summary of the results for each target.
+func printTargetResults(out output, targets []benchmarkTarget, states []*benchmarkState, total time.Duration) {
+	out.Printf("\nTarget results:\n")
+	for i, target := range targets {
+		s := states[i]
+		sort.Sort(byDuration(s.latencies))
+
+		numErrors := 0
+		for _, n := range s.errors {
+			numErrors += n
+		}
+
+		out.Printf("  %v (weight %v): %v requests, %v errors, %.2f RPS, p50: %v, p90: %v, p99: %v\n",
+			target.name, target.weight, len(s.latencies), numErrors, float64(len(s.latencies))/total.Seconds(),
+			s.getQuantile(0.5), s.getQuantile(0.9), s.getQuantile(0.99))
+	}
+}
+
+// closeTransports closes any transports that hold connections, so that
+// connections still open at the end of the benchmark are reported as closed
+// at shutdown.
+func closeTransports(transports []transport.Transport) {
+	for _, t := range transports {
+		if c, ok := t.(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
+
+// warnSaturated warns if the requested RPS was not achieved, since latencies
+// are misleading when the client cannot send requests at the requested rate.
+func warnSaturated(logger *logger, requestedRPS int, achievedRPS float64) {
+	if requestedRPS <= 0 || achievedRPS >= minAchievedRPSRatio*float64(requestedRPS) {
+		return
+	}
+
+	logger.Warnf("only achieved %.2f RPS of the requested %v RPS. The client could not sustain the "+
+		"requested rate, so latencies may be misleading. Try increasing --connections or --concurrency, "+
+		"or lowering --rps.", achievedRPS, requestedRPS)
 }
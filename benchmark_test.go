@@ -21,11 +21,25 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/yarpc/yab/ratelimit"
+	"github.com/yarpc/yab/statsd"
+	"github.com/yarpc/yab/transport"
+
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel-go/raw"
+	"golang.org/x/net/context"
 )
 
 func TestBenchmark(t *testing.T) {
@@ -48,13 +62,333 @@ func TestBenchmark(t *testing.T) {
 			Concurrency: 2,
 		},
 		TOpts: s.transportOpts(),
+		Seed:  7,
 	}, m)
 
 	bufStr := buf.String()
 	assert.Contains(t, bufStr, "Max RPS")
+	assert.Contains(t, bufStr, "Seed:            7\n", "The seed should be printed to reproduce the run")
 	assert.NotContains(t, bufStr, "Errors")
 
 	// Due to warm up, we make:
 	// 10 * Connections extra requests
 	assert.EqualValues(t, 1000+10*50, requests, "Invalid number of requests")
 }
+
+func TestBenchmarkShadow(t *testing.T) {
+	var primaryRequests, shadowRequests int32
+	primary := newServer(t)
+	defer primary.shutdown()
+	primary.register(fooMethod, methods.errorIf(func() bool {
+		atomic.AddInt32(&primaryRequests, 1)
+		return false
+	}))
+
+	// The shadow returns an invalid response, which should not be validated.
+	shadow := newServer(t)
+	defer shadow.shutdown()
+	shadow.register(fooMethod, func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		atomic.AddInt32(&shadowRequests, 1)
+		return &raw.Res{Arg3: []byte{1, 1}}, nil
+	})
+	shadowPeers := writeFile(t, "shadow", `["`+shadow.hostPort()+`"]`)
+	defer os.Remove(shadowPeers)
+
+	m := benchmarkMethodForTest(t, fooMethod)
+	buf, out := getOutput(t)
+
+	runBenchmark(out, Options{
+		BOpts: BenchmarkOptions{
+			MaxRequests:    100,
+			MaxDuration:    time.Second,
+			Connections:    5,
+			Concurrency:    2,
+			ShadowPeerList: shadowPeers,
+		},
+		TOpts: primary.transportOpts(),
+	}, m)
+
+	bufStr := buf.String()
+	assert.Contains(t, bufStr, "Shadow results")
+	assert.NotContains(t, bufStr, "Errors")
+
+	// Both sides receive the same number of requests, including warm up.
+	assert.EqualValues(t, 100+10*5, primaryRequests, "Invalid number of primary requests")
+	assert.EqualValues(t, 100+10*5, shadowRequests, "Invalid number of shadow requests")
+}
+
+func TestBenchmarkSlowShadow(t *testing.T) {
+	var primaryRequests, shadowRequests int32
+	primary := newServer(t)
+	defer primary.shutdown()
+	primary.register(fooMethod, methods.errorIf(func() bool {
+		atomic.AddInt32(&primaryRequests, 1)
+		return false
+	}))
+
+	// The shadow is slow after the warm up requests.
+	shadow := newServer(t)
+	defer shadow.shutdown()
+	shadow.register(fooMethod, func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		if atomic.AddInt32(&shadowRequests, 1) > 10 {
+			time.Sleep(100 * time.Millisecond)
+		}
+		return &raw.Res{}, nil
+	})
+	shadowPeers := writeFile(t, "shadow", `["`+shadow.hostPort()+`"]`)
+	defer os.Remove(shadowPeers)
+
+	m := benchmarkMethodForTest(t, fooMethod)
+	buf, out := getOutput(t)
+
+	runBenchmark(out, Options{
+		BOpts: BenchmarkOptions{
+			MaxRequests:       20,
+			MaxDuration:       5 * time.Second,
+			Connections:       1,
+			Concurrency:       1,
+			ShadowPeerList:    shadowPeers,
+			ShadowConcurrency: 1,
+		},
+		TOpts: primary.transportOpts(),
+	}, m)
+
+	// The primary isn't throttled by the shadow, so mirrored requests are dropped.
+	assert.EqualValues(t, 20+10, atomic.LoadInt32(&primaryRequests), "Invalid number of primary requests")
+	assert.True(t, atomic.LoadInt32(&shadowRequests) < 20+10, "Slow shadow should not receive every request")
+	assert.Contains(t, buf.String(), "Dropped requests:", "Dropped shadow requests should be reported")
+}
+
+func TestBenchmarkBurst(t *testing.T) {
+	tests := []struct {
+		msg          string
+		burst        int
+		interval     time.Duration
+		duration     time.Duration
+		wantRequests int32
+	}{
+		{
+			msg:          "multiple bursts",
+			burst:        20,
+			interval:     300 * time.Millisecond,
+			duration:     750 * time.Millisecond,
+			wantRequests: 60,
+		},
+		{
+			msg:          "stops during the interval",
+			burst:        5,
+			interval:     time.Hour,
+			duration:     200 * time.Millisecond,
+			wantRequests: 5,
+		},
+	}
+
+	for _, tt := range tests {
+		var requests int32
+		s := newServer(t)
+		s.register(fooMethod, methods.errorIf(func() bool {
+			atomic.AddInt32(&requests, 1)
+			return false
+		}))
+
+		m := benchmarkMethodForTest(t, fooMethod)
+		buf, out := getOutput(t)
+
+		start := time.Now()
+		runBenchmark(out, Options{
+			BOpts: BenchmarkOptions{
+				MaxRequests:   10000,
+				MaxDuration:   tt.duration,
+				Connections:   2,
+				Concurrency:   2,
+				Burst:         tt.burst,
+				BurstInterval: tt.interval,
+			},
+			TOpts: s.transportOpts(),
+		}, m)
+		assert.True(t, time.Since(start) < tt.duration+time.Second, "%v: benchmark did not stop after the duration", tt.msg)
+		assert.Contains(t, buf.String(), "Burst:", "%v: expected burst parameters", tt.msg)
+
+		// Due to warm up, we make 10 * Connections extra requests.
+		assert.EqualValues(t, tt.wantRequests+10*2, atomic.LoadInt32(&requests), "%v: unexpected number of requests", tt.msg)
+		s.shutdown()
+	}
+}
+
+func TestBenchmarkBurstWithRPS(t *testing.T) {
+	m := benchmarkMethodForTest(t, fooMethod)
+	var fatal string
+	out := testOutput{
+		Buffer: &bytes.Buffer{},
+		fatalf: func(format string, args ...interface{}) {
+			fatal = format
+		},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runBenchmark(out, Options{
+			BOpts: BenchmarkOptions{
+				MaxDuration:   time.Second,
+				Concurrency:   1,
+				RPS:           100,
+				Burst:         10,
+				BurstInterval: time.Second,
+			},
+		}, m)
+	}()
+	<-done
+
+	assert.Equal(t, "Cannot use --burst with --rps\n", fatal)
+}
+
+func TestBenchmarkInvalidConcurrency(t *testing.T) {
+	m := benchmarkMethodForTest(t, fooMethod)
+	var fatal string
+	out := testOutput{
+		Buffer: &bytes.Buffer{},
+		fatalf: func(format string, args ...interface{}) {
+			fatal = format
+		},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runBenchmark(out, Options{
+			BOpts: BenchmarkOptions{
+				MaxDuration: time.Second,
+				Concurrency: 0,
+			},
+		}, m)
+	}()
+	<-done
+
+	assert.Equal(t, "--concurrency must be positive\n", fatal)
+}
+
+func TestRunTokenBatches(t *testing.T) {
+	tests := []struct {
+		maxRequests int
+		numWorkers  int
+	}{
+		{maxRequests: 1, numWorkers: 10},
+		{maxRequests: 100, numWorkers: 3},
+		{maxRequests: 10000, numWorkers: 8},
+		{maxRequests: 1000000, numWorkers: 4},
+	}
+
+	for _, tt := range tests {
+		rt := newRunToken(tt.maxRequests, tt.numWorkers, time.Hour)
+		assert.True(t, rt.batchSize >= 1 && rt.batchSize <= maxRunBatch, "Unexpected batch size %v", rt.batchSize)
+
+		var total int64
+		var wg sync.WaitGroup
+		for i := 0; i < tt.numWorkers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				run := &workerToken{run: rt, limiter: ratelimit.NewInfinite()}
+				for run.More() {
+					atomic.AddInt64(&total, 1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.EqualValues(t, tt.maxRequests, total, "Workers should make exactly maxRequests requests")
+	}
+}
+
+func TestRunTokenStop(t *testing.T) {
+	rt := newRunToken(1000, 1, time.Hour)
+	run := &workerToken{run: rt, limiter: ratelimit.NewInfinite()}
+	assert.True(t, run.More(), "Expected more requests before stopping")
+
+	rt.stop()
+	assert.False(t, run.More(), "Expected no more requests after stopping, even with claimed requests")
+}
+
+func TestNewLimiters(t *testing.T) {
+	tests := []struct {
+		rps       int
+		numShards int
+		want      int
+	}{
+		{rps: 0, numShards: 8, want: 1},
+		{rps: 100, numShards: 8, want: 1},
+		{rps: 2500, numShards: 8, want: 2},
+		{rps: 100000, numShards: 8, want: 8},
+	}
+
+	for _, tt := range tests {
+		got := newLimiters(tt.rps, tt.numShards)
+		assert.Len(t, got, tt.want, "newLimiters(%v, %v) shards mismatch", tt.rps, tt.numShards)
+	}
+}
+
+func TestWarnSaturated(t *testing.T) {
+	tests := []struct {
+		requested int
+		achieved  float64
+		wantWarn  bool
+	}{
+		{requested: 0, achieved: 10},
+		{requested: 100, achieved: 99.5},
+		{requested: 100, achieved: 90},
+		{requested: 100, achieved: 50, wantWarn: true},
+	}
+
+	for _, tt := range tests {
+		buf, out := getOutput(t)
+		warnSaturated(newLogger(Options{}, out), tt.requested, tt.achieved)
+		if tt.wantWarn {
+			assert.Contains(t, buf.String(), "Warning: only achieved", "Expected warning for %v of %v RPS", tt.achieved, tt.requested)
+		} else {
+			assert.Empty(t, buf.String(), "Unexpected warning for %v of %v RPS", tt.achieved, tt.requested)
+		}
+	}
+}
+
+// runWorkerForTest runs a worker for a single request.
+func runWorkerForTest(t transport.Transport, m benchmarkMethod, sampler *errorSampler, outliers *outlierRecorder) {
+	run := &workerToken{run: newRunToken(1, 1, time.Second), limiter: newLimiters(0, 1)[0]}
+	runWorker(t, m, newBenchmarkState(statsd.Noop), run, nil, sampler, outliers)
+}
+
+func TestRunWorkerRecordsSentRequest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yab-errors")
+	require.NoError(t, err, "TempDir failed")
+	defer os.RemoveAll(dir)
+
+	// The rendered request that is sent differs from the base request.
+	m := benchmarkMethodForTest(t, fooMethod)
+	sent := &transport.Request{
+		Method:  fooMethod,
+		Timeout: time.Second,
+		Headers: map[string]string{"rendered": "true"},
+		Body:    []byte("rendered"),
+	}
+	m.nextRequest = func() (*transport.Request, error) { return sent, nil }
+	m.validate = func() bool { return false }
+
+	samples, err := newErrorSamples(dir, 1)
+	require.NoError(t, err, "newErrorSamples failed")
+	runWorkerForTest(fakeTransport{err: errors.New("failed")}, m, samples.forTarget("target"), nil)
+
+	details, err := ioutil.ReadFile(filepath.Join(samples.dir, "0001", "sample.json"))
+	require.NoError(t, err, "failed to read sample.json")
+	var sample errorSample
+	require.NoError(t, json.Unmarshal(details, &sample), "failed to parse sample.json")
+	assert.Equal(t, sent.Headers, sample.RequestHeaders, "error sample should have the sent headers")
+	body, err := ioutil.ReadFile(filepath.Join(samples.dir, "0001", "request.bin"))
+	require.NoError(t, err, "failed to read request.bin")
+	assert.Equal(t, sent.Body, body, "error sample should have the sent body")
+
+	outliers := newOutliers(time.Nanosecond)
+	runWorkerForTest(fakeTransport{res: &transport.Response{Peer: "peer"}}, m, nil, outliers.forTarget("target"))
+	report := outliers.report()
+	require.Len(t, report.Outliers, 1, "expected an outlier")
+	assert.Equal(t, sent.Headers, report.Outliers[0].RequestHeaders, "outlier should have the sent headers")
+}
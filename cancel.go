@@ -0,0 +1,89 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/uber/tchannel-go"
+	"github.com/yarpc/yab/encoding"
+	"github.com/yarpc/yab/transport"
+)
+
+// runCancel makes the request and cancels it after opts.CancelAfter, so
+// teams can check how cancellation is propagated. It reports whether the
+// response arrived before the request was cancelled, or how long after
+// the cancellation the call returned and with which error.
+func runCancel(out output, opts RequestOptions, t transport.Transport, serializer encoding.Serializer, req *transport.Request) {
+	if opts.CancelAfter >= req.Timeout {
+		out.Fatalf("Failed while parsing options: --cancel-after %v must be shorter than the timeout %v\n", opts.CancelAfter, req.Timeout)
+	}
+
+	ctx, cancel := tchannel.NewContext(req.Timeout)
+	defer cancel()
+
+	cancelled := make(chan time.Time, 1)
+	timer := time.AfterFunc(opts.CancelAfter, func() {
+		cancelled <- time.Now()
+		cancel()
+	})
+
+	start := time.Now()
+	response, err := t.Call(ctx, req)
+	returned := time.Now()
+
+	if timer.Stop() {
+		if err != nil {
+			out.Fatalf("Failed while making call before the request was cancelled: %v\n", err)
+		}
+		out.Printf("Response received after %v, before the request was cancelled after %v:\n", roundMicros(returned.Sub(start)), opts.CancelAfter)
+		printCancelResponse(out, serializer, response)
+		return
+	}
+
+	delay := roundMicros(returned.Sub(<-cancelled))
+	if err == nil {
+		out.Printf("Response received %v after the request was cancelled after %v:\n", delay, opts.CancelAfter)
+		printCancelResponse(out, serializer, response)
+		return
+	}
+
+	out.Printf("Request cancelled after %v, and the call returned %v later with: %v\n", opts.CancelAfter, delay, err)
+}
+
+func printCancelResponse(out output, serializer encoding.Serializer, response *transport.Response) {
+	outSerialized, err := responseToOutput(serializer, response)
+	if err != nil {
+		out.Fatalf("Failed while parsing response: %v\n", err)
+	}
+	bs, err := json.MarshalIndent(outSerialized, "", "  ")
+	if err != nil {
+		out.Fatalf("Failed to convert map to JSON: %v\nMap: %+v\n", err, outSerialized["body"])
+	}
+	out.Printf("%s\n", bs)
+}
+
+// roundMicros truncates d to microseconds, which is enough precision to
+// show how quickly a call returned after it was cancelled.
+func roundMicros(d time.Duration) time.Duration {
+	return d / time.Microsecond * time.Microsecond
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/yarpc/yab/encoding"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel-go/raw"
+	"golang.org/x/net/context"
+)
+
+func TestRunCancel(t *testing.T) {
+	s := newServer(t)
+	defer s.shutdown()
+	s.register(fooMethod, func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		if string(args.Arg3) == "slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		return &raw.Res{Arg2: args.Arg2, Arg3: args.Arg3}, nil
+	})
+
+	tests := []struct {
+		msg     string
+		body    string
+		want    string
+		wantErr string
+	}{
+		{
+			msg:  "cancelled",
+			body: "slow",
+			want: "Request cancelled after 20ms, and the call returned ",
+		},
+		{
+			msg:  "response before cancel",
+			body: "fast",
+			want: "before the request was cancelled after 20ms:\n",
+		},
+	}
+
+	for _, tt := range tests {
+		serializer := encoding.NewRaw(fooMethod)
+		req, err := serializer.Request([]byte(tt.body))
+		require.NoError(t, err, "%v: failed to create request", tt.msg)
+		req.Timeout = time.Second
+
+		transport, err := getTransport(s.transportOpts(), encoding.Raw)
+		require.NoError(t, err, "%v: failed to get transport", tt.msg)
+
+		buf, out := getOutput(t)
+		runCancel(out, RequestOptions{CancelAfter: 20 * time.Millisecond}, transport, serializer, req)
+		assert.Contains(t, buf.String(), tt.want, "%v: unexpected output", tt.msg)
+	}
+}
+
+func TestRunCancelAfterTimeout(t *testing.T) {
+	s := newServer(t)
+	defer s.shutdown()
+
+	serializer := encoding.NewRaw(fooMethod)
+	req, err := serializer.Request(nil)
+	require.NoError(t, err, "failed to create request")
+	req.Timeout = 10 * time.Millisecond
+
+	transport, err := getTransport(s.transportOpts(), encoding.Raw)
+	require.NoError(t, err, "failed to get transport")
+
+	var fatal string
+	out := testOutput{
+		Buffer: &bytes.Buffer{},
+		fatalf: func(format string, args ...interface{}) {
+			fatal = fmt.Sprintf(format, args...)
+		},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runCancel(out, RequestOptions{CancelAfter: time.Second}, transport, serializer, req)
+	}()
+	<-done
+
+	assert.Contains(t, fatal, "--cancel-after 1s must be shorter than the timeout 10ms", "unexpected error")
+}
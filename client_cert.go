@@ -0,0 +1,112 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+var errClientCertKey = errors.New("--cert and --key must be used together")
+
+// clientCert is the client certificate presented to HTTPS peers. It's
+// reloaded when the certificate or key file changes, so certificates can
+// be rotated during a benchmark without stopping it.
+type clientCert struct {
+	certFile string
+	keyFile  string
+	logger   *logger
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	loadedMod time.Time
+	failedMod time.Time
+}
+
+func newClientCert(certFile, keyFile string, logger *logger) (*clientCert, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errClientCertKey
+	}
+
+	c := &clientCert{
+		certFile: certFile,
+		keyFile:  keyFile,
+		logger:   logger,
+	}
+
+	mod, err := c.modTime()
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	c.cert = &cert
+	c.loadedMod = mod
+	return c, nil
+}
+
+// get returns the current certificate, reloading it first if the
+// certificate or key file changed. It's called for each new connection.
+// If the files can't be loaded, e.g. as only one of them has been replaced
+// so far, the previous certificate is used until they change again.
+func (c *clientCert) get() (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	mod, err := c.modTime()
+	if err != nil || mod.Equal(c.loadedMod) {
+		return c.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		if !mod.Equal(c.failedMod) {
+			c.failedMod = mod
+			c.logger.Warnf("failed to reload the client certificate, still using the previous certificate: %v", err)
+		}
+		return c.cert, nil
+	}
+
+	c.cert = &cert
+	c.loadedMod = mod
+	c.logger.Infof("rotated the client certificate from %v", c.certFile)
+	return c.cert, nil
+}
+
+// modTime returns the latest modification time of the certificate and key.
+func (c *clientCert) modTime() (time.Time, error) {
+	var latest time.Time
+	for _, f := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCertPEM returns a self-signed PEM certificate and key for name.
+func newTestCertPEM(t *testing.T, name string) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "GenerateKey failed")
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err, "CreateCertificate failed")
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err, "MarshalECPrivateKey failed")
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func commonName(t *testing.T, c *clientCert) string {
+	cert, err := c.get()
+	require.NoError(t, err, "get failed")
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err, "ParseCertificate failed")
+	return parsed.Subject.CommonName
+}
+
+func TestNewClientCert(t *testing.T) {
+	certPEM, keyPEM := newTestCertPEM(t, "client")
+	certFile := writeFile(t, "cert", string(certPEM))
+	defer os.Remove(certFile)
+	keyFile := writeFile(t, "key", string(keyPEM))
+	defer os.Remove(keyFile)
+
+	tests := []struct {
+		msg      string
+		certFile string
+		keyFile  string
+		wantErr  string
+	}{
+		{
+			msg:      "valid",
+			certFile: certFile,
+			keyFile:  keyFile,
+		},
+		{
+			msg:      "missing key",
+			certFile: certFile,
+			wantErr:  errClientCertKey.Error(),
+		},
+		{
+			msg:     "missing cert",
+			keyFile: keyFile,
+			wantErr: errClientCertKey.Error(),
+		},
+		{
+			msg:      "file not found",
+			certFile: "/fake/cert.pem",
+			keyFile:  keyFile,
+			wantErr:  "no such file",
+		},
+		{
+			msg:      "key is not a certificate",
+			certFile: keyFile,
+			keyFile:  keyFile,
+			wantErr:  "certificate",
+		},
+	}
+
+	for _, tt := range tests {
+		_, out := getOutput(t)
+		c, err := newClientCert(tt.certFile, tt.keyFile, newLogger(Options{}, out))
+		if tt.wantErr != "" {
+			if assert.Error(t, err, "%v: expected error", tt.msg) {
+				assert.Contains(t, err.Error(), tt.wantErr, "%v: unexpected error", tt.msg)
+			}
+			continue
+		}
+
+		require.NoError(t, err, "%v: newClientCert failed", tt.msg)
+		assert.Equal(t, "client", commonName(t, c), "%v: unexpected certificate", tt.msg)
+	}
+}
+
+func TestClientCertRotation(t *testing.T) {
+	certPEM, keyPEM := newTestCertPEM(t, "old")
+	certFile := writeFile(t, "cert", string(certPEM))
+	defer os.Remove(certFile)
+	keyFile := writeFile(t, "key", string(keyPEM))
+	defer os.Remove(keyFile)
+
+	buf, out := getOutput(t)
+	c, err := newClientCert(certFile, keyFile, newLogger(Options{}, out))
+	require.NoError(t, err, "newClientCert failed")
+	assert.Equal(t, "old", commonName(t, c), "unexpected initial certificate")
+
+	// Modification times are set explicitly, as file systems may only
+	// track them to the second.
+	modified := time.Now().Add(time.Minute)
+	update := func(file string, contents []byte) {
+		require.NoError(t, ioutil.WriteFile(file, contents, 0600), "WriteFile failed")
+		require.NoError(t, os.Chtimes(file, modified, modified), "Chtimes failed")
+		modified = modified.Add(time.Minute)
+	}
+
+	// Until the new key is written, the certificate and key don't match.
+	newCertPEM, newKeyPEM := newTestCertPEM(t, "new")
+	update(certFile, newCertPEM)
+	assert.Equal(t, "old", commonName(t, c), "mismatched key should keep the previous certificate")
+	assert.Equal(t, "old", commonName(t, c), "mismatched key should keep the previous certificate")
+	assert.Contains(t, buf.String(), "Warning: failed to reload the client certificate", "failed reload should be logged")
+	assert.Equal(t, 1, strings.Count(buf.String(), "Warning:"), "failed reload should only be logged once")
+
+	update(keyFile, newKeyPEM)
+	assert.Equal(t, "new", commonName(t, c), "certificate should be rotated")
+	assert.Contains(t, buf.String(), "Note: rotated the client certificate from "+certFile, "rotation should be logged")
+
+	// Missing files keep the previous certificate.
+	require.NoError(t, os.Remove(keyFile), "Remove failed")
+	assert.Equal(t, "new", commonName(t, c), "missing key should keep the previous certificate")
+}
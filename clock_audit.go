@@ -0,0 +1,125 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"time"
+	_ "unsafe" // for go:linkname
+)
+
+// nanotime is the runtime's monotonic clock, which isn't affected by
+// adjustments to the wall clock, such as NTP steps.
+//
+//go:linkname nanotime runtime.nanotime
+func nanotime() int64
+
+const (
+	// clockSkewTolerance is how far the wall clock can drift from the
+	// monotonic clock before a sample or interval is flagged. NTP slews the
+	// clock by at most 500ppm, which is well under this for any request.
+	clockSkewTolerance = time.Millisecond
+
+	// clockWatchInterval is how often the wall clock is checked for
+	// adjustments during a benchmark.
+	clockWatchInterval = 100 * time.Millisecond
+)
+
+// clockReading is a reading of both the wall clock and the monotonic clock.
+type clockReading struct {
+	wall int64
+	mono int64
+}
+
+func readClock() clockReading {
+	return clockReading{wall: time.Now().UnixNano(), mono: nanotime()}
+}
+
+// since returns the time elapsed since the reading using the monotonic
+// clock, and how much more time the wall clock says has elapsed.
+func (r clockReading) since() (elapsed, skew time.Duration) {
+	now := readClock()
+	elapsed = time.Duration(now.mono - r.mono)
+	return elapsed, time.Duration(now.wall-r.wall) - elapsed
+}
+
+// clockAdjustment is a change to the wall clock seen during a benchmark.
+type clockAdjustment struct {
+	at     time.Time
+	offset time.Duration
+}
+
+// clockWatcher checks the wall clock against the monotonic clock on an
+// interval, to report adjustments to the wall clock during a benchmark.
+type clockWatcher struct {
+	interval time.Duration
+	stopped  chan struct{}
+	done     chan struct{}
+
+	// adjustments is only safe to read once done is closed.
+	adjustments []clockAdjustment
+}
+
+func newClockWatcher(interval time.Duration) *clockWatcher {
+	return &clockWatcher{
+		interval: interval,
+		stopped:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (w *clockWatcher) start() {
+	go w.watch()
+}
+
+func (w *clockWatcher) watch() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	last := readClock()
+	for {
+		select {
+		case <-w.stopped:
+			w.check(last)
+			return
+		case <-ticker.C:
+			last = w.check(last)
+		}
+	}
+}
+
+// check records an adjustment if the wall clock has drifted from the
+// monotonic clock since the last reading, and returns a new reading.
+func (w *clockWatcher) check(last clockReading) clockReading {
+	_, skew := last.since()
+	if skew > clockSkewTolerance || skew < -clockSkewTolerance {
+		w.adjustments = append(w.adjustments, clockAdjustment{at: time.Now(), offset: skew})
+	}
+	return readClock()
+}
+
+// stop stops watching the clock, and returns the adjustments that were seen.
+func (w *clockWatcher) stop() []clockAdjustment {
+	close(w.stopped)
+	<-w.done
+	return w.adjustments
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClockReadingSince(t *testing.T) {
+	r := readClock()
+	time.Sleep(10 * time.Millisecond)
+	elapsed, skew := r.since()
+	assert.True(t, elapsed >= 10*time.Millisecond, "Elapsed time %v is too short", elapsed)
+	assert.True(t, skew < clockSkewTolerance && skew > -clockSkewTolerance, "Unexpected skew %v", skew)
+
+	// Simulate the wall clock being stepped back by a second.
+	r.wall += int64(time.Second)
+	_, skew = r.since()
+	assert.InDelta(t, float64(-time.Second), float64(skew), float64(clockSkewTolerance), "Unexpected skew")
+}
+
+func TestClockWatcher(t *testing.T) {
+	w := newClockWatcher(time.Millisecond)
+	w.start()
+	time.Sleep(10 * time.Millisecond)
+	assert.Empty(t, w.stop(), "Expected no adjustments")
+}
+
+func TestClockWatcherCheck(t *testing.T) {
+	w := newClockWatcher(time.Second)
+
+	last := readClock()
+	next := w.check(last)
+	assert.Empty(t, w.adjustments, "Expected no adjustments")
+
+	// Simulate the wall clock being stepped forward by 2 seconds.
+	next.wall -= int64(2 * time.Second)
+	w.check(next)
+	if assert.Len(t, w.adjustments, 1, "Expected an adjustment") {
+		assert.InDelta(t, float64(2*time.Second), float64(w.adjustments[0].offset), float64(clockSkewTolerance), "Unexpected offset")
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/yarpc/yab/sorted"
+	"github.com/yarpc/yab/thrift"
+
+	"github.com/jessevdk/go-flags"
+)
+
+// completeCommand is the hidden command used by the completion scripts to
+// get the completions for the words on the command line.
+const completeCommand = "__complete"
+
+// completionScripts are printed by --completion. Each script calls yab with
+// completeCommand and the words typed so far, including the partial word
+// being completed, and falls back to file completion if there are no results.
+var completionScripts = map[string]string{
+	"bash": `_yab() {
+  local cur words cword
+  if declare -F _get_comp_words_by_ref >/dev/null; then
+    _get_comp_words_by_ref -n =: cur words cword
+  else
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    words=("${COMP_WORDS[@]}")
+    cword=$COMP_CWORD
+  fi
+
+  local IFS=$'\n'
+  COMPREPLY=($(yab ` + completeCommand + ` "${words[@]:1:cword}" 2>/dev/null))
+  if [ ${#COMPREPLY[@]} -eq 0 ]; then
+    COMPREPLY=($(compgen -f -- "$cur"))
+  elif declare -F __ltrim_colon_completions >/dev/null; then
+    __ltrim_colon_completions "$cur"
+  fi
+}
+complete -F _yab yab
+`,
+	"zsh": `#compdef yab
+_yab() {
+  local -a completions
+  completions=("${(@f)$(yab ` + completeCommand + ` "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+  if [[ -n "${completions[1]}" ]]; then
+    compadd -Q -- "${completions[@]}"
+  else
+    _files
+  fi
+}
+compdef _yab yab
+`,
+	"fish": `function __yab_complete
+  set -l tokens (commandline -opc) (commandline -ct)
+  yab ` + completeCommand + ` $tokens[2..-1] 2>/dev/null
+end
+complete -c yab -a '(__yab_complete)'
+`,
+}
+
+// completionScript returns the completion script for the given shell.
+func completionScript(shell string) (string, error) {
+	script, ok := completionScripts[shell]
+	if !ok {
+		return "", fmt.Errorf("unsupported shell %q, options are: %v",
+			shell, strings.Join(sorted.MapKeys(completionScripts), ", "))
+	}
+	return script, nil
+}
+
+// runComplete prints the completions for the last word in words, using
+// the earlier words to find the options that have been specified.
+func runComplete(parser *flags.Parser, opts *Options, words []string, out output) {
+	for _, c := range getCompletions(parser, opts, words) {
+		out.Printf("%v\n", c)
+	}
+}
+
+func getCompletions(parser *flags.Parser, opts *Options, words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	cur := words[len(words)-1]
+	prev := ""
+	if len(words) > 1 {
+		prev = words[len(words)-2]
+	}
+
+	// Errors are ignored, since the command line is usually incomplete.
+	positional, _ := parser.ParseArgs(words[:len(words)-1])
+	if len(opts.ROpts.Methods) > 0 {
+		opts.ROpts.MethodName = opts.ROpts.Methods[0]
+	}
+
+	switch {
+	case strings.HasPrefix(cur, "--method="):
+		return withPrefix("--method=", filterPrefix(completeMethods(opts.ROpts), strings.TrimPrefix(cur, "--method=")))
+	case prev == "-m" || prev == "--method":
+		return filterPrefix(completeMethods(opts.ROpts), cur)
+	case strings.HasPrefix(cur, "-"):
+		return filterPrefix(optionNames(parser), cur)
+	case strings.HasPrefix(prev, "-") && takesValue(parser, prev):
+		// Other option values, such as files, are left to the shell.
+		return nil
+	case len(positional) == 1 && opts.ROpts.MethodName == "":
+		// The method is the second positional argument, after the service.
+		return filterPrefix(completeMethods(opts.ROpts), cur)
+	}
+	return nil
+}
+
+// completeMethods returns the Service::method names in the Thrift file.
+func completeMethods(rOpts RequestOptions) []string {
+	// Completion should be fast, so Thrift files are not fetched from URLs.
+	if rOpts.ThriftFile == "" || isURL(rOpts.ThriftFile) {
+		return nil
+	}
+
+	parsed, err := thrift.Parse(rOpts.ThriftFile)
+	if err != nil {
+		return nil
+	}
+
+	var methods []string
+	for _, svc := range thrift.Services(parsed) {
+		methods = append(methods, svc.Methods()...)
+	}
+	return methods
+}
+
+// optionNames returns the short and long names of all visible options.
+func optionNames(parser *flags.Parser) []string {
+	var names []string
+	var addGroup func(g *flags.Group)
+	addGroup = func(g *flags.Group) {
+		for _, opt := range g.Options() {
+			if opt.Hidden {
+				continue
+			}
+			if opt.LongName != "" {
+				names = append(names, "--"+opt.LongName)
+			}
+			if opt.ShortName != 0 {
+				names = append(names, "-"+string(opt.ShortName))
+			}
+		}
+		for _, child := range g.Groups() {
+			addGroup(child)
+		}
+	}
+	addGroup(parser.Group)
+	return names
+}
+
+// takesValue returns whether the given option requires a value.
+func takesValue(parser *flags.Parser, name string) bool {
+	var opt *flags.Option
+	if strings.HasPrefix(name, "--") {
+		opt = parser.FindOptionByLongName(strings.TrimPrefix(name, "--"))
+	} else if len(name) == 2 {
+		opt = parser.FindOptionByShortName(rune(name[1]))
+	}
+	if opt == nil {
+		return false
+	}
+	return reflect.TypeOf(opt.Value()).Kind() != reflect.Bool
+}
+
+func filterPrefix(items []string, prefix string) []string {
+	var filtered []string
+	for _, item := range items {
+		if strings.HasPrefix(item, prefix) {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered
+}
+
+func withPrefix(prefix string, items []string) []string {
+	for i := range items {
+		items[i] = prefix + items[i]
+	}
+	return items
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetCompletions(t *testing.T) {
+	allMethods := []string{"Simple::bar", "Simple::foo", "Simple::thriftEx"}
+
+	tests := []struct {
+		words []string
+		want  []string
+	}{
+		{
+			words: nil,
+			want:  nil,
+		},
+		{
+			words: []string{"-t", validThrift, "-m", ""},
+			want:  allMethods,
+		},
+		{
+			words: []string{"--thrift", validThrift, "--method", "Simple::f"},
+			want:  []string{"Simple::foo"},
+		},
+		{
+			words: []string{"-t", validThrift, "--method=Simple::b"},
+			want:  []string{"--method=Simple::bar"},
+		},
+		{
+			// The method is the second positional argument.
+			words: []string{"-t", validThrift, "service", "Simple::t"},
+			want:  []string{"Simple::thriftEx"},
+		},
+		{
+			// No Thrift file, so there are no methods.
+			words: []string{"-m", ""},
+			want:  nil,
+		},
+		{
+			words: []string{"--thr"},
+			want:  []string{"--thrift", "--thrift-checksum"},
+		},
+		{
+			// Values for other options are left to the shell.
+			words: []string{"--thrift", ""},
+			want:  nil,
+		},
+		{
+			// Boolean options do not take a value.
+			words: []string{"-t", validThrift, "service", "--health", "Simple::b"},
+			want:  []string{"Simple::bar"},
+		},
+	}
+
+	for _, tt := range tests {
+		var opts Options
+		parser := newParser(&opts)
+		got := getCompletions(parser, &opts, tt.words)
+		assert.Equal(t, tt.want, got, "getCompletions(%q)", tt.words)
+	}
+}
+
+func TestCompletionScript(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		script, err := completionScript(shell)
+		require.NoError(t, err, "completionScript(%v) failed", shell)
+		assert.Contains(t, script, "yab "+completeCommand, "completionScript(%v) should call yab", shell)
+	}
+
+	_, err := completionScript("tcsh")
+	if assert.Error(t, err, "completionScript should fail for unknown shells") {
+		assert.Contains(t, err.Error(), "bash, fish, zsh", "unexpected error")
+	}
+}
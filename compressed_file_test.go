@@ -0,0 +1,58 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadFile(t *testing.T) {
+	want, err := ioutil.ReadFile("testdata/valid_peerlist.csv")
+	require.NoError(t, err, "Failed to read uncompressed file")
+
+	for _, file := range []string{"testdata/valid_peerlist.csv", "testdata/valid_peerlist.csv.zst"} {
+		got, err := readFile(file)
+		if assert.NoError(t, err, "readFile(%v) failed", file) {
+			assert.Equal(t, want, got, "readFile(%v) contents mismatch", file)
+		}
+	}
+}
+
+func TestReadFileErrors(t *testing.T) {
+	_, err := readFile("testdata/missing.json.gz")
+	assert.Error(t, err, "Expected missing file to fail")
+
+	// Files with a compressed extension must be compressed.
+	for _, ext := range []string{".gz", ".zst"} {
+		f := writeFile(t, "compressed", `{"not": "compressed"}`)
+		defer os.Remove(f)
+		require.NoError(t, os.Rename(f, f+ext), "Failed to rename file")
+		defer os.Remove(f + ext)
+
+		_, err := readFile(f + ext)
+		assert.Error(t, err, "Expected uncompressed %v file to fail", ext)
+	}
+}
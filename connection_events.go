@@ -0,0 +1,114 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/yarpc/yab/transport"
+)
+
+// connectionEvents counts the connection events across all of a
+// benchmark's transports, since connection churn often explains latency
+// spikes.
+type connectionEvents struct {
+	opened int64
+	closed int64
+	reset  int64
+	busy   int64
+
+	// closedAtShutdown is counted separately from closed, so that closes
+	// during the benchmark aren't hidden by closing every connection at the end.
+	closedAtShutdown int64
+}
+
+func (c *connectionEvents) record(e transport.ConnectionEvent) {
+	switch e.Type {
+	case transport.ConnectionOpened:
+		atomic.AddInt64(&c.opened, 1)
+	case transport.ConnectionClosed:
+		atomic.AddInt64(&c.closed, 1)
+	case transport.ConnectionReset:
+		atomic.AddInt64(&c.reset, 1)
+	case transport.PeerBusy:
+		atomic.AddInt64(&c.busy, 1)
+	case transport.ConnectionClosedAtShutdown:
+		atomic.AddInt64(&c.closedAtShutdown, 1)
+	}
+}
+
+// print prints the number of each event, if there were any events.
+func (c *connectionEvents) print(out output) {
+	opened := atomic.LoadInt64(&c.opened)
+	closed := atomic.LoadInt64(&c.closed)
+	reset := atomic.LoadInt64(&c.reset)
+	busy := atomic.LoadInt64(&c.busy)
+	closedAtShutdown := atomic.LoadInt64(&c.closedAtShutdown)
+	if opened+closed+reset+busy+closedAtShutdown == 0 {
+		return
+	}
+
+	out.Printf("Connection events: %v opened, %v closed, %v reset, %v busy", opened, closed, reset, busy)
+	if closedAtShutdown > 0 {
+		out.Printf(", %v closed at shutdown", closedAtShutdown)
+	}
+	out.Printf("\n")
+}
+
+// tlsHandshakes counts the full and resumed TLS handshakes across all of a
+// benchmark's transports, and how long they took.
+type tlsHandshakes struct {
+	full         int64
+	fullNanos    int64
+	resumed      int64
+	resumedNanos int64
+}
+
+func (h *tlsHandshakes) record(hs transport.TLSHandshake) {
+	if hs.Resumed {
+		atomic.AddInt64(&h.resumed, 1)
+		atomic.AddInt64(&h.resumedNanos, int64(hs.Duration))
+		return
+	}
+	atomic.AddInt64(&h.full, 1)
+	atomic.AddInt64(&h.fullNanos, int64(hs.Duration))
+}
+
+// print prints the number of full and resumed handshakes with their average
+// duration, if there were any handshakes.
+func (h *tlsHandshakes) print(out output) {
+	full := atomic.LoadInt64(&h.full)
+	resumed := atomic.LoadInt64(&h.resumed)
+	if full+resumed == 0 {
+		return
+	}
+
+	average := func(count, nanos int64) time.Duration {
+		if count == 0 {
+			return 0
+		}
+		return time.Duration(nanos / count)
+	}
+	out.Printf("TLS handshakes: %v full (average %v), %v resumed (average %v)\n",
+		full, average(full, atomic.LoadInt64(&h.fullNanos)),
+		resumed, average(resumed, atomic.LoadInt64(&h.resumedNanos)))
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yarpc/yab/transport"
+)
+
+func TestConnectionEvents(t *testing.T) {
+	tests := []struct {
+		msg    string
+		events []transport.ConnectionEventType
+		want   string
+	}{
+		{
+			msg:  "no events",
+			want: "",
+		},
+		{
+			msg: "all events",
+			events: []transport.ConnectionEventType{
+				transport.ConnectionOpened,
+				transport.ConnectionOpened,
+				transport.ConnectionClosed,
+				transport.ConnectionReset,
+				transport.PeerBusy,
+				transport.PeerBusy,
+				transport.PeerBusy,
+			},
+			want: "Connection events: 2 opened, 1 closed, 1 reset, 3 busy\n",
+		},
+		{
+			msg: "closed at shutdown",
+			events: []transport.ConnectionEventType{
+				transport.ConnectionOpened,
+				transport.ConnectionOpened,
+				transport.ConnectionClosed,
+				transport.ConnectionClosedAtShutdown,
+			},
+			want: "Connection events: 2 opened, 1 closed, 0 reset, 0 busy, 1 closed at shutdown\n",
+		},
+	}
+
+	for _, tt := range tests {
+		var events connectionEvents
+		for _, e := range tt.events {
+			events.record(transport.ConnectionEvent{Type: e, Peer: "1.1.1.1:1"})
+		}
+
+		buf, out := getOutput(t)
+		events.print(out)
+		assert.Equal(t, tt.want, buf.String(), "%v: unexpected output", tt.msg)
+	}
+}
+
+func TestTLSHandshakes(t *testing.T) {
+	tests := []struct {
+		msg        string
+		handshakes []transport.TLSHandshake
+		want       string
+	}{
+		{
+			msg:  "no handshakes",
+			want: "",
+		},
+		{
+			msg: "full and resumed",
+			handshakes: []transport.TLSHandshake{
+				{Duration: 10 * time.Millisecond},
+				{Duration: 20 * time.Millisecond},
+				{Resumed: true, Duration: 2 * time.Millisecond},
+			},
+			want: "TLS handshakes: 2 full (average 15ms), 1 resumed (average 2ms)\n",
+		},
+		{
+			msg: "only resumed",
+			handshakes: []transport.TLSHandshake{
+				{Resumed: true, Duration: time.Millisecond},
+			},
+			want: "TLS handshakes: 0 full (average 0s), 1 resumed (average 1ms)\n",
+		},
+	}
+
+	for _, tt := range tests {
+		var handshakes tlsHandshakes
+		for _, h := range tt.handshakes {
+			handshakes.record(h)
+		}
+
+		buf, out := getOutput(t)
+		handshakes.print(out)
+		assert.Equal(t, tt.want, buf.String(), "%v: unexpected output", tt.msg)
+	}
+}
+
+func TestVerboseConnectionEvents(t *testing.T) {
+	s := newServer(t)
+	defer s.shutdown()
+	s.register(fooMethod, methods.echo())
+
+	buf, out := getOutput(t)
+	runWithOptions(Options{
+		Verbose: true,
+		ROpts: RequestOptions{
+			ThriftFile: validThrift,
+			MethodName: fooMethod,
+			Timeout:    timeMillisFlag(time.Second),
+		},
+		TOpts: s.transportOpts(),
+	}, out)
+
+	assert.Contains(t, buf.String(), "Note: connection to "+s.hostPort()+" opened\n", "connection should be reported")
+}
@@ -0,0 +1,194 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// cookieJar is a http.CookieJar shared by all HTTP transports, so cookies set
+// by one call (e.g. a login) are sent by later calls. It also tracks the
+// cookies it was given so they can be saved and loaded by later runs.
+type cookieJar struct {
+	jar *cookiejar.Jar
+
+	mu      sync.Mutex
+	cookies map[cookieKey]savedCookie
+}
+
+type cookieKey struct {
+	domain, path, name string
+}
+
+// savedCookie is the format cookies are persisted in.
+type savedCookie struct {
+	URL      string    `json:"url"`
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	Domain   string    `json:"domain,omitempty"`
+	Path     string    `json:"path,omitempty"`
+	Expires  time.Time `json:"expires,omitempty"`
+	Secure   bool      `json:"secure,omitempty"`
+	HTTPOnly bool      `json:"httpOnly,omitempty"`
+}
+
+func newCookieJar() *cookieJar {
+	// cookiejar.New only fails for invalid options.
+	jar, _ := cookiejar.New(nil)
+	return &cookieJar{
+		jar:     jar,
+		cookies: make(map[cookieKey]savedCookie),
+	}
+}
+
+// loadCookieJar returns a cookie jar with the cookies saved in file.
+// A missing file returns an empty jar, since it's created when saved.
+func loadCookieJar(file string) (*cookieJar, error) {
+	j := newCookieJar()
+
+	bs, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var saved []savedCookie
+	if err := json.Unmarshal(bs, &saved); err != nil {
+		return nil, fmt.Errorf("invalid cookie jar %v: %v", file, err)
+	}
+
+	for _, c := range saved {
+		u, err := url.Parse(c.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cookie jar %v: cookie %q has invalid URL: %v", file, c.Name, err)
+		}
+		j.SetCookies(u, []*http.Cookie{{
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   c.Domain,
+			Path:     c.Path,
+			Expires:  c.Expires,
+			Secure:   c.Secure,
+			HttpOnly: c.HTTPOnly,
+		}})
+	}
+	return j, nil
+}
+
+// SetCookies implements http.CookieJar.
+func (j *cookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.jar.SetCookies(u, cookies)
+
+	now := time.Now()
+	cookieURL := (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, c := range cookies {
+		domain := c.Domain
+		if domain == "" {
+			domain = u.Hostname()
+		}
+		key := cookieKey{domain, c.Path, c.Name}
+
+		expires := c.Expires
+		if c.MaxAge > 0 {
+			expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+		}
+		if c.MaxAge < 0 || (!expires.IsZero() && !expires.After(now)) {
+			delete(j.cookies, key)
+			continue
+		}
+
+		j.cookies[key] = savedCookie{
+			URL:      cookieURL,
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   c.Domain,
+			Path:     c.Path,
+			Expires:  expires,
+			Secure:   c.Secure,
+			HTTPOnly: c.HttpOnly,
+		}
+	}
+}
+
+// Cookies implements http.CookieJar.
+func (j *cookieJar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+// save writes the unexpired cookies in the jar to file. Session cookies
+// are included so that a sequence of yab runs shares a session.
+func (j *cookieJar) save(file string) error {
+	now := time.Now()
+
+	j.mu.Lock()
+	saved := make([]savedCookie, 0, len(j.cookies))
+	for _, c := range j.cookies {
+		if c.Expires.IsZero() || c.Expires.After(now) {
+			saved = append(saved, c)
+		}
+	}
+	j.mu.Unlock()
+
+	// Sort for a stable file, which makes it easier to inspect and diff.
+	sort.Sort(bySavedCookie(saved))
+
+	bs, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Cookies are often credentials, so only the user can read the file.
+	return ioutil.WriteFile(file, append(bs, '\n'), 0600)
+}
+
+type bySavedCookie []savedCookie
+
+func (p bySavedCookie) Len() int      { return len(p) }
+func (p bySavedCookie) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p bySavedCookie) Less(i, j int) bool {
+	if p[i].URL != p[j].URL {
+		return p[i].URL < p[j].URL
+	}
+	if p[i].Path != p[j].Path {
+		return p[i].Path < p[j].Path
+	}
+	return p[i].Name < p[j].Name
+}
+
+// saveCookieJar saves the jar to file, warning if it fails.
+func saveCookieJar(jar *cookieJar, file string, logger *logger) {
+	if err := jar.save(file); err != nil {
+		logger.Warnf("failed to save cookie jar: %v", err)
+	}
+}
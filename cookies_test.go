@@ -0,0 +1,155 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/yarpc/yab/encoding"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func cookieNames(cookies []*http.Cookie) []string {
+	var names []string
+	for _, c := range cookies {
+		names = append(names, c.Name+"="+c.Value)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestCookieJarSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yab-cookies")
+	require.NoError(t, err, "Failed to create temp dir")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "cookies.json")
+
+	jar, err := loadCookieJar(file)
+	require.NoError(t, err, "Missing cookie jar should be empty")
+
+	u, err := url.Parse("http://example.com/login")
+	require.NoError(t, err, "Failed to parse URL")
+	jar.SetCookies(u, []*http.Cookie{
+		{Name: "session", Value: "abc", Path: "/"},
+		{Name: "remember", Value: "me", Path: "/", MaxAge: 3600},
+		{Name: "old", Value: "x", Path: "/", Expires: time.Now().Add(-time.Hour)},
+		{Name: "deleted", Value: "y", Path: "/"},
+	})
+	jar.SetCookies(u, []*http.Cookie{{Name: "deleted", Path: "/", MaxAge: -1}})
+
+	other, err := url.Parse("http://example.com/other")
+	require.NoError(t, err, "Failed to parse URL")
+	want := []string{"remember=me", "session=abc"}
+	assert.Equal(t, want, cookieNames(jar.Cookies(other)), "Unexpected cookies before saving")
+
+	require.NoError(t, jar.save(file), "Failed to save cookie jar")
+	info, err := os.Stat(file)
+	require.NoError(t, err, "Failed to stat cookie jar")
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "Cookie jar should only be readable by the user")
+
+	loaded, err := loadCookieJar(file)
+	require.NoError(t, err, "Failed to load cookie jar")
+	assert.Equal(t, want, cookieNames(loaded.Cookies(other)), "Unexpected cookies after loading")
+
+	otherHost, err := url.Parse("http://example.org/")
+	require.NoError(t, err, "Failed to parse URL")
+	assert.Empty(t, loaded.Cookies(otherHost), "Cookies should not be sent to other hosts")
+}
+
+func TestLoadCookieJarErrors(t *testing.T) {
+	tests := []struct {
+		contents string
+		wantErr  string
+	}{
+		{contents: "{", wantErr: "invalid cookie jar"},
+		{contents: `[{"url": "://", "name": "a"}]`, wantErr: `cookie "a" has invalid URL`},
+	}
+
+	for _, tt := range tests {
+		file := writeFile(t, "cookies", tt.contents)
+		defer os.Remove(file)
+
+		_, err := loadCookieJar(file)
+		if assert.Error(t, err, "%v should fail", tt.contents) {
+			assert.Contains(t, err.Error(), tt.wantErr, "Unexpected error for %v", tt.contents)
+		}
+	}
+}
+
+func TestCookieJarAcrossRuns(t *testing.T) {
+	gotCookies := make(chan string, 10)
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie("session"); err == nil {
+			gotCookies <- c.Value
+		} else {
+			gotCookies <- ""
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1", Path: "/"})
+		}
+		io.WriteString(w, "{}")
+	}))
+	defer svr.Close()
+
+	dir, err := ioutil.TempDir("", "yab-cookies")
+	require.NoError(t, err, "Failed to create temp dir")
+	defer os.RemoveAll(dir)
+	jarFile := filepath.Join(dir, "cookies.json")
+
+	run := func(tOpts TransportOptions) {
+		tOpts.ServiceName = "svc"
+		tOpts.HostPorts = []string{svr.URL}
+
+		buf, out := getOutput(t)
+		runWithOptions(Options{
+			ROpts: RequestOptions{
+				Encoding:    encoding.JSON,
+				MethodName:  "method",
+				RequestJSON: "{}",
+			},
+			TOpts: tOpts,
+		}, out)
+		assert.Contains(t, buf.String(), "{}", "Unexpected output")
+	}
+
+	run(TransportOptions{})
+	run(TransportOptions{})
+	assert.Equal(t, "", <-gotCookies, "Cookies should be ignored by default")
+	assert.Equal(t, "", <-gotCookies, "Cookies should be ignored by default")
+
+	run(TransportOptions{CookieJar: jarFile})
+	run(TransportOptions{CookieJar: jarFile})
+	assert.Equal(t, "", <-gotCookies, "First run should not have a cookie")
+	assert.Equal(t, "s1", <-gotCookies, "Second run should send the saved cookie")
+
+	contents, err := ioutil.ReadFile(jarFile)
+	require.NoError(t, err, "Failed to read cookie jar")
+	assert.Contains(t, string(contents), `"name": "session"`, "Cookie jar should contain the session cookie")
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/yarpc/yab/transport"
+)
+
+// deadlineStep is the result of a single request in a deadline sweep.
+type deadlineStep struct {
+	timeout time.Duration
+	latency time.Duration
+	err     error
+}
+
+// ignored returns whether the call succeeded well after its deadline, which
+// means the service ignored the propagated deadline. Responses that arrive
+// just after the deadline are not counted, as they may have been sent in time.
+func (s deadlineStep) ignored() bool {
+	return s.err == nil && s.latency > s.timeout+deadlineIgnoredMargin(s.timeout)
+}
+
+// deadlineIgnoredMargin returns how long after the timeout a response must
+// arrive for the deadline to be considered ignored.
+func deadlineIgnoredMargin(timeout time.Duration) time.Duration {
+	if margin := timeout / 4; margin > 5*time.Millisecond {
+		return margin
+	}
+	return 5 * time.Millisecond
+}
+
+// deadlineSweepLocalTimeout returns how long to wait for a response when
+// timeout is propagated to the service, so that responses sent after the
+// deadline are still received.
+func deadlineSweepLocalTimeout(timeout time.Duration) time.Duration {
+	if timeout < time.Second {
+		return timeout + time.Second
+	}
+	return 2 * timeout
+}
+
+func (s deadlineStep) result() string {
+	switch {
+	case s.err != nil:
+		return fmt.Sprintf("error: %v", s.err)
+	case s.ignored():
+		return "success after the deadline"
+	}
+	return "success"
+}
+
+// deadlineSweepTimeouts returns the timeouts used in a deadline sweep,
+// which halve from the request's timeout down to min.
+func deadlineSweepTimeouts(timeout, min time.Duration) []time.Duration {
+	var timeouts []time.Duration
+	for ; timeout >= min && timeout > 0; timeout /= 2 {
+		timeouts = append(timeouts, timeout)
+	}
+	return timeouts
+}
+
+// runDeadlineSweep makes the request with descending timeouts, which are
+// propagated to the service (e.g. as the TChannel TTL or Context-TTL-MS),
+// and reports at which timeout the service starts failing, and whether it
+// ignores deadlines by responding after they have passed.
+// Requests wait longer than the propagated timeout for a response, so late
+// responses can be seen. TChannel calls can't outlive their TTL, so for
+// TChannel, a service that ignores deadlines shows up as failing.
+func runDeadlineSweep(out output, opts RequestOptions, t transport.Transport, req *transport.Request) {
+	timeouts := deadlineSweepTimeouts(req.Timeout, opts.DeadlineSweepMin)
+	if len(timeouts) == 0 {
+		out.Fatalf("Failed while parsing options: --deadline-sweep-min %v must not be longer than the timeout %v\n", opts.DeadlineSweepMin, req.Timeout)
+	}
+
+	out.Printf("%-12v %-12v %v\n", "Timeout", "Latency", "Result")
+	steps := make([]deadlineStep, len(timeouts))
+	for i, timeout := range timeouts {
+		stepReq := *req
+		stepReq.TTL = timeout
+		stepReq.Timeout = deadlineSweepLocalTimeout(timeout)
+
+		start := time.Now()
+		res, err := makeRequest(t, &stepReq)
+		steps[i] = deadlineStep{timeout, roundMicros(time.Since(start)), err}
+		if err == nil {
+			res.Release()
+		}
+		out.Printf("%-12v %-12v %v\n", steps[i].timeout, steps[i].latency, steps[i].result())
+	}
+	out.Printf("\n")
+
+	failed := -1
+	var ignored []time.Duration
+	for i, s := range steps {
+		if s.err != nil && failed < 0 {
+			failed = i
+		}
+		if s.ignored() {
+			ignored = append(ignored, s.timeout)
+		}
+	}
+
+	switch {
+	case failed < 0:
+		out.Printf("Requests succeeded with every timeout down to %v.\n", timeouts[len(timeouts)-1])
+	case failed == 0:
+		out.Printf("Requests failed with every timeout, starting at %v.\n", timeouts[0])
+	default:
+		out.Printf("Requests start failing at a timeout of %v, and succeeded with %v.\n", timeouts[failed], timeouts[failed-1])
+	}
+	if len(ignored) > 0 {
+		out.Printf("The service ignored the deadline and responded after the timeout for: %v\n", ignored)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yarpc/yab/encoding"
+	"github.com/yarpc/yab/transport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel-go/raw"
+	"golang.org/x/net/context"
+)
+
+func TestDeadlineSweepTimeouts(t *testing.T) {
+	tests := []struct {
+		timeout time.Duration
+		min     time.Duration
+		want    []time.Duration
+	}{
+		{
+			timeout: time.Second,
+			min:     100 * time.Millisecond,
+			want:    []time.Duration{time.Second, 500 * time.Millisecond, 250 * time.Millisecond, 125 * time.Millisecond},
+		},
+		{
+			timeout: 10 * time.Millisecond,
+			min:     10 * time.Millisecond,
+			want:    []time.Duration{10 * time.Millisecond},
+		},
+		{
+			timeout: 10 * time.Millisecond,
+			min:     time.Second,
+			want:    nil,
+		},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, deadlineSweepTimeouts(tt.timeout, tt.min), "deadlineSweepTimeouts(%v, %v)", tt.timeout, tt.min)
+	}
+}
+
+func TestDeadlineStepIgnored(t *testing.T) {
+	tests := []struct {
+		step deadlineStep
+		want bool
+	}{
+		{deadlineStep{timeout: 100 * time.Millisecond, latency: 50 * time.Millisecond}, false},
+		{deadlineStep{timeout: 100 * time.Millisecond, latency: 110 * time.Millisecond}, false},
+		{deadlineStep{timeout: 100 * time.Millisecond, latency: 126 * time.Millisecond}, true},
+		{deadlineStep{timeout: 100 * time.Millisecond, latency: 200 * time.Millisecond, err: errors.New("failed")}, false},
+		{deadlineStep{timeout: 10 * time.Millisecond, latency: 14 * time.Millisecond}, false},
+		{deadlineStep{timeout: 10 * time.Millisecond, latency: 16 * time.Millisecond}, true},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.step.ignored(), "ignored() for timeout %v, latency %v", tt.step.timeout, tt.step.latency)
+	}
+}
+
+func TestDeadlineSweepLocalTimeout(t *testing.T) {
+	assert.Equal(t, 1010*time.Millisecond, deadlineSweepLocalTimeout(10*time.Millisecond))
+	assert.Equal(t, 4*time.Second, deadlineSweepLocalTimeout(2*time.Second))
+}
+
+func TestRunDeadlineSweep(t *testing.T) {
+	s := newServer(t)
+	defer s.shutdown()
+	s.register(fooMethod, func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		time.Sleep(30 * time.Millisecond)
+		return &raw.Res{Arg2: args.Arg2, Arg3: args.Arg3}, nil
+	})
+
+	serializer := encoding.NewRaw(fooMethod)
+	req, err := serializer.Request(nil)
+	require.NoError(t, err, "failed to create request")
+	req.Timeout = 200 * time.Millisecond
+
+	transport, err := getTransport(s.transportOpts(), encoding.Raw)
+	require.NoError(t, err, "failed to get transport")
+
+	buf, out := getOutput(t)
+	runDeadlineSweep(out, RequestOptions{DeadlineSweepMin: 20 * time.Millisecond}, transport, req)
+
+	output := buf.String()
+	assert.Equal(t, 3, strings.Count(output, " success\n"), "unexpected output: %v", output)
+	assert.Contains(t, output, "Requests start failing at a timeout of 25ms, and succeeded with 50ms.\n")
+	assert.NotContains(t, output, "ignored the deadline")
+}
+
+func TestRunDeadlineSweepIgnored(t *testing.T) {
+	ttls := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ttls <- r.Header.Get("Context-TTL-MS")
+		time.Sleep(30 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	serializer := encoding.NewRaw(fooMethod)
+	req, err := serializer.Request(nil)
+	require.NoError(t, err, "failed to create request")
+	req.Timeout = 40 * time.Millisecond
+
+	transport, err := getTransport(TransportOptions{ServiceName: "svc", HostPorts: []string{server.URL}}, encoding.Raw)
+	require.NoError(t, err, "failed to get transport")
+
+	buf, out := getOutput(t)
+	runDeadlineSweep(out, RequestOptions{DeadlineSweepMin: 10 * time.Millisecond}, transport, req)
+
+	output := buf.String()
+	require.Len(t, ttls, 3, "unexpected number of requests")
+	for _, want := range []int{40, 20, 10} {
+		assert.Equal(t, strconv.Itoa(want), <-ttls, "unexpected TTL")
+	}
+	assert.Contains(t, output, "Requests succeeded with every timeout down to 10ms.\n")
+	assert.Contains(t, output, "The service ignored the deadline and responded after the timeout for: [20ms 10ms]\n")
+}
+
+func TestRunDeadlineSweepMinTooLong(t *testing.T) {
+	var fatal string
+	out := testOutput{
+		Buffer: &bytes.Buffer{},
+		fatalf: func(format string, args ...interface{}) {
+			fatal = fmt.Sprintf(format, args...)
+		},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runDeadlineSweep(out, RequestOptions{DeadlineSweepMin: time.Second}, nil, &transport.Request{Timeout: 10 * time.Millisecond})
+	}()
+	<-done
+
+	assert.Contains(t, fatal, "--deadline-sweep-min 1s must not be longer than the timeout 10ms")
+}
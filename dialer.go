@@ -0,0 +1,152 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+var (
+	errLocalAddrOptions      = errors.New("do not specify both --local-addr and --interface")
+	errSocketOptionsTChannel = errors.New("--tcp-nodelay, --tcp-keepalive, --so-rcvbuf and --so-sndbuf are not supported for TChannel, which does not allow a custom dialer")
+)
+
+// getDialer returns the function used to create connections for transports
+// that support custom dialing.
+func getDialer(opts TransportOptions) (func(network, addr string) (net.Conn, error), error) {
+	localIP, err := getLocalIP(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{
+		Timeout:       opts.ConnectTimeout.Duration(),
+		FallbackDelay: opts.FallbackDelay,
+		KeepAlive:     opts.TCPKeepAlive,
+	}
+	if localIP != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: localIP}
+	}
+
+	proxy, err := newProxyProtocol(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	overrides := newResolveOverrides(opts.Resolve)
+	return func(network, addr string) (net.Conn, error) {
+		conn, err := dialer.Dial(opts.IPVersion.network(network), overrides.apply(addr))
+		if err != nil {
+			return nil, err
+		}
+		if err := setSocketOptions(conn, opts); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if proxy != nil {
+			if err := proxy.write(conn); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+		return conn, nil
+	}, nil
+}
+
+// hasSocketOptions returns whether any socket options are set. The keepalive
+// period is set by the dialer, so it's not set by setSocketOptions.
+func (o TransportOptions) hasSocketOptions() bool {
+	return o.TCPNoDelay != "" || o.TCPKeepAlive != 0 || o.SocketRecvBuffer > 0 || o.SocketSendBuffer > 0
+}
+
+// setSocketOptions sets the socket options for a new TCP connection.
+func setSocketOptions(conn net.Conn, opts TransportOptions) error {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+
+	if opts.TCPNoDelay != "" {
+		if err := tcpConn.SetNoDelay(opts.TCPNoDelay == "true"); err != nil {
+			return fmt.Errorf("failed to set TCP_NODELAY: %v", err)
+		}
+	}
+	if opts.SocketRecvBuffer > 0 {
+		if err := tcpConn.SetReadBuffer(int(opts.SocketRecvBuffer)); err != nil {
+			return fmt.Errorf("failed to set SO_RCVBUF: %v", err)
+		}
+	}
+	if opts.SocketSendBuffer > 0 {
+		if err := tcpConn.SetWriteBuffer(int(opts.SocketSendBuffer)); err != nil {
+			return fmt.Errorf("failed to set SO_SNDBUF: %v", err)
+		}
+	}
+	return nil
+}
+
+// getLocalIP returns the IP that outgoing connections should be bound to,
+// or nil if the OS should choose.
+func getLocalIP(opts TransportOptions) (net.IP, error) {
+	if opts.LocalAddr != "" && opts.Interface != "" {
+		return nil, errLocalAddrOptions
+	}
+
+	if opts.LocalAddr != "" {
+		ip := net.ParseIP(opts.LocalAddr)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid local address %q", opts.LocalAddr)
+		}
+		if !opts.IPVersion.matches(ip) {
+			return nil, fmt.Errorf("local address %q is not an IPv%v address", opts.LocalAddr, opts.IPVersion)
+		}
+		return ip, nil
+	}
+
+	if opts.Interface != "" {
+		return interfaceIP(opts.Interface, opts.IPVersion)
+	}
+
+	return nil, nil
+}
+
+// interfaceIP returns the first IP of the named interface that matches the IP version.
+func interfaceIP(name string, version ipVersion) (net.IP, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find interface %q: %v", name, err)
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get addresses for interface %q: %v", name, err)
+	}
+
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if ok && version.matches(ipNet.IP) {
+			return ipNet.IP, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no matching address found for interface %q", name)
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getSockopt(t *testing.T, conn net.Conn, level, opt int) int {
+	raw, err := conn.(*net.TCPConn).SyscallConn()
+	require.NoError(t, err, "SyscallConn failed")
+
+	var value int
+	var sockErr error
+	require.NoError(t, raw.Control(func(fd uintptr) {
+		value, sockErr = syscall.GetsockoptInt(int(fd), level, opt)
+	}), "Control failed")
+	require.NoError(t, sockErr, "GetsockoptInt failed")
+	return value
+}
+
+func TestDialerSocketOptions(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Listen failed")
+	defer ln.Close()
+
+	tests := []struct {
+		msg           string
+		opts          TransportOptions
+		wantNoDelay   int
+		wantKeepAlive int
+		minRecvBuffer int
+		minSendBuffer int
+	}{
+		{
+			msg:           "defaults",
+			wantNoDelay:   1,
+			wantKeepAlive: 1,
+		},
+		{
+			msg: "all options",
+			opts: TransportOptions{
+				TCPNoDelay:       "false",
+				TCPKeepAlive:     -time.Second,
+				SocketRecvBuffer: 128 * 1024,
+				SocketSendBuffer: 64 * 1024,
+			},
+			wantNoDelay:   0,
+			wantKeepAlive: 0,
+			minRecvBuffer: 128 * 1024,
+			minSendBuffer: 64 * 1024,
+		},
+	}
+
+	for _, tt := range tests {
+		dial, err := getDialer(tt.opts)
+		require.NoError(t, err, "%v: getDialer failed", tt.msg)
+
+		conn, err := dial("tcp", ln.Addr().String())
+		require.NoError(t, err, "%v: Dial failed", tt.msg)
+
+		assert.Equal(t, tt.wantNoDelay, getSockopt(t, conn, syscall.IPPROTO_TCP, syscall.TCP_NODELAY), "%v: unexpected TCP_NODELAY", tt.msg)
+		assert.Equal(t, tt.wantKeepAlive, getSockopt(t, conn, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE), "%v: unexpected SO_KEEPALIVE", tt.msg)
+
+		// Linux doubles the requested buffer sizes for bookkeeping overhead.
+		assert.True(t, getSockopt(t, conn, syscall.SOL_SOCKET, syscall.SO_RCVBUF) >= tt.minRecvBuffer, "%v: SO_RCVBUF too small", tt.msg)
+		assert.True(t, getSockopt(t, conn, syscall.SOL_SOCKET, syscall.SO_SNDBUF) >= tt.minSendBuffer, "%v: SO_SNDBUF too small", tt.msg)
+		conn.Close()
+	}
+}
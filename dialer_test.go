@@ -0,0 +1,149 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialerResolve(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Listen failed")
+	defer ln.Close()
+
+	dial, err := getDialer(TransportOptions{
+		Resolve: []resolveOverride{{HostPort: "fake.host:80", Addr: ln.Addr().String()}},
+	})
+	require.NoError(t, err, "getDialer failed")
+
+	conn, err := dial("tcp", "fake.host:80")
+	require.NoError(t, err, "Dial with resolve override failed")
+	defer conn.Close()
+	assert.Equal(t, ln.Addr().String(), conn.RemoteAddr().String(), "Unexpected remote address")
+}
+
+func TestDialerIPVersion(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Listen failed")
+	defer ln.Close()
+
+	dial, err := getDialer(TransportOptions{IPVersion: ipVersion4})
+	require.NoError(t, err, "getDialer failed")
+	conn, err := dial("tcp", ln.Addr().String())
+	require.NoError(t, err, "Dial over IPv4 failed")
+	conn.Close()
+
+	dial, err = getDialer(TransportOptions{IPVersion: ipVersion6})
+	require.NoError(t, err, "getDialer failed")
+	_, err = dial("tcp", ln.Addr().String())
+	assert.Error(t, err, "Dial to an IPv4 address over IPv6 should fail")
+}
+
+func TestDialerLocalAddr(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Listen failed")
+	defer ln.Close()
+
+	dial, err := getDialer(TransportOptions{LocalAddr: "127.0.0.1"})
+	require.NoError(t, err, "getDialer failed")
+
+	conn, err := dial("tcp", ln.Addr().String())
+	require.NoError(t, err, "Dial failed")
+	defer conn.Close()
+	assert.Equal(t, "127.0.0.1", conn.LocalAddr().(*net.TCPAddr).IP.String(), "Unexpected local address")
+}
+
+func loopbackInterface(t *testing.T) string {
+	ifaces, err := net.Interfaces()
+	require.NoError(t, err, "Failed to list interfaces")
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			return iface.Name
+		}
+	}
+	t.Skip("no loopback interface found")
+	return ""
+}
+
+func TestGetLocalIP(t *testing.T) {
+	loopback := loopbackInterface(t)
+
+	tests := []struct {
+		opts    TransportOptions
+		want    string
+		wantErr string
+	}{
+		{
+			opts: TransportOptions{},
+		},
+		{
+			opts: TransportOptions{LocalAddr: "10.0.0.1"},
+			want: "10.0.0.1",
+		},
+		{
+			opts: TransportOptions{LocalAddr: "::1", IPVersion: ipVersion6},
+			want: "::1",
+		},
+		{
+			opts:    TransportOptions{LocalAddr: "::1", IPVersion: ipVersion4},
+			wantErr: "is not an IPv4 address",
+		},
+		{
+			opts:    TransportOptions{LocalAddr: "not-an-ip"},
+			wantErr: "invalid local address",
+		},
+		{
+			opts:    TransportOptions{LocalAddr: "10.0.0.1", Interface: loopback},
+			wantErr: errLocalAddrOptions.Error(),
+		},
+		{
+			opts: TransportOptions{Interface: loopback, IPVersion: ipVersion4},
+			want: "127.0.0.1",
+		},
+		{
+			opts:    TransportOptions{Interface: "yab-missing0"},
+			wantErr: "failed to find interface",
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := getLocalIP(tt.opts)
+		if tt.wantErr != "" {
+			if assert.Error(t, err, "getLocalIP(%+v) should fail", tt.opts) {
+				assert.Contains(t, err.Error(), tt.wantErr, "Unexpected error for getLocalIP(%+v)", tt.opts)
+			}
+			continue
+		}
+
+		if !assert.NoError(t, err, "getLocalIP(%+v) failed", tt.opts) {
+			continue
+		}
+		if tt.want == "" {
+			assert.Nil(t, got, "getLocalIP(%+v) should not bind", tt.opts)
+		} else {
+			assert.Equal(t, tt.want, got.String(), "getLocalIP(%+v) mismatch", tt.opts)
+		}
+	}
+}
@@ -26,6 +26,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/yarpc/yab/thrift"
 	"github.com/yarpc/yab/transport"
 	"github.com/yarpc/yab/unmarshal"
 )
@@ -62,6 +63,8 @@ var (
 	errNilEncoding = errors.New("cannot Unmarshal into nil Encoding")
 	// ErrHealthThriftOnly is returned if the user specifies an unsupported encoding with --health.
 	ErrHealthThriftOnly = errors.New("--health can only be used with Thrift")
+	// ErrResponseSchemaThriftOnly is returned if the user specifies an unsupported encoding with --export-response-schema.
+	ErrResponseSchemaThriftOnly = errors.New("--export-response-schema can only be used with Thrift")
 )
 
 func (e Encoding) String() string {
@@ -88,12 +91,30 @@ func (e *Encoding) UnmarshalFlag(s string) error {
 	return e.UnmarshalText([]byte(s))
 }
 
+// ResponseSchema returns a JSON Schema describing the responses of the
+// serializer's method. Only Thrift serializers are supported, since the
+// schema is derived from the IDL.
+func ResponseSchema(s Serializer) (map[string]interface{}, error) {
+	ts, ok := s.(thriftSerializer)
+	if !ok {
+		return nil, ErrResponseSchemaThriftOnly
+	}
+	return thrift.ResponseSchema(ts.methodName+" response", ts.spec, ts.opts), nil
+}
+
+// IsStringArg returns whether the top-level argument of the serializer's
+// method is a string or binary. This is only known for Thrift serializers.
+func IsStringArg(s Serializer, name string) bool {
+	ts, ok := s.(thriftSerializer)
+	return ok && thrift.IsStringArg(ts.spec, name, ts.opts)
+}
+
 // GetHealth returns a serializer for the Health endpoint.
 func (e Encoding) GetHealth() (Serializer, error) {
 	switch e {
 	case UnspecifiedEncoding, Thrift:
 		method, spec := getHealthSpec()
-		return thriftSerializer{method, spec}, nil
+		return thriftSerializer{methodName: method, spec: spec}, nil
 	default:
 		return nil, ErrHealthThriftOnly
 	}
@@ -137,6 +158,11 @@ func (e jsonSerializer) Response(res *transport.Response) (interface{}, error) {
 }
 
 func (e jsonSerializer) CheckSuccess(res *transport.Response) error {
+	// A truncated response cannot be parsed, so it is not checked.
+	if res.Truncated {
+		return nil
+	}
+
 	_, err := e.Response(res)
 	return err
 }
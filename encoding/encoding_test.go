@@ -181,3 +181,9 @@ func TestJSONEncodingResponse(t *testing.T) {
 		}
 	}
 }
+
+func TestJSONCheckSuccessTruncated(t *testing.T) {
+	serializer := NewJSON("method")
+	res := &transport.Response{Body: []byte(`{"key": `), Truncated: true}
+	assert.NoError(t, serializer.CheckSuccess(res), "Truncated responses should not be validated")
+}
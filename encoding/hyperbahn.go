@@ -0,0 +1,109 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package encoding
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/thriftrw/thriftrw-go/compile"
+)
+
+// _hyperbahnThrift is the discovery API of Hyperbahn routers, from
+// https://github.com/uber/hyperbahn/blob/master/hyperbahn.thrift
+const _hyperbahnThrift = `
+exception NoPeersAvailable {
+    1: required string message
+    2: required string serviceName
+}
+
+exception InvalidServiceName {
+    1: required string message
+    2: required string serviceName
+}
+
+struct DiscoveryQuery {
+    1: required string serviceName
+}
+
+union IpAddress {
+    1: i32 ipv4
+}
+
+struct ServicePeer {
+    1: required IpAddress ip
+    2: required i32 port
+}
+
+struct DiscoveryResult {
+    1: required list<ServicePeer> peers
+}
+
+service Hyperbahn {
+    DiscoveryResult discover(
+        1: required DiscoveryQuery query
+    ) throws (
+        1: NoPeersAvailable noPeersAvailable
+        2: InvalidServiceName invalidServiceName
+    )
+}
+`
+
+const (
+	hyperbahnService = "Hyperbahn"
+	discoverMethod   = "discover"
+)
+
+var (
+	hyperbahnModuleOnce sync.Once
+	hyperbahnModule     *compile.Module
+)
+
+type hyperbahnFS struct{}
+
+func (hyperbahnFS) Read(_ string) ([]byte, error) {
+	return []byte(_hyperbahnThrift), nil
+}
+
+func (hyperbahnFS) Abs(p string) (string, error) {
+	return p, nil
+}
+
+func getHyperbahnService() *compile.ServiceSpec {
+	hyperbahnModuleOnce.Do(func() {
+		var err error
+		hyperbahnModule, err = compile.Compile("hyperbahn.thrift", compile.Filesystem(hyperbahnFS{}))
+		if err != nil {
+			panic(fmt.Sprintf("failed to parse embedded hyperbahn.thrift: %v", err))
+		}
+	})
+
+	return hyperbahnModule.Services[hyperbahnService]
+}
+
+// NewHyperbahnDiscover returns a serializer for Hyperbahn::discover, which
+// returns the instances of a service that a Hyperbahn router routes to.
+func NewHyperbahnDiscover() Serializer {
+	return thriftSerializer{
+		methodName: hyperbahnService + "::" + discoverMethod,
+		spec:       getHyperbahnService().Functions[discoverMethod],
+	}
+}
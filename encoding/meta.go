@@ -60,8 +60,9 @@ service Meta {
 `
 
 const (
-	metaService  = "Meta"
-	healthMethod = "health"
+	metaService     = "Meta"
+	healthMethod    = "health"
+	thriftIDLMethod = "thriftIDL"
 )
 
 var (
@@ -94,3 +95,12 @@ func getMetaService() *compile.ServiceSpec {
 func getHealthSpec() (string, *compile.FunctionSpec) {
 	return metaService + "::" + healthMethod, getMetaService().Functions[healthMethod]
 }
+
+// NewThriftIDL returns a serializer for Meta::thriftIDL, which returns the
+// Thrift files used by a TChannel server, and the entry point file.
+func NewThriftIDL() Serializer {
+	return thriftSerializer{
+		methodName: metaService + "::" + thriftIDLMethod,
+		spec:       getMetaService().Functions[thriftIDLMethod],
+	}
+}
@@ -33,3 +33,38 @@ type notFoundError struct {
 func (e notFoundError) Error() string {
 	return fmt.Sprintf("%v\n\t%v", e.msg, strings.Join(e.available, "\n\t"))
 }
+
+// didYouMean returns a suggestion to add to an error message, or "" if
+// there is no suggestion.
+func didYouMean(suggestion string) string {
+	if suggestion == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (did you mean %q?)", suggestion)
+}
+
+// findByPrefix returns the name in available that matches name ignoring
+// case, or that name is a case-insensitive prefix of. It returns false if
+// there are no matches, or multiple names have name as a prefix.
+func findByPrefix(name string, available []string) (string, bool) {
+	if name == "" {
+		return "", false
+	}
+
+	lower := strings.ToLower(name)
+	var matches []string
+	for _, a := range available {
+		lowerA := strings.ToLower(a)
+		if lowerA == lower {
+			return a, true
+		}
+		if strings.HasPrefix(lowerA, lower) {
+			matches = append(matches, a)
+		}
+	}
+
+	if len(matches) != 1 {
+		return "", false
+	}
+	return matches[0], true
+}
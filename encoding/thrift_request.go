@@ -24,6 +24,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/yarpc/yab/sorted"
 	"github.com/yarpc/yab/thrift"
@@ -36,10 +37,14 @@ import (
 type thriftSerializer struct {
 	methodName string
 	spec       *compile.FunctionSpec
+	opts       thrift.Options
+
+	// module is used to resolve references to constants in requests.
+	module *compile.Module
 }
 
 // NewThrift returns a Thrift serializer.
-func NewThrift(thriftFile, methodName string) (Serializer, error) {
+func NewThrift(thriftFile, methodName string, opts thrift.Options) (Serializer, error) {
 	if thriftFile == "" {
 		return nil, errors.New("specify a Thrift file using --thrift")
 	}
@@ -52,22 +57,29 @@ func NewThrift(thriftFile, methodName string) (Serializer, error) {
 		return nil, fmt.Errorf("could not parse Thrift file: %v", err)
 	}
 
+	opts.Annotations, err = thrift.ParseAnnotations(parsed)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse Thrift annotations: %v", err)
+	}
+
 	thriftSvc, thriftMethod, err := thrift.SplitMethod(methodName)
 	if err != nil {
 		return nil, err
 	}
 
-	service, err := findService(parsed, thriftSvc)
+	svcName, service, err := findService(parsed, thriftSvc)
 	if err != nil {
 		return nil, err
 	}
 
-	spec, err := findMethod(service, thriftMethod)
+	spec, err := findMethod(svcName, service, thriftMethod)
 	if err != nil {
 		return nil, err
 	}
 
-	return thriftSerializer{methodName, spec}, nil
+	// The service and method may have been matched by a prefix, so use the names from the IDL.
+	// Services in included files are called using their name, without the include name.
+	return thriftSerializer{service.Name + "::" + spec.Name, spec, opts, parsed}, nil
 }
 
 func (e thriftSerializer) Encoding() Encoding {
@@ -75,12 +87,19 @@ func (e thriftSerializer) Encoding() Encoding {
 }
 
 func (e thriftSerializer) Request(input []byte) (*transport.Request, error) {
-	reqMap, err := unmarshal.YAML(input)
+	var reqMap map[string]interface{}
+	var err error
+	if ref := strings.TrimSpace(string(input)); thrift.IsConstRef(ref) {
+		// The whole request can be a constant defined in the Thrift file.
+		reqMap, err = thrift.ConstRequest(e.module, ref)
+	} else if reqMap, err = unmarshal.YAML(input); err == nil {
+		reqMap, err = thrift.ResolveConstants(e.module, reqMap)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	reqBytes, err := thrift.RequestToBytes(e.spec, reqMap)
+	reqBytes, err := thrift.RequestToBytes(e.spec, reqMap, e.opts)
 	if err != nil {
 		return nil, err
 	}
@@ -92,27 +111,44 @@ func (e thriftSerializer) Request(input []byte) (*transport.Request, error) {
 }
 
 func (e thriftSerializer) Response(res *transport.Response) (interface{}, error) {
-	return thrift.ResponseBytesToMap(e.spec, res.Body)
+	return thrift.ResponseBytesToMap(e.spec, res.Body, e.opts)
 }
 
-func findService(parsed *compile.Module, svcName string) (*compile.ServiceSpec, error) {
-	if service, err := parsed.LookupService(svcName); err == nil {
-		return service, nil
+// findService returns the service, and the name it was found by, which is
+// qualified with the include names for services in included files.
+func findService(parsed *compile.Module, svcName string) (string, *compile.ServiceSpec, error) {
+	if service, err := thrift.LookupService(parsed, svcName); err == nil {
+		return svcName, service, nil
+	}
+
+	services := thrift.Services(parsed)
+	available := make([]string, len(services))
+	for i, svc := range services {
+		available[i] = svc.Name
+	}
+	if name, ok := findByPrefix(svcName, available); ok {
+		for _, svc := range services {
+			if svc.Name == name {
+				return name, svc.Spec, nil
+			}
+		}
 	}
 
-	available := sorted.MapKeys(parsed.Services)
 	errMsg := "no Thrift service specified, specify --method Service::Method"
 	if svcName != "" {
-		errMsg = fmt.Sprintf("could not find service %q", svcName)
+		errMsg = fmt.Sprintf("could not find service %q", svcName) + didYouMean(thrift.ClosestName(svcName, available))
 	}
-	return nil, notFoundError{errMsg + ", available services:", available}
+	return "", nil, notFoundError{errMsg + ", available services:", available}
 }
 
 func (e thriftSerializer) CheckSuccess(res *transport.Response) error {
+	if res.Truncated {
+		return thrift.CheckSuccessPrefix(e.spec, res.Body)
+	}
 	return thrift.CheckSuccess(e.spec, res.Body)
 }
 
-func findMethod(service *compile.ServiceSpec, methodName string) (*compile.FunctionSpec, error) {
+func findMethod(svcName string, service *compile.ServiceSpec, methodName string) (*compile.FunctionSpec, error) {
 	functions := service.Functions
 
 	if service.Parent != nil {
@@ -130,9 +166,17 @@ func findMethod(service *compile.ServiceSpec, methodName string) (*compile.Funct
 	}
 
 	available := sorted.MapKeys(functions)
+	if name, ok := findByPrefix(methodName, available); ok {
+		return functions[name], nil
+	}
+
 	errMsg := "no Thrift method specified, specify --method Service::Method"
 	if methodName != "" {
-		errMsg = fmt.Sprintf("could not find method %q in %q", methodName, service.Name)
+		var suggestion string
+		if closest := thrift.ClosestName(methodName, available); closest != "" {
+			suggestion = svcName + "::" + closest
+		}
+		errMsg = fmt.Sprintf("could not find method %q in %q", methodName, svcName) + didYouMean(suggestion)
 	}
 	return nil, notFoundError{errMsg + ", available methods:", available}
 }
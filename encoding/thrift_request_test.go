@@ -23,6 +23,7 @@ package encoding
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -83,7 +84,7 @@ func TestNewThriftSerializer(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		got, err := NewThrift(tt.file, tt.method)
+		got, err := NewThrift(tt.file, tt.method, thrift.Options{})
 		if tt.errMsg == "" {
 			assert.NoError(t, err, "%v", tt.desc)
 			if assert.NotNil(t, got, "%v: Invalid request") {
@@ -99,8 +100,17 @@ func TestNewThriftSerializer(t *testing.T) {
 	}
 }
 
+func TestRequestMethodPrefix(t *testing.T) {
+	serializer, err := NewThrift(validThrift, "simple::FO", thrift.Options{})
+	require.NoError(t, err, "Failed to create serializer")
+
+	req, err := serializer.Request(nil)
+	require.NoError(t, err, "Failed to serialize request")
+	assert.Equal(t, "Simple::foo", req.Method, "Method should use the names from the IDL")
+}
+
 func TestRequest(t *testing.T) {
-	serializer, err := NewThrift(validThrift, "Simple::foo")
+	serializer, err := NewThrift(validThrift, "Simple::foo", thrift.Options{})
 	require.NoError(t, err, "Failed to create serializer")
 
 	tests := []struct {
@@ -143,25 +153,38 @@ func TestFindServiceFound(t *testing.T) {
 	parsed := mustParse(t, `
     service Foo {}
     service Bar {}
+    service Baz {}
   `)
 	tests := []struct {
 		svc    string
+		want   string
 		errMsg string
 	}{
 		{svc: "Foo"},
 		{svc: "Bar"},
+		{svc: "F", want: "Foo"},
+		{svc: "foo", want: "Foo"},
+		{svc: "baz", want: "Baz"},
 		{
 			svc:    "",
 			errMsg: "no Thrift service specified",
 		},
 		{
-			svc:    "F",
-			errMsg: `could not find service "F"`,
+			svc:    "Ba",
+			errMsg: `could not find service "Ba"`,
+		},
+		{
+			svc:    "Fooo",
+			errMsg: `could not find service "Fooo" (did you mean "Foo"?)`,
+		},
+		{
+			svc:    "Qux",
+			errMsg: `could not find service "Qux", available services:`,
 		},
 	}
 
 	for _, tt := range tests {
-		got, err := findService(parsed, tt.svc)
+		name, got, err := findService(parsed, tt.svc)
 		if tt.errMsg != "" {
 			if assert.Error(t, err, "findService(%v) should fail", tt.svc) {
 				assert.Contains(t, err.Error(), tt.errMsg, "findService(%v) got unexpected error", tt.svc)
@@ -169,8 +192,12 @@ func TestFindServiceFound(t *testing.T) {
 			continue
 		}
 
+		if tt.want == "" {
+			tt.want = tt.svc
+		}
 		if assert.NoError(t, err, "findService(%v) should not fail", tt.svc) {
-			assert.Equal(t, tt.svc, got.Name, "Service name mismatch")
+			assert.Equal(t, tt.want, name, "Service name mismatch")
+			assert.Equal(t, tt.want, got.Name, "Service name mismatch")
 		}
 	}
 }
@@ -198,9 +225,14 @@ func TestFindMethod(t *testing.T) {
 	tests := []struct {
 		svc    string
 		f      string
+		want   string
 		errMsg string
 	}{
 		{svc: "Foo", f: "f1"},
+		{svc: "Foo", f: "F1", want: "f1"},
+		{svc: "S3", f: "M", errMsg: "could not find method"},
+		{svc: "S3", f: "m", errMsg: "could not find method"},
+		{svc: "S2", f: "M2", want: "m2"},
 		{svc: "Foo", f: "f2"},
 		{svc: "S2", f: "m1"},
 		{svc: "S3", f: "m1"},
@@ -214,7 +246,12 @@ func TestFindMethod(t *testing.T) {
 		{
 			svc:    "Foo",
 			f:      "f3",
-			errMsg: `could not find method "f3" in "Foo"`,
+			errMsg: `could not find method "f3" in "Foo", available methods:`,
+		},
+		{
+			svc:    "Foo",
+			f:      "fx1",
+			errMsg: `could not find method "fx1" in "Foo" (did you mean "Foo::f1"?)`,
 		},
 		{
 			svc:    "S1",
@@ -229,10 +266,10 @@ func TestFindMethod(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		svc, err := findService(parsed, tt.svc)
+		svcName, svc, err := findService(parsed, tt.svc)
 		require.NoError(t, err, "Failed to find service")
 
-		got, err := findMethod(svc, tt.f)
+		got, err := findMethod(svcName, svc, tt.f)
 		if tt.errMsg != "" {
 			if assert.Error(t, err, "findMethod(%v) should fail", tt.f) {
 				assert.Contains(t, err.Error(), tt.errMsg, "findMethod(%v) got unexpected error", tt.f)
@@ -240,8 +277,11 @@ func TestFindMethod(t *testing.T) {
 			continue
 		}
 
+		if tt.want == "" {
+			tt.want = tt.f
+		}
 		if assert.NoError(t, err, "findMethod(%v) should not fail", tt.f) {
-			assert.Equal(t, tt.f, got.Name, "Method name mismatch")
+			assert.Equal(t, tt.want, got.Name, "Method name mismatch")
 		}
 	}
 }
@@ -269,3 +309,85 @@ func mustParseFile(t *testing.T, filename string) *compile.Module {
 	require.NoError(t, err, "thrift.Parse failed")
 	return parsed
 }
+
+func TestResponseSchema(t *testing.T) {
+	serializer, err := NewThrift(validThrift, "Simple::bar", thrift.Options{})
+	require.NoError(t, err, "Failed to create serializer")
+
+	schema, err := ResponseSchema(serializer)
+	require.NoError(t, err, "ResponseSchema failed")
+	assert.Equal(t, "Simple::bar response", schema["title"], "Unexpected title")
+
+	_, err = ResponseSchema(NewJSON("method"))
+	assert.Equal(t, ErrResponseSchemaThriftOnly, err, "ResponseSchema should fail for JSON")
+}
+
+func TestRequestConstants(t *testing.T) {
+	f, err := ioutil.TempFile("", "consts")
+	require.NoError(t, err, "TempFile failed")
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`
+		struct Filter {
+		  1: optional string status
+		}
+		const Filter ACTIVE = {"status": "ACTIVE"}
+		const map<string, Filter> FIND_ACTIVE = {"filter": ACTIVE}
+		service Search {
+		  void find(1: Filter filter)
+		}
+	`)
+	require.NoError(t, err, "Write failed")
+	require.NoError(t, f.Close(), "Close failed")
+
+	serializer, err := NewThrift(f.Name(), "Search::find", thrift.Options{})
+	require.NoError(t, err, "Failed to create serializer")
+
+	literal, err := serializer.Request([]byte(`{"filter": {"status": "ACTIVE"}}`))
+	require.NoError(t, err, "Failed to serialize literal request")
+
+	for _, input := range []string{`{"filter": "$consts.ACTIVE"}`, "$consts.FIND_ACTIVE\n"} {
+		req, err := serializer.Request([]byte(input))
+		if assert.NoError(t, err, "Failed to serialize %v", input) {
+			assert.Equal(t, literal.Body, req.Body, "Constant %v should match the literal request", input)
+		}
+	}
+
+	_, err = serializer.Request([]byte(`{"filter": "$consts.INACTIVE"}`))
+	if assert.Error(t, err, "Unknown constants should fail") {
+		assert.Contains(t, err.Error(), `could not find constant "$consts.INACTIVE"`)
+	}
+}
+
+func TestNewThriftIncludedService(t *testing.T) {
+	dir, err := ioutil.TempDir("", "included")
+	require.NoError(t, err, "TempDir failed")
+	defer os.RemoveAll(dir)
+
+	mainFile := filepath.Join(dir, "main.thrift")
+	require.NoError(t, ioutil.WriteFile(mainFile, []byte(`
+		include "./shared.thrift"
+		service Users {
+			void get()
+		}
+	`), 0644), "WriteFile failed")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "shared.thrift"), []byte(`
+		service Health {
+			bool check()
+		}
+	`), 0644), "WriteFile failed")
+
+	for _, method := range []string{"shared.Health::check", "shared.he::ch"} {
+		serializer, err := NewThrift(mainFile, method, thrift.Options{})
+		require.NoError(t, err, "Failed to create serializer for %v", method)
+
+		req, err := serializer.Request(nil)
+		require.NoError(t, err, "Failed to serialize request")
+		assert.Equal(t, "Health::check", req.Method, "Included services should be called without the include name")
+	}
+
+	_, err = NewThrift(mainFile, "shared.Health::chek", thrift.Options{})
+	assert.Contains(t, err.Error(), `could not find method "chek" in "shared.Health" (did you mean "shared.Health::check"?)`)
+
+	_, err = NewThrift(mainFile, "Health::check", thrift.Options{})
+	assert.Contains(t, err.Error(), `could not find service "Health", available services:`)
+}
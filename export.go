@@ -0,0 +1,153 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/yarpc/yab/transport"
+)
+
+// The list of supported --export formats.
+const exportPostman = "postman"
+
+var (
+	errExportBinary  = errors.New("binary request bodies, such as Thrift, are not supported by Postman")
+	errExportNothing = errors.New("no requests could be exported")
+)
+
+const postmanSchema = "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"
+
+// exportRequest is a request to include in an exported collection.
+type exportRequest struct {
+	name  string
+	tOpts TransportOptions
+	req   *transport.Request
+}
+
+type postmanCollection struct {
+	Info postmanInfo   `json:"info"`
+	Item []postmanItem `json:"item"`
+}
+
+type postmanInfo struct {
+	Name   string `json:"name"`
+	Schema string `json:"schema"`
+}
+
+type postmanItem struct {
+	Name    string         `json:"name"`
+	Request postmanRequest `json:"request"`
+}
+
+type postmanRequest struct {
+	Method string          `json:"method"`
+	Header []postmanHeader `json:"header"`
+	Body   *postmanBody    `json:"body,omitempty"`
+	URL    string          `json:"url"`
+}
+
+type postmanHeader struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type postmanBody struct {
+	Mode string `json:"mode"`
+	Raw  string `json:"raw"`
+}
+
+// runExport prints a collection containing reqs. The collection is named
+// after the targets file if there is one, or the service otherwise.
+func runExport(out output, opts Options, reqs []exportRequest) {
+	name := opts.TOpts.ServiceName
+	if targetsFile := opts.BOpts.TargetsFile; targetsFile != "" {
+		name = strings.TrimSuffix(filepath.Base(targetsFile), filepath.Ext(targetsFile))
+	}
+
+	collection, err := exportCollection(opts.Export, name, reqs, newLogger(opts, out).Warnf)
+	if err != nil {
+		out.Fatalf("Failed while exporting requests: %v\n", err)
+	}
+	out.Printf("%s\n", collection)
+}
+
+// exportCollection returns a collection containing the HTTP requests that
+// yab would make for reqs, calling warnf for options that can't be exported.
+func exportCollection(format, name string, reqs []exportRequest, warnf func(string, ...interface{})) ([]byte, error) {
+	if format != exportPostman {
+		return nil, fmt.Errorf("unknown --export format %q, must be one of: postman", format)
+	}
+
+	collection := postmanCollection{
+		Info: postmanInfo{Name: name, Schema: postmanSchema},
+		Item: make([]postmanItem, 0, len(reqs)),
+	}
+	for _, r := range reqs {
+		item, err := newPostmanItem(r)
+		if err == errExportBinary {
+			warnf("skipping %v: %v", r.name, err)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to export %v: %v", r.name, err)
+		}
+		if len(r.tOpts.Resolve) > 0 {
+			warnf("--resolve is not supported by Postman and was not exported for %v", r.name)
+		}
+		collection.Item = append(collection.Item, item)
+	}
+	if len(collection.Item) == 0 {
+		return nil, errExportNothing
+	}
+
+	return json.MarshalIndent(collection, "", "  ")
+}
+
+func newPostmanItem(r exportRequest) (postmanItem, error) {
+	hreq, err := newGeneratedRequest(r.tOpts, r.req)
+	if err != nil {
+		return postmanItem{}, err
+	}
+	if !isPrintable(r.req.Body) {
+		return postmanItem{}, errExportBinary
+	}
+
+	item := postmanItem{
+		Name: r.name,
+		Request: postmanRequest{
+			Method: hreq.Method,
+			URL:    hreq.URL.String(),
+			Header: []postmanHeader{},
+		},
+	}
+	for _, h := range snippetHeaders(hreq) {
+		item.Request.Header = append(item.Request.Header, postmanHeader{Key: h[0], Value: h[1]})
+	}
+	if len(r.req.Body) > 0 {
+		item.Request.Body = &postmanBody{Mode: "raw", Raw: string(r.req.Body)}
+	}
+	return item, nil
+}
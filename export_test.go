@@ -0,0 +1,185 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yarpc/yab/transport"
+)
+
+func TestExportCollection(t *testing.T) {
+	httpOpts := TransportOptions{
+		ServiceName:    "svc",
+		HostPorts:      []string{"http://localhost:8080/rpc"},
+		CallerOverride: "caller",
+		HostHeader:     "virtual",
+	}
+	resolveOpts := httpOpts
+	resolveOpts.Resolve = []resolveOverride{{HostPort: "localhost:8080", Addr: "127.0.0.1:8080"}}
+
+	jsonReq := &transport.Request{
+		Method:  "Svc::method",
+		Body:    []byte(`{"k":"v"}`),
+		Timeout: time.Second,
+	}
+
+	tests := []struct {
+		msg          string
+		format       string
+		reqs         []exportRequest
+		want         string
+		wantWarnings []string
+		wantErr      string
+	}{
+		{
+			msg:    "requests",
+			format: exportPostman,
+			reqs: []exportRequest{
+				{"with body", httpOpts, jsonReq},
+				{"without body", resolveOpts, &transport.Request{Method: "Svc::empty", Timeout: time.Second}},
+			},
+			want: `{
+  "info": {
+    "name": "coll",
+    "schema": "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"
+  },
+  "item": [
+    {
+      "name": "with body",
+      "request": {
+        "method": "POST",
+        "header": [
+          {"key": "Host", "value": "virtual"},
+          {"key": "Context-Ttl-Ms", "value": "1000"},
+          {"key": "Rpc-Caller", "value": "caller"},
+          {"key": "Rpc-Procedure", "value": "Svc::method"},
+          {"key": "Rpc-Service", "value": "svc"}
+        ],
+        "body": {"mode": "raw", "raw": "{\"k\":\"v\"}"},
+        "url": "http://localhost:8080/rpc"
+      }
+    },
+    {
+      "name": "without body",
+      "request": {
+        "method": "POST",
+        "header": [
+          {"key": "Host", "value": "virtual"},
+          {"key": "Context-Ttl-Ms", "value": "1000"},
+          {"key": "Rpc-Caller", "value": "caller"},
+          {"key": "Rpc-Procedure", "value": "Svc::empty"},
+          {"key": "Rpc-Service", "value": "svc"}
+        ],
+        "url": "http://localhost:8080/rpc"
+      }
+    }
+  ]
+}`,
+			wantWarnings: []string{"--resolve is not supported by Postman and was not exported for without body"},
+		},
+		{
+			msg:     "binary body",
+			format:  exportPostman,
+			reqs:    []exportRequest{{"bin", httpOpts, &transport.Request{Body: []byte{0, 1}}}},
+			wantErr: errExportNothing.Error(),
+		},
+		{
+			msg:     "tchannel peer",
+			format:  exportPostman,
+			reqs:    []exportRequest{{"tch", TransportOptions{ServiceName: "svc", HostPorts: []string{"1.1.1.1:1"}}, jsonReq}},
+			wantErr: "failed to export tch: " + errGenerateNotHTTP.Error(),
+		},
+		{
+			msg:     "unknown format",
+			format:  "insomnia",
+			wantErr: `unknown --export format "insomnia"`,
+		},
+	}
+
+	for _, tt := range tests {
+		var warnings []string
+		warnf := func(format string, args ...interface{}) {
+			warnings = append(warnings, fmt.Sprintf(format, args...))
+		}
+
+		got, err := exportCollection(tt.format, "coll", tt.reqs, warnf)
+		if tt.wantErr != "" {
+			if assert.Error(t, err, "%v: expected error", tt.msg) {
+				assert.Contains(t, err.Error(), tt.wantErr, "%v: unexpected error", tt.msg)
+			}
+			continue
+		}
+
+		require.NoError(t, err, "%v: exportCollection failed", tt.msg)
+		assert.JSONEq(t, tt.want, string(got), "%v: unexpected collection", tt.msg)
+		assert.Equal(t, tt.wantWarnings, warnings, "%v: unexpected warnings", tt.msg)
+	}
+}
+
+func TestExportTargets(t *testing.T) {
+	requestFile := writeFile(t, "request", `{"k":"v"}`)
+	defer os.Remove(requestFile)
+
+	targetsFile := writeFile(t, "targets", `
+- method: Simple::foo
+- method: json
+  encoding: json
+  requestFile: `+requestFile+`
+- name: raw echo
+  method: echo
+  encoding: raw
+  request: hello
+`)
+	defer os.Remove(targetsFile)
+
+	var buf, warnings bytes.Buffer
+	out := testOutput{Buffer: &buf, warnings: &warnings, fatalf: t.Errorf}
+	runWithOptions(Options{
+		Export: exportPostman,
+		ROpts:  RequestOptions{ThriftFile: validThrift},
+		TOpts: TransportOptions{
+			ServiceName: "svc",
+			HostPorts:   []string{"http://localhost:8080"},
+		},
+		BOpts: BenchmarkOptions{TargetsFile: targetsFile},
+	}, out)
+
+	var collection postmanCollection
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &collection), "output should be a JSON collection")
+
+	assert.Equal(t, strings.TrimSuffix(filepath.Base(targetsFile), filepath.Ext(targetsFile)), collection.Info.Name, "unexpected name")
+	assert.Equal(t, "Warning: skipping Simple::foo: "+errExportBinary.Error()+"\n", warnings.String(), "Thrift targets should be skipped")
+	require.Len(t, collection.Item, 2, "expected an item per JSON and raw target")
+	assert.Contains(t, collection.Item[0].Request.Header, postmanHeader{Key: "Rpc-Procedure", Value: "json"}, "unexpected procedure")
+	assert.Equal(t, &postmanBody{Mode: "raw", Raw: `{"k":"v"}`}, collection.Item[0].Request.Body, "unexpected body")
+	assert.Equal(t, "raw echo", collection.Item[1].Name, "unexpected name")
+	assert.Equal(t, &postmanBody{Mode: "raw", Raw: "hello\n"}, collection.Item[1].Request.Body, "unexpected body")
+}
@@ -0,0 +1,226 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// etagFile is the name of the file in a URL's cache directory
+// that contains the ETag of the cached contents.
+const etagFile = ".etag"
+
+var errInvalidChecksum = errors.New("checksum must be a SHA-256 hex digest, optionally prefixed with sha256:")
+
+var (
+	// urlClient is used to fetch Thrift files and request bodies from URLs.
+	urlClient = &http.Client{Timeout: 30 * time.Second}
+
+	// urlCacheDir returns the directory that fetched URLs are cached in.
+	urlCacheDir = defaultURLCacheDir
+)
+
+func defaultURLCacheDir() string {
+	if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, "yab")
+	}
+	if home := os.Getenv("HOME"); home != "" {
+		return filepath.Join(home, ".cache", "yab")
+	}
+	return filepath.Join(os.TempDir(), "yab-cache")
+}
+
+// isURL returns whether the given Thrift file or request file is a http(s) URL.
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// fetchURL downloads the contents of the URL to the cache directory, and
+// returns the path of the cached file. Cached contents are revalidated using
+// their ETag, and if a checksum is specified, contents matching the checksum
+// are used without making a request.
+func fetchURL(rawURL, checksum string) (string, error) {
+	want, err := parseChecksum(checksum)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL %q: %v", rawURL, err)
+	}
+
+	urlHash := sha256.Sum256([]byte(rawURL))
+	dir := filepath.Join(urlCacheDir(), hex.EncodeToString(urlHash[:8]))
+
+	// Keep the original file name, so the file is named sensibly in errors.
+	fileName := path.Base(u.Path)
+	if fileName == "." || fileName == "/" {
+		fileName = "contents"
+	}
+	cached := filepath.Join(dir, fileName)
+
+	if want != "" {
+		if got, err := fileChecksum(cached); err == nil && got == want {
+			return cached, nil
+		}
+	}
+
+	if err := downloadURL(rawURL, dir, cached); err != nil {
+		return "", err
+	}
+
+	if want != "" {
+		got, err := fileChecksum(cached)
+		if err != nil {
+			return "", err
+		}
+		if got != want {
+			os.Remove(cached)
+			return "", fmt.Errorf("checksum mismatch for %v: expected sha256:%v, got sha256:%v", rawURL, want, got)
+		}
+	}
+
+	return cached, nil
+}
+
+// downloadURL fetches rawURL to the cached path, unless the cached
+// contents are still current.
+func downloadURL(rawURL, dir, cached string) error {
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q: %v", rawURL, err)
+	}
+
+	if _, err := os.Stat(cached); err == nil {
+		if etag, err := ioutil.ReadFile(filepath.Join(dir, etagFile)); err == nil {
+			req.Header.Set("If-None-Match", string(etag))
+		}
+	}
+
+	res, err := urlClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %v: %v", rawURL, err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusNotModified:
+		return nil
+	case http.StatusOK:
+	default:
+		return fmt.Errorf("failed to fetch %v: got status %v", rawURL, res.Status)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %v", err)
+	}
+
+	// Write to a temporary file first, so a failed download does not
+	// leave partial contents in the cache.
+	f, err := ioutil.TempFile(dir, ".download")
+	if err != nil {
+		return fmt.Errorf("failed to create cache file: %v", err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = io.Copy(f, res.Body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch %v: %v", rawURL, err)
+	}
+
+	if err := os.Rename(f.Name(), cached); err != nil {
+		return fmt.Errorf("failed to write cache file: %v", err)
+	}
+
+	etagPath := filepath.Join(dir, etagFile)
+	if etag := res.Header.Get("ETag"); etag != "" {
+		return ioutil.WriteFile(etagPath, []byte(etag), 0644)
+	}
+	os.Remove(etagPath)
+	return nil
+}
+
+// parseChecksum returns the lowercase hex SHA-256 digest in checksum,
+// which may be prefixed with "sha256:".
+func parseChecksum(checksum string) (string, error) {
+	if checksum == "" {
+		return "", nil
+	}
+
+	digest := strings.ToLower(strings.TrimPrefix(checksum, "sha256:"))
+	if bs, err := hex.DecodeString(digest); err != nil || len(bs) != sha256.Size {
+		return "", errInvalidChecksum
+	}
+	return digest, nil
+}
+
+func fileChecksum(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// localFile returns a local path for the given Thrift or request file,
+// fetching it if it is a URL. If a checksum is specified, the contents
+// must match the checksum.
+func localFile(file, checksum string) (string, error) {
+	if isURL(file) {
+		return fetchURL(file, checksum)
+	}
+
+	want, err := parseChecksum(checksum)
+	if err != nil || want == "" {
+		return file, err
+	}
+
+	got, err := fileChecksum(file)
+	if err != nil {
+		return "", err
+	}
+	if got != want {
+		return "", fmt.Errorf("checksum mismatch for %v: expected sha256:%v, got sha256:%v", file, want, got)
+	}
+	return file, nil
+}
@@ -0,0 +1,183 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel-go/testutils"
+)
+
+// helloChecksum is the SHA-256 digest of "hello".
+const helloChecksum = "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+func withURLCacheDir(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "yab-cache")
+	require.NoError(t, err, "TempDir failed")
+
+	orig := urlCacheDir
+	urlCacheDir = func() string { return dir }
+	return func() {
+		urlCacheDir = orig
+		os.RemoveAll(dir)
+	}
+}
+
+// contentServer serves the given contents with an ETag, and counts the
+// number of requests and the number of full responses.
+func contentServer(contents string) (server *httptest.Server, requests, downloads *int32) {
+	requests, downloads = new(int32), new(int32)
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		atomic.AddInt32(downloads, 1)
+		w.Write([]byte(contents))
+	}))
+	return server, requests, downloads
+}
+
+func TestFetchURLCache(t *testing.T) {
+	defer withURLCacheDir(t)()
+
+	server, requests, downloads := contentServer("hello")
+	defer server.Close()
+
+	url := server.URL + "/dir/file.thrift"
+	path1, err := fetchURL(url, "")
+	require.NoError(t, err, "fetchURL failed")
+	assert.Equal(t, "file.thrift", filepath.Base(path1), "cached file should keep the file name")
+
+	path2, err := fetchURL(url, "")
+	require.NoError(t, err, "fetchURL failed")
+	assert.Equal(t, path1, path2, "fetchURL should use the same cached file")
+	assert.EqualValues(t, 2, atomic.LoadInt32(requests), "cached file should be revalidated")
+	assert.EqualValues(t, 1, atomic.LoadInt32(downloads), "cached file should not be downloaded again")
+
+	contents, err := ioutil.ReadFile(path2)
+	require.NoError(t, err, "ReadFile failed")
+	assert.Equal(t, "hello", string(contents), "cached contents mismatch")
+
+	// With a checksum, cached contents are used without any requests.
+	_, err = fetchURL(url, helloChecksum)
+	require.NoError(t, err, "fetchURL with checksum failed")
+	assert.EqualValues(t, 2, atomic.LoadInt32(requests), "cached file matching checksum should not be revalidated")
+}
+
+func TestFetchURLErrors(t *testing.T) {
+	defer withURLCacheDir(t)()
+
+	server, _, _ := contentServer("hello")
+	defer server.Close()
+
+	tests := []struct {
+		msg      string
+		url      string
+		checksum string
+		errMsg   string
+	}{
+		{
+			msg:    "missing file",
+			url:    server.URL + "/missing",
+			errMsg: "404",
+		},
+		{
+			msg:      "checksum mismatch",
+			url:      server.URL + "/file",
+			checksum: "sha256:" + strings.Repeat("0", 64),
+			errMsg:   "checksum mismatch",
+		},
+		{
+			msg:      "invalid checksum",
+			url:      server.URL + "/file",
+			checksum: "md5:abc",
+			errMsg:   errInvalidChecksum.Error(),
+		},
+		{
+			msg:    "server not listening",
+			url:    "http://" + testutils.GetClosedHostPort(t) + "/file",
+			errMsg: "failed to fetch",
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := fetchURL(tt.url, tt.checksum)
+		if assert.Error(t, err, "%v: expected error", tt.msg) {
+			assert.Contains(t, err.Error(), tt.errMsg, "%v: unexpected error", tt.msg)
+		}
+	}
+}
+
+func TestRequestAndThriftFromURL(t *testing.T) {
+	defer withURLCacheDir(t)()
+
+	thriftServer := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer thriftServer.Close()
+
+	serializer, err := NewSerializer(RequestOptions{
+		ThriftFile: thriftServer.URL + "/simple.thrift",
+		MethodName: fooMethod,
+	})
+	require.NoError(t, err, "NewSerializer with Thrift URL failed")
+	assert.NotNil(t, serializer, "expected serializer")
+
+	got, err := getRequestInput("", thriftServer.URL+"/valid.json", "")
+	require.NoError(t, err, "getRequestInput with URL failed")
+	assert.Equal(t, mustRead("testdata/valid.json"), got, "request body mismatch")
+}
+
+func TestInlineURLsNotFetched(t *testing.T) {
+	defer withURLCacheDir(t)()
+
+	server, requests, _ := contentServer("k: v")
+	defer server.Close()
+
+	// Inline bodies that are URLs are sent as-is.
+	got, err := getRequestInput(server.URL+"/body", "", "")
+	require.NoError(t, err, "getRequestInput failed")
+	assert.Equal(t, []byte(server.URL+"/body"), got, "inline URL should be the body")
+
+	// Headers are never fetched from URLs.
+	_, err = getHeaders(server.URL+"/headers", "")
+	assert.Error(t, err, "getHeaders with inline URL should fail to parse")
+	_, err = getHeaders("", server.URL+"/headers")
+	assert.Error(t, err, "getHeaders with URL file should fail to open")
+
+	assert.EqualValues(t, 0, atomic.LoadInt32(requests), "no requests should be made")
+}
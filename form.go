@@ -0,0 +1,165 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/yarpc/yab/encoding"
+)
+
+var (
+	errFormWithBody = errors.New("cannot use --form with --request or --file")
+	errFormEncoding = errors.New("--form can only be used with the raw encoding")
+)
+
+// quoteEscaper escapes quoted Content-Disposition parameters, like mime/multipart.
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// formField is a --form field, which is either a value or a file to upload.
+type formField struct {
+	name  string
+	value string
+	file  string
+}
+
+func parseFormFields(fields []string) ([]formField, error) {
+	parsed := make([]formField, 0, len(fields))
+	for _, f := range fields {
+		parts := strings.SplitN(f, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid form field %q, expected name=value or name=@path", f)
+		}
+
+		field := formField{name: parts[0]}
+		if strings.HasPrefix(parts[1], "@") {
+			field.file = parts[1][1:]
+		} else {
+			field.value = parts[1]
+		}
+		parsed = append(parsed, field)
+	}
+	return parsed, nil
+}
+
+// formBody returns the body and Content-Type for the given form fields.
+// Forms are urlencoded, unless multipart is set or a field uploads a file.
+func formBody(fields []formField, multipart bool) ([]byte, string, error) {
+	for _, f := range fields {
+		if f.file != "" {
+			multipart = true
+		}
+	}
+	if multipart {
+		return multipartBody(fields)
+	}
+
+	values := make(url.Values)
+	for _, f := range fields {
+		values.Add(f.name, f.value)
+	}
+	return []byte(values.Encode()), "application/x-www-form-urlencoded", nil
+}
+
+func multipartBody(fields []formField) ([]byte, string, error) {
+	buf := &bytes.Buffer{}
+	w := multipart.NewWriter(buf)
+	for _, f := range fields {
+		if f.file == "" {
+			if err := w.WriteField(f.name, f.value); err != nil {
+				return nil, "", err
+			}
+			continue
+		}
+
+		contents, err := ioutil.ReadFile(f.file)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read form file: %v", err)
+		}
+
+		contentType := mime.TypeByExtension(filepath.Ext(f.file))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+			quoteEscaper.Replace(f.name), quoteEscaper.Replace(filepath.Base(f.file))))
+		header.Set("Content-Type", contentType)
+		part, err := w.CreatePart(header)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := part.Write(contents); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), w.FormDataContentType(), nil
+}
+
+// applyForm replaces the request body with the --form fields, and sets the
+// Content-Type header unless one was specified.
+func applyForm(opts *RequestOptions, reqInput []byte, headers map[string]string) ([]byte, map[string]string, error) {
+	if len(reqInput) > 0 {
+		return nil, nil, errFormWithBody
+	}
+
+	switch opts.Encoding {
+	case encoding.UnspecifiedEncoding:
+		opts.Encoding = encoding.Raw
+	case encoding.Raw:
+	default:
+		return nil, nil, errFormEncoding
+	}
+
+	fields, err := parseFormFields(opts.Form)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body, contentType, err := formBody(fields, opts.FormMultipart)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for k := range headers {
+		if strings.EqualFold(k, "Content-Type") {
+			return body, headers, nil
+		}
+	}
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+	headers["Content-Type"] = contentType
+	return body, headers, nil
+}
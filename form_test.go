@@ -0,0 +1,222 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yarpc/yab/encoding"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFormFields(t *testing.T) {
+	tests := []struct {
+		fields  []string
+		want    []formField
+		wantErr string
+	}{
+		{
+			fields: []string{"a=1", "b=", "c=x=y", "d=@file.txt"},
+			want: []formField{
+				{name: "a", value: "1"},
+				{name: "b"},
+				{name: "c", value: "x=y"},
+				{name: "d", file: "file.txt"},
+			},
+		},
+		{
+			fields:  []string{"a"},
+			wantErr: `invalid form field "a", expected name=value or name=@path`,
+		},
+		{
+			fields:  []string{"=1"},
+			wantErr: `invalid form field "=1"`,
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := parseFormFields(tt.fields)
+		if tt.wantErr != "" {
+			if assert.Error(t, err, "%v should fail", tt.fields) {
+				assert.Contains(t, err.Error(), tt.wantErr, "Unexpected error for %v", tt.fields)
+			}
+			continue
+		}
+
+		require.NoError(t, err, "%v failed", tt.fields)
+		assert.Equal(t, tt.want, got, "Unexpected fields for %v", tt.fields)
+	}
+}
+
+func TestFormBodyURLEncoded(t *testing.T) {
+	body, contentType, err := formBody([]formField{
+		{name: "user", value: "a b"},
+		{name: "tag", value: "x&y"},
+		{name: "tag", value: "z"},
+	}, false /* multipart */)
+	require.NoError(t, err, "formBody failed")
+	assert.Equal(t, "application/x-www-form-urlencoded", contentType, "Content-Type mismatch")
+	assert.Equal(t, "tag=x%26y&tag=z&user=a+b", string(body), "Body mismatch")
+}
+
+func TestFormBodyMultipart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yab-form")
+	require.NoError(t, err, "Failed to create temp dir")
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "upload.json")
+	require.NoError(t, ioutil.WriteFile(file, []byte(`{"k": "v"}`), 0644), "Failed to write file")
+
+	tests := []struct {
+		msg       string
+		fields    []formField
+		multipart bool
+	}{
+		{
+			msg:       "forced multipart",
+			fields:    []formField{{name: "user", value: "a"}},
+			multipart: true,
+		},
+		{
+			msg:    "file upload",
+			fields: []formField{{name: "user", value: "a"}, {name: "doc", file: file}},
+		},
+	}
+
+	for _, tt := range tests {
+		body, contentType, err := formBody(tt.fields, tt.multipart)
+		require.NoError(t, err, "%v: formBody failed", tt.msg)
+
+		mediaType, params, err := mime.ParseMediaType(contentType)
+		require.NoError(t, err, "%v: invalid Content-Type %q", tt.msg, contentType)
+		assert.Equal(t, "multipart/form-data", mediaType, "%v: unexpected media type", tt.msg)
+
+		form, err := multipart.NewReader(bytes.NewReader(body), params["boundary"]).ReadForm(1 << 20)
+		require.NoError(t, err, "%v: failed to read form", tt.msg)
+		assert.Equal(t, []string{"a"}, form.Value["user"], "%v: unexpected values", tt.msg)
+
+		for _, f := range tt.fields {
+			if f.file == "" {
+				continue
+			}
+			require.Len(t, form.File["doc"], 1, "%v: expected uploaded file", tt.msg)
+			upload := form.File["doc"][0]
+			assert.Equal(t, "upload.json", upload.Filename, "%v: unexpected filename", tt.msg)
+			assert.Equal(t, "application/json", upload.Header.Get("Content-Type"), "%v: unexpected file Content-Type", tt.msg)
+
+			r, err := upload.Open()
+			require.NoError(t, err, "%v: failed to open uploaded file", tt.msg)
+			contents, err := ioutil.ReadAll(r)
+			require.NoError(t, err, "%v: failed to read uploaded file", tt.msg)
+			assert.Equal(t, `{"k": "v"}`, string(contents), "%v: unexpected file contents", tt.msg)
+		}
+	}
+}
+
+func TestApplyForm(t *testing.T) {
+	tests := []struct {
+		msg          string
+		opts         RequestOptions
+		reqInput     []byte
+		headers      map[string]string
+		wantHeaders  map[string]string
+		wantEncoding encoding.Encoding
+		wantErr      string
+	}{
+		{
+			msg:          "defaults to raw encoding",
+			opts:         RequestOptions{Form: []string{"a=1"}},
+			wantHeaders:  map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+			wantEncoding: encoding.Raw,
+		},
+		{
+			msg:          "keeps specified Content-Type",
+			opts:         RequestOptions{Form: []string{"a=1"}, Encoding: encoding.Raw},
+			headers:      map[string]string{"content-type": "text/plain"},
+			wantHeaders:  map[string]string{"content-type": "text/plain"},
+			wantEncoding: encoding.Raw,
+		},
+		{
+			msg:      "request body",
+			opts:     RequestOptions{Form: []string{"a=1"}},
+			reqInput: []byte("{}"),
+			wantErr:  errFormWithBody.Error(),
+		},
+		{
+			msg:     "JSON encoding",
+			opts:    RequestOptions{Form: []string{"a=1"}, Encoding: encoding.JSON},
+			wantErr: errFormEncoding.Error(),
+		},
+		{
+			msg:     "missing file",
+			opts:    RequestOptions{Form: []string{"a=@/does/not/exist"}},
+			wantErr: "failed to read form file",
+		},
+	}
+
+	for _, tt := range tests {
+		body, headers, err := applyForm(&tt.opts, tt.reqInput, tt.headers)
+		if tt.wantErr != "" {
+			if assert.Error(t, err, "%v: expected error", tt.msg) {
+				assert.Contains(t, err.Error(), tt.wantErr, "%v: unexpected error", tt.msg)
+			}
+			continue
+		}
+
+		require.NoError(t, err, "%v: applyForm failed", tt.msg)
+		assert.Equal(t, "a=1", string(body), "%v: unexpected body", tt.msg)
+		assert.Equal(t, tt.wantHeaders, headers, "%v: unexpected headers", tt.msg)
+		assert.Equal(t, tt.wantEncoding, tt.opts.Encoding, "%v: unexpected encoding", tt.msg)
+	}
+}
+
+func TestFormRequest(t *testing.T) {
+	gotValues := make(chan map[string][]string, 1)
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("failed to parse form: %v", err)
+		}
+		gotValues <- r.MultipartForm.Value
+	}))
+	defer svr.Close()
+
+	_, out := getOutput(t)
+	runWithOptions(Options{
+		ROpts: RequestOptions{
+			MethodName:    "upload",
+			Form:          []string{"user=a", "user=b", "id=1"},
+			FormMultipart: true,
+		},
+		TOpts: TransportOptions{ServiceName: "svc", HostPorts: []string{svr.URL}},
+	}, out)
+
+	assert.Equal(t, map[string][]string{"user": {"a", "b"}, "id": {"1"}}, <-gotValues, "Unexpected form values")
+}
@@ -0,0 +1,256 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yarpc/yab/sorted"
+	"github.com/yarpc/yab/transport"
+)
+
+var errGenerateNotHTTP = errors.New("--generate and --export are only supported for HTTP and HTTPS peers")
+
+// The list of supported --generate formats.
+const (
+	generateCurl   = "curl"
+	generateGo     = "go"
+	generatePython = "python"
+)
+
+// generateSnippet returns a curl command or minimal client program that
+// makes the same HTTP call that yab would make for req.
+func generateSnippet(format string, opts TransportOptions, req *transport.Request) (string, error) {
+	hreq, err := newGeneratedRequest(opts, req)
+	if err != nil {
+		return "", err
+	}
+
+	switch format {
+	case generateCurl:
+		return curlSnippet(hreq, req.Body, opts.Resolve), nil
+	case generateGo:
+		return goSnippet(hreq, req.Body), nil
+	case generatePython:
+		return pythonSnippet(hreq, req.Body), nil
+	}
+	return "", fmt.Errorf("unknown --generate format %q, must be one of: curl, go, python", format)
+}
+
+// newGeneratedRequest returns the HTTP request that yab would make to the
+// first peer for req.
+func newGeneratedRequest(opts TransportOptions, req *transport.Request) (*http.Request, error) {
+	if opts.ServiceName == "" {
+		return nil, errServiceRequired
+	}
+
+	hostPorts, err := getHostPorts(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	protocol, err := ensureSameProtocol(hostPorts)
+	if err != nil {
+		return nil, err
+	}
+	if !isHTTP(protocol) {
+		return nil, errGenerateNotHTTP
+	}
+
+	sourceService, err := getSourceService(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	hopts := transport.HTTPOptions{
+		SourceService: sourceService,
+		TargetService: opts.ServiceName,
+		Host:          opts.HostHeader,
+
+		PreserveHeaderCase: opts.PreserveHeaderCase,
+		ExpectContinue:     opts.ExpectContinue,
+		Chunked:            opts.Chunked,
+	}
+	return transport.NewHTTPRequest(hopts, hostPorts[0], req, req.Timeout)
+}
+
+// snippetHeaders returns the request's headers in a stable order,
+// including the Host header if it was overridden. Any resolved secrets
+// are replaced by their references.
+func snippetHeaders(req *http.Request) [][2]string {
+	var headers [][2]string
+	if req.Host != "" {
+		headers = append(headers, [2]string{"Host", req.Host})
+	}
+	for _, k := range sorted.MapKeys(req.Header) {
+		for _, v := range req.Header[k] {
+			headers = append(headers, [2]string{k, secrets.redact(v)})
+		}
+	}
+	return headers
+}
+
+// isPrintable returns whether the body can be written as text, rather
+// than needing to be encoded.
+func isPrintable(body []byte) bool {
+	if !utf8.Valid(body) {
+		return false
+	}
+	for _, r := range string(body) {
+		if !unicode.IsPrint(r) && r != '\n' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// shellQuote quotes s so it's passed as a single argument by POSIX shells.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func curlSnippet(req *http.Request, body []byte, resolve []resolveOverride) string {
+	// Each line is a single option and its value.
+	lines := []string{"curl -X " + req.Method + " " + shellQuote(req.URL.String())}
+	for _, r := range resolve {
+		// curl expects host:port:addr, where IPv6 addresses are bracketed.
+		addr, _, err := net.SplitHostPort(r.Addr)
+		if err != nil {
+			addr = r.Addr
+		}
+		if strings.Contains(addr, ":") {
+			addr = "[" + addr + "]"
+		}
+		lines = append(lines, "--resolve "+shellQuote(r.HostPort+":"+addr))
+	}
+	for _, h := range snippetHeaders(req) {
+		lines = append(lines, "-H "+shellQuote(h[0]+": "+h[1]))
+	}
+	if len(req.TransferEncoding) > 0 {
+		// curl uploads using chunked encoding when the header is set.
+		lines = append(lines, "-H "+shellQuote("Transfer-Encoding: "+strings.Join(req.TransferEncoding, ", ")))
+	}
+
+	if isPrintable(body) {
+		lines = append(lines, "--data-binary "+shellQuote(string(body)))
+	} else {
+		// Binary bodies can't be passed as an argument, so pipe them in.
+		lines[0] = fmt.Sprintf("echo %v | base64 --decode | ", base64.StdEncoding.EncodeToString(body)) + lines[0]
+		lines = append(lines, "--data-binary @-")
+	}
+	return strings.Join(lines, " \\\n  ") + "\n"
+}
+
+func goSnippet(req *http.Request, body []byte) string {
+	buf := &bytes.Buffer{}
+	buf.WriteString(`package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+func main() {
+`)
+	fmt.Fprintf(buf, "\tbody := []byte(%q)\n", body)
+	fmt.Fprintf(buf, "\treq, err := http.NewRequest(%q, %q, bytes.NewReader(body))\n", req.Method, req.URL.String())
+	buf.WriteString("\tif err != nil {\n\t\tpanic(err)\n\t}\n")
+	if req.Host != "" {
+		fmt.Fprintf(buf, "\treq.Host = %q\n", req.Host)
+	}
+	for _, k := range sorted.MapKeys(req.Header) {
+		for _, v := range req.Header[k] {
+			if k != http.CanonicalHeaderKey(k) {
+				// Header.Add would canonicalize the name, so set it directly.
+				fmt.Fprintf(buf, "\treq.Header[%q] = append(req.Header[%q], %q)\n", k, k, v)
+				continue
+			}
+			fmt.Fprintf(buf, "\treq.Header.Add(%q, %q)\n", k, v)
+		}
+	}
+	buf.WriteString(`
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		panic(err)
+	}
+	defer res.Body.Close()
+
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(res.Status)
+	fmt.Println(string(resBody))
+}
+`)
+	return buf.String()
+}
+
+func pythonSnippet(req *http.Request, body []byte) string {
+	buf := &bytes.Buffer{}
+	buf.WriteString("import urllib.request\n\n")
+	fmt.Fprintf(buf, "body = %v\n", pythonBytes(body))
+	buf.WriteString("headers = {\n")
+	for _, h := range snippetHeaders(req) {
+		fmt.Fprintf(buf, "    %v: %v,\n", strconv.QuoteToASCII(h[0]), strconv.QuoteToASCII(h[1]))
+	}
+	buf.WriteString("}\n\n")
+	fmt.Fprintf(buf, "req = urllib.request.Request(%v, data=body, headers=headers, method=%v)\n",
+		strconv.QuoteToASCII(req.URL.String()), strconv.QuoteToASCII(req.Method))
+	buf.WriteString(`with urllib.request.urlopen(req) as res:
+    print(res.status, res.reason)
+    print(res.read().decode("utf-8", "replace"))
+`)
+	return buf.String()
+}
+
+// pythonBytes returns a Python bytes literal for b. Python bytes literals
+// only allow ASCII characters, so all other bytes are escaped.
+func pythonBytes(b []byte) string {
+	buf := &bytes.Buffer{}
+	buf.WriteString(`b"`)
+	for _, c := range b {
+		switch {
+		case c == '"' || c == '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case c == '\n':
+			buf.WriteString(`\n`)
+		case c >= 0x20 && c < 0x7f:
+			buf.WriteByte(c)
+		default:
+			fmt.Fprintf(buf, `\x%02x`, c)
+		}
+	}
+	buf.WriteString(`"`)
+	return buf.String()
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yarpc/yab/transport"
+)
+
+func TestGenerateSnippet(t *testing.T) {
+	httpOpts := TransportOptions{
+		ServiceName:    "svc",
+		HostPorts:      []string{"http://example.com:8080/rpc"},
+		CallerOverride: "caller",
+	}
+	resolveOpts := httpOpts
+	resolveOpts.HostHeader = "virtual"
+	var override resolveOverride
+	require.NoError(t, override.UnmarshalFlag("example.com:8080:::1"), "UnmarshalFlag failed")
+	resolveOpts.Resolve = []resolveOverride{override}
+	preserveOpts := httpOpts
+	preserveOpts.PreserveHeaderCase = true
+	uploadOpts := httpOpts
+	uploadOpts.ExpectContinue = true
+	uploadOpts.Chunked = true
+
+	jsonReq := &transport.Request{
+		Method:  "Svc::method",
+		Body:    []byte(`{"it's": "ok"}`),
+		Headers: map[string]string{"k": "v"},
+		Timeout: 2 * time.Second,
+	}
+	binaryReq := &transport.Request{
+		Method:  "Svc::method",
+		Body:    []byte{0, 1, '"'},
+		Timeout: time.Second,
+	}
+
+	tests := []struct {
+		msg     string
+		format  string
+		opts    TransportOptions
+		req     *transport.Request
+		want    []string
+		wantErr string
+	}{
+		{
+			msg:    "curl with text body",
+			format: generateCurl,
+			opts:   httpOpts,
+			req:    jsonReq,
+			want: []string{
+				"curl -X POST 'http://example.com:8080/rpc' \\\n",
+				`-H 'Context-Ttl-Ms: 2000'`,
+				`-H 'Rpc-Caller: caller'`,
+				`-H 'Rpc-Procedure: Svc::method'`,
+				`-H 'Rpc-Service: svc'`,
+				`-H 'K: v'`,
+				`--data-binary '{"it'\''s": "ok"}'`,
+			},
+		},
+		{
+			msg:    "curl with binary body and overrides",
+			format: generateCurl,
+			opts:   resolveOpts,
+			req:    binaryReq,
+			want: []string{
+				"echo AAEi | base64 --decode | curl",
+				`--resolve 'example.com:8080:[::1]'`,
+				`-H 'Host: virtual'`,
+				"--data-binary @-\n",
+			},
+		},
+		{
+			msg:    "go",
+			format: generateGo,
+			opts:   resolveOpts,
+			req:    binaryReq,
+			want: []string{
+				"package main",
+				`body := []byte("\x00\x01\"")`,
+				`http.NewRequest("POST", "http://example.com:8080/rpc", bytes.NewReader(body))`,
+				`req.Host = "virtual"`,
+				`req.Header.Add("Rpc-Service", "svc")`,
+			},
+		},
+		{
+			msg:    "go with preserved header case",
+			format: generateGo,
+			opts:   preserveOpts,
+			req:    jsonReq,
+			want: []string{
+				`req.Header["k"] = append(req.Header["k"], "v")`,
+				`req.Header.Add("Rpc-Service", "svc")`,
+			},
+		},
+		{
+			msg:    "curl with preserved header case",
+			format: generateCurl,
+			opts:   preserveOpts,
+			req:    jsonReq,
+			want:   []string{`-H 'k: v'`},
+		},
+		{
+			msg:    "curl with expect continue and chunked",
+			format: generateCurl,
+			opts:   uploadOpts,
+			req:    jsonReq,
+			want: []string{
+				`-H 'Expect: 100-continue'`,
+				`-H 'Transfer-Encoding: chunked'`,
+			},
+		},
+		{
+			msg:    "python",
+			format: generatePython,
+			opts:   resolveOpts,
+			req:    binaryReq,
+			want: []string{
+				"import urllib.request",
+				`body = b"\x00\x01\""`,
+				`"Host": "virtual",`,
+				`"Rpc-Caller": "caller",`,
+				`urllib.request.Request("http://example.com:8080/rpc", data=body, headers=headers, method="POST")`,
+			},
+		},
+		{
+			msg:     "tchannel peers",
+			format:  generateCurl,
+			opts:    TransportOptions{ServiceName: "svc", HostPorts: []string{"1.1.1.1:1"}},
+			req:     jsonReq,
+			wantErr: errGenerateNotHTTP.Error(),
+		},
+		{
+			msg:     "redis peers",
+			format:  generateCurl,
+			opts:    TransportOptions{ServiceName: "svc", HostPorts: []string{"redis://localhost:6379"}},
+			req:     jsonReq,
+			wantErr: errGenerateNotHTTP.Error(),
+		},
+		{
+			msg:     "no service",
+			format:  generateCurl,
+			opts:    TransportOptions{HostPorts: []string{"http://example.com"}},
+			req:     jsonReq,
+			wantErr: errServiceRequired.Error(),
+		},
+		{
+			msg:     "unknown format",
+			format:  "ruby",
+			opts:    httpOpts,
+			req:     jsonReq,
+			wantErr: `unknown --generate format "ruby"`,
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := generateSnippet(tt.format, tt.opts, tt.req)
+		if tt.wantErr != "" {
+			if assert.Error(t, err, "%v: expected error", tt.msg) {
+				assert.Contains(t, err.Error(), tt.wantErr, "%v: unexpected error", tt.msg)
+			}
+			continue
+		}
+
+		require.NoError(t, err, "%v: generateSnippet failed", tt.msg)
+		for _, want := range tt.want {
+			assert.Contains(t, got, want, "%v: missing output", tt.msg)
+		}
+	}
+}
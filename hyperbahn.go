@@ -0,0 +1,147 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/yarpc/yab/encoding"
+)
+
+// hyperbahnService is the service name that Hyperbahn routers handle.
+const hyperbahnService = "hyperbahn"
+
+var (
+	errDiscoverTChannel     = errors.New("--discover and --compare-direct require TChannel router peers")
+	errDiscoverCompare      = errors.New("cannot use --discover with --compare-direct")
+	errDiscoverResponse     = errors.New("unexpected Hyperbahn::discover response")
+	errCompareDirectNoBench = errors.New("--compare-direct benchmarks the routed and direct peers, so it requires --maxDuration")
+	errNoDiscoveredPeers    = errors.New("Hyperbahn::discover returned no peers")
+)
+
+// discoverPeers returns the instances of the service that the Hyperbahn
+// routers in opts route to, by calling Hyperbahn::discover.
+func discoverPeers(opts TransportOptions, timeout time.Duration) ([]string, error) {
+	hostPorts, err := getHostPorts(opts)
+	if err != nil {
+		return nil, err
+	}
+	if protocol, err := ensureSameProtocol(hostPorts); err != nil || protocol != "tchannel" {
+		return nil, errDiscoverTChannel
+	}
+
+	routerOpts := opts
+	routerOpts.ServiceName = hyperbahnService
+	t, err := getTransport(routerOpts, encoding.Thrift)
+	if err != nil {
+		return nil, err
+	}
+
+	serializer := encoding.NewHyperbahnDiscover()
+	query, err := json.Marshal(map[string]interface{}{
+		"query": map[string]string{"serviceName": opts.ServiceName},
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := serializer.Request(query)
+	if err != nil {
+		return nil, err
+	}
+	req.Timeout = timeout
+
+	response, err := makeRequest(t, req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := serializer.Response(response)
+	if err != nil {
+		return nil, err
+	}
+	return parseDiscoverResult(body)
+}
+
+// parseDiscoverResult returns the host:ports of the peers in a
+// Hyperbahn::discover response.
+func parseDiscoverResult(body interface{}) ([]string, error) {
+	fields, ok := body.(map[string]interface{})
+	if !ok {
+		return nil, errDiscoverResponse
+	}
+	for _, exception := range []string{"noPeersAvailable", "invalidServiceName"} {
+		if ex, ok := fields[exception].(map[string]interface{}); ok {
+			return nil, fmt.Errorf("Hyperbahn::discover failed: %v", ex["message"])
+		}
+	}
+
+	result, ok := fields["result"].(map[string]interface{})
+	if !ok {
+		return nil, errDiscoverResponse
+	}
+	peers, ok := result["peers"].([]interface{})
+	if !ok {
+		return nil, errDiscoverResponse
+	}
+
+	hostPorts := make([]string, 0, len(peers))
+	for _, p := range peers {
+		peer, ok := p.(map[string]interface{})
+		if !ok {
+			return nil, errDiscoverResponse
+		}
+		ip, ok := peer["ip"].(map[string]interface{})
+		if !ok {
+			return nil, errDiscoverResponse
+		}
+		ipv4, ok := ip["ipv4"].(int32)
+		port, portOK := peer["port"].(int32)
+		if !ok || !portOK {
+			return nil, errDiscoverResponse
+		}
+
+		addr := net.IPv4(byte(ipv4>>24), byte(ipv4>>16), byte(ipv4>>8), byte(ipv4))
+		hostPorts = append(hostPorts, net.JoinHostPort(addr.String(), strconv.Itoa(int(port))))
+	}
+	if len(hostPorts) == 0 {
+		return nil, errNoDiscoveredPeers
+	}
+	return hostPorts, nil
+}
+
+// directTransportOptions returns opts with the routers replaced by the
+// instances of the service that they route to.
+func directTransportOptions(opts TransportOptions, timeout time.Duration, logger *logger) (TransportOptions, error) {
+	peers, err := discoverPeers(opts, timeout)
+	if err != nil {
+		return opts, err
+	}
+
+	logger.Infof("discovered %v instances of %v: %v", len(peers), opts.ServiceName, peers)
+	opts.HostPorts = peers
+	opts.HostPortFile = ""
+	opts.PeerFilters = nil
+	return opts, nil
+}
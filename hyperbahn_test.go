@@ -0,0 +1,263 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thriftrw/thriftrw-go/protocol"
+	"github.com/thriftrw/thriftrw-go/wire"
+	"github.com/uber/tchannel-go/raw"
+	"github.com/uber/tchannel-go/testutils"
+	"golang.org/x/net/context"
+)
+
+// rawHandler adapts a handler to raw.Handler, so it can be registered for
+// services other than the channel's own service.
+type rawHandler handler
+
+func (h rawHandler) Handle(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+	return h(ctx, args)
+}
+
+func (h rawHandler) OnError(ctx context.Context, err error) {}
+
+// discoverResult returns a Hyperbahn::discover result for the given host:ports.
+func discoverResult(t *testing.T, hostPorts ...string) []byte {
+	var peers []wire.Value
+	for _, hp := range hostPorts {
+		host, portStr, err := net.SplitHostPort(hp)
+		require.NoError(t, err, "Invalid host:port %v", hp)
+		port, err := strconv.Atoi(portStr)
+		require.NoError(t, err, "Invalid port %v", portStr)
+		ip := net.ParseIP(host).To4()
+		ipv4 := int32(ip[0])<<24 | int32(ip[1])<<16 | int32(ip[2])<<8 | int32(ip[3])
+
+		peers = append(peers, wire.NewValueStruct(wire.Struct{Fields: []wire.Field{
+			{ID: 1, Value: wire.NewValueStruct(wire.Struct{Fields: []wire.Field{
+				{ID: 1, Value: wire.NewValueI32(ipv4)},
+			}})},
+			{ID: 2, Value: wire.NewValueI32(int32(port))},
+		}}))
+	}
+
+	result := wire.NewValueStruct(wire.Struct{Fields: []wire.Field{
+		{ID: 0, Value: wire.NewValueStruct(wire.Struct{Fields: []wire.Field{
+			{ID: 1, Value: wire.NewValueList(wire.List{
+				ValueType: wire.TStruct,
+				Size:      len(peers),
+				Items:     wire.ValueListFromSlice(peers),
+			})},
+		}})},
+	}})
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, protocol.Binary.Encode(result, buf), "Failed to encode result")
+	return buf.Bytes()
+}
+
+func TestParseDiscoverResult(t *testing.T) {
+	peer := map[string]interface{}{
+		"ip":   map[string]interface{}{"ipv4": int32(0x0a000102)},
+		"port": int32(4040),
+	}
+
+	tests := []struct {
+		msg     string
+		body    interface{}
+		want    []string
+		wantErr string
+	}{
+		{
+			msg:  "peers",
+			body: map[string]interface{}{"result": map[string]interface{}{"peers": []interface{}{peer}}},
+			want: []string{"10.0.1.2:4040"},
+		},
+		{
+			msg:     "no peers",
+			body:    map[string]interface{}{"result": map[string]interface{}{"peers": []interface{}{}}},
+			wantErr: errNoDiscoveredPeers.Error(),
+		},
+		{
+			msg: "exception",
+			body: map[string]interface{}{"noPeersAvailable": map[string]interface{}{
+				"message":     "no peers for foo",
+				"serviceName": "foo",
+			}},
+			wantErr: "Hyperbahn::discover failed: no peers for foo",
+		},
+		{
+			msg:     "missing result",
+			body:    map[string]interface{}{},
+			wantErr: errDiscoverResponse.Error(),
+		},
+		{
+			msg: "invalid peer",
+			body: map[string]interface{}{"result": map[string]interface{}{"peers": []interface{}{
+				map[string]interface{}{"port": int32(1)},
+			}}},
+			wantErr: errDiscoverResponse.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := parseDiscoverResult(tt.body)
+		if tt.wantErr != "" {
+			if assert.Error(t, err, "%v: expected error", tt.msg) {
+				assert.Contains(t, err.Error(), tt.wantErr, "%v: unexpected error", tt.msg)
+			}
+			continue
+		}
+
+		require.NoError(t, err, "%v: parseDiscoverResult failed", tt.msg)
+		assert.Equal(t, tt.want, got, "%v: unexpected peers", tt.msg)
+	}
+}
+
+func TestDiscoverPeers(t *testing.T) {
+	var directRequests, routedRequests int32
+	backend := newServer(t)
+	defer backend.shutdown()
+	backend.register(fooMethod, methods.errorIf(func() bool {
+		atomic.AddInt32(&directRequests, 1)
+		return false
+	}))
+
+	router := testutils.NewServer(t, testutils.NewOpts().SetServiceName(hyperbahnService).DisableLogVerification())
+	defer router.Close()
+	testutils.RegisterFunc(router, "Hyperbahn::discover", methods.customArg3(discoverResult(t, backend.hostPort())))
+	router.GetSubChannel("foo").Register(raw.Wrap(rawHandler(methods.errorIf(func() bool {
+		atomic.AddInt32(&routedRequests, 1)
+		return false
+	}))), fooMethod)
+
+	routerOpts := TransportOptions{ServiceName: "foo", HostPorts: []string{router.PeerInfo().HostPort}}
+
+	t.Run("discover", func(t *testing.T) {
+		atomic.StoreInt32(&directRequests, 0)
+		atomic.StoreInt32(&routedRequests, 0)
+
+		tOpts := routerOpts
+		tOpts.Discover = true
+		buf, out := getOutput(t)
+		runWithOptions(Options{
+			ROpts: RequestOptions{ThriftFile: validThrift, MethodName: fooMethod},
+			TOpts: tOpts,
+		}, out)
+
+		assert.Contains(t, buf.String(), "discovered 1 instances of foo: ["+backend.hostPort()+"]", "Missing discovered peers")
+		assert.EqualValues(t, 1, atomic.LoadInt32(&directRequests), "Call should go to the instance directly")
+		assert.EqualValues(t, 0, atomic.LoadInt32(&routedRequests), "Call should not go through the router")
+	})
+
+	t.Run("compare direct", func(t *testing.T) {
+		atomic.StoreInt32(&directRequests, 0)
+		atomic.StoreInt32(&routedRequests, 0)
+
+		tOpts := routerOpts
+		tOpts.CompareDirect = true
+		buf, out := getOutput(t)
+		runWithOptions(Options{
+			ROpts: RequestOptions{ThriftFile: validThrift, MethodName: fooMethod},
+			TOpts: tOpts,
+			BOpts: BenchmarkOptions{
+				MaxRequests: 100,
+				MaxDuration: time.Second,
+				Connections: 2,
+				Concurrency: 1,
+			},
+		}, out)
+
+		bufStr := buf.String()
+		assert.Contains(t, bufStr, "routed (weight 1): 50 requests")
+		assert.Contains(t, bufStr, "direct (weight 1): 50 requests")
+		// The initial request goes through the router, and each connection makes warm up requests.
+		assert.EqualValues(t, 1+50+warmupRequests, atomic.LoadInt32(&routedRequests), "Unexpected routed requests")
+		assert.EqualValues(t, 50+warmupRequests, atomic.LoadInt32(&directRequests), "Unexpected direct requests")
+	})
+}
+
+func TestDiscoverErrors(t *testing.T) {
+	tests := []struct {
+		msg     string
+		opts    Options
+		wantErr string
+	}{
+		{
+			msg: "HTTP peers",
+			opts: Options{TOpts: TransportOptions{
+				ServiceName: "foo",
+				HostPorts:   []string{"http://localhost:1"},
+				Discover:    true,
+			}},
+			wantErr: errDiscoverTChannel.Error(),
+		},
+		{
+			msg: "discover and compare",
+			opts: Options{TOpts: TransportOptions{
+				ServiceName:   "foo",
+				HostPorts:     []string{"1.1.1.1:1"},
+				Discover:      true,
+				CompareDirect: true,
+			}},
+			wantErr: errDiscoverCompare.Error(),
+		},
+		{
+			msg: "compare without benchmark",
+			opts: Options{TOpts: TransportOptions{
+				ServiceName:   "foo",
+				HostPorts:     []string{"1.1.1.1:1"},
+				CompareDirect: true,
+			}},
+			wantErr: errCompareDirectNoBench.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		var fatal string
+		out := testOutput{
+			Buffer: &bytes.Buffer{},
+			fatalf: func(format string, args ...interface{}) {
+				if fatal == "" {
+					fatal = fmt.Sprintf(format, args...)
+				}
+			},
+		}
+
+		tt.opts.ROpts = RequestOptions{ThriftFile: validThrift, MethodName: fooMethod}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			runWithOptions(tt.opts, out)
+		}()
+		<-done
+
+		assert.Contains(t, fatal, tt.wantErr, "%v: unexpected error", tt.msg)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"strings"
+
+	"github.com/yarpc/yab/transport"
+)
+
+// idempotencyKeyAuto generates a new idempotency key for each logical request.
+const idempotencyKeyAuto = "auto"
+
+// replayedHeaders are the response headers services use to mark a response
+// as replayed, as the idempotency key was already used by an earlier request.
+var replayedHeaders = []string{"Idempotent-Replayed", "Idempotency-Replayed"}
+
+// newIdempotencyKey returns the key for a new logical request, which is a
+// random UUID for auto, or the given key otherwise. Auto keys don't use the
+// source seeded by --seed, so a rerun doesn't replay the previous run's keys.
+func newIdempotencyKey(key string) string {
+	if key == idempotencyKeyAuto {
+		return templateUUID()
+	}
+	return key
+}
+
+// isReplayed returns whether the service marked the response as replayed,
+// which means it's a duplicate of the response to an earlier request.
+func isReplayed(res *transport.Response) bool {
+	if res == nil {
+		return false
+	}
+
+	for k, v := range res.Headers {
+		for _, h := range replayedHeaders {
+			if strings.EqualFold(k, h) && strings.EqualFold(strings.TrimSpace(v), "true") {
+				return true
+			}
+		}
+	}
+	return false
+}
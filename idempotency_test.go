@@ -0,0 +1,157 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yarpc/yab/encoding"
+	"github.com/yarpc/yab/transport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewIdempotencyKey(t *testing.T) {
+	assert.Equal(t, "fixed", newIdempotencyKey("fixed"), "Fixed keys should be used as-is")
+
+	first := newIdempotencyKey(idempotencyKeyAuto)
+	assert.Len(t, first, 36, "auto should generate a UUID")
+	assert.NotEqual(t, first, newIdempotencyKey(idempotencyKeyAuto), "auto should generate a new key each time")
+
+	// A rerun with the same seed should not reuse the previous run's keys.
+	rand.Seed(1)
+	first = newIdempotencyKey(idempotencyKeyAuto)
+	rand.Seed(1)
+	assert.NotEqual(t, first, newIdempotencyKey(idempotencyKeyAuto), "auto keys should not depend on the seed")
+}
+
+func TestIsReplayed(t *testing.T) {
+	tests := []struct {
+		headers map[string]string
+		want    bool
+	}{
+		{headers: nil, want: false},
+		{headers: map[string]string{"Idempotent-Replayed": "true"}, want: true},
+		{headers: map[string]string{"idempotency-replayed": "TRUE"}, want: true},
+		{headers: map[string]string{"Idempotent-Replayed": "false"}, want: false},
+		{headers: map[string]string{"Other": "true"}, want: false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, isReplayed(&transport.Response{Headers: tt.headers}), "isReplayed(%v)", tt.headers)
+	}
+	assert.False(t, isReplayed(nil), "nil responses are not replayed")
+}
+
+func TestBenchmarkIdempotencyKeyRetry(t *testing.T) {
+	var mu sync.Mutex
+	keys := make(map[string]int)
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			// Warm up requests don't have a key.
+			io.WriteString(w, "{}")
+			return
+		}
+
+		// Throttle the first attempt of each request, and replay the retry.
+		mu.Lock()
+		keys[key]++
+		attempt := keys[key]
+		mu.Unlock()
+		if attempt == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Idempotent-Replayed", "true")
+		io.WriteString(w, "{}")
+	}))
+	defer svr.Close()
+
+	serializer := encoding.NewJSON("method")
+	req, err := serializer.Request([]byte("{}"))
+	require.NoError(t, err, "Failed to serialize request")
+	req.Timeout = time.Second
+
+	buf, out := getOutput(t)
+	runBenchmark(out, Options{
+		ROpts: RequestOptions{
+			IdempotencyKey:    idempotencyKeyAuto,
+			IdempotencyHeader: "Idempotency-Key",
+		},
+		BOpts: BenchmarkOptions{
+			MaxRequests: 20,
+			MaxDuration: time.Second,
+			Connections: 1,
+			Concurrency: 1,
+		},
+		TOpts: TransportOptions{ServiceName: "foo", HostPorts: []string{svr.URL}},
+	}, benchmarkMethod{serializer: serializer, req: req})
+
+	bufStr := buf.String()
+	assert.Contains(t, bufStr, "Idempotency key: Idempotency-Key: auto", "Missing idempotency key parameter")
+	assert.Contains(t, bufStr, "Total throttled: 10\n", "Unexpected throttled responses")
+	assert.Contains(t, bufStr, "Replayed: 10 responses", "Unexpected replayed responses")
+
+	assert.Len(t, keys, 10, "Each logical request should use a single key")
+	for key, attempts := range keys {
+		assert.Equal(t, 2, attempts, "Retries should reuse the key %v", key)
+	}
+}
+
+func TestRunWorkerRecordsIdempotencyKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yab-errors")
+	require.NoError(t, err, "TempDir failed")
+	defer os.RemoveAll(dir)
+
+	m := benchmarkMethodForTest(t, fooMethod)
+	m.idempotencyKey = idempotencyKeyAuto
+	m.idempotencyHeader = "Idempotency-Key"
+	m.validate = func() bool { return false }
+
+	samples, err := newErrorSamples(dir, 1)
+	require.NoError(t, err, "newErrorSamples failed")
+	runWorkerForTest(fakeTransport{err: errors.New("failed")}, m, samples.forTarget("target"), nil)
+
+	details, err := ioutil.ReadFile(filepath.Join(samples.dir, "0001", "sample.json"))
+	require.NoError(t, err, "failed to read sample.json")
+	var sample errorSample
+	require.NoError(t, json.Unmarshal(details, &sample), "failed to parse sample.json")
+	assert.Len(t, sample.RequestHeaders["Idempotency-Key"], 36, "error sample should have the idempotency key that was sent")
+
+	outliers := newOutliers(time.Nanosecond)
+	runWorkerForTest(fakeTransport{res: &transport.Response{}}, m, nil, outliers.forTarget("target"))
+	report := outliers.report()
+	require.Len(t, report.Outliers, 1, "expected an outlier")
+	assert.Len(t, report.Outliers[0].RequestHeaders["Idempotency-Key"], 36, "outlier should have the idempotency key that was sent")
+}
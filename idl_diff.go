@@ -0,0 +1,112 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/yarpc/yab/thrift"
+
+	"github.com/thriftrw/thriftrw-go/compile"
+)
+
+// idlDiffCommand compares two versions of a Thrift file.
+const idlDiffCommand = "idl-diff"
+
+var (
+	errIDLDiffUsage = errors.New("usage: yab idl-diff <old.thrift> <new.thrift> [Service::method | Service]...")
+	errIDLDiffProto = errors.New("yab idl-diff only supports Thrift files")
+)
+
+// runIDLDiff prints the changes between two versions of a Thrift file for the
+// given methods, or all methods, and fails if any of the changes break
+// compatibility with existing callers or servers.
+func runIDLDiff(args []string, out output) {
+	changes, err := idlDiff(args)
+	if err != nil {
+		out.Fatalf("Failed to compare IDLs: %v\n", err)
+	}
+
+	var breaking, other []thrift.Change
+	for _, c := range changes {
+		if c.Breaking {
+			breaking = append(breaking, c)
+		} else {
+			other = append(other, c)
+		}
+	}
+
+	if len(changes) == 0 {
+		out.Printf("No changes found\n")
+		return
+	}
+	printChanges(out, "Breaking changes", breaking)
+	printChanges(out, "Other changes", other)
+
+	if len(breaking) > 0 {
+		out.Fatalf("Found %v breaking changes\n", len(breaking))
+	}
+}
+
+func idlDiff(args []string) ([]thrift.Change, error) {
+	if len(args) < 2 {
+		return nil, errIDLDiffUsage
+	}
+
+	from, err := parseIDL(args[0])
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseIDL(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return thrift.Diff(from, to, args[2:])
+}
+
+func parseIDL(file string) (*compile.Module, error) {
+	if strings.HasSuffix(file, ".proto") {
+		return nil, errIDLDiffProto
+	}
+
+	path, err := localFile(file, "")
+	if err != nil {
+		return nil, err
+	}
+	module, err := thrift.Parse(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %v: %v", file, err)
+	}
+	return module, nil
+}
+
+func printChanges(out output, title string, changes []thrift.Change) {
+	if len(changes) == 0 {
+		return
+	}
+
+	out.Printf("%v:\n", title)
+	for _, c := range changes {
+		out.Printf("  %v\n", c)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunIDLDiff(t *testing.T) {
+	oldFile := writeFile(t, "old", `
+struct Item {
+  1: optional i32 count
+}
+service Store {
+  Item get(1: string key)
+  void put(1: string key)
+}
+`)
+	defer os.Remove(oldFile)
+	newFile := writeFile(t, "new", `
+struct Item {
+  1: optional i64 count
+}
+service Store {
+  Item get(1: string id)
+}
+`)
+	defer os.Remove(newFile)
+
+	tests := []struct {
+		args      []string
+		want      string
+		wantFatal string
+	}{
+		{
+			args: []string{oldFile, newFile},
+			want: "Breaking changes:\n" +
+				"  Store::get: result.count: type changed from i32 to i64\n" +
+				"  Store::put: method was removed\n" +
+				"Other changes:\n" +
+				"  Store::get: args: field 1 was renamed from key to id\n",
+			wantFatal: "Found 2 breaking changes\n",
+		},
+		{
+			args: []string{oldFile, oldFile},
+			want: "No changes found\n",
+		},
+		{
+			args:      []string{oldFile},
+			wantFatal: fmt.Sprintf("Failed to compare IDLs: %v\n", errIDLDiffUsage),
+		},
+		{
+			args:      []string{"old.proto", "new.proto"},
+			wantFatal: fmt.Sprintf("Failed to compare IDLs: %v\n", errIDLDiffProto),
+		},
+		{
+			args:      []string{oldFile, newFile, "Store::unknown"},
+			wantFatal: "Failed to compare IDLs: method \"Store::unknown\" not found in the old Thrift file\n",
+		},
+	}
+
+	for _, tt := range tests {
+		buf, out := getOutput(t)
+		var fatal string
+		out = testOutput{
+			Buffer: buf,
+			fatalf: func(format string, args ...interface{}) {
+				fatal = fmt.Sprintf(format, args...)
+			},
+		}
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			runIDLDiff(tt.args, out)
+		}()
+		<-done
+
+		assert.Equal(t, tt.want, buf.String(), "%v: unexpected output", tt.args)
+		assert.Equal(t, tt.wantFatal, fatal, "%v: unexpected fatal error", tt.args)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/yarpc/yab/encoding"
+	"github.com/yarpc/yab/thrift"
+	"github.com/yarpc/yab/transport"
+
+	"github.com/thriftrw/thriftrw-go/compile"
+)
+
+var errServerIDLResponse = errors.New("unexpected Meta::thriftIDL response")
+
+// fetchServerIDL calls Meta::thriftIDL, and compiles the Thrift files that
+// the server returns.
+func fetchServerIDL(t transport.Transport, req *transport.Request) (*compile.Module, error) {
+	serializer := encoding.NewThriftIDL()
+	idlReq, err := serializer.Request(nil)
+	if err != nil {
+		return nil, err
+	}
+	idlReq.Timeout = req.Timeout
+
+	response, err := makeRequest(t, idlReq)
+	if err != nil {
+		return nil, err
+	}
+	body, err := serializer.Response(response)
+	if err != nil {
+		return nil, err
+	}
+
+	fields, ok := body.(map[string]interface{})
+	if !ok {
+		return nil, errServerIDLResponse
+	}
+	result, ok := fields["result"].(map[string]interface{})
+	if !ok {
+		return nil, errServerIDLResponse
+	}
+	idls, ok := result["idls"].(map[string]interface{})
+	entryPoint, entryOK := result["entryPoint"].(string)
+	if !ok || !entryOK {
+		return nil, errServerIDLResponse
+	}
+
+	dir, err := ioutil.TempDir("", "yab-server-idl")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	for name, contents := range idls {
+		s, ok := contents.(string)
+		if !ok {
+			return nil, errServerIDLResponse
+		}
+
+		// Files are kept inside dir, even if the name contains "..".
+		path := filepath.Join(dir, filepath.Clean("/"+name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(path, []byte(s), 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	return thrift.Parse(filepath.Join(dir, filepath.Clean("/"+entryPoint)))
+}
+
+// lintServerIDL warns about differences between the local Thrift file and
+// the server's Thrift files for the method being called, which may cause
+// confusing errors when the server deserializes the request.
+func lintServerIDL(logger *logger, t transport.Transport, thriftFile string, req *transport.Request) {
+	local, err := parseIDL(thriftFile)
+	if err != nil {
+		logger.Warnf("could not compare with the server's Thrift IDL: %v", err)
+		return
+	}
+
+	server, err := fetchServerIDL(t, req)
+	if err != nil {
+		logger.Warnf("could not fetch the server's Thrift IDL using Meta::thriftIDL: %v", err)
+		return
+	}
+
+	changes, err := thrift.Diff(local, server, []string{req.Method})
+	if err != nil {
+		logger.Warnf("could not compare with the server's Thrift IDL: %v", err)
+		return
+	}
+
+	breaking := 0
+	for _, c := range changes {
+		if c.Breaking {
+			breaking++
+			logger.Warnf("the server's Thrift IDL is incompatible with the local IDL: %v", c)
+		} else {
+			logger.Infof("the server's Thrift IDL differs from the local IDL: %v", c)
+		}
+	}
+	if breaking == 0 {
+		logger.Infof("the server's Thrift IDL is compatible with the local IDL for %v", req.Method)
+	}
+}
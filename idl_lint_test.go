@@ -0,0 +1,174 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/yarpc/yab/encoding"
+	"github.com/yarpc/yab/transport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thriftrw/thriftrw-go/protocol"
+	"github.com/thriftrw/thriftrw-go/wire"
+)
+
+// thriftIDLResult returns an encoded Meta::thriftIDL result.
+func thriftIDLResult(t *testing.T, entryPoint string, idls map[string]string) []byte {
+	var items []wire.MapItem
+	for name, contents := range idls {
+		items = append(items, wire.MapItem{
+			Key:   wire.NewValueString(name),
+			Value: wire.NewValueString(contents),
+		})
+	}
+
+	result := wire.NewValueStruct(wire.Struct{Fields: []wire.Field{
+		{ID: 0, Value: wire.NewValueStruct(wire.Struct{Fields: []wire.Field{
+			{ID: 1, Value: wire.NewValueMap(wire.Map{
+				KeyType:   wire.TBinary,
+				ValueType: wire.TBinary,
+				Size:      len(items),
+				Items:     wire.MapItemListFromSlice(items),
+			})},
+			{ID: 2, Value: wire.NewValueString(entryPoint)},
+		}})},
+	}})
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, protocol.Binary.Encode(result, buf), "Failed to encode result")
+	return buf.Bytes()
+}
+
+func TestLintServerIDL(t *testing.T) {
+	const (
+		base     = "include \"./types.thrift\"\n"
+		simple   = "service Simple {\n  void foo()\n  i32 bar()\n}\n"
+		noFoo    = "service Simple {\n  i32 bar()\n}\n"
+		optional = "service Simple {\n  void foo(1: i32 arg)\n}\n"
+		required = "service Simple {\n  void foo(1: required i32 arg)\n}\n"
+	)
+
+	tests := []struct {
+		msg        string
+		entryPoint string
+		idls       map[string]string
+		noHandler  bool
+		want       []string
+	}{
+		{
+			msg:        "same IDL",
+			entryPoint: "simple.thrift",
+			idls:       map[string]string{"simple.thrift": simple},
+			want:       []string{"Note: the server's Thrift IDL is compatible with the local IDL for Simple::foo"},
+		},
+		{
+			msg:        "method removed",
+			entryPoint: "simple.thrift",
+			idls:       map[string]string{"simple.thrift": noFoo},
+			want:       []string{"Warning: the server's Thrift IDL is incompatible with the local IDL"},
+		},
+		{
+			msg:        "optional argument added",
+			entryPoint: "simple.thrift",
+			idls:       map[string]string{"simple.thrift": optional},
+			want: []string{
+				"Note: the server's Thrift IDL differs from the local IDL",
+				"Note: the server's Thrift IDL is compatible with the local IDL",
+			},
+		},
+		{
+			msg:        "required argument added",
+			entryPoint: "simple.thrift",
+			idls:       map[string]string{"simple.thrift": required},
+			want:       []string{"Warning: the server's Thrift IDL is incompatible with the local IDL"},
+		},
+		{
+			msg:        "includes outside the directory",
+			entryPoint: "../idl/simple.thrift",
+			idls: map[string]string{
+				"../idl/simple.thrift": base + simple,
+				"../idl/types.thrift":  "struct S {}\n",
+			},
+			want: []string{"Note: the server's Thrift IDL is compatible with the local IDL"},
+		},
+		{
+			msg:        "invalid server IDL",
+			entryPoint: "simple.thrift",
+			idls:       map[string]string{"simple.thrift": "service {"},
+			want:       []string{"Warning: could not fetch the server's Thrift IDL using Meta::thriftIDL"},
+		},
+		{
+			msg:       "no Meta::thriftIDL",
+			noHandler: true,
+			want:      []string{"Warning: could not fetch the server's Thrift IDL using Meta::thriftIDL"},
+		},
+	}
+
+	for _, tt := range tests {
+		s := newServer(t)
+		s.register(fooMethod, methods.echo())
+		if !tt.noHandler {
+			s.register("Meta::thriftIDL", methods.customArg3(thriftIDLResult(t, tt.entryPoint, tt.idls)))
+		}
+
+		tchan, err := getTransport(s.transportOpts(), encoding.Thrift)
+		require.NoError(t, err, "%v: getTransport failed", tt.msg)
+
+		buf, out := getOutput(t)
+		lintServerIDL(newLogger(Options{}, out), tchan, validThrift, &transport.Request{
+			Method:  fooMethod,
+			Timeout: time.Second,
+		})
+		for _, want := range tt.want {
+			assert.Contains(t, buf.String(), want, "%v: unexpected output", tt.msg)
+		}
+
+		s.shutdown()
+	}
+}
+
+func TestLintIDLFlag(t *testing.T) {
+	s := newServer(t)
+	defer s.shutdown()
+	s.register(fooMethod, methods.echo())
+	s.register("Meta::thriftIDL", methods.customArg3(thriftIDLResult(t, "simple.thrift", map[string]string{
+		"simple.thrift": "service Simple {\n  i32 bar()\n}\n",
+	})))
+
+	opts := Options{
+		ROpts: RequestOptions{
+			ThriftFile: validThrift,
+			MethodName: fooMethod,
+			LintIDL:    true,
+			Timeout:    timeMillisFlag(time.Second),
+		},
+		TOpts: s.transportOpts(),
+	}
+
+	buf, out := getOutput(t)
+	runWithOptions(opts, out)
+	assert.Contains(t, buf.String(), "the server's Thrift IDL is incompatible with the local IDL: Simple::foo", "Expected lint warning")
+	assert.Contains(t, buf.String(), `"body": {}`, "Expected the call to be made")
+}
@@ -0,0 +1,404 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// importCommand converts a curl command or HAR file to a yab command.
+const importCommand = "import"
+
+var (
+	errImportUsage    = errors.New("usage: yab import <curl command> | <file.har>")
+	errImportNoURL    = errors.New("no URL found in curl command")
+	errUnterminated   = errors.New("unterminated quote in command")
+	errHARNoEntries   = errors.New("no requests found in HAR file")
+	errImportBodyFile = errors.New("cannot import a body from stdin")
+)
+
+// importedRequest is a HTTP request from a curl command or HAR entry.
+type importedRequest struct {
+	Method   string
+	URL      string
+	Headers  [][2]string
+	Body     string
+	BodyFile string
+	Timeout  time.Duration
+	Resolve  []string
+
+	// Unsupported are options that yab does not support, which are ignored.
+	Unsupported []string
+}
+
+// curlValueOptions are curl options that take a value, mapped to the
+// canonical name used when importing.
+var curlValueOptions = map[string]string{
+	"-X": "-X", "--request": "-X",
+	"-H": "-H", "--header": "-H",
+	"-d": "-d", "--data": "-d", "--data-raw": "--data-raw",
+	"--data-binary": "-d", "--data-ascii": "-d",
+	"-m": "-m", "--max-time": "-m",
+	"--url":     "--url",
+	"--resolve": "--resolve",
+	"-A":        "-A", "--user-agent": "-A",
+
+	// These options are not supported, but take a value which must be skipped.
+	"-o": "", "--output": "", "-u": "", "--user": "", "-e": "", "--referer": "",
+	"-b": "", "--cookie": "", "-c": "", "--cookie-jar": "", "-w": "", "--write-out": "",
+	"-x": "", "--proxy": "", "--connect-timeout": "",
+}
+
+// curlIgnoredOptions only affect how curl displays the response.
+var curlIgnoredOptions = map[string]bool{
+	"-s": true, "--silent": true, "-S": true, "--show-error": true,
+	"-v": true, "--verbose": true, "-i": true, "--include": true,
+	"--compressed": true, "-sS": true,
+}
+
+// runImport prints the yab command for the given curl command or HAR file.
+func runImport(args []string, out output) {
+	reqs, err := importRequests(args)
+	if err != nil {
+		out.Fatalf("Failed to import: %v\n", err)
+	}
+
+	logger := &logger{printf: out.Warnf, now: time.Now}
+	for _, r := range reqs {
+		out.Printf("%v\n", r.yabCommand(logger.Warnf))
+	}
+}
+
+// importRequests parses the arguments to yab import, which are either a curl
+// command, which may be a single quoted argument, or the path of a HAR file.
+func importRequests(args []string) ([]importedRequest, error) {
+	if len(args) == 1 && strings.HasPrefix(args[0], "curl ") {
+		var err error
+		if args, err = splitCommand(args[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case len(args) > 0 && args[0] == "curl":
+		r, err := parseCurl(args[1:])
+		if err != nil {
+			return nil, err
+		}
+		return []importedRequest{r}, nil
+	case len(args) == 1:
+		contents, err := readFile(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return parseHAR(contents)
+	}
+	return nil, errImportUsage
+}
+
+// splitCommand splits a shell command into words, handling quotes, escapes
+// and line continuations.
+func splitCommand(cmd string) ([]string, error) {
+	var (
+		words   []string
+		cur     []rune
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	for _, c := range cmd {
+		switch {
+		case escaped:
+			if c != '\n' {
+				cur = append(cur, c)
+				inWord = true
+			}
+			escaped = false
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				cur = append(cur, c)
+			}
+		case c == '\\':
+			escaped = true
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else {
+				cur = append(cur, c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, string(cur))
+				cur, inWord = nil, false
+			}
+		default:
+			cur = append(cur, c)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errUnterminated
+	}
+	if inWord {
+		words = append(words, string(cur))
+	}
+	return words, nil
+}
+
+// parseCurl parses the arguments of a curl command.
+func parseCurl(args []string) (importedRequest, error) {
+	var r importedRequest
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			r.URL = arg
+			continue
+		}
+
+		// Short options may have the value attached, e.g. -XPOST.
+		opt, value, hasValue := arg, "", false
+		if !strings.HasPrefix(arg, "--") && len(arg) > 2 {
+			if _, ok := curlValueOptions[arg[:2]]; ok {
+				opt, value, hasValue = arg[:2], arg[2:], true
+			}
+		}
+
+		name, takesValue := curlValueOptions[opt]
+		if takesValue && name == "" {
+			r.Unsupported = append(r.Unsupported, opt)
+		}
+		if !takesValue {
+			if !curlIgnoredOptions[opt] {
+				r.Unsupported = append(r.Unsupported, opt)
+			}
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return r, fmt.Errorf("curl option %v requires a value", opt)
+			}
+			i++
+			value = args[i]
+		}
+
+		switch name {
+		case "-X":
+			r.Method = value
+		case "-H":
+			parts := strings.SplitN(value, ":", 2)
+			if len(parts) != 2 {
+				return r, fmt.Errorf("invalid header %q", value)
+			}
+			r.Headers = append(r.Headers, [2]string{strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])})
+		case "-A":
+			r.Headers = append(r.Headers, [2]string{"User-Agent", value})
+		case "-d", "--data-raw":
+			if name == "-d" && strings.HasPrefix(value, "@") {
+				if value == "@-" {
+					return r, errImportBodyFile
+				}
+				r.BodyFile = value[1:]
+				continue
+			}
+			if r.Body != "" {
+				r.Body += "&"
+			}
+			r.Body += value
+		case "-m":
+			secs, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return r, fmt.Errorf("invalid --max-time %q: %v", value, err)
+			}
+			r.Timeout = time.Duration(secs * float64(time.Second))
+		case "--url":
+			r.URL = value
+		case "--resolve":
+			r.Resolve = append(r.Resolve, value)
+		}
+	}
+
+	if r.URL == "" {
+		return r, errImportNoURL
+	}
+	if r.Method == "" {
+		r.Method = "GET"
+		if r.Body != "" || r.BodyFile != "" {
+			r.Method = "POST"
+		}
+	}
+	return r, nil
+}
+
+// harFile is the subset of the HAR format used to import requests.
+type harFile struct {
+	Log struct {
+		Entries []struct {
+			Request struct {
+				Method  string `json:"method"`
+				URL     string `json:"url"`
+				Headers []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"headers"`
+				PostData *struct {
+					Text string `json:"text"`
+				} `json:"postData"`
+			} `json:"request"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// parseHAR returns the requests for each entry in a HAR file.
+func parseHAR(contents []byte) ([]importedRequest, error) {
+	var har harFile
+	if err := json.Unmarshal(contents, &har); err != nil {
+		return nil, fmt.Errorf("invalid HAR file: %v", err)
+	}
+	if len(har.Log.Entries) == 0 {
+		return nil, errHARNoEntries
+	}
+
+	reqs := make([]importedRequest, len(har.Log.Entries))
+	for i, e := range har.Log.Entries {
+		r := importedRequest{
+			Method: e.Request.Method,
+			URL:    e.Request.URL,
+		}
+		for _, h := range e.Request.Headers {
+			// HTTP/2 pseudo-headers are derived from the URL.
+			if strings.HasPrefix(h.Name, ":") {
+				continue
+			}
+			r.Headers = append(r.Headers, [2]string{h.Name, h.Value})
+		}
+		if e.Request.PostData != nil {
+			r.Body = e.Request.PostData.Text
+		}
+		reqs[i] = r
+	}
+	return reqs, nil
+}
+
+// yabCommand returns the yab command that makes the request, calling warnf
+// for any parts of the request that yab cannot reproduce.
+func (r importedRequest) yabCommand(warnf func(string, ...interface{})) string {
+	u, err := url.Parse(r.URL)
+	if err != nil || u.Host == "" {
+		warnf("%q is not a valid URL", r.URL)
+		u = &url.URL{}
+	}
+	for _, opt := range r.Unsupported {
+		warnf("ignoring unsupported curl option %v", opt)
+	}
+	if r.Method != "POST" {
+		warnf("yab always uses POST, but the request uses %v", r.Method)
+	}
+
+	var service, method, caller, hostHeader string
+	var timeout time.Duration
+	headers := make(map[string]string)
+	for _, h := range r.Headers {
+		switch strings.ToLower(h[0]) {
+		case "rpc-service":
+			service = h[1]
+		case "rpc-procedure":
+			method = h[1]
+		case "rpc-caller":
+			caller = h[1]
+		case "context-ttl-ms":
+			if ms, err := strconv.Atoi(h[1]); err == nil {
+				timeout = time.Duration(ms) * time.Millisecond
+			}
+		case "host":
+			if h[1] != u.Host {
+				hostHeader = h[1]
+			}
+		case "content-length", "connection", "accept-encoding":
+			// These are set by the HTTP client.
+		default:
+			headers[h[0]] = h[1]
+		}
+	}
+	if r.Timeout > 0 {
+		timeout = r.Timeout
+	}
+
+	if service == "" {
+		service = u.Host
+		if host, _, err := net.SplitHostPort(u.Host); err == nil {
+			service = host
+		}
+		warnf("no RPC-Service header, using %q as the service", service)
+	}
+	if method == "" {
+		method = strings.TrimPrefix(u.Path, "/")
+		if method == "" {
+			method = "call"
+		}
+		warnf("no RPC-Procedure header, using %q as the method", method)
+	}
+
+	args := []string{"yab", shellQuote(service), shellQuote(method), "-p", shellQuote(r.URL)}
+	switch {
+	case r.BodyFile != "":
+		args = append(args, "-e", "raw", "-f", shellQuote(r.BodyFile))
+	case isJSON(r.Body):
+		args = append(args, "-e", "json", "-r", shellQuote(r.Body))
+	default:
+		args = append(args, "-e", "raw", "-r", shellQuote(r.Body))
+	}
+	if len(headers) > 0 {
+		// Marshalling a map sorts the keys, so the output is stable.
+		headersJSON, _ := json.Marshal(headers)
+		args = append(args, "--headers", shellQuote(string(headersJSON)))
+	}
+	if caller != "" {
+		args = append(args, "--caller", shellQuote(caller))
+	}
+	if hostHeader != "" {
+		args = append(args, "--host-header", shellQuote(hostHeader))
+	}
+	if timeout > 0 {
+		args = append(args, "--timeout", timeout.String())
+	}
+	for _, resolve := range r.Resolve {
+		args = append(args, "--resolve", shellQuote(resolve))
+	}
+	return strings.Join(args, " ")
+}
+
+// isJSON returns whether s is a JSON value.
+func isJSON(s string) bool {
+	var v interface{}
+	return s != "" && json.Unmarshal([]byte(s), &v) == nil
+}
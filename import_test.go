@@ -0,0 +1,333 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		cmd     string
+		want    []string
+		wantErr error
+	}{
+		{
+			cmd:  `curl -H 'a: b' "x y"`,
+			want: []string{"curl", "-H", "a: b", "x y"},
+		},
+		{
+			cmd:  "curl \\\n  -d '{\"k\": \"it'\\''s\"}' a\\ b",
+			want: []string{"curl", "-d", `{"k": "it's"}`, "a b"},
+		},
+		{
+			cmd:  `curl -d "say \"hi\""`,
+			want: []string{"curl", "-d", `say "hi"`},
+		},
+		{
+			cmd:  `curl -d ''`,
+			want: []string{"curl", "-d", ""},
+		},
+		{
+			cmd:     `curl 'unterminated`,
+			wantErr: errUnterminated,
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := splitCommand(tt.cmd)
+		if tt.wantErr != nil {
+			assert.Equal(t, tt.wantErr, err, "%q: unexpected error", tt.cmd)
+			continue
+		}
+		require.NoError(t, err, "%q: splitCommand failed", tt.cmd)
+		assert.Equal(t, tt.want, got, "%q: unexpected words", tt.cmd)
+	}
+}
+
+func TestParseCurl(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    importedRequest
+		wantErr string
+	}{
+		{
+			args: []string{"http://localhost:8080/rpc", "-XPUT", "-H", "RPC-Service: svc", "-HK:v", "-sS"},
+			want: importedRequest{
+				Method:  "PUT",
+				URL:     "http://localhost:8080/rpc",
+				Headers: [][2]string{{"RPC-Service", "svc"}, {"K", "v"}},
+			},
+		},
+		{
+			args: []string{"--url", "http://localhost", "-d", "a=1", "--data-raw", "@b", "-m", "1.5", "-A", "agent"},
+			want: importedRequest{
+				Method:  "POST",
+				URL:     "http://localhost",
+				Body:    "a=1&@b",
+				Timeout: 1500 * time.Millisecond,
+				Headers: [][2]string{{"User-Agent", "agent"}},
+			},
+		},
+		{
+			args: []string{"http://localhost", "--data-binary", "@body.bin", "-k", "-u", "user:pass", "--resolve", "localhost:80:1.1.1.1"},
+			want: importedRequest{
+				Method:      "POST",
+				URL:         "http://localhost",
+				BodyFile:    "body.bin",
+				Resolve:     []string{"localhost:80:1.1.1.1"},
+				Unsupported: []string{"-k", "-u"},
+			},
+		},
+		{
+			args:    []string{"-H", "K: v"},
+			wantErr: errImportNoURL.Error(),
+		},
+		{
+			args:    []string{"http://localhost", "-H"},
+			wantErr: "curl option -H requires a value",
+		},
+		{
+			args:    []string{"http://localhost", "-H", "no colon"},
+			wantErr: `invalid header "no colon"`,
+		},
+		{
+			args:    []string{"http://localhost", "-d", "@-"},
+			wantErr: errImportBodyFile.Error(),
+		},
+		{
+			args:    []string{"http://localhost", "-m", "soon"},
+			wantErr: `invalid --max-time "soon"`,
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := parseCurl(tt.args)
+		if tt.wantErr != "" {
+			if assert.Error(t, err, "%v: expected error", tt.args) {
+				assert.Contains(t, err.Error(), tt.wantErr, "%v: unexpected error", tt.args)
+			}
+			continue
+		}
+		require.NoError(t, err, "%v: parseCurl failed", tt.args)
+		assert.Equal(t, tt.want, got, "%v: unexpected request", tt.args)
+	}
+}
+
+func TestParseHAR(t *testing.T) {
+	tests := []struct {
+		msg     string
+		har     string
+		want    []importedRequest
+		wantErr string
+	}{
+		{
+			msg: "entries",
+			har: `{"log": {"entries": [
+				{"request": {"method": "POST", "url": "https://a/b", "headers": [
+					{"name": ":authority", "value": "a"},
+					{"name": "RPC-Service", "value": "svc"}
+				], "postData": {"mimeType": "application/json", "text": "{}"}}},
+				{"request": {"method": "GET", "url": "https://a/c"}}
+			]}}`,
+			want: []importedRequest{
+				{Method: "POST", URL: "https://a/b", Headers: [][2]string{{"RPC-Service", "svc"}}, Body: "{}"},
+				{Method: "GET", URL: "https://a/c"},
+			},
+		},
+		{
+			msg:     "no entries",
+			har:     `{"log": {"entries": []}}`,
+			wantErr: errHARNoEntries.Error(),
+		},
+		{
+			msg:     "invalid JSON",
+			har:     `{`,
+			wantErr: "invalid HAR file",
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := parseHAR([]byte(tt.har))
+		if tt.wantErr != "" {
+			if assert.Error(t, err, "%v: expected error", tt.msg) {
+				assert.Contains(t, err.Error(), tt.wantErr, "%v: unexpected error", tt.msg)
+			}
+			continue
+		}
+		require.NoError(t, err, "%v: parseHAR failed", tt.msg)
+		assert.Equal(t, tt.want, got, "%v: unexpected requests", tt.msg)
+	}
+}
+
+func TestImportRequests(t *testing.T) {
+	f, err := ioutil.TempFile("", "import")
+	require.NoError(t, err, "failed to create temp file")
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`{"log": {"entries": [{"request": {"method": "POST", "url": "http://a"}}]}}`)
+	require.NoError(t, err, "failed to write HAR file")
+	require.NoError(t, f.Close(), "failed to close HAR file")
+
+	tests := []struct {
+		args    []string
+		wantURL string
+		wantErr string
+	}{
+		{args: []string{"curl", "http://a/b"}, wantURL: "http://a/b"},
+		{args: []string{"curl 'http://a/b' -H 'K: v'"}, wantURL: "http://a/b"},
+		{args: []string{f.Name()}, wantURL: "http://a"},
+		{args: nil, wantErr: errImportUsage.Error()},
+		{args: []string{"a", "b"}, wantErr: errImportUsage.Error()},
+		{args: []string{"/does/not/exist.har"}, wantErr: "no such file"},
+	}
+
+	for _, tt := range tests {
+		got, err := importRequests(tt.args)
+		if tt.wantErr != "" {
+			if assert.Error(t, err, "%v: expected error", tt.args) {
+				assert.Contains(t, err.Error(), tt.wantErr, "%v: unexpected error", tt.args)
+			}
+			continue
+		}
+		require.NoError(t, err, "%v: importRequests failed", tt.args)
+		require.Len(t, got, 1, "%v: unexpected number of requests", tt.args)
+		assert.Equal(t, tt.wantURL, got[0].URL, "%v: unexpected URL", tt.args)
+	}
+}
+
+func TestImportYabCommand(t *testing.T) {
+	tests := []struct {
+		msg          string
+		req          importedRequest
+		want         Options
+		wantWarnings []string
+	}{
+		{
+			msg: "YARPC request",
+			req: importedRequest{
+				Method: "POST",
+				URL:    "http://localhost:8080/rpc",
+				Headers: [][2]string{
+					{"RPC-Service", "svc"},
+					{"RPC-Procedure", "Svc::method"},
+					{"RPC-Caller", "caller"},
+					{"Context-TTL-MS", "500"},
+					{"Content-Length", "2"},
+					{"K", "it's"},
+				},
+				Body:    `{"k": "v"}`,
+				Resolve: []string{"localhost:8080:127.0.0.1"},
+			},
+			want: Options{
+				ROpts: RequestOptions{
+					Encoding:    "json",
+					MethodName:  "Svc::method",
+					RequestJSON: `{"k": "v"}`,
+					HeadersJSON: `{"K":"it's"}`,
+					Timeout:     timeMillisFlag(500 * time.Millisecond),
+				},
+				TOpts: TransportOptions{
+					ServiceName:    "svc",
+					HostPorts:      []string{"http://localhost:8080/rpc"},
+					CallerOverride: "caller",
+					Resolve:        []resolveOverride{{HostPort: "localhost:8080", Addr: "127.0.0.1:8080"}},
+				},
+			},
+		},
+		{
+			msg: "plain HTTP request",
+			req: importedRequest{
+				Method:      "GET",
+				URL:         "http://example.com:8080/users/get",
+				Headers:     [][2]string{{"Host", "virtual"}},
+				BodyFile:    "body.bin",
+				Timeout:     2 * time.Second,
+				Unsupported: []string{"-k"},
+			},
+			want: Options{
+				ROpts: RequestOptions{
+					Encoding:    "raw",
+					MethodName:  "users/get",
+					RequestFile: "body.bin",
+					Timeout:     timeMillisFlag(2 * time.Second),
+				},
+				TOpts: TransportOptions{
+					ServiceName: "example.com",
+					HostPorts:   []string{"http://example.com:8080/users/get"},
+					HostHeader:  "virtual",
+				},
+			},
+			wantWarnings: []string{
+				"ignoring unsupported curl option -k",
+				"yab always uses POST, but the request uses GET",
+				`no RPC-Service header, using "example.com" as the service`,
+				`no RPC-Procedure header, using "users/get" as the method`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		var warnings []string
+		warnf := func(format string, args ...interface{}) {
+			warnings = append(warnings, fmt.Sprintf(format, args...))
+		}
+		cmd := tt.req.yabCommand(warnf)
+		assert.Equal(t, tt.wantWarnings, warnings, "%v: unexpected warnings", tt.msg)
+
+		// The command should parse to the expected options.
+		words, err := splitCommand(cmd)
+		require.NoError(t, err, "%v: failed to split %q", tt.msg, cmd)
+		require.Equal(t, "yab", words[0], "%v: unexpected command", tt.msg)
+
+		var opts Options
+		remaining, err := newParser(&opts).ParseArgs(words[1:])
+		require.NoError(t, err, "%v: failed to parse %q", tt.msg, cmd)
+		require.Len(t, remaining, 2, "%v: expected service and method", tt.msg)
+		opts.TOpts.ServiceName = remaining[0]
+		opts.ROpts.MethodName = remaining[1]
+
+		got := Options{
+			ROpts: RequestOptions{
+				Encoding:    opts.ROpts.Encoding,
+				MethodName:  opts.ROpts.MethodName,
+				RequestJSON: opts.ROpts.RequestJSON,
+				RequestFile: opts.ROpts.RequestFile,
+				HeadersJSON: opts.ROpts.HeadersJSON,
+				Timeout:     opts.ROpts.Timeout,
+			},
+			TOpts: TransportOptions{
+				ServiceName:    opts.TOpts.ServiceName,
+				HostPorts:      opts.TOpts.HostPorts,
+				CallerOverride: opts.TOpts.CallerOverride,
+				HostHeader:     opts.TOpts.HostHeader,
+				Resolve:        opts.TOpts.Resolve,
+			},
+		}
+		assert.Equal(t, tt.want, got, "%v: unexpected options for %q", tt.msg, cmd)
+	}
+}
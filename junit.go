@@ -0,0 +1,179 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/yarpc/yab/sorted"
+)
+
+// junitReport is a JUnit XML report of the checks made by probes and
+// benchmarks, so CI systems can display the results natively. Each probe or
+// benchmark adds a test suite, and the report is written once yab is done.
+type junitReport struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Skipped   int         `xml:"skipped,attr"`
+	Time      float64     `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *struct{}     `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Details string `xml:",chardata"`
+}
+
+// addSuite adds a test suite with the given test cases to the report.
+func (r *junitReport) addSuite(name string, start time.Time, elapsed time.Duration, cases []junitCase) {
+	if r == nil {
+		return
+	}
+
+	suite := junitSuite{
+		Name:      name,
+		Tests:     len(cases),
+		Time:      elapsed.Seconds(),
+		Timestamp: start.Format("2006-01-02T15:04:05"),
+		Cases:     cases,
+	}
+	for _, c := range cases {
+		if c.Failure != nil {
+			suite.Failures++
+		}
+		if c.Skipped != nil {
+			suite.Skipped++
+		}
+	}
+	r.Suites = append(r.Suites, suite)
+}
+
+// writeFile writes the report to file, logging a warning on failure.
+func (r *junitReport) writeFile(file string, logger *logger) {
+	contents, err := xml.MarshalIndent(r, "", "  ")
+	if err == nil {
+		err = ioutil.WriteFile(file, append([]byte(xml.Header), append(contents, '\n')...), 0644)
+	}
+	if err != nil {
+		logger.Warnf("failed to write JUnit report: %v", err)
+	}
+}
+
+// junitCheck counts the failures of a check that is made repeatedly, such
+// as a probe assertion, so it can be reported as a single test case.
+type junitCheck struct {
+	name     string
+	runs     int
+	failures int
+	lastErr  error
+}
+
+func (c *junitCheck) record(err error) {
+	c.runs++
+	if err != nil {
+		c.failures++
+		c.lastErr = err
+	}
+}
+
+// testCase returns a test case which fails if any run of the check failed,
+// and is skipped if the check was never made.
+func (c *junitCheck) testCase(classname string, elapsed time.Duration) junitCase {
+	tc := junitCase{Name: c.name, Classname: classname, Time: elapsed.Seconds()}
+	switch {
+	case c.runs == 0:
+		tc.Skipped = &struct{}{}
+	case c.failures > 0:
+		tc.Failure = &junitFailure{
+			Message: fmt.Sprintf("failed %v of %v times", c.failures, c.runs),
+			Details: fmt.Sprintf("last failure: %v", c.lastErr),
+		}
+	}
+	return tc
+}
+
+// benchmarkJUnitCases returns a test case for each target, which fails if
+// any of the target's requests failed, a test case for each success
+// criterion of each target, which fails if any responses did not meet it,
+// and a test case for each SLO of each target.
+func benchmarkJUnitCases(targets []benchmarkTarget, states []*benchmarkState, success []successCriterion, slos *sloMonitor, total time.Duration) []junitCase {
+	var cases []junitCase
+	for i, target := range targets {
+		s := states[i]
+		errors := countMessages(s.errors)
+		requests := len(s.latencies) + errors
+
+		tc := junitCase{Name: target.name, Classname: target.tOpts.ServiceName, Time: total.Seconds()}
+		if errors > 0 {
+			details := make([]string, 0, len(s.errors))
+			for _, msg := range sorted.MapKeys(s.errors) {
+				details = append(details, fmt.Sprintf("%4d: %v", s.errors[msg], msg))
+			}
+			tc.Failure = &junitFailure{
+				Message: fmt.Sprintf("%v of %v requests failed", errors, requests),
+				Details: strings.Join(details, "\n"),
+			}
+		}
+		cases = append(cases, tc)
+
+		for _, c := range success {
+			// Errors are stored as messages with numbers masked, so match the masked prefix.
+			prefix := errorToMessage(fmt.Errorf("success criterion %v not met", c.expr))
+			unmet := 0
+			for msg, n := range s.errors {
+				if strings.HasPrefix(msg, prefix) {
+					unmet += n
+				}
+			}
+
+			tc := junitCase{Name: target.name + ": " + c.expr, Classname: target.tOpts.ServiceName, Time: total.Seconds()}
+			if unmet > 0 {
+				tc.Failure = &junitFailure{
+					Message: fmt.Sprintf("%v of %v responses did not meet %v", unmet, requests, c.expr),
+				}
+			}
+			cases = append(cases, tc)
+		}
+
+		cases = append(cases, slos.junitCases(target, total)...)
+	}
+	return cases
+}
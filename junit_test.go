@@ -0,0 +1,239 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yarpc/yab/statsd"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJUnitCheck(t *testing.T) {
+	c := &junitCheck{name: "check"}
+	assert.Equal(t, junitCase{Name: "check", Classname: "svc", Time: 1, Skipped: &struct{}{}},
+		c.testCase("svc", time.Second), "Checks that were never made are skipped")
+
+	c.record(nil)
+	assert.Equal(t, junitCase{Name: "check", Classname: "svc", Time: 1}, c.testCase("svc", time.Second))
+
+	c.record(errors.New("bad 1"))
+	c.record(errors.New("bad 2"))
+	assert.Equal(t, &junitFailure{Message: "failed 2 of 3 times", Details: "last failure: bad 2"},
+		c.testCase("svc", time.Second).Failure)
+}
+
+func TestBenchmarkJUnitCases(t *testing.T) {
+	success, err := parseSuccessCriteria([]string{"body.result.count == 10", "body.result.ok == true"})
+	require.NoError(t, err, "Failed to parse success criteria")
+
+	ok := newBenchmarkState(statsd.Noop)
+	ok.recordLatency(time.Millisecond)
+
+	failed := newBenchmarkState(statsd.Noop)
+	failed.recordLatency(time.Millisecond)
+	failed.recordError(fmt.Errorf("success criterion body.result.count == 10 not met: got 20"))
+	failed.recordError(fmt.Errorf("success criterion body.result.count == 10 not met: got 30"))
+	failed.recordError(errors.New("timeout"))
+
+	targets := []benchmarkTarget{
+		{name: "ok", tOpts: TransportOptions{ServiceName: "svc"}},
+		{name: "failed", tOpts: TransportOptions{ServiceName: "svc"}},
+	}
+	cases := benchmarkJUnitCases(targets, []*benchmarkState{ok, failed}, success, nil, time.Second)
+
+	names := make([]string, len(cases))
+	for i, c := range cases {
+		names[i] = c.Name
+		assert.Equal(t, "svc", c.Classname, "Unexpected classname")
+	}
+	assert.Equal(t, []string{
+		"ok", "ok: body.result.count == 10", "ok: body.result.ok == true",
+		"failed", "failed: body.result.count == 10", "failed: body.result.ok == true",
+	}, names, "Unexpected test cases")
+
+	for _, i := range []int{0, 1, 2, 5} {
+		assert.Nil(t, cases[i].Failure, "%v should pass", cases[i].Name)
+	}
+	assert.Equal(t, &junitFailure{
+		Message: "3 of 4 requests failed",
+		Details: "   2: success criterion body.result.count == XX not met: got XX\n   1: timeout",
+	}, cases[3].Failure)
+	assert.Equal(t, &junitFailure{Message: "2 of 4 responses did not meet body.result.count == 10"}, cases[4].Failure)
+}
+
+func TestSLOJUnitCases(t *testing.T) {
+	_, out := getOutput(t)
+	m, err := newSLOMonitor(BenchmarkOptions{SLO: []string{"p99<100ms", "error-rate<=5%"}}, newLogger(Options{}, out))
+	require.NoError(t, err, "Failed to create SLO monitor")
+
+	run := time.Now()
+	for _, points := range [][]resultPoint{
+		{{time: run.Add(time.Second), kind: resultsSample, target: "foo", requests: 10, p99: 50 * time.Millisecond}},
+		{{time: run.Add(2 * time.Second), kind: resultsSample, target: "foo", requests: 10, p99: 150 * time.Millisecond}},
+		{{time: run.Add(3 * time.Second), kind: resultsSample, target: "foo", requests: 10, p99: 80 * time.Millisecond}},
+		{
+			// Summaries are only used for targets without samples.
+			{time: run.Add(3 * time.Second), kind: resultsSummary, target: "foo", requests: 30, errors: 30, p99: time.Millisecond},
+			{time: run.Add(3 * time.Second), kind: resultsSummary, target: "bar", requests: 10, errors: 1, p99: 20 * time.Millisecond},
+		},
+	} {
+		require.NoError(t, m.write(run, points), "Failed to write points")
+	}
+
+	var cases []junitCase
+	for _, name := range []string{"foo", "bar", "baz"} {
+		cases = append(cases, m.junitCases(benchmarkTarget{name: name, tOpts: TransportOptions{ServiceName: "svc"}}, time.Second)...)
+	}
+	require.Len(t, cases, 6, "Expected a test case for each SLO of each target")
+
+	tests := []struct {
+		name    string
+		result  string
+		failed  bool
+		skipped bool
+	}{
+		{name: "foo: SLO p99<100ms", result: "p99 was 150ms, the threshold is < 100ms", failed: true},
+		{name: "foo: SLO error-rate<=5%", result: "error-rate was 0.00%, the threshold is <= 5.00%"},
+		{name: "bar: SLO p99<100ms", result: "p99 was 20ms, the threshold is < 100ms"},
+		{name: "bar: SLO error-rate<=5%", result: "error-rate was 9.09%, the threshold is <= 5.00%", failed: true},
+		{name: "baz: SLO p99<100ms", skipped: true},
+		{name: "baz: SLO error-rate<=5%", skipped: true},
+	}
+	for i, tt := range tests {
+		tc := cases[i]
+		assert.Equal(t, tt.name, tc.Name, "Unexpected test case name")
+		assert.Equal(t, "svc", tc.Classname, "%v: unexpected classname", tt.name)
+		assert.Equal(t, tt.result, tc.SystemOut, "%v: unexpected result", tt.name)
+		assert.Equal(t, tt.skipped, tc.Skipped != nil, "%v: unexpected skipped", tt.name)
+		if tt.failed {
+			assert.Equal(t, &junitFailure{Message: tt.result}, tc.Failure, "%v: unexpected failure", tt.name)
+		} else {
+			assert.Nil(t, tc.Failure, "%v: should not fail", tt.name)
+		}
+	}
+
+	var nilMonitor *sloMonitor
+	assert.Empty(t, nilMonitor.junitCases(benchmarkTarget{name: "foo"}, time.Second), "Expected no test cases without SLOs")
+}
+
+func readJUnit(t *testing.T, file string) junitReport {
+	contents, err := ioutil.ReadFile(file)
+	require.NoError(t, err, "Failed to read JUnit report")
+	assert.Contains(t, string(contents), xml.Header, "Missing XML header")
+
+	var report junitReport
+	require.NoError(t, xml.Unmarshal(contents, &report), "Failed to parse JUnit report")
+	return report
+}
+
+func TestJUnitProbe(t *testing.T) {
+	origArgs := os.Args
+	defer func() { os.Args = origArgs }()
+
+	dir, err := ioutil.TempDir("", "yab-junit")
+	require.NoError(t, err, "TempDir failed")
+	defer os.RemoveAll(dir)
+	junitFile := filepath.Join(dir, "junit.xml")
+
+	echoAddr := echoServer(t, fooMethod, nil)
+	os.Args = []string{
+		"yab", "probe",
+		"-t", validThrift,
+		"foo", fooMethod,
+		"-p", echoAddr,
+		"--interval", "1ms",
+		"--probe-count", "2",
+		"--assert-latency", "1s",
+		"--assert-contains", "nope",
+		"--junit", junitFile,
+	}
+
+	_, out := getOutput(t)
+	parseAndRun(out)
+
+	report := readJUnit(t, junitFile)
+	require.Len(t, report.Suites, 1, "Expected a single suite")
+	suite := report.Suites[0]
+	assert.Equal(t, "yab probe", suite.Name)
+	assert.Equal(t, 3, suite.Tests, "Unexpected number of tests")
+	assert.Equal(t, 1, suite.Failures, "Unexpected number of failures")
+
+	require.Len(t, suite.Cases, 3, "Unexpected test cases")
+	assert.Equal(t, junitCase{Name: fooMethod, Classname: "foo", Time: suite.Cases[0].Time}, suite.Cases[0])
+	assert.Equal(t, fooMethod+": latency at most 1s", suite.Cases[1].Name)
+	assert.Nil(t, suite.Cases[1].Failure, "Latency assertion should pass")
+	assert.Equal(t, fooMethod+`: body contains "nope"`, suite.Cases[2].Name)
+	assert.Equal(t, &junitFailure{
+		Message: "failed 2 of 2 times",
+		Details: `last failure: response body does not contain "nope"`,
+	}, suite.Cases[2].Failure)
+}
+
+func TestJUnitBenchmark(t *testing.T) {
+	s := newServer(t)
+	defer s.shutdown()
+	// Warm up requests succeed, and all benchmark requests fail.
+	var calls int32
+	s.register(fooMethod, methods.errorIf(func() bool { return atomic.AddInt32(&calls, 1) > warmupRequests }))
+
+	m := benchmarkMethodForTest(t, fooMethod)
+	_, out := getOutput(t)
+	report := &junitReport{}
+	runBenchmark(out, Options{
+		ROpts: RequestOptions{MethodName: fooMethod},
+		BOpts: BenchmarkOptions{
+			MaxRequests: 10,
+			MaxDuration: time.Second,
+			Connections: 1,
+			Concurrency: 1,
+		},
+		TOpts: s.transportOpts(),
+		junit: report,
+	}, m)
+
+	require.Len(t, report.Suites, 1, "Expected a single suite")
+	suite := report.Suites[0]
+	assert.Equal(t, "yab benchmark", suite.Name)
+	assert.Equal(t, 1, suite.Tests, "Unexpected number of tests")
+	require.Len(t, suite.Cases, 1, "Unexpected test cases")
+	assert.Equal(t, fooMethod, suite.Cases[0].Name)
+	if assert.NotNil(t, suite.Cases[0].Failure, "Failed requests should fail the target") {
+		assert.Equal(t, "10 of 10 requests failed", suite.Cases[0].Failure.Message)
+	}
+}
+
+func TestJUnitWriteFileFailure(t *testing.T) {
+	buf, out := getOutput(t)
+	r := &junitReport{}
+	r.writeFile(filepath.Join("does", "not", "exist.xml"), newLogger(Options{}, out))
+	assert.Contains(t, buf.String(), "Warning: failed to write JUnit report: open does/not/exist.xml")
+}
@@ -0,0 +1,248 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	_ "crypto/sha256" // for SHA-256 signatures
+	_ "crypto/sha512" // for SHA-384 and SHA-512 signatures
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yarpc/yab/transport"
+)
+
+var (
+	errJWTClaimsWithoutKey = errors.New("--jwt-claims requires --jwt-sign")
+	errJWTKeyType          = errors.New("the key must be an RSA or ECDSA (P-256, P-384 or P-521) private key")
+)
+
+// jwtSigner mints the self-signed JWTs sent with requests, for services that
+// authenticate callers using JWTs rather than tokens from an OAuth server.
+type jwtSigner struct {
+	alg    string
+	hash   crypto.Hash
+	key    crypto.PrivateKey
+	keyID  string
+	claims map[string]interface{}
+	ttl    time.Duration
+	header string
+	now    func() time.Time
+
+	// perRun reuses a token for every request until half of its TTL has
+	// passed, so the token doesn't expire during long benchmarks.
+	perRun    bool
+	mu        sync.Mutex
+	token     string
+	refreshAt time.Time
+}
+
+// newJWTSigner returns a signer for --jwt-sign, or nil if it's not set.
+func newJWTSigner(opts RequestOptions) (*jwtSigner, error) {
+	if opts.JWTSign == "" {
+		if opts.JWTClaims != "" {
+			return nil, errJWTClaimsWithoutKey
+		}
+		return nil, nil
+	}
+
+	keyPEM, err := ioutil.ReadFile(opts.JWTSign)
+	if err != nil {
+		return nil, err
+	}
+	key, err := parsePrivateKey(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %v: %v", opts.JWTSign, err)
+	}
+
+	s := &jwtSigner{
+		key:    key,
+		keyID:  opts.JWTKeyID,
+		ttl:    opts.JWTTTL,
+		header: opts.JWTHeader,
+		now:    time.Now,
+		perRun: opts.JWTPerRun,
+	}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		s.alg, s.hash = "RS256", crypto.SHA256
+	case *ecdsa.PrivateKey:
+		switch k.Curve.Params().BitSize {
+		case 256:
+			s.alg, s.hash = "ES256", crypto.SHA256
+		case 384:
+			s.alg, s.hash = "ES384", crypto.SHA384
+		case 521:
+			s.alg, s.hash = "ES512", crypto.SHA512
+		default:
+			return nil, errJWTKeyType
+		}
+	default:
+		return nil, errJWTKeyType
+	}
+
+	if opts.JWTClaims != "" {
+		contents, err := ioutil.ReadFile(opts.JWTClaims)
+		if err != nil {
+			return nil, err
+		}
+
+		// Numbers are kept as is, rather than converted to floats.
+		decoder := json.NewDecoder(bytes.NewReader(contents))
+		decoder.UseNumber()
+		if err := decoder.Decode(&s.claims); err != nil {
+			return nil, fmt.Errorf("failed to parse %v as a JSON object: %v", opts.JWTClaims, err)
+		}
+	}
+	return s, nil
+}
+
+// parsePrivateKey returns the first private key in the PEM data, which may
+// also contain other blocks, such as EC PARAMETERS.
+func parsePrivateKey(data []byte) (crypto.PrivateKey, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("no private key found")
+		}
+
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			return x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			return x509.ParseECPrivateKey(block.Bytes)
+		case "PRIVATE KEY":
+			return x509.ParsePKCS8PrivateKey(block.Bytes)
+		}
+	}
+}
+
+// String describes how tokens are signed and sent.
+func (s *jwtSigner) String() string {
+	mint := "a token per request"
+	if s.perRun {
+		mint = fmt.Sprintf("a shared token renewed every %v", s.ttl/2)
+	}
+	return fmt.Sprintf("%v in %v, %v", s.alg, s.header, mint)
+}
+
+// apply returns a copy of req with a token in the configured header.
+// The Authorization header uses the Bearer scheme.
+func (s *jwtSigner) apply(req *transport.Request) (*transport.Request, error) {
+	token, err := s.mint()
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign JWT: %v", err)
+	}
+
+	if strings.EqualFold(s.header, "Authorization") {
+		token = "Bearer " + token
+	}
+	return withHeader(req, s.header, token), nil
+}
+
+// mint returns a new token, or the shared token with --jwt-per-run.
+// The iat, exp and jti claims are set unless the claims file sets them. The
+// jti is a UUID from crypto/rand, so a rerun with the same --seed doesn't
+// repeat values that services with replay protection would reject.
+func (s *jwtSigner) mint() (string, error) {
+	if s.perRun {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.token != "" && s.now().Before(s.refreshAt) {
+			return s.token, nil
+		}
+	}
+
+	now := s.now()
+	claims := map[string]interface{}{
+		"iat": now.Unix(),
+		"exp": now.Add(s.ttl).Unix(),
+		"jti": templateUUID(),
+	}
+	for k, v := range s.claims {
+		claims[k] = v
+	}
+
+	header := map[string]string{"alg": s.alg, "typ": "JWT"}
+	if s.keyID != "" {
+		header["kid"] = s.keyID
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	sig, err := s.sign([]byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+
+	token := signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+	if s.perRun {
+		s.token = token
+		s.refreshAt = now.Add(s.ttl / 2)
+	}
+	return token, nil
+}
+
+func (s *jwtSigner) sign(input []byte) ([]byte, error) {
+	h := s.hash.New()
+	h.Write(input)
+	digest := h.Sum(nil)
+
+	switch key := s.key.(type) {
+	case *rsa.PrivateKey:
+		return rsa.SignPKCS1v15(rand.Reader, key, s.hash, digest)
+	case *ecdsa.PrivateKey:
+		r, ss, err := ecdsa.Sign(rand.Reader, key, digest)
+		if err != nil {
+			return nil, err
+		}
+
+		// JWS uses the fixed-size concatenation of r and s, not ASN.1.
+		size := (key.Curve.Params().BitSize + 7) / 8
+		sig := make([]byte, 2*size)
+		rBytes, sBytes := r.Bytes(), ss.Bytes()
+		copy(sig[size-len(rBytes):size], rBytes)
+		copy(sig[2*size-len(sBytes):], sBytes)
+		return sig, nil
+	}
+	return nil, errJWTKeyType
+}
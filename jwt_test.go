@@ -0,0 +1,358 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	mathrand "math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yarpc/yab/encoding"
+	"github.com/yarpc/yab/transport"
+)
+
+var jwtTestNow = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func writeKeyFile(t *testing.T, blocks ...*pem.Block) string {
+	var contents []byte
+	for _, b := range blocks {
+		contents = append(contents, pem.EncodeToMemory(b)...)
+	}
+	return writeFile(t, "jwt-key", string(contents))
+}
+
+func newECKeyFile(t *testing.T, curve elliptic.Curve) (string, crypto.PublicKey) {
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	require.NoError(t, err, "GenerateKey failed")
+	der, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err, "MarshalECPrivateKey failed")
+
+	// openssl ecparam -genkey includes the curve parameters before the key.
+	return writeKeyFile(t,
+		&pem.Block{Type: "EC PARAMETERS", Bytes: []byte{0x06, 0x08}},
+		&pem.Block{Type: "EC PRIVATE KEY", Bytes: der},
+	), &key.PublicKey
+}
+
+func newRSAKeyFile(t *testing.T, pkcs8 bool) (string, crypto.PublicKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err, "GenerateKey failed")
+	if !pkcs8 {
+		return writeKeyFile(t, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), &key.PublicKey
+	}
+
+	der, err := asn1.Marshal(struct {
+		Version    int
+		Algorithm  pkix.AlgorithmIdentifier
+		PrivateKey []byte
+	}{
+		Algorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}, // rsaEncryption
+			Parameters: asn1.RawValue{Tag: asn1.TagNull},
+		},
+		PrivateKey: x509.MarshalPKCS1PrivateKey(key),
+	})
+	require.NoError(t, err, "failed to marshal PKCS #8 key")
+	return writeKeyFile(t, &pem.Block{Type: "PRIVATE KEY", Bytes: der}), &key.PublicKey
+}
+
+// verifyJWT checks the token's signature, and returns its header and claims.
+func verifyJWT(t *testing.T, token string, pub crypto.PublicKey) (header, claims map[string]interface{}) {
+	parts := strings.Split(token, ".")
+	require.Len(t, parts, 3, "token should have 3 parts")
+
+	decode := func(part string, v interface{}) {
+		bs, err := base64.RawURLEncoding.DecodeString(part)
+		require.NoError(t, err, "failed to decode token part")
+		if v != nil {
+			require.NoError(t, json.Unmarshal(bs, v), "failed to unmarshal token part")
+		}
+	}
+	decode(parts[0], &header)
+	decode(parts[1], &claims)
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	require.NoError(t, err, "failed to decode signature")
+
+	hashes := map[string]crypto.Hash{"RS256": crypto.SHA256, "ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512}
+	hash := hashes[header["alg"].(string)]
+	h := hash.New()
+	h.Write([]byte(parts[0] + "." + parts[1]))
+	digest := h.Sum(nil)
+
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		assert.NoError(t, rsa.VerifyPKCS1v15(pub, hash, digest, sig), "invalid RSA signature")
+	case *ecdsa.PublicKey:
+		size := len(sig) / 2
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		assert.True(t, ecdsa.Verify(pub, digest, r, s), "invalid ECDSA signature")
+	default:
+		t.Fatalf("unexpected public key type %T", pub)
+	}
+	return header, claims
+}
+
+func TestNewJWTSignerErrors(t *testing.T) {
+	p224Key, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	require.NoError(t, err, "GenerateKey failed")
+	p224DER, err := x509.MarshalECPrivateKey(p224Key)
+	require.NoError(t, err, "MarshalECPrivateKey failed")
+	p224File := writeKeyFile(t, &pem.Block{Type: "EC PRIVATE KEY", Bytes: p224DER})
+	defer os.Remove(p224File)
+
+	keyFile, _ := newECKeyFile(t, elliptic.P256())
+	defer os.Remove(keyFile)
+	certFile := writeKeyFile(t, &pem.Block{Type: "CERTIFICATE", Bytes: []byte{1}})
+	defer os.Remove(certFile)
+	badClaims := writeFile(t, "claims", `["not", "an", "object"]`)
+	defer os.Remove(badClaims)
+
+	tests := []struct {
+		msg     string
+		opts    RequestOptions
+		wantErr string
+	}{
+		{
+			msg: "not enabled",
+		},
+		{
+			msg:     "claims without key",
+			opts:    RequestOptions{JWTClaims: "claims.json"},
+			wantErr: errJWTClaimsWithoutKey.Error(),
+		},
+		{
+			msg:     "missing key",
+			opts:    RequestOptions{JWTSign: "/fake/key.pem"},
+			wantErr: "no such file",
+		},
+		{
+			msg:     "no private key",
+			opts:    RequestOptions{JWTSign: certFile},
+			wantErr: "no private key found",
+		},
+		{
+			msg:     "unsupported curve",
+			opts:    RequestOptions{JWTSign: p224File},
+			wantErr: errJWTKeyType.Error(),
+		},
+		{
+			msg:     "missing claims",
+			opts:    RequestOptions{JWTSign: keyFile, JWTClaims: "/fake/claims.json"},
+			wantErr: "no such file",
+		},
+		{
+			msg:     "claims not an object",
+			opts:    RequestOptions{JWTSign: keyFile, JWTClaims: badClaims},
+			wantErr: "as a JSON object",
+		},
+	}
+
+	for _, tt := range tests {
+		s, err := newJWTSigner(tt.opts)
+		if tt.wantErr == "" {
+			assert.NoError(t, err, "%v: unexpected error", tt.msg)
+			assert.Nil(t, s, "%v: expected no signer", tt.msg)
+			continue
+		}
+		if assert.Error(t, err, "%v: expected error", tt.msg) {
+			assert.Contains(t, err.Error(), tt.wantErr, "%v: unexpected error", tt.msg)
+		}
+	}
+}
+
+func TestJWTSignerMint(t *testing.T) {
+	claimsFile := writeFile(t, "claims", `{"iss": "yab", "aud": ["svc"], "exp": 1893456000, "n": 12345678901234567890}`)
+	defer os.Remove(claimsFile)
+
+	rsaFile, rsaPub := newRSAKeyFile(t, false /* pkcs8 */)
+	defer os.Remove(rsaFile)
+	pkcs8File, pkcs8Pub := newRSAKeyFile(t, true /* pkcs8 */)
+	defer os.Remove(pkcs8File)
+	p256File, p256Pub := newECKeyFile(t, elliptic.P256())
+	defer os.Remove(p256File)
+	p384File, p384Pub := newECKeyFile(t, elliptic.P384())
+	defer os.Remove(p384File)
+	p521File, p521Pub := newECKeyFile(t, elliptic.P521())
+	defer os.Remove(p521File)
+
+	tests := []struct {
+		keyFile string
+		pub     crypto.PublicKey
+		wantAlg string
+	}{
+		{rsaFile, rsaPub, "RS256"},
+		{pkcs8File, pkcs8Pub, "RS256"},
+		{p256File, p256Pub, "ES256"},
+		{p384File, p384Pub, "ES384"},
+		{p521File, p521Pub, "ES512"},
+	}
+
+	for _, tt := range tests {
+		s, err := newJWTSigner(RequestOptions{
+			JWTSign:   tt.keyFile,
+			JWTClaims: claimsFile,
+			JWTKeyID:  "key-1",
+			JWTTTL:    time.Minute,
+			JWTHeader: "Authorization",
+		})
+		require.NoError(t, err, "%v: newJWTSigner failed", tt.wantAlg)
+		s.now = func() time.Time { return jwtTestNow }
+
+		token, err := s.mint()
+		require.NoError(t, err, "%v: mint failed", tt.wantAlg)
+
+		header, claims := verifyJWT(t, token, tt.pub)
+		assert.Equal(t, map[string]interface{}{"alg": tt.wantAlg, "typ": "JWT", "kid": "key-1"}, header, "%v: unexpected header", tt.wantAlg)
+		assert.Equal(t, "yab", claims["iss"], "%v: claims from the file should be used", tt.wantAlg)
+		assert.Equal(t, []interface{}{"svc"}, claims["aud"], "%v: claims from the file should be used", tt.wantAlg)
+		assert.Equal(t, float64(1893456000), claims["exp"], "%v: exp from the file should be used", tt.wantAlg)
+		assert.Equal(t, float64(jwtTestNow.Unix()), claims["iat"], "%v: iat should be set", tt.wantAlg)
+		assert.Len(t, claims["jti"], 36, "%v: jti should be a UUID", tt.wantAlg)
+		assert.Contains(t, token, ".eyJ", "%v: token should be base64url encoded JSON", tt.wantAlg)
+	}
+}
+
+func TestJWTSignerJTIIgnoresSeed(t *testing.T) {
+	keyFile, pub := newECKeyFile(t, elliptic.P256())
+	defer os.Remove(keyFile)
+
+	s, err := newJWTSigner(RequestOptions{JWTSign: keyFile, JWTTTL: time.Minute, JWTHeader: "Authorization"})
+	require.NoError(t, err, "newJWTSigner failed")
+
+	jti := func() interface{} {
+		mathrand.Seed(1)
+		token, err := s.mint()
+		require.NoError(t, err, "mint failed")
+		_, claims := verifyJWT(t, token, pub)
+		return claims["jti"]
+	}
+	assert.NotEqual(t, jti(), jti(), "jti should differ between runs with the same seed")
+}
+
+func TestJWTSignerApply(t *testing.T) {
+	keyFile, pub := newECKeyFile(t, elliptic.P256())
+	defer os.Remove(keyFile)
+
+	req := &transport.Request{Method: "foo", Headers: map[string]string{"a": "b"}}
+
+	s, err := newJWTSigner(RequestOptions{JWTSign: keyFile, JWTTTL: time.Minute, JWTHeader: "authorization"})
+	require.NoError(t, err, "newJWTSigner failed")
+	s.now = func() time.Time { return jwtTestNow }
+	assert.Equal(t, "ES256 in authorization, a token per request", s.String(), "unexpected description")
+
+	first, err := s.apply(req)
+	require.NoError(t, err, "apply failed")
+	second, err := s.apply(req)
+	require.NoError(t, err, "apply failed")
+
+	assert.Equal(t, map[string]string{"a": "b"}, req.Headers, "original request should not be modified")
+	require.True(t, strings.HasPrefix(first.Headers["authorization"], "Bearer "), "Authorization should use the Bearer scheme")
+	assert.NotEqual(t, first.Headers["authorization"], second.Headers["authorization"], "each request should get a new token")
+
+	_, claims := verifyJWT(t, strings.TrimPrefix(first.Headers["authorization"], "Bearer "), pub)
+	assert.Equal(t, float64(jwtTestNow.Add(time.Minute).Unix()), claims["exp"], "exp should be set from the TTL")
+
+	s, err = newJWTSigner(RequestOptions{JWTSign: keyFile, JWTTTL: time.Minute, JWTHeader: "X-Service-Token", JWTPerRun: true})
+	require.NoError(t, err, "newJWTSigner failed")
+	assert.Equal(t, "ES256 in X-Service-Token, a shared token renewed every 30s", s.String(), "unexpected description")
+
+	now := jwtTestNow
+	s.now = func() time.Time { return now }
+	first, err = s.apply(req)
+	require.NoError(t, err, "apply failed")
+	now = now.Add(29 * time.Second)
+	second, err = s.apply(req)
+	require.NoError(t, err, "apply failed")
+	assert.Equal(t, first.Headers["X-Service-Token"], second.Headers["X-Service-Token"], "--jwt-per-run should reuse the token")
+	verifyJWT(t, first.Headers["X-Service-Token"], pub)
+
+	// The token is renewed after half of its TTL, before it expires.
+	now = now.Add(time.Second)
+	third, err := s.apply(req)
+	require.NoError(t, err, "apply failed")
+	assert.NotEqual(t, first.Headers["X-Service-Token"], third.Headers["X-Service-Token"], "--jwt-per-run should renew the token")
+	_, claims = verifyJWT(t, third.Headers["X-Service-Token"], pub)
+	assert.Equal(t, float64(now.Add(time.Minute).Unix()), claims["exp"], "the renewed token should expire a TTL after it's minted")
+}
+
+func TestBenchmarkJWT(t *testing.T) {
+	keyFile, _ := newECKeyFile(t, elliptic.P256())
+	defer os.Remove(keyFile)
+
+	var mu sync.Mutex
+	tokens := make(map[string]int)
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		tokens[r.Header.Get("Authorization")]++
+		mu.Unlock()
+		io.WriteString(w, "{}")
+	}))
+	defer svr.Close()
+
+	ropts := RequestOptions{JWTSign: keyFile, JWTTTL: time.Minute, JWTHeader: "Authorization"}
+	jwt, err := newJWTSigner(ropts)
+	require.NoError(t, err, "newJWTSigner failed")
+	ropts.jwt = jwt
+
+	serializer := encoding.NewJSON("method")
+	req, err := serializer.Request([]byte("{}"))
+	require.NoError(t, err, "Failed to serialize request")
+	req.Timeout = time.Second
+
+	buf, out := getOutput(t)
+	runBenchmark(out, Options{
+		ROpts: ropts,
+		BOpts: BenchmarkOptions{
+			MaxRequests: 20,
+			MaxDuration: time.Second,
+			Connections: 1,
+			Concurrency: 1,
+		},
+		TOpts: TransportOptions{ServiceName: "foo", HostPorts: []string{svr.URL}},
+	}, benchmarkMethod{serializer: serializer, req: req})
+
+	assert.Contains(t, buf.String(), "JWT: ES256 in Authorization, a token per request", "Missing JWT parameter")
+
+	// Warm up requests don't have a token.
+	delete(tokens, "")
+	assert.Len(t, tokens, 20, "Each request should have a new token")
+}
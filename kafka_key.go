@@ -0,0 +1,70 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"text/template"
+
+	"github.com/yarpc/yab/transport"
+)
+
+// kafkaKeyData is the data that --kafka-key is executed with for each
+// message. Body is the parsed request for JSON requests, and the request
+// as a string otherwise. Seq is the number of the message, starting at 0.
+type kafkaKeyData struct {
+	Body interface{}
+	Seq  int64
+}
+
+// kafkaKeySeq is shared by all transports, so benchmarks using multiple
+// connections don't reuse sequence numbers.
+var kafkaKeySeq int64 = -1
+
+// newKafkaKey parses the --kafka-key template, and returns a function that
+// executes it for each message. It returns nil if there is no template.
+func newKafkaKey(tmplText string) (func(*transport.Request) ([]byte, error), error) {
+	if tmplText == "" {
+		return nil, nil
+	}
+
+	// Fail on missing fields, rather than using "<no value>" as the key.
+	tmpl, err := template.New("kafka-key").Option("missingkey=error").Parse(tmplText)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Kafka key template: %v", err)
+	}
+
+	return func(r *transport.Request) ([]byte, error) {
+		data := kafkaKeyData{Seq: atomic.AddInt64(&kafkaKeySeq, 1)}
+		if err := json.Unmarshal(r.Body, &data.Body); err != nil {
+			data.Body = string(r.Body)
+		}
+
+		buf := &bytes.Buffer{}
+		if err := tmpl.Execute(buf, data); err != nil {
+			return nil, fmt.Errorf("failed to execute Kafka key template: %v", err)
+		}
+		return buf.Bytes(), nil
+	}, nil
+}
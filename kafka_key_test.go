@@ -0,0 +1,78 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yarpc/yab/transport"
+)
+
+func TestKafkaKey(t *testing.T) {
+	tests := []struct {
+		tmpl   string
+		body   string
+		want   string
+		errMsg string
+	}{
+		{tmpl: "{{.Body.user.id}}", body: `{"user": {"id": "u1"}}`, want: "u1"},
+		{tmpl: "{{.Body}}", body: "raw bytes", want: "raw bytes"},
+		{tmpl: "{{.Body.missing}}", body: `{"user": {}}`, errMsg: "failed to execute Kafka key template"},
+	}
+
+	for _, tt := range tests {
+		key, err := newKafkaKey(tt.tmpl)
+		require.NoError(t, err, "newKafkaKey(%q) failed", tt.tmpl)
+
+		got, err := key(&transport.Request{Body: []byte(tt.body)})
+		if tt.errMsg != "" {
+			if assert.Error(t, err, "%v: expected error", tt.tmpl) {
+				assert.Contains(t, err.Error(), tt.errMsg, "%v: unexpected error", tt.tmpl)
+			}
+			continue
+		}
+		if assert.NoError(t, err, "%v: failed to execute", tt.tmpl) {
+			assert.Equal(t, tt.want, string(got), "%v: unexpected key", tt.tmpl)
+		}
+	}
+}
+
+func TestKafkaKeySeq(t *testing.T) {
+	key, err := newKafkaKey("{{.Seq}}")
+	require.NoError(t, err, "newKafkaKey failed")
+	other, err := newKafkaKey("{{.Seq}}")
+	require.NoError(t, err, "newKafkaKey failed")
+
+	// Sequence numbers are shared by all transports.
+	first, err := key(&transport.Request{})
+	require.NoError(t, err, "Failed to execute key template")
+	second, err := other(&transport.Request{})
+	require.NoError(t, err, "Failed to execute key template")
+	assert.NotEqual(t, string(first), string(second), "Sequence numbers should not be reused")
+}
+
+func TestKafkaKeyEmpty(t *testing.T) {
+	key, err := newKafkaKey("")
+	assert.NoError(t, err, "newKafkaKey failed")
+	assert.Nil(t, key, "No key function without a template")
+}
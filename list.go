@@ -0,0 +1,66 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/yarpc/yab/thrift"
+)
+
+// runList prints the methods of each service in the Thrift file, and in the
+// files it includes, grouped by the file that defines the service.
+func runList(out output, opts RequestOptions) {
+	if opts.ThriftFile == "" {
+		out.Fatalf("Listing methods requires a Thrift file, specify one using --thrift\n")
+	}
+
+	thriftFile, err := localFile(opts.ThriftFile, opts.ThriftChecksum)
+	if err != nil {
+		out.Fatalf("Could not load Thrift file: %v\n", err)
+	}
+
+	parsed, err := thrift.Parse(thriftFile)
+	if err != nil {
+		out.Fatalf("Could not parse Thrift file: %v\n", err)
+	}
+
+	// Included files are shown relative to the Thrift file.
+	dir := filepath.Dir(parsed.ThriftPath)
+	lastFile := ""
+	for _, svc := range thrift.Services(parsed) {
+		if svc.File != lastFile {
+			if lastFile != "" {
+				out.Printf("\n")
+			}
+			lastFile = svc.File
+
+			file := filepath.Base(svc.File)
+			if rel, err := filepath.Rel(dir, svc.File); err == nil {
+				file = rel
+			}
+			out.Printf("%v:\n", file)
+		}
+		for _, method := range svc.Methods() {
+			out.Printf("  %v\n", method)
+		}
+	}
+}
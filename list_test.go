@@ -0,0 +1,107 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yab-list")
+	require.NoError(t, err, "TempDir failed")
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "common"), 0755), "Mkdir failed")
+	files := map[string]string{
+		"main.thrift": `
+			include "./common/shared.thrift"
+			service Users {
+				void get()
+				void put()
+			}
+		`,
+		"common/shared.thrift": `
+			service Health {
+				bool check()
+			}
+		`,
+	}
+	for name, contents := range files {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644), "WriteFile failed")
+	}
+
+	buf, out := getOutput(t)
+	runList(out, RequestOptions{ThriftFile: filepath.Join(dir, "main.thrift")})
+	assert.Equal(t, `main.thrift:
+  Users::get
+  Users::put
+
+common/shared.thrift:
+  shared.Health::check
+`, buf.String())
+}
+
+func TestRunListErrors(t *testing.T) {
+	tests := []struct {
+		thriftFile string
+		want       string
+	}{
+		{"", "Listing methods requires a Thrift file"},
+		{"/does/not/exist.thrift", "Could not parse Thrift file"},
+		{"testdata/invalid.json", "Could not parse Thrift file"},
+	}
+
+	for _, tt := range tests {
+		buf, _ := getOutput(t)
+		var fatal string
+		out := testOutput{
+			Buffer: buf,
+			fatalf: func(format string, args ...interface{}) {
+				fatal = fmt.Sprintf(format, args...)
+			},
+		}
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			runList(out, RequestOptions{ThriftFile: tt.thriftFile})
+		}()
+		<-done
+		assert.Contains(t, fatal, tt.want, "Unexpected error for %q", tt.thriftFile)
+	}
+}
+
+func TestListCommand(t *testing.T) {
+	origArgs := os.Args
+	defer func() { os.Args = origArgs }()
+
+	os.Args = []string{"yab", "-t", validThrift, "--list"}
+	buf, out := getOutput(t)
+	parseAndRun(out)
+	assert.Contains(t, buf.String(), "simple.thrift:\n  Simple::bar\n", "Unexpected output: %v", buf.String())
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const sineProfilePrefix = "sine:"
+
+var (
+	errSineProfile     = errors.New("sine load profile must be sine:MIN:MAX:PERIOD, e.g. sine:100:1000:1m")
+	errNoProfilePoints = errors.New("load profile file must contain at least one time,rps line")
+)
+
+// loadProfile returns the RPS to use at a time since the benchmark started.
+type loadProfile func(elapsed time.Duration) float64
+
+// profilePoint is the RPS at a time in a load profile file.
+type profilePoint struct {
+	at  time.Duration
+	rps float64
+}
+
+// parseLoadProfile parses a sine wave, sine:MIN:MAX:PERIOD, or the path of
+// a CSV file of time,rps lines.
+func parseLoadProfile(s string) (loadProfile, error) {
+	if strings.HasPrefix(s, sineProfilePrefix) {
+		return parseSineProfile(strings.TrimPrefix(s, sineProfilePrefix))
+	}
+	return loadProfileFile(s)
+}
+
+// parseSineProfile returns a sine wave that starts at the minimum RPS, and
+// reaches the maximum RPS half way through each period.
+func parseSineProfile(s string) (loadProfile, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return nil, errSineProfile
+	}
+
+	min, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return nil, errSineProfile
+	}
+	max, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return nil, errSineProfile
+	}
+	period, err := time.ParseDuration(parts[2])
+	if err != nil || period <= 0 || min < 0 || max < min {
+		return nil, errSineProfile
+	}
+
+	return func(elapsed time.Duration) float64 {
+		phase := 2 * math.Pi * float64(elapsed) / float64(period)
+		return min + (max-min)*(1-math.Cos(phase))/2
+	}, nil
+}
+
+// loadProfileFile reads a CSV file of time,rps lines, such as 30s,500. The
+// RPS changes linearly between lines, so a step is two lines with the same
+// time. The RPS before the first line is the first RPS, and after the last
+// line is the last RPS.
+func loadProfileFile(path string) (loadProfile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open load profile: %v", err)
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = 2
+	r.TrimLeadingSpace = true
+	r.Comment = '#'
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse load profile: %v", err)
+	}
+	if len(records) == 0 {
+		return nil, errNoProfilePoints
+	}
+
+	points := make([]profilePoint, len(records))
+	for i, record := range records {
+		at, err := time.ParseDuration(record[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid time on line %v of load profile: %v", i+1, err)
+		}
+		rps, err := strconv.ParseFloat(record[1], 64)
+		if err != nil || rps < 0 {
+			return nil, fmt.Errorf("invalid rps on line %v of load profile: %q", i+1, record[1])
+		}
+		if i > 0 && at < points[i-1].at {
+			return nil, fmt.Errorf("times in load profile must be in order, but %v is before %v", at, points[i-1].at)
+		}
+		points[i] = profilePoint{at, rps}
+	}
+
+	return func(elapsed time.Duration) float64 {
+		// Find the first point after elapsed, so steps use the later RPS.
+		i := sort.Search(len(points), func(i int) bool { return points[i].at > elapsed })
+		if i == 0 {
+			return points[0].rps
+		}
+		if i == len(points) {
+			return points[i-1].rps
+		}
+
+		from, to := points[i-1], points[i]
+		progress := float64(elapsed-from.at) / float64(to.at-from.at)
+		return from.rps + (to.rps-from.rps)*progress
+	}, nil
+}
+
+// scaled returns the profile scaled by weight/totalWeight, for a target's
+// share of the load.
+func (p loadProfile) scaled(weight, totalWeight int) loadProfile {
+	return func(elapsed time.Duration) float64 {
+		return p(elapsed) * float64(weight) / float64(totalWeight)
+	}
+}
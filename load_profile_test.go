@@ -0,0 +1,182 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLoadProfile(t *testing.T) {
+	type sample struct {
+		at  time.Duration
+		rps float64
+	}
+
+	tests := []struct {
+		msg     string
+		profile string
+		file    string
+		want    []sample
+		wantErr string
+	}{
+		{
+			msg:     "sine wave",
+			profile: "sine:100:300:1m",
+			want: []sample{
+				{0, 100},
+				{15 * time.Second, 200},
+				{30 * time.Second, 300},
+				{45 * time.Second, 200},
+				{time.Minute, 100},
+			},
+		},
+		{
+			msg:     "sine wave missing period",
+			profile: "sine:100:300",
+			wantErr: errSineProfile.Error(),
+		},
+		{
+			msg:     "sine wave with max below min",
+			profile: "sine:300:100:1m",
+			wantErr: errSineProfile.Error(),
+		},
+		{
+			msg:     "sine wave with invalid period",
+			profile: "sine:100:300:1",
+			wantErr: errSineProfile.Error(),
+		},
+		{
+			msg:  "ramp and step",
+			file: "# ramp up, then spike\n0s,100\n10s,200\n20s, 200\n20s, 1000\n",
+			want: []sample{
+				{0, 100},
+				{5 * time.Second, 150},
+				{10 * time.Second, 200},
+				{19 * time.Second, 200},
+				{20 * time.Second, 1000},
+				{time.Hour, 1000},
+			},
+		},
+		{
+			msg:  "first point after the start",
+			file: "10s,50\n20s,150\n",
+			want: []sample{
+				{0, 50},
+				{15 * time.Second, 100},
+			},
+		},
+		{
+			msg:     "empty file",
+			file:    "# nothing\n",
+			wantErr: errNoProfilePoints.Error(),
+		},
+		{
+			msg:     "invalid time",
+			file:    "0s,100\nsoon,200\n",
+			wantErr: "invalid time on line 2 of load profile",
+		},
+		{
+			msg:     "negative rps",
+			file:    "0s,-1\n",
+			wantErr: `invalid rps on line 1 of load profile: "-1"`,
+		},
+		{
+			msg:     "times out of order",
+			file:    "10s,100\n5s,200\n",
+			wantErr: "times in load profile must be in order, but 5s is before 10s",
+		},
+		{
+			msg:     "wrong number of fields",
+			file:    "0s,100,200\n",
+			wantErr: "failed to parse load profile",
+		},
+		{
+			msg:     "missing file",
+			profile: "testdata/missing.csv",
+			wantErr: "failed to open load profile",
+		},
+	}
+
+	for _, tt := range tests {
+		profile := tt.profile
+		if tt.file != "" {
+			profile = writeFile(t, "profile", tt.file)
+			defer os.Remove(profile)
+		}
+
+		got, err := parseLoadProfile(profile)
+		if tt.wantErr != "" {
+			if assert.Error(t, err, "%v: expected error", tt.msg) {
+				assert.Contains(t, err.Error(), tt.wantErr, "%v: unexpected error", tt.msg)
+			}
+			continue
+		}
+
+		require.NoError(t, err, "%v: failed to parse", tt.msg)
+		for _, s := range tt.want {
+			assert.InDelta(t, s.rps, got(s.at), 0.001, "%v: unexpected RPS at %v", tt.msg, s.at)
+		}
+	}
+}
+
+func TestLoadProfileScaled(t *testing.T) {
+	p, err := parseLoadProfile("sine:100:300:1m")
+	require.NoError(t, err, "Failed to parse load profile")
+	assert.InDelta(t, 75, p.scaled(3, 4)(0), 0.001, "Unexpected scaled RPS")
+}
+
+func TestBenchmarkLoadProfile(t *testing.T) {
+	var requests int32
+	s := newServer(t)
+	defer s.shutdown()
+	s.register(fooMethod, methods.errorIf(func() bool {
+		atomic.AddInt32(&requests, 1)
+		return false
+	}))
+
+	// 200 RPS for 300ms, then no requests.
+	profile := writeFile(t, "profile", "0s,200\n300ms,200\n300ms,0\n")
+	defer os.Remove(profile)
+
+	m := benchmarkMethodForTest(t, fooMethod)
+	buf, out := getOutput(t)
+	runBenchmark(out, Options{
+		BOpts: BenchmarkOptions{
+			MaxRequests: 10000,
+			MaxDuration: 600 * time.Millisecond,
+			Connections: 2,
+			Concurrency: 2,
+			LoadProfile: profile,
+		},
+		TOpts: s.transportOpts(),
+	}, m)
+
+	assert.Contains(t, buf.String(), "Load profile:", "Expected load profile parameters")
+
+	// Due to warm up, we make 10 * Connections extra requests.
+	assert.InDelta(t, 60+10*2, atomic.LoadInt32(&requests), 10, "Unexpected number of requests")
+}
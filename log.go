@@ -0,0 +1,130 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The list of supported --log-format formats.
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// logLevel is the severity of a diagnostic message.
+type logLevel string
+
+// The list of log levels.
+const (
+	levelInfo  logLevel = "info"
+	levelWarn  logLevel = "warn"
+	levelError logLevel = "error"
+)
+
+// levelPrefixes are used to prefix messages for the text format.
+var levelPrefixes = map[logLevel]string{
+	levelInfo: "Note: ",
+	levelWarn: "Warning: ",
+}
+
+// logger prints diagnostics, such as notes and warnings, which are not
+// part of the results. Messages should not end with a new line.
+type logger struct {
+	printf func(format string, args ...interface{})
+	json   bool
+	now    func() time.Time
+}
+
+// newLogger returns a logger for the given options. Diagnostics are printed
+// with the results, unless the results are machine-readable, or the log
+// format is JSON, where they are printed to stderr.
+func newLogger(opts Options, out output) *logger {
+	l := &logger{
+		printf: out.Printf,
+		json:   opts.LogFormat == logFormatJSON,
+		now:    time.Now,
+	}
+	if l.json || opts.OutputFormat == jsonOutputFormat || opts.OutputTemplate != "" ||
+		opts.Export != "" || opts.Generate != "" || opts.ExportResponseSchema {
+		l.printf = out.Warnf
+	}
+	return l
+}
+
+func (l *logger) Infof(format string, args ...interface{}) {
+	l.log(levelInfo, format, args...)
+}
+
+func (l *logger) Warnf(format string, args ...interface{}) {
+	l.log(levelWarn, format, args...)
+}
+
+func (l *logger) log(level logLevel, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if l.json {
+		l.printf("%s\n", jsonLogLine(l.now(), level, msg))
+		return
+	}
+	l.printf("%s%s\n", levelPrefixes[level], msg)
+}
+
+// jsonLogLine returns a JSON log line for the message.
+// annotationUsed returns a function that logs each Thrift annotation the
+// first time it changes how a value is encoded.
+func (l *logger) annotationUsed() func(name, annotation string) {
+	var mu sync.Mutex
+	seen := make(map[string]struct{})
+	return func(name, annotation string) {
+		key := name + " " + annotation
+		mu.Lock()
+		defer mu.Unlock()
+		if _, ok := seen[key]; ok {
+			return
+		}
+		seen[key] = struct{}{}
+		l.Infof("Thrift annotation %v on %v changed how it was encoded", annotation, name)
+	}
+}
+
+func jsonLogLine(t time.Time, level logLevel, msg string) []byte {
+	line, _ := json.Marshal(struct {
+		Time  string   `json:"time"`
+		Level logLevel `json:"level"`
+		Msg   string   `json:"msg"`
+	}{t.UTC().Format(time.RFC3339Nano), level, msg})
+	return line
+}
+
+// jsonLogOutput is an output that prints fatal errors as JSON log lines.
+type jsonLogOutput struct {
+	output
+	now func() time.Time
+}
+
+func (o jsonLogOutput) Fatalf(format string, args ...interface{}) {
+	msg := strings.TrimSpace(fmt.Sprintf(format, args...))
+	o.output.Fatalf("%s\n", jsonLogLine(o.now(), levelError, msg))
+}
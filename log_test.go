@@ -0,0 +1,110 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogger(t *testing.T) {
+	now := func() time.Time {
+		return time.Date(2016, 5, 1, 12, 30, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		msg          string
+		opts         Options
+		wantOut      string
+		wantWarnings string
+	}{
+		{
+			msg:     "text",
+			wantOut: "Note: matched field \"id\"\nWarning: took 2s\n",
+		},
+		{
+			msg:          "text with JSON output",
+			opts:         Options{OutputFormat: jsonOutputFormat},
+			wantWarnings: "Note: matched field \"id\"\nWarning: took 2s\n",
+		},
+		{
+			msg:          "text with export",
+			opts:         Options{Export: exportPostman},
+			wantWarnings: "Note: matched field \"id\"\nWarning: took 2s\n",
+		},
+		{
+			msg:  "json",
+			opts: Options{LogFormat: logFormatJSON},
+			wantWarnings: `{"time":"2016-05-01T12:30:00Z","level":"info","msg":"matched field \"id\""}` + "\n" +
+				`{"time":"2016-05-01T12:30:00Z","level":"warn","msg":"took 2s"}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		var outBuf, warnBuf bytes.Buffer
+		out := testOutput{Buffer: &outBuf, warnings: &warnBuf, fatalf: t.Errorf}
+
+		logger := newLogger(tt.opts, out)
+		logger.now = now
+		logger.Infof("matched field %q", "id")
+		logger.Warnf("took %v", 2*time.Second)
+
+		assert.Equal(t, tt.wantOut, outBuf.String(), "%v: unexpected stdout", tt.msg)
+		assert.Equal(t, tt.wantWarnings, warnBuf.String(), "%v: unexpected stderr", tt.msg)
+	}
+}
+
+func TestJSONLogOutputFatalf(t *testing.T) {
+	var fatal string
+	out := jsonLogOutput{
+		output: testOutput{
+			Buffer: &bytes.Buffer{},
+			fatalf: func(format string, args ...interface{}) {
+				fatal = fmt.Sprintf(format, args...)
+			},
+		},
+		now: func() time.Time { return time.Date(2016, 5, 1, 12, 30, 0, 0, time.UTC) },
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		out.Fatalf("Failed while parsing options: %v\n", "bad \"value\"")
+	}()
+	<-done
+
+	assert.Equal(t, `{"time":"2016-05-01T12:30:00Z","level":"error","msg":"Failed while parsing options: bad \"value\""}`+"\n", fatal)
+}
+
+func TestLoggerAnnotationUsed(t *testing.T) {
+	buf, out := getOutput(t)
+	annotationUsed := newLogger(Options{}, out).annotationUsed()
+	annotationUsed("Event.created", `js.type = "Date"`)
+	annotationUsed("Event.created", `js.type = "Date"`)
+	annotationUsed("Blob", `yab.format = "base64"`)
+
+	assert.Equal(t, `Note: Thrift annotation js.type = "Date" on Event.created changed how it was encoded`+"\n"+
+		`Note: Thrift annotation yab.format = "base64" on Blob changed how it was encoded`+"\n", buf.String())
+}
@@ -24,9 +24,11 @@ import (
 	"encoding/json"
 	"errors"
 	"log"
+	"math/rand"
 	"os"
 	"time"
 
+	"github.com/yarpc/yab/encoding"
 	"github.com/yarpc/yab/transport"
 
 	"github.com/jessevdk/go-flags"
@@ -60,10 +62,9 @@ func main() {
 	parseAndRun(consoleOutput{os.Stdout})
 }
 
-// parseAndRun is like main, but uses the given output.
-func parseAndRun(out output) {
-	var opts Options
-	parser := flags.NewParser(&opts, flags.HelpFlag|flags.PassDoubleDash)
+// newParser returns a flags parser that parses flags into opts.
+func newParser(opts *Options) *flags.Parser {
+	parser := flags.NewParser(opts, flags.HelpFlag|flags.PassDoubleDash)
 	parser.Usage = "[<service> <method> <body>] [OPTIONS]"
 	parser.ShortDescription = "yet another benchmarker"
 	parser.LongDescription = `
@@ -75,6 +76,29 @@ It can be used in a curl-like fashion when benchmarking features are disabled.
 	findGroup(parser, "transport").ShortDescription = "Transport Options"
 	findGroup(parser, "request").ShortDescription = "Request Options"
 	findGroup(parser, "benchmark").ShortDescription = "Benchmark Options"
+	findGroup(parser, "probe").ShortDescription = "Probe Options (yab probe)"
+	return parser
+}
+
+// parseAndRun is like main, but uses the given output.
+func parseAndRun(out output) {
+	var opts Options
+	parser := newParser(&opts)
+
+	if len(os.Args) > 1 && os.Args[1] == completeCommand {
+		runComplete(parser, &opts, os.Args[2:], out)
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == importCommand {
+		runImport(os.Args[2:], out)
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == idlDiffCommand {
+		runIDLDiff(os.Args[2:], out)
+		return
+	}
 
 	// If there are no arguments specified, write the help.
 	if len(os.Args) <= 1 {
@@ -82,7 +106,13 @@ It can be used in a curl-like fashion when benchmarking features are disabled.
 		return
 	}
 
-	remaining, err := parser.Parse()
+	args := os.Args[1:]
+	if args[0] == probeCommand {
+		opts.POpts.enabled = true
+		args = args[1:]
+	}
+
+	remaining, err := parser.ParseArgs(args)
 	if err != nil {
 		if ferr, ok := err.(*flags.Error); ok {
 			if ferr.Type == flags.ErrHelp {
@@ -93,16 +123,36 @@ It can be used in a curl-like fashion when benchmarking features are disabled.
 		out.Fatalf("Failed to parse flags: %v", err)
 	}
 
+	if opts.LogFormat == logFormatJSON {
+		out = jsonLogOutput{out, time.Now}
+	}
+
 	if opts.DisplayVersion {
 		out.Printf("yab version %v\n", versionString)
 		return
 	}
 
+	if opts.Completion != "" {
+		script, err := completionScript(opts.Completion)
+		if err != nil {
+			out.Fatalf("Failed to generate completion: %v\n", err)
+		}
+		out.Printf("%s", script)
+		return
+	}
+
 	if opts.ManPage {
 		parser.WriteManPage(os.Stdout)
 		return
 	}
 
+	if len(opts.ROpts.Methods) > 0 {
+		opts.ROpts.MethodName = opts.ROpts.Methods[0]
+	}
+	// Positional name=value arguments set arguments of the request, like --arg.
+	remaining, args := splitPositionalArgs(remaining, opts.ROpts)
+	opts.ROpts.Args = append(opts.ROpts.Args, args...)
+
 	fromPositional(remaining, 0, &opts.TOpts.ServiceName)
 	fromPositional(remaining, 1, &opts.ROpts.MethodName)
 
@@ -120,7 +170,75 @@ It can be used in a curl-like fashion when benchmarking features are disabled.
 }
 
 func runWithOptions(opts Options, out output) {
-	reqInput, err := getRequestInput(opts.ROpts.RequestJSON, opts.ROpts.RequestFile)
+	if opts.JUnitFile != "" {
+		opts.junit = &junitReport{}
+		defer opts.junit.writeFile(opts.JUnitFile, newLogger(opts, out))
+	}
+
+	seedRandom(&opts)
+
+	if opts.TOpts.CookieJar != "" {
+		jar, err := loadCookieJar(opts.TOpts.CookieJar)
+		if err != nil {
+			out.Fatalf("Failed to load cookie jar: %v\n", err)
+		}
+		opts.TOpts.cookieJar = jar
+		defer saveCookieJar(jar, opts.TOpts.CookieJar, newLogger(opts, out))
+	} else if opts.TOpts.Cookies {
+		opts.TOpts.cookieJar = newCookieJar()
+	}
+
+	jwt, err := newJWTSigner(opts.ROpts)
+	if err != nil {
+		out.Fatalf("Failed to load --jwt-sign: %v\n", err)
+	}
+	opts.ROpts.jwt = jwt
+
+	if opts.TOpts.TLSCert != "" || opts.TOpts.TLSKey != "" {
+		cert, err := newClientCert(opts.TOpts.TLSCert, opts.TOpts.TLSKey, newLogger(opts, out))
+		if err != nil {
+			out.Fatalf("Failed to load the client certificate: %v\n", err)
+		}
+		opts.TOpts.clientCert = cert
+	}
+
+	if opts.BOpts.PlanFile != "" {
+		if opts.BOpts.TargetsFile != "" {
+			out.Fatalf("Cannot use --plan with --targets\n")
+		}
+		runPlan(out, opts)
+		return
+	}
+
+	if opts.BOpts.TargetsFile != "" {
+		if opts.BOpts.MaxDuration == 0 && opts.Export == "" {
+			out.Fatalf("Benchmarking multiple targets requires --maxDuration\n")
+		}
+
+		targets, err := loadTargets(opts.BOpts.TargetsFile, opts)
+		if err != nil {
+			out.Fatalf("Failed while loading targets: %v\n", err)
+		}
+
+		if opts.Export != "" {
+			reqs := make([]exportRequest, len(targets))
+			for i, target := range targets {
+				reqs[i] = exportRequest{target.name, target.tOpts, target.method.req}
+			}
+			runExport(out, opts, reqs)
+			return
+		}
+
+		runBenchmarkTargets(out, opts, targets)
+		return
+	}
+
+	if len(opts.ROpts.Methods) > 1 || opts.BOpts.AllMethods {
+		runSweep(out, opts)
+		return
+	}
+
+	reqInput, err := getRequestInput(opts.ROpts.RequestJSON, opts.ROpts.RequestFile, opts.ROpts.RequestChecksum)
 	if err != nil {
 		out.Fatalf("Failed while loading body input: %v\n", err)
 	}
@@ -130,41 +248,267 @@ func runWithOptions(opts Options, out output) {
 		out.Fatalf("Failed while loading headers input: %v\n", err)
 	}
 
+	if len(opts.ROpts.Form) > 0 {
+		reqInput, headers, err = applyForm(&opts.ROpts, reqInput, headers)
+		if err != nil {
+			out.Fatalf("Failed while loading form input: %v\n", err)
+		}
+	}
+
+	opts.ROpts.ThriftFile, err = registryThriftFile(opts.ROpts, opts.TOpts.ServiceName)
+	if err != nil {
+		out.Fatalf("Failed while fetching IDL from registry: %v\n", err)
+	}
+
+	if opts.ListMethods {
+		runList(out, opts.ROpts)
+		return
+	}
+
+	outputTemplate, err := parseOutputTemplate(opts)
+	if err != nil {
+		out.Fatalf("Failed while parsing options: %v\n", err)
+	}
+
+	logger := newLogger(opts, out)
+	if opts.Verbose {
+		opts.ROpts.fieldResolved = func(key, field string) {
+			logger.Infof("request key %q matched field %q", key, field)
+		}
+	}
+	if opts.ROpts.ShowAnnotations {
+		opts.ROpts.annotationUsed = logger.annotationUsed()
+	}
+
 	serializer, err := NewSerializer(opts.ROpts)
 	if err != nil {
 		out.Fatalf("Failed while parsing input: %v\n", err)
 	}
 
+	if len(opts.ROpts.Patch) > 0 || len(opts.ROpts.Set) > 0 {
+		if reqInput, err = patchRequest(serializer, reqInput, opts.ROpts.Patch, opts.ROpts.Set); err != nil {
+			out.Fatalf("Failed while patching the request: %v\n", err)
+		}
+	}
+	if len(opts.ROpts.Args) > 0 {
+		if reqInput, err = applyArgs(serializer, reqInput, opts.ROpts.Args); err != nil {
+			out.Fatalf("Failed while parsing --arg: %v\n", err)
+		}
+	}
+
+	if opts.ExportResponseSchema {
+		schema, err := encoding.ResponseSchema(serializer)
+		if err != nil {
+			out.Fatalf("Failed while exporting response schema: %v\n", err)
+		}
+		bs, err := json.MarshalIndent(schema, "", "  ")
+		if err != nil {
+			out.Fatalf("Failed to convert response schema to JSON: %v\n", err)
+		}
+		out.Printf("%s\n", bs)
+		return
+	}
+
+	timeout := opts.ROpts.Timeout.Duration()
+	if timeout == 0 {
+		timeout = time.Second
+	}
+
+	// req is the transport.Request that will be used to make a call.
+	var req *transport.Request
+	var reqTemplate *requestTemplate
+	if opts.ROpts.Template {
+		reqTemplate, err = newRequestTemplate(serializer, reqInput, headers, opts.TOpts.HashField, timeout)
+		if err != nil {
+			out.Fatalf("Failed while parsing request input: %v\n", err)
+		}
+		if req, err = reqTemplate.next(); err != nil {
+			out.Fatalf("Failed while parsing request input: %v\n", err)
+		}
+	} else {
+		req, err = serializer.Request(reqInput)
+		if err != nil {
+			out.Fatalf("Failed while parsing request input: %v\n", err)
+		}
+
+		if opts.TOpts.HashField != "" {
+			req.ShardKey, err = getShardKey(reqInput, opts.TOpts.HashField)
+			if err != nil {
+				out.Fatalf("Failed while parsing request input: %v\n", err)
+			}
+		}
+
+		req.Headers = headers
+		req.Timeout = timeout
+	}
+	if opts.ROpts.IdempotencyKey != "" {
+		req = withHeader(req, opts.ROpts.IdempotencyHeader, newIdempotencyKey(opts.ROpts.IdempotencyKey))
+	}
+	if opts.ROpts.jwt != nil {
+		if req, err = opts.ROpts.jwt.apply(req); err != nil {
+			out.Fatalf("Failed while making request: %v\n", err)
+		}
+	}
+
+	if opts.Generate != "" {
+		snippet, err := generateSnippet(opts.Generate, opts.TOpts, req)
+		if err != nil {
+			out.Fatalf("Failed while generating %v: %v\n", opts.Generate, err)
+		}
+		out.Printf("%s", snippet)
+		return
+	}
+
+	if opts.Export != "" {
+		runExport(out, opts, []exportRequest{{opts.ROpts.MethodName, opts.TOpts, req}})
+		return
+	}
+
+	if opts.Verbose {
+		opts.TOpts.connectionEvent = func(e transport.ConnectionEvent) {
+			logger.Infof("connection to %v %v", e.Peer, e.Type)
+		}
+		opts.TOpts.tlsHandshake = func(h transport.TLSHandshake) {
+			logger.Infof("TLS handshake with %v took %v, resumed: %v", h.Peer, h.Duration, h.Resumed)
+		}
+	}
+
+	// directOpts are the options to call the service's instances directly,
+	// which are compared to calls through the routers in the benchmark.
+	var directOpts *TransportOptions
+	if opts.TOpts.Discover || opts.TOpts.CompareDirect {
+		if opts.TOpts.Discover && opts.TOpts.CompareDirect {
+			out.Fatalf("Failed while parsing options: %v\n", errDiscoverCompare)
+		}
+		if opts.TOpts.CompareDirect && opts.BOpts.MaxDuration == 0 {
+			out.Fatalf("Failed while parsing options: %v\n", errCompareDirectNoBench)
+		}
+
+		direct, err := directTransportOptions(opts.TOpts, timeout, logger)
+		if err != nil {
+			out.Fatalf("Failed while discovering peers: %v\n", err)
+		}
+		if opts.TOpts.Discover {
+			opts.TOpts = direct
+		} else {
+			directOpts = &direct
+		}
+	}
+
 	// transport abstracts the underlying wire protocol used to make the call.
 	transport, err := getTransport(opts.TOpts, serializer.Encoding())
 	if err != nil {
 		out.Fatalf("Failed while parsing options: %v\n", err)
 	}
 
-	// req is the transport.Request that will be used to make a call.
-	req, err := serializer.Request(reqInput)
-	if err != nil {
-		out.Fatalf("Failed while parsing request input: %v\n", err)
+	if opts.ROpts.LintIDL && serializer.Encoding() == encoding.Thrift {
+		lintServerIDL(logger, transport, opts.ROpts.ThriftFile, req)
 	}
 
-	req.Headers = headers
-	req.Timeout = opts.ROpts.Timeout.Duration()
-	if req.Timeout == 0 {
-		req.Timeout = time.Second
+	if opts.ROpts.Watch > 0 {
+		runWatch(out, opts.ROpts, transport, serializer, req)
+		return
 	}
 
+	if opts.POpts.enabled {
+		runProbe(out, opts, transport, serializer, req)
+		return
+	}
+
+	if opts.ROpts.CancelAfter > 0 {
+		runCancel(out, opts.ROpts, transport, serializer, req)
+		return
+	}
+
+	if opts.ROpts.DeadlineSweep {
+		runDeadlineSweep(out, opts.ROpts, transport, req)
+		return
+	}
+
+	start := time.Now()
 	response, err := makeRequest(transport, req)
 	if err != nil {
 		out.Fatalf("Failed while making call: %v\n", err)
 	}
+	elapsed := time.Since(start)
+
+	if opts.Verbose {
+		for _, r := range response.Redirects {
+			logger.Infof("followed %v redirect to %v", r.StatusCode, r.URL)
+		}
+	}
+
+	switch {
+	case outputTemplate != nil:
+		doc, err := newJSONResponse(serializer, response, elapsed)
+		if err != nil {
+			out.Fatalf("Failed while parsing response: %v\n", err)
+		}
+		output, err := executeOutputTemplate(outputTemplate, doc, elapsed)
+		if err != nil {
+			out.Fatalf("Failed while printing response: %v\n", err)
+		}
+		out.Printf("%s", output)
+	case opts.OutputFormat == jsonOutputFormat:
+		doc, err := newJSONResponse(serializer, response, elapsed)
+		if err != nil {
+			out.Fatalf("Failed while parsing response: %v\n", err)
+		}
+		bs, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			out.Fatalf("Failed to convert response to JSON: %v\n", err)
+		}
+		out.Printf("%s\n", bs)
+	default:
+		// Print the initial output body.
+		outSerialized, err := responseToOutput(serializer, response)
+		if err != nil {
+			out.Fatalf("Failed while parsing response: %v\n", err)
+		}
+		bs, err := json.MarshalIndent(outSerialized, "", "  ")
+		if err != nil {
+			out.Fatalf("Failed to convert map to JSON: %v\nMap: %+v\n", err, outSerialized["body"])
+		}
+		out.Printf("%s\n\n", bs)
+	}
+
+	if opts.ROpts.IdempotencyKey != "" && isReplayed(response) {
+		logger.Warnf("the response was replayed, as the idempotency key %q was already used", req.Headers[opts.ROpts.IdempotencyHeader])
+	}
 
+	if slow := opts.ROpts.SlowWarn; slow > 0 && elapsed > slow {
+		logger.Warnf("response took %v, longer than %v", elapsed, slow)
+	}
+
+	if opts.TOpts.TLSVerbose || opts.TOpts.TLSExpiryDays > 0 {
+		if err := checkTLS(logger, opts.TOpts, response.TLS, time.Now()); err != nil {
+			out.Fatalf("Failed TLS check: %v\n", err)
+		}
+	}
+
+	method := benchmarkMethod{
+		serializer: serializer,
+		req:        req,
+		template:   reqTemplate,
+	}
+	if directOpts != nil {
+		runBenchmarkTargets(out, opts, []benchmarkTarget{
+			{name: "routed", methodName: opts.ROpts.MethodName, weight: 1, method: method, tOpts: opts.TOpts},
+			{name: "direct", methodName: opts.ROpts.MethodName, weight: 1, method: method, tOpts: *directOpts},
+		})
+		return
+	}
+	runBenchmark(out, opts, method)
+}
+
+// responseToOutput converts the response into the map that is displayed to the user.
+func responseToOutput(serializer encoding.Serializer, response *transport.Response) (map[string]interface{}, error) {
 	// responseMap converts the Thrift bytes response to a map.
 	responseMap, err := serializer.Response(response)
 	if err != nil {
-		out.Fatalf("Failed while parsing response: %v\n", err)
+		return nil, err
 	}
 
-	// Print the initial output body.
 	outSerialized := map[string]interface{}{
 		"body": responseMap,
 	}
@@ -174,22 +518,31 @@ func runWithOptions(opts Options, out output) {
 	if response.Trace != "" {
 		outSerialized["trace"] = response.Trace
 	}
-	bs, err := json.MarshalIndent(outSerialized, "", "  ")
-	if err != nil {
-		out.Fatalf("Failed to convert map to JSON: %v\nMap: %+v\n", err, responseMap)
-	}
-	out.Printf("%s\n\n", bs)
+	return outSerialized, nil
+}
 
-	runBenchmark(out, opts, benchmarkMethod{
-		serializer: serializer,
-		req:        req,
-	})
+// seedRandom seeds randomized behavior with --seed, or a random seed if it's
+// not set, which is saved so that benchmarks can print it.
+func seedRandom(opts *Options) {
+	if opts.Seed == 0 {
+		opts.Seed = time.Now().UnixNano()
+	}
+	rand.Seed(opts.Seed)
 }
 
 // makeRequest makes a request using the given transport.
 func makeRequest(t transport.Transport, request *transport.Request) (*transport.Response, error) {
+	res, _, err := makeRequestPeer(t, request)
+	return res, err
+}
+
+// makeRequestPeer makes a request using the given transport, and returns the
+// peer chosen for the call, which is known even if the call fails.
+func makeRequestPeer(t transport.Transport, request *transport.Request) (*transport.Response, string, error) {
 	ctx, cancel := tchannel.NewContext(request.Timeout)
 	defer cancel()
 
-	return t.Call(ctx, request)
+	peerCtx, peer := transport.WithCallPeer(ctx)
+	res, err := t.Call(peerCtx, request)
+	return res, peer.Peer(), err
 }
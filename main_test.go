@@ -238,3 +238,28 @@ func TestVersion(t *testing.T) {
 	parseAndRun(out)
 	assert.Equal(t, "yab version "+versionString+"\n", buf.String(), "Version output mismatch")
 }
+
+func TestSeedRandom(t *testing.T) {
+	chooser := randomChooser{peerSlots(100, nil)}
+	choices := func(seed int64) ([]int, int64) {
+		opts := Options{Seed: seed}
+		seedRandom(&opts)
+
+		var got []int
+		for i := 0; i < 10; i++ {
+			got = append(got, chooser.choose(nil))
+		}
+		return got, opts.Seed
+	}
+
+	first, seed := choices(42)
+	assert.EqualValues(t, 42, seed, "--seed should be used")
+	second, _ := choices(42)
+	assert.Equal(t, first, second, "The same seed should make the same choices")
+
+	_, seed = choices(0)
+	assert.NotEqual(t, 0, seed, "A random seed should be chosen if --seed is not set")
+	replay, _ := choices(seed)
+	again, _ := choices(seed)
+	assert.Equal(t, replay, again, "The chosen seed should reproduce the run")
+}
@@ -25,6 +25,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestTimeMillisFlag(t *testing.T) {
@@ -65,3 +66,98 @@ func TestTimeMillisFlag(t *testing.T) {
 		assert.Equal(t, tt.want, timeMillis.Duration(), "UnmarshalFlag(%v) expected %v", tt.value, tt.want)
 	}
 }
+
+func TestByteSizeFlag(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    byteSize
+		wantErr bool
+	}{
+		{value: "100", want: 100},
+		{value: "100B", want: 100},
+		{value: "2KB", want: 2048},
+		{value: "1mb", want: 1 << 20},
+		{value: "3 GB", want: 3 << 30},
+		{value: "1.5MB", wantErr: true},
+		{value: "-1", wantErr: true},
+		{value: "MB", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		var size byteSize
+
+		err := size.UnmarshalFlag(tt.value)
+		if tt.wantErr {
+			assert.Error(t, err, "UnmarshalFlag(%v) should fail", tt.value)
+			continue
+		}
+
+		assert.NoError(t, err, "UnmarshalFlag(%v) should not fail", tt.value)
+		assert.Equal(t, tt.want, size, "UnmarshalFlag(%v) expected %v", tt.value, tt.want)
+	}
+}
+
+func TestSampleRateFlag(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    float64
+		wantErr bool
+	}{
+		{args: nil, want: 1},
+		{args: []string{"--validate-sample-rate", "1"}, want: 1},
+		{args: []string{"--validate-sample-rate", "0.25"}, want: 0.25},
+		{args: []string{"--validate-sample-rate", "0"}, wantErr: true},
+		{args: []string{"--validate-sample-rate", "1.5"}, wantErr: true},
+		{args: []string{"--validate-sample-rate", "-0.5"}, wantErr: true},
+		{args: []string{"--validate-sample-rate", "all"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		var opts Options
+		_, err := newParser(&opts).ParseArgs(tt.args)
+		if tt.wantErr {
+			if assert.Error(t, err, "ParseArgs(%v) should fail", tt.args) {
+				assert.Contains(t, err.Error(), "must be greater than 0, and at most 1", "ParseArgs(%v) unexpected error", tt.args)
+			}
+			continue
+		}
+
+		assert.NoError(t, err, "ParseArgs(%v) should not fail", tt.args)
+		assert.Equal(t, tt.want, opts.BOpts.ValidateSampleRate.fraction(), "ParseArgs(%v) unexpected value", tt.args)
+	}
+
+	var unset sampleRate
+	assert.Equal(t, 1.0, unset.fraction(), "An unset rate should validate every response")
+}
+
+func TestTCPNoDelayFlag(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{args: nil, want: ""},
+		{args: []string{"--tcp-nodelay"}, want: "true"},
+		{args: []string{"--tcp-nodelay=false"}, want: "false"},
+		{args: []string{"--tcp-nodelay=maybe"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		var opts Options
+		_, err := newParser(&opts).ParseArgs(tt.args)
+		if tt.wantErr {
+			assert.Error(t, err, "ParseArgs(%v) should fail", tt.args)
+			continue
+		}
+
+		assert.NoError(t, err, "ParseArgs(%v) should not fail", tt.args)
+		assert.Equal(t, tt.want, opts.TOpts.TCPNoDelay, "ParseArgs(%v) unexpected value", tt.args)
+	}
+}
+
+func TestMultipleMethods(t *testing.T) {
+	var opts Options
+	_, err := newParser(&opts).ParseArgs([]string{"-m", "Simple::foo", "--method", "Simple::bar"})
+	require.NoError(t, err, "ParseArgs failed")
+	assert.Equal(t, []string{"Simple::foo", "Simple::bar"}, opts.ROpts.Methods, "unexpected methods")
+}
@@ -0,0 +1,186 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"container/heap"
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yarpc/yab/transport"
+)
+
+// maxOutliers is the number of outliers kept in the report. Once there are
+// more outliers, only the slowest are kept.
+const maxOutliers = 1000
+
+// outliers records the details of benchmark calls that took longer than a
+// threshold, so tail latency can be investigated using the peer and trace
+// of the slowest calls.
+type outliers struct {
+	threshold time.Duration
+
+	mu    sync.Mutex
+	total int
+	calls outlierHeap
+}
+
+// outlier is the details of a slow call in the outliers report.
+type outlier struct {
+	Target          string            `json:"target"`
+	Method          string            `json:"method"`
+	Peer            string            `json:"peer,omitempty"`
+	Time            time.Time         `json:"time"`
+	LatencyMs       float64           `json:"latencyMs"`
+	Trace           string            `json:"trace,omitempty"`
+	TraceSampled    bool              `json:"traceSampled,omitempty"`
+	RequestHeaders  map[string]string `json:"requestHeaders,omitempty"`
+	ResponseHeaders map[string]string `json:"responseHeaders,omitempty"`
+
+	latency time.Duration
+}
+
+// outliersReport is the report written at the end of the benchmark.
+type outliersReport struct {
+	ThresholdMs float64    `json:"thresholdMs"`
+	Total       int        `json:"total"`
+	Outliers    []*outlier `json:"outliers"`
+}
+
+// newOutliers returns outliers that records calls slower than threshold,
+// or nil if outliers are not recorded.
+func newOutliers(threshold time.Duration) *outliers {
+	if threshold <= 0 {
+		return nil
+	}
+	return &outliers{threshold: threshold}
+}
+
+// forTarget returns the outlierRecorder used by the workers for a target.
+func (o *outliers) forTarget(name string) *outlierRecorder {
+	if o == nil {
+		return nil
+	}
+	return &outlierRecorder{o, name}
+}
+
+func (o *outliers) add(call *outlier) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.total++
+	if len(o.calls) < maxOutliers {
+		heap.Push(&o.calls, call)
+		return
+	}
+	if call.latency > o.calls[0].latency {
+		o.calls[0] = call
+		heap.Fix(&o.calls, 0)
+	}
+}
+
+// report returns the outliers report, with the slowest calls first.
+func (o *outliers) report() outliersReport {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	calls := make([]*outlier, len(o.calls))
+	copy(calls, o.calls)
+	sort.Sort(sort.Reverse(outlierHeap(calls)))
+	return outliersReport{
+		ThresholdMs: float64(o.threshold) / float64(time.Millisecond),
+		Total:       o.total,
+		Outliers:    calls,
+	}
+}
+
+// write writes the outliers report to file, if there were any outliers.
+func (o *outliers) write(file string, logger *logger) {
+	if o == nil {
+		return
+	}
+
+	report := o.report()
+	if report.Total == 0 {
+		return
+	}
+
+	contents, err := json.MarshalIndent(report, "", "  ")
+	if err == nil {
+		err = ioutil.WriteFile(file, contents, 0644)
+	}
+	if err != nil {
+		logger.Warnf("failed to write outliers report: %v", err)
+		return
+	}
+
+	if report.Total > len(report.Outliers) {
+		logger.Infof("recorded the slowest %v of %v outliers (> %v) to %v", len(report.Outliers), report.Total, o.threshold, file)
+		return
+	}
+	logger.Infof("recorded %v outliers (> %v) to %v", report.Total, o.threshold, file)
+}
+
+// outlierRecorder records outliers for a single target.
+type outlierRecorder struct {
+	*outliers
+	target string
+}
+
+// record records the call if it was slower than the threshold. It must be
+// called before the response is released.
+func (r *outlierRecorder) record(req *transport.Request, res *transport.Response, latency time.Duration) {
+	if r == nil || latency <= r.threshold {
+		return
+	}
+
+	r.add(&outlier{
+		Target:          r.target,
+		Method:          req.Method,
+		Peer:            res.Peer,
+		Time:            time.Now().Add(-latency),
+		LatencyMs:       float64(latency) / float64(time.Millisecond),
+		Trace:           res.Trace,
+		TraceSampled:    res.TraceSampled,
+		RequestHeaders:  secrets.redactHeaders(req.Headers),
+		ResponseHeaders: res.Headers,
+		latency:         latency,
+	})
+}
+
+// outlierHeap is a min-heap of outliers by latency, so the fastest outlier
+// can be replaced once the report is full.
+type outlierHeap []*outlier
+
+func (h outlierHeap) Len() int            { return len(h) }
+func (h outlierHeap) Less(i, j int) bool  { return h[i].latency < h[j].latency }
+func (h outlierHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *outlierHeap) Push(x interface{}) { *h = append(*h, x.(*outlier)) }
+
+func (h *outlierHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel-go/raw"
+	"golang.org/x/net/context"
+)
+
+func TestBenchmarkOutliers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yab-outliers")
+	require.NoError(t, err, "TempDir failed")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "outliers.json")
+
+	// Delay every call after the warm up requests.
+	var requests int32
+	s := newServer(t)
+	defer s.shutdown()
+	s.register(fooMethod, func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		if atomic.AddInt32(&requests, 1) > warmupRequests {
+			time.Sleep(20 * time.Millisecond)
+		}
+		return &raw.Res{Arg2: args.Arg2, Arg3: args.Arg3}, nil
+	})
+
+	m := benchmarkMethodForTest(t, fooMethod)
+	buf, out := getOutput(t)
+	runBenchmark(out, Options{
+		ROpts: RequestOptions{MethodName: fooMethod},
+		BOpts: BenchmarkOptions{
+			MaxRequests:      5,
+			MaxDuration:      time.Second,
+			Connections:      1,
+			Concurrency:      1,
+			OutlierThreshold: 10 * time.Millisecond,
+			OutliersFile:     file,
+			OutlierTraceRate: 1,
+		},
+		TOpts: s.transportOpts(),
+	}, m)
+
+	assert.Contains(t, buf.String(), "Note: recorded 5 outliers (> 10ms) to "+file+"\n")
+
+	contents, err := ioutil.ReadFile(file)
+	require.NoError(t, err, "failed to read outliers report")
+	var report outliersReport
+	require.NoError(t, json.Unmarshal(contents, &report), "failed to parse outliers report")
+	assert.Equal(t, 10.0, report.ThresholdMs, "unexpected threshold")
+	assert.Equal(t, 5, report.Total, "unexpected number of outliers")
+	require.Len(t, report.Outliers, 5, "unexpected outliers")
+	for i, o := range report.Outliers {
+		assert.Equal(t, fooMethod, o.Target, "unexpected target")
+		assert.Equal(t, fooMethod, o.Method, "unexpected method")
+		assert.Equal(t, s.hostPort(), o.Peer, "unexpected peer")
+		assert.True(t, o.LatencyMs >= 20, "unexpected latency %v", o.LatencyMs)
+		assert.NotEmpty(t, o.Trace, "missing trace")
+		assert.True(t, o.TraceSampled, "trace should be sampled")
+		if i > 0 {
+			assert.True(t, o.LatencyMs <= report.Outliers[i-1].LatencyMs, "outliers should be sorted by latency")
+		}
+	}
+}
+
+func TestBenchmarkNoOutliers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yab-outliers")
+	require.NoError(t, err, "TempDir failed")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "outliers.json")
+
+	s := newServer(t)
+	defer s.shutdown()
+	s.register(fooMethod, methods.echo())
+
+	m := benchmarkMethodForTest(t, fooMethod)
+	buf, out := getOutput(t)
+	runBenchmark(out, Options{
+		ROpts: RequestOptions{MethodName: fooMethod},
+		BOpts: BenchmarkOptions{
+			MaxRequests:      5,
+			MaxDuration:      time.Second,
+			Connections:      1,
+			Concurrency:      1,
+			OutlierThreshold: time.Minute,
+			OutliersFile:     file,
+		},
+		TOpts: s.transportOpts(),
+	}, m)
+
+	assert.NotContains(t, buf.String(), "outliers", "no outliers should be reported")
+	_, err = os.Stat(file)
+	assert.True(t, os.IsNotExist(err), "outliers report should not be written")
+}
+
+func TestOutliersKeepsSlowest(t *testing.T) {
+	o := newOutliers(time.Millisecond)
+	for i := 0; i < maxOutliers+500; i++ {
+		// Add the latencies out of order.
+		latency := time.Duration((i*7919)%(maxOutliers+500)) * time.Millisecond
+		o.add(&outlier{latency: latency})
+	}
+
+	report := o.report()
+	assert.Equal(t, maxOutliers+500, report.Total, "unexpected total")
+	require.Len(t, report.Outliers, maxOutliers, "unexpected number of outliers kept")
+	assert.Equal(t, time.Duration(maxOutliers+499)*time.Millisecond, report.Outliers[0].latency, "slowest outlier should be first")
+	assert.Equal(t, 500*time.Millisecond, report.Outliers[maxOutliers-1].latency, "fastest outliers should be dropped")
+}
+
+func TestOutliersDisabled(t *testing.T) {
+	o := newOutliers(0)
+	assert.Nil(t, o, "outliers should be disabled")
+	assert.Nil(t, o.forTarget("foo"), "recorder should be nil")
+
+	var r *outlierRecorder
+	assert.NotPanics(t, func() {
+		r.record(nil, nil, time.Hour)
+		o.write("", nil)
+	})
+}
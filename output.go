@@ -32,6 +32,10 @@ type output interface {
 
 	Fatalf(format string, args ...interface{})
 	Printf(format string, args ...interface{})
+
+	// Warnf prints notes and warnings that are not part of the output,
+	// such as when stdout must only contain a machine-readable document.
+	Warnf(format string, args ...interface{})
 }
 
 type consoleOutput struct {
@@ -45,3 +49,7 @@ func (consoleOutput) Fatalf(format string, args ...interface{}) {
 func (consoleOutput) Printf(format string, args ...interface{}) {
 	fmt.Printf(format, args...)
 }
+
+func (consoleOutput) Warnf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format, args...)
+}
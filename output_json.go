@@ -0,0 +1,81 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"time"
+
+	"github.com/yarpc/yab/encoding"
+	"github.com/yarpc/yab/transport"
+)
+
+// jsonOutputFormat is the --output-format for machine-readable output.
+const jsonOutputFormat = "json"
+
+// Statuses for jsonResponse.
+const (
+	statusSuccess          = "success"
+	statusApplicationError = "applicationError"
+)
+
+// jsonResponse is the document printed for a single request with
+// --output-format json. Fields should only be added, so that the
+// format is stable for automation.
+type jsonResponse struct {
+	Body    interface{}       `json:"body"`
+	Headers map[string]string `json:"headers"`
+	Trace   string            `json:"trace,omitempty"`
+	Peer    string            `json:"peer"`
+
+	// LatencyMs is the latency of the call in milliseconds.
+	LatencyMs float64 `json:"latencyMs"`
+
+	// Status is statusApplicationError if the response is an application
+	// error, such as a Thrift exception, with the reason in Error.
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+func newJSONResponse(serializer encoding.Serializer, response *transport.Response, latency time.Duration) (jsonResponse, error) {
+	body, err := serializer.Response(response)
+	if err != nil {
+		return jsonResponse{}, err
+	}
+
+	headers := response.Headers
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+
+	doc := jsonResponse{
+		Body:      body,
+		Headers:   headers,
+		Trace:     response.Trace,
+		Peer:      response.Peer,
+		LatencyMs: float64(latency) / float64(time.Millisecond),
+		Status:    statusSuccess,
+	}
+	if err := serializer.CheckSuccess(response); err != nil {
+		doc.Status = statusApplicationError
+		doc.Error = err.Error()
+	}
+	return doc, nil
+}
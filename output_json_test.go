@@ -0,0 +1,141 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yarpc/yab/transport"
+)
+
+func TestJSONOutputFormat(t *testing.T) {
+	hostPort := echoServer(t, fooMethod, nil)
+
+	var outBuf, warnBuf, errBuf bytes.Buffer
+	out := testOutput{
+		Buffer:   &outBuf,
+		warnings: &warnBuf,
+		fatalf: func(format string, args ...interface{}) {
+			errBuf.WriteString(fmt.Sprintf(format, args...))
+		},
+	}
+
+	opts := Options{
+		OutputFormat: jsonOutputFormat,
+		ROpts: RequestOptions{
+			ThriftFile: validThrift,
+			MethodName: fooMethod,
+			Timeout:    timeMillisFlag(time.Second),
+			SlowWarn:   time.Nanosecond,
+		},
+		TOpts: TransportOptions{
+			ServiceName: "foo",
+			HostPorts:   []string{hostPort},
+		},
+	}
+
+	runComplete := make(chan struct{})
+	go func() {
+		defer close(runComplete)
+		runWithOptions(opts, out)
+	}()
+	<-runComplete
+
+	require.Empty(t, errBuf.String(), "should not error")
+	assert.Contains(t, warnBuf.String(), "Warning: response took", "warnings should not be written to stdout")
+
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(outBuf.Bytes(), &doc), "stdout should only contain a JSON document")
+
+	assert.Equal(t, map[string]interface{}{}, doc["body"], "unexpected body")
+	assert.Equal(t, map[string]interface{}{}, doc["headers"], "headers should be an empty object")
+	assert.Equal(t, hostPort, doc["peer"], "unexpected peer")
+	assert.Equal(t, statusSuccess, doc["status"], "unexpected status")
+	assert.NotContains(t, doc, "error", "successful responses should not have an error")
+	if assert.IsType(t, float64(0), doc["latencyMs"], "latencyMs should be a number") {
+		assert.True(t, doc["latencyMs"].(float64) > 0, "latencyMs should be positive")
+	}
+}
+
+func TestNewJSONResponse(t *testing.T) {
+	serializer, err := NewSerializer(RequestOptions{
+		ThriftFile: validThrift,
+		MethodName: "Simple::thriftEx",
+	})
+	require.NoError(t, err, "NewSerializer failed")
+
+	tests := []struct {
+		msg  string
+		body []byte
+		want jsonResponse
+	}{
+		{
+			msg:  "success",
+			body: []byte{0},
+			want: jsonResponse{
+				Body:      map[string]interface{}{},
+				Headers:   map[string]string{"k": "v"},
+				Peer:      "1.1.1.1:1",
+				LatencyMs: 1.5,
+				Status:    statusSuccess,
+			},
+		},
+		{
+			// Field 1 is a ThriftException struct, followed by the stop fields.
+			msg:  "application error",
+			body: []byte{12, 0, 1, 0, 0},
+			want: jsonResponse{
+				Body:      map[string]interface{}{"ex": map[string]interface{}{}},
+				Headers:   map[string]string{"k": "v"},
+				Peer:      "1.1.1.1:1",
+				LatencyMs: 1.5,
+				Status:    statusApplicationError,
+				Error:     "void method got exception: ex ThriftException",
+			},
+		},
+		{
+			msg:  "invalid body",
+			body: []byte{1},
+		},
+	}
+
+	for _, tt := range tests {
+		res := &transport.Response{
+			Body:    tt.body,
+			Headers: map[string]string{"k": "v"},
+			Peer:    "1.1.1.1:1",
+		}
+		got, err := newJSONResponse(serializer, res, 1500*time.Microsecond)
+		if tt.want.Status == "" {
+			assert.Error(t, err, "%v: expected error", tt.msg)
+			continue
+		}
+
+		require.NoError(t, err, "%v: newJSONResponse failed", tt.msg)
+		assert.Equal(t, tt.want, got, "%v: unexpected response", tt.msg)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+var errTemplateAndFormat = errors.New("cannot use --output-template with --output-format json")
+
+// templateResponse is the data that --output-template is executed with.
+// It has the same fields as the JSON output, and the latency as a duration.
+type templateResponse struct {
+	jsonResponse
+
+	Latency time.Duration
+}
+
+// parseOutputTemplate parses the --output-template, so that errors are
+// reported before any calls are made.
+func parseOutputTemplate(opts Options) (*template.Template, error) {
+	if opts.OutputTemplate == "" {
+		return nil, nil
+	}
+	if opts.OutputFormat == jsonOutputFormat {
+		return nil, errTemplateAndFormat
+	}
+
+	// Fail on missing fields, rather than printing "<no value>".
+	tmpl, err := template.New("output").Option("missingkey=error").Parse(opts.OutputTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// executeOutputTemplate returns the output for the response, which always
+// ends with a new line.
+func executeOutputTemplate(tmpl *template.Template, doc jsonResponse, latency time.Duration) (string, error) {
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, templateResponse{doc, latency}); err != nil {
+		return "", fmt.Errorf("failed to execute output template: %v", err)
+	}
+
+	output := buf.String()
+	if !strings.HasSuffix(output, "\n") {
+		output += "\n"
+	}
+	return output, nil
+}
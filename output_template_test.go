@@ -0,0 +1,117 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOutputTemplate(t *testing.T) {
+	tests := []struct {
+		opts    Options
+		wantNil bool
+		errMsg  string
+	}{
+		{
+			opts:    Options{},
+			wantNil: true,
+		},
+		{
+			opts: Options{OutputTemplate: "{{.Latency}}"},
+		},
+		{
+			opts:   Options{OutputTemplate: "{{.Latency"},
+			errMsg: "invalid output template",
+		},
+		{
+			opts:   Options{OutputTemplate: "{{.Latency}}", OutputFormat: jsonOutputFormat},
+			errMsg: errTemplateAndFormat.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := parseOutputTemplate(tt.opts)
+		if tt.errMsg != "" {
+			if assert.Error(t, err, "parseOutputTemplate(%q) should fail", tt.opts.OutputTemplate) {
+				assert.Contains(t, err.Error(), tt.errMsg, "parseOutputTemplate(%q) unexpected error", tt.opts.OutputTemplate)
+			}
+			continue
+		}
+
+		require.NoError(t, err, "parseOutputTemplate(%q) failed", tt.opts.OutputTemplate)
+		assert.Equal(t, tt.wantNil, got == nil, "parseOutputTemplate(%q) unexpected template", tt.opts.OutputTemplate)
+	}
+}
+
+func TestExecuteOutputTemplate(t *testing.T) {
+	doc := jsonResponse{
+		Body: map[string]interface{}{
+			"result": map[string]interface{}{"id": 42},
+		},
+		Headers:   map[string]string{"k": "v"},
+		Peer:      "1.1.1.1:1",
+		LatencyMs: 1.5,
+		Status:    statusSuccess,
+	}
+
+	tests := []struct {
+		template string
+		want     string
+		errMsg   string
+	}{
+		{
+			template: "{{.Latency}} {{.Body.result.id}}",
+			want:     "1.5ms 42\n",
+		},
+		{
+			template: "{{.Peer}} {{.Status}} {{.LatencyMs}}\n",
+			want:     "1.1.1.1:1 success 1.5\n",
+		},
+		{
+			template: `{{index .Headers "k"}}`,
+			want:     "v\n",
+		},
+		{
+			template: "{{.Body.result.missing}}",
+			errMsg:   "failed to execute output template",
+		},
+	}
+
+	for _, tt := range tests {
+		tmpl, err := parseOutputTemplate(Options{OutputTemplate: tt.template})
+		require.NoError(t, err, "parseOutputTemplate(%q) failed", tt.template)
+
+		got, err := executeOutputTemplate(tmpl, doc, 1500*time.Microsecond)
+		if tt.errMsg != "" {
+			if assert.Error(t, err, "executeOutputTemplate(%q) should fail", tt.template) {
+				assert.Contains(t, err.Error(), tt.errMsg, "executeOutputTemplate(%q) unexpected error", tt.template)
+			}
+			continue
+		}
+
+		require.NoError(t, err, "executeOutputTemplate(%q) failed", tt.template)
+		assert.Equal(t, tt.want, got, "executeOutputTemplate(%q) mismatch", tt.template)
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/yarpc/yab/transport"
+
+	"golang.org/x/net/context"
+)
+
+// peerStrategy is the strategy used to choose a peer for each call.
+type peerStrategy string
+
+// The list of supported peer strategies.
+const (
+	defaultPeerStrategy      peerStrategy = ""
+	roundRobinPeerStrategy   peerStrategy = "round-robin"
+	randomPeerStrategy       peerStrategy = "random"
+	leastPendingPeerStrategy peerStrategy = "least-pending"
+	consistentHashStrategy   peerStrategy = "consistent-hash"
+)
+
+// consistentHashReplicas is the number of points each peer has on the hash ring
+// for each unit of weight.
+const consistentHashReplicas = 100
+
+// UnmarshalFlag allows peerStrategy to be used as a flag.
+func (s *peerStrategy) UnmarshalFlag(value string) error {
+	switch ps := peerStrategy(value); ps {
+	case defaultPeerStrategy, roundRobinPeerStrategy, randomPeerStrategy, leastPendingPeerStrategy, consistentHashStrategy:
+		*s = ps
+		return nil
+	default:
+		return fmt.Errorf("unknown peer strategy: %q", value)
+	}
+}
+
+// peerChooser chooses which peer to use for each call.
+type peerChooser interface {
+	// choose returns the index of the peer to use for the given request.
+	choose(req *transport.Request) int
+
+	// release is called when a call to the chosen peer has completed.
+	release(peer int)
+}
+
+// newPeerChooser returns a chooser for the given strategy. If weights is
+// non-nil, it has the weight of each peer, and peers with a higher weight
+// are chosen proportionally more often.
+func newPeerChooser(strategy peerStrategy, hostPorts []string, weights []int) (peerChooser, error) {
+	numPeers := len(hostPorts)
+	switch strategy {
+	case roundRobinPeerStrategy:
+		return &roundRobinChooser{slots: peerSlots(numPeers, weights)}, nil
+	case randomPeerStrategy:
+		return randomChooser{peerSlots(numPeers, weights)}, nil
+	case leastPendingPeerStrategy:
+		return newLeastPendingChooser(numPeers, weights), nil
+	case consistentHashStrategy:
+		return newConsistentHashChooser(hostPorts, weights), nil
+	default:
+		return nil, fmt.Errorf("unknown peer strategy: %q", strategy)
+	}
+}
+
+// roundRobinChooser cycles through the peer slots, where each peer has
+// a slot for each unit of weight.
+type roundRobinChooser struct {
+	next  int64
+	slots []int
+}
+
+func (c *roundRobinChooser) choose(*transport.Request) int {
+	return c.slots[(atomic.AddInt64(&c.next, 1)-1)%int64(len(c.slots))]
+}
+
+func (c *roundRobinChooser) release(int) {}
+
+type randomChooser struct {
+	slots []int
+}
+
+func (c randomChooser) choose(*transport.Request) int {
+	return c.slots[rand.Intn(len(c.slots))]
+}
+
+func (c randomChooser) release(int) {}
+
+// leastPendingChooser chooses the peer with the fewest outstanding calls
+// relative to its weight.
+type leastPendingChooser struct {
+	pending []int64
+	weights []int64
+}
+
+func newLeastPendingChooser(numPeers int, weights []int) *leastPendingChooser {
+	c := &leastPendingChooser{
+		pending: make([]int64, numPeers),
+		weights: make([]int64, numPeers),
+	}
+	for i := range c.weights {
+		c.weights[i] = 1
+		if weights != nil {
+			c.weights[i] = int64(weights[i])
+		}
+	}
+	return c
+}
+
+func (c *leastPendingChooser) choose(*transport.Request) int {
+	// Start from a random peer so that ties are not always broken
+	// in favour of the first peer.
+	numPeers := len(c.pending)
+	offset := rand.Intn(numPeers)
+
+	best := offset
+	bestPending := atomic.LoadInt64(&c.pending[best])
+	for i := 1; i < numPeers && bestPending > 0; i++ {
+		peer := (offset + i) % numPeers
+		// Compare pending/weight without dividing.
+		pending := atomic.LoadInt64(&c.pending[peer])
+		if pending*c.weights[best] < bestPending*c.weights[peer] {
+			best, bestPending = peer, pending
+		}
+	}
+
+	atomic.AddInt64(&c.pending[best], 1)
+	return best
+}
+
+func (c *leastPendingChooser) release(peer int) {
+	atomic.AddInt64(&c.pending[peer], -1)
+}
+
+type ringPoint struct {
+	hash uint32
+	peer int
+}
+
+type byHash []ringPoint
+
+func (p byHash) Len() int           { return len(p) }
+func (p byHash) Less(i, j int) bool { return p[i].hash < p[j].hash }
+func (p byHash) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// consistentHashChooser chooses a peer using the request's shard key, so that
+// requests with the same key are always sent to the same peer.
+type consistentHashChooser struct {
+	ring []ringPoint
+}
+
+func newConsistentHashChooser(hostPorts []string, weights []int) *consistentHashChooser {
+	ring := make([]ringPoint, 0, len(hostPorts)*consistentHashReplicas)
+	for peer, hp := range hostPorts {
+		replicas := consistentHashReplicas
+		if weights != nil {
+			replicas *= weights[peer]
+		}
+		for i := 0; i < replicas; i++ {
+			ring = append(ring, ringPoint{
+				hash: crc32.ChecksumIEEE([]byte(hp + "#" + strconv.Itoa(i))),
+				peer: peer,
+			})
+		}
+	}
+
+	sort.Sort(byHash(ring))
+	return &consistentHashChooser{ring}
+}
+
+func (c *consistentHashChooser) choose(req *transport.Request) int {
+	hash := crc32.ChecksumIEEE([]byte(req.ShardKey))
+	i := sort.Search(len(c.ring), func(i int) bool {
+		return c.ring[i].hash >= hash
+	})
+	if i == len(c.ring) {
+		i = 0
+	}
+	return c.ring[i].peer
+}
+
+func (c *consistentHashChooser) release(int) {}
+
+// peerChooserTransport is a transport that uses a peerChooser to choose
+// which of the underlying per-peer transports to use for each call.
+type peerChooserTransport struct {
+	chooser peerChooser
+	peers   []transport.Transport
+}
+
+func newPeerChooserTransport(chooser peerChooser, peers []transport.Transport) transport.Transport {
+	return &peerChooserTransport{
+		chooser: chooser,
+		peers:   peers,
+	}
+}
+
+func (t *peerChooserTransport) Call(ctx context.Context, r *transport.Request) (*transport.Response, error) {
+	peer := t.chooser.choose(r)
+	defer t.chooser.release(peer)
+
+	return t.peers[peer].Call(ctx, r)
+}
@@ -0,0 +1,214 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yarpc/yab/encoding"
+	"github.com/yarpc/yab/transport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel-go"
+	"github.com/uber/tchannel-go/raw"
+	"golang.org/x/net/context"
+)
+
+var testPeers = []string{"1.1.1.1:1", "2.2.2.2:2", "3.3.3.3:3"}
+
+func TestPeerStrategyFlag(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    peerStrategy
+		wantErr bool
+	}{
+		{value: "", want: defaultPeerStrategy},
+		{value: "round-robin", want: roundRobinPeerStrategy},
+		{value: "random", want: randomPeerStrategy},
+		{value: "least-pending", want: leastPendingPeerStrategy},
+		{value: "consistent-hash", want: consistentHashStrategy},
+		{value: "fastest", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		var strategy peerStrategy
+		err := strategy.UnmarshalFlag(tt.value)
+		if tt.wantErr {
+			assert.Error(t, err, "UnmarshalFlag(%v) should fail", tt.value)
+			continue
+		}
+
+		assert.NoError(t, err, "UnmarshalFlag(%v) should not fail", tt.value)
+		assert.Equal(t, tt.want, strategy, "UnmarshalFlag(%v) mismatch", tt.value)
+	}
+}
+
+func TestRoundRobinChooser(t *testing.T) {
+	chooser, err := newPeerChooser(roundRobinPeerStrategy, testPeers, nil)
+	require.NoError(t, err, "Failed to create chooser")
+
+	var got []int
+	for i := 0; i < 7; i++ {
+		got = append(got, chooser.choose(nil))
+	}
+	assert.Equal(t, []int{0, 1, 2, 0, 1, 2, 0}, got, "Unexpected peers chosen")
+}
+
+func TestRandomChooser(t *testing.T) {
+	chooser, err := newPeerChooser(randomPeerStrategy, testPeers, nil)
+	require.NoError(t, err, "Failed to create chooser")
+
+	for i := 0; i < 100; i++ {
+		peer := chooser.choose(nil)
+		assert.True(t, peer >= 0 && peer < 3, "Chosen peer %v out of range", peer)
+	}
+}
+
+func TestWeightedChoosers(t *testing.T) {
+	weights := []int{1, 2, 3}
+
+	roundRobin, err := newPeerChooser(roundRobinPeerStrategy, testPeers, weights)
+	require.NoError(t, err, "Failed to create chooser")
+	var got []int
+	for i := 0; i < 7; i++ {
+		got = append(got, roundRobin.choose(nil))
+	}
+	assert.Equal(t, []int{0, 1, 1, 2, 2, 2, 0}, got, "Unexpected peers chosen")
+
+	random, err := newPeerChooser(randomPeerStrategy, testPeers, weights)
+	require.NoError(t, err, "Failed to create chooser")
+	counts := make([]int, len(testPeers))
+	for i := 0; i < 6000; i++ {
+		counts[random.choose(nil)]++
+	}
+	for i, w := range weights {
+		assert.InDelta(t, 1000*w, counts[i], 250, "Peer %v should be chosen in proportion to its weight", i)
+	}
+
+	// Peer 2 has the highest weight, so it should get 3 calls for every
+	// call made to peer 0.
+	leastPending, err := newPeerChooser(leastPendingPeerStrategy, testPeers, weights)
+	require.NoError(t, err, "Failed to create chooser")
+	counts = make([]int, len(testPeers))
+	for i := 0; i < 6; i++ {
+		counts[leastPending.choose(nil)]++
+	}
+	assert.Equal(t, []int{1, 2, 3}, counts, "Pending calls should be in proportion to weight")
+
+	consistentHash, err := newPeerChooser(consistentHashStrategy, testPeers, []int{1, 1, 10})
+	require.NoError(t, err, "Failed to create chooser")
+	counts = make([]int, len(testPeers))
+	for i := 0; i < 1200; i++ {
+		counts[consistentHash.choose(&transport.Request{ShardKey: fmt.Sprint("user", i)})]++
+	}
+	assert.True(t, counts[2] > counts[0]+counts[1], "Heavier peer should own more keys: %v", counts)
+}
+
+func TestLeastPendingChooser(t *testing.T) {
+	chooser, err := newPeerChooser(leastPendingPeerStrategy, testPeers, nil)
+	require.NoError(t, err, "Failed to create chooser")
+
+	// With no releases, each peer should be chosen once before any peer
+	// is chosen a second time.
+	counts := make(map[int]int)
+	for i := 0; i < 3; i++ {
+		counts[chooser.choose(nil)]++
+	}
+	assert.Equal(t, map[int]int{0: 1, 1: 1, 2: 1}, counts, "Expected each peer to be chosen once")
+
+	// Once peer 1 completes its call, it has the fewest pending calls.
+	chooser.release(1)
+	assert.Equal(t, 1, chooser.choose(nil), "Expected peer with fewest pending calls")
+}
+
+func TestConsistentHashChooser(t *testing.T) {
+	chooser, err := newPeerChooser(consistentHashStrategy, testPeers, nil)
+	require.NoError(t, err, "Failed to create chooser")
+
+	counts := make(map[int]int)
+	for i := 0; i < 300; i++ {
+		req := &transport.Request{ShardKey: fmt.Sprint("user", i)}
+		peer := chooser.choose(req)
+		counts[peer]++
+
+		// The same key should always go to the same peer.
+		for j := 0; j < 3; j++ {
+			assert.Equal(t, peer, chooser.choose(req), "Key %v should map to a single peer", req.ShardKey)
+		}
+	}
+
+	assert.Len(t, counts, len(testPeers), "Keys should be spread across all peers")
+
+	// Adding a peer should only move some keys, as long as the existing
+	// peers are in the same order.
+	bigger, err := newPeerChooser(consistentHashStrategy, append(testPeers, "4.4.4.4:4"), nil)
+	require.NoError(t, err, "Failed to create chooser")
+	moved := 0
+	for i := 0; i < 300; i++ {
+		req := &transport.Request{ShardKey: fmt.Sprint("user", i)}
+		if chooser.choose(req) != bigger.choose(req) {
+			moved++
+		}
+	}
+	assert.True(t, moved < 150, "Too many keys moved after adding a peer: %v", moved)
+}
+
+func TestNewPeerChooserUnknown(t *testing.T) {
+	_, err := newPeerChooser("fastest", testPeers, nil)
+	assert.Error(t, err, "Expected unknown strategy to fail")
+}
+
+func TestGetTransportPeerStrategy(t *testing.T) {
+	var calls [2]int32
+	servers := make([]*server, len(calls))
+	hostPorts := make([]string, len(calls))
+	for i := range servers {
+		i := i
+		servers[i] = newServer(t)
+		defer servers[i].shutdown()
+		servers[i].register("test", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+			atomic.AddInt32(&calls[i], 1)
+			return &raw.Res{}, nil
+		})
+		hostPorts[i] = servers[i].hostPort()
+	}
+
+	opts := TransportOptions{
+		ServiceName:  "foo",
+		HostPorts:    hostPorts,
+		PeerStrategy: roundRobinPeerStrategy,
+	}
+	tchan, err := getTransport(opts, encoding.Raw)
+	require.NoError(t, err, "getTransport failed")
+
+	for i := 0; i < 10; i++ {
+		ctx, cancel := tchannel.NewContext(time.Second)
+		_, err := tchan.Call(ctx, &transport.Request{Method: "test"})
+		cancel()
+		require.NoError(t, err, "Call failed")
+	}
+
+	assert.EqualValues(t, [2]int32{5, 5}, calls, "Calls should be spread evenly across peers")
+}
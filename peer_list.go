@@ -0,0 +1,313 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// peer is a single entry in a peer list, along with any metadata
+// (such as the datacenter) that was specified for it. Peers with a higher
+// weight are chosen more often, and a weight of 0 means it was not set.
+type peer struct {
+	HostPort string
+	Weight   int
+	Metadata map[string]string
+}
+
+// csvColumns are the column names used for CSV peer lists without a header.
+var csvColumns = []string{"host", "port", "weight", "dc"}
+
+func parsePeerFile(filename string) ([]peer, error) {
+	contents, err := readFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open peer list: %v", err)
+	}
+
+	// Try as JSON or YAML first, as JSON is a subset of YAML.
+	peers, err := parsePeersYAML(contents)
+	if err != nil {
+		if bytes.Contains(contents, []byte(",")) {
+			peers, err = parsePeersCSV(bytes.NewReader(contents))
+		} else {
+			peers, err = parsePeersNewLines(bytes.NewReader(contents))
+		}
+	}
+	if err != nil {
+		return nil, errPeerListFile
+	}
+
+	return peers, nil
+}
+
+// parsePeersYAML parses a list where each item is either a host:port
+// or an object with the host:port and metadata.
+func parsePeersYAML(contents []byte) ([]peer, error) {
+	var items []interface{}
+	if err := yaml.Unmarshal(contents, &items); err != nil {
+		return nil, err
+	}
+
+	peers := make([]peer, 0, len(items))
+	for _, item := range items {
+		switch item := item.(type) {
+		case string:
+			peers = append(peers, peer{HostPort: item})
+		case map[interface{}]interface{}:
+			p, err := peerFromMap(item)
+			if err != nil {
+				return nil, err
+			}
+			peers = append(peers, p)
+		default:
+			return nil, fmt.Errorf("peer must be a string or an object, got %T", item)
+		}
+	}
+
+	return peers, nil
+}
+
+func peerFromMap(m map[interface{}]interface{}) (peer, error) {
+	fields := make(map[string]string, len(m))
+	for k, v := range m {
+		fields[fmt.Sprint(k)] = fmt.Sprint(v)
+	}
+	return peerFromFields(fields)
+}
+
+// peerFromFields creates a peer from a map of fields. The host:port is specified
+// using either "hostPort" or "host" and "port", and all other fields other
+// than "weight" are used as metadata. "datacenter" is stored as "dc", so
+// filters and peer groups use the same key for either name.
+func peerFromFields(fields map[string]string) (peer, error) {
+	p := peer{
+		HostPort: fields["hostPort"],
+		Metadata: make(map[string]string),
+	}
+	if p.HostPort == "" {
+		// IPv6 hosts may be specified with or without brackets.
+		host := strings.TrimSuffix(strings.TrimPrefix(fields["host"], "["), "]")
+		port := fields["port"]
+		if host == "" || port == "" {
+			return peer{}, fmt.Errorf("peer must specify hostPort, or host and port: %v", fields)
+		}
+		if _, err := strconv.Atoi(port); err != nil {
+			return peer{}, fmt.Errorf("invalid port %q: %v", port, err)
+		}
+		p.HostPort = net.JoinHostPort(host, port)
+	}
+
+	if weight, ok := fields["weight"]; ok && weight != "" {
+		var err error
+		if p.Weight, err = strconv.Atoi(weight); err != nil || p.Weight < 1 {
+			return peer{}, fmt.Errorf("invalid weight %q, must be a positive number", weight)
+		}
+	}
+
+	for k, v := range fields {
+		switch k {
+		case "hostPort", "host", "port", "weight":
+		case "datacenter":
+			if _, ok := fields["dc"]; !ok {
+				p.Metadata["dc"] = v
+			}
+		default:
+			p.Metadata[k] = v
+		}
+	}
+
+	return p, nil
+}
+
+// parsePeersCSV parses a CSV with the columns host, port, weight and dc.
+// If the first row is a header, the header is used for the column names.
+func parsePeersCSV(r io.Reader) ([]peer, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := csvColumns
+	if len(records) > 0 && isCSVHeader(records[0]) {
+		columns = records[0]
+		records = records[1:]
+	}
+
+	peers := make([]peer, 0, len(records))
+	for _, record := range records {
+		if len(record) > len(columns) {
+			return nil, fmt.Errorf("peer %v has more columns than expected %v", record, columns)
+		}
+
+		fields := make(map[string]string, len(record))
+		for i, v := range record {
+			fields[strings.TrimSpace(columns[i])] = strings.TrimSpace(v)
+		}
+
+		p, err := peerFromFields(fields)
+		if err != nil {
+			return nil, err
+		}
+		peers = append(peers, p)
+	}
+
+	return peers, nil
+}
+
+// isCSVHeader returns whether the given record is a header, which is
+// the case if the port column is not a number.
+func isCSVHeader(record []string) bool {
+	if len(record) < 2 {
+		return false
+	}
+
+	_, err := strconv.Atoi(strings.TrimSpace(record[1]))
+	return err != nil
+}
+
+func parsePeersNewLines(r io.Reader) ([]peer, error) {
+	var peers []peer
+	rdr := bufio.NewReader(r)
+	for {
+		line, err := rdr.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if _, _, err := net.SplitHostPort(line); err != nil {
+			return nil, err
+		}
+
+		peers = append(peers, peer{HostPort: line})
+	}
+
+	return peers, nil
+}
+
+// filterPeers returns the peers whose metadata matches all of the given
+// key=value filters.
+func filterPeers(peers []peer, filters []string) ([]peer, error) {
+	if len(filters) == 0 {
+		return peers, nil
+	}
+
+	want := make(map[string]string, len(filters))
+	for _, f := range filters {
+		parts := strings.SplitN(f, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid peer filter %q, expected key=value", f)
+		}
+		want[parts[0]] = parts[1]
+	}
+
+	var filtered []peer
+	for _, p := range peers {
+		if p.matches(want) {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered, nil
+}
+
+func (p peer) matches(want map[string]string) bool {
+	for k, v := range want {
+		if p.Metadata[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func peerHostPorts(peers []peer) []string {
+	hostPorts := make([]string, len(peers))
+	for i, p := range peers {
+		hostPorts[i] = p.HostPort
+	}
+	return hostPorts
+}
+
+// peerWeights returns the weight of each peer, where peers without a weight
+// have a weight of 1, or nil if no peer has a weight.
+func peerWeights(peers []peer) []int {
+	var weights []int
+	for i, p := range peers {
+		if p.Weight == 0 {
+			continue
+		}
+		if weights == nil {
+			weights = make([]int, len(peers))
+			for j := range weights {
+				weights[j] = 1
+			}
+		}
+		weights[i] = p.Weight
+	}
+	return weights
+}
+
+// peerSlots returns the index of each peer repeated by its weight, reduced
+// by the weights' greatest common divisor. Without weights, each peer has a
+// single slot.
+func peerSlots(numPeers int, weights []int) []int {
+	divisor := 0
+	for _, w := range weights {
+		divisor = gcd(divisor, w)
+	}
+
+	var slots []int
+	for i := 0; i < numPeers; i++ {
+		n := 1
+		if weights != nil {
+			n = weights[i] / divisor
+		}
+		for j := 0; j < n; j++ {
+			slots = append(slots, i)
+		}
+	}
+	return slots
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
@@ -0,0 +1,251 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePeerFile(t *testing.T) {
+	tests := []struct {
+		filename string
+		errMsg   string
+		want     []string
+	}{
+		{
+			filename: "/fake/file",
+			errMsg:   "failed to open peer list",
+		},
+		{
+			filename: "testdata/valid_peerlist.json",
+			want:     []string{"1.1.1.1:1", "2.2.2.2:2"},
+		},
+		{
+			filename: "testdata/valid_peerlist.yaml",
+			want:     []string{"1.1.1.1:1", "2.2.2.2:2"},
+		},
+		{
+			filename: "testdata/valid_peerlist.txt",
+			want:     []string{"1.1.1.1:1", "2.2.2.2:2"},
+		},
+		{
+			filename: "testdata/valid_peerlist.csv",
+			want:     []string{"1.1.1.1:1", "2.2.2.2:2"},
+		},
+		{
+			filename: "testdata/valid_peerlist.txt.gz",
+			want:     []string{"1.1.1.1:1", "2.2.2.2:2"},
+		},
+		{
+			filename: "testdata/valid_peerlist.csv.zst",
+			want:     []string{"1.1.1.1:1", "2.2.2.2:2"},
+		},
+		{
+			filename: "testdata/valid_peerlist_header.csv",
+			want:     []string{"1.1.1.1:1", "2.2.2.2:2"},
+		},
+		{
+			filename: "testdata/valid_peerlist_metadata.yaml",
+			want:     []string{"1.1.1.1:1", "2.2.2.2:2", "3.3.3.3:3"},
+		},
+		{
+			filename: "testdata/valid_peerlist_ipv6.csv",
+			want:     []string{"1.1.1.1:1", "[::1]:2", "[fd00::2]:3"},
+		},
+		{
+			filename: "testdata/valid_peerlist_ipv6.yaml",
+			want:     []string{"[::1]:1", "[fd00::2]:2"},
+		},
+		{
+			filename: "testdata/invalid_peerlist.json",
+			errMsg:   errPeerListFile.Error(),
+		},
+		{
+			filename: "testdata/invalid.json",
+			errMsg:   errPeerListFile.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := parsePeerFile(tt.filename)
+		if tt.errMsg != "" {
+			if assert.Error(t, err, "parsePeerFile(%v) should fail", tt.filename) {
+				assert.Contains(t, err.Error(), tt.errMsg, "Unexpected error for parsePeerFile(%v)", tt.filename)
+			}
+			continue
+		}
+
+		if assert.NoError(t, err, "parsePeerFile(%v) should not fail", tt.filename) {
+			assert.Equal(t, tt.want, peerHostPorts(got), "parsePeerFile(%v) mismatch", tt.filename)
+		}
+	}
+}
+
+func TestParsePeerFileMetadata(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     []peer
+	}{
+		{
+			filename: "testdata/valid_peerlist.csv",
+			want: []peer{
+				{HostPort: "1.1.1.1:1", Weight: 10, Metadata: map[string]string{"dc": "sjc1"}},
+				{HostPort: "2.2.2.2:2", Weight: 5, Metadata: map[string]string{"dc": "dca1"}},
+			},
+		},
+		{
+			filename: "testdata/valid_peerlist_header.csv",
+			want: []peer{
+				{HostPort: "1.1.1.1:1", Metadata: map[string]string{"zone": "sjc1-a"}},
+				{HostPort: "2.2.2.2:2", Metadata: map[string]string{"zone": "sjc1-b"}},
+			},
+		},
+		{
+			filename: "testdata/valid_peerlist_metadata.yaml",
+			want: []peer{
+				{HostPort: "1.1.1.1:1", Metadata: map[string]string{"dc": "sjc1", "zone": "a"}},
+				{HostPort: "2.2.2.2:2", Weight: 3, Metadata: map[string]string{"dc": "dca1"}},
+				{HostPort: "3.3.3.3:3"},
+			},
+		},
+		{
+			filename: "testdata/valid_peerlist_datacenter.csv",
+			want: []peer{
+				{HostPort: "1.1.1.1:1", Weight: 2, Metadata: map[string]string{"dc": "sjc1"}},
+				{HostPort: "2.2.2.2:2", Metadata: map[string]string{"dc": "dca1"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := parsePeerFile(tt.filename)
+		if assert.NoError(t, err, "parsePeerFile(%v) should not fail", tt.filename) {
+			assert.Equal(t, tt.want, got, "parsePeerFile(%v) mismatch", tt.filename)
+		}
+	}
+}
+
+func TestPeerFromFields(t *testing.T) {
+	tests := []struct {
+		fields map[string]string
+		want   peer
+		errMsg string
+	}{
+		{
+			fields: map[string]string{"hostPort": "1.1.1.1:1", "datacenter": "sjc1"},
+			want:   peer{HostPort: "1.1.1.1:1", Metadata: map[string]string{"dc": "sjc1"}},
+		},
+		{
+			fields: map[string]string{"hostPort": "1.1.1.1:1", "datacenter": "sjc1", "dc": "dca1"},
+			want:   peer{HostPort: "1.1.1.1:1", Metadata: map[string]string{"dc": "dca1"}},
+		},
+		{
+			fields: map[string]string{"hostPort": "1.1.1.1:1", "weight": "4"},
+			want:   peer{HostPort: "1.1.1.1:1", Weight: 4, Metadata: map[string]string{}},
+		},
+		{
+			fields: map[string]string{"hostPort": "1.1.1.1:1", "weight": "0"},
+			errMsg: `invalid weight "0"`,
+		},
+		{
+			fields: map[string]string{"hostPort": "1.1.1.1:1", "weight": "-1"},
+			errMsg: `invalid weight "-1"`,
+		},
+		{
+			fields: map[string]string{"hostPort": "1.1.1.1:1", "weight": "heavy"},
+			errMsg: `invalid weight "heavy"`,
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := peerFromFields(tt.fields)
+		if tt.errMsg != "" {
+			if assert.Error(t, err, "peerFromFields(%v) should fail", tt.fields) {
+				assert.Contains(t, err.Error(), tt.errMsg, "Unexpected error for peerFromFields(%v)", tt.fields)
+			}
+			continue
+		}
+
+		if assert.NoError(t, err, "peerFromFields(%v) should not fail", tt.fields) {
+			assert.Equal(t, tt.want, got, "peerFromFields(%v) mismatch", tt.fields)
+		}
+	}
+}
+
+func TestPeerWeights(t *testing.T) {
+	assert.Nil(t, peerWeights([]peer{{HostPort: "1.1.1.1:1"}, {HostPort: "2.2.2.2:2"}}),
+		"Peers without weights should have no weights")
+	assert.Equal(t, []int{1, 3}, peerWeights([]peer{{HostPort: "1.1.1.1:1"}, {HostPort: "2.2.2.2:2", Weight: 3}}),
+		"Peers without a weight should have a weight of 1")
+	assert.Equal(t, []int{0, 1, 1, 1, 1}, peerSlots(2, []int{2, 8}),
+		"Slots should be reduced by the common divisor")
+}
+
+func TestFilterPeers(t *testing.T) {
+	peers := []peer{
+		{HostPort: "1.1.1.1:1", Metadata: map[string]string{"dc": "sjc1", "zone": "a"}},
+		{HostPort: "2.2.2.2:2", Metadata: map[string]string{"dc": "sjc1", "zone": "b"}},
+		{HostPort: "3.3.3.3:3", Metadata: map[string]string{"dc": "dca1", "zone": "a"}},
+		{HostPort: "4.4.4.4:4"},
+	}
+
+	tests := []struct {
+		filters []string
+		want    []string
+		errMsg  string
+	}{
+		{
+			want: []string{"1.1.1.1:1", "2.2.2.2:2", "3.3.3.3:3", "4.4.4.4:4"},
+		},
+		{
+			filters: []string{"dc=sjc1"},
+			want:    []string{"1.1.1.1:1", "2.2.2.2:2"},
+		},
+		{
+			filters: []string{"dc=sjc1", "zone=a"},
+			want:    []string{"1.1.1.1:1"},
+		},
+		{
+			filters: []string{"dc=phx2"},
+			want:    []string{},
+		},
+		{
+			filters: []string{"dc"},
+			errMsg:  "invalid peer filter",
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := filterPeers(peers, tt.filters)
+		if tt.errMsg != "" {
+			if assert.Error(t, err, "filterPeers(%v) should fail", tt.filters) {
+				assert.Contains(t, err.Error(), tt.errMsg, "Unexpected error for filterPeers(%v)", tt.filters)
+			}
+			continue
+		}
+
+		if assert.NoError(t, err, "filterPeers(%v) should not fail", tt.filters) {
+			assert.Equal(t, tt.want, peerHostPorts(got), "filterPeers(%v) mismatch", tt.filters)
+		}
+	}
+}
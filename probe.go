@@ -0,0 +1,330 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yarpc/yab/encoding"
+	"github.com/yarpc/yab/transport"
+)
+
+// probeCommand makes the request on an interval, as a blackbox prober.
+const probeCommand = "probe"
+
+// probeHistorySize is the number of recent probe results kept for /history.
+const probeHistorySize = 100
+
+// probeLatencyBuckets are the upper bounds, in seconds, of the latency histogram.
+var probeLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// openMetricsType is the content type of the OpenMetrics text format,
+// which is served if the scraper accepts it, since only it supports exemplars.
+const openMetricsType = "application/openmetrics-text"
+
+// probeResult is the result of a single probe.
+type probeResult struct {
+	Time      time.Time `json:"time"`
+	Success   bool      `json:"success"`
+	LatencyMs float64   `json:"latencyMs"`
+	Error     string    `json:"error,omitempty"`
+
+	// Trace is the trace ID of the probe, if the trace was sampled.
+	Trace string `json:"trace,omitempty"`
+}
+
+// probeExemplar is the most recent traced probe in a latency bucket,
+// so a latency spike can be linked to its trace.
+type probeExemplar struct {
+	trace   string
+	seconds float64
+	time    time.Time
+}
+
+// prober records probe results, and serves them as Prometheus metrics.
+type prober struct {
+	labels string
+
+	mu        sync.Mutex
+	history   []probeResult
+	successes int
+	failures  int
+
+	// buckets are the (non-cumulative) latency bucket counts, with the
+	// last bucket for latencies above all of probeLatencyBuckets.
+	buckets    []int
+	exemplars  []*probeExemplar
+	latencySum float64
+}
+
+func newProber(service, method string) *prober {
+	return &prober{
+		labels:    fmt.Sprintf("service=%v,method=%v", strconv.Quote(service), strconv.Quote(method)),
+		buckets:   make([]int, len(probeLatencyBuckets)+1),
+		exemplars: make([]*probeExemplar, len(probeLatencyBuckets)+1),
+	}
+}
+
+func (p *prober) record(r probeResult) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if r.Success {
+		p.successes++
+	} else {
+		p.failures++
+	}
+
+	seconds := r.LatencyMs / 1000
+	bucket := sort.SearchFloat64s(probeLatencyBuckets, seconds)
+	p.buckets[bucket]++
+	p.latencySum += seconds
+	if r.Trace != "" {
+		p.exemplars[bucket] = &probeExemplar{trace: r.Trace, seconds: seconds, time: r.Time}
+	}
+	if len(p.history) == probeHistorySize {
+		p.history = append(p.history[:0], p.history[1:]...)
+	}
+	p.history = append(p.history, r)
+}
+
+// handler serves the metrics in the Prometheus text format on /metrics,
+// or the OpenMetrics format with trace exemplars if the scraper accepts it,
+// and the recent results as JSON on /history.
+func (p *prober) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", p.serveMetrics)
+	mux.HandleFunc("/history", p.serveHistory)
+	return mux
+}
+
+func (p *prober) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	openMetrics := strings.Contains(r.Header.Get("Accept"), openMetricsType)
+
+	buf := &bytes.Buffer{}
+	metric := func(name, kind, help string) {
+		if openMetrics && kind == "counter" {
+			// OpenMetrics counter families are named without the _total suffix.
+			name = strings.TrimSuffix(name, "_total")
+		}
+		fmt.Fprintf(buf, "# HELP %v %v\n# TYPE %v %v\n", name, help, name, kind)
+	}
+
+	metric("yab_probe_total", "counter", "The number of probes made, by result.")
+	fmt.Fprintf(buf, "yab_probe_total{%v,result=\"success\"} %v\n", p.labels, p.successes)
+	fmt.Fprintf(buf, "yab_probe_total{%v,result=\"failure\"} %v\n", p.labels, p.failures)
+
+	if len(p.history) > 0 {
+		last := p.history[len(p.history)-1]
+		success := 0
+		if last.Success {
+			success = 1
+		}
+
+		metric("yab_probe_success", "gauge", "Whether the last probe succeeded.")
+		fmt.Fprintf(buf, "yab_probe_success{%v} %v\n", p.labels, success)
+		metric("yab_probe_duration_seconds", "gauge", "The latency of the last probe.")
+		fmt.Fprintf(buf, "yab_probe_duration_seconds{%v} %v\n", p.labels, last.LatencyMs/1000)
+		metric("yab_probe_last_timestamp_seconds", "gauge", "When the last probe was made.")
+		fmt.Fprintf(buf, "yab_probe_last_timestamp_seconds{%v} %v\n", p.labels, last.Time.Unix())
+	}
+
+	metric("yab_probe_latency_seconds", "histogram", "The latency of probes.")
+	count := 0
+	for i, n := range p.buckets {
+		count += n
+		le := "+Inf"
+		if i < len(probeLatencyBuckets) {
+			le = strconv.FormatFloat(probeLatencyBuckets[i], 'g', -1, 64)
+		}
+		fmt.Fprintf(buf, "yab_probe_latency_seconds_bucket{%v,le=%q} %v", p.labels, le, count)
+		if e := p.exemplars[i]; openMetrics && e != nil {
+			fmt.Fprintf(buf, " # {trace_id=%q} %v %.3f", e.trace, e.seconds, float64(e.time.UnixNano())/float64(time.Second))
+		}
+		buf.WriteString("\n")
+	}
+	fmt.Fprintf(buf, "yab_probe_latency_seconds_sum{%v} %v\n", p.labels, p.latencySum)
+	fmt.Fprintf(buf, "yab_probe_latency_seconds_count{%v} %v\n", p.labels, count)
+
+	if openMetrics {
+		buf.WriteString("# EOF\n")
+		w.Header().Set("Content-Type", openMetricsType+"; version=1.0.0; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	}
+	w.Write(buf.Bytes())
+}
+
+func (p *prober) serveHistory(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	bs, err := json.Marshal(p.history)
+	p.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(bs)
+}
+
+// probeAssertionNames returns the names of the assertions, in the order
+// that checkProbeAssertions returns their results.
+func probeAssertionNames(opts ProbeOptions) []string {
+	var names []string
+	if opts.AssertLatency > 0 {
+		names = append(names, fmt.Sprintf("latency at most %v", opts.AssertLatency))
+	}
+	for _, s := range opts.AssertContains {
+		names = append(names, fmt.Sprintf("body contains %q", s))
+	}
+	return names
+}
+
+// checkProbeAssertions checks the response against each of the assertions,
+// and returns the result of each, which is nil if the assertion passed.
+func checkProbeAssertions(opts ProbeOptions, serializer encoding.Serializer, response *transport.Response, latency time.Duration) []error {
+	var errs []error
+	if opts.AssertLatency > 0 {
+		var err error
+		if latency > opts.AssertLatency {
+			err = fmt.Errorf("latency %v exceeded --assert-latency %v", latency, opts.AssertLatency)
+		}
+		errs = append(errs, err)
+	}
+	if len(opts.AssertContains) == 0 {
+		return errs
+	}
+
+	body, err := probeBody(serializer, response)
+	for _, s := range opts.AssertContains {
+		switch {
+		case err != nil:
+			errs = append(errs, err)
+		case !bytes.Contains(body, []byte(s)):
+			errs = append(errs, fmt.Errorf("response body does not contain %q", s))
+		default:
+			errs = append(errs, nil)
+		}
+	}
+	return errs
+}
+
+// probeBody returns the JSON response body.
+func probeBody(serializer encoding.Serializer, response *transport.Response) ([]byte, error) {
+	outSerialized, err := responseToOutput(serializer, response)
+	if err != nil {
+		return nil, fmt.Errorf("failed while parsing response: %v", err)
+	}
+	body, err := json.Marshal(outSerialized["body"])
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert body to JSON: %v", err)
+	}
+	return body, nil
+}
+
+// runProbe makes the request every --interval until interrupted, checking
+// each response against the assertions, and printing whether it succeeded.
+// If --probe-metrics is set, the results are served as Prometheus metrics.
+func runProbe(out output, allOpts Options, t transport.Transport, serializer encoding.Serializer, req *transport.Request) {
+	opts := allOpts.POpts
+	p := newProber(allOpts.TOpts.ServiceName, allOpts.ROpts.MethodName)
+	if opts.MetricsAddr != "" {
+		ln, err := net.Listen("tcp", opts.MetricsAddr)
+		if err != nil {
+			out.Fatalf("Failed to listen for probe metrics: %v\n", err)
+		}
+		defer ln.Close()
+
+		go http.Serve(ln, p.handler())
+		out.Printf("Serving probe metrics on http://%v/metrics\n", ln.Addr())
+	}
+
+	// Each probe's request and assertions are checks in the JUnit report.
+	checks := []*junitCheck{{name: allOpts.ROpts.MethodName}}
+	for _, name := range probeAssertionNames(opts) {
+		checks = append(checks, &junitCheck{name: allOpts.ROpts.MethodName + ": " + name})
+	}
+	probesStart := time.Now()
+	defer func() {
+		if allOpts.junit == nil {
+			return
+		}
+
+		elapsed := time.Since(probesStart)
+		cases := make([]junitCase, len(checks))
+		for i, c := range checks {
+			cases[i] = c.testCase(allOpts.TOpts.ServiceName, elapsed)
+		}
+		allOpts.junit.addSuite("yab probe", probesStart, elapsed, cases)
+	}()
+
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+
+	for i := 0; opts.Count <= 0 || i < opts.Count; i++ {
+		if i > 0 {
+			<-ticker.C
+		}
+
+		start := time.Now()
+		response, err := makeRequest(t, req)
+		latency := time.Since(start)
+		checks[0].record(err)
+		if err == nil {
+			for i, assertErr := range checkProbeAssertions(opts, serializer, response, latency) {
+				checks[i+1].record(assertErr)
+				if err == nil {
+					err = assertErr
+				}
+			}
+		}
+
+		result := probeResult{
+			Time:      start,
+			Success:   err == nil,
+			LatencyMs: float64(latency) / float64(time.Millisecond),
+		}
+		timestamp := start.Format(watchTimeFormat)
+		if response != nil && response.TraceSampled {
+			result.Trace = response.Trace
+		}
+		if err != nil {
+			result.Error = err.Error()
+			out.Printf("[%v] FAILED after %v: %v\n", timestamp, roundMicros(latency), err)
+		} else {
+			out.Printf("[%v] OK in %v\n", timestamp, roundMicros(latency))
+		}
+		p.record(result)
+	}
+}
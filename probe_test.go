@@ -0,0 +1,213 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yarpc/yab/encoding"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel-go/raw"
+	"golang.org/x/net/context"
+)
+
+func TestRunProbe(t *testing.T) {
+	var calls int32
+	s := newServer(t)
+	defer s.shutdown()
+	s.register("Simple::bar", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		result := byte(1)
+		if atomic.AddInt32(&calls, 1) > 2 {
+			result = 2
+		}
+
+		return &raw.Res{
+			Arg2: args.Arg2,
+			Arg3: []byte{
+				8,    /* i32 */
+				0, 0, /* field ID */
+				0, 0, 0, result,
+				0, /* STOP */
+			},
+		}, nil
+	})
+
+	m := benchmarkMethodForTest(t, "Simple::bar")
+	transport, err := getTransport(s.transportOpts(), encoding.Thrift)
+	require.NoError(t, err, "Failed to get transport")
+
+	buf, out := getOutput(t)
+	opts := Options{
+		ROpts: RequestOptions{MethodName: "Simple::bar"},
+		POpts: ProbeOptions{
+			Interval:       time.Millisecond,
+			Count:          4,
+			MetricsAddr:    "127.0.0.1:0",
+			AssertContains: []string{`"result":1`},
+		},
+	}
+	runProbe(out, opts, transport, m.serializer, m.req)
+
+	output := buf.String()
+	assert.EqualValues(t, 4, calls, "Unexpected number of calls")
+	assert.Contains(t, output, "Serving probe metrics on http://127.0.0.1:", "Unexpected output")
+	assert.Equal(t, 2, strings.Count(output, "] OK in "), "Unexpected output: %v", output)
+	assert.Equal(t, 2, strings.Count(output, `] FAILED after `), "Unexpected output: %v", output)
+	assert.Contains(t, output, `response body does not contain "\"result\":1"`, "Unexpected output")
+}
+
+func TestRunProbeErrors(t *testing.T) {
+	m := benchmarkMethodForTest(t, fooMethod)
+	s := newServer(t)
+	defer s.shutdown()
+	s.register(fooMethod, methods.errorIf(func() bool { return false }))
+
+	transport, err := getTransport(s.transportOpts(), encoding.Thrift)
+	require.NoError(t, err, "Failed to get transport")
+
+	buf, out := getOutput(t)
+	opts := Options{POpts: ProbeOptions{
+		Interval:      time.Millisecond,
+		Count:         2,
+		AssertLatency: time.Nanosecond,
+	}}
+	runProbe(out, opts, transport, m.serializer, m.req)
+	assert.Equal(t, 2, strings.Count(buf.String(), "exceeded --assert-latency 1ns"), "Slow probes should fail")
+
+	buf.Reset()
+	m = benchmarkMethodForTest(t, "Simple::bar")
+	opts.POpts.AssertLatency = 0
+	runProbe(out, opts, transport, m.serializer, m.req)
+	assert.Equal(t, 2, strings.Count(buf.String(), "] FAILED after "), "Failed calls should not stop the probe")
+}
+
+func TestProberHandler(t *testing.T) {
+	p := newProber("svc", `Svc::"m"`)
+	server := httptest.NewServer(p.handler())
+	defer server.Close()
+
+	body := httpGet(t, server.URL+"/metrics")
+	assert.Contains(t, body, `yab_probe_total{service="svc",method="Svc::\"m\"",result="failure"} 0`, "Unexpected metrics")
+	assert.NotContains(t, body, "yab_probe_success", "The last result should not be reported before any probes")
+
+	now := time.Unix(1500000000, 0)
+	for i := 0; i < probeHistorySize+5; i++ {
+		p.record(probeResult{Time: now, Success: i%2 == 0, LatencyMs: 250})
+	}
+
+	body = httpGet(t, server.URL+"/metrics")
+	for _, want := range []string{
+		"# TYPE yab_probe_total counter",
+		`yab_probe_total{service="svc",method="Svc::\"m\"",result="success"} 53`,
+		`yab_probe_total{service="svc",method="Svc::\"m\"",result="failure"} 52`,
+		`yab_probe_success{service="svc",method="Svc::\"m\""} 1`,
+		`yab_probe_duration_seconds{service="svc",method="Svc::\"m\""} 0.25`,
+		`yab_probe_last_timestamp_seconds{service="svc",method="Svc::\"m\""} 1500000000`,
+	} {
+		assert.Contains(t, body, want, "Missing metric")
+	}
+
+	var history []probeResult
+	require.NoError(t, json.Unmarshal([]byte(httpGet(t, server.URL+"/history")), &history), "Failed to parse history")
+	assert.Len(t, history, probeHistorySize, "History should be limited")
+}
+
+func TestProberOpenMetrics(t *testing.T) {
+	p := newProber("svc", "Svc::m")
+	server := httptest.NewServer(p.handler())
+	defer server.Close()
+
+	now := time.Unix(1500000000, 0)
+	p.record(probeResult{Time: now, Success: true, LatencyMs: 3, Trace: "abc"})
+	p.record(probeResult{Time: now, Success: true, LatencyMs: 4})
+	p.record(probeResult{Time: now, Success: false, LatencyMs: 300, Trace: "def"})
+	p.record(probeResult{Time: now, Success: true, LatencyMs: 20000})
+
+	req, err := http.NewRequest("GET", server.URL+"/metrics", nil)
+	require.NoError(t, err, "Failed to create request")
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0,text/plain;q=0.5")
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err, "GET /metrics failed")
+	defer res.Body.Close()
+	bs, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err, "Failed to read /metrics")
+	body := string(bs)
+
+	assert.Contains(t, res.Header.Get("Content-Type"), "application/openmetrics-text", "Unexpected content type")
+	for _, want := range []string{
+		"# TYPE yab_probe counter",
+		`yab_probe_total{service="svc",method="Svc::m",result="success"} 3`,
+		"# TYPE yab_probe_latency_seconds histogram",
+		`yab_probe_latency_seconds_bucket{service="svc",method="Svc::m",le="0.005"} 2 # {trace_id="abc"} 0.003 1500000000.000`,
+		`yab_probe_latency_seconds_bucket{service="svc",method="Svc::m",le="0.25"} 2` + "\n",
+		`yab_probe_latency_seconds_bucket{service="svc",method="Svc::m",le="0.5"} 3 # {trace_id="def"} 0.3 1500000000.000`,
+		`yab_probe_latency_seconds_bucket{service="svc",method="Svc::m",le="+Inf"} 4` + "\n",
+		`yab_probe_latency_seconds_count{service="svc",method="Svc::m"} 4`,
+	} {
+		assert.Contains(t, body, want, "Missing metric")
+	}
+	assert.True(t, strings.HasSuffix(body, "# EOF\n"), "OpenMetrics must end with # EOF")
+
+	body = httpGet(t, server.URL+"/metrics")
+	assert.Contains(t, body, "# TYPE yab_probe_total counter", "Unexpected counter type")
+	assert.Contains(t, body, `yab_probe_latency_seconds_bucket{service="svc",method="Svc::m",le="0.5"} 3`+"\n", "Missing bucket")
+	assert.NotContains(t, body, "trace_id", "Exemplars are only supported by OpenMetrics")
+}
+
+func httpGet(t *testing.T, url string) string {
+	res, err := http.Get(url)
+	require.NoError(t, err, "GET %v failed", url)
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err, "Failed to read %v", url)
+	return string(body)
+}
+
+func TestProbeCommand(t *testing.T) {
+	origArgs := os.Args
+	defer func() { os.Args = origArgs }()
+
+	echoAddr := echoServer(t, fooMethod, nil)
+	os.Args = []string{
+		"yab", "probe",
+		"-t", validThrift,
+		"foo", fooMethod,
+		"-p", echoAddr,
+		"--interval", "1ms",
+		"--probe-count", "2",
+		"--assert-latency", "1s",
+	}
+
+	buf, out := getOutput(t)
+	parseAndRun(out)
+	assert.Equal(t, 2, strings.Count(buf.String(), "] OK in "), "Unexpected output: %v", buf.String())
+}
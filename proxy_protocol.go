@@ -0,0 +1,137 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+var errProxyProtocolTChannel = errors.New("--proxy-protocol is not supported for TChannel, which does not allow a custom dialer")
+
+// proxyV2Signature starts every PROXY protocol version 2 header.
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyProtocol prepends a PROXY protocol header to new connections, so
+// services behind L4 load balancers that require it can be called directly.
+type proxyProtocol struct {
+	version string
+
+	// source is the client address sent in the header. If the IP is nil,
+	// the connection's local address is used, and if the port is 0, the
+	// connection's local port is used.
+	source net.TCPAddr
+}
+
+// newProxyProtocol returns the PROXY protocol for the options, or nil if
+// the header is not sent.
+func newProxyProtocol(opts TransportOptions) (*proxyProtocol, error) {
+	if opts.ProxyProtocol == "" {
+		if opts.ProxyProtocolSource != "" {
+			return nil, errors.New("--proxy-protocol-source requires --proxy-protocol")
+		}
+		return nil, nil
+	}
+
+	p := &proxyProtocol{version: opts.ProxyProtocol}
+	if opts.ProxyProtocolSource == "" {
+		return p, nil
+	}
+
+	host, port := opts.ProxyProtocolSource, "0"
+	if h, pt, err := net.SplitHostPort(opts.ProxyProtocolSource); err == nil {
+		host, port = h, pt
+	}
+	p.source.IP = net.ParseIP(host)
+	portNum, err := strconv.ParseUint(port, 10, 16)
+	if p.source.IP == nil || err != nil {
+		return nil, fmt.Errorf("invalid --proxy-protocol-source %q, expected an IP or IP:port", opts.ProxyProtocolSource)
+	}
+	p.source.Port = int(portNum)
+	return p, nil
+}
+
+// header returns the header for a connection from local to remote.
+func (p *proxyProtocol) header(local, remote net.Addr) ([]byte, error) {
+	src, ok := local.(*net.TCPAddr)
+	dst, ok2 := remote.(*net.TCPAddr)
+	if !ok || !ok2 {
+		return nil, fmt.Errorf("PROXY protocol requires TCP connections, got %v", local.Network())
+	}
+
+	source := *src
+	if p.source.IP != nil {
+		source.IP = p.source.IP
+	}
+	if p.source.Port != 0 {
+		source.Port = p.source.Port
+	}
+
+	srcIP, dstIP := source.IP.To4(), dst.IP.To4()
+	if srcIP == nil || dstIP == nil {
+		if srcIP != nil || dstIP != nil {
+			return nil, fmt.Errorf("PROXY protocol source %v and destination %v must use the same IP version", source.IP, dst.IP)
+		}
+		srcIP, dstIP = source.IP.To16(), dst.IP.To16()
+	}
+
+	if p.version == "v1" {
+		family := "TCP4"
+		if len(srcIP) == net.IPv6len {
+			family = "TCP6"
+		}
+		return []byte(fmt.Sprintf("PROXY %v %v %v %v %v\r\n", family, srcIP, dstIP, source.Port, dst.Port)), nil
+	}
+
+	// Version 2 is a binary header: the signature, the version and PROXY
+	// command, the family and TCP, the length of the addresses, and then
+	// the addresses and ports.
+	family := byte(0x11)
+	if len(srcIP) == net.IPv6len {
+		family = 0x21
+	}
+	buf := &bytes.Buffer{}
+	buf.Write(proxyV2Signature)
+	buf.WriteByte(0x21)
+	buf.WriteByte(family)
+	binary.Write(buf, binary.BigEndian, uint16(2*len(srcIP)+4))
+	buf.Write(srcIP)
+	buf.Write(dstIP)
+	binary.Write(buf, binary.BigEndian, uint16(source.Port))
+	binary.Write(buf, binary.BigEndian, uint16(dst.Port))
+	return buf.Bytes(), nil
+}
+
+// write sends the header on a new connection.
+func (p *proxyProtocol) write(conn net.Conn) error {
+	header, err := p.header(conn.LocalAddr(), conn.RemoteAddr())
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(header); err != nil {
+		return fmt.Errorf("failed to send PROXY protocol header: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewProxyProtocol(t *testing.T) {
+	tests := []struct {
+		opts    TransportOptions
+		want    *proxyProtocol
+		wantErr string
+	}{
+		{opts: TransportOptions{}},
+		{
+			opts: TransportOptions{ProxyProtocol: "v1"},
+			want: &proxyProtocol{version: "v1"},
+		},
+		{
+			opts: TransportOptions{ProxyProtocol: "v2", ProxyProtocolSource: "203.0.113.7"},
+			want: &proxyProtocol{version: "v2", source: net.TCPAddr{IP: net.ParseIP("203.0.113.7")}},
+		},
+		{
+			opts: TransportOptions{ProxyProtocol: "v2", ProxyProtocolSource: "[2001:db8::1]:4000"},
+			want: &proxyProtocol{version: "v2", source: net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 4000}},
+		},
+		{
+			opts:    TransportOptions{ProxyProtocol: "v1", ProxyProtocolSource: "203.0.113.7:70000"},
+			wantErr: "invalid --proxy-protocol-source",
+		},
+		{
+			opts:    TransportOptions{ProxyProtocolSource: "203.0.113.7"},
+			wantErr: "requires --proxy-protocol",
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := newProxyProtocol(tt.opts)
+		if tt.wantErr != "" {
+			if assert.Error(t, err, "newProxyProtocol(%+v) should fail", tt.opts) {
+				assert.Contains(t, err.Error(), tt.wantErr, "newProxyProtocol(%+v) unexpected error", tt.opts)
+			}
+			continue
+		}
+
+		require.NoError(t, err, "newProxyProtocol(%+v) failed", tt.opts)
+		assert.Equal(t, tt.want, got, "newProxyProtocol(%+v) mismatch", tt.opts)
+	}
+}
+
+func TestProxyProtocolHeader(t *testing.T) {
+	local4 := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 5000}
+	remote4 := &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 443}
+	local6 := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 5000}
+	remote6 := &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 443}
+
+	tests := []struct {
+		msg     string
+		proxy   proxyProtocol
+		local   net.Addr
+		remote  net.Addr
+		want    string
+		wantErr string
+	}{
+		{
+			msg:    "v1 IPv4",
+			proxy:  proxyProtocol{version: "v1"},
+			local:  local4,
+			remote: remote4,
+			want:   "PROXY TCP4 10.0.0.1 10.0.0.2 5000 443\r\n",
+		},
+		{
+			msg:    "v1 IPv6 with source",
+			proxy:  proxyProtocol{version: "v1", source: net.TCPAddr{IP: net.ParseIP("2001:db8::7"), Port: 4000}},
+			local:  local6,
+			remote: remote6,
+			want:   "PROXY TCP6 2001:db8::7 2001:db8::2 4000 443\r\n",
+		},
+		{
+			msg:    "v2 IPv4 with source IP",
+			proxy:  proxyProtocol{version: "v2", source: net.TCPAddr{IP: net.ParseIP("203.0.113.7")}},
+			local:  local4,
+			remote: remote4,
+			want: "\r\n\r\n\x00\r\nQUIT\n\x21\x11\x00\x0c" +
+				"\xcb\x00\x71\x07" + "\x0a\x00\x00\x02" + "\x13\x88" + "\x01\xbb",
+		},
+		{
+			msg:    "v2 IPv6",
+			proxy:  proxyProtocol{version: "v2"},
+			local:  local6,
+			remote: remote6,
+			want: "\r\n\r\n\x00\r\nQUIT\n\x21\x21\x00\x24" +
+				"\x20\x01\x0d\xb8\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01" +
+				"\x20\x01\x0d\xb8\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02" +
+				"\x13\x88" + "\x01\xbb",
+		},
+		{
+			msg:     "mixed IP versions",
+			proxy:   proxyProtocol{version: "v1", source: net.TCPAddr{IP: net.ParseIP("203.0.113.7")}},
+			local:   local6,
+			remote:  remote6,
+			wantErr: "must use the same IP version",
+		},
+		{
+			msg:     "not TCP",
+			proxy:   proxyProtocol{version: "v1"},
+			local:   &net.UnixAddr{Name: "/tmp/sock", Net: "unix"},
+			remote:  &net.UnixAddr{Name: "/tmp/sock", Net: "unix"},
+			wantErr: "requires TCP connections",
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.proxy.header(tt.local, tt.remote)
+		if tt.wantErr != "" {
+			if assert.Error(t, err, "%v: expected error", tt.msg) {
+				assert.Contains(t, err.Error(), tt.wantErr, "%v: unexpected error", tt.msg)
+			}
+			continue
+		}
+
+		require.NoError(t, err, "%v: header failed", tt.msg)
+		assert.Equal(t, tt.want, string(got), "%v: unexpected header", tt.msg)
+	}
+}
+
+func TestDialerProxyProtocol(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Listen failed")
+	defer ln.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		header, _ := r.ReadString('\n')
+		body, _ := ioutil.ReadAll(r)
+		received <- header + string(body)
+	}()
+
+	dial, err := getDialer(TransportOptions{ProxyProtocol: "v1", ProxyProtocolSource: "203.0.113.7:4000"})
+	require.NoError(t, err, "getDialer failed")
+
+	conn, err := dial("tcp", ln.Addr().String())
+	require.NoError(t, err, "Dial failed")
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err, "Write failed")
+	conn.Close()
+
+	_, port, err := net.SplitHostPort(ln.Addr().String())
+	require.NoError(t, err, "SplitHostPort failed")
+	assert.Equal(t, "PROXY TCP4 203.0.113.7 127.0.0.1 4000 "+port+"\r\nhello", <-received, "Unexpected data received")
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+type burst struct {
+	sync.Mutex
+	size     int
+	interval time.Duration
+	done     <-chan struct{}
+
+	start time.Time
+	taken int
+}
+
+// NewBurst returns a Limiter that allows size calls at the start of each
+// interval, and blocks further calls until the next interval starts. Blocked
+// calls return immediately once done is closed.
+func NewBurst(size int, interval time.Duration, done <-chan struct{}) Limiter {
+	return &burst{
+		size:     size,
+		interval: interval,
+		done:     done,
+	}
+}
+
+// Take blocks once size calls have been made in the current interval, until
+// the next interval starts.
+func (b *burst) Take() {
+	b.Lock()
+	defer b.Unlock()
+
+	cur := time.Now()
+	if b.start.IsZero() {
+		b.start = cur
+	}
+
+	// If the service is slow, intervals may pass without any calls. Skip them
+	// rather than sending a larger burst to catch up.
+	if elapsed := cur.Sub(b.start); elapsed >= b.interval {
+		b.start = b.start.Add(elapsed / b.interval * b.interval)
+		b.taken = 0
+	}
+
+	if b.taken < b.size {
+		b.taken++
+		return
+	}
+
+	next := b.start.Add(b.interval)
+	timer := time.NewTimer(next.Sub(cur))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-b.done:
+		return
+	}
+	b.start = next
+	b.taken = 1
+}
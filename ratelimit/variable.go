@@ -0,0 +1,110 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// idlePoll is how often a variable limiter checks the rate while it is 0.
+const idlePoll = 100 * time.Millisecond
+
+// maxVariableSlack is the number of requests that a variable limiter allows
+// to catch up on after a slow period.
+const maxVariableSlack = 10
+
+type variable struct {
+	sync.Mutex
+	rate func(elapsed time.Duration) float64
+	done <-chan struct{}
+
+	start time.Time
+	next  time.Time
+}
+
+// NewVariable returns a Limiter whose RPS changes over time. The rate is
+// called with the time since the first call to Take, and returns the RPS
+// to use at that time. Blocked calls return immediately once done is closed.
+func NewVariable(rate func(elapsed time.Duration) float64, done <-chan struct{}) Limiter {
+	return &variable{
+		rate: rate,
+		done: done,
+	}
+}
+
+// Take blocks until the next request is allowed by the rate at that time.
+func (v *variable) Take() {
+	v.Lock()
+	defer v.Unlock()
+
+	cur := time.Now()
+	if v.start.IsZero() {
+		v.start = cur
+		v.next = cur
+	}
+
+	for {
+		rps := v.rate(v.next.Sub(v.start))
+		if rps <= 0 {
+			v.next = v.next.Add(idlePoll)
+			if v.next.Before(cur) {
+				v.next = cur
+			}
+			if !v.sleepUntil(v.next) {
+				return
+			}
+			cur = v.next
+			continue
+		}
+
+		perRequest := time.Duration(float64(time.Second) / rps)
+
+		// Similar to New, don't allow a slow period to cause a much higher
+		// RPS afterwards.
+		if minNext := cur.Add(-maxVariableSlack * perRequest); v.next.Before(minNext) {
+			v.next = minNext
+		}
+
+		allowed := v.next
+		v.next = v.next.Add(perRequest)
+		v.sleepUntil(allowed)
+		return
+	}
+}
+
+// sleepUntil sleeps until t, and returns false if done was closed first.
+func (v *variable) sleepUntil(t time.Time) bool {
+	d := t.Sub(time.Now())
+	if d <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-v.done:
+		return false
+	}
+}
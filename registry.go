@@ -0,0 +1,102 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/yarpc/yab/encoding"
+)
+
+var (
+	errRegistryNoService = errors.New("specify a service name using --service to fetch its IDL from the registry")
+	errRegistryBuf       = errors.New("the Buf Schema Registry only serves Protobuf definitions, which are not supported")
+)
+
+// latestVersion is the version used when no IDL version is specified.
+const latestVersion = "latest"
+
+// idlRegistry looks up the IDL for a service.
+type idlRegistry interface {
+	// ThriftFile returns the path of a local copy of the Thrift file
+	// for the given service and version.
+	ThriftFile(service, version string) (string, error)
+}
+
+// newIDLRegistry returns the registry client for the given registry address.
+func newIDLRegistry(registry string) (idlRegistry, error) {
+	u, err := url.Parse(registry)
+	if err != nil {
+		return nil, fmt.Errorf("invalid registry %q: %v", registry, err)
+	}
+
+	switch {
+	case u.Scheme == "buf" || u.Host == "buf.build" || strings.HasSuffix(u.Host, ".buf.build"):
+		return nil, errRegistryBuf
+	case isURL(registry):
+		return httpRegistry{strings.TrimSuffix(registry, "/")}, nil
+	}
+	return nil, fmt.Errorf("unsupported registry %q, specify a http(s) URL", registry)
+}
+
+// httpRegistry is an IDL registry that uses a simple artifact convention,
+// where the Thrift file for a service is served at
+// {registry}/{service}/{version}/{service}.thrift.
+type httpRegistry struct {
+	baseURL string
+}
+
+func (r httpRegistry) ThriftFile(service, version string) (string, error) {
+	if version == "" {
+		version = latestVersion
+	}
+
+	service = url.PathEscape(service)
+	fileURL := fmt.Sprintf("%v/%v/%v/%v.thrift", r.baseURL, service, url.PathEscape(version), service)
+	return fetchURL(fileURL, "")
+}
+
+// registryThriftFile returns the Thrift file to use for the request, fetching
+// it from the registry if one is specified and no Thrift file was given.
+func registryThriftFile(rOpts RequestOptions, service string) (string, error) {
+	if rOpts.Registry == "" || rOpts.ThriftFile != "" || rOpts.Health {
+		return rOpts.ThriftFile, nil
+	}
+
+	switch rOpts.Encoding {
+	case encoding.UnspecifiedEncoding, encoding.Thrift:
+	default:
+		return "", nil
+	}
+
+	if service == "" {
+		return "", errRegistryNoService
+	}
+
+	registry, err := newIDLRegistry(rOpts.Registry)
+	if err != nil {
+		return "", err
+	}
+	return registry.ThriftFile(service, rOpts.RegistryVersion)
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yarpc/yab/encoding"
+)
+
+func TestNewIDLRegistry(t *testing.T) {
+	tests := []struct {
+		registry string
+		want     idlRegistry
+		errMsg   string
+	}{
+		{
+			registry: "https://idl.example.com/",
+			want:     httpRegistry{"https://idl.example.com"},
+		},
+		{
+			registry: "http://localhost:8080/idl",
+			want:     httpRegistry{"http://localhost:8080/idl"},
+		},
+		{
+			registry: "https://buf.build/acme",
+			errMsg:   errRegistryBuf.Error(),
+		},
+		{
+			registry: "buf://acme",
+			errMsg:   errRegistryBuf.Error(),
+		},
+		{
+			registry: "idl.example.com",
+			errMsg:   "unsupported registry",
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := newIDLRegistry(tt.registry)
+		if tt.errMsg != "" {
+			if assert.Error(t, err, "newIDLRegistry(%v) should fail", tt.registry) {
+				assert.Contains(t, err.Error(), tt.errMsg, "newIDLRegistry(%v) unexpected error", tt.registry)
+			}
+			continue
+		}
+
+		if assert.NoError(t, err, "newIDLRegistry(%v) failed", tt.registry) {
+			assert.Equal(t, tt.want, got, "newIDLRegistry(%v) mismatch", tt.registry)
+		}
+	}
+}
+
+func TestRegistryThriftFile(t *testing.T) {
+	defer withURLCacheDir(t)()
+
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		http.ServeFile(w, r, validThrift)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		msg      string
+		rOpts    RequestOptions
+		service  string
+		wantPath string
+		want     string
+		errMsg   string
+	}{
+		{
+			msg:   "no registry",
+			rOpts: RequestOptions{ThriftFile: "a.thrift"},
+			want:  "a.thrift",
+		},
+		{
+			msg:   "Thrift file overrides registry",
+			rOpts: RequestOptions{ThriftFile: "a.thrift", Registry: server.URL},
+			want:  "a.thrift",
+		},
+		{
+			msg:   "health does not need an IDL",
+			rOpts: RequestOptions{Registry: server.URL, Health: true},
+		},
+		{
+			msg:   "JSON does not need an IDL",
+			rOpts: RequestOptions{Registry: server.URL, Encoding: encoding.JSON},
+		},
+		{
+			msg:    "no service",
+			rOpts:  RequestOptions{Registry: server.URL},
+			errMsg: errRegistryNoService.Error(),
+		},
+		{
+			msg:      "default version",
+			rOpts:    RequestOptions{Registry: server.URL},
+			service:  "foo",
+			wantPath: "/foo/latest/foo.thrift",
+		},
+		{
+			msg:      "specific version",
+			rOpts:    RequestOptions{Registry: server.URL + "/", RegistryVersion: "v1.2.3"},
+			service:  "foo",
+			wantPath: "/foo/v1.2.3/foo.thrift",
+		},
+	}
+
+	for _, tt := range tests {
+		paths = nil
+		got, err := registryThriftFile(tt.rOpts, tt.service)
+		if tt.errMsg != "" {
+			if assert.Error(t, err, "%v: expected error", tt.msg) {
+				assert.Contains(t, err.Error(), tt.errMsg, "%v: unexpected error", tt.msg)
+			}
+			continue
+		}
+		require.NoError(t, err, "%v: registryThriftFile failed", tt.msg)
+
+		if tt.wantPath == "" {
+			assert.Equal(t, tt.want, got, "%v: unexpected Thrift file", tt.msg)
+			assert.Empty(t, paths, "%v: registry should not be used", tt.msg)
+			continue
+		}
+
+		assert.Equal(t, []string{tt.wantPath}, paths, "%v: unexpected registry request", tt.msg)
+		assert.Equal(t, mustRead(validThrift), mustRead(got), "%v: unexpected Thrift file contents", tt.msg)
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/yarpc/yab/encoding"
+	"github.com/yarpc/yab/transport"
+)
+
+// maxReplayLine is the maximum length of a line in a replay capture.
+const maxReplayLine = 16 << 20
+
+var (
+	errReplayPace    = errors.New("replay pace must be original, or a speed such as 2x or 0.5x")
+	errReplayEmpty   = errors.New("replay capture must contain at least one request")
+	errReplayTooFew  = errors.New("a paced replay needs at least two requests")
+	errReplayStopped = errors.New("the benchmark stopped before the replayed request was due")
+)
+
+// replayLine is a captured request, which is a line of a replay capture.
+type replayLine struct {
+	Time    json.RawMessage   `json:"time"`
+	Request json.RawMessage   `json:"request"`
+	Headers map[string]string `json:"headers"`
+}
+
+// replayEntry is a serialized request from a capture, and when it was sent
+// relative to the first request.
+type replayEntry struct {
+	offset time.Duration
+	req    *transport.Request
+}
+
+// parseReplayPace parses original, which is a pace of 1, or a speed such as
+// 2x. An empty pace is 0, which sends requests as fast as allowed.
+func parseReplayPace(s string) (float64, error) {
+	switch s {
+	case "":
+		return 0, nil
+	case "original":
+		return 1, nil
+	}
+
+	pace, err := strconv.ParseFloat(strings.TrimSuffix(s, "x"), 64)
+	if err != nil || !strings.HasSuffix(s, "x") || pace <= 0 || math.IsInf(pace, 0) {
+		return 0, errReplayPace
+	}
+	return pace, nil
+}
+
+// loadReplay reads the capture at path, which has a JSON object per line with
+// the time the request was sent, the request, and optionally headers, which
+// are added to the base request's headers.
+func loadReplay(path string, serializer encoding.Serializer, base *transport.Request) ([]replayEntry, error) {
+	f, err := openFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open replay capture: %v", err)
+	}
+	defer f.Close()
+
+	var (
+		entries []replayEntry
+		first   time.Time
+		prev    time.Time
+	)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, maxReplayLine)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var captured replayLine
+		if err := json.Unmarshal(line, &captured); err != nil {
+			return nil, fmt.Errorf("invalid replay capture line %v: %v", lineNum, err)
+		}
+		at, err := parseReplayTime(captured.Time)
+		if err != nil {
+			return nil, fmt.Errorf("invalid replay capture line %v: %v", lineNum, err)
+		}
+		if len(entries) == 0 {
+			first = at
+		} else if at.Before(prev) {
+			return nil, fmt.Errorf("replay capture line %v is earlier than the previous line, captures must be in time order", lineNum)
+		}
+		prev = at
+
+		req, err := replayRequest(serializer, base, captured)
+		if err != nil {
+			return nil, fmt.Errorf("invalid request on replay capture line %v: %v", lineNum, err)
+		}
+		entries = append(entries, replayEntry{offset: at.Sub(first), req: req})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read replay capture: %v", err)
+	}
+
+	if len(entries) == 0 {
+		return nil, errReplayEmpty
+	}
+	return entries, nil
+}
+
+// parseReplayTime parses a RFC 3339 time, or a number of seconds since the Unix epoch.
+func parseReplayTime(raw json.RawMessage) (time.Time, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return time.Parse(time.RFC3339Nano, s)
+	}
+
+	var secs float64
+	if err := json.Unmarshal(raw, &secs); err != nil {
+		return time.Time{}, fmt.Errorf("time must be a RFC 3339 time or Unix seconds, got %s", raw)
+	}
+	return time.Unix(0, int64(secs*float64(time.Second))), nil
+}
+
+// replayRequest serializes a captured request. Raw requests may be a JSON
+// string, which is sent without the quotes.
+func replayRequest(serializer encoding.Serializer, base *transport.Request, captured replayLine) (*transport.Request, error) {
+	body := []byte(captured.Request)
+	var s string
+	if serializer.Encoding() == encoding.Raw && json.Unmarshal(body, &s) == nil {
+		body = []byte(s)
+	}
+
+	req, err := serializer.Request(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Timeout = base.Timeout
+	req.ShardKey = base.ShardKey
+	req.Headers = make(map[string]string, len(base.Headers)+len(captured.Headers))
+	for k, v := range base.Headers {
+		req.Headers[k] = v
+	}
+	capturedHeaders, err := secrets.resolveHeaders(captured.Headers)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range capturedHeaders {
+		req.Headers[k] = v
+	}
+	return req, nil
+}
+
+// replaySchedule returns the captured requests in order to all the workers
+// of a target, starting again after the last request. If it's paced, each
+// request is returned at its original time, scaled by the pace.
+type replaySchedule struct {
+	entries []replayEntry
+	pace    float64
+	done    <-chan struct{}
+
+	// length is the duration of a pass through the capture, which includes
+	// the average gap between requests before starting again.
+	length time.Duration
+
+	// start is set when the benchmark starts, before next is called.
+	start time.Time
+
+	// sent is the number of requests returned.
+	sent int64
+}
+
+func newReplaySchedule(entries []replayEntry, pace float64, done <-chan struct{}) (*replaySchedule, error) {
+	s := &replaySchedule{entries: entries, pace: pace, done: done}
+	if pace == 0 {
+		return s, nil
+	}
+
+	if len(entries) < 2 {
+		return nil, errReplayTooFew
+	}
+	last := entries[len(entries)-1].offset
+	s.length = last + last/time.Duration(len(entries)-1)
+	return s, nil
+}
+
+// next returns the next request, waiting until it's due if the replay is paced.
+func (s *replaySchedule) next() (*transport.Request, error) {
+	i := atomic.AddInt64(&s.sent, 1) - 1
+	n := int64(len(s.entries))
+	e := s.entries[i%n]
+	if s.pace == 0 {
+		return e.req, nil
+	}
+
+	at := time.Duration(i/n)*s.length + e.offset
+	wait := time.Duration(float64(at)/s.pace) - time.Since(s.start)
+	if wait <= 0 {
+		return e.req, nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return e.req, nil
+	case <-s.done:
+		return nil, errReplayStopped
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yarpc/yab/encoding"
+	"github.com/yarpc/yab/transport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseReplayPace(t *testing.T) {
+	tests := []struct {
+		pace    string
+		want    float64
+		wantErr bool
+	}{
+		{pace: "", want: 0},
+		{pace: "original", want: 1},
+		{pace: "2x", want: 2},
+		{pace: "0.5x", want: 0.5},
+		{pace: "2", wantErr: true},
+		{pace: "0x", wantErr: true},
+		{pace: "-1x", wantErr: true},
+		{pace: "fast", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseReplayPace(tt.pace)
+		if tt.wantErr {
+			assert.Equal(t, errReplayPace, err, "parseReplayPace(%q) should fail", tt.pace)
+			continue
+		}
+		if assert.NoError(t, err, "parseReplayPace(%q) failed", tt.pace) {
+			assert.Equal(t, tt.want, got, "parseReplayPace(%q) mismatch", tt.pace)
+		}
+	}
+}
+
+func TestLoadReplay(t *testing.T) {
+	capture := writeFile(t, "capture", `{"time": "2026-01-02T15:04:05Z", "request": {"id": 1}}
+
+{"time": "2026-01-02T15:04:05.25Z", "request": {"id": 2}, "headers": {"user": "bob"}}
+{"time": 1767366246, "request": {"id": 3}}
+`)
+	defer os.Remove(capture)
+
+	base := &transport.Request{
+		Timeout: time.Second,
+		Headers: map[string]string{"user": "alice", "env": "test"},
+	}
+	entries, err := loadReplay(capture, encoding.NewJSON("method"), base)
+	require.NoError(t, err, "loadReplay failed")
+	require.Len(t, entries, 3, "Unexpected number of entries")
+
+	wantOffsets := []time.Duration{0, 250 * time.Millisecond, time.Second}
+	wantBodies := []string{`{"id":1}`, `{"id":2}`, `{"id":3}`}
+	for i, e := range entries {
+		assert.Equal(t, wantOffsets[i], e.offset, "Unexpected offset for entry %v", i)
+		assert.JSONEq(t, wantBodies[i], string(e.req.Body), "Unexpected body for entry %v", i)
+		assert.Equal(t, time.Second, e.req.Timeout, "Timeout should be copied from the base request")
+	}
+	assert.Equal(t, map[string]string{"user": "alice", "env": "test"}, entries[0].req.Headers, "Unexpected base headers")
+	assert.Equal(t, map[string]string{"user": "bob", "env": "test"}, entries[1].req.Headers, "Captured headers should override base headers")
+	assert.Equal(t, "alice", base.Headers["user"], "Base request should not be modified")
+}
+
+func TestLoadReplayErrors(t *testing.T) {
+	tests := []struct {
+		contents string
+		errMsg   string
+	}{
+		{contents: "", errMsg: errReplayEmpty.Error()},
+		{contents: "not json", errMsg: "invalid replay capture line 1"},
+		{contents: `{"time": "yesterday", "request": {}}`, errMsg: "invalid replay capture line 1"},
+		{contents: `{"time": true, "request": {}}`, errMsg: "time must be a RFC 3339 time or Unix seconds"},
+		{
+			contents: `{"time": 10, "request": {}}` + "\n" + `{"time": 5, "request": {}}`,
+			errMsg:   "line 2 is earlier than the previous line",
+		},
+		{contents: `{"time": 10, "request": [1]}`, errMsg: "invalid request on replay capture line 1"},
+	}
+
+	for _, tt := range tests {
+		capture := writeFile(t, "capture", tt.contents)
+		defer os.Remove(capture)
+
+		_, err := loadReplay(capture, encoding.NewJSON("method"), &transport.Request{})
+		if assert.Error(t, err, "loadReplay(%q) should fail", tt.contents) {
+			assert.Contains(t, err.Error(), tt.errMsg, "loadReplay(%q) unexpected error", tt.contents)
+		}
+	}
+
+	_, err := loadReplay("/fake/capture", encoding.NewJSON("method"), &transport.Request{})
+	assert.Error(t, err, "Expected missing capture to fail")
+}
+
+func TestReplaySchedulePaced(t *testing.T) {
+	entries := []replayEntry{
+		{offset: 0, req: &transport.Request{Method: "a"}},
+		{offset: 100 * time.Millisecond, req: &transport.Request{Method: "b"}},
+		{offset: 200 * time.Millisecond, req: &transport.Request{Method: "c"}},
+	}
+
+	_, err := newReplaySchedule(entries[:1], 1, nil)
+	assert.Equal(t, errReplayTooFew, err, "Paced replays need multiple requests")
+
+	s, err := newReplaySchedule(entries, 2, nil)
+	require.NoError(t, err, "newReplaySchedule failed")
+	s.start = time.Now()
+
+	// At twice the speed, a pass takes 150ms, including the average gap.
+	wantMethods := []string{"a", "b", "c", "a"}
+	wantTimes := []time.Duration{0, 50 * time.Millisecond, 100 * time.Millisecond, 150 * time.Millisecond}
+	for i := range wantMethods {
+		req, err := s.next()
+		require.NoError(t, err, "next failed")
+		assert.Equal(t, wantMethods[i], req.Method, "Unexpected request %v", i)
+
+		elapsed := time.Since(s.start)
+		assert.True(t, elapsed >= wantTimes[i], "Request %v was sent early at %v", i, elapsed)
+		assert.True(t, elapsed < wantTimes[i]+40*time.Millisecond, "Request %v was sent late at %v", i, elapsed)
+	}
+
+	done := make(chan struct{})
+	close(done)
+	s, err = newReplaySchedule(entries, 0.001, done)
+	require.NoError(t, err, "newReplaySchedule failed")
+	s.start = time.Now()
+	_, err = s.next()
+	assert.NoError(t, err, "The first request is due immediately")
+	_, err = s.next()
+	assert.Equal(t, errReplayStopped, err, "Requests due after the benchmark stops should not be sent")
+}
+
+func TestBenchmarkReplay(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		bodies []string
+	)
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		w.Write([]byte("{}"))
+	}))
+	defer svr.Close()
+
+	capture := writeFile(t, "capture", `{"time": 0, "request": "first"}
+{"time": 0.1, "request": "second"}
+`)
+	defer os.Remove(capture)
+
+	buf, out := getOutput(t)
+	start := time.Now()
+	runBenchmark(out, Options{
+		BOpts: BenchmarkOptions{
+			MaxRequests: 4,
+			MaxDuration: time.Second,
+			Connections: 1,
+			Concurrency: 1,
+			ReplayFile:  capture,
+			ReplayPace:  "original",
+		},
+		TOpts: TransportOptions{ServiceName: "foo", HostPorts: []string{svr.URL}},
+	}, benchmarkMethod{serializer: encoding.NewRaw("method"), req: &transport.Request{Timeout: time.Second}})
+
+	assert.Contains(t, buf.String(), "Replay pace:     original", "Missing replay pace parameter")
+	assert.True(t, time.Since(start) >= 300*time.Millisecond, "Requests should be sent at their original times")
+
+	// Warm up uses the first captured request.
+	want := []string{"first", "second", "first", "second"}
+	require.True(t, len(bodies) > len(want), "Missing requests")
+	assert.Equal(t, want, bodies[len(bodies)-len(want):], "Replayed requests should be sent in order")
+	for _, body := range bodies[:len(bodies)-len(want)] {
+		assert.Equal(t, "first", body, "Unexpected warm up request")
+	}
+}
@@ -0,0 +1,454 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yarpc/yab/sorted"
+)
+
+const (
+	reportChartWidth       = 720
+	reportChartHeight      = 200
+	reportHistogramBuckets = 40
+)
+
+// reportColors are the colors used for each target in time series charts.
+var reportColors = []string{"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b", "#e377c2", "#7f7f7f"}
+
+// benchmarkReport records the per-second samples of a benchmark, so a
+// self-contained HTML report of the results can be written once it ends.
+// It's written to by the resultsExporter.
+type benchmarkReport struct {
+	run     time.Time
+	samples []resultPoint
+}
+
+func (r *benchmarkReport) write(run time.Time, points []resultPoint) error {
+	r.run = run
+	for _, p := range points {
+		if p.kind == resultsSample {
+			r.samples = append(r.samples, p)
+		}
+	}
+	return nil
+}
+
+func (r *benchmarkReport) Close() error {
+	return nil
+}
+
+// reportResults are the results of the benchmark included in the report.
+type reportResults struct {
+	service string
+	params  []benchmarkParam
+	targets []benchmarkTarget
+	states  []*benchmarkState
+	overall *benchmarkState
+	total   time.Duration
+
+	// groups is only set if peers have metadata that results can be grouped by.
+	groups *peerGroups
+}
+
+// The types below are used to render the report template.
+type reportPage struct {
+	Title     string
+	Started   string
+	Summary   []reportField
+	Params    []reportField
+	Quantiles []reportField
+	Histogram reportChart
+	RPS       reportChart
+	P99       reportChart
+	Targets   []reportRow
+	Peers     []reportTable
+	Errors    []reportCount
+	Throttled []reportCount
+}
+
+type reportField struct {
+	Name  string
+	Value string
+}
+
+type reportRow struct {
+	Name     string
+	Requests int
+	Errors   int
+	RPS      string
+	P50      time.Duration
+	P90      time.Duration
+	P99      time.Duration
+}
+
+type reportTable struct {
+	Name string
+	Rows []reportRow
+}
+
+type reportCount struct {
+	Message string
+	Count   int
+}
+
+type reportChart struct {
+	Width  int
+	Height int
+	XMin   string
+	XMax   string
+	YMax   string
+	Bars   []reportBar
+	Lines  []reportLine
+}
+
+// Margin is the space around the chart's plot area for labels.
+func (c reportChart) Margin() int { return 20 }
+
+// SVGWidth is the width of the chart, including the margin.
+func (c reportChart) SVGWidth() int { return c.Width + 2*c.Margin() }
+
+// SVGHeight is the height of the chart, including the margin.
+func (c reportChart) SVGHeight() int { return c.Height + 2*c.Margin() }
+
+type reportBar struct {
+	X, Y, Width, Height float64
+	Title               string
+}
+
+type reportLine struct {
+	Name   string
+	Color  string
+	Points string
+}
+
+// writeFile writes the report to file, logging a warning on failure.
+func (r *benchmarkReport) writeFile(file string, logger *logger, results reportResults) {
+	f, err := os.Create(file)
+	if err == nil {
+		err = r.render(f, results)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		logger.Warnf("failed to write report: %v", err)
+		return
+	}
+	logger.Infof("wrote the benchmark report to %v", file)
+}
+
+func (r *benchmarkReport) render(w io.Writer, results reportResults) error {
+	overall := results.overall
+	sort.Sort(byDuration(overall.latencies))
+
+	targetNames := make([]string, len(results.targets))
+	for i, t := range results.targets {
+		targetNames[i] = t.name
+	}
+
+	page := reportPage{
+		Title:   "yab benchmark of " + strings.Join(targetNames, ", "),
+		Started: r.run.Format(time.RFC1123),
+		Summary: []reportField{
+			{"Requests", fmt.Sprint(len(overall.latencies))},
+			{"Errors", fmt.Sprint(countMessages(overall.errors))},
+			{"Throttled", fmt.Sprint(countMessages(overall.throttled))},
+			{"RPS", fmt.Sprintf("%.2f", float64(len(overall.latencies))/results.total.Seconds())},
+			{"Elapsed time", fmt.Sprint(results.total / time.Millisecond * time.Millisecond)},
+		},
+		Histogram: latencyHistogram(overall),
+		RPS: r.timeSeries(func(p resultPoint) float64 { return p.rps }, func(max float64) string {
+			return fmt.Sprintf("%.0f RPS", max)
+		}),
+		P99: r.timeSeries(func(p resultPoint) float64 { return float64(p.p99) / float64(time.Millisecond) }, func(max float64) string {
+			return fmt.Sprintf("%.2fms", max)
+		}),
+		Errors:    reportCounts(overall.errors),
+		Throttled: reportCounts(overall.throttled),
+	}
+
+	if results.service != "" {
+		page.Params = append(page.Params, reportField{"Service", results.service})
+	}
+	for _, p := range results.params {
+		page.Params = append(page.Params, reportField{p.name, fmt.Sprint(p.value)})
+	}
+
+	for _, q := range []float64{0.5, 0.9, 0.95, 0.99, 0.999, 0.9995, 1.0} {
+		page.Quantiles = append(page.Quantiles, reportField{fmt.Sprintf("%.4f", q), overall.getQuantile(q).String()})
+	}
+
+	if len(results.targets) > 1 {
+		for i, t := range results.targets {
+			page.Targets = append(page.Targets, newReportRow(t.name, results.states[i], results.total))
+		}
+	}
+
+	if len(overall.peerLatencies) > 0 {
+		page.Peers = append(page.Peers, latencyTable("peer", overall.peerLatencies))
+	}
+	if g := results.groups; g != nil {
+		for _, key := range g.keys {
+			grouped := make(map[string][]time.Duration)
+			for peer, latencies := range overall.peerLatencies {
+				group, ok := g.metadata[peer][key]
+				if !ok {
+					group = "unknown"
+				}
+				grouped[group] = append(grouped[group], latencies...)
+			}
+			page.Peers = append(page.Peers, latencyTable(key, grouped))
+		}
+	}
+
+	return reportTemplate.Execute(w, page)
+}
+
+func newReportRow(name string, s *benchmarkState, total time.Duration) reportRow {
+	sort.Sort(byDuration(s.latencies))
+	return reportRow{
+		Name:     name,
+		Requests: len(s.latencies),
+		Errors:   countMessages(s.errors),
+		RPS:      fmt.Sprintf("%.2f", float64(len(s.latencies))/total.Seconds()),
+		P50:      s.getQuantile(0.5),
+		P90:      s.getQuantile(0.9),
+		P99:      s.getQuantile(0.99),
+	}
+}
+
+func latencyTable(name string, groups map[string][]time.Duration) reportTable {
+	table := reportTable{Name: name}
+	for _, group := range sorted.MapKeys(groups) {
+		state := &benchmarkState{latencies: groups[group]}
+		sort.Sort(byDuration(state.latencies))
+		table.Rows = append(table.Rows, reportRow{
+			Name:     group,
+			Requests: len(state.latencies),
+			P50:      state.getQuantile(0.5),
+			P90:      state.getQuantile(0.9),
+			P99:      state.getQuantile(0.99),
+		})
+	}
+	return table
+}
+
+func countMessages(counts map[string]int) int {
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	return total
+}
+
+func reportCounts(counts map[string]int) []reportCount {
+	var result []reportCount
+	for _, k := range sorted.MapKeys(counts) {
+		result = append(result, reportCount{k, counts[k]})
+	}
+	return result
+}
+
+// latencyHistogram returns a histogram of the sorted latencies. Latencies
+// above the 99.9th percentile are counted in the last bucket, so a few slow
+// requests don't hide the shape of the distribution.
+func latencyHistogram(s *benchmarkState) reportChart {
+	chart := reportChart{Width: reportChartWidth, Height: reportChartHeight}
+	if len(s.latencies) == 0 {
+		return chart
+	}
+
+	lo := s.latencies[0]
+	hi := s.getQuantile(0.999)
+	bucketWidth := (hi - lo) / reportHistogramBuckets
+	if bucketWidth <= 0 {
+		bucketWidth = 1
+	}
+
+	counts := make([]int, reportHistogramBuckets)
+	maxCount := 0
+	for _, l := range s.latencies {
+		i := int((l - lo) / bucketWidth)
+		if i >= len(counts) {
+			i = len(counts) - 1
+		}
+		counts[i]++
+		if counts[i] > maxCount {
+			maxCount = counts[i]
+		}
+	}
+
+	barWidth := float64(chart.Width) / reportHistogramBuckets
+	for i, count := range counts {
+		from := lo + time.Duration(i)*bucketWidth
+		title := fmt.Sprintf("%v to %v: %v requests", from, from+bucketWidth, count)
+		if i == len(counts)-1 {
+			title = fmt.Sprintf("%v and above: %v requests", from, count)
+		}
+
+		height := float64(chart.Height) * float64(count) / float64(maxCount)
+		chart.Bars = append(chart.Bars, reportBar{
+			X:      float64(i) * barWidth,
+			Y:      float64(chart.Height) - height,
+			Width:  barWidth - 1,
+			Height: height,
+			Title:  title,
+		})
+	}
+
+	chart.XMin = lo.String()
+	chart.XMax = (lo + reportHistogramBuckets*bucketWidth).String()
+	chart.YMax = fmt.Sprintf("%v requests", maxCount)
+	return chart
+}
+
+// timeSeries returns a chart with a line for each target of the value of
+// the samples over time.
+func (r *benchmarkReport) timeSeries(value func(resultPoint) float64, label func(max float64) string) reportChart {
+	chart := reportChart{Width: reportChartWidth, Height: reportChartHeight, XMin: "0s"}
+
+	var targets []string
+	byTarget := make(map[string][]resultPoint)
+	maxX, maxY := 0.0, 0.0
+	for _, p := range r.samples {
+		if _, ok := byTarget[p.target]; !ok {
+			targets = append(targets, p.target)
+		}
+		byTarget[p.target] = append(byTarget[p.target], p)
+
+		if x := p.time.Sub(r.run).Seconds(); x > maxX {
+			maxX = x
+		}
+		if y := value(p); y > maxY {
+			maxY = y
+		}
+	}
+	if maxX == 0 {
+		maxX = 1
+	}
+	if maxY == 0 {
+		maxY = 1
+	}
+
+	for i, target := range targets {
+		points := make([]string, len(byTarget[target]))
+		for j, p := range byTarget[target] {
+			x := float64(chart.Width) * p.time.Sub(r.run).Seconds() / maxX
+			y := float64(chart.Height) * (1 - value(p)/maxY)
+			points[j] = fmt.Sprintf("%.1f,%.1f", x, y)
+		}
+		chart.Lines = append(chart.Lines, reportLine{
+			Name:   target,
+			Color:  reportColors[i%len(reportColors)],
+			Points: strings.Join(points, " "),
+		})
+	}
+
+	chart.XMax = fmt.Sprintf("%.0fs", maxX)
+	chart.YMax = label(maxY)
+	return chart
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em auto; max-width: 800px; color: #222; }
+h1 { font-size: 1.5em; }
+h2 { font-size: 1.2em; margin-top: 2em; border-bottom: 1px solid #ddd; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { padding: 0.3em 0.8em; text-align: left; border-bottom: 1px solid #eee; }
+td.num { text-align: right; font-variant-numeric: tabular-nums; }
+.summary { display: flex; flex-wrap: wrap; gap: 1em; }
+.summary div { background: #f5f5f5; padding: 0.6em 1em; border-radius: 4px; }
+.summary b { display: block; font-size: 1.4em; }
+svg { background: #fafafa; }
+svg text { font-size: 11px; fill: #666; }
+.legend span { margin-right: 1em; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>Started {{.Started}}</p>
+<div class="summary">
+{{range .Summary}}<div>{{.Name}}<b>{{.Value}}</b></div>
+{{end}}</div>
+
+<h2>Configuration</h2>
+<table>
+{{range .Params}}<tr><th>{{.Name}}</th><td>{{.Value}}</td></tr>
+{{end}}</table>
+
+<h2>Latency distribution</h2>
+{{template "chart" .Histogram}}
+<table>
+<tr><th>Quantile</th><th>Latency</th></tr>
+{{range .Quantiles}}<tr><td>{{.Name}}</td><td class="num">{{.Value}}</td></tr>
+{{end}}</table>
+
+<h2>Throughput</h2>
+{{template "chart" .RPS}}
+
+<h2>p99 latency</h2>
+{{template "chart" .P99}}
+{{if .Targets}}
+<h2>Targets</h2>
+<table>
+<tr><th>Target</th><th>Requests</th><th>Errors</th><th>RPS</th><th>p50</th><th>p90</th><th>p99</th></tr>
+{{range .Targets}}<tr><td>{{.Name}}</td><td class="num">{{.Requests}}</td><td class="num">{{.Errors}}</td><td class="num">{{.RPS}}</td><td class="num">{{.P50}}</td><td class="num">{{.P90}}</td><td class="num">{{.P99}}</td></tr>
+{{end}}</table>
+{{end}}{{range .Peers}}
+<h2>Latencies by {{.Name}}</h2>
+<table>
+<tr><th>{{.Name}}</th><th>Requests</th><th>p50</th><th>p90</th><th>p99</th></tr>
+{{range .Rows}}<tr><td>{{.Name}}</td><td class="num">{{.Requests}}</td><td class="num">{{.P50}}</td><td class="num">{{.P90}}</td><td class="num">{{.P99}}</td></tr>
+{{end}}</table>
+{{end}}{{if .Errors}}
+<h2>Errors</h2>
+<table>
+{{range .Errors}}<tr><td class="num">{{.Count}}</td><td>{{.Message}}</td></tr>
+{{end}}</table>
+{{end}}{{if .Throttled}}
+<h2>Throttled</h2>
+<table>
+{{range .Throttled}}<tr><td class="num">{{.Count}}</td><td>{{.Message}}</td></tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+{{define "chart"}}<svg width="{{.SVGWidth}}" height="{{.SVGHeight}}"><g transform="translate({{.Margin}},{{.Margin}})">
+<text x="0" y="-6">{{.YMax}}</text>
+<text x="0" y="{{.Height}}" dy="14">{{.XMin}}</text>
+<text x="{{.Width}}" y="{{.Height}}" dy="14" text-anchor="end">{{.XMax}}</text>
+{{range .Bars}}<rect x="{{.X}}" y="{{.Y}}" width="{{.Width}}" height="{{.Height}}" fill="#1f77b4"><title>{{.Title}}</title></rect>
+{{end}}{{range .Lines}}<polyline points="{{.Points}}" fill="none" stroke="{{.Color}}" stroke-width="1.5"><title>{{.Name}}</title></polyline>
+{{end}}</g></svg>
+{{if gt (len .Lines) 1}}<p class="legend">{{range .Lines}}<span style="color: {{.Color}}">&#9632; {{.Name}}</span>{{end}}</p>
+{{end}}{{end}}`))
@@ -0,0 +1,143 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yarpc/yab/statsd"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatencyHistogram(t *testing.T) {
+	s := &benchmarkState{}
+	for i := 1; i <= 1000; i++ {
+		s.latencies = append(s.latencies, time.Duration(i)*time.Millisecond)
+	}
+	// A slow request is counted in the last bucket.
+	s.latencies = append(s.latencies, time.Minute)
+
+	chart := latencyHistogram(s)
+	require.Len(t, chart.Bars, reportHistogramBuckets, "Unexpected number of bars")
+	assert.Equal(t, "1ms", chart.XMin, "Unexpected min")
+	assert.Equal(t, "26 requests", chart.YMax, "Unexpected max count")
+
+	total := 0
+	for _, b := range chart.Bars {
+		var count int
+		_, err := fmt.Sscanf(b.Title[strings.LastIndex(b.Title, ":")+1:], "%d requests", &count)
+		require.NoError(t, err, "Failed to parse bar title %q", b.Title)
+		total += count
+	}
+	assert.Equal(t, len(s.latencies), total, "Bars should include every request")
+	assert.Contains(t, chart.Bars[len(chart.Bars)-1].Title, "and above", "Last bucket includes slow requests")
+}
+
+func TestLatencyHistogramEmpty(t *testing.T) {
+	assert.Empty(t, latencyHistogram(&benchmarkState{}).Bars)
+
+	chart := latencyHistogram(&benchmarkState{latencies: []time.Duration{time.Millisecond, time.Millisecond}})
+	assert.Equal(t, float64(reportChartHeight), chart.Bars[0].Height, "Single latency should fill the first bucket")
+}
+
+func TestReportTimeSeries(t *testing.T) {
+	run := time.Now()
+	r := &benchmarkReport{}
+	for i := 1; i <= 2; i++ {
+		now := run.Add(time.Duration(i) * time.Second)
+		require.NoError(t, r.write(run, []resultPoint{
+			{time: now, kind: resultsSample, target: "a", rps: float64(100 * i)},
+			{time: now, kind: resultsSample, target: "b", rps: 50},
+		}))
+	}
+	require.NoError(t, r.write(run, []resultPoint{{time: run.Add(3 * time.Second), kind: resultsSummary, target: "a"}}))
+	assert.Len(t, r.samples, 4, "Summaries should not be included in samples")
+
+	chart := r.timeSeries(func(p resultPoint) float64 { return p.rps }, func(max float64) string {
+		return fmt.Sprintf("%.0f RPS", max)
+	})
+	assert.Equal(t, "200 RPS", chart.YMax)
+	assert.Equal(t, "2s", chart.XMax)
+	assert.Equal(t, []reportLine{
+		{Name: "a", Color: reportColors[0], Points: "360.0,100.0 720.0,0.0"},
+		{Name: "b", Color: reportColors[1], Points: "360.0,150.0 720.0,150.0"},
+	}, chart.Lines)
+}
+
+func TestBenchmarkReport(t *testing.T) {
+	s := newServer(t)
+	defer s.shutdown()
+	s.register(fooMethod, methods.errorIf(func() bool { return false }))
+
+	dir, err := ioutil.TempDir("", "yab-report")
+	require.NoError(t, err, "TempDir failed")
+	defer os.RemoveAll(dir)
+	reportFile := filepath.Join(dir, "report.html")
+
+	m := benchmarkMethodForTest(t, fooMethod)
+	buf, out := getOutput(t)
+	runBenchmark(out, Options{
+		ROpts: RequestOptions{MethodName: fooMethod},
+		BOpts: BenchmarkOptions{
+			MaxRequests: 100,
+			MaxDuration: time.Second,
+			Connections: 1,
+			Concurrency: 1,
+			Report:      reportFile,
+		},
+		TOpts: s.transportOpts(),
+	}, m)
+	assert.Contains(t, buf.String(), "Note: wrote the benchmark report to "+reportFile)
+
+	contents, err := ioutil.ReadFile(reportFile)
+	require.NoError(t, err, "Failed to read report")
+	report := string(contents)
+	for _, want := range []string{
+		"<title>yab benchmark of Simple::foo</title>",
+		"<th>Max requests</th><td>100</td>",
+		"<div>Requests<b>100</b></div>",
+		"<h2>Latency distribution</h2>",
+		"<rect ",
+		"<h2>Latencies by peer</h2>",
+		"<td>" + s.hostPort() + "</td><td class=\"num\">100</td>",
+	} {
+		assert.Contains(t, report, want, "Report is missing %q", want)
+	}
+	assert.NotContains(t, report, "<h2>Errors</h2>", "Report should not have errors")
+}
+
+func TestBenchmarkReportWriteFailure(t *testing.T) {
+	buf, out := getOutput(t)
+	r := &benchmarkReport{}
+	r.writeFile(filepath.Join("does", "not", "exist.html"), newLogger(Options{}, out), reportResults{
+		overall: newBenchmarkState(statsd.Noop),
+		total:   time.Second,
+	})
+	assert.Contains(t, buf.String(), "Warning: failed to write report: open does/not/exist.html")
+}
@@ -28,6 +28,8 @@ import (
 	"strings"
 
 	"github.com/yarpc/yab/encoding"
+	"github.com/yarpc/yab/thrift"
+	"github.com/yarpc/yab/transport"
 
 	"gopkg.in/yaml.v2"
 )
@@ -38,13 +40,27 @@ var (
 )
 
 // getRequestInput gets the byte body passed in by the user via flags or through a file.
-func getRequestInput(inline, file string) ([]byte, error) {
+// The file may also be a http(s) URL, but inline bodies are always sent as-is. If a
+// checksum is specified, the file or URL contents must match it.
+func getRequestInput(inline, file, checksum string) ([]byte, error) {
+	if file != "" && file != "-" {
+		var err error
+		if file, err = localFile(file, checksum); err != nil {
+			return nil, fmt.Errorf("failed to open request file: %v", err)
+		}
+	}
+
+	return readInput(inline, file)
+}
+
+// readInput reads the inline value, a local file, or stdin if either is "-".
+func readInput(inline, file string) ([]byte, error) {
 	if file == "-" || inline == "-" {
 		return ioutil.ReadAll(os.Stdin)
 	}
 
 	if file != "" {
-		bs, err := ioutil.ReadFile(file)
+		bs, err := readFile(file)
 		if err != nil {
 			return nil, fmt.Errorf("failed to open request file: %v", err)
 		}
@@ -60,7 +76,7 @@ func getRequestInput(inline, file string) ([]byte, error) {
 }
 
 func getHeaders(inline, file string) (map[string]string, error) {
-	contents, err := getRequestInput(inline, file)
+	contents, err := readInput(inline, file)
 	if err != nil {
 		return nil, err
 	}
@@ -74,7 +90,43 @@ func getHeaders(inline, file string) (map[string]string, error) {
 		return nil, fmt.Errorf("unmarshal headers failed: %v", err)
 	}
 
-	return headers, nil
+	return secrets.resolveHeaders(headers)
+}
+
+// getShardKey returns the value of the given field in the request body, which
+// may be a dot-separated path to a nested field (e.g. user.id).
+func getShardKey(body []byte, field string) (string, error) {
+	var value interface{}
+	if err := yaml.Unmarshal(body, &value); err != nil {
+		return "", fmt.Errorf("unmarshal request failed: %v", err)
+	}
+
+	for _, name := range strings.Split(field, ".") {
+		m, ok := value.(map[interface{}]interface{})
+		if !ok {
+			return "", fmt.Errorf("cannot get hash field %q from non-object request", field)
+		}
+
+		if value, ok = m[name]; !ok {
+			return "", fmt.Errorf("hash field %q not found in request", field)
+		}
+	}
+
+	return fmt.Sprint(value), nil
+}
+
+// withHeader returns a copy of req with header set to value, since requests
+// may be shared and must not be modified.
+func withHeader(req *transport.Request, header, value string) *transport.Request {
+	headers := make(map[string]string, len(req.Headers)+1)
+	for k, v := range req.Headers {
+		headers[k] = v
+	}
+	headers[header] = value
+
+	copied := *req
+	copied.Headers = headers
+	return &copied
 }
 
 // NewSerializer creates a Serializer for the specific encoding.
@@ -99,7 +151,23 @@ func NewSerializer(opts RequestOptions) (encoding.Serializer, error) {
 
 	switch e {
 	case encoding.Thrift:
-		return encoding.NewThrift(opts.ThriftFile, opts.MethodName)
+		thriftFile := opts.ThriftFile
+		if thriftFile != "" {
+			var err error
+			if thriftFile, err = localFile(thriftFile, opts.ThriftChecksum); err != nil {
+				return nil, fmt.Errorf("could not load Thrift file: %v", err)
+			}
+		}
+
+		return encoding.NewThrift(thriftFile, opts.MethodName, thrift.Options{
+			MaxDepth:         opts.MaxDepth,
+			MaxContainerSize: opts.MaxResponseItems,
+			DecodeTimeout:    opts.DecodeTimeout,
+			AnnotateTypedefs: opts.AnnotateTypedefs,
+			LooseFields:      opts.LooseFields,
+			FieldResolved:    opts.fieldResolved,
+			AnnotationUsed:   opts.annotationUsed,
+		})
 	case encoding.JSON:
 		return encoding.NewJSON(opts.MethodName), nil
 	case encoding.Raw:
@@ -0,0 +1,231 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/yarpc/yab/encoding"
+	"github.com/yarpc/yab/unmarshal"
+
+	"gopkg.in/yaml.v2"
+)
+
+var errPatchEncoding = errors.New("--patch and --set can only be used with the Thrift or JSON encodings")
+
+// requestCodec decodes a request body so its fields can be changed, and
+// encodes it again, for encodings with structured request bodies.
+type requestCodec struct {
+	unmarshal func([]byte) (map[string]interface{}, error)
+	marshal   func(interface{}) ([]byte, error)
+
+	// parseValue parses a value given on the command line.
+	parseValue func(string) (interface{}, error)
+}
+
+// newRequestCodec returns the codec for the serializer's encoding, and false
+// if the encoding's request bodies are not structured.
+func newRequestCodec(serializer encoding.Serializer) (requestCodec, bool) {
+	switch serializer.Encoding() {
+	case encoding.Thrift:
+		return requestCodec{
+			unmarshal: unmarshal.YAML,
+			marshal:   yaml.Marshal,
+			parseValue: func(s string) (interface{}, error) {
+				var v interface{}
+				err := yaml.Unmarshal([]byte(s), &v)
+				return v, err
+			},
+		}, true
+	case encoding.JSON:
+		return requestCodec{
+			unmarshal: unmarshal.JSON,
+			marshal:   json.Marshal,
+			// Values that aren't valid JSON are used as strings, so name=foo works.
+			parseValue: func(s string) (interface{}, error) {
+				decoder := json.NewDecoder(bytes.NewReader([]byte(s)))
+				decoder.UseNumber()
+
+				var v interface{}
+				if err := decoder.Decode(&v); err != nil || decoder.More() {
+					return s, nil
+				}
+				return v, nil
+			},
+		}, true
+	default:
+		return requestCodec{}, false
+	}
+}
+
+// patchRequest applies layers on top of the request input, in order: each
+// --patch, which is merged into the request as a JSON merge patch
+// (RFC 7386), and then each --set path=value. This lets large request
+// fixtures be tweaked per invocation without editing them.
+func patchRequest(serializer encoding.Serializer, reqInput []byte, patches, sets []string) ([]byte, error) {
+	codec, ok := newRequestCodec(serializer)
+	if !ok {
+		return nil, errPatchEncoding
+	}
+
+	req, err := codec.unmarshal(reqInput)
+	if err != nil {
+		return nil, fmt.Errorf("cannot patch the request: %v", err)
+	}
+	doc := make(map[string]interface{})
+	if req != nil {
+		doc = normalizeYAML(req).(map[string]interface{})
+	}
+
+	for _, p := range patches {
+		patch, err := loadPatch(p)
+		if err != nil {
+			return nil, err
+		}
+		doc = mergePatch(doc, patch)
+	}
+
+	for _, s := range sets {
+		parts := strings.SplitN(s, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid --set %q, expected path=value", s)
+		}
+
+		path := strings.Split(parts[0], ".")
+		var value interface{}
+		if len(path) == 1 && encoding.IsStringArg(serializer, path[0]) {
+			value = parts[1]
+		} else if value, err = codec.parseValue(parts[1]); err != nil {
+			return nil, fmt.Errorf("invalid --set %q: %v", s, err)
+		}
+
+		if err := setPath(doc, path, normalizeYAML(value)); err != nil {
+			return nil, fmt.Errorf("invalid --set %q: %v", s, err)
+		}
+	}
+	return codec.marshal(doc)
+}
+
+// loadPatch returns the patch, which is inline JSON or YAML, or @path to read
+// it from a file.
+func loadPatch(patch string) (interface{}, error) {
+	contents := []byte(patch)
+	if strings.HasPrefix(patch, "@") {
+		var err error
+		if contents, err = readFile(patch[1:]); err != nil {
+			return nil, fmt.Errorf("failed to open patch file: %v", err)
+		}
+	}
+
+	var v interface{}
+	if err := yaml.Unmarshal(contents, &v); err != nil {
+		return nil, fmt.Errorf("failed to parse patch %q: %v", patch, err)
+	}
+	if _, ok := v.(map[interface{}]interface{}); !ok {
+		return nil, fmt.Errorf("invalid patch %q, expected an object", patch)
+	}
+	return normalizeYAML(v), nil
+}
+
+// mergePatch merges the patch into target: objects are merged recursively,
+// null values remove fields, and other values replace the target.
+func mergePatch(target map[string]interface{}, patch interface{}) map[string]interface{} {
+	for k, v := range patch.(map[string]interface{}) {
+		if v == nil {
+			delete(target, k)
+			continue
+		}
+
+		if _, ok := v.(map[string]interface{}); ok {
+			t, ok := target[k].(map[string]interface{})
+			if !ok {
+				t = make(map[string]interface{})
+			}
+			target[k] = mergePatch(t, v)
+			continue
+		}
+		target[k] = v
+	}
+	return target
+}
+
+// setPath sets the value at the dotted path, creating objects as needed.
+// Segments of the path can index into existing lists.
+func setPath(doc map[string]interface{}, path []string, value interface{}) error {
+	var cur interface{} = doc
+	for i, name := range path {
+		last := i == len(path)-1
+		switch c := cur.(type) {
+		case map[string]interface{}:
+			if last {
+				c[name] = value
+				return nil
+			}
+			if c[name] == nil {
+				c[name] = make(map[string]interface{})
+			}
+			cur = c[name]
+		case []interface{}:
+			idx, err := strconv.Atoi(name)
+			if err != nil || idx < 0 || idx >= len(c) {
+				return fmt.Errorf("%v is not an index of the list %v", name, strings.Join(path[:i], "."))
+			}
+			if last {
+				c[idx] = value
+				return nil
+			}
+			cur = c[idx]
+		default:
+			return fmt.Errorf("%v is not an object or list", strings.Join(path[:i], "."))
+		}
+	}
+	return nil
+}
+
+// normalizeYAML converts the maps decoded from YAML to map[string]interface{},
+// so they can be merged with JSON values and marshalled as JSON.
+func normalizeYAML(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = normalizeYAML(val)
+		}
+		return m
+	case map[string]interface{}:
+		for k, val := range v {
+			v[k] = normalizeYAML(val)
+		}
+		return v
+	case []interface{}:
+		for i, val := range v {
+			v[i] = normalizeYAML(val)
+		}
+		return v
+	default:
+		return v
+	}
+}
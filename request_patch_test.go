@@ -0,0 +1,185 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/yarpc/yab/encoding"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergePatch(t *testing.T) {
+	target := map[string]interface{}{
+		"a": "b",
+		"c": map[string]interface{}{"d": "e", "f": "g"},
+		"l": []interface{}{1, 2},
+		"s": "scalar",
+	}
+	patch := map[string]interface{}{
+		"a": "z",
+		"c": map[string]interface{}{"f": nil, "h": "i"},
+		"l": []interface{}{3},
+		"s": map[string]interface{}{"t": "u"},
+		"n": nil,
+	}
+
+	want := map[string]interface{}{
+		"a": "z",
+		"c": map[string]interface{}{"d": "e", "h": "i"},
+		"l": []interface{}{3},
+		"s": map[string]interface{}{"t": "u"},
+	}
+	assert.Equal(t, want, mergePatch(target, patch), "Unexpected merged document")
+}
+
+func TestSetPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    map[string]interface{}
+		wantErr string
+	}{
+		{
+			path: "a",
+			want: map[string]interface{}{"a": 1, "l": []interface{}{map[string]interface{}{"b": 2}}, "s": "x"},
+		},
+		{
+			path: "new.nested",
+			want: map[string]interface{}{"l": []interface{}{map[string]interface{}{"b": 2}}, "s": "x", "new": map[string]interface{}{"nested": 1}},
+		},
+		{
+			path: "l.0.b",
+			want: map[string]interface{}{"l": []interface{}{map[string]interface{}{"b": 1}}, "s": "x"},
+		},
+		{
+			path: "l.0",
+			want: map[string]interface{}{"l": []interface{}{1}, "s": "x"},
+		},
+		{
+			path:    "l.1",
+			wantErr: "1 is not an index of the list l",
+		},
+		{
+			path:    "l.x.b",
+			wantErr: "x is not an index of the list l",
+		},
+		{
+			path:    "s.t",
+			wantErr: "s is not an object or list",
+		},
+	}
+
+	for _, tt := range tests {
+		doc := map[string]interface{}{
+			"l": []interface{}{map[string]interface{}{"b": 2}},
+			"s": "x",
+		}
+		err := setPath(doc, strings.Split(tt.path, "."), 1)
+		if tt.wantErr != "" {
+			if assert.Error(t, err, "setPath(%v) should fail", tt.path) {
+				assert.Contains(t, err.Error(), tt.wantErr, "setPath(%v) unexpected error", tt.path)
+			}
+			continue
+		}
+
+		require.NoError(t, err, "setPath(%v) failed", tt.path)
+		assert.Equal(t, tt.want, doc, "setPath(%v) unexpected document", tt.path)
+	}
+}
+
+func TestPatchRequest(t *testing.T) {
+	defaults := writeFile(t, "defaults", "user:\n  name: default\n  tags: [a]\nlimit: 10\n")
+	defer os.Remove(defaults)
+
+	tests := []struct {
+		msg      string
+		reqInput string
+		patches  []string
+		sets     []string
+		want     string
+		wantErr  string
+	}{
+		{
+			msg:  "empty request",
+			sets: []string{"user.name=foo"},
+			want: `{"user": {"name": "foo"}}`,
+		},
+		{
+			msg:      "layers are applied in order",
+			reqInput: `{"user": {"id": 1, "name": "base"}, "debug": true}`,
+			patches:  []string{"@" + defaults, `{"debug": null, "limit": 20}`},
+			sets:     []string{"user.tags.0=b", "limit=30", `user.id="5"`},
+			want:     `{"user": {"id": "5", "name": "default", "tags": ["b"]}, "limit": 30}`,
+		},
+		{
+			msg:     "patch must be an object",
+			patches: []string{"[1]"},
+			wantErr: "expected an object",
+		},
+		{
+			msg:     "invalid patch",
+			patches: []string{"{"},
+			wantErr: "failed to parse patch",
+		},
+		{
+			msg:     "missing patch file",
+			patches: []string{"@/fake/file"},
+			wantErr: "failed to open patch file",
+		},
+		{
+			msg:     "invalid set",
+			sets:    []string{"user"},
+			wantErr: "expected path=value",
+		},
+		{
+			msg:      "set through a scalar",
+			reqInput: `{"user": "foo"}`,
+			sets:     []string{"user.name=foo"},
+			wantErr:  "user is not an object or list",
+		},
+		{
+			msg:      "invalid request",
+			reqInput: `{`,
+			sets:     []string{"a=b"},
+			wantErr:  "cannot patch the request",
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := patchRequest(encoding.NewJSON("method"), []byte(tt.reqInput), tt.patches, tt.sets)
+		if tt.wantErr != "" {
+			if assert.Error(t, err, "%v: expected error", tt.msg) {
+				assert.Contains(t, err.Error(), tt.wantErr, "%v: unexpected error", tt.msg)
+			}
+			continue
+		}
+
+		require.NoError(t, err, "%v: patchRequest failed", tt.msg)
+		assert.JSONEq(t, tt.want, string(got), "%v: unexpected request", tt.msg)
+	}
+
+	_, err := patchRequest(encoding.NewRaw("method"), nil, nil, []string{"a=b"})
+	assert.Equal(t, errPatchEncoding, err, "Expected raw encoding to fail")
+}
@@ -0,0 +1,327 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	cryptorand "crypto/rand"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/yarpc/yab/encoding"
+	"github.com/yarpc/yab/transport"
+)
+
+// requestTemplateData is the data that request templates are executed with.
+// Seq is the number of the request, starting at 0. Worker is the number of
+// the benchmark worker rendering the request, and WorkerSeq is the number of
+// the request rendered by that worker, so workers can use distinct values.
+type requestTemplateData struct {
+	Seq       int64
+	Worker    int64
+	WorkerSeq int64
+}
+
+// requestTemplate renders a request for each call when --template is used,
+// by executing the request body and header values as Go text/templates.
+type requestTemplate struct {
+	serializer encoding.Serializer
+	body       *template.Template
+	headers    map[string]*template.Template
+	hashField  string
+	timeout    time.Duration
+
+	// counters are shared by all workers, while worker is the state of the
+	// worker using this template.
+	counters *templateCounters
+	worker   *templateWorker
+}
+
+// templateCounters are the counters shared by all workers rendering a template.
+type templateCounters struct {
+	// seq is the Seq of the last rendered request.
+	seq int64
+
+	// sequences are the last values returned by the sequence function, by name.
+	sequencesMu sync.Mutex
+	sequences   map[string]int64
+}
+
+// templateWorker is the template state of a single worker, which is only
+// used by that worker, so it is not synchronized.
+type templateWorker struct {
+	id   int64
+	seq  int64
+	vars map[string]interface{}
+}
+
+func newTemplateWorker(id int) *templateWorker {
+	return &templateWorker{
+		id:   int64(id),
+		seq:  -1,
+		vars: make(map[string]interface{}),
+	}
+}
+
+// funcs returns the template functions that use the worker's state.
+func (w *templateWorker) funcs() template.FuncMap {
+	return template.FuncMap{
+		"set": w.set,
+		"get": w.get,
+	}
+}
+
+// set sets a variable that is kept between requests rendered by the worker.
+// It returns an empty string, so it doesn't add to the rendered output.
+func (w *templateWorker) set(name string, value interface{}) string {
+	w.vars[name] = value
+	return ""
+}
+
+// get returns the value of a variable set by the worker, or nil if it's unset.
+func (w *templateWorker) get(name string) interface{} {
+	return w.vars[name]
+}
+
+// randStringChars are the characters that randstring uses.
+const randStringChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+var errRandIntRange = errors.New("randint max must not be less than min")
+
+// funcs returns the functions available to request templates. Random values
+// other than UUIDs use the global source, so they are reproducible using --seed.
+func (t *requestTemplate) funcs() template.FuncMap {
+	funcs := template.FuncMap{
+		"uuid":       templateUUID,
+		"now":        templateNow,
+		"randint":    templateRandInt,
+		"randstring": templateRandString,
+		"sequence":   t.counters.sequence,
+		"add":        templateAdd,
+		"mul":        templateMul,
+	}
+	for name, f := range t.worker.funcs() {
+		funcs[name] = f
+	}
+	return funcs
+}
+
+// sequence returns the next value of the named sequence, starting at 0.
+// Unlike .Seq, it is incremented every time it is called.
+func (c *templateCounters) sequence(name ...string) int64 {
+	key := ""
+	if len(name) > 0 {
+		key = name[0]
+	}
+
+	c.sequencesMu.Lock()
+	defer c.sequencesMu.Unlock()
+
+	v, ok := c.sequences[key]
+	if ok {
+		v++
+	}
+	c.sequences[key] = v
+	return v
+}
+
+func templateAdd(a, b int64) int64 { return a + b }
+func templateMul(a, b int64) int64 { return a * b }
+
+// templateUUID returns a random (version 4) UUID. UUIDs are identifiers that
+// must differ between runs, so they use crypto/rand rather than the source
+// seeded by --seed.
+func templateUUID() string {
+	var b [16]byte
+	if _, err := cryptorand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("failed to read random bytes for a UUID: %v", err))
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// templateNow returns the current time in the given format, which is one of
+// unix, unixms, unixnano, rfc3339 or a Go time layout. It defaults to RFC 3339
+// with nanoseconds.
+func templateNow(format ...string) string {
+	now := time.Now()
+	if len(format) == 0 {
+		return now.Format(time.RFC3339Nano)
+	}
+
+	switch format[0] {
+	case "unix":
+		return strconv.FormatInt(now.Unix(), 10)
+	case "unixms":
+		return strconv.FormatInt(now.UnixNano()/int64(time.Millisecond), 10)
+	case "unixnano":
+		return strconv.FormatInt(now.UnixNano(), 10)
+	case "rfc3339":
+		return now.Format(time.RFC3339)
+	default:
+		return now.Format(format[0])
+	}
+}
+
+// templateRandInt returns a random integer between min and max, inclusive.
+func templateRandInt(min, max int64) (int64, error) {
+	if max < min {
+		return 0, errRandIntRange
+	}
+	return min + rand.Int63n(max-min+1), nil
+}
+
+// templateRandString returns a random alphanumeric string of length n.
+func templateRandString(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = randStringChars[rand.Intn(len(randStringChars))]
+	}
+	return string(b)
+}
+
+func newRequestTemplate(serializer encoding.Serializer, body []byte, headers map[string]string, hashField string, timeout time.Duration) (*requestTemplate, error) {
+	t := &requestTemplate{
+		serializer: serializer,
+		headers:    make(map[string]*template.Template, len(headers)),
+		hashField:  hashField,
+		timeout:    timeout,
+		counters: &templateCounters{
+			seq:       -1,
+			sequences: make(map[string]int64),
+		},
+		worker: newTemplateWorker(0),
+	}
+
+	// Fail on missing fields, rather than sending "<no value>".
+	var err error
+	t.body, err = template.New("request").Funcs(t.funcs()).Option("missingkey=error").Parse(string(body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid request template: %v", err)
+	}
+
+	for k, v := range headers {
+		t.headers[k], err = template.New(k).Funcs(t.funcs()).Option("missingkey=error").Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template for header %q: %v", k, err)
+		}
+	}
+
+	return t, nil
+}
+
+// forWorker returns a copy of the template for the benchmark worker with the
+// given number, which has its own worker state, but shares the counters.
+func (t *requestTemplate) forWorker(id int) *requestTemplate {
+	wt := *t
+	wt.worker = newTemplateWorker(id)
+	wt.body = cloneTemplate(t.body, wt.worker)
+	wt.headers = make(map[string]*template.Template, len(t.headers))
+	for k, tmpl := range t.headers {
+		wt.headers[k] = cloneTemplate(tmpl, wt.worker)
+	}
+	return &wt
+}
+
+// cloneTemplate copies a parsed template, replacing the functions that use
+// the worker's state.
+func cloneTemplate(tmpl *template.Template, w *templateWorker) *template.Template {
+	// Unlike html/template, text/template's Clone doesn't fail.
+	clone := template.Must(tmpl.Clone())
+	return clone.Funcs(w.funcs())
+}
+
+// next renders and serializes the next request.
+func (t *requestTemplate) next() (*transport.Request, error) {
+	t.worker.seq++
+	data := requestTemplateData{
+		Seq:       atomic.AddInt64(&t.counters.seq, 1),
+		Worker:    t.worker.id,
+		WorkerSeq: t.worker.seq,
+	}
+
+	buf := &bytes.Buffer{}
+	if err := t.body.Execute(buf, data); err != nil {
+		return nil, fmt.Errorf("failed to execute request template: %v", err)
+	}
+	body := buf.Bytes()
+
+	req, err := t.serializer.Request(body)
+	if err != nil {
+		return nil, err
+	}
+	if t.hashField != "" {
+		if req.ShardKey, err = getShardKey(body, t.hashField); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(t.headers) > 0 {
+		// Serializers may keep the body, so headers are rendered to a new buffer.
+		buf = &bytes.Buffer{}
+		req.Headers = make(map[string]string, len(t.headers))
+		for k, tmpl := range t.headers {
+			buf.Reset()
+			if err := tmpl.Execute(buf, data); err != nil {
+				return nil, fmt.Errorf("failed to execute template for header %q: %v", k, err)
+			}
+			req.Headers[k] = buf.String()
+		}
+	}
+
+	req.Timeout = t.timeout
+	return req, nil
+}
+
+// pool renders n requests, so benchmarks don't render requests while
+// sending them.
+func (t *requestTemplate) pool(n int) ([]*transport.Request, error) {
+	reqs := make([]*transport.Request, n)
+	for i := range reqs {
+		var err error
+		if reqs[i], err = t.next(); err != nil {
+			return nil, err
+		}
+	}
+	return reqs, nil
+}
+
+// cycleRequests returns a function that returns the requests in order,
+// starting at offset, and starting again after the last request. It is
+// not safe for concurrent use, so each worker cycles through the requests
+// separately.
+func cycleRequests(reqs []*transport.Request, offset int) func() (*transport.Request, error) {
+	i := offset % len(reqs)
+	return func() (*transport.Request, error) {
+		req := reqs[i]
+		if i++; i == len(reqs) {
+			i = 0
+		}
+		return req, nil
+	}
+}
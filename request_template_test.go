@@ -0,0 +1,394 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"math/rand"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yarpc/yab/encoding"
+	"github.com/yarpc/yab/transport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel-go/raw"
+	"golang.org/x/net/context"
+)
+
+func TestRequestTemplate(t *testing.T) {
+	tmpl, err := newRequestTemplate(
+		encoding.NewJSON("method"),
+		[]byte(`{"user": {"id": "user-{{.Seq}}"}}`),
+		map[string]string{"key": "k{{.Seq}}", "static": "v"},
+		"user.id",
+		time.Second,
+	)
+	require.NoError(t, err, "Failed to create request template")
+
+	for i := 0; i < 3; i++ {
+		req, err := tmpl.next()
+		require.NoError(t, err, "Failed to render request %v", i)
+
+		seq := string('0' + byte(i))
+		assert.JSONEq(t, `{"user": {"id": "user-`+seq+`"}}`, string(req.Body), "Unexpected body")
+		assert.Equal(t, map[string]string{"key": "k" + seq, "static": "v"}, req.Headers, "Unexpected headers")
+		assert.Equal(t, "user-"+seq, req.ShardKey, "Unexpected shard key")
+		assert.Equal(t, time.Second, req.Timeout, "Unexpected timeout")
+	}
+}
+
+func TestRequestTemplateHeadersKeepBody(t *testing.T) {
+	// The raw serializer uses the rendered body as is, so rendering headers
+	// must not reuse the body's buffer.
+	tmpl, err := newRequestTemplate(
+		encoding.NewRaw("method"),
+		[]byte(`body-{{.Seq}}`),
+		map[string]string{"key": "a-much-longer-header-value-{{.Seq}}"},
+		"",
+		time.Second,
+	)
+	require.NoError(t, err, "Failed to create request template")
+
+	var reqs []*transport.Request
+	for i := 0; i < 3; i++ {
+		req, err := tmpl.next()
+		require.NoError(t, err, "Failed to render request %v", i)
+		reqs = append(reqs, req)
+	}
+
+	for i, req := range reqs {
+		seq := string('0' + byte(i))
+		assert.Equal(t, "body-"+seq, string(req.Body), "Rendering headers should not change the body")
+		assert.Equal(t, "a-much-longer-header-value-"+seq, req.Headers["key"], "Unexpected header")
+	}
+}
+
+func TestRequestTemplateErrors(t *testing.T) {
+	tests := []struct {
+		msg       string
+		body      string
+		headers   map[string]string
+		hashField string
+		wantErr   string
+		renderErr string
+	}{
+		{
+			msg:     "invalid body template",
+			body:    `{"id": "{{.Seq"}`,
+			wantErr: "invalid request template",
+		},
+		{
+			msg:     "invalid header template",
+			headers: map[string]string{"key": "{{"},
+			wantErr: `invalid template for header "key"`,
+		},
+		{
+			msg:       "missing field",
+			body:      `{"id": "{{.Missing}}"}`,
+			renderErr: "failed to execute request template",
+		},
+		{
+			msg:       "missing field in header",
+			headers:   map[string]string{"key": "{{.Missing}}"},
+			renderErr: `failed to execute template for header "key"`,
+		},
+		{
+			msg:       "invalid rendered body",
+			body:      `{"id": {{.Seq}}`,
+			renderErr: "failed to parse JSON",
+		},
+		{
+			msg:       "missing hash field",
+			body:      `{"id": {{.Seq}}}`,
+			hashField: "user",
+			renderErr: `hash field "user" not found in request`,
+		},
+	}
+
+	for _, tt := range tests {
+		tmpl, err := newRequestTemplate(encoding.NewJSON("method"), []byte(tt.body), tt.headers, tt.hashField, time.Second)
+		if tt.wantErr != "" {
+			if assert.Error(t, err, "%v: expected error", tt.msg) {
+				assert.Contains(t, err.Error(), tt.wantErr, "%v: unexpected error", tt.msg)
+			}
+			continue
+		}
+		require.NoError(t, err, "%v: failed to create template", tt.msg)
+
+		_, err = tmpl.next()
+		if assert.Error(t, err, "%v: expected render error", tt.msg) {
+			assert.Contains(t, err.Error(), tt.renderErr, "%v: unexpected render error", tt.msg)
+		}
+	}
+}
+
+func TestRequestTemplateFuncs(t *testing.T) {
+	tests := []struct {
+		msg     string
+		body    string
+		want    *regexp.Regexp
+		wantErr string
+	}{
+		{
+			msg:  "uuid",
+			body: `"{{uuid}}"`,
+			want: regexp.MustCompile(`^"[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}"$`),
+		},
+		{
+			msg:  "now",
+			body: `"{{now}}"`,
+			want: regexp.MustCompile(`^"\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d(\.\d+)?(Z|[+-]\d\d:\d\d)"$`),
+		},
+		{
+			msg:  "now unix formats",
+			body: `[{{now "unix"}}, {{now "unixms"}}, {{now "unixnano"}}]`,
+			want: regexp.MustCompile(`^\[\d{10}, \d{13}, \d{19}\]$`),
+		},
+		{
+			msg:  "now layout",
+			body: `"{{now "2006-01-02"}}"`,
+			want: regexp.MustCompile(`^"\d{4}-\d\d-\d\d"$`),
+		},
+		{
+			msg:  "randint",
+			body: `{{randint 5 5}}`,
+			want: regexp.MustCompile(`^5$`),
+		},
+		{
+			msg:  "randstring",
+			body: `"{{randstring 12}}"`,
+			want: regexp.MustCompile(`^"[a-zA-Z0-9]{12}"$`),
+		},
+		{
+			msg:  "sequence",
+			body: `[{{sequence}}, {{sequence}}, {{sequence "a"}}, {{sequence}}]`,
+			want: regexp.MustCompile(`^\[0, 1, 0, 2\]$`),
+		},
+		{
+			msg:     "randint range",
+			body:    `{{randint 5 4}}`,
+			wantErr: errRandIntRange.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		tmpl, err := newRequestTemplate(encoding.NewRaw("method"), []byte(tt.body), nil, "", time.Second)
+		require.NoError(t, err, "%v: failed to create template", tt.msg)
+
+		req, err := tmpl.next()
+		if tt.wantErr != "" {
+			if assert.Error(t, err, "%v: expected error", tt.msg) {
+				assert.Contains(t, err.Error(), tt.wantErr, "%v: unexpected error", tt.msg)
+			}
+			continue
+		}
+
+		require.NoError(t, err, "%v: failed to render", tt.msg)
+		assert.Regexp(t, tt.want, string(req.Body), "%v: unexpected body", tt.msg)
+	}
+}
+
+func TestRequestTemplateFuncsSeed(t *testing.T) {
+	render := func(seed int64) []string {
+		rand.Seed(seed)
+		tmpl, err := newRequestTemplate(
+			encoding.NewJSON("method"),
+			[]byte(`{"n": {{randint 0 1000000}}, "s": "{{randstring 8}}"}`),
+			nil, "", time.Second,
+		)
+		require.NoError(t, err, "Failed to create template")
+
+		var bodies []string
+		for i := 0; i < 3; i++ {
+			req, err := tmpl.next()
+			require.NoError(t, err, "Failed to render request %v", i)
+			bodies = append(bodies, string(req.Body))
+		}
+		return bodies
+	}
+
+	first := render(1)
+	assert.Equal(t, first, render(1), "The same seed should render the same requests")
+	assert.NotEqual(t, first, render(2), "Different seeds should render different requests")
+	for i := 1; i < len(first); i++ {
+		assert.NotEqual(t, first[0], first[i], "Request %v should differ from the first", i)
+	}
+}
+
+func TestRequestTemplateUUIDIgnoresSeed(t *testing.T) {
+	rand.Seed(1)
+	first := templateUUID()
+	rand.Seed(1)
+	assert.NotEqual(t, first, templateUUID(), "UUIDs should differ between runs with the same seed")
+}
+
+func TestRequestTemplateForWorker(t *testing.T) {
+	tmpl, err := newRequestTemplate(
+		encoding.NewRaw("method"),
+		[]byte(`{{.Worker}} {{.WorkerSeq}} {{.Seq}} {{add (mul .Worker 1000) .WorkerSeq}} {{if not (get "first")}}{{set "first" (printf "s%v" .Seq)}}{{end}}{{get "first"}}`),
+		map[string]string{"key": "{{.Worker}}-{{.WorkerSeq}}"},
+		"",
+		time.Second,
+	)
+	require.NoError(t, err, "Failed to create request template")
+
+	workers := []*requestTemplate{tmpl.forWorker(1), tmpl.forWorker(2)}
+	render := func(tmpl *requestTemplate) (string, string) {
+		req, err := tmpl.next()
+		require.NoError(t, err, "Failed to render request")
+		return string(req.Body), req.Headers["key"]
+	}
+
+	tests := []struct {
+		worker     *requestTemplate
+		wantBody   string
+		wantHeader string
+	}{
+		{workers[0], "1 0 0 1000 s0", "1-0"},
+		{workers[1], "2 0 1 2000 s1", "2-0"},
+		{workers[0], "1 1 2 1001 s0", "1-1"},
+		{workers[1], "2 1 3 2001 s1", "2-1"},
+		{tmpl, "0 0 4 0 s4", "0-0"},
+	}
+
+	for i, tt := range tests {
+		body, header := render(tt.worker)
+		assert.Equal(t, tt.wantBody, body, "%v: unexpected body", i)
+		assert.Equal(t, tt.wantHeader, header, "%v: unexpected header", i)
+	}
+}
+
+func TestCycleRequests(t *testing.T) {
+	reqs := []*transport.Request{{Method: "0"}, {Method: "1"}, {Method: "2"}}
+
+	tests := []struct {
+		offset int
+		want   []string
+	}{
+		{0, []string{"0", "1", "2", "0"}},
+		{2, []string{"2", "0", "1", "2"}},
+		{4, []string{"1", "2", "0", "1"}},
+	}
+
+	for _, tt := range tests {
+		next := cycleRequests(reqs, tt.offset)
+
+		var got []string
+		for range tt.want {
+			req, err := next()
+			require.NoError(t, err, "next failed")
+			got = append(got, req.Method)
+		}
+		assert.Equal(t, tt.want, got, "Unexpected requests for offset %v", tt.offset)
+	}
+}
+
+func TestBenchmarkPayloadPool(t *testing.T) {
+	tests := []struct {
+		msg          string
+		pool         int
+		wantDistinct int
+	}{
+		{
+			msg:          "pool",
+			pool:         10,
+			wantDistinct: 10,
+		},
+		{
+			msg:          "render each request",
+			pool:         0,
+			wantDistinct: 100,
+		},
+	}
+
+	for _, tt := range tests {
+		var mu sync.Mutex
+		bodies := make(map[string]int)
+		s := newServer(t)
+		s.register("method", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+			mu.Lock()
+			bodies[string(args.Arg3)]++
+			mu.Unlock()
+			return &raw.Res{Arg2: args.Arg2, Arg3: []byte("{}")}, nil
+		})
+
+		serializer := encoding.NewJSON("method")
+		tmpl, err := newRequestTemplate(serializer, []byte(`{"id": {{.Seq}}}`), nil, "", time.Second)
+		require.NoError(t, err, "%v: failed to create template", tt.msg)
+		req, err := tmpl.next()
+		require.NoError(t, err, "%v: failed to render request", tt.msg)
+
+		buf, out := getOutput(t)
+		runBenchmark(out, Options{
+			BOpts: BenchmarkOptions{
+				MaxRequests: 100,
+				MaxDuration: time.Second,
+				Connections: 2,
+				Concurrency: 2,
+				PayloadPool: tt.pool,
+			},
+			TOpts: s.transportOpts(),
+		}, benchmarkMethod{serializer: serializer, req: req, template: tmpl})
+		s.shutdown()
+
+		if tt.pool > 0 {
+			assert.Contains(t, buf.String(), "Payload pool:    10", "%v: expected payload pool parameters", tt.msg)
+		}
+
+		// Warm up requests all use the first request.
+		mu.Lock()
+		assert.Equal(t, 10*2, bodies[`{"id":0}`], "%v: unexpected warm up requests", tt.msg)
+		delete(bodies, `{"id":0}`)
+		assert.Len(t, bodies, tt.wantDistinct, "%v: unexpected number of distinct requests", tt.msg)
+		mu.Unlock()
+	}
+}
+
+func TestTemplateIntegration(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	s := newServer(t)
+	defer s.shutdown()
+	s.register("method", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		mu.Lock()
+		got = append(got, string(args.Arg3))
+		mu.Unlock()
+		return &raw.Res{Arg2: args.Arg2, Arg3: []byte("{}")}, nil
+	})
+
+	opts := Options{
+		ROpts: RequestOptions{
+			Encoding:    encoding.JSON,
+			MethodName:  "method",
+			RequestJSON: `{"id": "{{.Seq}}"}`,
+			Template:    true,
+		},
+		TOpts: s.transportOpts(),
+	}
+
+	buf, out := getOutput(t)
+	runWithOptions(opts, out)
+	assert.Contains(t, buf.String(), `"body": {}`, "Expected response")
+	assert.Equal(t, []string{`{"id":"0"}`}, got, "Unexpected request")
+}
@@ -28,6 +28,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/yarpc/yab/encoding"
+	"github.com/yarpc/yab/transport"
 )
 
 func mustRead(fname string) []byte {
@@ -44,12 +45,15 @@ func TestGetRequestInput(t *testing.T) {
 		os.Stdin = origStdin
 	}()
 
+	const validChecksum = "sha256:d83322d0a86a294d8a02e11efb3bd81f1eae51e17ed148bc49e1a974d0af716e"
+
 	tests := []struct {
-		inline string
-		file   string
-		stdin  string
-		errMsg string
-		want   []byte
+		inline   string
+		file     string
+		checksum string
+		stdin    string
+		errMsg   string
+		want     []byte
 	}{
 		{
 			want: nil,
@@ -71,6 +75,25 @@ func TestGetRequestInput(t *testing.T) {
 			file: "testdata/invalid.json",
 			want: mustRead("testdata/invalid.json"),
 		},
+		{
+			file: "testdata/valid.json.gz",
+			want: mustRead("testdata/valid.json"),
+		},
+		{
+			file:     "testdata/valid.json",
+			checksum: validChecksum,
+			want:     mustRead("testdata/valid.json"),
+		},
+		{
+			file:     "testdata/invalid.json",
+			checksum: validChecksum,
+			errMsg:   "checksum mismatch",
+		},
+		{
+			file:     "testdata/valid.json",
+			checksum: "sha256:abc",
+			errMsg:   errInvalidChecksum.Error(),
+		},
 		{
 			inline: "-",
 			stdin:  "{}",
@@ -97,7 +120,7 @@ func TestGetRequestInput(t *testing.T) {
 			os.Stdin = f
 		}
 
-		got, err := getRequestInput(tt.inline, tt.file)
+		got, err := getRequestInput(tt.inline, tt.file, tt.checksum)
 		if tt.errMsg != "" {
 			if assert.Error(t, err, "getRequestInput(%v, %v) should fail", tt.inline, tt.file) {
 				assert.Contains(t, err.Error(), tt.errMsg, "getRequestInput(%v, %v) got unexpected error", tt.inline, tt.file)
@@ -155,6 +178,15 @@ func TestGetHeaders(t *testing.T) {
 	}
 }
 
+func TestWithHeader(t *testing.T) {
+	req := &transport.Request{Method: "foo", Headers: map[string]string{"a": "b"}}
+	got := withHeader(req, "Idempotency-Key", "key")
+
+	assert.Equal(t, map[string]string{"a": "b", "Idempotency-Key": "key"}, got.Headers, "Unexpected headers")
+	assert.Equal(t, "foo", got.Method, "Method should be copied")
+	assert.Equal(t, map[string]string{"a": "b"}, req.Headers, "Original request should not be modified")
+}
+
 func TestNewSerializer(t *testing.T) {
 	tests := []struct {
 		encoding encoding.Encoding
@@ -242,3 +274,57 @@ func TestNewSerializer(t *testing.T) {
 		}
 	}
 }
+
+func TestGetShardKey(t *testing.T) {
+	tests := []struct {
+		body   string
+		field  string
+		want   string
+		errMsg string
+	}{
+		{
+			body:  `{"user_id": 123}`,
+			field: "user_id",
+			want:  "123",
+		},
+		{
+			body:  `{"user": {"id": "abc"}}`,
+			field: "user.id",
+			want:  "abc",
+		},
+		{
+			body:  "user:\n  id: abc",
+			field: "user.id",
+			want:  "abc",
+		},
+		{
+			body:   `{"user_id": 123}`,
+			field:  "id",
+			errMsg: "not found",
+		},
+		{
+			body:   `{"user_id": 123}`,
+			field:  "user_id.id",
+			errMsg: "non-object",
+		},
+		{
+			body:   `{`,
+			field:  "id",
+			errMsg: "unmarshal request failed",
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := getShardKey([]byte(tt.body), tt.field)
+		if tt.errMsg != "" {
+			if assert.Error(t, err, "getShardKey(%v, %v) should fail", tt.body, tt.field) {
+				assert.Contains(t, err.Error(), tt.errMsg, "Unexpected error for getShardKey(%v, %v)", tt.body, tt.field)
+			}
+			continue
+		}
+
+		if assert.NoError(t, err, "getShardKey(%v, %v) should not fail", tt.body, tt.field) {
+			assert.Equal(t, tt.want, got, "getShardKey(%v, %v) mismatch", tt.body, tt.field)
+		}
+	}
+}
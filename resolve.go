@@ -0,0 +1,182 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ipVersion controls the address family used to connect to peers.
+type ipVersion string
+
+// The list of supported IP versions.
+const (
+	ipVersionAuto ipVersion = "auto"
+	ipVersion4    ipVersion = "4"
+	ipVersion6    ipVersion = "6"
+)
+
+// lookupIP is used to resolve hostnames, and can be overridden in tests.
+var lookupIP = net.LookupIP
+
+// UnmarshalFlag allows ipVersion to be used as a flag.
+func (v *ipVersion) UnmarshalFlag(value string) error {
+	switch iv := ipVersion(value); iv {
+	case ipVersionAuto, ipVersion4, ipVersion6:
+		*v = iv
+		return nil
+	default:
+		return fmt.Errorf("unknown IP version %q, must be one of: 4, 6, auto", value)
+	}
+}
+
+// network returns the network to dial for the given network, restricted
+// to the address family of the IP version.
+func (v ipVersion) network(network string) string {
+	if network != "tcp" {
+		return network
+	}
+
+	switch v {
+	case ipVersion4:
+		return "tcp4"
+	case ipVersion6:
+		return "tcp6"
+	default:
+		return network
+	}
+}
+
+// matches returns whether the IP belongs to the IP version's address family.
+func (v ipVersion) matches(ip net.IP) bool {
+	switch v {
+	case ipVersion4:
+		return ip.To4() != nil
+	case ipVersion6:
+		return ip.To4() == nil
+	default:
+		return true
+	}
+}
+
+// normalizeHostPorts returns the host:ports that a transport should connect to.
+// For TChannel, --resolve overrides are applied and hosts are resolved to an
+// address of the given IP version, since TChannel does not allow customizing
+// how it dials peers.
+func normalizeHostPorts(protocol string, hostPorts []string, opts TransportOptions) ([]string, error) {
+	if protocol != "tchannel" {
+		return hostPorts, nil
+	}
+
+	overrides := newResolveOverrides(opts.Resolve)
+	normalized := make([]string, len(hostPorts))
+	for i, hp := range hostPorts {
+		normalized[i] = overrides.apply(hp)
+	}
+
+	// remapLocalHost uses an IPv4 address, so it should not be used with IPv6.
+	version := opts.IPVersion
+	if version != ipVersion6 {
+		remapLocalHost(normalized)
+	}
+
+	if version != ipVersion4 && version != ipVersion6 {
+		return normalized, nil
+	}
+
+	for i, hp := range normalized {
+		host, port, err := net.SplitHostPort(hp)
+		if err != nil {
+			return nil, err
+		}
+
+		ip, err := resolveHost(host, version)
+		if err != nil {
+			return nil, err
+		}
+		normalized[i] = net.JoinHostPort(ip.String(), port)
+	}
+
+	return normalized, nil
+}
+
+// resolveHost returns the first address for host that matches the IP version.
+func resolveHost(host string, version ipVersion) (net.IP, error) {
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		var err error
+		if ips, err = lookupIP(host); err != nil {
+			return nil, fmt.Errorf("failed to resolve %q: %v", host, err)
+		}
+	}
+
+	for _, ip := range ips {
+		if version.matches(ip) {
+			return ip, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no IPv%v address found for %q", version, host)
+}
+
+// resolveOverride overrides the address used for a host:port, similar to
+// curl's --resolve flag.
+type resolveOverride struct {
+	HostPort string
+	Addr     string
+}
+
+// UnmarshalFlag parses a resolve override in the format host:port:addr.
+func (r *resolveOverride) UnmarshalFlag(value string) error {
+	parts := strings.SplitN(value, ":", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return fmt.Errorf("invalid resolve %q, must be in the format host:port:addr", value)
+	}
+
+	// IPv6 addresses may be specified with or without brackets.
+	addr := strings.TrimSuffix(strings.TrimPrefix(parts[2], "["), "]")
+	*r = resolveOverride{
+		HostPort: net.JoinHostPort(parts[0], parts[1]),
+		Addr:     net.JoinHostPort(addr, parts[1]),
+	}
+	return nil
+}
+
+// resolveOverrides maps a host:port to the address that should be used instead.
+type resolveOverrides map[string]string
+
+func newResolveOverrides(overrides []resolveOverride) resolveOverrides {
+	m := make(resolveOverrides, len(overrides))
+	for _, o := range overrides {
+		m[o.HostPort] = o.Addr
+	}
+	return m
+}
+
+// apply returns the address to use for the given host:port.
+func (r resolveOverrides) apply(hostPort string) string {
+	if addr, ok := r[hostPort]; ok {
+		return addr
+	}
+	return hostPort
+}
@@ -0,0 +1,223 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func stubLookupIP(t *testing.T, hosts map[string][]string) func() {
+	old := lookupIP
+	lookupIP = func(host string) ([]net.IP, error) {
+		addrs, ok := hosts[host]
+		if !ok {
+			return nil, errors.New("no such host")
+		}
+
+		var ips []net.IP
+		for _, addr := range addrs {
+			ip := net.ParseIP(addr)
+			require.NotNil(t, ip, "invalid IP %v", addr)
+			ips = append(ips, ip)
+		}
+		return ips, nil
+	}
+	return func() { lookupIP = old }
+}
+
+func TestIPVersionUnmarshal(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    ipVersion
+		wantErr bool
+	}{
+		{value: "4", want: ipVersion4},
+		{value: "6", want: ipVersion6},
+		{value: "auto", want: ipVersionAuto},
+		{value: "5", wantErr: true},
+		{value: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		var v ipVersion
+		err := v.UnmarshalFlag(tt.value)
+		if tt.wantErr {
+			assert.Error(t, err, "UnmarshalFlag(%q) should fail", tt.value)
+			continue
+		}
+		if assert.NoError(t, err, "UnmarshalFlag(%q) failed", tt.value) {
+			assert.Equal(t, tt.want, v, "UnmarshalFlag(%q) mismatch", tt.value)
+		}
+	}
+}
+
+func TestIPVersionNetwork(t *testing.T) {
+	tests := []struct {
+		version ipVersion
+		network string
+		want    string
+	}{
+		{ipVersionAuto, "tcp", "tcp"},
+		{"", "tcp", "tcp"},
+		{ipVersion4, "tcp", "tcp4"},
+		{ipVersion6, "tcp", "tcp6"},
+		{ipVersion4, "udp", "udp"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.version.network(tt.network), "%q.network(%v)", tt.version, tt.network)
+	}
+}
+
+func TestNormalizeHostPorts(t *testing.T) {
+	defer stubLookupIP(t, map[string][]string{
+		"dual":   {"10.0.0.1", "fd00::1"},
+		"v4only": {"10.0.0.2"},
+		"v6only": {"fd00::2"},
+	})()
+
+	tests := []struct {
+		protocol  string
+		hostPorts []string
+		version   ipVersion
+		resolve   []resolveOverride
+		want      []string
+		wantErr   string
+	}{
+		{
+			protocol:  "http",
+			hostPorts: []string{"http://dual:80"},
+			version:   ipVersion6,
+			want:      []string{"http://dual:80"},
+		},
+		{
+			protocol:  "tchannel",
+			hostPorts: []string{"dual:1", "v6only:2"},
+			version:   ipVersionAuto,
+			want:      []string{"dual:1", "v6only:2"},
+		},
+		{
+			protocol:  "tchannel",
+			hostPorts: []string{"dual:1", "v4only:2", "1.1.1.1:3"},
+			version:   ipVersion4,
+			want:      []string{"10.0.0.1:1", "10.0.0.2:2", "1.1.1.1:3"},
+		},
+		{
+			protocol:  "tchannel",
+			hostPorts: []string{"dual:1", "v6only:2", "[::1]:3"},
+			version:   ipVersion6,
+			want:      []string{"[fd00::1]:1", "[fd00::2]:2", "[::1]:3"},
+		},
+		{
+			protocol:  "tchannel",
+			hostPorts: []string{"dual:1", "dual:2"},
+			resolve:   []resolveOverride{{HostPort: "dual:1", Addr: "1.1.1.1:1"}},
+			want:      []string{"1.1.1.1:1", "dual:2"},
+		},
+		{
+			protocol:  "tchannel",
+			hostPorts: []string{"dual:1", "dual:2"},
+			version:   ipVersion6,
+			resolve:   []resolveOverride{{HostPort: "dual:1", Addr: "[::1]:1"}},
+			want:      []string{"[::1]:1", "[fd00::1]:2"},
+		},
+		{
+			protocol:  "tchannel",
+			hostPorts: []string{"v4only:1"},
+			version:   ipVersion6,
+			wantErr:   `no IPv6 address found for "v4only"`,
+		},
+		{
+			protocol:  "tchannel",
+			hostPorts: []string{"[::1]:1"},
+			version:   ipVersion4,
+			wantErr:   `no IPv4 address found for "::1"`,
+		},
+		{
+			protocol:  "tchannel",
+			hostPorts: []string{"unknown:1"},
+			version:   ipVersion4,
+			wantErr:   `failed to resolve "unknown"`,
+		},
+		{
+			protocol:  "tchannel",
+			hostPorts: []string{"dual"},
+			version:   ipVersion4,
+			wantErr:   "missing port",
+		},
+	}
+
+	for _, tt := range tests {
+		opts := TransportOptions{IPVersion: tt.version, Resolve: tt.resolve}
+		got, err := normalizeHostPorts(tt.protocol, tt.hostPorts, opts)
+		if tt.wantErr != "" {
+			if assert.Error(t, err, "normalizeHostPorts(%v) should fail", tt.hostPorts) {
+				assert.Contains(t, err.Error(), tt.wantErr, "unexpected error for %v", tt.hostPorts)
+			}
+			continue
+		}
+
+		if assert.NoError(t, err, "normalizeHostPorts(%v) failed", tt.hostPorts) {
+			assert.Equal(t, tt.want, got, "normalizeHostPorts(%v) mismatch", tt.hostPorts)
+		}
+	}
+}
+
+func TestResolveOverrideUnmarshal(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    resolveOverride
+		wantErr bool
+	}{
+		{
+			value: "example.com:80:1.1.1.1",
+			want:  resolveOverride{HostPort: "example.com:80", Addr: "1.1.1.1:80"},
+		},
+		{
+			value: "example.com:443:[::1]",
+			want:  resolveOverride{HostPort: "example.com:443", Addr: "[::1]:443"},
+		},
+		{
+			value: "example.com:443:::1",
+			want:  resolveOverride{HostPort: "example.com:443", Addr: "[::1]:443"},
+		},
+		{value: "example.com:80", wantErr: true},
+		{value: "example.com::1.1.1.1", wantErr: true},
+		{value: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		var got resolveOverride
+		err := got.UnmarshalFlag(tt.value)
+		if tt.wantErr {
+			assert.Error(t, err, "UnmarshalFlag(%q) should fail", tt.value)
+			continue
+		}
+		if assert.NoError(t, err, "UnmarshalFlag(%q) failed", tt.value) {
+			assert.Equal(t, tt.want, got, "UnmarshalFlag(%q) mismatch", tt.value)
+		}
+	}
+}
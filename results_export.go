@@ -0,0 +1,295 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yarpc/yab/statsd"
+)
+
+// resultsSampleInterval is how often samples are written while a
+// benchmark is running.
+const resultsSampleInterval = time.Second
+
+// The kinds of results points.
+const (
+	resultsSample  = "sample"
+	resultsSummary = "summary"
+)
+
+// resultPoint is a sample of the benchmark results for a target, or the
+// summary of the whole benchmark.
+type resultPoint struct {
+	time      time.Time
+	kind      string
+	target    string
+	requests  int
+	errors    int
+	throttled int
+	rps       float64
+	p50       time.Duration
+	p90       time.Duration
+	p99       time.Duration
+	max       time.Duration
+}
+
+// resultsWriter writes results points to a database.
+type resultsWriter interface {
+	write(run time.Time, points []resultPoint) error
+	Close() error
+}
+
+// newResultPoint returns a point for the latencies, which are sorted.
+func newResultPoint(t time.Time, kind, target string, latencies []time.Duration, errors, throttled int, elapsed time.Duration) resultPoint {
+	sort.Sort(byDuration(latencies))
+	s := &benchmarkState{latencies: latencies}
+	return resultPoint{
+		time:      t,
+		kind:      kind,
+		target:    target,
+		requests:  len(latencies),
+		errors:    errors,
+		throttled: throttled,
+		rps:       float64(len(latencies)) / elapsed.Seconds(),
+		p50:       s.getQuantile(0.5),
+		p90:       s.getQuantile(0.9),
+		p99:       s.getQuantile(0.99),
+		max:       s.getQuantile(1),
+	}
+}
+
+// resultsShard records the results of the workers in a shard since the
+// last sample. It wraps the shard's statsd client, which the benchmark
+// state reports every call to.
+type resultsShard struct {
+	statsd.Client
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	errors    int
+	throttled int
+}
+
+func (s *resultsShard) Inc(stat string) {
+	s.Client.Inc(stat)
+
+	s.mu.Lock()
+	switch stat {
+	case "error":
+		s.errors++
+	case "throttled":
+		s.throttled++
+	}
+	s.mu.Unlock()
+}
+
+func (s *resultsShard) Timing(stat string, d time.Duration) {
+	s.Client.Timing(stat, d)
+
+	// Other timings, such as the server's time, are not request latencies.
+	if stat != "latency" {
+		return
+	}
+
+	s.mu.Lock()
+	s.latencies = append(s.latencies, d)
+	s.mu.Unlock()
+}
+
+// drain returns the results since the last call to drain.
+func (s *resultsShard) drain() (latencies []time.Duration, errors, throttled int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	latencies, errors, throttled = s.latencies, s.errors, s.throttled
+	s.latencies, s.errors, s.throttled = nil, 0, 0
+	return latencies, errors, throttled
+}
+
+// resultsExporter writes per-second samples of each target's results while
+// a benchmark runs, and a summary of the results once it ends, so long
+// running test programs can keep a history of results.
+type resultsExporter struct {
+	writers []resultsWriter
+	logger  *logger
+	run     time.Time
+
+	targets []string
+	shards  map[string][]*resultsShard
+
+	stop chan struct{}
+	done chan struct{}
+
+	// failed is set once a write fails, so the failure is only logged once.
+	failed bool
+}
+
+// newResultsExporter returns a resultsExporter for the databases in opts,
+// the report and the SLO monitor, or nil if results are not exported.
+func newResultsExporter(opts BenchmarkOptions, logger *logger, report *benchmarkReport, slos *sloMonitor) (*resultsExporter, error) {
+	var writers []resultsWriter
+	if report != nil {
+		writers = append(writers, report)
+	}
+	if slos != nil {
+		writers = append(writers, slos)
+	}
+	if opts.ResultsInflux != "" {
+		w, err := newInfluxWriter(opts.ResultsInflux)
+		if err != nil {
+			return nil, err
+		}
+		writers = append(writers, w)
+	}
+	if opts.ResultsPostgres != "" {
+		w, err := newPostgresWriter(opts.ResultsPostgres)
+		if err != nil {
+			return nil, err
+		}
+		writers = append(writers, w)
+	}
+	if opts.StreamResults != "" {
+		w, err := newWebSocketWriter(opts.StreamResults)
+		if err != nil {
+			return nil, err
+		}
+		writers = append(writers, w)
+	}
+	if len(writers) == 0 {
+		return nil, nil
+	}
+
+	return &resultsExporter{
+		writers: writers,
+		logger:  logger,
+		shards:  make(map[string][]*resultsShard),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// statter returns a statsd client for a shard of the target, which records
+// results for the exporter and reports them to next.
+func (e *resultsExporter) statter(target string, next statsd.Client) statsd.Client {
+	if e == nil {
+		return next
+	}
+
+	if _, ok := e.shards[target]; !ok {
+		e.targets = append(e.targets, target)
+	}
+	shard := &resultsShard{Client: next}
+	e.shards[target] = append(e.shards[target], shard)
+	return shard
+}
+
+// start starts writing samples every resultsSampleInterval.
+func (e *resultsExporter) start() {
+	if e == nil {
+		return
+	}
+
+	e.run = time.Now()
+	go func() {
+		defer close(e.done)
+
+		ticker := time.NewTicker(resultsSampleInterval)
+		defer ticker.Stop()
+
+		last := e.run
+		for {
+			select {
+			case now := <-ticker.C:
+				e.writeSamples(now, now.Sub(last))
+				last = now
+			case <-e.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (e *resultsExporter) writeSamples(now time.Time, elapsed time.Duration) {
+	points := make([]resultPoint, len(e.targets))
+	for i, target := range e.targets {
+		var latencies []time.Duration
+		var errors, throttled int
+		for _, shard := range e.shards[target] {
+			l, errs, thr := shard.drain()
+			latencies = append(latencies, l...)
+			errors += errs
+			throttled += thr
+		}
+		points[i] = newResultPoint(now, resultsSample, target, latencies, errors, throttled, elapsed)
+	}
+	e.write(points)
+}
+
+func (e *resultsExporter) write(points []resultPoint) {
+	for _, w := range e.writers {
+		if err := w.write(e.run, points); err != nil && !e.failed {
+			e.failed = true
+			e.logger.Warnf("failed to export benchmark results: %v", err)
+		}
+	}
+}
+
+// finish stops writing samples, and writes a summary of the results of each
+// target. If there are multiple targets, the overall results are written
+// with the target "all".
+func (e *resultsExporter) finish(targets []benchmarkTarget, states []*benchmarkState, overall *benchmarkState, total time.Duration) {
+	if e == nil {
+		return
+	}
+
+	close(e.stop)
+	<-e.done
+
+	now := time.Now()
+	var points []resultPoint
+	summary := func(target string, s *benchmarkState) {
+		errors := 0
+		for _, n := range s.errors {
+			errors += n
+		}
+		throttled := 0
+		for _, n := range s.throttled {
+			throttled += n
+		}
+		points = append(points, newResultPoint(now, resultsSummary, target, s.latencies, errors, throttled, total))
+	}
+	for i, target := range targets {
+		summary(target.name, states[i])
+	}
+	if len(targets) > 1 {
+		summary("all", overall)
+	}
+	e.write(points)
+
+	for _, w := range e.writers {
+		if err := w.Close(); err != nil {
+			e.logger.Warnf("failed to export benchmark results: %v", err)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yarpc/yab/statsd"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewResultPoint(t *testing.T) {
+	now := time.Now()
+	latencies := []time.Duration{4 * time.Millisecond, time.Millisecond, 3 * time.Millisecond, 2 * time.Millisecond, 5 * time.Millisecond}
+	p := newResultPoint(now, resultsSample, "target", latencies, 2, 1, 500*time.Millisecond)
+
+	assert.Equal(t, resultPoint{
+		time:      now,
+		kind:      resultsSample,
+		target:    "target",
+		requests:  5,
+		errors:    2,
+		throttled: 1,
+		rps:       10,
+		p50:       3 * time.Millisecond,
+		p90:       4600 * time.Microsecond,
+		p99:       4960 * time.Microsecond,
+		max:       5 * time.Millisecond,
+	}, p)
+}
+
+func TestResultsShard(t *testing.T) {
+	s := &resultsShard{Client: statsd.Noop}
+	s.Inc("success")
+	s.Timing("latency", time.Millisecond)
+	s.Timing("other", time.Second)
+	s.Inc("error")
+	s.Inc("throttled")
+	s.Inc("throttled")
+
+	latencies, errors, throttled := s.drain()
+	assert.Equal(t, []time.Duration{time.Millisecond}, latencies, "Only latency timings should be recorded")
+	assert.Equal(t, 1, errors, "Unexpected errors")
+	assert.Equal(t, 2, throttled, "Unexpected throttled")
+
+	latencies, errors, throttled = s.drain()
+	assert.Empty(t, latencies, "Expected results to be reset after drain")
+	assert.Equal(t, 0, errors+throttled, "Expected results to be reset after drain")
+}
+
+func TestInfluxLine(t *testing.T) {
+	run := time.Date(2016, 4, 1, 12, 0, 0, 0, time.UTC)
+	got := influxLine(run, resultPoint{
+		time:     run.Add(time.Second),
+		kind:     resultsSample,
+		target:   "Svc::method, weird=name",
+		requests: 10,
+		errors:   1,
+		rps:      9.5,
+		p50:      1500 * time.Microsecond,
+		p90:      2 * time.Millisecond,
+		p99:      3 * time.Millisecond,
+		max:      4 * time.Millisecond,
+	})
+	assert.Equal(t, `yab_benchmark,kind=sample,target=Svc::method\,\ weird\=name,run=2016-04-01T12:00:00Z `+
+		"requests=10i,errors=1i,throttled=0i,rps=9.5,p50_ms=1.5,p90_ms=2,p99_ms=3,max_ms=4 1459512001000000000\n", got)
+}
+
+// influxServer records the lines written to it.
+type influxServer struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	lines []string
+	auth  []string
+	fail  bool
+}
+
+func newInfluxServer() *influxServer {
+	s := &influxServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.fail {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"database not found: \"yab\""}`))
+			return
+		}
+		s.auth = append(s.auth, r.Header.Get("Authorization"))
+		s.lines = append(s.lines, strings.Split(strings.TrimSpace(string(body)), "\n")...)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	return s
+}
+
+func TestInfluxWriter(t *testing.T) {
+	s := newInfluxServer()
+	defer s.Close()
+
+	w, err := newInfluxWriter(s.URL + "/api/v2/write?org=o&bucket=b&token=secret")
+	require.NoError(t, err, "Failed to create InfluxDB writer")
+	assert.Equal(t, s.URL+"/api/v2/write?bucket=b&org=o", w.url, "Token should not be in the URL")
+
+	run := time.Now()
+	points := []resultPoint{{time: run, kind: resultsSummary, target: "t"}}
+	require.NoError(t, w.write(run, points), "Failed to write")
+	assert.NoError(t, w.Close(), "Failed to close")
+
+	s.mu.Lock()
+	assert.Equal(t, []string{strings.TrimSpace(influxLine(run, points[0]))}, s.lines, "Unexpected lines")
+	assert.Equal(t, []string{"Token secret"}, s.auth, "Unexpected authorization")
+	s.fail = true
+	s.mu.Unlock()
+
+	err = w.write(run, points)
+	assert.EqualError(t, err, `InfluxDB write failed with 404 Not Found: {"error":"database not found: \"yab\""}`)
+}
+
+func TestNewInfluxWriterErrors(t *testing.T) {
+	for _, url := range []string{"localhost:8086", "udp://localhost:8086", "http://", "http://[::1"} {
+		_, err := newInfluxWriter(url)
+		if assert.Error(t, err, "%v: expected error", url) {
+			assert.Contains(t, err.Error(), "invalid InfluxDB URL", "%v: unexpected error", url)
+		}
+	}
+}
+
+func TestBenchmarkResultsExport(t *testing.T) {
+	influx := newInfluxServer()
+	defer influx.Close()
+
+	s := newServer(t)
+	defer s.shutdown()
+	s.register(fooMethod, methods.echo())
+
+	m := benchmarkMethodForTest(t, fooMethod)
+	buf, out := getOutput(t)
+	runBenchmark(out, Options{
+		ROpts: RequestOptions{MethodName: fooMethod},
+		BOpts: BenchmarkOptions{
+			MaxRequests:   100000,
+			MaxDuration:   1500 * time.Millisecond,
+			Connections:   1,
+			Concurrency:   1,
+			RPS:           100,
+			ResultsInflux: influx.URL + "/write?db=yab",
+		},
+		TOpts: s.transportOpts(),
+	}, m)
+	assert.NotContains(t, buf.String(), "Warning", "Unexpected warnings")
+
+	influx.mu.Lock()
+	defer influx.mu.Unlock()
+	require.Len(t, influx.lines, 2, "Expected a sample and a summary")
+	assert.True(t, strings.HasPrefix(influx.lines[0], "yab_benchmark,kind=sample,target=Simple::foo,"), "Unexpected sample: %v", influx.lines[0])
+	assert.True(t, strings.HasPrefix(influx.lines[1], "yab_benchmark,kind=summary,target=Simple::foo,"), "Unexpected summary: %v", influx.lines[1])
+	assert.Contains(t, influx.lines[1], "i,errors=0i,throttled=0i,rps=", "Unexpected summary: %v", influx.lines[1])
+}
+
+func TestBenchmarkResultsExportFailure(t *testing.T) {
+	influx := newInfluxServer()
+	defer influx.Close()
+	influx.fail = true
+
+	s := newServer(t)
+	defer s.shutdown()
+	s.register(fooMethod, methods.echo())
+
+	m := benchmarkMethodForTest(t, fooMethod)
+	buf, out := getOutput(t)
+	runBenchmark(out, Options{
+		BOpts: BenchmarkOptions{
+			MaxRequests:   100,
+			MaxDuration:   time.Second,
+			Connections:   1,
+			Concurrency:   1,
+			ResultsInflux: influx.URL + "/write?db=yab",
+		},
+		TOpts: s.transportOpts(),
+	}, m)
+
+	assert.Equal(t, 1, bytes.Count(buf.Bytes(), []byte("Warning: failed to export benchmark results: InfluxDB write failed with 404")),
+		"Expected a single warning: %v", buf.String())
+}
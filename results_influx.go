@@ -0,0 +1,121 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// influxMeasurement is the measurement that results are written to.
+const influxMeasurement = "yab_benchmark"
+
+// influxTimeout is the timeout for each write to InfluxDB.
+const influxTimeout = 5 * time.Second
+
+// influxTagEscaper escapes tag values in the line protocol.
+var influxTagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// influxWriter writes results to an InfluxDB write endpoint, such as
+// http://localhost:8086/write?db=yab for InfluxDB 1.x, or
+// http://localhost:8086/api/v2/write?org=o&bucket=b for InfluxDB 2.x, in
+// the line protocol. A token can be specified using the token parameter.
+type influxWriter struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func newInfluxWriter(rawURL string) (*influxWriter, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid InfluxDB URL %q, expected a http(s) URL of the write endpoint", rawURL)
+	}
+
+	// The token is sent as a header, rather than a parameter.
+	q := u.Query()
+	token := q.Get("token")
+	q.Del("token")
+	u.RawQuery = q.Encode()
+
+	return &influxWriter{
+		url:    u.String(),
+		token:  token,
+		client: &http.Client{Timeout: influxTimeout},
+	}, nil
+}
+
+// influxLine returns the point in the line protocol. The run is a tag, so
+// the results of each run can be grouped.
+func influxLine(run time.Time, p resultPoint) string {
+	ms := func(d time.Duration) string {
+		return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', -1, 64)
+	}
+
+	return fmt.Sprintf("%v,kind=%v,target=%v,run=%v requests=%vi,errors=%vi,throttled=%vi,rps=%v,p50_ms=%v,p90_ms=%v,p99_ms=%v,max_ms=%v %v\n",
+		influxMeasurement,
+		influxTagEscaper.Replace(p.kind),
+		influxTagEscaper.Replace(p.target),
+		influxTagEscaper.Replace(run.UTC().Format(time.RFC3339)),
+		p.requests, p.errors, p.throttled,
+		strconv.FormatFloat(p.rps, 'f', -1, 64),
+		ms(p.p50), ms(p.p90), ms(p.p99), ms(p.max),
+		p.time.UnixNano())
+}
+
+func (w *influxWriter) write(run time.Time, points []resultPoint) error {
+	buf := &bytes.Buffer{}
+	for _, p := range points {
+		buf.WriteString(influxLine(run, p))
+	}
+
+	req, err := http.NewRequest("POST", w.url, buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if w.token != "" {
+		req.Header.Set("Authorization", "Token "+w.token)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("InfluxDB write failed with %v: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+func (w *influxWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,354 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Postgres authentication request types used by fakePostgres.
+const (
+	postgresAuthOK           = 0
+	postgresAuthCleartext    = 3
+	postgresAuthMD5          = 5
+	postgresAuthSASL         = 10
+	postgresAuthSASLContinue = 11
+	postgresAuthSASLFinal    = 12
+)
+
+// fakePostgres is a Postgres server that supports the startup and simple
+// query protocols, and records the queries it receives.
+type fakePostgres struct {
+	t        *testing.T
+	ln       net.Listener
+	auth     uint32
+	password string
+
+	mu      sync.Mutex
+	params  map[string]string
+	queries []string
+	failOn  string
+}
+
+func newFakePostgres(t *testing.T, auth uint32, password string) *fakePostgres {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Failed to listen")
+
+	s := &fakePostgres{t: t, ln: ln, auth: auth, password: password}
+	go s.serve()
+	return s
+}
+
+func (s *fakePostgres) addr() string {
+	return s.ln.Addr().String()
+}
+
+func (s *fakePostgres) close() {
+	s.ln.Close()
+}
+
+func (s *fakePostgres) getParams() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.params
+}
+
+func (s *fakePostgres) getQueries() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.queries...)
+}
+
+func (s *fakePostgres) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakePostgres) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	write := func(typ byte, payload []byte) {
+		msg := []byte{typ, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(msg[1:], uint32(4+len(payload)))
+		conn.Write(append(msg, payload...))
+	}
+	auth := func(method uint32, data string) {
+		payload := make([]byte, 4)
+		binary.BigEndian.PutUint32(payload, method)
+		write('R', append(payload, data...))
+	}
+	read := func() (byte, []byte) {
+		header := make([]byte, 5)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return 0, nil
+		}
+		payload := make([]byte, binary.BigEndian.Uint32(header[1:])-4)
+		io.ReadFull(r, payload)
+		return header[0], payload
+	}
+	fail := func(msg string) {
+		write('E', []byte("SERROR\x00C28P01\x00M"+msg+"\x00\x00"))
+	}
+
+	// The startup message has no type, and is followed by key, value pairs.
+	lenBytes := make([]byte, 4)
+	io.ReadFull(r, lenBytes)
+	startup := make([]byte, binary.BigEndian.Uint32(lenBytes)-4)
+	io.ReadFull(r, startup)
+	fields := strings.Split(strings.TrimRight(string(startup[4:]), "\x00"), "\x00")
+	params := make(map[string]string)
+	for i := 0; i+1 < len(fields); i += 2 {
+		params[fields[i]] = fields[i+1]
+	}
+	s.mu.Lock()
+	s.params = params
+	s.mu.Unlock()
+
+	switch s.auth {
+	case postgresAuthCleartext:
+		auth(postgresAuthCleartext, "")
+		if _, p := read(); string(p) != s.password+"\x00" {
+			fail("password authentication failed")
+			return
+		}
+	case postgresAuthMD5:
+		salt := "salt"
+		auth(postgresAuthMD5, salt)
+		inner := md5.Sum([]byte(s.password + params["user"]))
+		outer := md5.Sum([]byte(hex.EncodeToString(inner[:]) + salt))
+		if _, p := read(); string(p) != "md5"+hex.EncodeToString(outer[:])+"\x00" {
+			fail("password authentication failed")
+			return
+		}
+	case postgresAuthSASL:
+		auth(postgresAuthSASL, "SCRAM-SHA-256\x00\x00")
+		_, p := read()
+		clientFirst := string(p[len("SCRAM-SHA-256\x00")+4:])
+		clientFirstBare := strings.TrimPrefix(clientFirst, "n,,")
+		salt := []byte("saltsalt")
+		// Clients reject iteration counts below 4096.
+		serverFirst := "r=" + scramAttributes(clientFirstBare)["r"] + "server,s=" + base64.StdEncoding.EncodeToString(salt) + ",i=4096"
+		auth(postgresAuthSASLContinue, serverFirst)
+
+		if _, p = read(); p == nil {
+			return
+		}
+		clientFinal := string(p)
+		withoutProof := clientFinal[:strings.LastIndex(clientFinal, ",p=")]
+		authMessage := clientFirstBare + "," + serverFirst + "," + withoutProof
+
+		salted := pbkdf2SHA256([]byte(s.password), salt, 4096)
+		storedKey := sha256.Sum256(hmacSHA256(salted, "Client Key"))
+		proof, _ := base64.StdEncoding.DecodeString(scramAttributes(clientFinal)["p"])
+		signature := hmacSHA256(storedKey[:], authMessage)
+		for i := range proof {
+			proof[i] ^= signature[i]
+		}
+		if got := sha256.Sum256(proof); got != storedKey {
+			fail("password authentication failed")
+			return
+		}
+		auth(postgresAuthSASLFinal, "v="+base64.StdEncoding.EncodeToString(hmacSHA256(hmacSHA256(salted, "Server Key"), authMessage)))
+	}
+	auth(postgresAuthOK, "")
+	write('S', []byte("server_version\x0016.0\x00"))
+	write('Z', []byte("I"))
+
+	for {
+		typ, payload := read()
+		if typ != 'Q' {
+			return
+		}
+
+		query := strings.TrimSuffix(string(payload), "\x00")
+		if query == ";" {
+			// The driver pings using an empty query.
+			write('I', nil)
+			write('Z', []byte("I"))
+			continue
+		}
+
+		s.mu.Lock()
+		s.queries = append(s.queries, query)
+		failOn := s.failOn
+		s.mu.Unlock()
+		if failOn != "" && strings.HasPrefix(query, failOn) {
+			write('E', []byte("SERROR\x00C42P01\x00Mrelation does not exist\x00\x00"))
+		} else {
+			write('C', []byte("INSERT 0 1\x00"))
+		}
+		write('Z', []byte("I"))
+	}
+}
+
+// scramAttributes parses the attributes of a SCRAM message.
+func scramAttributes(msg string) map[string]string {
+	attrs := make(map[string]string)
+	for _, attr := range strings.Split(msg, ",") {
+		if len(attr) > 2 && attr[1] == '=' {
+			attrs[attr[:1]] = attr[2:]
+		}
+	}
+	return attrs
+}
+
+// pbkdf2SHA256 derives a single block key, which is all SCRAM-SHA-256 uses.
+func pbkdf2SHA256(password, salt []byte, iterations int) []byte {
+	mac := hmac.New(sha256.New, password)
+	mac.Write(salt)
+	mac.Write([]byte{0, 0, 0, 1})
+	u := mac.Sum(nil)
+
+	key := append([]byte(nil), u...)
+	for i := 1; i < iterations; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range key {
+			key[j] ^= u[j]
+		}
+	}
+	return key
+}
+
+func TestPostgresWriterAuth(t *testing.T) {
+	tests := []struct {
+		msg      string
+		auth     uint32
+		password string
+		wantErr  string
+	}{
+		{msg: "trust", auth: postgresAuthOK},
+		{msg: "cleartext", auth: postgresAuthCleartext, password: "secret"},
+		{msg: "md5", auth: postgresAuthMD5, password: "secret"},
+		{msg: "scram", auth: postgresAuthSASL, password: "secret"},
+		{msg: "wrong password", auth: postgresAuthSASL, password: "other", wantErr: "password authentication failed"},
+	}
+
+	for _, tt := range tests {
+		s := newFakePostgres(t, tt.auth, "secret")
+
+		w, err := newPostgresWriter("postgres://yab:" + tt.password + "@" + s.addr() + "/db?sslmode=disable")
+		if tt.wantErr != "" {
+			if assert.Error(t, err, "%v: expected error", tt.msg) {
+				assert.Contains(t, err.Error(), tt.wantErr, "%v: unexpected error", tt.msg)
+			}
+			s.close()
+			continue
+		}
+		require.NoError(t, err, "%v: failed to connect", tt.msg)
+		assert.NoError(t, w.Close(), "%v: failed to close", tt.msg)
+
+		params := s.getParams()
+		assert.Equal(t, "yab", params["user"], "%v: unexpected user", tt.msg)
+		assert.Equal(t, "db", params["database"], "%v: unexpected database", tt.msg)
+		queries := s.getQueries()
+		if assert.Len(t, queries, 1, "%v: expected the table to be created", tt.msg) {
+			assert.Contains(t, queries[0], "CREATE TABLE IF NOT EXISTS yab_results (", "%v: unexpected query", tt.msg)
+		}
+		s.close()
+	}
+}
+
+func TestPostgresWriterWrite(t *testing.T) {
+	s := newFakePostgres(t, postgresAuthOK, "")
+	defer s.close()
+
+	w, err := newPostgresWriter("postgres://yab@" + s.addr() + "/db?table=bench.results&sslmode=disable")
+	require.NoError(t, err, "Failed to connect")
+	defer w.Close()
+
+	_, ok := s.getParams()["table"]
+	assert.False(t, ok, "The table parameter should not be sent to the server")
+
+	run := time.Date(2016, 4, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, w.write(run, []resultPoint{
+		{
+			time:     run.Add(time.Second),
+			kind:     resultsSample,
+			target:   "it's",
+			requests: 10,
+			errors:   1,
+			rps:      10,
+			p50:      1500 * time.Microsecond,
+			p90:      2 * time.Millisecond,
+			p99:      3 * time.Millisecond,
+			max:      4 * time.Millisecond,
+		},
+		{time: run.Add(2 * time.Second), kind: resultsSummary, target: "Simple::foo", throttled: 2},
+	}), "Failed to write")
+	require.NoError(t, w.write(run, nil), "Failed to write no points")
+
+	queries := s.getQueries()
+	require.Len(t, queries, 2, "Unexpected queries")
+	assert.Contains(t, queries[0], "CREATE TABLE IF NOT EXISTS bench.results (")
+	assert.Equal(t, "INSERT INTO bench.results (time, run, kind, target, requests, errors, throttled, rps, p50_ms, p90_ms, p99_ms, max_ms) VALUES "+
+		"('2016-04-01T12:00:01Z', '2016-04-01T12:00:00Z', 'sample', 'it''s', 10, 1, 0, 10, 1.5, 2, 3, 4), "+
+		"('2016-04-01T12:00:02Z', '2016-04-01T12:00:00Z', 'summary', 'Simple::foo', 0, 0, 2, 0, 0, 0, 0, 0)", queries[1])
+
+	s.mu.Lock()
+	s.failOn = "INSERT"
+	s.mu.Unlock()
+	err = w.write(run, []resultPoint{{time: run}})
+	if assert.Error(t, err, "Expected query error") {
+		assert.Contains(t, err.Error(), "relation does not exist", "Unexpected query error")
+	}
+}
+
+func TestNewPostgresWriterErrors(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr string
+	}{
+		{"http://localhost:5432/db", "invalid Postgres URL"},
+		{"postgres:///db", "invalid Postgres URL"},
+		{"postgres://localhost/db?table=results-drop", `invalid Postgres table name "results-drop"`},
+		{"postgres://127.0.0.1:1/db", "failed to connect to Postgres"},
+	}
+
+	for _, tt := range tests {
+		_, err := newPostgresWriter(tt.url)
+		if assert.Error(t, err, "%v: expected error", tt.url) {
+			assert.Contains(t, err.Error(), tt.wantErr, "%v: unexpected error", tt.url)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// webSocketTimeout is the timeout for connecting and for each message.
+const webSocketTimeout = 5 * time.Second
+
+// webSocketMessage is the JSON message sent for each results point.
+type webSocketMessage struct {
+	Run       time.Time `json:"run"`
+	Time      time.Time `json:"time"`
+	Kind      string    `json:"kind"`
+	Target    string    `json:"target"`
+	Requests  int       `json:"requests"`
+	Errors    int       `json:"errors"`
+	Throttled int       `json:"throttled"`
+	RPS       float64   `json:"rps"`
+	P50Ms     float64   `json:"p50_ms"`
+	P90Ms     float64   `json:"p90_ms"`
+	P99Ms     float64   `json:"p99_ms"`
+	MaxMs     float64   `json:"max_ms"`
+}
+
+// webSocketWriter streams results to a WebSocket listener, such as a live
+// dashboard, as a JSON text message for each point.
+type webSocketWriter struct {
+	conn *websocket.Conn
+}
+
+func newWebSocketWriter(rawURL string) (*webSocketWriter, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+		return nil, fmt.Errorf("invalid WebSocket URL %q, expected a ws(s):// URL", rawURL)
+	}
+
+	dialer := &websocket.Dialer{
+		NetDial:          (&net.Dialer{Timeout: webSocketTimeout}).Dial,
+		HandshakeTimeout: webSocketTimeout,
+	}
+	conn, res, err := dialer.Dial(rawURL, nil)
+	if err == websocket.ErrBadHandshake && res != nil {
+		return nil, fmt.Errorf("WebSocket handshake failed: got %v, expected 101 Switching Protocols", res.Status)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to WebSocket listener: %v", err)
+	}
+	return &webSocketWriter{conn: conn}, nil
+}
+
+func (w *webSocketWriter) write(run time.Time, points []resultPoint) error {
+	ms := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Millisecond)
+	}
+
+	for _, p := range points {
+		msg, err := json.Marshal(webSocketMessage{
+			Run:       run,
+			Time:      p.time,
+			Kind:      p.kind,
+			Target:    p.target,
+			Requests:  p.requests,
+			Errors:    p.errors,
+			Throttled: p.throttled,
+			RPS:       p.rps,
+			P50Ms:     ms(p.p50),
+			P90Ms:     ms(p.p90),
+			P99Ms:     ms(p.p99),
+			MaxMs:     ms(p.max),
+		})
+		if err != nil {
+			return err
+		}
+
+		w.conn.SetWriteDeadline(time.Now().Add(webSocketTimeout))
+		if err := w.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close sends a normal closure message, and closes the connection.
+func (w *webSocketWriter) Close() error {
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	err := w.conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(webSocketTimeout))
+	if closeErr := w.conn.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
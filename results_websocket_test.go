@@ -0,0 +1,118 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newWebSocketServer returns a server that accepts a WebSocket, and sends
+// the messages it receives to the returned channel, which is closed once the
+// client closes the connection.
+func newWebSocketServer(t *testing.T) (*httptest.Server, <-chan []byte) {
+	messages := make(chan []byte, 10)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/yab", r.URL.Path, "Unexpected path")
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err, "Failed to upgrade connection")
+		defer conn.Close()
+
+		defer close(messages)
+		for {
+			typ, msg, err := conn.ReadMessage()
+			if err != nil {
+				assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), "Expected normal closure, got %v", err)
+				return
+			}
+			assert.Equal(t, websocket.TextMessage, typ, "Unexpected message type")
+			messages <- msg
+		}
+	}))
+	return server, messages
+}
+
+func TestWebSocketWriter(t *testing.T) {
+	server, messages := newWebSocketServer(t)
+	defer server.Close()
+
+	w, err := newWebSocketWriter("ws://" + strings.TrimPrefix(server.URL, "http://") + "/yab")
+	require.NoError(t, err, "Failed to create WebSocket writer")
+
+	run := time.Unix(1500000000, 0).UTC()
+	err = w.write(run, []resultPoint{
+		{time: run.Add(time.Second), kind: resultsSample, target: "foo", requests: 10, errors: 1, rps: 10, p50: time.Millisecond, max: 3 * time.Millisecond},
+		{time: run.Add(2 * time.Second), kind: resultsSummary, target: "foo", requests: 20, throttled: 2, rps: 10, p99: 1500 * time.Microsecond},
+	})
+	require.NoError(t, err, "Failed to write points")
+	require.NoError(t, w.Close(), "Failed to close writer")
+
+	var got []webSocketMessage
+	for payload := range messages {
+		var msg webSocketMessage
+		require.NoError(t, json.Unmarshal(payload, &msg), "Failed to unmarshal message")
+		got = append(got, msg)
+	}
+
+	want := []webSocketMessage{
+		{Run: run, Time: run.Add(time.Second), Kind: "sample", Target: "foo", Requests: 10, Errors: 1, RPS: 10, P50Ms: 1, MaxMs: 3},
+		{Run: run, Time: run.Add(2 * time.Second), Kind: "summary", Target: "foo", Requests: 20, Throttled: 2, RPS: 10, P99Ms: 1.5},
+	}
+	assert.Equal(t, want, got, "Unexpected messages")
+}
+
+func TestWebSocketWriterErrors(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Failed to listen")
+	addr := ln.Addr().String()
+	ln.Close()
+
+	notUpgraded := httptest.NewServer(http.NotFoundHandler())
+	defer notUpgraded.Close()
+
+	tests := []struct {
+		url     string
+		wantErr string
+	}{
+		{"http://localhost:8080/yab", "invalid WebSocket URL"},
+		{"ws://", "invalid WebSocket URL"},
+		{"ws://" + addr, "failed to connect"},
+		{"ws://" + strings.TrimPrefix(notUpgraded.URL, "http://"), "expected 101"},
+	}
+
+	for _, tt := range tests {
+		_, err := newWebSocketWriter(tt.url)
+		if assert.Error(t, err, "Expected error for %v", tt.url) {
+			assert.Contains(t, err.Error(), tt.wantErr, "Unexpected error for %v", tt.url)
+		}
+	}
+}
@@ -0,0 +1,400 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// secretTimeout is the timeout for fetching a secret from a secret manager.
+const secretTimeout = 10 * time.Second
+
+// secretRef matches references to secrets in header values, such as
+// env://API_TOKEN, vault://secret/data/yab#token or awssm://yab/token#token,
+// which may be part of a value, such as "Bearer env://API_TOKEN".
+var secretRef = regexp.MustCompile(`\b(env|vault|awssm)://[^\s]+`)
+
+// secretResolver resolves secret references at runtime, so tokens don't need
+// to be stored in plaintext in header, targets and plan files. Secrets are
+// resolved once, when requests are built, and are cached with their
+// references, so secrets are replaced by their references when requests are
+// printed or saved.
+type secretResolver struct {
+	getenv func(string) string
+	now    func() time.Time
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[string]string
+}
+
+func newSecretResolver() *secretResolver {
+	return &secretResolver{
+		getenv: os.Getenv,
+		now:    time.Now,
+		client: &http.Client{Timeout: secretTimeout},
+		cache:  make(map[string]string),
+	}
+}
+
+// secrets resolves the secrets referenced by headers.
+var secrets = newSecretResolver()
+
+// resolveHeaders returns the headers with secret references replaced by the
+// secrets. Headers without references are returned as is.
+func (r *secretResolver) resolveHeaders(headers map[string]string) (map[string]string, error) {
+	var resolved map[string]string
+	for k, v := range headers {
+		if !secretRef.MatchString(v) {
+			continue
+		}
+
+		if resolved == nil {
+			resolved = make(map[string]string, len(headers))
+			for name, value := range headers {
+				resolved[name] = value
+			}
+		}
+
+		var err error
+		resolved[k] = secretRef.ReplaceAllStringFunc(v, func(ref string) string {
+			secret, resolveErr := r.resolve(ref)
+			if resolveErr != nil && err == nil {
+				err = fmt.Errorf("failed to resolve secret for header %q: %v", k, resolveErr)
+			}
+			return secret
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if resolved == nil {
+		return headers, nil
+	}
+	return resolved, nil
+}
+
+// redactHeaders returns the headers with any resolved secrets replaced by
+// their references. Headers without secrets are returned as is.
+func (r *secretResolver) redactHeaders(headers map[string]string) map[string]string {
+	var redacted map[string]string
+	for k, v := range headers {
+		if redactedValue := r.redact(v); redactedValue != v {
+			if redacted == nil {
+				redacted = make(map[string]string, len(headers))
+				for name, value := range headers {
+					redacted[name] = value
+				}
+			}
+			redacted[k] = redactedValue
+		}
+	}
+
+	if redacted == nil {
+		return headers
+	}
+	return redacted
+}
+
+// redact replaces any resolved secrets in s by their references.
+func (r *secretResolver) redact(s string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for ref, secret := range r.cache {
+		if secret != "" {
+			s = strings.Replace(s, secret, ref, -1)
+		}
+	}
+	return s
+}
+
+// resolve returns the secret for a reference. The lock isn't held while the
+// secret is fetched, so a reference may be fetched more than once if it's
+// resolved concurrently.
+func (r *secretResolver) resolve(ref string) (string, error) {
+	r.mu.Lock()
+	secret, ok := r.cache[ref]
+	r.mu.Unlock()
+	if ok {
+		return secret, nil
+	}
+
+	secret, err := r.fetch(ref)
+	if err != nil {
+		return "", fmt.Errorf("%v: %v", ref, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cache[ref] = secret
+	return secret, nil
+}
+
+// fetch reads the secret for a reference from its source.
+func (r *secretResolver) fetch(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, "env://"):
+		name := strings.TrimPrefix(ref, "env://")
+		secret := r.getenv(name)
+		if secret == "" {
+			return "", fmt.Errorf("environment variable %v is not set", name)
+		}
+		return secret, nil
+	case strings.HasPrefix(ref, "vault://"):
+		return r.vault(strings.TrimPrefix(ref, "vault://"))
+	default:
+		return r.awsSecretsManager(strings.TrimPrefix(ref, "awssm://"))
+	}
+}
+
+// splitSecretKey splits a path#key reference.
+func splitSecretKey(ref string) (path, key string) {
+	if i := strings.LastIndex(ref, "#"); i >= 0 {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, ""
+}
+
+// vault reads the key of the secret at path from HashiCorp Vault, using
+// VAULT_ADDR, and VAULT_TOKEN or the token saved by vault login. Both the
+// KV version 1 and 2 secrets engines are supported.
+func (r *secretResolver) vault(ref string) (string, error) {
+	path, key := splitSecretKey(ref)
+	if path == "" || key == "" {
+		return "", fmt.Errorf("expected vault://path#key")
+	}
+
+	addr := r.getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", fmt.Errorf("VAULT_ADDR is not set")
+	}
+	token := r.getenv("VAULT_TOKEN")
+	if token == "" {
+		if bs, err := ioutil.ReadFile(filepath.Join(r.getenv("HOME"), ".vault-token")); err == nil {
+			token = strings.TrimSpace(string(bs))
+		}
+	}
+	if token == "" {
+		return "", fmt.Errorf("VAULT_TOKEN is not set, and there is no ~/.vault-token")
+	}
+
+	req, err := http.NewRequest("GET", strings.TrimSuffix(addr, "/")+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := r.getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+
+	var result struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := r.doJSON(req, &result); err != nil {
+		return "", err
+	}
+
+	// KV version 2 nests the secret's data, next to its metadata.
+	data := result.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nested
+		}
+	}
+	return secretField(data, key)
+}
+
+// awsSecretsManager reads the secret from AWS Secrets Manager, using the
+// credentials and region from the standard AWS environment variables. If
+// a key is given, the secret must be a JSON object, and the key's value is
+// used.
+func (r *secretResolver) awsSecretsManager(ref string) (string, error) {
+	secretID, key := splitSecretKey(ref)
+	if secretID == "" {
+		return "", fmt.Errorf("expected awssm://secret-id or awssm://secret-id#key")
+	}
+
+	region := r.getenv("AWS_REGION")
+	if region == "" {
+		region = r.getenv("AWS_DEFAULT_REGION")
+	}
+	accessKey, secretKey := r.getenv("AWS_ACCESS_KEY_ID"), r.getenv("AWS_SECRET_ACCESS_KEY")
+	if region == "" || accessKey == "" || secretKey == "" {
+		return "", fmt.Errorf("AWS_REGION, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+
+	endpoint := r.getenv("AWS_ENDPOINT_URL_SECRETS_MANAGER")
+	if endpoint == "" {
+		endpoint = r.getenv("AWS_ENDPOINT_URL")
+	}
+	if endpoint == "" {
+		endpoint = "https://secretsmanager." + region + ".amazonaws.com"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid endpoint %q: %v", endpoint, err)
+	}
+
+	body, err := json.Marshal(map[string]string{"SecretId": secretID})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest("POST", strings.TrimSuffix(u.String(), "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	if token := r.getenv("AWS_SESSION_TOKEN"); token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+	signAWSRequest(req, body, u.Host, region, "secretsmanager", accessKey, secretKey, r.now())
+
+	var result struct {
+		SecretString *string `json:"SecretString"`
+	}
+	if err := r.doJSON(req, &result); err != nil {
+		return "", err
+	}
+	if result.SecretString == nil {
+		return "", fmt.Errorf("secret is binary, only string secrets are supported")
+	}
+	if key == "" {
+		return *result.SecretString, nil
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(*result.SecretString), &data); err != nil {
+		return "", fmt.Errorf("secret is not a JSON object, so key %q cannot be used", key)
+	}
+	return secretField(data, key)
+}
+
+// doJSON makes the request, and decodes the JSON response into v.
+func (r *secretResolver) doJSON(req *http.Request, v interface{}) error {
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("got %v: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse response: %v", err)
+	}
+	return nil
+}
+
+// secretField returns the string value of the key in the secret's data.
+func secretField(data map[string]interface{}, key string) (string, error) {
+	v, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("secret has no key %q", key)
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("secret key %q is not a string", key)
+	}
+	return s, nil
+}
+
+// signAWSRequest signs the request using AWS Signature Version 4.
+func signAWSRequest(req *http.Request, body []byte, host, region, service, accessKey, secretKey string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	// The signed headers are the lowercase names of the headers, and the host, in order.
+	names := []string{"host"}
+	values := map[string]string{"host": host}
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		names = append(names, lower)
+		values[lower] = strings.TrimSpace(req.Header.Get(name))
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%v:%v\n", name, values[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+	signature := hex.EncodeToString(hmacSHA256(awsSigningKey(secretKey, date, region, service), stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v",
+		accessKey, scope, signedHeaders, signature))
+}
+
+// awsSigningKey derives the Signature Version 4 signing key.
+func awsSigningKey(secretKey, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, msg string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(msg))
+	return mac.Sum(nil)
+}
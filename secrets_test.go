@@ -0,0 +1,298 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yarpc/yab/encoding"
+	"github.com/yarpc/yab/transport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSecretResolverForTest(env map[string]string) *secretResolver {
+	r := newSecretResolver()
+	r.getenv = func(name string) string { return env[name] }
+	r.now = func() time.Time { return time.Date(2017, 5, 6, 7, 8, 9, 0, time.UTC) }
+	return r
+}
+
+func TestResolveHeadersEnv(t *testing.T) {
+	r := newSecretResolverForTest(map[string]string{"API_TOKEN": "s3cret", "CALLER": "yab"})
+
+	headers := map[string]string{"X-Caller": "caller"}
+	got, err := r.resolveHeaders(headers)
+	require.NoError(t, err, "resolveHeaders failed")
+	assert.Equal(t, headers, got, "Headers without secrets should not change")
+
+	headers = map[string]string{
+		"Authorization": "Bearer env://API_TOKEN",
+		"X-Caller":      "env://CALLER",
+		"X-Url":         "http://env.example.com",
+	}
+	got, err = r.resolveHeaders(headers)
+	require.NoError(t, err, "resolveHeaders failed")
+	assert.Equal(t, map[string]string{
+		"Authorization": "Bearer s3cret",
+		"X-Caller":      "yab",
+		"X-Url":         "http://env.example.com",
+	}, got, "Unexpected resolved headers")
+	assert.Equal(t, "Bearer env://API_TOKEN", headers["Authorization"], "Original headers should not be modified")
+
+	_, err = r.resolveHeaders(map[string]string{"Authorization": "env://MISSING"})
+	if assert.Error(t, err, "Expected missing variable to fail") {
+		assert.Contains(t, err.Error(), `header "Authorization"`, "Error should include the header")
+		assert.Contains(t, err.Error(), "MISSING is not set", "Unexpected error")
+	}
+}
+
+func TestSecretsResolvedOnce(t *testing.T) {
+	defer func(old *secretResolver) { secrets = old }(secrets)
+	lookups := 0
+	secrets = newSecretResolverForTest(nil)
+	secrets.getenv = func(name string) string {
+		lookups++
+		return map[string]string{"API_TOKEN": "s3cret"}[name]
+	}
+
+	authHeaders := make(chan string, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeaders <- r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	headers, err := getHeaders(`{"Authorization": "Bearer env://API_TOKEN"}`, "")
+	require.NoError(t, err, "getHeaders failed")
+	assert.Equal(t, "Bearer s3cret", headers["Authorization"], "Secrets should be resolved when the request is built")
+
+	tr, err := getTransport(TransportOptions{ServiceName: "svc", HostPorts: []string{server.URL}}, encoding.JSON)
+	require.NoError(t, err, "getTransport failed")
+
+	req := &transport.Request{Method: "method", Headers: headers, Timeout: time.Second}
+	for i := 0; i < 2; i++ {
+		res, err := makeRequest(tr, req)
+		require.NoError(t, err, "makeRequest failed")
+		res.Release()
+		assert.Equal(t, "Bearer s3cret", <-authHeaders, "The secret should be sent")
+	}
+	assert.Equal(t, 1, lookups, "The secret should only be resolved once")
+	assert.Equal(t, map[string]string{"Authorization": "Bearer env://API_TOKEN"},
+		secrets.redactHeaders(req.Headers), "The reference should be kept for redaction")
+
+	_, err = getHeaders(`{"Authorization": "env://MISSING"}`, "")
+	assert.Error(t, err, "Missing secrets should fail before requests are made")
+}
+
+func TestResolveDoesNotBlockOnFetch(t *testing.T) {
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+		w.Write([]byte(`{"data": {"token": "v1-token"}}`))
+	}))
+	defer server.Close()
+	defer close(unblock)
+
+	r := newSecretResolverForTest(map[string]string{"VAULT_ADDR": server.URL, "VAULT_TOKEN": "vault-token", "API_TOKEN": "s3cret"})
+	go r.resolve("vault://secret/yab#token")
+
+	// While the Vault secret is being fetched, other secrets can be resolved.
+	resolved := make(chan struct{})
+	go func() {
+		defer close(resolved)
+		got, err := r.resolve("env://API_TOKEN")
+		assert.NoError(t, err, "resolve failed")
+		assert.Equal(t, "s3cret", got, "resolve mismatch")
+	}()
+
+	select {
+	case <-resolved:
+	case <-time.After(time.Second):
+		t.Fatal("resolve blocked on another secret being fetched")
+	}
+}
+
+func TestSecretsRedacted(t *testing.T) {
+	defer func(old *secretResolver) { secrets = old }(secrets)
+	secrets = newSecretResolverForTest(map[string]string{"API_TOKEN": "s3cret"})
+	_, err := secrets.resolve("env://API_TOKEN")
+	require.NoError(t, err, "resolve failed")
+
+	opts := TransportOptions{ServiceName: "svc", HostPorts: []string{"http://example.com/rpc"}}
+	for _, headers := range []map[string]string{
+		{"Authorization": "Bearer env://API_TOKEN"},
+		{"Authorization": "Bearer s3cret"},
+	} {
+		snippet, err := generateSnippet(generateCurl, opts, &transport.Request{Method: "method", Headers: headers, Timeout: time.Second})
+		require.NoError(t, err, "generateSnippet failed")
+		assert.Contains(t, snippet, "Bearer env://API_TOKEN", "Snippet should contain the reference")
+		assert.NotContains(t, snippet, "s3cret", "Snippet should not contain the secret")
+	}
+
+	dir, err := ioutil.TempDir("", "yab-errors")
+	require.NoError(t, err, "TempDir failed")
+	defer os.RemoveAll(dir)
+
+	samples, err := newErrorSamples(dir, 1)
+	require.NoError(t, err, "newErrorSamples failed")
+	req := &transport.Request{Method: "method", Headers: map[string]string{"Authorization": "Bearer s3cret", "k": "v"}}
+	samples.forTarget("target").record(req, "", nil, time.Millisecond, errors.New("failed"))
+
+	details, err := ioutil.ReadFile(filepath.Join(samples.dir, "0001", "sample.json"))
+	require.NoError(t, err, "failed to read sample.json")
+	assert.NotContains(t, string(details), "s3cret", "Error sample should not contain the secret")
+
+	var sample errorSample
+	require.NoError(t, json.Unmarshal(details, &sample), "failed to parse sample.json")
+	assert.Equal(t, map[string]string{"Authorization": "Bearer env://API_TOKEN", "k": "v"}, sample.RequestHeaders, "Unexpected request headers")
+	assert.Equal(t, "Bearer s3cret", req.Headers["Authorization"], "The request should not be modified")
+}
+
+func TestResolveVault(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "vault-token", r.Header.Get("X-Vault-Token"), "Unexpected token")
+		switch r.URL.Path {
+		case "/v1/secret/yab":
+			w.Write([]byte(`{"data": {"token": "v1-token", "count": 1}}`))
+		case "/v1/secret/data/yab":
+			w.Write([]byte(`{"data": {"data": {"token": "v2-token"}, "metadata": {"version": 3}}}`))
+		default:
+			http.Error(w, `{"errors": ["permission denied"]}`, http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	r := newSecretResolverForTest(map[string]string{"VAULT_ADDR": server.URL + "/", "VAULT_TOKEN": "vault-token"})
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr string
+	}{
+		{ref: "vault://secret/yab#token", want: "v1-token"},
+		{ref: "vault://secret/data/yab#token", want: "v2-token"},
+		{ref: "vault://secret/yab#missing", wantErr: `secret has no key "missing"`},
+		{ref: "vault://secret/yab#count", wantErr: `secret key "count" is not a string`},
+		{ref: "vault://secret/other#token", wantErr: "permission denied"},
+		{ref: "vault://secret/yab", wantErr: "expected vault://path#key"},
+	}
+
+	for _, tt := range tests {
+		got, err := r.resolve(tt.ref)
+		if tt.wantErr != "" {
+			if assert.Error(t, err, "resolve(%v) should fail", tt.ref) {
+				assert.Contains(t, err.Error(), tt.wantErr, "resolve(%v) unexpected error", tt.ref)
+			}
+			continue
+		}
+
+		require.NoError(t, err, "resolve(%v) failed", tt.ref)
+		assert.Equal(t, tt.want, got, "resolve(%v) mismatch", tt.ref)
+	}
+
+	before := requests
+	_, err := r.resolve("vault://secret/yab#token")
+	require.NoError(t, err, "resolve failed")
+	assert.Equal(t, before, requests, "Secrets should be cached")
+
+	_, err = newSecretResolverForTest(nil).resolve("vault://secret/yab#token")
+	assert.Error(t, err, "Expected missing VAULT_ADDR to fail")
+}
+
+func TestResolveAWSSecretsManager(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method, "Unexpected method")
+		assert.Equal(t, "secretsmanager.GetSecretValue", r.Header.Get("X-Amz-Target"), "Unexpected target")
+		assert.Equal(t, "20170506T070809Z", r.Header.Get("X-Amz-Date"), "Unexpected date")
+		assert.Equal(t, "session", r.Header.Get("X-Amz-Security-Token"), "Unexpected session token")
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"),
+			"AWS4-HMAC-SHA256 Credential=AKID/20170506/us-west-2/secretsmanager/aws4_request, SignedHeaders=content-type;host;x-amz-date;x-amz-security-token;x-amz-target, Signature="),
+			"Unexpected Authorization header: %v", r.Header.Get("Authorization"))
+
+		var req struct{ SecretId string }
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req), "Failed to decode request")
+		switch req.SecretId {
+		case "yab/plain":
+			w.Write([]byte(`{"SecretString": "plain-token"}`))
+		case "yab/json":
+			w.Write([]byte(`{"SecretString": "{\"token\": \"json-token\"}"}`))
+		case "yab/binary":
+			w.Write([]byte(`{"SecretBinary": "AAEC"}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type": "ResourceNotFoundException"}`))
+		}
+	}))
+	defer server.Close()
+
+	r := newSecretResolverForTest(map[string]string{
+		"AWS_DEFAULT_REGION":    "us-west-2",
+		"AWS_ACCESS_KEY_ID":     "AKID",
+		"AWS_SECRET_ACCESS_KEY": "secret",
+		"AWS_SESSION_TOKEN":     "session",
+		"AWS_ENDPOINT_URL":      server.URL,
+	})
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr string
+	}{
+		{ref: "awssm://yab/plain", want: "plain-token"},
+		{ref: "awssm://yab/json#token", want: "json-token"},
+		{ref: "awssm://yab/plain#token", wantErr: "not a JSON object"},
+		{ref: "awssm://yab/binary", wantErr: "only string secrets are supported"},
+		{ref: "awssm://yab/missing", wantErr: "ResourceNotFoundException"},
+	}
+
+	for _, tt := range tests {
+		got, err := r.resolve(tt.ref)
+		if tt.wantErr != "" {
+			if assert.Error(t, err, "resolve(%v) should fail", tt.ref) {
+				assert.Contains(t, err.Error(), tt.wantErr, "resolve(%v) unexpected error", tt.ref)
+			}
+			continue
+		}
+
+		require.NoError(t, err, "resolve(%v) failed", tt.ref)
+		assert.Equal(t, tt.want, got, "resolve(%v) mismatch", tt.ref)
+	}
+
+	_, err := newSecretResolverForTest(nil).resolve("awssm://yab/plain")
+	assert.Error(t, err, "Expected missing credentials to fail")
+}
+
+func TestAWSSigningKey(t *testing.T) {
+	// Example from the AWS Signature Version 4 documentation.
+	key := awsSigningKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20120215", "us-east-1", "iam")
+	assert.Equal(t, "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d", hex.EncodeToString(key))
+}
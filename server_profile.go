@@ -0,0 +1,172 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// serverProfileTimeout is the timeout for fetching a heap profile, and how
+// much longer than the benchmark a CPU profile can take.
+const serverProfileTimeout = 30 * time.Second
+
+var errServerProfileCancelled = errors.New("the benchmark ended before the server CPU profile finished, so it was not saved")
+
+// serverProfiler fetches profiles from the target's /debug/pprof endpoints,
+// so server-side profiles are bundled with the benchmark results: a CPU
+// profile covering the benchmark, and heap profiles before and after it.
+type serverProfiler struct {
+	baseURL string
+	dir     string
+
+	// cpuEnd is when the benchmark is expected to end, and cancelCPU cancels
+	// fetching the CPU profile if the benchmark ends before then.
+	cpuEnd    time.Time
+	cancelCPU context.CancelFunc
+
+	// cpuDone receives the result of fetching the CPU profile.
+	cpuDone chan error
+	files   []string
+}
+
+// newServerProfiler returns a serverProfiler for the admin address, which is
+// a host:port or a http(s) URL, or nil if addr is empty.
+func newServerProfiler(addr, dir string) (*serverProfiler, error) {
+	if addr == "" {
+		return nil, nil
+	}
+
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid admin address %q, expected a host:port or http(s) URL", addr)
+	}
+
+	return &serverProfiler{
+		baseURL: strings.TrimSuffix(u.String(), "/") + "/debug/pprof/",
+		dir:     dir,
+	}, nil
+}
+
+// start fetches a heap profile, and starts fetching a CPU profile for the
+// duration of the benchmark.
+func (p *serverProfiler) start(duration time.Duration) error {
+	if p == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(p.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create profile directory: %v", err)
+	}
+	if err := p.fetch(context.Background(), "heap", "heap-before.pb.gz", serverProfileTimeout); err != nil {
+		return err
+	}
+
+	seconds := int(math.Ceil(duration.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cpuEnd = time.Now().Add(duration)
+	p.cancelCPU = cancel
+	p.cpuDone = make(chan error, 1)
+	go func() {
+		err := p.fetch(ctx, fmt.Sprintf("profile?seconds=%v", seconds), "cpu.pb.gz", duration+serverProfileTimeout)
+		if err != nil && ctx.Err() != nil {
+			err = errServerProfileCancelled
+		}
+		p.cpuDone <- err
+	}()
+	return nil
+}
+
+// stop waits for the CPU profile, fetches a heap profile, and logs where the
+// profiles were saved.
+func (p *serverProfiler) stop(logger *logger) {
+	if p == nil {
+		return
+	}
+
+	// If the benchmark ended early, such as when --maxRequests is reached,
+	// the CPU profile would still cover the whole --maxDuration, so it's
+	// cancelled rather than waiting for it.
+	if time.Now().Before(p.cpuEnd) {
+		p.cancelCPU()
+	}
+	p.warn(logger, <-p.cpuDone)
+	p.cancelCPU()
+
+	p.warn(logger, p.fetch(context.Background(), "heap", "heap-after.pb.gz", serverProfileTimeout))
+
+	if len(p.files) > 0 {
+		logger.Infof("saved server profiles to %v: %v", p.dir, strings.Join(p.files, ", "))
+	}
+}
+
+func (p *serverProfiler) warn(logger *logger, err error) {
+	if err != nil {
+		logger.Warnf("%v", err)
+	}
+}
+
+// fetch saves the profile at path, relative to /debug/pprof/, to file. The
+// request is abandoned if ctx is cancelled.
+func (p *serverProfiler) fetch(ctx context.Context, path, file string, timeout time.Duration) error {
+	client := &http.Client{Timeout: timeout}
+	resp, err := ctxhttp.Get(ctx, client, p.baseURL+path)
+	if err != nil {
+		return fmt.Errorf("failed to fetch server profile %v: %v", file, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to fetch server profile %v: got %v: %s", file, resp.Status, bytes.TrimSpace(body))
+	}
+
+	f, err := os.Create(filepath.Join(p.dir, file))
+	if err != nil {
+		return fmt.Errorf("failed to create server profile %v: %v", file, err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		return fmt.Errorf("failed to save server profile %v: %v", file, err)
+	}
+	p.files = append(p.files, file)
+	return nil
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewServerProfiler(t *testing.T) {
+	tests := []struct {
+		addr    string
+		want    string
+		wantErr bool
+	}{
+		{addr: ""},
+		{addr: "localhost:8081", want: "http://localhost:8081/debug/pprof/"},
+		{addr: "https://admin.example.com/", want: "https://admin.example.com/debug/pprof/"},
+		{addr: "http://localhost:8081/admin", want: "http://localhost:8081/admin/debug/pprof/"},
+		{addr: "ftp://localhost:8081", wantErr: true},
+		{addr: "http://", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		p, err := newServerProfiler(tt.addr, "dir")
+		if tt.wantErr {
+			assert.Error(t, err, "Expected error for %q", tt.addr)
+			continue
+		}
+
+		require.NoError(t, err, "Failed to parse %q", tt.addr)
+		if tt.want == "" {
+			assert.Nil(t, p, "Expected no profiler for %q", tt.addr)
+			continue
+		}
+		assert.Equal(t, tt.want, p.baseURL, "Unexpected URL for %q", tt.addr)
+	}
+}
+
+func TestServerProfiler(t *testing.T) {
+	heaps := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/heap", func(w http.ResponseWriter, r *http.Request) {
+		heaps++
+		w.Write([]byte("heap" + strings.Repeat("!", heaps)))
+	})
+	mux.HandleFunc("/debug/pprof/profile", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "1", r.URL.Query().Get("seconds"), "Unexpected CPU profile duration")
+		w.Write([]byte("cpu"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "server-profiles")
+	require.NoError(t, err, "TempDir failed")
+	defer os.RemoveAll(dir)
+
+	buf, out := getOutput(t)
+	p, err := newServerProfiler(server.URL, filepath.Join(dir, "profiles"))
+	require.NoError(t, err, "Failed to create profiler")
+	require.NoError(t, p.start(10*time.Millisecond), "Failed to start profiler")
+	time.Sleep(10 * time.Millisecond)
+	p.stop(newLogger(Options{}, out))
+
+	for file, want := range map[string]string{
+		"heap-before.pb.gz": "heap!",
+		"cpu.pb.gz":         "cpu",
+		"heap-after.pb.gz":  "heap!!",
+	} {
+		got, err := ioutil.ReadFile(filepath.Join(dir, "profiles", file))
+		if assert.NoError(t, err, "Failed to read %v", file) {
+			assert.Equal(t, want, string(got), "Unexpected contents of %v", file)
+		}
+	}
+	assert.Contains(t, buf.String(), "cpu.pb.gz", "Expected saved profiles to be logged")
+	assert.NotContains(t, buf.String(), "Warning", "Unexpected warnings")
+}
+
+func TestServerProfilerEndedEarly(t *testing.T) {
+	// The CPU profile only returns once the request is abandoned.
+	unblock := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/heap", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("heap"))
+	})
+	mux.HandleFunc("/debug/pprof/profile", func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	defer close(unblock)
+
+	dir, err := ioutil.TempDir("", "server-profiles")
+	require.NoError(t, err, "TempDir failed")
+	defer os.RemoveAll(dir)
+
+	buf, out := getOutput(t)
+	p, err := newServerProfiler(server.URL, dir)
+	require.NoError(t, err, "Failed to create profiler")
+	require.NoError(t, p.start(time.Minute), "Failed to start profiler")
+
+	start := time.Now()
+	p.stop(newLogger(Options{}, out))
+	assert.True(t, time.Since(start) < 5*time.Second, "stop should not wait for the CPU profile, took %v", time.Since(start))
+	assert.Contains(t, buf.String(), errServerProfileCancelled.Error(), "Expected the CPU profile to be cancelled")
+	assert.Contains(t, buf.String(), "heap-before.pb.gz, heap-after.pb.gz", "Expected heap profiles to be saved")
+
+	_, err = os.Stat(filepath.Join(dir, "cpu.pb.gz"))
+	assert.True(t, os.IsNotExist(err), "cancelled CPU profile should not be saved")
+}
+
+func TestServerProfilerErrors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/heap", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("heap"))
+	})
+	mux.HandleFunc("/debug/pprof/profile", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "cpu profiling already in use", http.StatusInternalServerError)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "server-profiles")
+	require.NoError(t, err, "TempDir failed")
+	defer os.RemoveAll(dir)
+
+	buf, out := getOutput(t)
+	p, err := newServerProfiler(server.URL, dir)
+	require.NoError(t, err, "Failed to create profiler")
+	require.NoError(t, p.start(10*time.Millisecond), "Failed to start profiler")
+	time.Sleep(10 * time.Millisecond)
+	p.stop(newLogger(Options{}, out))
+	assert.Contains(t, buf.String(), "failed to fetch server profile cpu.pb.gz: got 500 Internal Server Error: cpu profiling already in use", "Expected CPU profile failure")
+	assert.Contains(t, buf.String(), "heap-before.pb.gz, heap-after.pb.gz", "Expected heap profiles to be saved")
+
+	unreachable, err := newServerProfiler(strings.TrimPrefix(server.URL, "http://")+"/missing", dir)
+	require.NoError(t, err, "Failed to create profiler")
+	err = unreachable.start(time.Second)
+	if assert.Error(t, err, "Expected missing endpoint to fail") {
+		assert.Contains(t, err.Error(), "404", "Unexpected error")
+	}
+}
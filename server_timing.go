@@ -0,0 +1,128 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// serverTimingTotal is the metric used as the server's total time, if a
+// response reports it. Otherwise, the server's time is the sum of the
+// reported metrics.
+const serverTimingTotal = "total"
+
+// serverTimingMetric is a server-reported duration for a phase of a call.
+type serverTimingMetric struct {
+	name string
+	dur  time.Duration
+}
+
+// parseServerTiming returns the metrics with a duration in the given header,
+// which uses the Server-Timing format, e.g. `db;dur=12.5, app;dur=40`.
+// Headers such as x-envoy-upstream-service-time that only contain a
+// duration (in milliseconds, or with a unit) are reported as the total.
+func parseServerTiming(headers map[string]string, header string) []serverTimingMetric {
+	var value string
+	for k, v := range headers {
+		if strings.EqualFold(k, header) {
+			value = strings.TrimSpace(v)
+			break
+		}
+	}
+	if value == "" {
+		return nil
+	}
+
+	if d, ok := parseTimingDuration(value); ok {
+		return []serverTimingMetric{{serverTimingTotal, d}}
+	}
+
+	var metrics []serverTimingMetric
+	for _, entry := range splitUnquoted(value, ',') {
+		params := splitUnquoted(entry, ';')
+		name := strings.TrimSpace(params[0])
+		if name == "" {
+			continue
+		}
+
+		// Metrics without a duration, e.g. cache;desc=hit, are ignored.
+		for _, param := range params[1:] {
+			kv := strings.SplitN(param, "=", 2)
+			if len(kv) != 2 || !strings.EqualFold(strings.TrimSpace(kv[0]), "dur") {
+				continue
+			}
+			ms, err := strconv.ParseFloat(strings.Trim(strings.TrimSpace(kv[1]), `"`), 64)
+			if err != nil || ms < 0 {
+				continue
+			}
+			metrics = append(metrics, serverTimingMetric{name, time.Duration(ms * float64(time.Millisecond))})
+			break
+		}
+	}
+	return metrics
+}
+
+// parseTimingDuration parses a number of milliseconds, or a duration with a unit.
+func parseTimingDuration(s string) (time.Duration, bool) {
+	if ms, err := strconv.ParseFloat(s, 64); err == nil && ms >= 0 {
+		return time.Duration(ms * float64(time.Millisecond)), true
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return d, true
+	}
+	return 0, false
+}
+
+// splitUnquoted splits s at each sep that isn't in a quoted string, since
+// descriptions may contain separators, e.g. desc="a, b".
+func splitUnquoted(s string, sep byte) []string {
+	var (
+		parts  []string
+		start  int
+		quoted bool
+	)
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// serverTime returns the server's total time for the metrics of a response.
+func serverTime(metrics []serverTimingMetric) time.Duration {
+	var sum time.Duration
+	for _, m := range metrics {
+		if strings.EqualFold(m.name, serverTimingTotal) {
+			return m.dur
+		}
+		sum += m.dur
+	}
+	return sum
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yarpc/yab/statsd"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseServerTiming(t *testing.T) {
+	tests := []struct {
+		msg     string
+		headers map[string]string
+		header  string
+		want    []serverTimingMetric
+	}{
+		{
+			msg:     "no header",
+			headers: map[string]string{"Content-Type": "application/json"},
+			header:  "Server-Timing",
+		},
+		{
+			msg:     "metrics",
+			headers: map[string]string{"Server-Timing": "db;dur=12.5, app;dur=40"},
+			header:  "Server-Timing",
+			want: []serverTimingMetric{
+				{"db", 12500 * time.Microsecond},
+				{"app", 40 * time.Millisecond},
+			},
+		},
+		{
+			msg:     "header names are case insensitive",
+			headers: map[string]string{"server-timing": "db;dur=1"},
+			header:  "Server-Timing",
+			want:    []serverTimingMetric{{"db", time.Millisecond}},
+		},
+		{
+			msg:     "descriptions and metrics without durations",
+			headers: map[string]string{"Server-Timing": `cache;desc="hit, warm", db;desc="a;b";dur=3, miss, app;dur=oops`},
+			header:  "Server-Timing",
+			want:    []serverTimingMetric{{"db", 3 * time.Millisecond}},
+		},
+		{
+			msg:     "quoted duration",
+			headers: map[string]string{"Server-Timing": `total;DUR="7"`},
+			header:  "Server-Timing",
+			want:    []serverTimingMetric{{"total", 7 * time.Millisecond}},
+		},
+		{
+			msg:     "milliseconds only",
+			headers: map[string]string{"X-Envoy-Upstream-Service-Time": "25"},
+			header:  "x-envoy-upstream-service-time",
+			want:    []serverTimingMetric{{"total", 25 * time.Millisecond}},
+		},
+		{
+			msg:     "duration with unit",
+			headers: map[string]string{"X-Server-Time": "1.5s"},
+			header:  "X-Server-Time",
+			want:    []serverTimingMetric{{"total", 1500 * time.Millisecond}},
+		},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, parseServerTiming(tt.headers, tt.header), tt.msg)
+	}
+}
+
+func TestServerTime(t *testing.T) {
+	assert.Equal(t, time.Duration(0), serverTime(nil), "no metrics")
+	assert.Equal(t, 30*time.Millisecond, serverTime([]serverTimingMetric{
+		{"db", 10 * time.Millisecond},
+		{"app", 20 * time.Millisecond},
+	}), "metrics are summed")
+	assert.Equal(t, 25*time.Millisecond, serverTime([]serverTimingMetric{
+		{"db", 10 * time.Millisecond},
+		{"Total", 25 * time.Millisecond},
+	}), "total is used")
+}
+
+func TestServerTimingResultsExport(t *testing.T) {
+	// Server timings are reported to the statter, but exported results and
+	// SLOs should only see the request latencies.
+	shard := &resultsShard{Client: statsd.Noop}
+	state := newBenchmarkState(shard)
+	for i := 0; i < 3; i++ {
+		state.recordLatency(100 * time.Millisecond)
+		state.recordServerTiming([]serverTimingMetric{{"app", 20 * time.Millisecond}}, 100*time.Millisecond)
+	}
+
+	latencies, errors, throttled := shard.drain()
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 100 * time.Millisecond, 100 * time.Millisecond}, latencies,
+		"Server and network timings should not be exported as latencies")
+	assert.Equal(t, 0, errors+throttled, "Unexpected errors")
+
+	point := newResultPoint(time.Now(), resultsSample, "target", latencies, errors, throttled, time.Second)
+	assert.Equal(t, 3, point.requests, "Each request should be counted once")
+	assert.Equal(t, 100*time.Millisecond, point.p50, "Unexpected p50")
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"time"
+
+	"github.com/yarpc/yab/transport"
+
+	"golang.org/x/net/context"
+)
+
+// simTransport wraps a transport to simulate a slower network by adding
+// latency and limiting bandwidth for each call.
+type simTransport struct {
+	transport.Transport
+
+	latency   time.Duration
+	bandwidth byteSize
+}
+
+// newSimTransport returns a transport that simulates the network conditions
+// in opts, or t if no simulation is configured.
+func newSimTransport(t transport.Transport, opts TransportOptions) transport.Transport {
+	if opts.SimLatency <= 0 && opts.SimBandwidth <= 0 {
+		return t
+	}
+
+	return &simTransport{
+		Transport: t,
+		latency:   opts.SimLatency,
+		bandwidth: opts.SimBandwidth,
+	}
+}
+
+// transferTime returns how long it takes to transfer n bytes.
+func (t *simTransport) transferTime(n int) time.Duration {
+	if t.bandwidth <= 0 {
+		return 0
+	}
+	return time.Duration(int64(n) * int64(time.Second) / int64(t.bandwidth))
+}
+
+func (t *simTransport) Call(ctx context.Context, r *transport.Request) (*transport.Response, error) {
+	if err := sleepContext(ctx, t.latency+t.transferTime(len(r.Body))); err != nil {
+		return nil, err
+	}
+
+	res, err := t.Transport.Call(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := sleepContext(ctx, t.transferTime(len(res.Body))); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// sleepContext sleeps for d, returning early with an error if ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
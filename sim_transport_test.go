@@ -0,0 +1,98 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yarpc/yab/transport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+type fakeTransport struct {
+	res *transport.Response
+	err error
+}
+
+func (t fakeTransport) Call(ctx context.Context, r *transport.Request) (*transport.Response, error) {
+	return t.res, t.err
+}
+
+func TestNewSimTransportDisabled(t *testing.T) {
+	underlying := fakeTransport{}
+	assert.Equal(t, underlying, newSimTransport(underlying, TransportOptions{}), "Expected transport to be unchanged")
+}
+
+func TestSimTransport(t *testing.T) {
+	tests := []struct {
+		opts    TransportOptions
+		reqSize int
+		resSize int
+		minTime time.Duration
+	}{
+		{
+			opts:    TransportOptions{SimLatency: 20 * time.Millisecond},
+			minTime: 20 * time.Millisecond,
+		},
+		{
+			opts:    TransportOptions{SimBandwidth: 1000},
+			reqSize: 10,
+			resSize: 20,
+			minTime: 30 * time.Millisecond,
+		},
+		{
+			opts:    TransportOptions{SimLatency: 10 * time.Millisecond, SimBandwidth: 1000},
+			reqSize: 10,
+			minTime: 20 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		sim := newSimTransport(fakeTransport{
+			res: &transport.Response{Body: make([]byte, tt.resSize)},
+		}, tt.opts)
+
+		started := time.Now()
+		_, err := sim.Call(context.Background(), &transport.Request{Body: make([]byte, tt.reqSize)})
+		require.NoError(t, err, "Call failed for %+v", tt.opts)
+		assert.True(t, time.Since(started) >= tt.minTime, "Call with %+v should take at least %v", tt.opts, tt.minTime)
+	}
+}
+
+func TestSimTransportErrors(t *testing.T) {
+	sim := newSimTransport(fakeTransport{err: errors.New("call failed")}, TransportOptions{SimLatency: time.Millisecond})
+	_, err := sim.Call(context.Background(), &transport.Request{})
+	assert.EqualError(t, err, "call failed", "Unexpected error")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	sim = newSimTransport(fakeTransport{}, TransportOptions{SimLatency: time.Second})
+	started := time.Now()
+	_, err = sim.Call(ctx, &transport.Request{})
+	assert.Equal(t, context.DeadlineExceeded, err, "Expected simulated latency to respect the deadline")
+	assert.True(t, time.Since(started) < time.Second, "Simulated latency should stop at the deadline")
+}
@@ -0,0 +1,363 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sloActionTimeout is the timeout for running the --on-threshold-breach
+// command or webhook.
+const sloActionTimeout = 10 * time.Second
+
+// sloExpr matches an SLO threshold, such as p99 < 500ms.
+var sloExpr = regexp.MustCompile(`^\s*([a-z0-9-]+)\s*(<=|<)\s*(.+?)\s*$`)
+
+// sloThreshold is a limit on a metric of each per-second sample.
+type sloThreshold struct {
+	expr      string
+	metric    string
+	limit     float64
+	inclusive bool
+}
+
+// parseSLOs parses expressions of the form METRIC < VALUE, where METRIC is
+// p50, p90, p99 or max with a duration VALUE, or error-rate with a
+// percentage VALUE.
+func parseSLOs(exprs []string) ([]sloThreshold, error) {
+	slos := make([]sloThreshold, len(exprs))
+	for i, expr := range exprs {
+		m := sloExpr.FindStringSubmatch(expr)
+		if m == nil {
+			return nil, fmt.Errorf("invalid SLO %q, expected METRIC<VALUE, e.g. p99<500ms", expr)
+		}
+
+		slo := sloThreshold{expr: expr, metric: m[1], inclusive: m[2] == "<="}
+		switch slo.metric {
+		case "p50", "p90", "p99", "max":
+			d, err := time.ParseDuration(m[3])
+			if err != nil {
+				return nil, fmt.Errorf("invalid SLO %q, the value must be a duration: %v", expr, err)
+			}
+			slo.limit = float64(d)
+		case "error-rate":
+			pct, err := strconv.ParseFloat(strings.TrimSuffix(m[3], "%"), 64)
+			if err != nil || pct < 0 || pct > 100 {
+				return nil, fmt.Errorf("invalid SLO %q, the value must be a percentage, e.g. 1%%", expr)
+			}
+			slo.limit = pct
+		default:
+			return nil, fmt.Errorf("invalid SLO %q, the metric must be p50, p90, p99, max or error-rate", expr)
+		}
+		slos[i] = slo
+	}
+	return slos, nil
+}
+
+// value returns the metric of the point, and false if the point has no
+// results for the metric.
+func (s sloThreshold) value(p resultPoint) (float64, bool) {
+	if s.metric == "error-rate" {
+		total := p.requests + p.errors
+		if total == 0 {
+			return 0, false
+		}
+		return 100 * float64(p.errors) / float64(total), true
+	}
+
+	if p.requests == 0 {
+		return 0, false
+	}
+	switch s.metric {
+	case "p50":
+		return float64(p.p50), true
+	case "p90":
+		return float64(p.p90), true
+	case "p99":
+		return float64(p.p99), true
+	default:
+		return float64(p.max), true
+	}
+}
+
+func (s sloThreshold) breached(v float64) bool {
+	if s.inclusive {
+		return v > s.limit
+	}
+	return v >= s.limit
+}
+
+func (s sloThreshold) format(v float64) string {
+	if s.metric == "error-rate" {
+		return strconv.FormatFloat(v, 'f', 2, 64) + "%"
+	}
+	return time.Duration(v).String()
+}
+
+// threshold returns the limit with its comparison, such as < 500ms.
+func (s sloThreshold) threshold() string {
+	if s.inclusive {
+		return "<= " + s.format(s.limit)
+	}
+	return "< " + s.format(s.limit)
+}
+
+// sloBreach is the first sample of a target that exceeded an SLO.
+type sloBreach struct {
+	Run     time.Time `json:"run"`
+	Time    time.Time `json:"time"`
+	Elapsed string    `json:"elapsed"`
+	Target  string    `json:"target"`
+	SLO     string    `json:"slo"`
+	Value   string    `json:"value"`
+	Aborted bool      `json:"aborted"`
+}
+
+func (b sloBreach) String() string {
+	return fmt.Sprintf("%v: %v was %v after %v", b.Target, b.SLO, b.Value, b.Elapsed)
+}
+
+// sloMonitor checks each per-second sample against the SLOs, and when a
+// target first exceeds an SLO, runs the breach action, and optionally aborts
+// the benchmark, so a load test that is hurting a service can trigger
+// automation immediately.
+type sloMonitor struct {
+	slos   []sloThreshold
+	action string
+	logger *logger
+
+	// abort stops the benchmark, if set.
+	abort func()
+
+	mu       sync.Mutex
+	breaches []sloBreach
+	seen     map[string]bool
+
+	// observed is the worst sample of each target's SLOs, or the target's
+	// summary if there were no samples, keyed like seen.
+	observed map[string]float64
+}
+
+func newSLOMonitor(opts BenchmarkOptions, logger *logger) (*sloMonitor, error) {
+	slos, err := parseSLOs(opts.SLO)
+	if err != nil {
+		return nil, err
+	}
+	if len(slos) == 0 {
+		if opts.OnThresholdBreach != "" || opts.AbortOnBreach {
+			return nil, fmt.Errorf("--on-threshold-breach and --abort-on-breach require --slo")
+		}
+		return nil, nil
+	}
+
+	return &sloMonitor{
+		slos:     slos,
+		action:   opts.OnThresholdBreach,
+		logger:   logger,
+		seen:     make(map[string]bool),
+		observed: make(map[string]float64),
+	}, nil
+}
+
+func (m *sloMonitor) write(run time.Time, points []resultPoint) error {
+	var breaches []sloBreach
+	m.mu.Lock()
+	for _, p := range points {
+		if p.kind != resultsSample && p.kind != resultsSummary {
+			continue
+		}
+		for _, slo := range m.slos {
+			v, ok := slo.value(p)
+			if !ok {
+				continue
+			}
+			key := p.target + "\x00" + slo.expr
+			m.observe(key, p.kind, v)
+			if p.kind != resultsSample || !slo.breached(v) || m.seen[key] {
+				continue
+			}
+
+			m.seen[key] = true
+			breaches = append(breaches, sloBreach{
+				Run:     run,
+				Time:    p.time,
+				Elapsed: (p.time.Sub(run) / time.Second * time.Second).String(),
+				Target:  p.target,
+				SLO:     slo.expr,
+				Value:   slo.format(v),
+				Aborted: m.abort != nil,
+			})
+		}
+	}
+	m.breaches = append(m.breaches, breaches...)
+	m.mu.Unlock()
+
+	if len(breaches) == 0 {
+		return nil
+	}
+
+	// Stop sending load before running the action, which may be slow.
+	if m.abort != nil {
+		m.abort()
+	}
+	for _, b := range breaches {
+		m.logger.Warnf("SLO breached by %v", b)
+		if m.action == "" {
+			continue
+		}
+		if err := runSLOAction(m.action, b); err != nil {
+			m.logger.Warnf("--on-threshold-breach failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// observe records the value of an SLO. Samples keep the worst value, and
+// summaries are only used if there were no samples. It must be called with
+// m.mu held.
+func (m *sloMonitor) observe(key, kind string, v float64) {
+	old, ok := m.observed[key]
+	if !ok || (kind == resultsSample && v > old) {
+		m.observed[key] = v
+	}
+}
+
+// junitCases returns a test case for each SLO of the target, with the worst
+// value observed and the threshold, which fails if the SLO was breached.
+func (m *sloMonitor) junitCases(target benchmarkTarget, total time.Duration) []junitCase {
+	if m == nil {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cases := make([]junitCase, len(m.slos))
+	for i, slo := range m.slos {
+		tc := junitCase{Name: target.name + ": SLO " + slo.expr, Classname: target.tOpts.ServiceName, Time: total.Seconds()}
+		v, ok := m.observed[target.name+"\x00"+slo.expr]
+		if !ok {
+			tc.Skipped = &struct{}{}
+			cases[i] = tc
+			continue
+		}
+
+		result := fmt.Sprintf("%v was %v, the threshold is %v", slo.metric, slo.format(v), slo.threshold())
+		tc.SystemOut = result
+		if slo.breached(v) {
+			tc.Failure = &junitFailure{Message: result}
+		}
+		cases[i] = tc
+	}
+	return cases
+}
+
+func (m *sloMonitor) Close() error {
+	return nil
+}
+
+// print prints the SLO breaches, if any.
+func (m *sloMonitor) print(out output) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.breaches) == 0 {
+		return
+	}
+
+	out.Printf("SLO breaches:\n")
+	for _, b := range m.breaches {
+		out.Printf("  %v\n", b)
+	}
+	if m.abort != nil {
+		out.Printf("The benchmark was aborted after the first breach.\n")
+	}
+	out.Printf("\n")
+}
+
+// runSLOAction POSTs the breach as JSON to a http(s) URL, or otherwise runs
+// the action as a shell command, with the breach in environment variables.
+func runSLOAction(action string, b sloBreach) error {
+	if strings.HasPrefix(action, "http://") || strings.HasPrefix(action, "https://") {
+		body, err := json.Marshal(b)
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequest("POST", action, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		client := &http.Client{Timeout: sloActionTimeout}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+			return fmt.Errorf("webhook failed with %v: %s", resp.Status, bytes.TrimSpace(body))
+		}
+		return nil
+	}
+
+	cmd := exec.Command("sh", "-c", action)
+	cmd.Env = append(os.Environ(),
+		"YAB_BREACH_TARGET="+b.Target,
+		"YAB_BREACH_SLO="+b.SLO,
+		"YAB_BREACH_VALUE="+b.Value,
+		"YAB_BREACH_ELAPSED="+b.Elapsed,
+		"YAB_BREACH_TIME="+b.Time.UTC().Format(time.RFC3339),
+		"YAB_BREACH_ABORTED="+strconv.FormatBool(b.Aborted),
+	)
+	out := &bytes.Buffer{}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// Kill the command if it takes too long, so it can't block the results.
+	timer := time.AfterFunc(sloActionTimeout, func() { cmd.Process.Kill() })
+	defer timer.Stop()
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("%v: %s", err, bytes.TrimSpace(out.Bytes()))
+	}
+	return nil
+}
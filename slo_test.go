@@ -0,0 +1,202 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSLOs(t *testing.T) {
+	tests := []struct {
+		expr      string
+		metric    string
+		limit     float64
+		inclusive bool
+		wantErr   string
+	}{
+		{expr: "p99<500ms", metric: "p99", limit: float64(500 * time.Millisecond)},
+		{expr: " max <= 2s ", metric: "max", limit: float64(2 * time.Second), inclusive: true},
+		{expr: "error-rate<1%", metric: "error-rate", limit: 1},
+		{expr: "error-rate < 0.5", metric: "error-rate", limit: 0.5},
+		{expr: "p99>500ms", wantErr: "expected METRIC<VALUE"},
+		{expr: "p95<500ms", wantErr: "the metric must be"},
+		{expr: "p99<500", wantErr: "must be a duration"},
+		{expr: "error-rate<150%", wantErr: "must be a percentage"},
+	}
+
+	for _, tt := range tests {
+		slos, err := parseSLOs([]string{tt.expr})
+		if tt.wantErr != "" {
+			if assert.Error(t, err, "Expected error for %q", tt.expr) {
+				assert.Contains(t, err.Error(), tt.wantErr, "Unexpected error for %q", tt.expr)
+			}
+			continue
+		}
+
+		require.NoError(t, err, "Failed to parse %q", tt.expr)
+		assert.Equal(t, []sloThreshold{{expr: tt.expr, metric: tt.metric, limit: tt.limit, inclusive: tt.inclusive}}, slos, "Unexpected SLO for %q", tt.expr)
+	}
+}
+
+func TestSLOThresholdBreached(t *testing.T) {
+	slos, err := parseSLOs([]string{"p99<500ms", "max<=1s", "error-rate<10%"})
+	require.NoError(t, err, "Failed to parse SLOs")
+	p99, max, errorRate := slos[0], slos[1], slos[2]
+
+	tests := []struct {
+		msg   string
+		slo   sloThreshold
+		point resultPoint
+		want  string
+	}{
+		{"under", p99, resultPoint{requests: 10, p99: 499 * time.Millisecond}, ""},
+		{"at exclusive limit", p99, resultPoint{requests: 10, p99: 500 * time.Millisecond}, "500ms"},
+		{"at inclusive limit", max, resultPoint{requests: 10, max: time.Second}, ""},
+		{"over inclusive limit", max, resultPoint{requests: 10, max: 1500 * time.Millisecond}, "1.5s"},
+		{"no requests", p99, resultPoint{errors: 10}, ""},
+		{"error rate", errorRate, resultPoint{requests: 3, errors: 1}, "25.00%"},
+		{"no errors", errorRate, resultPoint{requests: 3}, ""},
+		{"no results", errorRate, resultPoint{}, ""},
+	}
+
+	for _, tt := range tests {
+		v, ok := tt.slo.value(tt.point)
+		if tt.want == "" {
+			assert.False(t, ok && tt.slo.breached(v), "%v: unexpected breach", tt.msg)
+			continue
+		}
+		if assert.True(t, ok && tt.slo.breached(v), "%v: expected breach", tt.msg) {
+			assert.Equal(t, tt.want, tt.slo.format(v), "%v: unexpected value", tt.msg)
+		}
+	}
+}
+
+func TestNewSLOMonitor(t *testing.T) {
+	m, err := newSLOMonitor(BenchmarkOptions{}, nil)
+	assert.NoError(t, err, "Expected no error without SLOs")
+	assert.Nil(t, m, "Expected no monitor without SLOs")
+
+	_, err = newSLOMonitor(BenchmarkOptions{AbortOnBreach: true}, nil)
+	assert.Error(t, err, "Expected --abort-on-breach to require --slo")
+
+	_, err = newSLOMonitor(BenchmarkOptions{OnThresholdBreach: "true"}, nil)
+	assert.Error(t, err, "Expected --on-threshold-breach to require --slo")
+
+	_, err = newSLOMonitor(BenchmarkOptions{SLO: []string{"p99"}}, nil)
+	assert.Error(t, err, "Expected invalid SLO to fail")
+}
+
+func TestSLOMonitorWebhook(t *testing.T) {
+	breaches := make(chan sloBreach, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"), "Unexpected content type")
+
+		var b sloBreach
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&b), "Failed to decode breach")
+		breaches <- b
+	}))
+	defer server.Close()
+
+	buf, out := getOutput(t)
+	m, err := newSLOMonitor(BenchmarkOptions{
+		SLO:               []string{"p99<100ms", "error-rate<5%"},
+		OnThresholdBreach: server.URL,
+	}, newLogger(Options{}, out))
+	require.NoError(t, err, "Failed to create SLO monitor")
+
+	aborted := 0
+	m.abort = func() { aborted++ }
+
+	run := time.Unix(1500000000, 0).UTC()
+	samples := [][]resultPoint{
+		{{time: run.Add(time.Second), kind: resultsSample, target: "foo", requests: 10, p99: 50 * time.Millisecond}},
+		{{time: run.Add(2 * time.Second), kind: resultsSample, target: "foo", requests: 10, p99: 150 * time.Millisecond}},
+		{{time: run.Add(3 * time.Second), kind: resultsSample, target: "foo", requests: 10, p99: 200 * time.Millisecond}},
+		{{time: run.Add(4 * time.Second), kind: resultsSummary, target: "foo", requests: 10, errors: 10}},
+	}
+	for _, points := range samples {
+		require.NoError(t, m.write(run, points), "Failed to write points")
+	}
+	close(breaches)
+
+	var got []sloBreach
+	for b := range breaches {
+		got = append(got, b)
+	}
+	assert.Equal(t, []sloBreach{{
+		Run:     run,
+		Time:    run.Add(2 * time.Second),
+		Elapsed: "2s",
+		Target:  "foo",
+		SLO:     "p99<100ms",
+		Value:   "150ms",
+		Aborted: true,
+	}}, got, "Expected a single breach for the first sample over the SLO")
+	assert.Equal(t, 1, aborted, "Expected the benchmark to be aborted once")
+	assert.Contains(t, buf.String(), "Warning: SLO breached by foo: p99<100ms was 150ms after 2s", "Expected breach to be logged")
+
+	buf.Reset()
+	m.print(out)
+	assert.Contains(t, buf.String(), "SLO breaches:\n  foo: p99<100ms was 150ms after 2s\n", "Unexpected breaches")
+	assert.Contains(t, buf.String(), "aborted", "Expected abort to be reported")
+}
+
+func TestSLOMonitorCommand(t *testing.T) {
+	f, err := ioutil.TempFile("", "slo")
+	require.NoError(t, err, "TempFile failed")
+	f.Close()
+	defer os.Remove(f.Name())
+
+	buf, out := getOutput(t)
+	m, err := newSLOMonitor(BenchmarkOptions{
+		SLO:               []string{"error-rate<1%"},
+		OnThresholdBreach: `echo "$YAB_BREACH_TARGET $YAB_BREACH_SLO $YAB_BREACH_VALUE $YAB_BREACH_ABORTED" >> ` + f.Name(),
+	}, newLogger(Options{}, out))
+	require.NoError(t, err, "Failed to create SLO monitor")
+
+	run := time.Now()
+	require.NoError(t, m.write(run, []resultPoint{
+		{time: run.Add(time.Second), kind: resultsSample, target: "foo", requests: 9, errors: 1},
+		{time: run.Add(time.Second), kind: resultsSample, target: "bar", requests: 10},
+	}), "Failed to write points")
+
+	contents, err := ioutil.ReadFile(f.Name())
+	require.NoError(t, err, "Failed to read command output")
+	assert.Equal(t, "foo error-rate<1% 10.00% false\n", string(contents), "Unexpected command output")
+	assert.Contains(t, buf.String(), "SLO breached by foo", "Expected breach to be logged")
+	assert.NotContains(t, buf.String(), "failed", "Unexpected command failure")
+
+	m.action = "exit 3"
+	m.seen = make(map[string]bool)
+	require.NoError(t, m.write(run, []resultPoint{
+		{time: run.Add(2 * time.Second), kind: resultsSample, target: "foo", requests: 0, errors: 1},
+	}), "Failed to write points")
+	assert.Contains(t, buf.String(), "--on-threshold-breach failed: exit status 3", "Expected command failure to be logged")
+}
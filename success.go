@@ -0,0 +1,267 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/yarpc/yab/encoding"
+	"github.com/yarpc/yab/transport"
+)
+
+// successExpr matches a success criterion, such as body.result.status == "OK".
+var successExpr = regexp.MustCompile(`^\s*([^\s=!<>]+)\s*(==|!=|<=|>=|<|>)\s*(.+?)\s*$`)
+
+// successCriterion compares a field of the decoded response to a value, so
+// business-level failures that are returned as successful responses can be
+// counted as errors.
+type successCriterion struct {
+	expr  string
+	path  []string
+	op    string
+	value interface{}
+}
+
+// parseSuccessCriteria parses expressions of the form PATH OP VALUE, where
+// PATH is a dotted path starting with body or headers, OP is one of
+// ==, !=, <, <=, >, >=, and VALUE is a JSON string, number, bool or null.
+func parseSuccessCriteria(exprs []string) ([]successCriterion, error) {
+	criteria := make([]successCriterion, len(exprs))
+	for i, expr := range exprs {
+		m := successExpr.FindStringSubmatch(expr)
+		if m == nil {
+			return nil, fmt.Errorf("invalid success criterion %q, expected PATH OP VALUE, e.g. body.result.status == \"OK\"", expr)
+		}
+
+		path := strings.Split(m[1], ".")
+		if path[0] != "body" && path[0] != "headers" {
+			return nil, fmt.Errorf("invalid success criterion %q, the path must start with body or headers", expr)
+		}
+
+		value, err := parseSuccessValue(m[3])
+		if err != nil {
+			return nil, fmt.Errorf("invalid success criterion %q, the value must be a JSON string, number, bool or null: %v", expr, err)
+		}
+
+		op := m[2]
+		_, isNumber := value.(json.Number)
+		_, isString := value.(string)
+		if op != "==" && op != "!=" && !isNumber && !isString {
+			return nil, fmt.Errorf("invalid success criterion %q, %v can only compare numbers or strings", expr, op)
+		}
+
+		criteria[i] = successCriterion{expr: expr, path: path, op: op, value: value}
+	}
+	return criteria, nil
+}
+
+// parseSuccessValue parses a JSON value, keeping numbers as json.Number so
+// large integers don't lose precision.
+func parseSuccessValue(s string) (interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after the value")
+	}
+	return value, nil
+}
+
+// checkSuccessCriteria decodes the response, and returns an error for the
+// first criterion that is not met.
+func checkSuccessCriteria(criteria []successCriterion, serializer encoding.Serializer, res *transport.Response) error {
+	body, err := serializer.Response(res)
+	if err != nil {
+		return err
+	}
+
+	doc := map[string]interface{}{
+		"body":    body,
+		"headers": res.Headers,
+	}
+	for _, c := range criteria {
+		if err := c.check(doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c successCriterion) check(doc map[string]interface{}) error {
+	got, ok := lookupPath(doc, c.path)
+	if !ok {
+		return fmt.Errorf("success criterion %v not met: %v is not set", c.expr, strings.Join(c.path, "."))
+	}
+	if !c.compare(got) {
+		return fmt.Errorf("success criterion %v not met: got %v", c.expr, formatSuccessValue(got))
+	}
+	return nil
+}
+
+func (c successCriterion) compare(got interface{}) bool {
+	switch want := c.value.(type) {
+	case json.Number:
+		// Integers are compared as int64 when both sides are integers, since
+		// float64 can't represent every int64, such as IDs above 2^53.
+		if wantInt, err := want.Int64(); err == nil {
+			if n, ok := toInt(got); ok {
+				return compareOrdered(c.op, n < wantInt, n == wantInt)
+			}
+		}
+
+		wantFloat, err := want.Float64()
+		if err != nil {
+			return c.op == "!="
+		}
+		n, ok := toFloat(got)
+		if !ok {
+			return c.op == "!="
+		}
+		return compareOrdered(c.op, n < wantFloat, n == wantFloat)
+	case string:
+		s, ok := got.(string)
+		if !ok {
+			return c.op == "!="
+		}
+		return compareOrdered(c.op, s < want, s == want)
+	}
+
+	equal := reflect.DeepEqual(got, c.value)
+	if c.op == "!=" {
+		return !equal
+	}
+	return equal
+}
+
+func compareOrdered(op string, less, equal bool) bool {
+	switch op {
+	case "==":
+		return equal
+	case "!=":
+		return !equal
+	case "<":
+		return less
+	case "<=":
+		return less || equal
+	case ">":
+		return !less && !equal
+	default: // ">="
+		return !less
+	}
+}
+
+// lookupPath returns the value at the dotted path, where list elements are
+// selected using their index.
+func lookupPath(v interface{}, path []string) (interface{}, bool) {
+	for _, key := range path {
+		rv := reflect.ValueOf(v)
+		switch rv.Kind() {
+		case reflect.Map:
+			if rv.Type().Key().Kind() != reflect.String {
+				return nil, false
+			}
+			elem := rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key()))
+			if !elem.IsValid() {
+				return nil, false
+			}
+			v = elem.Interface()
+		case reflect.Slice, reflect.Array:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= rv.Len() {
+				return nil, false
+			}
+			v = rv.Index(i).Interface()
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// toInt converts integers, including integers decoded from JSON and integer
+// strings such as headers, to an int64.
+func toInt(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case json.Number:
+		n, err := v.Int64()
+		return n, err == nil
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		return n, err == nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if u := rv.Uint(); u <= math.MaxInt64 {
+			return int64(u), true
+		}
+	}
+	return 0, false
+}
+
+// toFloat converts numbers, including numbers decoded from JSON and numeric
+// strings such as headers, to a float64.
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case json.Number:
+		// JSON responses are decoded using UseNumber.
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		// Headers are strings, but can be compared to numbers.
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// formatSuccessValue formats a value as JSON, so strings are quoted.
+func formatSuccessValue(v interface{}) string {
+	if bs, err := json.Marshal(v); err == nil {
+		return string(bs)
+	}
+	return fmt.Sprint(v)
+}
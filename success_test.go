@@ -0,0 +1,268 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yarpc/yab/encoding"
+	"github.com/yarpc/yab/transport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel-go/raw"
+	"golang.org/x/net/context"
+)
+
+func TestParseSuccessCriteria(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    successCriterion
+		wantErr string
+	}{
+		{
+			expr: `body.result.status == "OK"`,
+			want: successCriterion{path: []string{"body", "result", "status"}, op: "==", value: "OK"},
+		},
+		{
+			expr: `headers.retry!=true`,
+			want: successCriterion{path: []string{"headers", "retry"}, op: "!=", value: true},
+		},
+		{
+			expr: ` body.items.0.count >= 10 `,
+			want: successCriterion{path: []string{"body", "items", "0", "count"}, op: ">=", value: json.Number("10")},
+		},
+		{
+			expr: `body.error == null`,
+			want: successCriterion{path: []string{"body", "error"}, op: "=="},
+		},
+		{
+			expr:    `body.status`,
+			wantErr: "expected PATH OP VALUE",
+		},
+		{
+			expr:    `result.status == "OK"`,
+			wantErr: "the path must start with body or headers",
+		},
+		{
+			expr:    `body.status == OK`,
+			wantErr: "the value must be a JSON string, number, bool or null",
+		},
+		{
+			expr:    `body.ok < true`,
+			wantErr: "< can only compare numbers or strings",
+		},
+		{
+			expr:    `body.count == 1 2`,
+			wantErr: "unexpected data after the value",
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := parseSuccessCriteria([]string{tt.expr})
+		if tt.wantErr != "" {
+			if assert.Error(t, err, "%v: expected error", tt.expr) {
+				assert.Contains(t, err.Error(), tt.wantErr, "%v: unexpected error", tt.expr)
+			}
+			continue
+		}
+
+		require.NoError(t, err, "%v: failed to parse", tt.expr)
+		tt.want.expr = tt.expr
+		assert.Equal(t, []successCriterion{tt.want}, got, "%v: unexpected criterion", tt.expr)
+	}
+}
+
+func TestSuccessCriterionCheck(t *testing.T) {
+	doc := map[string]interface{}{
+		"body": map[string]interface{}{
+			"status": "OK",
+			"count":  int32(5),
+			"ratio":  0.5,
+			"ok":     true,
+			"items":  []interface{}{map[string]interface{}{"id": int64(7)}},
+			"bigID":  int64(9007199254740993),
+			"jsonID": json.Number("9007199254740993"),
+			"error":  nil,
+		},
+		"headers": map[string]string{"region": "us-east"},
+	}
+
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{expr: `body.status == "OK"`},
+		{expr: `body.status != "FAILED"`},
+		{expr: `body.status < "P"`},
+		{expr: `body.count == 5`},
+		{expr: `body.count > 4`},
+		{expr: `body.count <= 5`},
+		{expr: `body.ratio < 1`},
+		{expr: `body.ok == true`},
+		{expr: `body.items.0.id == 7`},
+		{expr: `body.error == null`},
+		{expr: `headers.region == "us-east"`},
+		{expr: `body.status != 5`},
+		{expr: `body.bigID == 9007199254740993`},
+		{expr: `body.bigID != 9007199254740992`},
+		{expr: `body.bigID > 9007199254740992`},
+		{expr: `body.jsonID == 9007199254740993`},
+		{expr: `body.jsonID != 9007199254740992`},
+		{expr: `body.ratio > 0.25`},
+		{
+			expr:    `body.status == "FAILED"`,
+			wantErr: `success criterion body.status == "FAILED" not met: got "OK"`,
+		},
+		{
+			expr:    `body.bigID == 9007199254740992`,
+			wantErr: `success criterion body.bigID == 9007199254740992 not met: got 9007199254740993`,
+		},
+		{
+			expr:    `body.count > 5`,
+			wantErr: `success criterion body.count > 5 not met: got 5`,
+		},
+		{
+			expr:    `body.count == "5"`,
+			wantErr: `success criterion body.count == "5" not met: got 5`,
+		},
+		{
+			expr:    `body.missing == 1`,
+			wantErr: `success criterion body.missing == 1 not met: body.missing is not set`,
+		},
+		{
+			expr:    `body.items.1.id == 7`,
+			wantErr: `success criterion body.items.1.id == 7 not met: body.items.1.id is not set`,
+		},
+		{
+			expr:    `body.status.code == 1`,
+			wantErr: `success criterion body.status.code == 1 not met: body.status.code is not set`,
+		},
+	}
+
+	for _, tt := range tests {
+		criteria, err := parseSuccessCriteria([]string{tt.expr})
+		require.NoError(t, err, "%v: failed to parse", tt.expr)
+
+		err = criteria[0].check(doc)
+		if tt.wantErr != "" {
+			assert.EqualError(t, err, tt.wantErr, "%v: unexpected error", tt.expr)
+			continue
+		}
+		assert.NoError(t, err, "%v: unexpected error", tt.expr)
+	}
+}
+
+func TestBenchmarkSuccessCriteria(t *testing.T) {
+	var requests int32
+	s := newServer(t)
+	defer s.shutdown()
+	s.register("echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		// Every other request fails with a successful response.
+		status := `{"status": "OK"}`
+		if atomic.AddInt32(&requests, 1)%2 == 0 {
+			status = `{"status": "FAILED"}`
+		}
+		return &raw.Res{Arg2: args.Arg2, Arg3: []byte(status)}, nil
+	})
+
+	serializer := encoding.NewJSON("echo")
+	req, err := serializer.Request([]byte("{}"))
+	require.NoError(t, err, "Failed to serialize request")
+	req.Timeout = time.Second
+
+	buf, out := getOutput(t)
+	runBenchmark(out, Options{
+		BOpts: BenchmarkOptions{
+			MaxRequests: 100,
+			MaxDuration: time.Second,
+			Connections: 1,
+			Concurrency: 1,
+			Success:     []string{`body.status == "OK"`},
+		},
+		TOpts: s.transportOpts(),
+	}, benchmarkMethod{serializer: serializer, req: req})
+
+	assert.Contains(t, buf.String(), `Success:         body.status == "OK"`, "Expected success criteria parameters")
+	assert.Contains(t, buf.String(), `50: success criterion body.status == "OK" not met: got "FAILED"`, "Expected failed criteria to be errors")
+}
+
+func TestCheckSuccessCriteriaDecodeError(t *testing.T) {
+	criteria, err := parseSuccessCriteria([]string{`body.status == "OK"`})
+	require.NoError(t, err, "Failed to parse")
+
+	err = checkSuccessCriteria(criteria, encoding.NewJSON("echo"), &transport.Response{Body: []byte("{")})
+	assert.Error(t, err, "Expected error for invalid response")
+}
+
+func TestCheckSuccessCriteriaJSONNumbers(t *testing.T) {
+	res := &transport.Response{
+		Body:    []byte(`{"count": 5, "ratio": 0.5, "id": 12345678901, "bigID": 9007199254740993, "status": "OK"}`),
+		Headers: map[string]string{"x-count": "3", "region": "us-east"},
+	}
+
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{expr: `body.count == 5`},
+		{expr: `body.count >= 5`},
+		{expr: `body.count > 4`},
+		{expr: `body.count < 6`},
+		{expr: `body.ratio <= 0.5`},
+		{expr: `body.id == 12345678901`},
+		{expr: `body.bigID == 9007199254740993`},
+		{expr: `body.bigID != 9007199254740992`},
+		{expr: `headers.x-count < 4`},
+		{expr: `body.status != 5`},
+		{
+			expr:    `body.count != 5`,
+			wantErr: `success criterion body.count != 5 not met: got 5`,
+		},
+		{
+			expr:    `body.count > 5`,
+			wantErr: `success criterion body.count > 5 not met: got 5`,
+		},
+		{
+			expr:    `body.ratio > 1`,
+			wantErr: `success criterion body.ratio > 1 not met: got 0.5`,
+		},
+		{
+			expr:    `headers.region > 1`,
+			wantErr: `success criterion headers.region > 1 not met: got "us-east"`,
+		},
+	}
+
+	for _, tt := range tests {
+		criteria, err := parseSuccessCriteria([]string{tt.expr})
+		require.NoError(t, err, "%v: failed to parse", tt.expr)
+
+		err = checkSuccessCriteria(criteria, encoding.NewJSON("echo"), res)
+		if tt.wantErr != "" {
+			assert.EqualError(t, err, tt.wantErr, "%v: unexpected error", tt.expr)
+			continue
+		}
+		assert.NoError(t, err, "%v: unexpected error", tt.expr)
+	}
+}
@@ -0,0 +1,302 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package thrift
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"time"
+
+	"github.com/thriftrw/thriftrw-go/ast"
+	"github.com/thriftrw/thriftrw-go/compile"
+	"github.com/thriftrw/thriftrw-go/idl"
+	"github.com/thriftrw/thriftrw-go/wire"
+)
+
+// hintFormat is how an annotated value is represented in requests and responses.
+type hintFormat int
+
+const (
+	// hintDate represents an i64 of milliseconds since the epoch as an
+	// RFC 3339 date, like a JavaScript Date.
+	hintDate hintFormat = iota + 1
+
+	// hintLong represents an i64 as a string, so it is not rounded by
+	// clients that use doubles for numbers, like a JavaScript Long.
+	hintLong
+
+	// hintBase64 represents a binary or string as a base64 string.
+	hintBase64
+)
+
+// hint is an annotation that changes how a value is represented.
+type hint struct {
+	format hintFormat
+
+	// name is the annotated field or typedef, and annotation is the
+	// annotation that was used, which are reported when the hint is used.
+	name       string
+	annotation string
+}
+
+// Annotations contains the annotations in a Thrift file and its includes
+// that change how values are represented. js.type = "Date" on an i64 uses
+// RFC 3339 dates for milliseconds since the epoch, js.type = "Long" on an
+// i64 uses strings, and yab.format = "base64" on a binary or string uses
+// base64 strings. Annotations apply to fields, function arguments,
+// exceptions and typedefs.
+type Annotations struct {
+	fields   map[*compile.FieldSpec]*hint
+	typedefs map[*compile.TypedefSpec]*hint
+}
+
+// ParseAnnotations returns the supported annotations in the given module
+// and the modules it includes.
+func ParseAnnotations(module *compile.Module) (*Annotations, error) {
+	a := &Annotations{
+		fields:   make(map[*compile.FieldSpec]*hint),
+		typedefs: make(map[*compile.TypedefSpec]*hint),
+	}
+	if err := a.addModule(module, make(map[string]struct{})); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *Annotations) addModule(module *compile.Module, visited map[string]struct{}) error {
+	if _, ok := visited[module.ThriftPath]; ok {
+		return nil
+	}
+	visited[module.ThriftPath] = struct{}{}
+
+	contents, err := ioutil.ReadFile(module.ThriftPath)
+	if err != nil {
+		return err
+	}
+	program, err := idl.Parse(contents)
+	if err != nil {
+		return fmt.Errorf("could not parse annotations in %v: %v", module.ThriftPath, err)
+	}
+
+	for _, def := range program.Definitions {
+		if err := a.addDefinition(module, def); err != nil {
+			return err
+		}
+	}
+
+	for _, include := range module.Includes {
+		if err := a.addModule(include.Module, visited); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Annotations) addDefinition(module *compile.Module, def ast.Definition) error {
+	switch def := def.(type) {
+	case *ast.Typedef:
+		spec, ok := module.Types[def.Name].(*compile.TypedefSpec)
+		if !ok {
+			return nil
+		}
+		h, err := newHint(def.Name, spec.Target, typeAnnotations(def.Type, def.Annotations))
+		if h != nil {
+			a.typedefs[spec] = h
+		}
+		return err
+	case *ast.Struct:
+		spec, ok := module.Types[def.Name].(*compile.StructSpec)
+		if !ok {
+			return nil
+		}
+		return a.addFields(def.Name, spec.Fields, def.Fields)
+	case *ast.Service:
+		spec, ok := module.Services[def.Name]
+		if !ok {
+			return nil
+		}
+		for _, f := range def.Functions {
+			fSpec, ok := spec.Functions[f.Name]
+			if !ok {
+				continue
+			}
+			name := def.Name + "::" + f.Name
+			if err := a.addFields(name, compile.FieldGroup(fSpec.ArgsSpec), f.Parameters); err != nil {
+				return err
+			}
+			if fSpec.ResultSpec != nil {
+				if err := a.addFields(name, fSpec.ResultSpec.Exceptions, f.Exceptions); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (a *Annotations) addFields(parent string, specs compile.FieldGroup, fields []*ast.Field) error {
+	for _, f := range fields {
+		for _, spec := range specs {
+			if spec.Name != f.Name {
+				continue
+			}
+
+			h, err := newHint(parent+"."+f.Name, spec.Type, typeAnnotations(f.Type, f.Annotations))
+			if err != nil {
+				return err
+			}
+			if h != nil {
+				a.fields[spec] = h
+			}
+		}
+	}
+	return nil
+}
+
+// typeAnnotations returns the annotations of a field or typedef, followed
+// by the annotations of its type.
+func typeAnnotations(t ast.Type, anns []*ast.Annotation) []*ast.Annotation {
+	switch t := t.(type) {
+	case ast.BaseType:
+		return append(anns, t.Annotations...)
+	case *ast.BaseType:
+		return append(anns, t.Annotations...)
+	}
+	return anns
+}
+
+// newHint returns the hint for the first supported annotation of a value
+// with the given type, or nil if there is none.
+func newHint(name string, spec compile.TypeSpec, anns []*ast.Annotation) (*hint, error) {
+	typeCode := resolveTypedef(spec).TypeCode()
+	for _, ann := range anns {
+		h := &hint{name: name, annotation: ann.String()}
+		switch ann.Name {
+		case "js.type":
+			if typeCode != wire.TI64 {
+				continue
+			}
+			switch ann.Value {
+			case "Date":
+				h.format = hintDate
+			case "Long":
+				h.format = hintLong
+			default:
+				continue
+			}
+		case "yab.format":
+			if ann.Value != "base64" {
+				return nil, fmt.Errorf("unsupported annotation %v on %v, the only supported yab.format is base64", ann, name)
+			}
+			if typeCode != wire.TBinary {
+				return nil, fmt.Errorf("unsupported annotation %v on %v, yab.format is only supported for binary and string", ann, name)
+			}
+			h.format = hintBase64
+		default:
+			continue
+		}
+		return h, nil
+	}
+	return nil, nil
+}
+
+// fieldHint returns the hint for the given field's value, using the
+// annotations of the field, or of its typedef.
+func (n *nesting) fieldHint(spec *compile.FieldSpec) *hint {
+	if n.annotations == nil {
+		return nil
+	}
+	if h, ok := n.annotations.fields[spec]; ok {
+		return h
+	}
+	return n.typeHint(spec.Type)
+}
+
+// typeHint returns the hint for values of the given type, using the
+// annotations of the typedef and the typedefs it refers to.
+func (n *nesting) typeHint(spec compile.TypeSpec) *hint {
+	if n.annotations == nil {
+		return nil
+	}
+	for {
+		typedef, ok := spec.(*compile.TypedefSpec)
+		if !ok {
+			return nil
+		}
+		if h, ok := n.annotations.typedefs[typedef]; ok {
+			return h
+		}
+		spec = typedef.Target
+	}
+}
+
+// used reports that the hint changed how a value is represented.
+func (n *nesting) used(h *hint) {
+	if n.annotationUsed != nil {
+		n.annotationUsed(h.name, h.annotation)
+	}
+}
+
+// toWire converts the user's value to the value expected by toWireValue.
+// Values that are not in the annotated representation are unchanged, so
+// the value can always be specified without using the annotation.
+func (h *hint) toWire(n *nesting, value interface{}) (interface{}, error) {
+	s, ok := value.(string)
+	if h == nil || !ok {
+		return value, nil
+	}
+
+	n.used(h)
+	switch h.format {
+	case hintDate:
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse date for %v: %v", h.annotation, err)
+		}
+		return t.UnixNano() / int64(time.Millisecond), nil
+	case hintLong:
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse long for %v: %v", h.annotation, err)
+		}
+		return v, nil
+	case hintBase64:
+		return map[interface{}]interface{}{"base64": s}, nil
+	}
+	return value, nil
+}
+
+// fromWire returns the annotated representation of w, which must have
+// the annotated type.
+func (h *hint) fromWire(n *nesting, w wire.Value) interface{} {
+	n.used(h)
+	switch h.format {
+	case hintDate:
+		return time.Unix(0, w.GetI64()*int64(time.Millisecond)).UTC().Format(time.RFC3339Nano)
+	case hintLong:
+		return strconv.FormatInt(w.GetI64(), 10)
+	case hintBase64:
+		return base64.StdEncoding.EncodeToString(w.GetBinary())
+	}
+	panic(fmt.Sprintf("unknown hint format: %v", h.format))
+}
@@ -0,0 +1,231 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package thrift
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thriftrw/thriftrw-go/compile"
+	"github.com/thriftrw/thriftrw-go/wire"
+)
+
+const annotatedThrift = `
+  include "./types.thrift"
+
+  typedef i64 (js.type = "Date") Timestamp
+  typedef binary Blob (yab.format = "base64")
+
+  struct Event {
+    1: optional Timestamp created
+    2: optional i64 (js.type = "Long") id
+    3: optional string token (yab.format = "base64")
+    4: optional Blob data
+    5: optional i64 count
+    6: optional list<Timestamp> times
+    7: optional types.Counter counter
+  }
+
+  service Test {
+    Event echo(1: Event event, 2: i64 at (js.type = "Date"))
+  }
+`
+
+const annotatedIncludeThrift = `
+  struct Counter {
+    1: optional i64 value (js.type = "Long")
+  }
+`
+
+// parseAnnotated compiles the given Thrift file, along with types.thrift,
+// and returns the module and its annotations.
+func parseAnnotated(t *testing.T, contents string) (*compile.Module, *Annotations, error) {
+	dir, err := ioutil.TempDir("", "annotations")
+	require.NoError(t, err, "TempDir failed")
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "test.thrift")
+	require.NoError(t, ioutil.WriteFile(file, []byte(contents), 0644), "WriteFile failed")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "types.thrift"), []byte(annotatedIncludeThrift), 0644), "WriteFile failed")
+
+	module, err := compile.Compile(file)
+	require.NoError(t, err, "Compile failed")
+
+	annotations, err := ParseAnnotations(module)
+	return module, annotations, err
+}
+
+func TestAnnotationsRequest(t *testing.T) {
+	module, annotations, err := parseAnnotated(t, annotatedThrift)
+	require.NoError(t, err, "ParseAnnotations failed")
+	spec := module.Services["Test"].Functions["echo"]
+
+	used := make(map[string]string)
+	opts := Options{
+		Annotations: annotations,
+		AnnotationUsed: func(name, annotation string) {
+			used[name] = annotation
+		},
+	}
+	got, err := RequestToBytes(spec, map[string]interface{}{
+		"event": map[string]interface{}{
+			"created": "2016-05-01T10:00:00.5Z",
+			"id":      "9007199254740993",
+			"token":   "dG9rZW4=",
+			"data":    "AAEC",
+			"count":   1,
+			"times":   []interface{}{"1970-01-01T00:00:01Z", 2000},
+			"counter": map[string]interface{}{"value": "3"},
+		},
+		"at": "1970-01-01T00:00:00.001Z",
+	}, opts)
+	require.NoError(t, err, "RequestToBytes failed")
+
+	want, err := RequestToBytes(spec, map[string]interface{}{
+		"event": map[string]interface{}{
+			"created": int64(1462096800500),
+			"id":      int64(9007199254740993),
+			"token":   "token",
+			"data":    []interface{}{0, 1, 2},
+			"count":   1,
+			"times":   []interface{}{1000, 2000},
+			"counter": map[string]interface{}{"value": 3},
+		},
+		"at": 1,
+	}, Options{})
+	require.NoError(t, err, "RequestToBytes failed")
+	assert.Equal(t, want, got, "annotated request should match the unannotated request")
+
+	assert.Equal(t, map[string]string{
+		"Timestamp":     `js.type = "Date"`,
+		"Event.id":      `js.type = "Long"`,
+		"Event.token":   `yab.format = "base64"`,
+		"Blob":          `yab.format = "base64"`,
+		"Counter.value": `js.type = "Long"`,
+		"Test::echo.at": `js.type = "Date"`,
+	}, used, "unexpected annotations used")
+}
+
+func TestAnnotationsRequestErrors(t *testing.T) {
+	module, annotations, err := parseAnnotated(t, annotatedThrift)
+	require.NoError(t, err, "ParseAnnotations failed")
+	spec := module.Services["Test"].Functions["echo"]
+
+	tests := []struct {
+		event  map[string]interface{}
+		errMsg string
+	}{
+		{
+			event:  map[string]interface{}{"created": "yesterday"},
+			errMsg: `cannot parse date for js.type = "Date"`,
+		},
+		{
+			event:  map[string]interface{}{"id": "1.5"},
+			errMsg: `cannot parse long for js.type = "Long"`,
+		},
+		{
+			event:  map[string]interface{}{"token": "!!"},
+			errMsg: "event.token",
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := RequestToBytes(spec, map[string]interface{}{"event": tt.event}, Options{Annotations: annotations})
+		if assert.Error(t, err, "%v should fail", tt.event) {
+			assert.Contains(t, err.Error(), tt.errMsg, "unexpected error for %v", tt.event)
+		}
+	}
+}
+
+func TestAnnotationsResponse(t *testing.T) {
+	module, annotations, err := parseAnnotated(t, annotatedThrift)
+	require.NoError(t, err, "ParseAnnotations failed")
+	spec := module.Services["Test"].Functions["echo"]
+
+	event, err := toWireValue(newNesting(Options{}), spec.ResultSpec.ReturnType, map[string]interface{}{
+		"created": int64(1462096800500),
+		"id":      int64(9007199254740993),
+		"token":   "token",
+		"data":    []interface{}{0, 1, 2},
+		"count":   1,
+		"times":   []interface{}{1000},
+		"counter": map[string]interface{}{"value": 3},
+	})
+	require.NoError(t, err, "toWireValue failed")
+	res := encodeWire(wire.NewValueStruct(wire.Struct{
+		Fields: []wire.Field{{ID: 0, Value: event}},
+	}))
+
+	got, err := ResponseBytesToMap(spec, res, Options{Annotations: annotations})
+	require.NoError(t, err, "ResponseBytesToMap failed")
+	assert.Equal(t, map[string]interface{}{
+		"result": map[string]interface{}{
+			"created": "2016-05-01T10:00:00.5Z",
+			"id":      "9007199254740993",
+			"token":   "dG9rZW4=",
+			"data":    "AAEC",
+			"count":   int64(1),
+			"times":   []interface{}{"1970-01-01T00:00:01Z"},
+			"counter": map[string]interface{}{"value": "3"},
+		},
+	}, got, "unexpected response")
+}
+
+func TestAnnotationsUnsupported(t *testing.T) {
+	tests := []struct {
+		contents string
+		errMsg   string
+	}{
+		{
+			contents: `struct S { 1: optional string s (yab.format = "hex") }`,
+			errMsg:   `unsupported annotation yab.format = "hex" on S.s`,
+		},
+		{
+			contents: `typedef i64 (yab.format = "base64") T`,
+			errMsg:   `unsupported annotation yab.format = "base64" on T`,
+		},
+	}
+
+	for _, tt := range tests {
+		_, _, err := parseAnnotated(t, tt.contents)
+		if assert.Error(t, err, "%v should fail", tt.contents) {
+			assert.Contains(t, err.Error(), tt.errMsg, "unexpected error")
+		}
+	}
+
+	// Other annotations, and js.type on other types, are ignored.
+	module, annotations, err := parseAnnotated(t, `
+    struct S {
+      1: optional string s (js.type = "Date", go.tag = "json")
+      2: optional binary b (js.type = "Buffer")
+    }
+  `)
+	require.NoError(t, err, "ParseAnnotations failed")
+	s := module.Types["S"].(*compile.StructSpec)
+	n := newNesting(Options{Annotations: annotations})
+	for _, f := range s.Fields {
+		assert.Nil(t, n.fieldHint(f), "%v should not have a hint", f.Name)
+	}
+}
@@ -22,10 +22,17 @@ package thrift
 
 import (
 	"fmt"
+	"strings"
+
+	"github.com/yarpc/yab/sorted"
 
 	"github.com/thriftrw/thriftrw-go/compile"
 )
 
+// ConstRefPrefix is the prefix of string values in a request that refer to a
+// constant defined in the Thrift file, e.g. "$consts.DEFAULT_FILTER".
+const ConstRefPrefix = "$consts."
+
 func constToRequest(v compile.ConstantValue) interface{} {
 	switch v := v.(type) {
 	case compile.ConstantBool:
@@ -58,3 +65,101 @@ func constToRequest(v compile.ConstantValue) interface{} {
 		panic(fmt.Sprintf("unknown constant type: %T", v))
 	}
 }
+
+// IsConstRef returns whether the value refers to a constant.
+func IsConstRef(value string) bool {
+	return strings.HasPrefix(value, ConstRefPrefix)
+}
+
+// ResolveConstants replaces strings in the request that refer to constants,
+// such as "$consts.DEFAULT_FILTER", or "$consts.shared.DEFAULT_FILTER" for a
+// constant in an included file, with the value of the constant.
+func ResolveConstants(module *compile.Module, request map[string]interface{}) (map[string]interface{}, error) {
+	for k, v := range request {
+		resolved, err := resolveConstants(module, v)
+		if err != nil {
+			return nil, err
+		}
+		request[k] = resolved
+	}
+	return request, nil
+}
+
+// ConstRequest returns the request for a reference to a constant map, so
+// requests defined in the Thrift file can be used as the whole request.
+func ConstRequest(module *compile.Module, ref string) (map[string]interface{}, error) {
+	c, err := lookupConstRef(module, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	m, ok := c.Value.(compile.ConstantMap)
+	if !ok {
+		return nil, fmt.Errorf("constant %q cannot be used as the request, it must be a map or struct", ref)
+	}
+
+	request, _ := structValueMap(constToRequest(m))
+	return request, nil
+}
+
+func resolveConstants(module *compile.Module, value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if !IsConstRef(v) {
+			return v, nil
+		}
+		c, err := lookupConstRef(module, v)
+		if err != nil {
+			return nil, err
+		}
+		return constToRequest(c.Value), nil
+	case []interface{}:
+		for i, item := range v {
+			resolved, err := resolveConstants(module, item)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = resolved
+		}
+	case map[string]interface{}:
+		return ResolveConstants(module, v)
+	case map[interface{}]interface{}:
+		for k, item := range v {
+			resolved, err := resolveConstants(module, item)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = resolved
+		}
+	}
+	return value, nil
+}
+
+// lookupConstRef returns the constant that ref refers to, looking up any
+// include prefixes in the module's includes.
+func lookupConstRef(module *compile.Module, ref string) (*compile.Constant, error) {
+	if module == nil {
+		return nil, fmt.Errorf("could not find constant %q: constants require a Thrift file", ref)
+	}
+
+	parts := strings.Split(strings.TrimPrefix(ref, ConstRefPrefix), ".")
+	for _, include := range parts[:len(parts)-1] {
+		included, ok := module.Includes[include]
+		if !ok {
+			return nil, fmt.Errorf("could not find constant %q: no included file %q", ref, include)
+		}
+		module = included.Module
+	}
+
+	name := parts[len(parts)-1]
+	if c, ok := module.Constants[name]; ok {
+		return c, nil
+	}
+
+	available := sorted.MapKeys(module.Constants)
+	msg := fmt.Sprintf("could not find constant %q", ref)
+	if closest := ClosestName(name, available); closest != "" {
+		msg += fmt.Sprintf(" (did you mean %q?)", strings.TrimSuffix(ref, name)+closest)
+	}
+	return nil, fmt.Errorf("%v, available constants: %v", msg, strings.Join(available, ", "))
+}
@@ -21,9 +21,13 @@
 package thrift
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/thriftrw/thriftrw-go/compile"
 )
 
@@ -96,3 +100,135 @@ func TestConstToRequest(t *testing.T) {
 		assert.Equal(t, tt.want, got, "Result mismatch for %v", tt.v)
 	}
 }
+
+const constsThrift = `
+  include "./shared.thrift"
+
+  struct Filter {
+    1: optional string status
+    2: optional i32 limit
+    3: optional list<string> tags
+  }
+
+  const i32 LIMIT = 10
+  const Filter DEFAULT_FILTER = {"status": "ACTIVE", "limit": LIMIT, "tags": ["a", "b"]}
+  const map<string, Filter> ARGS = {"filter": DEFAULT_FILTER}
+  const list<string> TAGS = ["x"]
+
+  service Search {
+    void find(1: Filter filter, 2: string id)
+  }
+`
+
+const constsIncludeThrift = `
+  const string DEFAULT_ID = "id-1"
+`
+
+func parseConsts(t *testing.T) *compile.Module {
+	dir, err := ioutil.TempDir("", "consts")
+	require.NoError(t, err, "TempDir failed")
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "test.thrift")
+	require.NoError(t, ioutil.WriteFile(file, []byte(constsThrift), 0644), "WriteFile failed")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "shared.thrift"), []byte(constsIncludeThrift), 0644), "WriteFile failed")
+
+	module, err := compile.Compile(file)
+	require.NoError(t, err, "Compile failed")
+	return module
+}
+
+func TestResolveConstants(t *testing.T) {
+	module := parseConsts(t)
+	defaultFilter := map[interface{}]interface{}{
+		"status": "ACTIVE",
+		"limit":  int64(10),
+		"tags":   []interface{}{"a", "b"},
+	}
+
+	tests := []struct {
+		msg     string
+		request map[string]interface{}
+		want    map[string]interface{}
+		errMsg  string
+	}{
+		{
+			msg:     "no references",
+			request: map[string]interface{}{"id": "consts.LIMIT", "filter": map[string]interface{}{"limit": 1}},
+			want:    map[string]interface{}{"id": "consts.LIMIT", "filter": map[string]interface{}{"limit": 1}},
+		},
+		{
+			msg:     "struct constant",
+			request: map[string]interface{}{"filter": "$consts.DEFAULT_FILTER"},
+			want:    map[string]interface{}{"filter": defaultFilter},
+		},
+		{
+			msg: "nested references",
+			request: map[string]interface{}{
+				"filter": map[interface{}]interface{}{
+					"limit": "$consts.LIMIT",
+					"tags":  []interface{}{"$consts.TAGS", "y"},
+				},
+			},
+			want: map[string]interface{}{
+				"filter": map[interface{}]interface{}{
+					"limit": int64(10),
+					"tags":  []interface{}{[]interface{}{"x"}, "y"},
+				},
+			},
+		},
+		{
+			msg:     "included constant",
+			request: map[string]interface{}{"id": "$consts.shared.DEFAULT_ID"},
+			want:    map[string]interface{}{"id": "id-1"},
+		},
+		{
+			msg:     "unknown constant",
+			request: map[string]interface{}{"filter": "$consts.DEFAULT_FILTR"},
+			errMsg:  `could not find constant "$consts.DEFAULT_FILTR" (did you mean "$consts.DEFAULT_FILTER"?), available constants: ARGS, DEFAULT_FILTER, LIMIT, TAGS`,
+		},
+		{
+			msg:     "unknown include",
+			request: map[string]interface{}{"id": []interface{}{"$consts.other.DEFAULT_ID"}},
+			errMsg:  `could not find constant "$consts.other.DEFAULT_ID": no included file "other"`,
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := ResolveConstants(module, tt.request)
+		if tt.errMsg != "" {
+			assert.EqualError(t, err, tt.errMsg, "%v: unexpected error", tt.msg)
+			continue
+		}
+		if assert.NoError(t, err, "%v: unexpected error", tt.msg) {
+			assert.Equal(t, tt.want, got, "%v: unexpected result", tt.msg)
+		}
+	}
+
+	_, err := ResolveConstants(nil, map[string]interface{}{"id": "$consts.LIMIT"})
+	assert.EqualError(t, err, `could not find constant "$consts.LIMIT": constants require a Thrift file`)
+}
+
+func TestConstRequest(t *testing.T) {
+	module := parseConsts(t)
+
+	request, err := ConstRequest(module, "$consts.ARGS")
+	require.NoError(t, err, "ConstRequest failed")
+	assert.Equal(t, map[string]interface{}{
+		"filter": map[interface{}]interface{}{
+			"status": "ACTIVE",
+			"limit":  int64(10),
+			"tags":   []interface{}{"a", "b"},
+		},
+	}, request)
+
+	// The resolved request can be serialized for the method.
+	_, err = RequestToBytes(module.Services["Search"].Functions["find"], request, Options{})
+	assert.NoError(t, err, "RequestToBytes failed")
+
+	_, err = ConstRequest(module, "$consts.LIMIT")
+	assert.EqualError(t, err, `constant "$consts.LIMIT" cannot be used as the request, it must be a map or struct`)
+
+	_, err = ConstRequest(module, "$consts.UNKNOWN")
+	assert.Error(t, err, "Unknown constants should fail")
+}
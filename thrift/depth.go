@@ -0,0 +1,240 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package thrift
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/thriftrw/thriftrw-go/compile"
+	"github.com/thriftrw/thriftrw-go/wire"
+)
+
+// DefaultMaxDepth is the default limit on how deeply structs and containers
+// may be nested in a request or response. It bounds the recursion for
+// recursive types such as trees and linked lists.
+const DefaultMaxDepth = 128
+
+var errValueCycle = errors.New("value contains a reference to itself")
+
+// Options control how values are converted to and from Thrift.
+type Options struct {
+	// MaxDepth is the maximum nesting depth of structs and containers.
+	// If it is not set, DefaultMaxDepth is used.
+	MaxDepth int
+
+	// LooseFields allows request keys to match fields regardless of case
+	// and separators, even in structs where some fields only differ by case
+	// or separators. Only the clashing fields require an exact match.
+	LooseFields bool
+
+	// FieldResolved is called for each request key that matches a field
+	// with a different name, with the paths of the key and the field.
+	FieldResolved func(key, field string)
+
+	// Annotations change how annotated fields and typedefs are represented.
+	Annotations *Annotations
+
+	// AnnotationUsed is called each time an annotation changes how a value
+	// is represented, with the annotated field or typedef and the annotation.
+	AnnotationUsed func(name, annotation string)
+
+	// MaxContainerSize limits how many items of each list, set and map in a
+	// response are converted. Larger containers are truncated. If it is not
+	// set, containers are not limited.
+	MaxContainerSize int
+
+	// DecodeTimeout limits how long converting a response can take. Values
+	// that are not converted in time are replaced with a truncation marker.
+	// If it is not set, there is no limit.
+	DecodeTimeout time.Duration
+
+	// AnnotateTypedefs wraps response values of typedefs in an object with
+	// the typedef name, using TypedefKey and TypedefValueKey.
+	AnnotateTypedefs bool
+}
+
+type maxDepthError struct {
+	max int
+}
+
+func (e maxDepthError) Error() string {
+	return fmt.Sprintf("value exceeds the maximum nesting depth of %v", e.max)
+}
+
+// nesting tracks the structs and containers that are being converted,
+// so that cyclic values and deeply recursive types fail with an error
+// rather than recursing until the stack overflows. It also tracks the path
+// of the value being converted, which is used to report errors, and the
+// options that control how fields are matched.
+type nesting struct {
+	max   int
+	depth int
+	path  []string
+
+	looseFields   bool
+	fieldResolved func(key, field string)
+
+	annotations    *Annotations
+	annotationUsed func(name, annotation string)
+
+	// maxItems, timeout and deadline bound converting values from Thrift,
+	// and truncated is the reason the value was truncated, if it was.
+	maxItems  int
+	timeout   time.Duration
+	deadline  time.Time
+	truncated string
+
+	annotateTypedefs bool
+
+	// visiting contains the maps and slices currently being converted.
+	visiting map[uintptr]struct{}
+}
+
+func newNesting(opts Options) *nesting {
+	max := opts.MaxDepth
+	if max <= 0 {
+		max = DefaultMaxDepth
+	}
+	var deadline time.Time
+	if opts.DecodeTimeout > 0 {
+		deadline = time.Now().Add(opts.DecodeTimeout)
+	}
+	return &nesting{
+		max:           max,
+		looseFields:   opts.LooseFields,
+		fieldResolved: opts.FieldResolved,
+		visiting:      make(map[uintptr]struct{}),
+
+		annotations:    opts.Annotations,
+		annotationUsed: opts.AnnotationUsed,
+
+		maxItems: opts.MaxContainerSize,
+		timeout:  opts.DecodeTimeout,
+		deadline: deadline,
+
+		annotateTypedefs: opts.AnnotateTypedefs,
+	}
+}
+
+// isNested returns whether values of the given type contain other values.
+func isNested(t wire.Type) bool {
+	switch t {
+	case wire.TStruct, wire.TList, wire.TSet, wire.TMap:
+		return true
+	}
+	return false
+}
+
+// enter should be called before converting a nested value, and must be
+// followed by a call to leave if it succeeds. value is the user's value
+// when converting to Thrift, and nil when converting from Thrift.
+func (n *nesting) enter(value interface{}) error {
+	if n.depth >= n.max {
+		return maxDepthError{n.max}
+	}
+
+	if ptr, ok := refPointer(value); ok {
+		if _, ok := n.visiting[ptr]; ok {
+			return errValueCycle
+		}
+		n.visiting[ptr] = struct{}{}
+	}
+
+	n.depth++
+	return nil
+}
+
+func (n *nesting) leave(value interface{}) {
+	if ptr, ok := refPointer(value); ok {
+		delete(n.visiting, ptr)
+	}
+	n.depth--
+}
+
+// pushField adds a struct field to the current path.
+func (n *nesting) pushField(name string) {
+	if len(n.path) > 0 {
+		name = "." + name
+	}
+	n.path = append(n.path, name)
+}
+
+// pushIndex adds a list item or map key to the current path.
+func (n *nesting) pushIndex(index interface{}) {
+	n.path = append(n.path, fmt.Sprintf("[%v]", index))
+}
+
+// fieldPath returns the path of the given field in the current struct.
+func (n *nesting) fieldPath(name string) string {
+	path := strings.Join(n.path, "")
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func (n *nesting) pop() {
+	n.path = n.path[:len(n.path)-1]
+}
+
+// wrapErr adds the current path to an error converting value to typeSpec.
+// Errors that already have a path are returned unchanged, so the path of
+// the innermost value that failed is reported.
+func (n *nesting) wrapErr(typeSpec compile.TypeSpec, value interface{}, err error) error {
+	path := strings.Join(n.path, "")
+	switch err.(type) {
+	case fieldPathError, valueMismatch:
+		return err
+	case fieldGroupError, maxDepthError:
+		return fieldPathError{path, err}
+	}
+	if err == errValueCycle || err == errUsingSingleField {
+		return fieldPathError{path, err}
+	}
+
+	return valueMismatch{
+		path:       path,
+		expected:   typeName(typeSpec),
+		got:        valueKind(value),
+		underlying: err,
+	}
+}
+
+// refPointer returns the pointer that identifies a non-empty map or slice,
+// which are the only user values that can contain themselves.
+func refPointer(value interface{}) (uintptr, bool) {
+	if value == nil {
+		return 0, false
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice:
+		if v.Len() > 0 {
+			return v.Pointer(), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,203 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package thrift
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thriftrw/thriftrw-go/compile"
+	"github.com/thriftrw/thriftrw-go/wire"
+	"github.com/yarpc/yab/unmarshal"
+)
+
+const recursiveThrift = `
+  struct Node {
+    1: optional string value
+    2: optional Node next
+  }
+  service Test {
+    Node echo(1: Node node)
+  }
+`
+
+// linkedList returns a request for a Node linked list of the given length.
+func linkedList(length int) map[string]interface{} {
+	var node map[string]interface{}
+	for i := 0; i < length; i++ {
+		next := map[string]interface{}{"value": "v"}
+		if node != nil {
+			next["next"] = node
+		}
+		node = next
+	}
+	return node
+}
+
+// echoResponse returns the response bytes for echo returning the given node.
+func echoResponse(t *testing.T, spec *compile.FunctionSpec, node map[string]interface{}) []byte {
+	w, err := toWireValue(newNesting(Options{MaxDepth: 1000}), spec.ResultSpec.ReturnType, node)
+	require.NoError(t, err, "toWireValue failed")
+	return encodeWire(wire.NewValueStruct(wire.Struct{
+		Fields: []wire.Field{{ID: 0, Value: w}},
+	}))
+}
+
+func TestRecursiveRoundTrip(t *testing.T) {
+	spec := getFuncSpecs(t, recursiveThrift)["echo"]
+
+	tests := []struct {
+		msg      string
+		length   int
+		maxDepth int
+		wantErr  bool
+	}{
+		{msg: "short list", length: 3},
+		{msg: "at the default limit", length: DefaultMaxDepth},
+		{msg: "beyond the default limit", length: DefaultMaxDepth + 1, wantErr: true},
+		{msg: "at a custom limit", length: 5, maxDepth: 5},
+		{msg: "beyond a custom limit", length: 6, maxDepth: 5, wantErr: true},
+		{msg: "custom limit above the default", length: DefaultMaxDepth + 1, maxDepth: DefaultMaxDepth + 1},
+	}
+
+	for _, tt := range tests {
+		opts := Options{MaxDepth: tt.maxDepth}
+		list := linkedList(tt.length)
+
+		_, reqErr := RequestToBytes(spec, map[string]interface{}{"node": list}, opts)
+		got, resErr := ResponseBytesToMap(spec, echoResponse(t, spec, list), opts)
+		if tt.wantErr {
+			for _, err := range []error{reqErr, resErr} {
+				if assert.Error(t, err, "%v: expected error", tt.msg) {
+					assert.Contains(t, err.Error(), "maximum nesting depth", "%v: unexpected error", tt.msg)
+				}
+			}
+			continue
+		}
+
+		assert.NoError(t, reqErr, "%v: RequestToBytes failed", tt.msg)
+		if assert.NoError(t, resErr, "%v: ResponseBytesToMap failed", tt.msg) {
+			assert.Equal(t, map[string]interface{}{"result": list}, got, "%v: unexpected response", tt.msg)
+		}
+	}
+}
+
+func TestResponseMaxDepth(t *testing.T) {
+	spec := getFuncSpecs(t, recursiveThrift)["echo"]
+
+	_, err := ResponseBytesToMap(spec, echoResponse(t, spec, linkedList(10)), Options{MaxDepth: 9})
+	if assert.Error(t, err, "ResponseBytesToMap should fail") {
+		assert.Contains(t, err.Error(), "maximum nesting depth of 9")
+	}
+}
+
+func TestRequestCycle(t *testing.T) {
+	spec := getFuncSpecs(t, recursiveThrift)["echo"]
+
+	node := map[string]interface{}{"value": "v"}
+	node["next"] = node
+
+	_, err := RequestToBytes(spec, map[string]interface{}{"node": node}, Options{})
+	if assert.Error(t, err, "RequestToBytes should fail") {
+		assert.Contains(t, err.Error(), errValueCycle.Error())
+	}
+}
+
+func TestRequestSharedValues(t *testing.T) {
+	spec := getFuncSpecs(t, `
+    struct S {
+      1: optional list<string> a
+      2: optional list<string> b
+    }
+    service Test {
+      void f(1: S s)
+    }
+  `)["f"]
+
+	// The same value used for sibling fields is not a cycle.
+	shared := []interface{}{"x", "y"}
+	_, err := RequestToBytes(spec, map[string]interface{}{
+		"s": map[string]interface{}{"a": shared, "b": shared},
+	}, Options{})
+	assert.NoError(t, err, "RequestToBytes failed")
+}
+
+func TestRequestFieldPath(t *testing.T) {
+	spec := getFuncSpecs(t, `
+    struct Range {
+      1: optional i64 min
+      2: optional i64 max
+    }
+    struct Filter {
+      1: optional Range range
+    }
+    struct Request {
+      1: optional list<Filter> filters
+      2: optional map<string, Range> ranges
+    }
+    service Test {
+      void f(1: Request request)
+    }
+  `)["f"]
+
+	tests := []struct {
+		msg     string
+		request string
+		errMsg  string
+	}{
+		{
+			msg:     "type mismatch in a list",
+			request: `{"request": {"filters": [{}, {}, {"range": {"min": "foo"}}]}}`,
+			errMsg:  `request.filters[2].range.min expects i64, got string`,
+		},
+		{
+			msg:     "type mismatch in a map",
+			request: `{"request": {"ranges": {"r": {"max": [1]}}}}`,
+			errMsg:  `request.ranges[r].max expects i64, got list`,
+		},
+		{
+			msg:     "unknown field",
+			request: `{"request": {"filters": [{"rnage": {}}]}}`,
+			errMsg:  `request.filters[0]: failed to parse fields`,
+		},
+		{
+			msg:     "unknown field suggestion",
+			request: `{"request": {"filters": [{"rnage": {}}]}}`,
+			errMsg:  `rnage (did you mean "range"?)`,
+		},
+		{
+			msg:     "struct specified as a scalar",
+			request: `{"request": {"filters": [1]}}`,
+			errMsg:  `request.filters[0] expects Filter, got integer`,
+		},
+	}
+
+	for _, tt := range tests {
+		req, err := unmarshal.YAML([]byte(tt.request))
+		require.NoError(t, err, "%v: failed to unmarshal request", tt.msg)
+
+		_, err = RequestToBytes(spec, req, Options{})
+		if assert.Error(t, err, "%v: expected error", tt.msg) {
+			assert.Contains(t, err.Error(), tt.errMsg, "%v: unexpected error", tt.msg)
+		}
+	}
+}
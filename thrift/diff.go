@@ -0,0 +1,314 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package thrift
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yarpc/yab/sorted"
+
+	"github.com/thriftrw/thriftrw-go/compile"
+)
+
+// Change is a difference between two versions of a Thrift file that
+// affects callers of a method.
+type Change struct {
+	// Method is the Service::method that is affected.
+	Method string
+
+	// Breaking is set if existing callers or servers using the old version
+	// can't interoperate with the new version.
+	Breaking bool
+
+	Message string
+}
+
+func (c Change) String() string {
+	return c.Method + ": " + c.Message
+}
+
+// Diff compares the methods of two versions of a Thrift file, and returns the
+// changes to each method's arguments, results and exceptions, including the
+// types they use. Methods are either Service::method, or a service name for
+// all of its methods. If no methods are specified, all methods are compared.
+func Diff(from, to *compile.Module, methods []string) ([]Change, error) {
+	all := serviceMethods(from)
+	if len(methods) == 0 {
+		methods = sorted.MapKeys(all)
+	} else {
+		var err error
+		if methods, err = expandMethods(all, methods); err != nil {
+			return nil, err
+		}
+	}
+
+	newMethods := serviceMethods(to)
+	var changes []Change
+	for _, method := range methods {
+		d := &differ{
+			method:  method,
+			visited: make(map[visitedStruct]bool),
+		}
+		if newSpec, ok := newMethods[method]; ok {
+			d.function(all[method], newSpec)
+		} else {
+			d.add(true, "method was removed")
+		}
+		changes = append(changes, d.changes...)
+	}
+	return changes, nil
+}
+
+// serviceMethods returns the functions of every service, including inherited
+// functions, keyed by Service::method.
+func serviceMethods(module *compile.Module) map[string]*compile.FunctionSpec {
+	methods := make(map[string]*compile.FunctionSpec)
+	for name, svc := range module.Services {
+		for ; svc != nil; svc = svc.Parent {
+			for fname, f := range svc.Functions {
+				if _, ok := methods[name+"::"+fname]; !ok {
+					methods[name+"::"+fname] = f
+				}
+			}
+		}
+	}
+	return methods
+}
+
+// expandMethods replaces service names with the service's methods, and
+// checks that the methods exist.
+func expandMethods(all map[string]*compile.FunctionSpec, methods []string) ([]string, error) {
+	var expanded []string
+	for _, method := range methods {
+		if _, ok := all[method]; ok {
+			expanded = append(expanded, method)
+			continue
+		}
+
+		found := false
+		for _, name := range sorted.MapKeys(all) {
+			if strings.HasPrefix(name, method+"::") {
+				expanded = append(expanded, name)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("method %q not found in the old Thrift file", method)
+		}
+	}
+	return expanded, nil
+}
+
+// direction is which way values are sent. Whether a change breaks existing
+// callers depends on the direction: callers using the old version write
+// arguments that the new version reads, and read results that the new
+// version writes.
+type direction int
+
+const (
+	// request values, such as arguments, are written by callers.
+	request direction = iota
+
+	// response values, such as results and exceptions, are written by servers.
+	response
+)
+
+// visitedStruct is a pair of structs that were compared in a direction.
+type visitedStruct struct {
+	from, to *compile.StructSpec
+	dir      direction
+}
+
+// differ records the changes to a single method.
+type differ struct {
+	method  string
+	changes []Change
+
+	// visited tracks structs that were compared, for recursive types.
+	visited map[visitedStruct]bool
+}
+
+func (d *differ) add(breaking bool, format string, args ...interface{}) {
+	d.changes = append(d.changes, Change{
+		Method:   d.method,
+		Breaking: breaking,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (d *differ) function(from, to *compile.FunctionSpec) {
+	if from.OneWay != to.OneWay {
+		d.add(true, "oneway changed from %v to %v", from.OneWay, to.OneWay)
+		return
+	}
+
+	d.fields(request, "args", compile.FieldGroup(from.ArgsSpec), compile.FieldGroup(to.ArgsSpec))
+	if from.ResultSpec == nil || to.ResultSpec == nil {
+		return
+	}
+
+	oldReturn, newReturn := from.ResultSpec.ReturnType, to.ResultSpec.ReturnType
+	switch {
+	case oldReturn != nil && newReturn == nil:
+		d.add(true, "result: return type changed from %v to void", typeName(oldReturn))
+	case oldReturn == nil && newReturn != nil:
+		d.add(false, "result: return type changed from void to %v", typeName(newReturn))
+	case oldReturn != nil:
+		d.typeSpec(response, "result", oldReturn, newReturn)
+	}
+
+	newExceptions := fieldsByID(to.ResultSpec.Exceptions)
+	for _, oldEx := range from.ResultSpec.Exceptions {
+		newEx, ok := newExceptions[oldEx.ID]
+		if !ok {
+			d.add(false, "exception %v (%v) was removed", oldEx.Name, oldEx.ID)
+			continue
+		}
+		d.typeSpec(response, "exception "+newEx.Name, oldEx.Type, newEx.Type)
+	}
+
+	oldExceptions := fieldsByID(from.ResultSpec.Exceptions)
+	for _, newEx := range to.ResultSpec.Exceptions {
+		if _, ok := oldExceptions[newEx.ID]; !ok {
+			d.add(true, "new exception %v (%v) is not known to existing callers", newEx.Name, newEx.ID)
+		}
+	}
+}
+
+// fields compares fields by ID, since field names are not sent on the wire.
+// Required fields must be sent by writers, so making a field required only
+// breaks callers that write it, and making it optional only breaks callers
+// that read it.
+func (d *differ) fields(dir direction, path string, from, to compile.FieldGroup) {
+	newFields := fieldsByID(to)
+	for _, oldField := range from {
+		newField, ok := newFields[oldField.ID]
+		if !ok {
+			if oldField.Required {
+				d.add(true, "%v: required field %v (%v) was removed", path, oldField.Name, oldField.ID)
+			} else {
+				d.add(false, "%v: optional field %v (%v) was removed", path, oldField.Name, oldField.ID)
+			}
+			continue
+		}
+
+		if oldField.Name != newField.Name {
+			d.add(false, "%v: field %v was renamed from %v to %v", path, oldField.ID, oldField.Name, newField.Name)
+		}
+		switch {
+		case newField.Required && !oldField.Required:
+			d.add(dir == request, "%v.%v: field became required", path, newField.Name)
+		case oldField.Required && !newField.Required:
+			d.add(dir == response, "%v.%v: field became optional", path, newField.Name)
+		}
+		d.typeSpec(dir, path+"."+newField.Name, oldField.Type, newField.Type)
+	}
+
+	oldFields := fieldsByID(from)
+	for _, newField := range to {
+		if _, ok := oldFields[newField.ID]; ok {
+			continue
+		}
+		if newField.Required {
+			d.add(dir == request, "%v: new required field %v (%v)", path, newField.Name, newField.ID)
+		} else {
+			d.add(false, "%v: new optional field %v (%v)", path, newField.Name, newField.ID)
+		}
+	}
+}
+
+func (d *differ) typeSpec(dir direction, path string, from, to compile.TypeSpec) {
+	oldSpec, newSpec := resolveTypedef(from), resolveTypedef(to)
+	if oldSpec.TypeCode() != newSpec.TypeCode() {
+		d.add(true, "%v: type changed from %v to %v", path, typeName(from), typeName(to))
+		return
+	}
+
+	switch oldSpec := oldSpec.(type) {
+	case *compile.ListSpec:
+		d.typeSpec(dir, path+"[]", oldSpec.ValueSpec, newSpec.(*compile.ListSpec).ValueSpec)
+	case *compile.SetSpec:
+		d.typeSpec(dir, path+"[]", oldSpec.ValueSpec, newSpec.(*compile.SetSpec).ValueSpec)
+	case *compile.MapSpec:
+		newMap := newSpec.(*compile.MapSpec)
+		d.typeSpec(dir, path+"{key}", oldSpec.KeySpec, newMap.KeySpec)
+		d.typeSpec(dir, path+"{value}", oldSpec.ValueSpec, newMap.ValueSpec)
+	case *compile.StructSpec:
+		newStruct := newSpec.(*compile.StructSpec)
+		key := visitedStruct{oldSpec, newStruct, dir}
+		if d.visited[key] {
+			return
+		}
+		d.visited[key] = true
+		d.fields(dir, path, oldSpec.Fields, newStruct.Fields)
+	case *compile.EnumSpec:
+		newEnum, ok := newSpec.(*compile.EnumSpec)
+		if !ok {
+			d.add(false, "%v: type changed from %v to %v", path, typeName(from), typeName(to))
+			return
+		}
+		d.enum(dir, path, oldSpec, newEnum)
+	}
+}
+
+// enum compares enum values by name, since requests and responses use the
+// names, and the values are sent on the wire. Removed values only break
+// callers that write them, and new values only break callers that read them.
+func (d *differ) enum(dir direction, path string, from, to *compile.EnumSpec) {
+	newValues := make(map[string]int32, len(to.Items))
+	for _, item := range to.Items {
+		newValues[item.Name] = item.Value
+	}
+
+	for _, item := range from.Items {
+		newValue, ok := newValues[item.Name]
+		switch {
+		case !ok:
+			d.add(dir == request, "%v: enum value %v (%v) was removed", path, item.Name, item.Value)
+		case newValue != item.Value:
+			d.add(true, "%v: enum value %v changed from %v to %v", path, item.Name, item.Value, newValue)
+		}
+	}
+
+	oldValues := make(map[string]struct{}, len(from.Items))
+	for _, item := range from.Items {
+		oldValues[item.Name] = struct{}{}
+	}
+	for _, item := range to.Items {
+		if _, ok := oldValues[item.Name]; ok {
+			continue
+		}
+		if dir == response {
+			d.add(true, "%v: new enum value %v (%v) is not known to existing callers", path, item.Name, item.Value)
+		} else {
+			d.add(false, "%v: new enum value %v (%v)", path, item.Name, item.Value)
+		}
+	}
+}
+
+func fieldsByID(fields compile.FieldGroup) map[int16]*compile.FieldSpec {
+	byID := make(map[int16]*compile.FieldSpec, len(fields))
+	for _, f := range fields {
+		byID[f.ID] = f
+	}
+	return byID
+}
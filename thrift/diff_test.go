@@ -0,0 +1,222 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package thrift
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thriftrw/thriftrw-go/compile"
+)
+
+const diffOldThrift = `
+enum Status { ACTIVE = 1, DISABLED = 2, DELETED = 3 }
+
+struct Item {
+  1: required string name
+  2: optional i32 count
+  3: optional Status status
+  4: optional list<Item> children
+  5: optional string legacy
+}
+
+exception NotFound {}
+
+service Base {
+  void ping()
+}
+
+service Store extends Base {
+  Item get(1: string key) throws (1: NotFound notFound)
+  void put(1: string key, 2: Item item)
+  i64 size()
+  oneway void log(1: string msg)
+  void removed()
+}
+`
+
+const diffNewThrift = `
+enum Status { ACTIVE = 1, DISABLED = 4 }
+
+typedef string Name
+
+struct Item {
+  1: required Name name
+  2: optional i64 count
+  3: optional Status status
+  4: optional list<Item> children
+  6: required bool valid
+}
+
+exception NotFound {}
+exception Throttled {}
+
+service Base {
+  void ping()
+}
+
+service Store extends Base {
+  Item get(1: string id, 2: optional bool cached) throws (2: Throttled throttled)
+  void put(1: string key, 2: Item item)
+  void size()
+  void log(1: string msg)
+}
+`
+
+func compileThrift(t *testing.T, contents string) *compile.Module {
+	file, err := ioutil.TempFile("", "diff.thrift")
+	require.NoError(t, err, "TempFile failed")
+	defer os.Remove(file.Name())
+
+	_, err = file.WriteString(contents)
+	require.NoError(t, err, "Write failed")
+	require.NoError(t, file.Close(), "Close failed")
+
+	module, err := compile.Compile(file.Name())
+	require.NoError(t, err, "Compile failed")
+	return module
+}
+
+func TestDiff(t *testing.T) {
+	from := compileThrift(t, diffOldThrift)
+	to := compileThrift(t, diffNewThrift)
+
+	// Removed enum values and new required fields only break arguments.
+	itemChanges := func(method, path string, dir direction) []Change {
+		return []Change{
+			{method, true, path + ".count: type changed from i32 to i64"},
+			{method, true, path + ".status: enum value DISABLED changed from 2 to 4"},
+			{method, dir == request, path + ".status: enum value DELETED (3) was removed"},
+			{method, false, path + ": optional field legacy (5) was removed"},
+			{method, dir == request, path + ": new required field valid (6)"},
+		}
+	}
+
+	tests := []struct {
+		methods []string
+		want    []Change
+		errMsg  string
+	}{
+		{
+			methods: []string{"Store::get"},
+			want: append(append([]Change{
+				{"Store::get", false, "args: field 1 was renamed from key to id"},
+				{"Store::get", false, "args: new optional field cached (2)"},
+			}, itemChanges("Store::get", "result", response)...),
+				Change{"Store::get", false, "exception notFound (1) was removed"},
+				Change{"Store::get", true, "new exception throttled (2) is not known to existing callers"},
+			),
+		},
+		{
+			methods: []string{"Store::put", "Store::size"},
+			want: append(itemChanges("Store::put", "args.item", request),
+				Change{"Store::size", true, "result: return type changed from i64 to void"},
+			),
+		},
+		{
+			methods: []string{"Store::log", "Store::removed", "Store::ping"},
+			want: []Change{
+				{"Store::log", true, "oneway changed from true to false"},
+				{"Store::removed", true, "method was removed"},
+			},
+		},
+		{
+			methods: []string{"Base"},
+			want:    nil,
+		},
+		{
+			methods: []string{"Store::unknown"},
+			errMsg:  `method "Store::unknown" not found in the old Thrift file`,
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := Diff(from, to, tt.methods)
+		if tt.errMsg != "" {
+			assert.EqualError(t, err, tt.errMsg, "Diff(%v) unexpected error", tt.methods)
+			continue
+		}
+		if assert.NoError(t, err, "Diff(%v) failed", tt.methods) {
+			assert.Equal(t, tt.want, got, "Diff(%v) unexpected changes", tt.methods)
+		}
+	}
+
+	all, err := Diff(from, to, nil)
+	require.NoError(t, err, "Diff failed")
+	methods := make(map[string]bool)
+	for _, c := range all {
+		methods[c.Method] = true
+	}
+	assert.Equal(t, map[string]bool{
+		"Store::get": true, "Store::log": true, "Store::put": true, "Store::removed": true, "Store::size": true,
+	}, methods, "All methods should be compared by default")
+	assert.Equal(t, "Store::removed: method was removed", Change{"Store::removed", true, "method was removed"}.String())
+}
+
+func TestDiffDirection(t *testing.T) {
+	// The same struct is used for the arguments and the result, so each change
+	// is reported for both, but only breaks one direction.
+	from := compileThrift(t, `
+enum Color { RED = 1, GREEN = 2 }
+
+struct Paint {
+  1: optional Color color
+  2: optional string name
+  3: required string brand
+}
+
+service Shop {
+  Paint mix(1: Paint paint)
+}
+`)
+	to := compileThrift(t, `
+enum Color { RED = 1, BLUE = 3 }
+
+struct Paint {
+  1: optional Color color
+  2: required string name
+  3: optional string brand
+  4: required i32 size
+}
+
+service Shop {
+  Paint mix(1: Paint paint)
+}
+`)
+
+	got, err := Diff(from, to, nil)
+	require.NoError(t, err, "Diff failed")
+	assert.Equal(t, []Change{
+		{"Shop::mix", true, "args.paint.color: enum value GREEN (2) was removed"},
+		{"Shop::mix", false, "args.paint.color: new enum value BLUE (3)"},
+		{"Shop::mix", true, "args.paint.name: field became required"},
+		{"Shop::mix", false, "args.paint.brand: field became optional"},
+		{"Shop::mix", true, "args.paint: new required field size (4)"},
+		{"Shop::mix", false, "result.color: enum value GREEN (2) was removed"},
+		{"Shop::mix", true, "result.color: new enum value BLUE (3) is not known to existing callers"},
+		{"Shop::mix", false, "result.name: field became required"},
+		{"Shop::mix", true, "result.brand: field became optional"},
+		{"Shop::mix", false, "result: new required field size (4)"},
+	}, got, "unexpected changes")
+}
@@ -31,10 +31,19 @@ type fieldGroupError struct {
 	available       []string
 	missingRequired []string
 	notFound        []string
+
+	// suggestions maps fields that were not found to the closest available field.
+	suggestions map[string]string
 }
 
 func (e *fieldGroupError) addNotFound(arg string) {
 	e.notFound = append(e.notFound, arg)
+	if closest := ClosestName(arg, e.available); closest != "" {
+		if e.suggestions == nil {
+			e.suggestions = make(map[string]string)
+		}
+		e.suggestions[arg] = closest
+	}
 }
 
 func (e *fieldGroupError) addMissingRequired(arg string) {
@@ -49,8 +58,15 @@ func (e fieldGroupError) Error() string {
 	}
 
 	if len(e.notFound) > 0 {
+		notFound := make([]string, len(e.notFound))
+		for i, f := range e.notFound {
+			notFound[i] = f
+			if closest, ok := e.suggestions[f]; ok {
+				notFound[i] = fmt.Sprintf("%v (did you mean %q?)", f, closest)
+			}
+		}
 		messages = append(messages,
-			messageList("the following fields were specified but not found", e.notFound))
+			messageList("the following fields were specified but not found", notFound))
 		messages = append(messages,
 			messageList("the available fields are", e.available))
 	}
@@ -111,6 +127,61 @@ func (e specStructFieldMismatch) Error() string {
 	return fmt.Sprintf("%q failed: %v", e.fieldName, e.underlying)
 }
 
+// fieldPathError is an error converting the user's value at path.
+type fieldPathError struct {
+	path       string
+	underlying error
+}
+
+func (e fieldPathError) Error() string {
+	if e.path == "" {
+		return e.underlying.Error()
+	}
+	return fmt.Sprintf("%v: %v", e.path, e.underlying)
+}
+
+// valueMismatch is an error converting the user's value at path
+// to the type specified in the Thrift file.
+type valueMismatch struct {
+	path       string
+	mapKey     bool
+	expected   string
+	got        string
+	underlying error
+}
+
+func (e valueMismatch) Error() string {
+	path := e.path
+	if path == "" {
+		path = "request body"
+	}
+	if e.mapKey {
+		path += " key"
+	}
+	return fmt.Sprintf("%v expects %v, got %v: %v", path, e.expected, e.got, e.underlying)
+}
+
+// valueKind returns a description of the type of a user's value.
+func valueKind(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case string:
+		return "string"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "integer"
+	case float32, float64:
+		return "number"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}, map[interface{}]interface{}:
+		return "map"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
 // messageList formats a message and a list for an error message.
 func messageList(message string, list []string) string {
 	if len(list) == 0 {
@@ -48,23 +48,45 @@ func (fs fields) getField(name string) (*compile.FieldSpec, bool) {
 	return nil, false
 }
 
+// IsStringArg returns whether the argument of the method matching name, the
+// same way as a request key, is a string or binary, so a value given for it
+// on the command line can be used as is rather than parsed.
+func IsStringArg(method *compile.FunctionSpec, name string, opts Options) bool {
+	f, ok := getFields(compile.FieldGroup(method.ArgsSpec), opts.LooseFields).getField(name)
+	return ok && resolveTypedef(f.Type).TypeCode() == wire.TBinary
+}
+
 // fieldMap returns maps from string to the field spec.
 // The first map is an exact map, which uses the name as specified in the Thrift file.
 // The second map is a fuzzy map, which will ignore case, and ignore
 // any non-alphanumberic characters.
-func getFields(spec compile.FieldGroup) fields {
+// If loose is set, field clashes in the fuzzy map only disable fuzzy
+// matching for the clashing fields, rather than for all fields.
+func getFields(spec compile.FieldGroup, loose bool) fields {
 	exact := make(map[string]*compile.FieldSpec)
 	fieldIDs := make(map[string]*compile.FieldSpec)
 	fuzzy := make(map[string]*compile.FieldSpec)
+	clashes := make(map[string]struct{})
 	for _, f := range spec {
 		exact[f.ThriftName()] = f
 		fieldIDs[strconv.Itoa(int(f.ID))] = f
-		fuzzy[fuzz(f.ThriftName())] = f
+
+		fuzzed := fuzz(f.ThriftName())
+		if _, ok := fuzzy[fuzzed]; ok {
+			clashes[fuzzed] = struct{}{}
+		}
+		fuzzy[fuzzed] = f
 	}
 
-	// If there's any field clashes in the fuzzy map, skip fuzzy matching.
-	if len(exact) != len(fuzzy) {
-		fuzzy = nil
+	if len(clashes) > 0 {
+		if loose {
+			for fuzzed := range clashes {
+				delete(fuzzy, fuzzed)
+			}
+		} else {
+			// If there's any field clashes in the fuzzy map, skip fuzzy matching.
+			fuzzy = nil
+		}
 	}
 
 	return fields{
@@ -74,9 +96,9 @@ func getFields(spec compile.FieldGroup) fields {
 	}
 }
 
-func fieldGroupToValue(fieldsList compile.FieldGroup, request map[string]interface{}) ([]wire.Field, error) {
+func fieldGroupToValue(n *nesting, fieldsList compile.FieldGroup, request map[string]interface{}) ([]wire.Field, error) {
 	var (
-		fields = getFields(fieldsList)
+		fields = getFields(fieldsList, n.looseFields)
 
 		err = fieldGroupError{available: sorted.MapKeys(fields.exact)}
 
@@ -91,6 +113,9 @@ func fieldGroupToValue(fieldsList compile.FieldGroup, request map[string]interfa
 			continue
 		}
 
+		if k != field.ThriftName() && n.fieldResolved != nil {
+			n.fieldResolved(n.fieldPath(k), n.fieldPath(field.ThriftName()))
+		}
 		userFields[field.ThriftName()] = v
 	}
 
@@ -115,16 +140,18 @@ func fieldGroupToValue(fieldsList compile.FieldGroup, request map[string]interfa
 		return nil, err
 	}
 
-	return fieldsMapToValue(fields.exact, userFields)
+	return fieldsMapToValue(n, fields.exact, userFields)
 }
 
 // fieldMapToValue converts the userFields to a list of wire.Field.
 // It does not do any error checking.
-func fieldsMapToValue(fields map[string]*compile.FieldSpec, userFields map[string]interface{}) ([]wire.Field, error) {
+func fieldsMapToValue(n *nesting, fields map[string]*compile.FieldSpec, userFields map[string]interface{}) ([]wire.Field, error) {
 	wireFields := make([]wire.Field, 0, len(userFields))
 	for k, userValue := range userFields {
 		spec := fields[k]
-		value, err := toWireValue(spec.Type, userValue)
+		n.pushField(k)
+		value, err := toWireField(n, spec, userValue)
+		n.pop()
 		if err != nil {
 			return nil, err
 		}
@@ -159,6 +186,58 @@ func fuzz(fieldName string) string {
 	return string(newField)
 }
 
+// ClosestName returns the name in available that is closest to name, ignoring
+// case and separators, or "" if none of them are close enough to suggest.
+func ClosestName(name string, available []string) string {
+	fuzzed := fuzz(name)
+
+	// Allow roughly one typo for every 3 characters.
+	best, bestDistance := "", len(fuzzed)/3+1
+	for _, f := range available {
+		if d := editDistance(fuzzed, fuzz(f)); d < bestDistance {
+			best, bestDistance = f, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the number of insertions, deletions, substitutions
+// and transpositions of adjacent characters needed to turn a into b.
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min3(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] && d[i-2][j-2]+1 < d[i][j] {
+				d[i][j] = d[i-2][j-2] + 1
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
 type byFieldID []wire.Field
 
 func (p byFieldID) Len() int           { return len(p) }
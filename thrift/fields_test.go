@@ -24,6 +24,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestFuzz(t *testing.T) {
@@ -40,3 +41,144 @@ func TestFuzz(t *testing.T) {
 		assert.Equal(t, tt.want, got, "Fuzz(%v)", tt.input)
 	}
 }
+
+func TestIsStringArg(t *testing.T) {
+	specs := getFuncSpecs(t, `
+    typedef string UUID
+    struct S {}
+    service Test {
+      void f(1: string name, 2: binary data, 3: UUID userID, 4: i64 id, 5: S s, 6: list<string> tags)
+    }
+  `)
+	spec := specs["f"]
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"name", true},
+		{"data", true},
+		{"userID", true},
+		{"user_id", true},
+		{"3", true},
+		{"id", false},
+		{"s", false},
+		{"tags", false},
+		{"unknown", false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, IsStringArg(spec, tt.name, Options{}), "IsStringArg(%v)", tt.name)
+	}
+}
+
+func TestClosestName(t *testing.T) {
+	available := []string{"filters", "limit", "user_id", "uuid"}
+	tests := []struct {
+		input, want string
+	}{
+		{"filter", "filters"},
+		{"fitlers", "filters"},
+		{"limt", "limit"},
+		{"userID", "user_id"},
+		{"uid", "uuid"},
+		{"offset", ""},
+		{"x", ""},
+	}
+
+	for _, tt := range tests {
+		got := ClosestName(tt.input, available)
+		assert.Equal(t, tt.want, got, "ClosestName(%v)", tt.input)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"", "abc", 3},
+		{"abc", "abc", 0},
+		{"abc", "abd", 1},
+		{"kitten", "sitting", 3},
+		{"range", "rnage", 1},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, editDistance(tt.a, tt.b), "editDistance(%v, %v)", tt.a, tt.b)
+	}
+}
+
+func TestLooseFields(t *testing.T) {
+	spec := getFuncSpecs(t, `
+    struct S {
+      1: optional string user_id
+      2: optional string ns
+      3: optional string ns_
+    }
+    service Test {
+      void f(1: S s)
+    }
+  `)["f"]
+
+	tests := []struct {
+		msg      string
+		request  map[string]interface{}
+		loose    bool
+		errMsg   string
+		resolved map[string]string
+	}{
+		{
+			msg:     "fuzzy matching is disabled by clashes",
+			request: map[string]interface{}{"s": map[string]interface{}{"userId": "u"}},
+			errMsg:  "userId",
+		},
+		{
+			msg:      "loose fields match despite clashes",
+			request:  map[string]interface{}{"s": map[string]interface{}{"userId": "u"}},
+			loose:    true,
+			resolved: map[string]string{"s.userId": "s.user_id"},
+		},
+		{
+			msg:      "loose fields match by field ID",
+			request:  map[string]interface{}{"s": map[string]interface{}{"1": "u"}},
+			loose:    true,
+			resolved: map[string]string{"s.1": "s.user_id"},
+		},
+		{
+			msg:      "exact matches are not reported",
+			request:  map[string]interface{}{"s": map[string]interface{}{"ns": "n", "ns_": "n"}},
+			loose:    true,
+			resolved: map[string]string{},
+		},
+		{
+			msg:     "clashing fields require an exact match",
+			request: map[string]interface{}{"s": map[string]interface{}{"NS": "n"}},
+			loose:   true,
+			errMsg:  "NS",
+		},
+	}
+
+	for _, tt := range tests {
+		resolved := make(map[string]string)
+		opts := Options{
+			LooseFields: tt.loose,
+			FieldResolved: func(key, field string) {
+				resolved[key] = field
+			},
+		}
+
+		_, err := RequestToBytes(spec, tt.request, opts)
+		if tt.errMsg != "" {
+			if assert.Error(t, err, "%v: expected error", tt.msg) {
+				assert.Contains(t, err.Error(), tt.errMsg, "%v: unexpected error", tt.msg)
+			}
+			continue
+		}
+
+		require.NoError(t, err, "%v: RequestToBytes failed", tt.msg)
+		assert.Equal(t, tt.resolved, resolved, "%v: unexpected resolved fields", tt.msg)
+	}
+}
@@ -21,9 +21,11 @@
 package thrift
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 
+	"github.com/thriftrw/thriftrw-go/ast"
 	"github.com/thriftrw/thriftrw-go/compile"
 	"github.com/thriftrw/thriftrw-go/wire"
 )
@@ -37,23 +39,37 @@ func getFieldMap(fields compile.FieldGroup) map[int16]*compile.FieldSpec {
 	return specs
 }
 
-func valueFromWireStruct(spec *compile.StructSpec, w wire.Struct) (map[string]interface{}, error) {
+func valueFromWireStruct(n *nesting, spec *compile.StructSpec, w wire.Struct) (map[string]interface{}, error) {
 	result := make(map[string]interface{})
 	specs := getFieldMap(spec.Fields)
+	var unknown []wire.Field
 	for _, f := range w.Fields {
 		fSpec, ok := specs[f.ID]
 		if !ok {
-			// TODO: Return unknown fields in the map possibly with a key :unknown_field_[id]
+			unknown = append(unknown, f)
 			continue
 		}
 
 		var err error
-		result[fSpec.Name], err = valueFromWire(fSpec.Type, f.Value)
+		result[fSpec.Name], err = valueFromWireField(n, fSpec, f.Value)
 		if err != nil {
 			return nil, specStructFieldMismatch{fSpec.Name, err}
 		}
 	}
 
+	if len(unknown) > 0 {
+		var err error
+		result[UnknownFieldsKey], err = unknownFieldsFromWire(n, unknown)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Only the set field of a union is returned, so unions are a single-key object.
+	if spec.Type == ast.UnionType {
+		return result, nil
+	}
+
 	for _, fSpec := range specs {
 		if _, ok := result[fSpec.Name]; ok {
 			continue
@@ -72,63 +88,128 @@ func valueFromWireStruct(spec *compile.StructSpec, w wire.Struct) (map[string]in
 	return result, nil
 }
 
-func valueFromWireList(spec *compile.ListSpec, w wire.List) ([]interface{}, error) {
-	result := make([]interface{}, w.Size)
-	values := wire.ValueListToSlice(w.Items, w.Size)
-	for i, v := range values {
-		var err error
-		result[i], err = valueFromWire(spec.ValueSpec, v)
+func valueFromWireList(n *nesting, spec *compile.ListSpec, w wire.List) ([]interface{}, error) {
+	limit := n.limitItems(w.Size)
+	result := make([]interface{}, 0, limit)
+	err := w.Items.ForEach(func(v wire.Value) error {
+		i := len(result)
+		if i >= limit || n.timedOut() {
+			return errStopItems
+		}
+
+		item, err := valueFromWire(n, spec.ValueSpec, v)
 		if err != nil {
-			return nil, specListItemMismatch{i, err}
+			return specListItemMismatch{i, err}
 		}
+		result = append(result, item)
+		return nil
+	})
+	if err == errStopItems {
+		return append(result, n.truncatedItems(w.Size-len(result), w.Size, "items")), nil
+	}
+	if err != nil {
+		return nil, err
 	}
 	return result, nil
 }
 
-func valueFromWireSet(spec *compile.SetSpec, w wire.Set) ([]interface{}, error) {
+func valueFromWireSet(n *nesting, spec *compile.SetSpec, w wire.Set) ([]interface{}, error) {
 	// Since wire.Set and wire.List are exactly the same type, we can cast one to the other.
-	return valueFromWireList(&compile.ListSpec{
+	return valueFromWireList(n, &compile.ListSpec{
 		ValueSpec: spec.ValueSpec,
 	}, wire.List(w))
 }
 
-func valueFromWireMap(spec *compile.MapSpec, w wire.Map) (map[string]interface{}, error) {
-	result := make(map[string]interface{}, w.Size)
-	values := wire.MapItemListToSlice(w.Items, w.Size)
-	for _, v := range values {
-		key, err := valueFromWire(spec.KeySpec, v.Key)
+func valueFromWireMap(n *nesting, spec *compile.MapSpec, w wire.Map) (map[string]interface{}, error) {
+	limit := n.limitItems(w.Size)
+	result := make(map[string]interface{}, limit)
+	converted := 0
+	err := w.Items.ForEach(func(v wire.MapItem) error {
+		if converted >= limit || n.timedOut() {
+			return errStopItems
+		}
+		converted++
+
+		// Keys are not wrapped with their typedef name, so they remain strings.
+		key, err := valueFromWireType(n, spec.KeySpec, v.Key)
 		if err != nil {
-			return nil, specMapItemMismatch{"key", err}
+			return specMapItemMismatch{"key", err}
 		}
 
-		value, err := valueFromWire(spec.ValueSpec, v.Value)
+		value, err := valueFromWire(n, spec.ValueSpec, v.Value)
 		if err != nil {
-			return nil, specMapItemMismatch{"value", err}
+			return specMapItemMismatch{"value", err}
 		}
 
 		// Note: If the key is not hashable, we marshal it to a string and use that.
 		// We might want to use a []MapItem instead to represent the map.
 		if keyS, ok := key.(string); ok {
 			result[keyS] = value
-			continue
+			return nil
 		}
 
 		bs, err := json.Marshal(key)
 		if err != nil {
-			return nil, fmt.Errorf("failed to marshal key object: %v\nkey: %v", err, key)
+			return fmt.Errorf("failed to marshal key object: %v\nkey: %v", err, key)
 		}
 
 		result[string(bs)] = value
+		return nil
+	})
+	if err == errStopItems {
+		result[TruncatedKey] = n.truncatedItems(w.Size-converted, w.Size, "entries")
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
 	}
 	return result, nil
 }
 
+// valueFromWireField converts the value of a field, using the field's annotations.
+func valueFromWireField(n *nesting, spec *compile.FieldSpec, w wire.Value) (interface{}, error) {
+	if h := n.fieldHint(spec); h != nil && resolveTypedef(spec.Type).TypeCode() == w.Type() {
+		return h.fromWire(n, w), nil
+	}
+	return valueFromWire(n, spec.Type, w)
+}
+
 // valueFromWire converts the wire.Value to the specific type it represents.
-func valueFromWire(spec compile.TypeSpec, w wire.Value) (interface{}, error) {
+// Typedefs are converted using their underlying type, and are wrapped with
+// the typedef name if typedefs are annotated.
+func valueFromWire(n *nesting, typeSpec compile.TypeSpec, w wire.Value) (interface{}, error) {
+	result, err := valueFromWireType(n, typeSpec, w)
+	if err != nil || !n.annotateTypedefs {
+		return result, err
+	}
+
+	// Typedefs with annotations such as js.type already use their own representation.
+	if typedef, ok := typeSpec.(*compile.TypedefSpec); ok && n.typeHint(typeSpec) == nil {
+		return annotateTypedef(typedef, result), nil
+	}
+	return result, nil
+}
+
+func valueFromWireType(n *nesting, typeSpec compile.TypeSpec, w wire.Value) (interface{}, error) {
+	spec := resolveTypedef(typeSpec)
 	if spec.TypeCode() != w.Type() {
 		return nil, specTypeMismatch{specified: spec.TypeCode(), got: w.Type()}
 	}
 
+	if h := n.typeHint(typeSpec); h != nil {
+		return h.fromWire(n, w), nil
+	}
+
+	if isNested(spec.TypeCode()) {
+		if n.timedOut() {
+			return n.truncatedValue(), nil
+		}
+		if err := n.enter(nil); err != nil {
+			return nil, specValueMismatch{typeName(typeSpec), err}
+		}
+		defer n.leave(nil)
+	}
+
 	var result interface{}
 	var err error
 
@@ -146,26 +227,29 @@ func valueFromWire(spec compile.TypeSpec, w wire.Value) (interface{}, error) {
 	case wire.TDouble:
 		result = w.GetDouble()
 	case wire.TBinary:
-		// Binary could be a string, or actual []byte
+		// Binary could be a string, or actual binary data, which uses the same
+		// representation as binary inputs so it is distinguishable from strings.
 		if spec == compile.StringSpec {
 			result = w.GetString()
 		} else {
-			result = w.GetBinary()
+			result = map[string]interface{}{
+				"base64": base64.StdEncoding.EncodeToString(w.GetBinary()),
+			}
 		}
 	case wire.TStruct:
-		result, err = valueFromWireStruct(spec.(*compile.StructSpec), w.GetStruct())
+		result, err = valueFromWireStruct(n, spec.(*compile.StructSpec), w.GetStruct())
 	case wire.TList:
-		result, err = valueFromWireList(spec.(*compile.ListSpec), w.GetList())
+		result, err = valueFromWireList(n, spec.(*compile.ListSpec), w.GetList())
 	case wire.TSet:
-		result, err = valueFromWireSet(spec.(*compile.SetSpec), w.GetSet())
+		result, err = valueFromWireSet(n, spec.(*compile.SetSpec), w.GetSet())
 	case wire.TMap:
-		result, err = valueFromWireMap(spec.(*compile.MapSpec), w.GetMap())
+		result, err = valueFromWireMap(n, spec.(*compile.MapSpec), w.GetMap())
 	default:
 		panic(fmt.Sprintf("valueFromWire got an unknown type: %v", spec))
 	}
 
 	if err != nil {
-		return nil, specValueMismatch{spec.ThriftName(), err}
+		return nil, specValueMismatch{typeName(typeSpec), err}
 	}
 	return result, nil
 }
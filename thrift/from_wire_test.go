@@ -116,7 +116,52 @@ func TestValueFromWireSuccess(t *testing.T) {
 		{
 			w:    wire.NewValueBinary([]byte("foo")),
 			spec: compile.BinarySpec,
-			v:    []byte("foo"),
+			v:    map[string]interface{}{"base64": "Zm9v"},
+		},
+		{
+			// typedef string UUID
+			w:    wire.NewValueString("uuid"),
+			spec: &compile.TypedefSpec{Name: "UUID", Target: compile.StringSpec},
+			v:    "uuid",
+		},
+		{
+			// typedef S T, where struct S {1: s string}
+			w: wire.NewValueStruct(wire.Struct{
+				Fields: []wire.Field{{ID: 1, Value: wire.NewValueString("foo")}},
+			}),
+			spec: &compile.TypedefSpec{Name: "T", Target: &compile.StructSpec{
+				Name: "S",
+				Type: ast.StructType,
+				Fields: compile.FieldGroup{{
+					ID:   1,
+					Name: "s",
+					Type: compile.StringSpec,
+				}},
+			}},
+			v: map[string]interface{}{"s": "foo"},
+		},
+		{
+			// list<i8> is distinguishable from binary.
+			w: makeWireList(wire.TI8, 2, func(i int) wire.Value {
+				return wire.NewValueI8(int8(i))
+			}),
+			spec: &compile.ListSpec{ValueSpec: compile.I8Spec},
+			v:    []interface{}{int8(0), int8(1)},
+		},
+		{
+			// union U {1: string s, 2: string t = 'foo'}, defaults are not set for unions.
+			w: wire.NewValueStruct(wire.Struct{
+				Fields: []wire.Field{{ID: 1, Value: wire.NewValueString("bar")}},
+			}),
+			spec: &compile.StructSpec{
+				Name: "U",
+				Type: ast.UnionType,
+				Fields: compile.FieldGroup{
+					{ID: 1, Name: "s", Type: compile.StringSpec},
+					{ID: 2, Name: "t", Type: compile.StringSpec, Default: compile.ConstantString("foo")},
+				},
+			},
+			v: map[string]interface{}{"s": "bar"},
 		},
 		{
 			w: makeWireList(wire.TI32, 4, func(i int) wire.Value {
@@ -198,8 +243,7 @@ func TestValueFromWireSuccess(t *testing.T) {
 			},
 		},
 		{
-			// struct S {}, unknown field shouldn't cause an error.
-			// TODO: should we add unknown fields to the result with a special _unknown_field_1 key?
+			// struct S {}, unknown fields are returned under a reserved key.
 			w: wire.NewValueStruct(wire.Struct{
 				Fields: []wire.Field{{
 					ID:    1,
@@ -211,7 +255,11 @@ func TestValueFromWireSuccess(t *testing.T) {
 				Type:   ast.StructType,
 				Fields: compile.FieldGroup{},
 			},
-			v: map[string]interface{}{},
+			v: map[string]interface{}{
+				"_unknown": []interface{}{
+					map[string]interface{}{"id": int16(1), "type": "binary", "value": "foo"},
+				},
+			},
 		},
 		{
 			// struct S {1: optional string s = 'foo'}, default fields should always be set.
@@ -233,13 +281,71 @@ func TestValueFromWireSuccess(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		got, err := valueFromWire(tt.spec, tt.w)
+		got, err := valueFromWire(newNesting(Options{}), tt.spec, tt.w)
 		if assert.NoError(t, err, "Failed for (%v, %v)", tt.spec, tt.w) {
 			assert.Equal(t, tt.v, got, "Unexpected value for (%v, %v)", tt.spec, tt.w)
 		}
 	}
 }
 
+func TestValueFromWireAnnotateTypedefs(t *testing.T) {
+	uuid := &compile.TypedefSpec{Name: "UUID", Target: compile.StringSpec}
+	userID := &compile.TypedefSpec{Name: "UserID", Target: uuid}
+
+	tests := []struct {
+		msg  string
+		w    wire.Value
+		spec compile.TypeSpec
+		v    interface{}
+	}{
+		{
+			msg:  "typedef string UUID",
+			w:    wire.NewValueString("uuid"),
+			spec: uuid,
+			v:    map[string]interface{}{TypedefKey: "UUID", TypedefValueKey: "uuid"},
+		},
+		{
+			msg:  "typedef of typedef uses the outer name",
+			w:    wire.NewValueString("uuid"),
+			spec: userID,
+			v:    map[string]interface{}{TypedefKey: "UserID", TypedefValueKey: "uuid"},
+		},
+		{
+			msg: "list<UUID>",
+			w: makeWireList(wire.TBinary, 1, func(i int) wire.Value {
+				return wire.NewValueString("uuid")
+			}),
+			spec: &compile.ListSpec{ValueSpec: uuid},
+			v: []interface{}{
+				map[string]interface{}{TypedefKey: "UUID", TypedefValueKey: "uuid"},
+			},
+		},
+		{
+			msg: "map<UUID, UUID> keys are not wrapped",
+			w: makeWireMap(wire.TBinary, wire.TBinary, 1, func(i int) (wire.Value, wire.Value) {
+				return wire.NewValueString("k"), wire.NewValueString("v")
+			}),
+			spec: &compile.MapSpec{KeySpec: uuid, ValueSpec: uuid},
+			v: map[string]interface{}{
+				"k": map[string]interface{}{TypedefKey: "UUID", TypedefValueKey: "v"},
+			},
+		},
+		{
+			msg:  "non-typedefs are not wrapped",
+			w:    wire.NewValueString("foo"),
+			spec: compile.StringSpec,
+			v:    "foo",
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := valueFromWire(newNesting(Options{AnnotateTypedefs: true}), tt.spec, tt.w)
+		if assert.NoError(t, err, "%v: failed", tt.msg) {
+			assert.Equal(t, tt.v, got, "%v: unexpected value", tt.msg)
+		}
+	}
+}
+
 func TestValueFromWireError(t *testing.T) {
 	tests := []struct {
 		w    wire.Value
@@ -259,6 +365,24 @@ func TestValueFromWireError(t *testing.T) {
 			spec: compile.I8Spec,
 			err:  specTypeMismatch{specified: wire.TI8, got: wire.TI16},
 		},
+		{
+			msg: "typedef T of struct S with invalid field",
+			w: wire.NewValueStruct(wire.Struct{
+				Fields: []wire.Field{{ID: 1, Value: wire.NewValueI32(1)}},
+			}),
+			spec: &compile.TypedefSpec{Name: "T", Target: &compile.StructSpec{
+				Name: "S",
+				Type: ast.StructType,
+				Fields: compile.FieldGroup{{
+					ID:   1,
+					Name: "s",
+					Type: compile.StringSpec,
+				}},
+			}},
+			err: specValueMismatch{"T (typedef of S)",
+				specStructFieldMismatch{"s", specTypeMismatch{specified: wire.TBinary, got: wire.TI32}},
+			},
+		},
 		{
 			msg:  "i16 -> list<i16>",
 			w:    wire.NewValueI16(1),
@@ -321,7 +445,7 @@ func TestValueFromWireError(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		got, err := valueFromWire(tt.spec, tt.w)
+		got, err := valueFromWire(newNesting(Options{}), tt.spec, tt.w)
 		if !assert.Error(t, err, "Expected error for %v", tt.msg) {
 			continue
 		}
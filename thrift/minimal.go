@@ -0,0 +1,93 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package thrift
+
+import (
+	"github.com/thriftrw/thriftrw-go/ast"
+	"github.com/thriftrw/thriftrw-go/compile"
+	"github.com/thriftrw/thriftrw-go/wire"
+)
+
+// maxMinimalDepth limits how deeply required structs are filled in, since
+// a struct can require itself and never have a valid value.
+const maxMinimalDepth = 32
+
+// MinimalRequest returns the smallest request for the given method, which
+// only sets required arguments and fields that do not have a default,
+// using zero values.
+func MinimalRequest(method *compile.FunctionSpec) map[string]interface{} {
+	return minimalFields(compile.FieldGroup(method.ArgsSpec), false, 0)
+}
+
+func minimalFields(fields compile.FieldGroup, union bool, depth int) map[string]interface{} {
+	result := make(map[string]interface{})
+	if depth >= maxMinimalDepth {
+		return result
+	}
+
+	// A union must have a single field set, so use the field with the lowest ID.
+	if union {
+		var first *compile.FieldSpec
+		for _, f := range fields {
+			if first == nil || f.ID < first.ID {
+				first = f
+			}
+		}
+		if first != nil {
+			result[first.Name] = minimalValue(first.Type, depth+1)
+		}
+		return result
+	}
+
+	for _, f := range fields {
+		if f.Required && f.Default == nil {
+			result[f.Name] = minimalValue(f.Type, depth+1)
+		}
+	}
+	return result
+}
+
+// minimalValue returns the zero value for the given type.
+func minimalValue(spec compile.TypeSpec, depth int) interface{} {
+	switch spec := resolveTypedef(spec).(type) {
+	case *compile.EnumSpec:
+		if len(spec.Items) > 0 {
+			return int(spec.Items[0].Value)
+		}
+		return 0
+	case *compile.StructSpec:
+		return minimalFields(spec.Fields, spec.Type == ast.UnionType, depth)
+	case *compile.ListSpec, *compile.SetSpec:
+		return []interface{}{}
+	case *compile.MapSpec:
+		return map[string]interface{}{}
+	}
+
+	switch spec.TypeCode() {
+	case wire.TBool:
+		return false
+	case wire.TDouble:
+		return 0.0
+	case wire.TBinary:
+		return ""
+	}
+	return 0
+}
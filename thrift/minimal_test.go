@@ -0,0 +1,88 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package thrift
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMinimalRequest(t *testing.T) {
+	specs := getFuncSpecs(t, `
+    enum Status { Active = 2, Inactive = 3 }
+    typedef string UUID
+    union U {
+      2: string b
+      1: i32 a
+    }
+    struct Node {
+      1: required Node next
+    }
+    struct S {
+      1: required bool b
+      2: required i64 i
+      3: required double d
+      4: required UUID id
+      5: required binary bs
+      6: required Status status
+      7: required list<string> l
+      8: required set<i32> st
+      9: required map<string, i32> m
+      10: required U u
+      11: optional string opt
+      12: required string def = "default"
+    }
+    service Test {
+      void f(1: required S s, 2: string opt)
+      void recursive(1: required Node node)
+    }
+  `)
+	spec := specs["f"]
+
+	got := MinimalRequest(spec)
+	assert.Equal(t, map[string]interface{}{
+		"b":      false,
+		"i":      0,
+		"d":      0.0,
+		"id":     "",
+		"bs":     "",
+		"status": 2,
+		"l":      []interface{}{},
+		"st":     []interface{}{},
+		"m":      map[string]interface{}{},
+		"u":      map[string]interface{}{"a": 0},
+	}, got["s"], "unexpected minimal struct")
+	assert.NotContains(t, got, "opt", "optional arguments should not be set")
+
+	_, err := RequestToBytes(spec, got, Options{})
+	assert.NoError(t, err, "minimal request should be valid")
+
+	// Required recursive structs can't have a valid value, so they are only
+	// filled in up to a limit.
+	depth := 1
+	node := MinimalRequest(specs["recursive"])["node"].(map[string]interface{})
+	for node["next"] != nil {
+		node = node["next"].(map[string]interface{})
+		depth++
+	}
+	assert.Equal(t, maxMinimalDepth, depth, "unexpected depth for recursive struct")
+}
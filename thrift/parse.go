@@ -62,8 +62,8 @@ func SplitMethod(fullMethod string) (svc, method string, err error) {
 
 // RequestToBytes takes a user request and converts it to the Thrift binary payload.
 // It uses the method spec to convert the user request.
-func RequestToBytes(method *compile.FunctionSpec, request map[string]interface{}) ([]byte, error) {
-	w, err := structToValue(compile.FieldGroup(method.ArgsSpec), request)
+func RequestToBytes(method *compile.FunctionSpec, request map[string]interface{}, opts Options) ([]byte, error) {
+	w, err := structToValue(newNesting(opts), compile.FieldGroup(method.ArgsSpec), request)
 	if err != nil {
 		return nil, err
 	}
@@ -116,7 +116,10 @@ func TestParseRequest(t *testing.T) {
 			request: map[string]interface{}{
 				"foo2": 1,
 			},
-			errMsg: fieldGroupError{notFound: []string{"foo2"}}.Error(),
+			errMsg: fieldGroupError{
+				notFound:    []string{"foo2"},
+				suggestions: map[string]string{"foo2": "foo"},
+			}.Error(),
 		},
 		{
 			// Set numbers and bools
@@ -142,7 +145,7 @@ func TestParseRequest(t *testing.T) {
 			request: map[string]interface{}{
 				"arg1": "asd",
 			},
-			errMsg: `field "byte" cannot parse int8 from string: asd`,
+			errMsg: `arg1 expects byte, got string: cannot parse int8 from string: asd`,
 		},
 		{
 			// Set the typedef
@@ -286,7 +289,7 @@ func TestParseRequest(t *testing.T) {
 			request: map[string]interface{}{
 				"str_list": []interface{}{"a", 1, "c"},
 			},
-			errMsg: "list item failed",
+			errMsg: "str_list[1] expects string, got integer",
 		},
 		{
 			request: map[string]interface{}{
@@ -381,7 +384,7 @@ func TestParseRequest(t *testing.T) {
 					"asd": 1,
 				},
 			},
-			errMsg: "map key (asd) failed",
+			errMsg: "b_i_map[asd] key expects bool, got string",
 		},
 		{
 			// map value type is wrong.
@@ -390,7 +393,7 @@ func TestParseRequest(t *testing.T) {
 					"true": "asd",
 				},
 			},
-			errMsg: "map value (asd) for key (true) failed",
+			errMsg: "b_i_map[true] expects i32, got string",
 		},
 		{
 			// use fuzzy matching to set fields.
@@ -415,7 +418,10 @@ func TestParseRequest(t *testing.T) {
 					"NS": "asd",
 				},
 			},
-			errMsg: fieldGroupError{notFound: []string{"NS"}}.Error(),
+			errMsg: "s: " + fieldGroupError{
+				notFound:    []string{"NS"},
+				suggestions: map[string]string{"NS": "ns"},
+			}.Error(),
 		},
 		{
 			// allow specifying fields by field ID
@@ -441,7 +447,7 @@ func TestParseRequest(t *testing.T) {
 
 	for _, tt := range tests {
 		req := map[string]interface{}(tt.request)
-		got, err := structToValue(compile.FieldGroup(funcSpec.ArgsSpec), req)
+		got, err := structToValue(newNesting(Options{}), compile.FieldGroup(funcSpec.ArgsSpec), req)
 		if tt.errMsg != "" {
 			if assert.Error(t, err, "Expected error for %v", req) {
 				assert.Contains(t, err.Error(), tt.errMsg, "Unexpected error for %v", req)
@@ -547,7 +553,7 @@ func TestRequestToBytes(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		_, err := RequestToBytes(funcSpec, tt.request)
+		_, err := RequestToBytes(funcSpec, tt.request, Options{})
 		assert.Equal(t, tt.wantErr, err != nil, "wantErr %v for %v", tt.wantErr, tt.request)
 	}
 }
@@ -22,6 +22,8 @@ package thrift
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
 
 	"github.com/thriftrw/thriftrw-go/compile"
@@ -31,7 +33,7 @@ import (
 
 // ResponseBytesToMap takes the given response bytes and creates a map that
 // uses field name as keys.
-func ResponseBytesToMap(spec *compile.FunctionSpec, responseBytes []byte) (map[string]interface{}, error) {
+func ResponseBytesToMap(spec *compile.FunctionSpec, responseBytes []byte, opts Options) (map[string]interface{}, error) {
 	w, err := responseBytesToWire(responseBytes)
 	if err != nil {
 		return nil, err
@@ -42,6 +44,7 @@ func ResponseBytesToMap(spec *compile.FunctionSpec, responseBytes []byte) (map[s
 		specs = getFieldMap(spec.ResultSpec.Exceptions)
 	}
 
+	n := newNesting(opts)
 	result := make(map[string]interface{})
 	for _, f := range w.Fields {
 		err = nil
@@ -50,20 +53,23 @@ func ResponseBytesToMap(spec *compile.FunctionSpec, responseBytes []byte) (map[s
 			if spec.ResultSpec == nil || spec.ResultSpec.ReturnType == nil {
 				return nil, fmt.Errorf("got unexpected result for void method: %v", f.Value)
 			}
-			result["result"], err = valueFromWire(spec.ResultSpec.ReturnType, f.Value)
+			result["result"], err = valueFromWire(n, spec.ResultSpec.ReturnType, f.Value)
 		} else {
 			exSpec, ok := specs[f.ID]
 			if !ok {
 				return nil, fmt.Errorf("got unknown exception with ID %v: %v", f.ID, f.Value)
 			}
 
-			result[exSpec.Name], err = valueFromWire(exSpec.Type, f.Value)
+			result[exSpec.Name], err = valueFromWireField(n, exSpec, f.Value)
 		}
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse result field %v: %v", f.ID, err)
 		}
 	}
 
+	if n.truncated != "" {
+		result[TruncatedKey] = n.truncated
+	}
 	return result, nil
 }
 
@@ -111,6 +117,46 @@ func CheckSuccess(spec *compile.FunctionSpec, responseBytes []byte) error {
 	return nil
 }
 
+// CheckSuccessPrefix is similar to CheckSuccess, but only uses the start of
+// the response, so it can be used when the full response is not available.
+// Only the first field in the result is checked.
+func CheckSuccessPrefix(spec *compile.FunctionSpec, prefix []byte) error {
+	if len(prefix) == 0 {
+		return errors.New("could not deserialize result: empty response")
+	}
+
+	hasField := prefix[0] != stopField
+	var fieldID int16
+	if hasField {
+		if len(prefix) < 3 {
+			return errors.New("could not deserialize result: incomplete field header")
+		}
+		fieldID = int16(binary.BigEndian.Uint16(prefix[1:3]))
+	}
+
+	if spec.ResultSpec == nil || spec.ResultSpec.ReturnType == nil {
+		if !hasField {
+			return nil
+		}
+		if fieldID == 0 {
+			return fmt.Errorf("void method got unexpected result, field ID: %v", fieldID)
+		}
+		return fmt.Errorf("void method got exception: %s", checkException(spec, fieldID))
+	}
+
+	if !hasField {
+		return errors.New("method with return did not get 1 field in result")
+	}
+	if fieldID != 0 {
+		return fmt.Errorf("method with return got exception: %s", checkException(spec, fieldID))
+	}
+
+	return nil
+}
+
+// stopField is the field type that marks the end of a struct in the binary protocol.
+const stopField = 0
+
 func responseBytesToWire(responseBytes []byte) (wire.Struct, error) {
 	w, err := protocol.Binary.Decode(bytes.NewReader(responseBytes), wire.TStruct)
 	if err != nil {
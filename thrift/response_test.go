@@ -128,7 +128,7 @@ func TestResponseBytesToMap(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		got, err := ResponseBytesToMap(tt.spec, tt.bs)
+		got, err := ResponseBytesToMap(tt.spec, tt.bs, Options{})
 		if tt.errMsg != "" {
 			if assert.Error(t, err, "Expected error for %v", tt.msg) {
 				assert.Contains(t, err.Error(), tt.errMsg, "Error mismatch for %v", tt.msg)
@@ -333,3 +333,82 @@ func TestCheckSuccess(t *testing.T) {
 		}
 	}
 }
+
+func TestCheckSuccessPrefix(t *testing.T) {
+	funcSpecs := getFuncSpecs(t, `
+    exception E {
+      1: required string reason
+    }
+    service Test {
+      void m1()
+      i32 m2()
+      i32 m2Ex() throws (1: E e)
+    }
+  `)
+
+	onlyResult := encodeWire(wire.NewValueStruct(wire.Struct{Fields: []wire.Field{
+		{ID: 0, Value: wire.NewValueI32(0)},
+	}}))
+	onlyEx := encodeWire(wire.NewValueStruct(wire.Struct{Fields: []wire.Field{
+		{ID: 1, Value: wire.NewValueStruct(wire.Struct{})},
+	}}))
+
+	tests := []struct {
+		msg    string
+		method string
+		bs     []byte
+		errMsg string
+	}{
+		{
+			msg:    "empty response",
+			method: "m1",
+			errMsg: "could not deserialize",
+		},
+		{
+			msg:    "incomplete field header",
+			method: "m2",
+			bs:     onlyResult[:2],
+			errMsg: "could not deserialize",
+		},
+		{
+			msg:    "void success",
+			method: "m1",
+			bs:     encodeWire(wire.NewValueStruct(wire.Struct{})),
+		},
+		{
+			msg:    "unexpected result for void method",
+			method: "m1",
+			bs:     onlyResult[:3],
+			errMsg: "void method got unexpected result",
+		},
+		{
+			msg:    "i32 return got no result",
+			method: "m2",
+			bs:     []byte{0},
+			errMsg: "method with return did not get 1 field",
+		},
+		{
+			msg:    "i32 return success",
+			method: "m2",
+			bs:     onlyResult[:3],
+		},
+		{
+			msg:    "i32 return with exception got exception",
+			method: "m2Ex",
+			bs:     onlyEx[:4],
+			errMsg: "method with return got exception: e E",
+		},
+	}
+
+	for _, tt := range tests {
+		err := CheckSuccessPrefix(funcSpecs[tt.method], tt.bs)
+		if tt.errMsg == "" {
+			assert.NoError(t, err, "%v: CheckSuccessPrefix should not fail", tt.msg)
+			continue
+		}
+
+		if assert.Error(t, err, "%v: CheckSuccessPrefix should fail with: %v", tt.msg, tt.errMsg) {
+			assert.Contains(t, err.Error(), tt.errMsg, "%v: CheckSuccessPrefix invalid error", tt.msg)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package thrift
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/thriftrw/thriftrw-go/ast"
+	"github.com/thriftrw/thriftrw-go/compile"
+	"github.com/thriftrw/thriftrw-go/wire"
+)
+
+// jsonSchemaDraft is the JSON Schema version of the schemas returned by ResponseSchema.
+const jsonSchemaDraft = "http://json-schema.org/draft-04/schema#"
+
+// schemaBuilder builds a JSON Schema, with a definition for each struct so
+// that recursive structs can be described.
+type schemaBuilder struct {
+	annotations *Annotations
+	definitions map[string]interface{}
+	names       map[*compile.StructSpec]string
+
+	// truncates is set if containers may be truncated, and timesOut is set
+	// if any nested value may be replaced with a truncation marker.
+	truncates bool
+	timesOut  bool
+
+	annotateTypedefs bool
+}
+
+// ResponseSchema returns a JSON Schema describing the responses returned by
+// ResponseBytesToMap for the given method, which contain either the result
+// or a single exception. Annotations in opts are used to describe annotated
+// values using their annotated representation, and the truncation markers
+// are described if opts limits how responses are converted.
+func ResponseSchema(title string, spec *compile.FunctionSpec, opts Options) map[string]interface{} {
+	b := &schemaBuilder{
+		annotations: opts.Annotations,
+		definitions: make(map[string]interface{}),
+		names:       make(map[*compile.StructSpec]string),
+		truncates:   opts.MaxContainerSize > 0 || opts.DecodeTimeout > 0,
+		timesOut:    opts.DecodeTimeout > 0,
+
+		annotateTypedefs: opts.AnnotateTypedefs,
+	}
+
+	properties := make(map[string]interface{})
+	if spec.ResultSpec != nil {
+		if spec.ResultSpec.ReturnType != nil {
+			properties["result"] = b.typeSchema(spec.ResultSpec.ReturnType)
+		}
+		for _, ex := range spec.ResultSpec.Exceptions {
+			properties[ex.Name] = b.fieldSchema(ex)
+		}
+	}
+
+	schema := map[string]interface{}{
+		"$schema":              jsonSchemaDraft,
+		"title":                title,
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+		"maxProperties":        1,
+	}
+	if b.truncates {
+		// Truncated responses also have the reason they were truncated.
+		properties[TruncatedKey] = map[string]interface{}{"type": "string"}
+		delete(schema, "maxProperties")
+		schema["anyOf"] = maxPropertiesWith(1, TruncatedKey)
+	}
+	if len(b.definitions) > 0 {
+		schema["definitions"] = b.definitions
+	}
+	return schema
+}
+
+func (b *schemaBuilder) fieldSchema(spec *compile.FieldSpec) map[string]interface{} {
+	if b.annotations != nil {
+		if h, ok := b.annotations.fields[spec]; ok {
+			return h.schema()
+		}
+	}
+	return b.typeSchema(spec.Type)
+}
+
+func (b *schemaBuilder) typeSchema(spec compile.TypeSpec) map[string]interface{} {
+	if b.annotations != nil {
+		for t := spec; ; {
+			typedef, ok := t.(*compile.TypedefSpec)
+			if !ok {
+				break
+			}
+			if h, ok := b.annotations.typedefs[typedef]; ok {
+				return h.schema()
+			}
+			t = typedef.Target
+		}
+	}
+
+	schema := b.valueSchema(resolveTypedef(spec))
+	if typedef, ok := spec.(*compile.TypedefSpec); ok && b.annotateTypedefs {
+		return map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				TypedefKey:      map[string]interface{}{"enum": []interface{}{typedef.Name}},
+				TypedefValueKey: schema,
+			},
+			"required":             []string{TypedefKey, TypedefValueKey},
+			"additionalProperties": false,
+		}
+	}
+	return schema
+}
+
+// valueSchema returns the schema for values of a type that is not a typedef.
+func (b *schemaBuilder) valueSchema(spec compile.TypeSpec) map[string]interface{} {
+	switch spec := spec.(type) {
+	case *compile.EnumSpec:
+		values := make([]interface{}, len(spec.Items))
+		for i, item := range spec.Items {
+			values[i] = item.Value
+		}
+		return map[string]interface{}{"type": "integer", "enum": values}
+	case *compile.StructSpec:
+		return b.nestedSchema(map[string]interface{}{"$ref": "#/definitions/" + b.structDefinition(spec)})
+	case *compile.ListSpec:
+		return b.nestedSchema(b.listSchema(spec.ValueSpec))
+	case *compile.SetSpec:
+		return b.nestedSchema(b.listSchema(spec.ValueSpec))
+	case *compile.MapSpec:
+		return b.nestedSchema(b.mapSchema(spec.ValueSpec))
+	}
+
+	switch spec.TypeCode() {
+	case wire.TBool:
+		return map[string]interface{}{"type": "boolean"}
+	case wire.TI8:
+		return intSchema(8)
+	case wire.TI16:
+		return intSchema(16)
+	case wire.TI32:
+		return intSchema(32)
+	case wire.TI64:
+		return map[string]interface{}{"type": "integer"}
+	case wire.TDouble:
+		return map[string]interface{}{"type": "number"}
+	}
+
+	if spec == compile.StringSpec {
+		return map[string]interface{}{"type": "string"}
+	}
+	// Binary values use the same representation as binary inputs.
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           map[string]interface{}{"base64": map[string]interface{}{"type": "string"}},
+		"required":             []string{"base64"},
+		"additionalProperties": false,
+	}
+}
+
+// structDefinition adds the definition for a struct, and returns its name.
+func (b *schemaBuilder) structDefinition(spec *compile.StructSpec) string {
+	if name, ok := b.names[spec]; ok {
+		return name
+	}
+
+	// Structs in different files may have the same name, so they are
+	// qualified by the file's name.
+	name := spec.Name
+	if _, ok := b.definitions[name]; ok {
+		name = strings.TrimSuffix(filepath.Base(spec.File), ".thrift") + "." + spec.Name
+	}
+	b.names[spec] = name
+	b.definitions[name] = nil
+
+	properties := make(map[string]interface{})
+	var required []string
+	for _, f := range spec.Fields {
+		properties[f.Name] = b.fieldSchema(f)
+		if f.Required {
+			required = append(required, f.Name)
+		}
+	}
+	properties[UnknownFieldsKey] = unknownFieldsSchema()
+
+	definition := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	switch {
+	case spec.Type == ast.UnionType:
+		// Only the set field of a union is returned, along with any unknown fields.
+		definition["minProperties"] = 1
+		definition["anyOf"] = maxPropertiesWith(1, UnknownFieldsKey)
+	case len(required) > 0:
+		definition["required"] = required
+	}
+	b.definitions[name] = definition
+	return name
+}
+
+// nestedSchema returns the schema for a struct or container, which may be
+// replaced with a truncation marker if decoding times out.
+func (b *schemaBuilder) nestedSchema(schema map[string]interface{}) map[string]interface{} {
+	if !b.timesOut {
+		return schema
+	}
+	return map[string]interface{}{
+		"anyOf": []interface{}{schema, markerSchema(`^<truncated: .*>$`)},
+	}
+}
+
+func (b *schemaBuilder) listSchema(valueSpec compile.TypeSpec) map[string]interface{} {
+	items := b.typeSchema(valueSpec)
+	if b.truncates {
+		// Truncated lists and sets end with a marker for the dropped items.
+		items = map[string]interface{}{
+			"anyOf": []interface{}{items, markerSchema(`^<[0-9]+ of [0-9]+ items truncated>$`)},
+		}
+	}
+	return map[string]interface{}{"type": "array", "items": items}
+}
+
+func (b *schemaBuilder) mapSchema(valueSpec compile.TypeSpec) map[string]interface{} {
+	// Map keys are always strings, as non-string keys are marshalled to JSON.
+	schema := map[string]interface{}{"type": "object", "additionalProperties": b.typeSchema(valueSpec)}
+	if b.truncates {
+		// Truncated maps have a marker for the dropped entries.
+		schema["properties"] = map[string]interface{}{
+			TruncatedKey: markerSchema(`^<[0-9]+ of [0-9]+ entries truncated>$`),
+		}
+	}
+	return schema
+}
+
+// markerSchema describes a truncation marker matching pattern.
+func markerSchema(pattern string) map[string]interface{} {
+	return map[string]interface{}{"type": "string", "pattern": pattern}
+}
+
+// unknownFieldsSchema describes the fields listed under UnknownFieldsKey.
+// Their values may be of any type, as they have no spec.
+func unknownFieldsSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "array",
+		"items": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"id":    map[string]interface{}{"type": "integer"},
+				"type":  map[string]interface{}{"type": "string"},
+				"value": map[string]interface{}{},
+			},
+			"required":             []string{"id", "type", "value"},
+			"additionalProperties": false,
+		},
+	}
+}
+
+// maxPropertiesWith returns the alternatives that allow an object to have
+// at most max properties, or one more if it has the given key.
+func maxPropertiesWith(max int, key string) []interface{} {
+	return []interface{}{
+		map[string]interface{}{"maxProperties": max},
+		map[string]interface{}{"maxProperties": max + 1, "required": []string{key}},
+	}
+}
+
+func intSchema(bits uint) map[string]interface{} {
+	max := int64(1)<<(bits-1) - 1
+	return map[string]interface{}{
+		"type":    "integer",
+		"minimum": -max - 1,
+		"maximum": max,
+	}
+}
+
+// schema returns the JSON Schema for values in the hint's representation.
+func (h *hint) schema() map[string]interface{} {
+	schema := map[string]interface{}{
+		"type":        "string",
+		"description": h.annotation,
+	}
+	switch h.format {
+	case hintDate:
+		schema["format"] = "date-time"
+	case hintLong:
+		schema["pattern"] = `^-?[0-9]+$`
+	case hintBase64:
+		schema["pattern"] = `^[A-Za-z0-9+/]*=*$`
+	}
+	return schema
+}
@@ -0,0 +1,217 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package thrift
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseSchema(t *testing.T) {
+	specs := getFuncSpecs(t, `
+    enum Status { Active = 1, Inactive = 2 }
+    typedef string UUID
+    struct Node {
+      1: required UUID id
+      2: optional Node next
+      3: optional Status status
+    }
+    union Value {
+      1: i8 small
+      2: binary data
+    }
+    exception NotFound {
+      1: optional string message
+    }
+    service Test {
+      Node get(1: string id) throws (1: NotFound notFound)
+      map<string, list<Value>> values()
+      void ping()
+    }
+  `)
+
+	tests := []struct {
+		method string
+		want   string
+	}{
+		{
+			method: "get",
+			want: `{
+        "$schema": "http://json-schema.org/draft-04/schema#",
+        "title": "Test::get response",
+        "type": "object",
+        "additionalProperties": false,
+        "maxProperties": 1,
+        "properties": {
+          "result": {"$ref": "#/definitions/Node"},
+          "notFound": {"$ref": "#/definitions/NotFound"}
+        },
+        "definitions": {
+          "Node": {
+            "type": "object",
+            "additionalProperties": false,
+            "required": ["id"],
+            "properties": {
+              "id": {"type": "string"},
+              "next": {"$ref": "#/definitions/Node"},
+              "status": {"type": "integer", "enum": [1, 2]},
+              "_unknown": {
+                "type": "array",
+                "items": {
+                  "type": "object",
+                  "additionalProperties": false,
+                  "required": ["id", "type", "value"],
+                  "properties": {"id": {"type": "integer"}, "type": {"type": "string"}, "value": {}}
+                }
+              }
+            }
+          },
+          "NotFound": {
+            "type": "object",
+            "additionalProperties": false,
+            "properties": {
+              "message": {"type": "string"},
+              "_unknown": {
+                "type": "array",
+                "items": {
+                  "type": "object",
+                  "additionalProperties": false,
+                  "required": ["id", "type", "value"],
+                  "properties": {"id": {"type": "integer"}, "type": {"type": "string"}, "value": {}}
+                }
+              }
+            }
+          }
+        }
+      }`,
+		},
+		{
+			method: "values",
+			want: `{
+        "$schema": "http://json-schema.org/draft-04/schema#",
+        "title": "Test::values response",
+        "type": "object",
+        "additionalProperties": false,
+        "maxProperties": 1,
+        "properties": {
+          "result": {
+            "type": "object",
+            "additionalProperties": {"type": "array", "items": {"$ref": "#/definitions/Value"}}
+          }
+        },
+        "definitions": {
+          "Value": {
+            "type": "object",
+            "additionalProperties": false,
+            "minProperties": 1,
+            "anyOf": [
+              {"maxProperties": 1},
+              {"maxProperties": 2, "required": ["_unknown"]}
+            ],
+            "properties": {
+              "small": {"type": "integer", "minimum": -128, "maximum": 127},
+              "data": {
+                "type": "object",
+                "additionalProperties": false,
+                "required": ["base64"],
+                "properties": {"base64": {"type": "string"}}
+              },
+              "_unknown": {
+                "type": "array",
+                "items": {
+                  "type": "object",
+                  "additionalProperties": false,
+                  "required": ["id", "type", "value"],
+                  "properties": {"id": {"type": "integer"}, "type": {"type": "string"}, "value": {}}
+                }
+              }
+            }
+          }
+        }
+      }`,
+		},
+		{
+			method: "ping",
+			want: `{
+        "$schema": "http://json-schema.org/draft-04/schema#",
+        "title": "Test::ping response",
+        "type": "object",
+        "additionalProperties": false,
+        "maxProperties": 1,
+        "properties": {}
+      }`,
+		},
+	}
+
+	for _, tt := range tests {
+		schema := ResponseSchema("Test::"+tt.method+" response", specs[tt.method], Options{})
+		got, err := json.Marshal(schema)
+		require.NoError(t, err, "%v: failed to marshal schema", tt.method)
+		assert.JSONEq(t, tt.want, string(got), "%v: unexpected schema", tt.method)
+	}
+}
+
+func TestResponseSchemaAnnotateTypedefs(t *testing.T) {
+	specs := getFuncSpecs(t, `
+    typedef string UUID
+    typedef UUID UserID
+    service Test {
+      UserID get()
+    }
+  `)
+
+	schema := ResponseSchema("Test::get response", specs["get"], Options{AnnotateTypedefs: true})
+	got, err := json.Marshal(schema["properties"].(map[string]interface{})["result"])
+	require.NoError(t, err, "failed to marshal schema")
+	assert.JSONEq(t, `{
+    "type": "object",
+    "additionalProperties": false,
+    "required": ["_typedef", "_value"],
+    "properties": {
+      "_typedef": {"enum": ["UserID"]},
+      "_value": {"type": "string"}
+    }
+  }`, string(got), "unexpected schema for annotated typedef")
+}
+
+func TestResponseSchemaAnnotations(t *testing.T) {
+	module, annotations, err := parseAnnotated(t, annotatedThrift)
+	require.NoError(t, err, "ParseAnnotations failed")
+
+	schema := ResponseSchema("Test::echo", module.Services["Test"].Functions["echo"], Options{Annotations: annotations})
+	event := schema["definitions"].(map[string]interface{})["Event"].(map[string]interface{})
+	properties := event["properties"].(map[string]interface{})
+
+	assert.Equal(t, map[string]interface{}{
+		"type":        "string",
+		"format":      "date-time",
+		"description": `js.type = "Date"`,
+	}, properties["created"], "unexpected schema for typedef with annotations")
+	assert.Equal(t, map[string]interface{}{
+		"type":        "string",
+		"pattern":     `^-?[0-9]+$`,
+		"description": `js.type = "Long"`,
+	}, properties["id"], "unexpected schema for field with annotations")
+	assert.Equal(t, map[string]interface{}{"type": "integer"}, properties["count"], "unexpected schema for i64")
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package thrift
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yarpc/yab/sorted"
+
+	"github.com/thriftrw/thriftrw-go/compile"
+)
+
+// Service is a service defined in a Thrift file, or in a file it includes.
+type Service struct {
+	// Name is the name used to refer to the service. Services in included
+	// files are qualified with the include names, e.g. shared.Health.
+	Name string
+
+	// File is the path of the Thrift file that defines the service.
+	File string
+
+	Spec *compile.ServiceSpec
+}
+
+// Services returns the services defined in the module, followed by the
+// services in the files it includes. If a file is included multiple times,
+// its services are only returned with the shortest qualified name.
+func Services(module *compile.Module) []Service {
+	type qualifiedModule struct {
+		prefix string
+		module *compile.Module
+	}
+
+	var services []Service
+	visited := make(map[string]struct{})
+	toVisit := []qualifiedModule{{"", module}}
+	for len(toVisit) > 0 {
+		cur := toVisit[0]
+		toVisit = toVisit[1:]
+		if _, ok := visited[cur.module.ThriftPath]; ok {
+			continue
+		}
+		visited[cur.module.ThriftPath] = struct{}{}
+
+		for _, name := range sorted.MapKeys(cur.module.Services) {
+			services = append(services, Service{
+				Name: cur.prefix + name,
+				File: cur.module.ThriftPath,
+				Spec: cur.module.Services[name],
+			})
+		}
+		for _, include := range sorted.MapKeys(cur.module.Includes) {
+			toVisit = append(toVisit, qualifiedModule{cur.prefix + include + ".", cur.module.Includes[include].Module})
+		}
+	}
+	return services
+}
+
+// LookupService returns the service with the given name, which is qualified
+// with the include names for services in included files, e.g. shared.Health.
+func LookupService(module *compile.Module, name string) (*compile.ServiceSpec, error) {
+	parts := strings.Split(name, ".")
+	for _, include := range parts[:len(parts)-1] {
+		included, ok := module.Includes[include]
+		if !ok {
+			return nil, fmt.Errorf("could not find service %q: no included file %q", name, include)
+		}
+		module = included.Module
+	}
+
+	return module.LookupService(parts[len(parts)-1])
+}
+
+// Methods returns the Service::method names of the service's methods,
+// including methods inherited from parent services.
+func (s Service) Methods() []string {
+	var methods []string
+	for svc := s.Spec; svc != nil; svc = svc.Parent {
+		for _, method := range sorted.MapKeys(svc.Functions) {
+			methods = append(methods, s.Name+"::"+method)
+		}
+	}
+	return methods
+}
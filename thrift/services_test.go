@@ -0,0 +1,125 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package thrift
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thriftrw/thriftrw-go/compile"
+)
+
+// parseFiles writes the files to a temporary directory, and compiles main.thrift.
+func parseFiles(t *testing.T, files map[string]string) *compile.Module {
+	dir, err := ioutil.TempDir("", "services")
+	require.NoError(t, err, "TempDir failed")
+	defer os.RemoveAll(dir)
+
+	for name, contents := range files {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644), "WriteFile failed")
+	}
+
+	module, err := compile.Compile(filepath.Join(dir, "main.thrift"))
+	require.NoError(t, err, "Compile failed")
+	return module
+}
+
+var servicesFiles = map[string]string{
+	"main.thrift": `
+		include "./shared.thrift"
+		include "./base.thrift"
+
+		service Users extends base.Base {
+			void get()
+		}
+		service Admin {
+			void reset()
+		}
+	`,
+	"shared.thrift": `
+		include "./base.thrift"
+
+		service Health {
+			bool check()
+		}
+	`,
+	"base.thrift": `
+		service Base {
+			string version()
+		}
+	`,
+}
+
+func TestServices(t *testing.T) {
+	module := parseFiles(t, servicesFiles)
+
+	var names, files []string
+	var methods []string
+	for _, svc := range Services(module) {
+		names = append(names, svc.Name)
+		files = append(files, filepath.Base(svc.File))
+		methods = append(methods, svc.Methods()...)
+	}
+
+	// base.thrift is included twice, but only listed with the shortest name.
+	assert.Equal(t, []string{"Admin", "Users", "base.Base", "shared.Health"}, names, "Unexpected services")
+	assert.Equal(t, []string{"main.thrift", "main.thrift", "base.thrift", "shared.thrift"}, files, "Unexpected files")
+	assert.Equal(t, []string{
+		"Admin::reset",
+		"Users::get",
+		"Users::version",
+		"base.Base::version",
+		"shared.Health::check",
+	}, methods, "Unexpected methods")
+}
+
+func TestLookupService(t *testing.T) {
+	module := parseFiles(t, servicesFiles)
+
+	tests := []struct {
+		name   string
+		want   string
+		errMsg string
+	}{
+		{name: "Users", want: "Users"},
+		{name: "shared.Health", want: "Health"},
+		{name: "shared.base.Base", want: "Base"},
+		{name: "Health", errMsg: "unknown"},
+		{name: "other.Health", errMsg: `could not find service "other.Health": no included file "other"`},
+	}
+
+	for _, tt := range tests {
+		got, err := LookupService(module, tt.name)
+		if tt.errMsg != "" {
+			if assert.Error(t, err, "LookupService(%v) should fail", tt.name) {
+				assert.Contains(t, err.Error(), tt.errMsg, "LookupService(%v) unexpected error", tt.name)
+			}
+			continue
+		}
+		if assert.NoError(t, err, "LookupService(%v) failed", tt.name) {
+			assert.Equal(t, tt.want, got.Name, "LookupService(%v) unexpected service", tt.name)
+		}
+	}
+}
@@ -23,6 +23,7 @@ package thrift
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 
@@ -58,13 +59,13 @@ func structValueMap(value interface{}) (map[string]interface{}, bool) {
 	return result, true
 }
 
-func structToValue(fieldGroup compile.FieldGroup, value interface{}) (wire.Struct, error) {
+func structToValue(n *nesting, fieldGroup compile.FieldGroup, value interface{}) (wire.Struct, error) {
 	mapValue, ok := structValueMap(value)
 	if !ok {
 		return wire.Struct{}, errStructUseMapString
 	}
 
-	fields, err := fieldGroupToValue(fieldGroup, mapValue)
+	fields, err := fieldGroupToValue(n, fieldGroup, mapValue)
 	if err != nil {
 		return wire.Struct{}, err
 	}
@@ -72,7 +73,7 @@ func structToValue(fieldGroup compile.FieldGroup, value interface{}) (wire.Struc
 	return wire.Struct{Fields: fields}, nil
 }
 
-func listToValue(t string, spec compile.TypeSpec, value interface{}) (wire.List, error) {
+func listToValue(n *nesting, t string, spec compile.TypeSpec, value interface{}) (wire.List, error) {
 	valueList, ok := value.([]interface{})
 	if !ok {
 		return wire.List{}, fmt.Errorf("%v must be specified using list[*]", t)
@@ -80,9 +81,11 @@ func listToValue(t string, spec compile.TypeSpec, value interface{}) (wire.List,
 
 	values := make([]wire.Value, len(valueList))
 	for i, v := range valueList {
-		wv, err := toWireValue(spec, v)
+		n.pushIndex(i)
+		wv, err := toWireValue(n, spec, v)
+		n.pop()
 		if err != nil {
-			return wire.List{}, fmt.Errorf("%v item failed: %v", t, err)
+			return wire.List{}, err
 		}
 
 		values[i] = wv
@@ -128,7 +131,7 @@ func convertMapKey(keySpec compile.TypeSpec, value interface{}) interface{} {
 // mapToValue converts a map from JSON to a wire.Map.
 // TODO: Allow specifying maps using a []MapItem form so the user
 // can cleanly use non-string/int keys.
-func mapToValue(keySpec, valueSpec compile.TypeSpec, value interface{}) (wire.Map, error) {
+func mapToValue(n *nesting, keySpec, valueSpec compile.TypeSpec, value interface{}) (wire.Map, error) {
 	var valueMap map[interface{}]interface{}
 	if vm, ok := value.(map[interface{}]interface{}); ok {
 		valueMap = vm
@@ -140,15 +143,22 @@ func mapToValue(keySpec, valueSpec compile.TypeSpec, value interface{}) (wire.Ma
 
 	items := make([]wire.MapItem, 0, len(valueMap))
 	for k, v := range valueMap {
+		n.pushIndex(k)
 		keyValue := convertMapKey(keySpec, k)
-		kw, err := toWireValue(keySpec, keyValue)
+		kw, err := toWireValue(n, keySpec, keyValue)
+		if vm, ok := err.(valueMismatch); ok && vm.path == strings.Join(n.path, "") {
+			vm.mapKey = true
+			err = vm
+		}
 		if err != nil {
-			return wire.Map{}, fmt.Errorf("map key (%v) failed: %v", k, err)
+			n.pop()
+			return wire.Map{}, err
 		}
 
-		vw, err := toWireValue(valueSpec, v)
+		vw, err := toWireValue(n, valueSpec, v)
+		n.pop()
 		if err != nil {
-			return wire.Map{}, fmt.Errorf("map value (%v) for key (%v) failed: %v", v, k, err)
+			return wire.Map{}, err
 		}
 
 		items = append(items, wire.MapItem{
@@ -178,7 +188,29 @@ func checkStructValue(spec *compile.StructSpec, value wire.Struct) error {
 	return nil
 }
 
-func toWireValue(spec compile.TypeSpec, value interface{}) (w wire.Value, err error) {
+// toWireField converts the value of a field, using the field's annotations.
+func toWireField(n *nesting, spec *compile.FieldSpec, value interface{}) (wire.Value, error) {
+	value, err := n.fieldHint(spec).toWire(n, value)
+	if err != nil {
+		return wire.Value{}, n.wrapErr(spec.Type, value, err)
+	}
+	return toWireValue(n, spec.Type, value)
+}
+
+func toWireValue(n *nesting, typeSpec compile.TypeSpec, value interface{}) (w wire.Value, err error) {
+	value, err = n.typeHint(typeSpec).toWire(n, value)
+	if err != nil {
+		return wire.Value{}, n.wrapErr(typeSpec, value, err)
+	}
+
+	spec := resolveTypedef(typeSpec)
+	if isNested(spec.TypeCode()) {
+		if err := n.enter(value); err != nil {
+			return wire.Value{}, n.wrapErr(typeSpec, value, err)
+		}
+		defer n.leave(value)
+	}
+
 	switch spec.TypeCode() {
 	case wire.TBool:
 		var boolValue bool
@@ -211,7 +243,7 @@ func toWireValue(spec compile.TypeSpec, value interface{}) (w wire.Value, err er
 	case wire.TStruct:
 		sspec := spec.(*compile.StructSpec)
 		var structValue wire.Struct
-		structValue, err = structToValue(sspec.Fields, value)
+		structValue, err = structToValue(n, sspec.Fields, value)
 		if err == nil {
 			err = checkStructValue(sspec, structValue)
 		}
@@ -219,25 +251,24 @@ func toWireValue(spec compile.TypeSpec, value interface{}) (w wire.Value, err er
 	case wire.TList:
 		lspec := spec.(*compile.ListSpec)
 		var wireValue wire.List
-		wireValue, err = listToValue("list", lspec.ValueSpec, value)
+		wireValue, err = listToValue(n, "list", lspec.ValueSpec, value)
 		w = wire.NewValueList(wireValue)
 	case wire.TSet:
 		lspec := spec.(*compile.SetSpec)
 		var wireValue wire.List
-		wireValue, err = listToValue("set", lspec.ValueSpec, value)
+		wireValue, err = listToValue(n, "set", lspec.ValueSpec, value)
 		w = wire.NewValueSet(wire.Set(wireValue))
 	case wire.TMap:
 		mspec := spec.(*compile.MapSpec)
 		var wireValue wire.Map
-		wireValue, err = mapToValue(mspec.KeySpec, mspec.ValueSpec, value)
+		wireValue, err = mapToValue(n, mspec.KeySpec, mspec.ValueSpec, value)
 		w = wire.NewValueMap(wireValue)
 	default:
 		panic(fmt.Sprintf("got unknown TypeCode in spec: %v", spec))
 	}
 
 	if err != nil {
-		// TODO: Error messages should use the thrift field name, not type.
-		return wire.Value{}, fmt.Errorf("field %q %v", spec.ThriftName(), err)
+		return wire.Value{}, n.wrapErr(typeSpec, value, err)
 	}
 	return w, nil
 }
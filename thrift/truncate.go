@@ -0,0 +1,73 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package thrift
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TruncatedKey is the key added to responses and maps that were only partly
+// converted, as they exceeded MaxContainerSize or DecodeTimeout. Truncated
+// lists and sets end with a marker describing the items that were dropped.
+const TruncatedKey = "_truncated"
+
+// errStopItems stops iterating over the items of a truncated container.
+var errStopItems = errors.New("stop converting items")
+
+// timedOut returns whether converting values has taken longer than the
+// DecodeTimeout, in which case the rest of the value is truncated.
+func (n *nesting) timedOut() bool {
+	if n.deadline.IsZero() || time.Now().Before(n.deadline) {
+		return false
+	}
+
+	n.truncate(fmt.Sprintf("decoding took longer than %v", n.timeout))
+	return true
+}
+
+// limitItems returns how many of a container's items should be converted.
+func (n *nesting) limitItems(size int) int {
+	if n.maxItems > 0 && size > n.maxItems {
+		return n.maxItems
+	}
+	return size
+}
+
+// truncate records why a value was truncated. Only the first reason is kept.
+func (n *nesting) truncate(reason string) {
+	if n.truncated == "" {
+		n.truncated = reason
+	}
+}
+
+// truncatedItems returns the marker for items of a container that were not
+// converted, and records why they were dropped.
+func (n *nesting) truncatedItems(remaining, size int, kind string) string {
+	n.truncate(fmt.Sprintf("containers are limited to %v items", n.maxItems))
+	return fmt.Sprintf("<%v of %v %v truncated>", remaining, size, kind)
+}
+
+// truncatedValue is the marker for a value that was not converted in time.
+func (n *nesting) truncatedValue() string {
+	return fmt.Sprintf("<truncated: %v>", n.truncated)
+}
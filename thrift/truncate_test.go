@@ -0,0 +1,315 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package thrift
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thriftrw/thriftrw-go/compile"
+	"github.com/thriftrw/thriftrw-go/wire"
+)
+
+// truncatableResponse returns a method, and a response for it with a list of
+// 5 items and a map of 3 entries.
+func truncatableResponse(t *testing.T) (*compile.FunctionSpec, []byte) {
+	funcSpecs := getFuncSpecs(t, `
+    struct S {
+      1: optional list<i32> ids
+      2: optional map<string, i32> counts
+    }
+    service Test {
+      S f()
+    }
+  `)
+
+	ids := make([]wire.Value, 5)
+	for i := range ids {
+		ids[i] = wire.NewValueI32(int32(i))
+	}
+	counts := []wire.MapItem{
+		{Key: wire.NewValueString("a"), Value: wire.NewValueI32(1)},
+		{Key: wire.NewValueString("b"), Value: wire.NewValueI32(2)},
+		{Key: wire.NewValueString("c"), Value: wire.NewValueI32(3)},
+	}
+	bs := encodeWire(wire.NewValueStruct(wire.Struct{Fields: []wire.Field{
+		{ID: 0, Value: wire.NewValueStruct(wire.Struct{Fields: []wire.Field{
+			{ID: 1, Value: wire.NewValueList(wire.List{
+				ValueType: wire.TI32,
+				Size:      len(ids),
+				Items:     wire.ValueListFromSlice(ids),
+			})},
+			{ID: 2, Value: wire.NewValueMap(wire.Map{
+				KeyType:   wire.TBinary,
+				ValueType: wire.TI32,
+				Size:      len(counts),
+				Items:     wire.MapItemListFromSlice(counts),
+			})},
+		}})},
+	}}))
+	return funcSpecs["f"], bs
+}
+
+func TestResponseBytesToMapTruncated(t *testing.T) {
+	spec, bs := truncatableResponse(t)
+
+	tests := []struct {
+		msg  string
+		opts Options
+		want map[string]interface{}
+	}{
+		{
+			msg: "no limits",
+			want: map[string]interface{}{
+				"result": map[string]interface{}{
+					"ids":    []interface{}{int32(0), int32(1), int32(2), int32(3), int32(4)},
+					"counts": map[string]interface{}{"a": int32(1), "b": int32(2), "c": int32(3)},
+				},
+			},
+		},
+		{
+			msg:  "limit larger than containers",
+			opts: Options{MaxContainerSize: 5},
+			want: map[string]interface{}{
+				"result": map[string]interface{}{
+					"ids":    []interface{}{int32(0), int32(1), int32(2), int32(3), int32(4)},
+					"counts": map[string]interface{}{"a": int32(1), "b": int32(2), "c": int32(3)},
+				},
+			},
+		},
+		{
+			msg:  "containers truncated",
+			opts: Options{MaxContainerSize: 2},
+			want: map[string]interface{}{
+				"result": map[string]interface{}{
+					"ids":    []interface{}{int32(0), int32(1), "<3 of 5 items truncated>"},
+					"counts": map[string]interface{}{"a": int32(1), "b": int32(2), TruncatedKey: "<1 of 3 entries truncated>"},
+				},
+				TruncatedKey: "containers are limited to 2 items",
+			},
+		},
+		{
+			msg:  "decode timeout",
+			opts: Options{DecodeTimeout: time.Nanosecond},
+			want: map[string]interface{}{
+				"result":     "<truncated: decoding took longer than 1ns>",
+				TruncatedKey: "decoding took longer than 1ns",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := ResponseBytesToMap(spec, bs, tt.opts)
+		require.NoError(t, err, "%v: ResponseBytesToMap failed", tt.msg)
+		assert.Equal(t, tt.want, got, "%v: unexpected result", tt.msg)
+	}
+}
+
+func TestResponseSchemaTruncated(t *testing.T) {
+	spec, bs := truncatableResponse(t)
+
+	tests := []struct {
+		msg  string
+		opts Options
+	}{
+		{"no limits", Options{}},
+		{"containers truncated", Options{MaxContainerSize: 2}},
+		{"decode timeout", Options{DecodeTimeout: time.Nanosecond}},
+		{"both", Options{MaxContainerSize: 2, DecodeTimeout: time.Hour}},
+	}
+
+	for _, tt := range tests {
+		response, err := ResponseBytesToMap(spec, bs, tt.opts)
+		require.NoError(t, err, "%v: ResponseBytesToMap failed", tt.msg)
+
+		schema := ResponseSchema("Test::f response", spec, tt.opts)
+		assert.Empty(t, validateSchema(t, schema, response), "%v: response does not match the schema", tt.msg)
+
+		if _, ok := response[TruncatedKey]; !ok {
+			continue
+		}
+
+		// The markers are only allowed when responses may be truncated.
+		strict := ResponseSchema("Test::f response", spec, Options{})
+		assert.NotEmpty(t, validateSchema(t, strict, response), "%v: truncated response should not match the schema without limits", tt.msg)
+	}
+}
+
+// validateSchema returns the errors validating value against the subset of
+// JSON Schema used by ResponseSchema.
+func validateSchema(t *testing.T, schema map[string]interface{}, value interface{}) []string {
+	// Round trip the value through JSON, so it has the types a JSON Schema
+	// validator would see.
+	bs, err := json.Marshal(value)
+	require.NoError(t, err, "failed to marshal value")
+	decoder := json.NewDecoder(bytes.NewReader(bs))
+	decoder.UseNumber()
+	var decoded interface{}
+	require.NoError(t, decoder.Decode(&decoded), "failed to unmarshal value")
+
+	v := &schemaValidator{root: schema}
+	v.validate("$", schema, decoded)
+	return v.errs
+}
+
+type schemaValidator struct {
+	root map[string]interface{}
+	errs []string
+}
+
+func (v *schemaValidator) errorf(path, format string, args ...interface{}) {
+	v.errs = append(v.errs, path+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *schemaValidator) validate(path string, schema map[string]interface{}, value interface{}) {
+	if ref, ok := schema["$ref"].(string); ok {
+		definitions := v.root["definitions"].(map[string]interface{})
+		schema = definitions[strings.TrimPrefix(ref, "#/definitions/")].(map[string]interface{})
+	}
+
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		matched := false
+		for _, alt := range anyOf {
+			altValidator := &schemaValidator{root: v.root}
+			altValidator.validate(path, alt.(map[string]interface{}), value)
+			if len(altValidator.errs) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.errorf(path, "does not match any of the anyOf schemas")
+		}
+	}
+
+	if typ, ok := schema["type"].(string); ok && !hasSchemaType(typ, value) {
+		v.errorf(path, "expected %v, got %T", typ, value)
+		return
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if fmt.Sprint(e) == fmt.Sprint(value) {
+				found = true
+			}
+		}
+		if !found {
+			v.errorf(path, "%v is not one of %v", value, enum)
+		}
+	}
+
+	if n, ok := value.(json.Number); ok {
+		i, _ := n.Int64()
+		if min, ok := schema["minimum"].(int64); ok && i < min {
+			v.errorf(path, "%v is less than %v", i, min)
+		}
+		if max, ok := schema["maximum"].(int64); ok && i > max {
+			v.errorf(path, "%v is greater than %v", i, max)
+		}
+	}
+
+	if s, ok := value.(string); ok {
+		if pattern, ok := schema["pattern"].(string); ok && !regexp.MustCompile(pattern).MatchString(s) {
+			v.errorf(path, "%q does not match %v", s, pattern)
+		}
+	}
+
+	if list, ok := value.([]interface{}); ok {
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range list {
+				v.validate(fmt.Sprintf("%v[%v]", path, i), items, item)
+			}
+		}
+	}
+
+	if obj, ok := value.(map[string]interface{}); ok {
+		v.validateObject(path, schema, obj)
+	}
+}
+
+func (v *schemaValidator) validateObject(path string, schema map[string]interface{}, obj map[string]interface{}) {
+	if max, ok := schema["maxProperties"].(int); ok && len(obj) > max {
+		v.errorf(path, "has %v properties, more than %v", len(obj), max)
+	}
+	if min, ok := schema["minProperties"].(int); ok && len(obj) < min {
+		v.errorf(path, "has %v properties, fewer than %v", len(obj), min)
+	}
+	if required, ok := schema["required"].([]string); ok {
+		for _, name := range required {
+			if _, ok := obj[name]; !ok {
+				v.errorf(path, "missing required property %v", name)
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	for name, value := range obj {
+		if prop, ok := properties[name]; ok {
+			v.validate(path+"."+name, prop.(map[string]interface{}), value)
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				v.errorf(path, "unexpected property %v", name)
+			}
+		case map[string]interface{}:
+			v.validate(path+"."+name, additional, value)
+		}
+	}
+}
+
+// hasSchemaType returns whether a value decoded from JSON has the JSON Schema type.
+func hasSchemaType(typ string, value interface{}) bool {
+	switch typ {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := value.(json.Number)
+		return ok
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		_, err := n.Int64()
+		return err == nil
+	}
+	return false
+}
@@ -26,6 +26,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"strings"
+
+	"github.com/thriftrw/thriftrw-go/compile"
 )
 
 var errBinaryObjectOptions = errors.New(
@@ -176,3 +178,40 @@ func parseBinary(value interface{}) ([]byte, error) {
 		return nil, fmt.Errorf("cannot parse binary/string from %T: %v", value, v)
 	}
 }
+
+// resolveTypedef returns the underlying type for a typedef, or spec if it
+// is not a typedef.
+func resolveTypedef(spec compile.TypeSpec) compile.TypeSpec {
+	for {
+		typedef, ok := spec.(*compile.TypedefSpec)
+		if !ok {
+			return spec
+		}
+		spec = typedef.Target
+	}
+}
+
+// TypedefKey and TypedefValueKey are the keys of the object that typedef
+// values in responses are wrapped in when Options.AnnotateTypedefs is set,
+// e.g. {"_typedef": "UUID", "_value": "..."}.
+const (
+	TypedefKey      = "_typedef"
+	TypedefValueKey = "_value"
+)
+
+// annotateTypedef wraps a value with the name of its typedef.
+func annotateTypedef(typedef *compile.TypedefSpec, v interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		TypedefKey:      typedef.Name,
+		TypedefValueKey: v,
+	}
+}
+
+// typeName returns the name of the type for error messages, annotating
+// typedefs with their underlying type.
+func typeName(spec compile.TypeSpec) string {
+	if resolved := resolveTypedef(spec); resolved != spec {
+		return fmt.Sprintf("%v (typedef of %v)", spec.ThriftName(), resolved.ThriftName())
+	}
+	return spec.ThriftName()
+}
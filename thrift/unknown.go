@@ -0,0 +1,143 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package thrift
+
+import (
+	"encoding/base64"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/thriftrw/thriftrw-go/wire"
+)
+
+// UnknownFieldsKey is the key under which fields that are not in the IDL are
+// returned, so a server using a newer IDL than the client can be spotted.
+const UnknownFieldsKey = "_unknown"
+
+var wireTypeNames = map[wire.Type]string{
+	wire.TBool:   "bool",
+	wire.TI8:     "i8",
+	wire.TI16:    "i16",
+	wire.TI32:    "i32",
+	wire.TI64:    "i64",
+	wire.TDouble: "double",
+	wire.TBinary: "binary",
+	wire.TStruct: "struct",
+	wire.TMap:    "map",
+	wire.TSet:    "set",
+	wire.TList:   "list",
+}
+
+func wireTypeName(t wire.Type) string {
+	if name, ok := wireTypeNames[t]; ok {
+		return name
+	}
+	return t.String()
+}
+
+// unknownFieldsFromWire converts fields without a spec to a list of the
+// field ID, wire type and value of each field.
+func unknownFieldsFromWire(n *nesting, fields []wire.Field) ([]interface{}, error) {
+	result := make([]interface{}, len(fields))
+	for i, f := range fields {
+		v, err := unknownFromWire(n, f.Value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse unknown field %v: %v", f.ID, err)
+		}
+
+		result[i] = map[string]interface{}{
+			"id":    f.ID,
+			"type":  wireTypeName(f.Value.Type()),
+			"value": v,
+		}
+	}
+	return result, nil
+}
+
+// unknownFromWire converts a value without a spec. Binary values can't be
+// told apart from strings, so they are returned as strings if they are
+// valid UTF-8, and use the binary representation otherwise.
+func unknownFromWire(n *nesting, w wire.Value) (interface{}, error) {
+	if isNested(w.Type()) {
+		if err := n.enter(nil); err != nil {
+			return nil, err
+		}
+		defer n.leave(nil)
+	}
+
+	switch w.Type() {
+	case wire.TBool:
+		return w.GetBool(), nil
+	case wire.TI8:
+		return w.GetI8(), nil
+	case wire.TI16:
+		return w.GetI16(), nil
+	case wire.TI32:
+		return w.GetI32(), nil
+	case wire.TI64:
+		return w.GetI64(), nil
+	case wire.TDouble:
+		return w.GetDouble(), nil
+	case wire.TBinary:
+		if bs := w.GetBinary(); utf8.Valid(bs) {
+			return string(bs), nil
+		}
+		return map[string]interface{}{
+			"base64": base64.StdEncoding.EncodeToString(w.GetBinary()),
+		}, nil
+	case wire.TStruct:
+		return unknownFieldsFromWire(n, w.GetStruct().Fields)
+	case wire.TList:
+		l := w.GetList()
+		return unknownListFromWire(n, wire.ValueListToSlice(l.Items, l.Size))
+	case wire.TSet:
+		s := w.GetSet()
+		return unknownListFromWire(n, wire.ValueListToSlice(s.Items, s.Size))
+	case wire.TMap:
+		m := w.GetMap()
+		items := wire.MapItemListToSlice(m.Items, m.Size)
+		result := make([]interface{}, len(items))
+		for i, item := range items {
+			key, err := unknownFromWire(n, item.Key)
+			if err != nil {
+				return nil, err
+			}
+			value, err := unknownFromWire(n, item.Value)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = map[string]interface{}{"key": key, "value": value}
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("unknown wire type: %v", w.Type())
+}
+
+func unknownListFromWire(n *nesting, items []wire.Value) ([]interface{}, error) {
+	result := make([]interface{}, len(items))
+	for i, item := range items {
+		var err error
+		if result[i], err = unknownFromWire(n, item); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package thrift
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thriftrw/thriftrw-go/wire"
+)
+
+func TestUnknownFromWire(t *testing.T) {
+	tests := []struct {
+		msg  string
+		w    wire.Value
+		want interface{}
+	}{
+		{msg: "bool", w: wire.NewValueBool(true), want: true},
+		{msg: "i8", w: wire.NewValueI8(1), want: int8(1)},
+		{msg: "i16", w: wire.NewValueI16(2), want: int16(2)},
+		{msg: "i32", w: wire.NewValueI32(3), want: int32(3)},
+		{msg: "i64", w: wire.NewValueI64(4), want: int64(4)},
+		{msg: "double", w: wire.NewValueDouble(1.5), want: 1.5},
+		{msg: "string", w: wire.NewValueString("foo"), want: "foo"},
+		{
+			msg:  "binary",
+			w:    wire.NewValueBinary([]byte{0xff, 0xfe}),
+			want: map[string]interface{}{"base64": "//4="},
+		},
+		{
+			msg: "struct",
+			w: wire.NewValueStruct(wire.Struct{Fields: []wire.Field{
+				{ID: 1, Value: wire.NewValueI32(1)},
+				{ID: 3, Value: wire.NewValueString("s")},
+			}}),
+			want: []interface{}{
+				map[string]interface{}{"id": int16(1), "type": "i32", "value": int32(1)},
+				map[string]interface{}{"id": int16(3), "type": "binary", "value": "s"},
+			},
+		},
+		{
+			msg: "list",
+			w: makeWireList(wire.TI16, 2, func(i int) wire.Value {
+				return wire.NewValueI16(int16(i))
+			}),
+			want: []interface{}{int16(0), int16(1)},
+		},
+		{
+			msg: "set",
+			w: makeWireSet(wire.TBool, 1, func(int) wire.Value {
+				return wire.NewValueBool(false)
+			}),
+			want: []interface{}{false},
+		},
+		{
+			msg: "map",
+			w: makeWireMap(wire.TI32, wire.TBinary, 1, func(int) (wire.Value, wire.Value) {
+				return wire.NewValueI32(1), wire.NewValueString("v")
+			}),
+			want: []interface{}{
+				map[string]interface{}{"key": int32(1), "value": "v"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := unknownFromWire(newNesting(Options{}), tt.w)
+		if assert.NoError(t, err, "%v: unknownFromWire failed", tt.msg) {
+			assert.Equal(t, tt.want, got, "%v: unexpected value", tt.msg)
+		}
+	}
+}
+
+func TestUnknownFromWireMaxDepth(t *testing.T) {
+	w := wire.NewValueI32(1)
+	for i := 0; i < 5; i++ {
+		w = wire.NewValueStruct(wire.Struct{Fields: []wire.Field{{ID: 1, Value: w}}})
+	}
+
+	_, err := unknownFromWire(newNesting(Options{MaxDepth: 5}), w)
+	assert.NoError(t, err, "unknownFromWire should succeed at the limit")
+
+	_, err = unknownFromWire(newNesting(Options{MaxDepth: 4}), w)
+	if assert.Error(t, err, "unknownFromWire should fail beyond the limit") {
+		assert.Contains(t, err.Error(), "maximum nesting depth of 4")
+	}
+}
+
+func TestResponseUnknownFields(t *testing.T) {
+	spec := getFuncSpecs(t, `
+    struct S {
+      1: optional string s
+    }
+    union U {
+      1: string s
+    }
+    service Test {
+      S getS()
+      U getU()
+    }
+  `)
+
+	// The server uses a newer IDL with an extra field in each type.
+	newer := wire.NewValueStruct(wire.Struct{Fields: []wire.Field{
+		{ID: 1, Value: wire.NewValueString("foo")},
+		{ID: 2, Value: wire.NewValueI64(10)},
+	}})
+	newerUnion := wire.NewValueStruct(wire.Struct{Fields: []wire.Field{
+		{ID: 2, Value: wire.NewValueBool(true)},
+	}})
+	response := func(w wire.Value) []byte {
+		return encodeWire(wire.NewValueStruct(wire.Struct{Fields: []wire.Field{{ID: 0, Value: w}}}))
+	}
+
+	got, err := ResponseBytesToMap(spec["getS"], response(newer), Options{})
+	require.NoError(t, err, "ResponseBytesToMap failed")
+	assert.Equal(t, map[string]interface{}{
+		"result": map[string]interface{}{
+			"s": "foo",
+			UnknownFieldsKey: []interface{}{
+				map[string]interface{}{"id": int16(2), "type": "i64", "value": int64(10)},
+			},
+		},
+	}, got, "unexpected response for struct")
+
+	got, err = ResponseBytesToMap(spec["getU"], response(newerUnion), Options{})
+	require.NoError(t, err, "ResponseBytesToMap failed")
+	assert.Equal(t, map[string]interface{}{
+		"result": map[string]interface{}{
+			UnknownFieldsKey: []interface{}{
+				map[string]interface{}{"id": int16(2), "type": "bool", "value": true},
+			},
+		},
+	}, got, "unexpected response for union")
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// minSampledTimeout is the shortest timeout sampled from a distribution, as
+// a normal distribution can return timeouts that are 0 or negative.
+const minSampledTimeout = time.Millisecond
+
+var errTimeoutDistribution = errors.New("timeout distribution must be uniform:MIN:MAX or normal:MEAN:STDDEV, e.g. uniform:50ms:500ms")
+
+// timeoutDistribution is used to pick the timeout for each benchmark request,
+// so the service sees a realistic mix of propagated deadlines.
+type timeoutDistribution struct {
+	kind string
+	a, b time.Duration
+}
+
+func parseTimeoutDistribution(s string) (timeoutDistribution, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return timeoutDistribution{}, errTimeoutDistribution
+	}
+
+	a, err := time.ParseDuration(parts[1])
+	if err != nil {
+		return timeoutDistribution{}, errTimeoutDistribution
+	}
+	b, err := time.ParseDuration(parts[2])
+	if err != nil {
+		return timeoutDistribution{}, errTimeoutDistribution
+	}
+
+	d := timeoutDistribution{kind: parts[0], a: a, b: b}
+	switch d.kind {
+	case "uniform":
+		if a < minSampledTimeout || b < a {
+			return timeoutDistribution{}, fmt.Errorf("uniform timeout distribution must have %v <= MIN <= MAX", minSampledTimeout)
+		}
+	case "normal":
+		if a < minSampledTimeout || b < 0 {
+			return timeoutDistribution{}, fmt.Errorf("normal timeout distribution must have MEAN >= %v and STDDEV >= 0", minSampledTimeout)
+		}
+	default:
+		return timeoutDistribution{}, errTimeoutDistribution
+	}
+	return d, nil
+}
+
+func (d timeoutDistribution) String() string {
+	if d.kind == "uniform" {
+		return fmt.Sprintf("uniform %v to %v", d.a, d.b)
+	}
+	return fmt.Sprintf("normal with mean %v and stddev %v", d.a, d.b)
+}
+
+// sampler returns a function that picks timeouts using r, which is not safe
+// for concurrent use, so each worker has its own sampler.
+func (d timeoutDistribution) sampler(r *rand.Rand) func() time.Duration {
+	return func() time.Duration {
+		var timeout time.Duration
+		if d.kind == "uniform" {
+			timeout = d.a + time.Duration(r.Int63n(int64(d.b-d.a)+1))
+		} else {
+			timeout = d.a + time.Duration(r.NormFloat64()*float64(d.b))
+		}
+
+		if timeout < minSampledTimeout {
+			return minSampledTimeout
+		}
+		return timeout
+	}
+}
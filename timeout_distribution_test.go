@@ -0,0 +1,162 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel-go/raw"
+	"golang.org/x/net/context"
+)
+
+func TestParseTimeoutDistribution(t *testing.T) {
+	tests := []struct {
+		dist    string
+		want    timeoutDistribution
+		wantStr string
+		wantErr string
+	}{
+		{
+			dist:    "uniform:50ms:500ms",
+			want:    timeoutDistribution{"uniform", 50 * time.Millisecond, 500 * time.Millisecond},
+			wantStr: "uniform 50ms to 500ms",
+		},
+		{
+			dist:    "uniform:1s:1s",
+			want:    timeoutDistribution{"uniform", time.Second, time.Second},
+			wantStr: "uniform 1s to 1s",
+		},
+		{
+			dist:    "normal:200ms:50ms",
+			want:    timeoutDistribution{"normal", 200 * time.Millisecond, 50 * time.Millisecond},
+			wantStr: "normal with mean 200ms and stddev 50ms",
+		},
+		{
+			dist:    "uniform:500ms:50ms",
+			wantErr: "uniform timeout distribution must have 1ms <= MIN <= MAX",
+		},
+		{
+			dist:    "normal:0s:50ms",
+			wantErr: "normal timeout distribution must have MEAN >= 1ms and STDDEV >= 0",
+		},
+		{
+			dist:    "exponential:50ms:500ms",
+			wantErr: errTimeoutDistribution.Error(),
+		},
+		{
+			dist:    "uniform:50ms",
+			wantErr: errTimeoutDistribution.Error(),
+		},
+		{
+			dist:    "uniform:50:500",
+			wantErr: errTimeoutDistribution.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := parseTimeoutDistribution(tt.dist)
+		if tt.wantErr != "" {
+			assert.EqualError(t, err, tt.wantErr, "%v: unexpected error", tt.dist)
+			continue
+		}
+
+		require.NoError(t, err, "%v: failed to parse", tt.dist)
+		assert.Equal(t, tt.want, got, "%v: unexpected distribution", tt.dist)
+		assert.Equal(t, tt.wantStr, got.String(), "%v: unexpected String", tt.dist)
+	}
+}
+
+func TestTimeoutDistributionSampler(t *testing.T) {
+	tests := []struct {
+		dist     string
+		min, max time.Duration
+	}{
+		{"uniform:50ms:500ms", 50 * time.Millisecond, 500 * time.Millisecond},
+		{"uniform:100ms:100ms", 100 * time.Millisecond, 100 * time.Millisecond},
+		// Samples below the minimum timeout are raised to the minimum.
+		{"normal:2ms:1s", minSampledTimeout, time.Hour},
+	}
+
+	for _, tt := range tests {
+		d, err := parseTimeoutDistribution(tt.dist)
+		require.NoError(t, err, "%v: failed to parse", tt.dist)
+
+		sample := d.sampler(rand.New(rand.NewSource(1)))
+		for i := 0; i < 1000; i++ {
+			got := sample()
+			assert.True(t, got >= tt.min && got <= tt.max, "%v: sampled %v out of range", tt.dist, got)
+		}
+	}
+}
+
+func TestBenchmarkTimeoutDistribution(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		ttls []time.Duration
+	)
+	s := newServer(t)
+	defer s.shutdown()
+	s.register(fooMethod, func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		deadline, _ := ctx.Deadline()
+		mu.Lock()
+		ttls = append(ttls, deadline.Sub(time.Now()))
+		mu.Unlock()
+		return &raw.Res{Arg2: args.Arg2, Arg3: args.Arg3}, nil
+	})
+
+	m := benchmarkMethodForTest(t, fooMethod)
+	buf, out := getOutput(t)
+	runBenchmark(out, Options{
+		BOpts: BenchmarkOptions{
+			MaxRequests:         200,
+			MaxDuration:         time.Second,
+			Connections:         2,
+			Concurrency:         2,
+			TimeoutDistribution: "uniform:50ms:500ms",
+		},
+		TOpts: s.transportOpts(),
+	}, m)
+	assert.Contains(t, buf.String(), "Timeouts:        uniform 50ms to 500ms", "Expected timeout parameters")
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// Skip the warm up requests, which use the request's timeout.
+	benchTTLs := ttls[10*2:]
+	require.Len(t, benchTTLs, 200, "Unexpected number of requests")
+
+	var short, long int
+	for _, ttl := range benchTTLs {
+		assert.True(t, ttl <= 500*time.Millisecond, "Deadline %v longer than the distribution's maximum", ttl)
+		if ttl < 200*time.Millisecond {
+			short++
+		}
+		if ttl > 350*time.Millisecond {
+			long++
+		}
+	}
+	assert.True(t, short > 0 && long > 0, "Expected a mix of deadlines, got %v short and %v long", short, long)
+}
@@ -0,0 +1,234 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+const tlsDateFormat = "2006-01-02"
+
+var errNoTLS = errors.New("the call was not made over TLS")
+
+// tlsVersions are the names of TLS versions. Older versions of crypto/tls
+// don't have constants for newer versions.
+var tlsVersions = map[uint16]string{
+	0x0300: "SSL 3.0",
+	0x0301: "TLS 1.0",
+	0x0302: "TLS 1.1",
+	0x0303: "TLS 1.2",
+	0x0304: "TLS 1.3",
+}
+
+// ocspBasicResponseOID identifies a basic OCSP response (RFC 6960).
+var ocspBasicResponseOID = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+
+// checkTLS prints the TLS connection's details with --tls-verbose, and
+// returns an error if a certificate expires within --tls-expiry-days.
+func checkTLS(logger *logger, opts TransportOptions, state *tls.ConnectionState, now time.Time) error {
+	if state == nil {
+		return errNoTLS
+	}
+
+	if opts.TLSVerbose {
+		for _, line := range describeTLS(state, now) {
+			logger.Infof("%v", line)
+		}
+	}
+
+	if opts.TLSExpiryDays > 0 {
+		return checkCertExpiry(state.PeerCertificates, opts.TLSExpiryDays, now)
+	}
+	return nil
+}
+
+// describeTLS returns a line for the TLS version, each of the peer's
+// certificates, and the stapled OCSP response.
+func describeTLS(state *tls.ConnectionState, now time.Time) []string {
+	version, ok := tlsVersions[state.Version]
+	if !ok {
+		version = fmt.Sprintf("TLS version 0x%04x", state.Version)
+	}
+
+	lines := []string{fmt.Sprintf("TLS: %v, resumed: %v", version, state.DidResume)}
+	for i, cert := range state.PeerCertificates {
+		lines = append(lines, fmt.Sprintf("TLS certificate %v: %v, issued by %v, %v",
+			i, certName(cert.Subject), certName(cert.Issuer), describeExpiry(cert.NotAfter, now)))
+		if sans := certSANs(cert); len(sans) > 0 {
+			lines = append(lines, fmt.Sprintf("TLS certificate %v SANs: %v", i, strings.Join(sans, ", ")))
+		}
+	}
+
+	var leaf *x509.Certificate
+	if len(state.PeerCertificates) > 0 {
+		leaf = state.PeerCertificates[0]
+	}
+	return append(lines, "TLS stapled OCSP: "+describeOCSP(state.OCSPResponse, leaf))
+}
+
+// checkCertExpiry returns an error for the first certificate that expires
+// within days.
+func checkCertExpiry(certs []*x509.Certificate, days int, now time.Time) error {
+	limit := now.Add(time.Duration(days) * 24 * time.Hour)
+	for i, cert := range certs {
+		if cert.NotAfter.Before(limit) {
+			return fmt.Errorf("certificate %v (%v) %v, within --tls-expiry-days %v",
+				i, certName(cert.Subject), describeExpiry(cert.NotAfter, now), days)
+		}
+	}
+	return nil
+}
+
+func describeExpiry(notAfter, now time.Time) string {
+	days := int(notAfter.Sub(now).Hours() / 24)
+	if notAfter.Before(now) {
+		return fmt.Sprintf("expired %v (%v days ago)", notAfter.Format(tlsDateFormat), -days)
+	}
+	return fmt.Sprintf("expires %v (in %v days)", notAfter.Format(tlsDateFormat), days)
+}
+
+// certName returns the common name, or the organization for certificates
+// without a common name.
+func certName(name pkix.Name) string {
+	if name.CommonName != "" {
+		return name.CommonName
+	}
+	if len(name.Organization) > 0 {
+		return name.Organization[0]
+	}
+	return "(unnamed)"
+}
+
+func certSANs(cert *x509.Certificate) []string {
+	sans := append([]string(nil), cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	return append(sans, cert.EmailAddresses...)
+}
+
+// The OCSP response structures from RFC 6960, with only the fields needed
+// to report the status.
+type ocspResponse struct {
+	Status   asn1.Enumerated
+	Response ocspResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseBytes struct {
+	Type     asn1.ObjectIdentifier
+	Response []byte
+}
+
+type ocspBasicResponse struct {
+	Data               ocspResponseData
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseData struct {
+	Version     int `asn1:"optional,default:0,explicit,tag:0"`
+	ResponderID asn1.RawValue
+	ProducedAt  time.Time `asn1:"generalized"`
+	Responses   []ocspSingleResponse
+	Extensions  []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type ocspSingleResponse struct {
+	CertID     ocspCertID
+	Good       asn1.Flag        `asn1:"tag:0,optional"`
+	Revoked    ocspRevokedInfo  `asn1:"tag:1,optional"`
+	Unknown    asn1.Flag        `asn1:"tag:2,optional"`
+	ThisUpdate time.Time        `asn1:"generalized"`
+	NextUpdate time.Time        `asn1:"generalized,explicit,tag:0,optional"`
+	Extensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type ocspCertID struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	NameHash      []byte
+	KeyHash       []byte
+	SerialNumber  *big.Int
+}
+
+type ocspRevokedInfo struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+}
+
+// describeOCSP returns the status in the stapled OCSP response for leaf.
+// The response's signature is not verified.
+func describeOCSP(raw []byte, leaf *x509.Certificate) string {
+	if len(raw) == 0 {
+		return "none"
+	}
+
+	var resp ocspResponse
+	if _, err := asn1.Unmarshal(raw, &resp); err != nil {
+		return fmt.Sprintf("invalid response: %v", err)
+	}
+	if resp.Status != 0 {
+		return fmt.Sprintf("unsuccessful response (status %v)", resp.Status)
+	}
+	if !resp.Response.Type.Equal(ocspBasicResponseOID) {
+		return fmt.Sprintf("unsupported response type %v", resp.Response.Type)
+	}
+
+	var basic ocspBasicResponse
+	if _, err := asn1.Unmarshal(resp.Response.Response, &basic); err != nil {
+		return fmt.Sprintf("invalid response: %v", err)
+	}
+
+	var single *ocspSingleResponse
+	for i, r := range basic.Data.Responses {
+		if leaf != nil && r.CertID.SerialNumber != nil && r.CertID.SerialNumber.Cmp(leaf.SerialNumber) == 0 {
+			single = &basic.Data.Responses[i]
+			break
+		}
+	}
+	if single == nil {
+		return "no response for the server's certificate"
+	}
+
+	var status string
+	switch {
+	case bool(single.Good):
+		status = "good"
+	case bool(single.Unknown):
+		status = "unknown"
+	default:
+		status = "revoked at " + single.Revoked.RevocationTime.Format(time.RFC3339)
+	}
+
+	status += ", updated " + single.ThisUpdate.Format(time.RFC3339)
+	if !single.NextUpdate.IsZero() {
+		status += ", next update " + single.NextUpdate.Format(time.RFC3339)
+	}
+	return status + " (signature not verified)"
+}
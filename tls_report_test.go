@@ -0,0 +1,259 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var tlsTestNow = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestCert(t *testing.T, template *x509.Certificate) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "GenerateKey failed")
+
+	template.NotBefore = tlsTestNow.Add(-24 * time.Hour)
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err, "CreateCertificate failed")
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err, "ParseCertificate failed")
+	return cert
+}
+
+type testOCSPStatus struct {
+	serial     int64
+	good       bool
+	unknown    bool
+	revokedAt  time.Time
+	nextUpdate time.Time
+}
+
+func newTestOCSP(t *testing.T, s testOCSPStatus) []byte {
+	marshal := func(v interface{}) []byte {
+		bs, err := asn1.Marshal(v)
+		require.NoError(t, err, "asn1.Marshal failed")
+		return bs
+	}
+
+	sha1 := pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}}
+	single := ocspSingleResponse{
+		CertID: ocspCertID{
+			HashAlgorithm: sha1,
+			NameHash:      []byte{1},
+			KeyHash:       []byte{2},
+			SerialNumber:  big.NewInt(s.serial),
+		},
+		Good:       asn1.Flag(s.good),
+		Unknown:    asn1.Flag(s.unknown),
+		ThisUpdate: tlsTestNow.Add(-time.Hour),
+		NextUpdate: s.nextUpdate,
+	}
+	if !s.revokedAt.IsZero() {
+		single.Revoked = ocspRevokedInfo{RevocationTime: s.revokedAt}
+	}
+
+	basic := marshal(ocspBasicResponse{
+		Data: ocspResponseData{
+			ResponderID: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 2, IsCompound: true, Bytes: marshal([]byte{3})},
+			ProducedAt:  tlsTestNow.Add(-time.Hour),
+			Responses:   []ocspSingleResponse{single},
+		},
+		SignatureAlgorithm: sha1,
+		Signature:          asn1.BitString{Bytes: []byte{4}, BitLength: 8},
+	})
+	return marshal(ocspResponse{
+		Response: ocspResponseBytes{Type: ocspBasicResponseOID, Response: basic},
+	})
+}
+
+func TestDescribeTLS(t *testing.T) {
+	leaf := newTestCert(t, &x509.Certificate{
+		SerialNumber:   big.NewInt(42),
+		Subject:        pkix.Name{CommonName: "app.example.com"},
+		Issuer:         pkix.Name{CommonName: "Example CA"},
+		NotAfter:       tlsTestNow.Add(45 * 24 * time.Hour),
+		DNSNames:       []string{"app.example.com", "*.app.example.com"},
+		IPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+		EmailAddresses: []string{"ops@example.com"},
+	})
+	intermediate := newTestCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{Organization: []string{"Example CA Org"}},
+		NotAfter:     tlsTestNow.Add(-3 * 24 * time.Hour),
+	})
+
+	state := &tls.ConnectionState{
+		Version:          tls.VersionTLS12,
+		PeerCertificates: []*x509.Certificate{leaf, intermediate},
+		OCSPResponse:     newTestOCSP(t, testOCSPStatus{serial: 42, good: true}),
+	}
+
+	assert.Equal(t, []string{
+		"TLS: TLS 1.2, resumed: false",
+		// Self-signed certificates are their own issuer.
+		"TLS certificate 0: app.example.com, issued by app.example.com, expires 2026-02-15 (in 45 days)",
+		"TLS certificate 0 SANs: app.example.com, *.app.example.com, 10.0.0.1, ops@example.com",
+		"TLS certificate 1: Example CA Org, issued by Example CA Org, expired 2025-12-29 (3 days ago)",
+		"TLS stapled OCSP: good, updated 2026-01-01T11:00:00Z (signature not verified)",
+	}, describeTLS(state, tlsTestNow))
+
+	state.Version = 0x0304
+	state.PeerCertificates = nil
+	state.OCSPResponse = nil
+	assert.Equal(t, []string{
+		"TLS: TLS 1.3, resumed: false",
+		"TLS stapled OCSP: none",
+	}, describeTLS(state, tlsTestNow))
+}
+
+func TestDescribeOCSP(t *testing.T) {
+	leaf := newTestCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		NotAfter:     tlsTestNow.Add(time.Hour),
+	})
+
+	tests := []struct {
+		msg  string
+		raw  []byte
+		want string
+	}{
+		{
+			msg:  "no response",
+			want: "none",
+		},
+		{
+			msg:  "invalid",
+			raw:  []byte("not asn1"),
+			want: "invalid response",
+		},
+		{
+			msg:  "unsuccessful",
+			raw:  []byte{0x30, 0x03, 0x0a, 0x01, 0x01},
+			want: "unsuccessful response (status 1)",
+		},
+		{
+			msg:  "good with next update",
+			raw:  newTestOCSP(t, testOCSPStatus{serial: 42, good: true, nextUpdate: tlsTestNow.Add(48 * time.Hour)}),
+			want: "good, updated 2026-01-01T11:00:00Z, next update 2026-01-03T12:00:00Z (signature not verified)",
+		},
+		{
+			msg:  "revoked",
+			raw:  newTestOCSP(t, testOCSPStatus{serial: 42, revokedAt: tlsTestNow.Add(-48 * time.Hour)}),
+			want: "revoked at 2025-12-30T12:00:00Z, updated 2026-01-01T11:00:00Z (signature not verified)",
+		},
+		{
+			msg:  "unknown",
+			raw:  newTestOCSP(t, testOCSPStatus{serial: 42, unknown: true}),
+			want: "unknown, updated 2026-01-01T11:00:00Z (signature not verified)",
+		},
+		{
+			msg:  "other certificate",
+			raw:  newTestOCSP(t, testOCSPStatus{serial: 7, good: true}),
+			want: "no response for the server's certificate",
+		},
+	}
+
+	for _, tt := range tests {
+		got := describeOCSP(tt.raw, leaf)
+		assert.True(t, strings.HasPrefix(got, tt.want), "%v: got %q, want %q", tt.msg, got, tt.want)
+	}
+}
+
+func TestCheckCertExpiry(t *testing.T) {
+	soon := newTestCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "soon"},
+		NotAfter:     tlsTestNow.Add(10 * 24 * time.Hour),
+	})
+	later := newTestCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "later"},
+		NotAfter:     tlsTestNow.Add(100 * 24 * time.Hour),
+	})
+
+	tests := []struct {
+		certs   []*x509.Certificate
+		days    int
+		wantErr string
+	}{
+		{certs: []*x509.Certificate{later, soon}, days: 7},
+		{
+			certs:   []*x509.Certificate{later, soon},
+			days:    30,
+			wantErr: "certificate 1 (soon) expires 2026-01-11 (in 10 days), within --tls-expiry-days 30",
+		},
+		{
+			certs:   []*x509.Certificate{later, soon},
+			days:    365,
+			wantErr: "certificate 0 (later) expires 2026-04-11 (in 100 days), within --tls-expiry-days 365",
+		},
+	}
+
+	for _, tt := range tests {
+		err := checkCertExpiry(tt.certs, tt.days, tlsTestNow)
+		if tt.wantErr == "" {
+			assert.NoError(t, err, "checkCertExpiry(%v days) should succeed", tt.days)
+			continue
+		}
+		if assert.Error(t, err, "checkCertExpiry(%v days) should fail", tt.days) {
+			assert.Equal(t, tt.wantErr, err.Error(), "checkCertExpiry(%v days) unexpected error", tt.days)
+		}
+	}
+}
+
+func TestCheckTLS(t *testing.T) {
+	cert := newTestCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "app.example.com"},
+		NotAfter:     tlsTestNow.Add(10 * 24 * time.Hour),
+	})
+	state := &tls.ConnectionState{Version: tls.VersionTLS12, PeerCertificates: []*x509.Certificate{cert}}
+
+	buf, out := getOutput(t)
+	logger := newLogger(Options{}, out)
+
+	assert.Equal(t, errNoTLS, checkTLS(logger, TransportOptions{TLSVerbose: true}, nil, tlsTestNow), "checkTLS without TLS should fail")
+
+	require.NoError(t, checkTLS(logger, TransportOptions{TLSExpiryDays: 5}, state, tlsTestNow), "checkTLS failed")
+	assert.Empty(t, buf.String(), "details should only be printed with --tls-verbose")
+
+	err := checkTLS(logger, TransportOptions{TLSVerbose: true, TLSExpiryDays: 30}, state, tlsTestNow)
+	if assert.Error(t, err, "checkTLS should fail for a certificate expiring soon") {
+		assert.Contains(t, err.Error(), "within --tls-expiry-days 30", "unexpected error")
+	}
+	assert.Contains(t, buf.String(), "Note: TLS: TLS 1.2, resumed: false\n", "TLS details should be printed")
+	assert.Contains(t, buf.String(), "Note: TLS certificate 0: app.example.com", "certificates should be printed")
+}
@@ -21,19 +21,13 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
 	"errors"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"net"
 	"net/url"
 	"os"
 	"strings"
 
-	"gopkg.in/yaml.v2"
-
 	"github.com/yarpc/yab/encoding"
 	"github.com/yarpc/yab/transport"
 
@@ -44,8 +38,20 @@ var (
 	errServiceRequired    = errors.New("specify a target service using --service")
 	errPeerRequired       = errors.New("specify at least one peer using --peer or using --hostfile")
 	errPeerOptions        = errors.New("do not specify peers using --peer and --hostfile")
-	errPeerListFile       = errors.New("peer list should be a JSON file with a list of strings")
+	errPeerListFile       = errors.New("peer list should be a JSON or YAML list, a CSV file, or a new line separated list of host:ports")
 	errCallerForBenchmark = errors.New("cannot override caller name when running benchmarks")
+	errHashFieldRequired  = errors.New("specify the request field to hash using --hash-field")
+	errHTTPOnlyOptions    = errors.New("--sni, --host-header, --tls-session-tickets and --cert are only supported for HTTP")
+	errLocalAddrTChannel  = errors.New("--local-addr and --interface are not supported for TChannel")
+	errRedisJSONOnly      = errors.New("Redis peers require --encoding json, with the command's arguments as a JSON list")
+	errKafkaEncoding      = errors.New("Kafka peers require --encoding json or raw")
+	errMQTTEncoding       = errors.New("MQTT peers require --encoding json or raw")
+	errThriftPeerEncoding = errors.New("thrift:// peers require the Thrift encoding")
+	errCQLJSONOnly        = errors.New("CQL peers require --encoding json, with the statement's bind values as a JSON list")
+	errPipeSinglePeer     = errors.New("only one pipe:// peer can be specified")
+	errPipeNetworkOptions = errors.New("--local-addr, --interface, socket options and --proxy-protocol are not supported for pipe:// peers")
+
+	errNewConnectionProtocol = errors.New("--new-connection-per-request is only supported for HTTP and TChannel peers")
 )
 
 func remapLocalHost(hostPorts []string) {
@@ -67,6 +73,11 @@ func protocolFor(hostPort string) string {
 		return "tchannel"
 	}
 
+	// Pipe peers are command lines, which are not valid URLs.
+	if strings.HasPrefix(hostPort, "pipe://") {
+		return "pipe"
+	}
+
 	u, err := url.ParseRequestURI(hostPort)
 	if err != nil {
 		return "unknown"
@@ -75,6 +86,10 @@ func protocolFor(hostPort string) string {
 	return u.Scheme
 }
 
+func isHTTP(protocol string) bool {
+	return protocol == "http" || protocol == "https"
+}
+
 // ensureSameProtocol must get at least one host:port.
 func ensureSameProtocol(hostPorts []string) (string, error) {
 	lastProtocol := protocolFor(hostPorts[0])
@@ -86,28 +101,73 @@ func ensureSameProtocol(hostPorts []string) (string, error) {
 	return lastProtocol, nil
 }
 
-func getTransport(opts TransportOptions, encoding encoding.Encoding) (transport.Transport, error) {
-	if opts.ServiceName == "" {
-		return nil, errServiceRequired
+// getHostPorts returns the peers specified by --peer or --peer-list.
+func getHostPorts(opts TransportOptions) ([]string, error) {
+	peers, err := getPeers(opts)
+	if err != nil {
+		return nil, err
 	}
+	return peerHostPorts(peers), nil
+}
+
+// getPeers returns the peers specified by --peer or --peer-list, including
+// any weights and metadata from the peer list.
+func getPeers(opts TransportOptions) ([]peer, error) {
 	if len(opts.HostPorts) == 0 && opts.HostPortFile == "" {
 		return nil, errPeerRequired
 	}
 
-	hostPorts := opts.HostPorts
-	if opts.HostPortFile != "" {
-		if len(hostPorts) > 0 {
-			return nil, errPeerOptions
-		}
-		var err error
-		hostPorts, err = parseHostFile(opts.HostPortFile)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse host file: %v", err)
+	if opts.HostPortFile == "" {
+		peers := make([]peer, len(opts.HostPorts))
+		for i, hp := range opts.HostPorts {
+			peers[i] = peer{HostPort: hp}
 		}
+		return peers, nil
+	}
 
-		if len(hostPorts) == 0 {
-			return nil, errPeerRequired
-		}
+	if len(opts.HostPorts) > 0 {
+		return nil, errPeerOptions
+	}
+	peers, err := parsePeerFile(opts.HostPortFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse host file: %v", err)
+	}
+
+	peers, err = filterPeers(peers, opts.PeerFilters)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(peers) == 0 {
+		return nil, errPeerRequired
+	}
+	return peers, nil
+}
+
+// getSourceService returns the caller name to use for calls.
+func getSourceService(opts TransportOptions) (string, error) {
+	if opts.CallerOverride == "" {
+		return "yab-" + os.Getenv("USER"), nil
+	}
+	if opts.benchmarking {
+		return "", errCallerForBenchmark
+	}
+	return opts.CallerOverride, nil
+}
+
+func getTransport(opts TransportOptions, e encoding.Encoding) (transport.Transport, error) {
+	if opts.ServiceName == "" {
+		return nil, errServiceRequired
+	}
+
+	peers, err := getPeers(opts)
+	if err != nil {
+		return nil, err
+	}
+	hostPorts := peerHostPorts(peers)
+
+	if opts.PeerStrategy == consistentHashStrategy && opts.HashField == "" {
+		return nil, errHashFieldRequired
 	}
 
 	protocol, err := ensureSameProtocol(hostPorts)
@@ -115,20 +175,94 @@ func getTransport(opts TransportOptions, encoding encoding.Encoding) (transport.
 		return nil, err
 	}
 
-	sourceService := "yab-" + os.Getenv("USER")
-	if opts.CallerOverride != "" {
-		if opts.benchmarking {
-			return nil, errCallerForBenchmark
+	sourceService, err := getSourceService(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isHTTP(protocol) && (opts.SNI != "" || opts.HostHeader != "" || opts.TLSSessionTickets != "" || opts.TLSCert != "") {
+		return nil, errHTTPOnlyOptions
+	}
+	if protocol == "redis" && e != encoding.JSON {
+		return nil, errRedisJSONOnly
+	}
+	if protocol == "kafka" && e != encoding.JSON && e != encoding.Raw {
+		return nil, errKafkaEncoding
+	}
+	if protocol == "mqtt" && e != encoding.JSON && e != encoding.Raw {
+		return nil, errMQTTEncoding
+	}
+	if protocol == "thrift" && e != encoding.Thrift {
+		return nil, errThriftPeerEncoding
+	}
+	if protocol == "cql" && e != encoding.JSON {
+		return nil, errCQLJSONOnly
+	}
+	if protocol == "pipe" && len(hostPorts) > 1 {
+		return nil, errPipeSinglePeer
+	}
+	if protocol == "pipe" && (opts.LocalAddr != "" || opts.Interface != "" || opts.hasSocketOptions() || opts.ProxyProtocol != "") {
+		return nil, errPipeNetworkOptions
+	}
+	if protocol == "tchannel" && (opts.LocalAddr != "" || opts.Interface != "") {
+		return nil, errLocalAddrTChannel
+	}
+	if protocol == "tchannel" && opts.hasSocketOptions() {
+		return nil, errSocketOptionsTChannel
+	}
+	if protocol == "tchannel" && opts.ProxyProtocol != "" {
+		return nil, errProxyProtocolTChannel
+	}
+	if opts.NewConnectionPerRequest && protocol != "tchannel" && !isHTTP(protocol) {
+		return nil, errNewConnectionProtocol
+	}
+
+	hostPorts, err = normalizeHostPorts(protocol, hostPorts, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := newPeersTransport(opts, protocol, sourceService, hostPorts, peerWeights(peers), e)
+	if err != nil {
+		return nil, err
+	}
+	return newSimTransport(t, opts), nil
+}
+
+// newPeersTransport returns a transport that calls the given peers, using
+// the configured peer strategy. If the peers have weights, the default
+// strategy chooses peers at random by weight.
+func newPeersTransport(opts TransportOptions, protocol, sourceService string, hostPorts []string, weights []int, encoding encoding.Encoding) (transport.Transport, error) {
+	strategy := opts.PeerStrategy
+	if strategy == defaultPeerStrategy {
+		if weights == nil {
+			return newTransport(opts, protocol, sourceService, hostPorts, encoding)
 		}
-		sourceService = opts.CallerOverride
+		strategy = randomPeerStrategy
 	}
 
-	if protocol == "tchannel" {
-		remapLocalHost(hostPorts)
+	// Use a separate transport for each peer, so the chooser controls
+	// which peer each call is made to.
+	chooser, err := newPeerChooser(strategy, hostPorts, weights)
+	if err != nil {
+		return nil, err
+	}
 
+	peers := make([]transport.Transport, len(hostPorts))
+	for i, hp := range hostPorts {
+		peers[i], err = newTransport(opts, protocol, sourceService, []string{hp}, encoding)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return newPeerChooserTransport(chooser, peers), nil
+}
+
+func newTransport(opts TransportOptions, protocol, sourceService string, hostPorts []string, encoding encoding.Encoding) (transport.Transport, error) {
+	if protocol == "tchannel" {
 		traceSampleRate := 1.0
 		if opts.benchmarking {
-			traceSampleRate = 0
+			traceSampleRate = opts.traceSampleRate
 		}
 
 		topts := transport.TChannelOptions{
@@ -138,64 +272,116 @@ func getTransport(opts TransportOptions, encoding encoding.Encoding) (transport.
 			Encoding:        encoding.String(),
 			TransportOpts:   opts.TransportOptions,
 			TraceSampleRate: traceSampleRate,
+
+			MaxResponseBytes:  int64(opts.MaxResponseBytes),
+			MaxBufferedBytes:  int64(opts.maxBufferedBytes),
+			BufferPool:        opts.bufferPool,
+			OnConnectionEvent: opts.connectionEvent,
+			ConnectTimeout:    opts.ConnectTimeout.Duration(),
+
+			NewConnectionPerRequest: opts.NewConnectionPerRequest,
 		}
 		return transport.TChannel(topts)
 	}
 
-	hopts := transport.HTTPOptions{
-		SourceService: sourceService,
-		TargetService: opts.ServiceName,
-		URLs:          hostPorts,
+	if protocol == "pipe" {
+		command, err := transport.ParsePipeURL(hostPorts[0])
+		if err != nil {
+			return nil, err
+		}
+		return transport.Pipe(transport.PipeOptions{
+			Command:          command,
+			MaxResponseBytes: int64(opts.MaxResponseBytes),
+		})
 	}
-	return transport.HTTP(hopts)
-}
 
-func parseHostFile(filename string) ([]string, error) {
-	contents, err := ioutil.ReadFile(filename)
+	dial, err := getDialer(opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open peer list: %v", err)
+		return nil, err
 	}
 
-	// Try as JSON.
-	hosts, err := parseHostFileYAML(contents)
-	if err != nil {
-		hosts, err = parseHostsFileNewLines(bytes.NewReader(contents))
-	}
-	if err != nil {
-		return nil, errPeerListFile
+	if protocol == "redis" {
+		return transport.Redis(transport.RedisOptions{
+			URLs:             hostPorts,
+			Dial:             dial,
+			MaxResponseBytes: int64(opts.MaxResponseBytes),
+		})
 	}
 
-	return hosts, nil
-}
-
-func parseHostFileYAML(contents []byte) ([]string, error) {
-	var hosts []string
-	return hosts, yaml.Unmarshal(contents, &hosts)
-}
+	if protocol == "cql" {
+		return transport.CQL(transport.CQLOptions{
+			URLs:             hostPorts,
+			Dial:             dial,
+			MaxResponseBytes: int64(opts.MaxResponseBytes),
+		})
+	}
 
-func parseHostsFileNewLines(r io.Reader) ([]string, error) {
-	var hosts []string
-	rdr := bufio.NewReader(r)
-	for {
-		line, err := rdr.ReadString('\n')
+	if protocol == "kafka" {
+		key, err := newKafkaKey(opts.KafkaKey)
 		if err != nil {
-			if err == io.EOF {
-				break
-			}
 			return nil, err
 		}
 
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
+		return transport.Kafka(transport.KafkaOptions{
+			URLs:             hostPorts,
+			ClientID:         sourceService,
+			Dial:             dial,
+			Acks:             opts.KafkaAcks,
+			Key:              key,
+			MaxResponseBytes: int64(opts.MaxResponseBytes),
+		})
+	}
 
-		if _, _, err := net.SplitHostPort(line); err != nil {
-			return nil, err
-		}
+	if protocol == "thrift" {
+		return transport.Thrift(transport.ThriftOptions{
+			URLs:             hostPorts,
+			Dial:             dial,
+			MaxResponseBytes: int64(opts.MaxResponseBytes),
+		})
+	}
 
-		hosts = append(hosts, line)
+	if protocol == "mqtt" {
+		return transport.MQTT(transport.MQTTOptions{
+			URLs:             hostPorts,
+			ClientID:         sourceService,
+			Dial:             dial,
+			QoS:              opts.MQTTQoS,
+			NoWait:           opts.MQTTNoWait,
+			MaxResponseBytes: int64(opts.MaxResponseBytes),
+		})
 	}
 
-	return hosts, nil
+	hopts := transport.HTTPOptions{
+		SourceService: sourceService,
+		TargetService: opts.ServiceName,
+		URLs:          hostPorts,
+		Dial:          dial,
+		Host:          opts.HostHeader,
+		ServerName:    opts.SNI,
+
+		PreserveHeaderCase: opts.PreserveHeaderCase,
+
+		NoFollowRedirects:      opts.NoFollowRedirects,
+		MaxRedirects:           opts.MaxRedirects,
+		PreserveRedirectMethod: opts.RedirectMethod,
+
+		ExpectContinue:        opts.ExpectContinue,
+		ExpectContinueTimeout: opts.ContinueTimeout,
+		Chunked:               opts.Chunked,
+
+		MaxResponseBytes: int64(opts.MaxResponseBytes),
+		MaxBufferedBytes: int64(opts.maxBufferedBytes),
+		BufferPool:       opts.bufferPool,
+
+		NewConnectionPerRequest: opts.NewConnectionPerRequest,
+		SessionTicketsDisabled:  opts.TLSSessionTickets == "false",
+		OnTLSHandshake:          opts.tlsHandshake,
+	}
+	if opts.cookieJar != nil {
+		hopts.Jar = opts.cookieJar
+	}
+	if opts.clientCert != nil {
+		hopts.ClientCertificate = opts.clientCert.get
+	}
+	return transport.HTTP(hopts)
 }
@@ -0,0 +1,62 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+type callPeerKey struct{}
+
+// CallPeer records the peer chosen for a call, so the peer is known even if
+// the call fails without a response.
+type CallPeer struct {
+	mu   sync.Mutex
+	peer string
+}
+
+// WithCallPeer returns a context that records the peer chosen by calls made
+// using it.
+func WithCallPeer(ctx context.Context) (context.Context, *CallPeer) {
+	p := &CallPeer{}
+	return context.WithValue(ctx, callPeerKey{}, p), p
+}
+
+// Peer returns the peer chosen for the call, or "" if a peer wasn't chosen.
+func (p *CallPeer) Peer() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.peer
+}
+
+// setCallPeer records the peer chosen for a call, if ctx records it.
+func setCallPeer(ctx context.Context, peer string) {
+	p, ok := ctx.Value(callPeerKey{}).(*CallPeer)
+	if !ok {
+		return
+	}
+
+	p.mu.Lock()
+	p.peer = peer
+	p.mu.Unlock()
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func TestCallPeerOnError(t *testing.T) {
+	// Nothing listens on the address, so calls fail before there's a response.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Listen failed")
+	addr := ln.Addr().String()
+	ln.Close()
+
+	httpTransport, err := HTTP(HTTPOptions{
+		URLs:          []string{"http://" + addr + "/rpc"},
+		SourceService: "source",
+		TargetService: "target",
+	})
+	require.NoError(t, err, "Failed to create HTTP transport")
+	redisTransport, err := Redis(RedisOptions{URLs: []string{"redis://" + addr}})
+	require.NoError(t, err, "Failed to create Redis transport")
+
+	tests := []struct {
+		msg       string
+		transport Transport
+		r         *Request
+		want      string
+	}{
+		{"HTTP", httpTransport, &Request{Method: "method", Timeout: time.Second}, "http://" + addr + "/rpc"},
+		{"Redis", redisTransport, &Request{Method: "PING"}, "redis://" + addr},
+	}
+
+	for _, tt := range tests {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		ctx, peer := WithCallPeer(ctx)
+		_, err := tt.transport.Call(ctx, tt.r)
+		cancel()
+		assert.Error(t, err, "%v: call should fail", tt.msg)
+		assert.Equal(t, tt.want, peer.Peer(), "%v: peer should be recorded for a failed call", tt.msg)
+	}
+}
+
+func TestCallPeerNotChosen(t *testing.T) {
+	_, peer := WithCallPeer(context.Background())
+	assert.Equal(t, "", peer.Peer(), "peer should be empty if no call was made")
+
+	// Recording a peer without a CallPeer in the context is a no-op.
+	setCallPeer(context.Background(), "peer")
+}
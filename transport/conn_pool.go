@@ -0,0 +1,110 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// bufConn is a connection with a buffered reader, used by transports that
+// make one call at a time on each connection.
+type bufConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// watch sets the connection's deadline from the context, and unblocks reads
+// and writes if the context is cancelled before the deadline. The returned
+// function must be called once the call completes.
+func (c *bufConn) watch(ctx context.Context) func() {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(time.Second)
+	}
+	c.SetDeadline(deadline)
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// connPool keeps idle connections for each address.
+type connPool struct {
+	dial func(network, addr string) (net.Conn, error)
+
+	mu   sync.Mutex
+	idle map[string][]*bufConn
+}
+
+func newConnPool(dial func(network, addr string) (net.Conn, error)) *connPool {
+	if dial == nil {
+		dial = net.Dial
+	}
+	return &connPool{
+		dial: dial,
+		idle: make(map[string][]*bufConn),
+	}
+}
+
+// get returns an idle connection to addr, or dials a new connection and
+// calls setup with it. Connections must be returned using put if they can
+// be reused, or closed otherwise.
+func (p *connPool) get(addr string, setup func(*bufConn) error) (*bufConn, error) {
+	p.mu.Lock()
+	if idle := p.idle[addr]; len(idle) > 0 {
+		conn := idle[len(idle)-1]
+		p.idle[addr] = idle[:len(idle)-1]
+		p.mu.Unlock()
+		return conn, nil
+	}
+	p.mu.Unlock()
+
+	c, err := p.dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &bufConn{Conn: c, r: bufio.NewReader(c)}
+	if setup != nil {
+		if err := setup(conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (p *connPool) put(addr string, conn *bufConn) {
+	p.mu.Lock()
+	p.idle[addr] = append(p.idle[addr], conn)
+	p.mu.Unlock()
+}
@@ -0,0 +1,555 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// CQLOptions are used to create a CQL transport.
+type CQLOptions struct {
+	// URLs are the nodes to call, as
+	// cql://[user:password@]host:port[/keyspace][?consistency=quorum].
+	URLs []string
+
+	// Dial is used to create connections. If nil, net.Dial is used.
+	Dial func(network, addr string) (net.Conn, error)
+
+	// MaxResponseBytes limits the size of responses. If 0, there is no limit.
+	MaxResponseBytes int64
+}
+
+// CQL native protocol v4 opcodes.
+const (
+	cqlVersion         = 0x04
+	cqlResponseVersion = 0x84
+
+	cqlOpError        = 0x00
+	cqlOpStartup      = 0x01
+	cqlOpReady        = 0x02
+	cqlOpAuthenticate = 0x03
+	cqlOpQuery        = 0x07
+	cqlOpResult       = 0x08
+	cqlOpPrepare      = 0x09
+	cqlOpExecute      = 0x0A
+	cqlOpAuthResponse = 0x0F
+	cqlOpAuthSuccess  = 0x10
+
+	cqlFlagTracing       = 0x02
+	cqlFlagCustomPayload = 0x04
+	cqlFlagWarning       = 0x08
+
+	cqlResultVoid         = 0x0001
+	cqlResultRows         = 0x0002
+	cqlResultSetKeyspace  = 0x0003
+	cqlResultPrepared     = 0x0004
+	cqlResultSchemaChange = 0x0005
+
+	cqlErrUnprepared = 0x2500
+)
+
+var cqlConsistencies = map[string]int16{
+	"any":          0x0000,
+	"one":          0x0001,
+	"two":          0x0002,
+	"three":        0x0003,
+	"quorum":       0x0004,
+	"all":          0x0005,
+	"local_quorum": 0x0006,
+	"each_quorum":  0x0007,
+	"serial":       0x0008,
+	"local_serial": 0x0009,
+	"local_one":    0x000A,
+}
+
+var (
+	errNoCQLStatement  = errors.New("specify the CQL statement as the method")
+	errCQLValues       = errors.New("CQL values should be a JSON list with a value for each bind marker")
+	errCQLResponseSize = errors.New("CQL response exceeds the maximum response size")
+)
+
+// CQLError is returned for error responses.
+type CQLError struct {
+	Code    int32
+	Message string
+}
+
+var cqlErrorNames = map[int32]string{
+	0x0000: "Server error",
+	0x000A: "Protocol error",
+	0x0100: "Bad credentials",
+	0x1000: "Unavailable",
+	0x1001: "Overloaded",
+	0x1002: "Is bootstrapping",
+	0x1100: "Write timeout",
+	0x1200: "Read timeout",
+	0x1300: "Read failure",
+	0x1500: "Write failure",
+	0x2000: "Syntax error",
+	0x2100: "Unauthorized",
+	0x2200: "Invalid",
+	0x2300: "Config error",
+	0x2400: "Already exists",
+	0x2500: "Unprepared",
+}
+
+func (e CQLError) Error() string {
+	if name, ok := cqlErrorNames[e.Code]; ok {
+		return fmt.Sprintf("CQL error %v (0x%04x): %v", name, e.Code, e.Message)
+	}
+	return fmt.Sprintf("CQL error 0x%04x: %v", e.Code, e.Message)
+}
+
+type cqlPeer struct {
+	addr        string
+	user        string
+	password    string
+	keyspace    string
+	consistency int16
+}
+
+type cqlPrepared struct {
+	id     []byte
+	params []*cqlType
+}
+
+type cqlTransport struct {
+	peers        []cqlPeer
+	pool         *connPool
+	maxBodyBytes int64
+
+	mu       sync.Mutex
+	prepared map[string]*cqlPrepared
+}
+
+// CQL returns a transport that executes CQL statements using the native
+// protocol. Calls prepare the method as a statement, execute it with the body
+// as a JSON list of bind values, and reply with the JSON representation of
+// the result.
+func CQL(opts CQLOptions) (Transport, error) {
+	if len(opts.URLs) == 0 {
+		return nil, errNoURLs
+	}
+
+	peers := make([]cqlPeer, len(opts.URLs))
+	for i, u := range opts.URLs {
+		peer, err := parseCQLURL(u)
+		if err != nil {
+			return nil, err
+		}
+		peers[i] = peer
+	}
+
+	return &cqlTransport{
+		peers:        peers,
+		pool:         newConnPool(opts.Dial),
+		maxBodyBytes: opts.MaxResponseBytes,
+		prepared:     make(map[string]*cqlPrepared),
+	}, nil
+}
+
+func parseCQLURL(s string) (cqlPeer, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return cqlPeer{}, err
+	}
+	if u.Scheme != "cql" || u.Host == "" {
+		return cqlPeer{}, fmt.Errorf("invalid CQL URL %q, expected cql://host:port", s)
+	}
+
+	peer := cqlPeer{
+		addr:        u.Host,
+		keyspace:    strings.Trim(u.Path, "/"),
+		consistency: cqlConsistencies["one"],
+	}
+	if u.User != nil {
+		peer.user = u.User.Username()
+		peer.password, _ = u.User.Password()
+	}
+	if c := u.Query().Get("consistency"); c != "" {
+		consistency, ok := cqlConsistencies[strings.ToLower(c)]
+		if !ok {
+			return cqlPeer{}, fmt.Errorf("invalid CQL consistency %q in %v", c, s)
+		}
+		peer.consistency = consistency
+	}
+	return peer, nil
+}
+
+func cqlFrame(opcode byte, body []byte) []byte {
+	w := &wireWriter{}
+	w.int8(cqlVersion)
+	w.int8(0)  // flags
+	w.int16(0) // stream
+	w.int8(int8(opcode))
+	w.bytes(body)
+	return w.Bytes()
+}
+
+// readCQLFrame reads a response frame, and returns its opcode and body.
+// Error responses are returned as a CQLError.
+func readCQLFrame(r *bufio.Reader, maxBytes int64) (byte, *wireReader, error) {
+	var header [9]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	if header[0] != cqlResponseVersion {
+		return 0, nil, fmt.Errorf("unsupported CQL response version 0x%02x", header[0])
+	}
+
+	size := int64(int32(binary.BigEndian.Uint32(header[5:])))
+	if size < 0 {
+		return 0, nil, errShortResponse
+	}
+	if maxBytes > 0 && size > maxBytes {
+		return 0, nil, errCQLResponseSize
+	}
+
+	body := &wireReader{buf: make([]byte, size)}
+	if _, err := io.ReadFull(r, body.buf); err != nil {
+		return 0, nil, err
+	}
+
+	flags, opcode := header[1], header[4]
+	if flags&cqlFlagTracing != 0 {
+		body.next(16)
+	}
+	if flags&cqlFlagWarning != 0 {
+		for i, n := 0, int(body.int16()); i < n; i++ {
+			body.string()
+		}
+	}
+	if flags&cqlFlagCustomPayload != 0 {
+		for i, n := 0, int(body.int16()); i < n; i++ {
+			body.string()
+			body.bytes()
+		}
+	}
+
+	if opcode == cqlOpError {
+		err := CQLError{Code: body.int32(), Message: body.string()}
+		if body.err != nil {
+			return 0, nil, fmt.Errorf("failed to parse CQL error: %v", body.err)
+		}
+		return 0, nil, err
+	}
+	return opcode, body, body.err
+}
+
+func (t *cqlTransport) roundTrip(conn *bufConn, opcode byte, body []byte) (byte, *wireReader, error) {
+	if _, err := conn.Write(cqlFrame(opcode, body)); err != nil {
+		return 0, nil, err
+	}
+	return readCQLFrame(conn.r, t.maxBodyBytes)
+}
+
+// setupConn starts, authenticates, and sets the keyspace of new connections.
+func (t *cqlTransport) setupConn(peer cqlPeer) func(*bufConn) error {
+	return func(conn *bufConn) error {
+		startup := &wireWriter{}
+		startup.int16(1)
+		startup.string("CQL_VERSION")
+		startup.string("3.0.0")
+
+		opcode, _, err := t.roundTrip(conn, cqlOpStartup, startup.Bytes())
+		if err != nil {
+			return fmt.Errorf("failed to start CQL connection: %v", err)
+		}
+
+		if opcode == cqlOpAuthenticate {
+			if peer.user == "" {
+				return errors.New("CQL node requires authentication, specify the user and password in the cql:// URL")
+			}
+
+			// Use SASL PLAIN, which is supported by PasswordAuthenticator.
+			auth := &wireWriter{}
+			auth.bytes([]byte("\x00" + peer.user + "\x00" + peer.password))
+			if opcode, _, err = t.roundTrip(conn, cqlOpAuthResponse, auth.Bytes()); err != nil {
+				return fmt.Errorf("failed to authenticate CQL connection: %v", err)
+			}
+			if opcode != cqlOpAuthSuccess {
+				return fmt.Errorf("failed to authenticate CQL connection, got opcode 0x%02x", opcode)
+			}
+		} else if opcode != cqlOpReady {
+			return fmt.Errorf("failed to start CQL connection, got opcode 0x%02x", opcode)
+		}
+
+		if peer.keyspace != "" {
+			use := &wireWriter{}
+			use.bytes([]byte("USE " + peer.keyspace))
+			use.int16(peer.consistency)
+			use.int8(0) // flags
+			if _, _, err := t.roundTrip(conn, cqlOpQuery, use.Bytes()); err != nil {
+				return fmt.Errorf("failed to use keyspace %v: %v", peer.keyspace, err)
+			}
+		}
+		return nil
+	}
+}
+
+// prepare returns the prepared statement, preparing it on the node the first
+// time it is used. Prepared statements are shared by connections to a node.
+func (t *cqlTransport) prepare(conn *bufConn, peer cqlPeer, statement string) (*cqlPrepared, error) {
+	cacheKey := peer.addr + "\x00" + statement
+	t.mu.Lock()
+	prepared, ok := t.prepared[cacheKey]
+	t.mu.Unlock()
+	if ok {
+		return prepared, nil
+	}
+
+	body := &wireWriter{}
+	body.bytes([]byte(statement))
+	_, res, err := t.roundTrip(conn, cqlOpPrepare, body.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	if kind := res.int32(); kind != cqlResultPrepared {
+		return nil, fmt.Errorf("unexpected CQL result kind 0x%04x for prepare", kind)
+	}
+	prepared = &cqlPrepared{id: res.next(int(res.int16()))}
+
+	flags := res.int32()
+	columns := int(res.int32())
+	for i, n := 0, int(res.int32()); i < n; i++ {
+		res.int16() // partition key index
+	}
+	prepared.params = readCQLColumns(res, flags, columns, nil)
+	if res.err != nil {
+		return nil, fmt.Errorf("failed to parse CQL prepared result: %v", res.err)
+	}
+
+	t.mu.Lock()
+	t.prepared[cacheKey] = prepared
+	t.mu.Unlock()
+	return prepared, nil
+}
+
+func (t *cqlTransport) unprepare(peer cqlPeer, statement string) {
+	t.mu.Lock()
+	delete(t.prepared, peer.addr+"\x00"+statement)
+	t.mu.Unlock()
+}
+
+// readCQLColumns reads column specs, and returns their types. If names is
+// not nil, the column names are appended to it.
+func readCQLColumns(r *wireReader, flags int32, columns int, names *[]string) []*cqlType {
+	const globalTablesSpec = 0x0001
+
+	if flags&globalTablesSpec != 0 {
+		r.string() // keyspace
+		r.string() // table
+	}
+
+	types := make([]*cqlType, 0, columns)
+	for i := 0; i < columns && r.err == nil; i++ {
+		if flags&globalTablesSpec == 0 {
+			r.string() // keyspace
+			r.string() // table
+		}
+		name := r.string()
+		if names != nil {
+			*names = append(*names, name)
+		}
+		types = append(types, readCQLType(r))
+	}
+	return types
+}
+
+// cqlValues returns the bind values in the body, which should be a JSON list.
+func cqlValues(body []byte) ([]interface{}, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 || bytes.Equal(body, []byte("null")) || bytes.Equal(body, []byte("{}")) {
+		return nil, nil
+	}
+
+	var values []interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return nil, errCQLValues
+	}
+	return values, nil
+}
+
+func (t *cqlTransport) execute(conn *bufConn, peer cqlPeer, prepared *cqlPrepared, values []interface{}) (*wireReader, error) {
+	if len(values) != len(prepared.params) {
+		return nil, fmt.Errorf("statement has %v bind markers, got %v values", len(prepared.params), len(values))
+	}
+
+	body := &wireWriter{}
+	body.int16(int16(len(prepared.id)))
+	body.Write(prepared.id)
+	body.int16(peer.consistency)
+	if len(values) == 0 {
+		body.int8(0)
+	} else {
+		body.int8(0x01) // values
+		body.int16(int16(len(values)))
+		for i, v := range values {
+			bs, err := encodeCQLValue(prepared.params[i], v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %v: %v", i, err)
+			}
+			writeCQLValue(body, bs)
+		}
+	}
+
+	_, res, err := t.roundTrip(conn, cqlOpExecute, body.Bytes())
+	return res, err
+}
+
+func (t *cqlTransport) Call(ctx context.Context, r *Request) (*Response, error) {
+	statement := strings.TrimSpace(r.Method)
+	if statement == "" {
+		return nil, errNoCQLStatement
+	}
+	values, err := cqlValues(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	peer := t.peers[rand.Intn(len(t.peers))]
+	setCallPeer(ctx, "cql://"+peer.addr)
+	conn, err := t.pool.get(peer.addr, t.setupConn(peer))
+	if err != nil {
+		return nil, err
+	}
+
+	done := conn.watch(ctx)
+	res, err := t.call(conn, peer, statement, values)
+	done()
+	if _, ok := err.(CQLError); err != nil && !ok {
+		// The connection is in an unknown state after I/O errors.
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	t.pool.put(peer.addr, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+	return &Response{
+		Body: body,
+		Peer: "cql://" + peer.addr,
+	}, nil
+}
+
+// call prepares and executes the statement, preparing it again if the node
+// no longer has the prepared statement, e.g. after a restart.
+func (t *cqlTransport) call(conn *bufConn, peer cqlPeer, statement string, values []interface{}) (interface{}, error) {
+	var res *wireReader
+	for attempt := 0; ; attempt++ {
+		prepared, err := t.prepare(conn, peer, statement)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err = t.execute(conn, peer, prepared, values)
+		if cqlErr, ok := err.(CQLError); ok && cqlErr.Code == cqlErrUnprepared && attempt == 0 {
+			t.unprepare(peer, statement)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+
+	result, err := parseCQLResult(res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CQL result: %v", err)
+	}
+	return result, nil
+}
+
+// parseCQLResult returns the JSON representation of a result. Rows are
+// returned as a list of objects, keyed by column name.
+func parseCQLResult(r *wireReader) (interface{}, error) {
+	switch kind := r.int32(); kind {
+	case cqlResultVoid:
+		return map[string]interface{}{}, r.err
+	case cqlResultSetKeyspace:
+		return map[string]interface{}{"keyspace": r.string()}, r.err
+	case cqlResultSchemaChange:
+		change := r.string()
+		target := r.string()
+		return map[string]interface{}{"change": change, "target": target, "keyspace": r.string()}, r.err
+	case cqlResultRows:
+		const (
+			hasMorePages = 0x0002
+			noMetadata   = 0x0004
+		)
+
+		flags := r.int32()
+		columns := int(r.int32())
+		if flags&hasMorePages != 0 {
+			r.bytes() // paging state
+		}
+		if flags&noMetadata != 0 {
+			return nil, errors.New("rows have no metadata")
+		}
+
+		var names []string
+		types := readCQLColumns(r, flags, columns, &names)
+
+		n := r.arrayLen()
+		rows := make([]interface{}, 0, n)
+		for i := 0; i < n && r.err == nil; i++ {
+			row := make(map[string]interface{}, len(types))
+			for j, t := range types {
+				v, err := decodeCQLValue(t, r.bytes())
+				if err != nil {
+					return nil, fmt.Errorf("column %v: %v", names[j], err)
+				}
+				row[names[j]] = v
+			}
+			rows = append(rows, row)
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+		return map[string]interface{}{"rows": rows}, nil
+	default:
+		return nil, fmt.Errorf("unexpected result kind 0x%04x", kind)
+	}
+}
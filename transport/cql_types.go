@@ -0,0 +1,555 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CQL type IDs, as used in result metadata.
+const (
+	cqlCustom    = 0x0000
+	cqlASCII     = 0x0001
+	cqlBigint    = 0x0002
+	cqlBlob      = 0x0003
+	cqlBoolean   = 0x0004
+	cqlCounter   = 0x0005
+	cqlDecimal   = 0x0006
+	cqlDouble    = 0x0007
+	cqlFloat     = 0x0008
+	cqlInt       = 0x0009
+	cqlTimestamp = 0x000B
+	cqlUUID      = 0x000C
+	cqlVarchar   = 0x000D
+	cqlVarint    = 0x000E
+	cqlTimeUUID  = 0x000F
+	cqlInet      = 0x0010
+	cqlDate      = 0x0011
+	cqlTime      = 0x0012
+	cqlSmallint  = 0x0013
+	cqlTinyint   = 0x0014
+	cqlDuration  = 0x0015
+	cqlList      = 0x0020
+	cqlMap       = 0x0021
+	cqlSet       = 0x0022
+	cqlUDT       = 0x0030
+	cqlTuple     = 0x0031
+)
+
+var cqlTypeNames = map[uint16]string{
+	cqlASCII:     "ascii",
+	cqlBigint:    "bigint",
+	cqlBlob:      "blob",
+	cqlBoolean:   "boolean",
+	cqlCounter:   "counter",
+	cqlDecimal:   "decimal",
+	cqlDouble:    "double",
+	cqlFloat:     "float",
+	cqlInt:       "int",
+	cqlTimestamp: "timestamp",
+	cqlUUID:      "uuid",
+	cqlVarchar:   "varchar",
+	cqlVarint:    "varint",
+	cqlTimeUUID:  "timeuuid",
+	cqlInet:      "inet",
+	cqlDate:      "date",
+	cqlTime:      "time",
+	cqlSmallint:  "smallint",
+	cqlTinyint:   "tinyint",
+	cqlDuration:  "duration",
+	cqlList:      "list",
+	cqlMap:       "map",
+	cqlSet:       "set",
+	cqlUDT:       "udt",
+	cqlTuple:     "tuple",
+}
+
+// cqlDateEpoch is the value of 1970-01-01 for the date type.
+const cqlDateEpoch = 1 << 31
+
+type cqlType struct {
+	id     uint16
+	custom string
+
+	// elems are the element types of collections and tuples, the key and
+	// value types of maps, or the field types of user-defined types.
+	elems []*cqlType
+
+	// fields are the field names of user-defined types.
+	fields []string
+}
+
+func (t *cqlType) String() string {
+	if t.id == cqlCustom {
+		return t.custom
+	}
+	if name, ok := cqlTypeNames[t.id]; ok {
+		return name
+	}
+	return fmt.Sprintf("type 0x%04x", t.id)
+}
+
+func readCQLType(r *wireReader) *cqlType {
+	t := &cqlType{id: uint16(r.int16())}
+	switch t.id {
+	case cqlCustom:
+		t.custom = r.string()
+	case cqlList, cqlSet:
+		t.elems = []*cqlType{readCQLType(r)}
+	case cqlMap:
+		t.elems = []*cqlType{readCQLType(r), readCQLType(r)}
+	case cqlUDT:
+		r.string() // keyspace
+		r.string() // name
+		for i, n := 0, int(r.int16()); i < n && r.err == nil; i++ {
+			t.fields = append(t.fields, r.string())
+			t.elems = append(t.elems, readCQLType(r))
+		}
+	case cqlTuple:
+		for i, n := 0, int(r.int16()); i < n && r.err == nil; i++ {
+			t.elems = append(t.elems, readCQLType(r))
+		}
+	}
+	return t
+}
+
+// cqlBinary is the representation of binary values, the same as binary
+// values in Thrift.
+func cqlBinary(bs []byte) map[string]interface{} {
+	return map[string]interface{}{"base64": base64.StdEncoding.EncodeToString(bs)}
+}
+
+// decodeCQLValue converts a value to its JSON representation. Timestamps,
+// dates, times, UUIDs and addresses are returned as strings, and types
+// without a JSON representation use the binary representation.
+func decodeCQLValue(t *cqlType, bs []byte) (interface{}, error) {
+	if bs == nil {
+		return nil, nil
+	}
+
+	fixed := func(n int) error {
+		if len(bs) != n {
+			return fmt.Errorf("invalid %v value with %v bytes", t, len(bs))
+		}
+		return nil
+	}
+
+	switch t.id {
+	case cqlASCII, cqlVarchar:
+		return string(bs), nil
+	case cqlBigint, cqlCounter:
+		if err := fixed(8); err != nil {
+			return nil, err
+		}
+		return int64(binary.BigEndian.Uint64(bs)), nil
+	case cqlInt:
+		if err := fixed(4); err != nil {
+			return nil, err
+		}
+		return int32(binary.BigEndian.Uint32(bs)), nil
+	case cqlSmallint:
+		if err := fixed(2); err != nil {
+			return nil, err
+		}
+		return int16(binary.BigEndian.Uint16(bs)), nil
+	case cqlTinyint:
+		if err := fixed(1); err != nil {
+			return nil, err
+		}
+		return int8(bs[0]), nil
+	case cqlBoolean:
+		if err := fixed(1); err != nil {
+			return nil, err
+		}
+		return bs[0] != 0, nil
+	case cqlDouble:
+		if err := fixed(8); err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(bs)), nil
+	case cqlFloat:
+		if err := fixed(4); err != nil {
+			return nil, err
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(bs)), nil
+	case cqlTimestamp:
+		if err := fixed(8); err != nil {
+			return nil, err
+		}
+		ms := int64(binary.BigEndian.Uint64(bs))
+		return time.Unix(0, ms*int64(time.Millisecond)).UTC().Format(time.RFC3339Nano), nil
+	case cqlDate:
+		if err := fixed(4); err != nil {
+			return nil, err
+		}
+		days := int64(binary.BigEndian.Uint32(bs)) - cqlDateEpoch
+		return time.Unix(days*24*60*60, 0).UTC().Format("2006-01-02"), nil
+	case cqlTime:
+		if err := fixed(8); err != nil {
+			return nil, err
+		}
+		nanos := time.Duration(binary.BigEndian.Uint64(bs))
+		return time.Time{}.Add(nanos).Format("15:04:05.999999999"), nil
+	case cqlUUID, cqlTimeUUID:
+		if err := fixed(16); err != nil {
+			return nil, err
+		}
+		h := hex.EncodeToString(bs)
+		return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:], nil
+	case cqlInet:
+		if len(bs) != net.IPv4len && len(bs) != net.IPv6len {
+			return nil, fmt.Errorf("invalid inet value with %v bytes", len(bs))
+		}
+		return net.IP(bs).String(), nil
+	case cqlVarint:
+		return json.Number(decodeCQLVarint(bs).String()), nil
+	case cqlDecimal:
+		if len(bs) < 4 {
+			return nil, fmt.Errorf("invalid decimal value with %v bytes", len(bs))
+		}
+		scale := int32(binary.BigEndian.Uint32(bs))
+		return json.Number(fmt.Sprintf("%ve%v", decodeCQLVarint(bs[4:]), -scale)), nil
+	case cqlList, cqlSet:
+		return decodeCQLCollection(t, bs)
+	case cqlMap:
+		return decodeCQLMap(t, bs)
+	case cqlUDT, cqlTuple:
+		return decodeCQLFields(t, bs)
+	}
+	return cqlBinary(bs), nil
+}
+
+func decodeCQLVarint(bs []byte) *big.Int {
+	v := new(big.Int).SetBytes(bs)
+	if len(bs) > 0 && bs[0]&0x80 != 0 {
+		v.Sub(v, new(big.Int).Lsh(big.NewInt(1), uint(8*len(bs))))
+	}
+	return v
+}
+
+func decodeCQLCollection(t *cqlType, bs []byte) ([]interface{}, error) {
+	r := &wireReader{buf: bs}
+	n := r.arrayLen()
+	result := make([]interface{}, 0, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		v, err := decodeCQLValue(t.elems[0], r.bytes())
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("invalid %v value: %v", t, r.err)
+	}
+	return result, nil
+}
+
+func decodeCQLMap(t *cqlType, bs []byte) (map[string]interface{}, error) {
+	r := &wireReader{buf: bs}
+	n := r.arrayLen()
+	result := make(map[string]interface{}, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		key, err := decodeCQLValue(t.elems[0], r.bytes())
+		if err != nil {
+			return nil, err
+		}
+		value, err := decodeCQLValue(t.elems[1], r.bytes())
+		if err != nil {
+			return nil, err
+		}
+
+		// JSON keys must be strings, so other keys are marshalled to strings.
+		keyS, ok := key.(string)
+		if !ok {
+			bs, err := json.Marshal(key)
+			if err != nil {
+				return nil, err
+			}
+			keyS = string(bs)
+		}
+		result[keyS] = value
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("invalid %v value: %v", t, r.err)
+	}
+	return result, nil
+}
+
+// decodeCQLFields decodes tuples to lists, and user-defined types to maps.
+// Values may have fewer fields than the type if fields were added later.
+func decodeCQLFields(t *cqlType, bs []byte) (interface{}, error) {
+	r := &wireReader{buf: bs}
+	values := make([]interface{}, 0, len(t.elems))
+	for i := 0; i < len(t.elems) && len(r.buf) > 0; i++ {
+		v, err := decodeCQLValue(t.elems[i], r.bytes())
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("invalid %v value: %v", t, r.err)
+	}
+
+	if t.id == cqlTuple {
+		return values, nil
+	}
+	result := make(map[string]interface{}, len(values))
+	for i, v := range values {
+		result[t.fields[i]] = v
+	}
+	return result, nil
+}
+
+// encodeCQLValue converts a JSON value to a bind value of the given type.
+// Numbers must be decoded as json.Number, so large integers are not rounded.
+func encodeCQLValue(t *cqlType, v interface{}) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	mismatch := func() error {
+		return fmt.Errorf("cannot use %v (%T) as CQL %v", v, v, t)
+	}
+
+	switch t.id {
+	case cqlASCII, cqlVarchar:
+		s, ok := v.(string)
+		if !ok {
+			return nil, mismatch()
+		}
+		return []byte(s), nil
+	case cqlBigint, cqlCounter, cqlInt, cqlSmallint, cqlTinyint:
+		n, ok := v.(json.Number)
+		if !ok {
+			return nil, mismatch()
+		}
+		return encodeCQLInt(t, n.String())
+	case cqlBoolean:
+		b, ok := v.(bool)
+		if !ok {
+			return nil, mismatch()
+		}
+		if b {
+			return []byte{1}, nil
+		}
+		return []byte{0}, nil
+	case cqlDouble, cqlFloat:
+		n, ok := v.(json.Number)
+		if !ok {
+			return nil, mismatch()
+		}
+		if t.id == cqlFloat {
+			f, err := strconv.ParseFloat(n.String(), 32)
+			if err != nil {
+				return nil, err
+			}
+			bs := make([]byte, 4)
+			binary.BigEndian.PutUint32(bs, math.Float32bits(float32(f)))
+			return bs, nil
+		}
+		f, err := strconv.ParseFloat(n.String(), 64)
+		if err != nil {
+			return nil, err
+		}
+		bs := make([]byte, 8)
+		binary.BigEndian.PutUint64(bs, math.Float64bits(f))
+		return bs, nil
+	case cqlTimestamp:
+		var ms int64
+		switch v := v.(type) {
+		case json.Number:
+			var err error
+			if ms, err = strconv.ParseInt(v.String(), 10, 64); err != nil {
+				return nil, err
+			}
+		case string:
+			ts, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return nil, err
+			}
+			ms = ts.UnixNano() / int64(time.Millisecond)
+		default:
+			return nil, mismatch()
+		}
+		bs := make([]byte, 8)
+		binary.BigEndian.PutUint64(bs, uint64(ms))
+		return bs, nil
+	case cqlDate:
+		s, ok := v.(string)
+		if !ok {
+			return nil, mismatch()
+		}
+		d, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			return nil, err
+		}
+		bs := make([]byte, 4)
+		binary.BigEndian.PutUint32(bs, uint32(d.Unix()/(24*60*60)+cqlDateEpoch))
+		return bs, nil
+	case cqlUUID, cqlTimeUUID:
+		s, ok := v.(string)
+		if !ok {
+			return nil, mismatch()
+		}
+		bs, err := hex.DecodeString(strings.Replace(s, "-", "", -1))
+		if err != nil || len(bs) != 16 {
+			return nil, fmt.Errorf("invalid UUID %q", s)
+		}
+		return bs, nil
+	case cqlInet:
+		s, ok := v.(string)
+		if !ok {
+			return nil, mismatch()
+		}
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %q", s)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4, nil
+		}
+		return ip, nil
+	case cqlVarint:
+		n, ok := v.(json.Number)
+		if !ok {
+			return nil, mismatch()
+		}
+		i, ok := new(big.Int).SetString(n.String(), 10)
+		if !ok {
+			return nil, mismatch()
+		}
+		return encodeCQLVarint(i), nil
+	case cqlBlob:
+		switch v := v.(type) {
+		case string:
+			return []byte(v), nil
+		case map[string]interface{}:
+			if s, ok := v["base64"].(string); ok && len(v) == 1 {
+				return base64.StdEncoding.DecodeString(s)
+			}
+		}
+		return nil, mismatch()
+	case cqlList, cqlSet:
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil, mismatch()
+		}
+		w := &wireWriter{}
+		w.int32(int32(len(list)))
+		for _, item := range list {
+			bs, err := encodeCQLValue(t.elems[0], item)
+			if err != nil {
+				return nil, err
+			}
+			writeCQLValue(w, bs)
+		}
+		return w.Bytes(), nil
+	case cqlMap:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, mismatch()
+		}
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		w := &wireWriter{}
+		w.int32(int32(len(m)))
+		for _, k := range keys {
+			// JSON keys are strings, so other key types are parsed from JSON.
+			kbs, err := encodeCQLValue(t.elems[0], cqlMapKey(t.elems[0], k))
+			if err != nil {
+				return nil, err
+			}
+			vbs, err := encodeCQLValue(t.elems[1], m[k])
+			if err != nil {
+				return nil, err
+			}
+			writeCQLValue(w, kbs)
+			writeCQLValue(w, vbs)
+		}
+		return w.Bytes(), nil
+	}
+	return nil, fmt.Errorf("CQL %v is not supported for bind values", t)
+}
+
+// cqlMapKey converts a JSON key, which is always a string, to the value
+// used for the map's key type.
+func cqlMapKey(t *cqlType, k string) interface{} {
+	switch t.id {
+	case cqlBigint, cqlCounter, cqlInt, cqlSmallint, cqlTinyint, cqlDouble, cqlFloat, cqlVarint:
+		return json.Number(k)
+	case cqlBoolean:
+		return k == "true"
+	}
+	return k
+}
+
+func encodeCQLInt(t *cqlType, s string) ([]byte, error) {
+	sizes := map[uint16]int{cqlBigint: 8, cqlCounter: 8, cqlInt: 4, cqlSmallint: 2, cqlTinyint: 1}
+	size := sizes[t.id]
+	n, err := strconv.ParseInt(s, 10, size*8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CQL %v %v: %v", t, s, err)
+	}
+
+	bs := make([]byte, 8)
+	binary.BigEndian.PutUint64(bs, uint64(n))
+	return bs[8-size:], nil
+}
+
+// encodeCQLVarint returns the two's complement representation of v.
+func encodeCQLVarint(v *big.Int) []byte {
+	n := v.BitLen()/8 + 1
+	if v.Sign() >= 0 {
+		bs := v.Bytes()
+		if len(bs) == 0 || bs[0]&0x80 != 0 {
+			bs = append([]byte{0}, bs...)
+		}
+		return bs
+	}
+
+	// Negative values are offset by 2^(8n), which sets the top bit.
+	return new(big.Int).Add(v, new(big.Int).Lsh(big.NewInt(1), uint(8*n))).Bytes()
+}
+
+// writeCQLValue writes a value with an int32 length, using -1 for null.
+func writeCQLValue(w *wireWriter, bs []byte) {
+	if bs == nil {
+		w.int32(-1)
+		return
+	}
+	w.bytes(bs)
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCQLValueRoundTrip(t *testing.T) {
+	text := &cqlType{id: cqlVarchar}
+	tests := []struct {
+		typ  *cqlType
+		in   interface{}
+		want interface{}
+	}{
+		{typ: text, in: "foo", want: "foo"},
+		{typ: &cqlType{id: cqlASCII}, in: "foo", want: "foo"},
+		{typ: &cqlType{id: cqlBigint}, in: json.Number("-9007199254740993"), want: int64(-9007199254740993)},
+		{typ: &cqlType{id: cqlInt}, in: json.Number("-2"), want: int32(-2)},
+		{typ: &cqlType{id: cqlSmallint}, in: json.Number("300"), want: int16(300)},
+		{typ: &cqlType{id: cqlTinyint}, in: json.Number("-1"), want: int8(-1)},
+		{typ: &cqlType{id: cqlBoolean}, in: true, want: true},
+		{typ: &cqlType{id: cqlDouble}, in: json.Number("1.5"), want: 1.5},
+		{typ: &cqlType{id: cqlFloat}, in: json.Number("0.25"), want: float32(0.25)},
+		{typ: &cqlType{id: cqlTimestamp}, in: json.Number("1500"), want: "1970-01-01T00:00:01.5Z"},
+		{typ: &cqlType{id: cqlTimestamp}, in: "2016-05-01T10:00:00Z", want: "2016-05-01T10:00:00Z"},
+		{typ: &cqlType{id: cqlDate}, in: "1969-12-31", want: "1969-12-31"},
+		{typ: &cqlType{id: cqlUUID}, in: "123e4567-e89b-12d3-a456-426655440000", want: "123e4567-e89b-12d3-a456-426655440000"},
+		{typ: &cqlType{id: cqlInet}, in: "10.0.0.1", want: "10.0.0.1"},
+		{typ: &cqlType{id: cqlInet}, in: "::1", want: "::1"},
+		{typ: &cqlType{id: cqlVarint}, in: json.Number("-129"), want: json.Number("-129")},
+		{typ: &cqlType{id: cqlVarint}, in: json.Number("128"), want: json.Number("128")},
+		{typ: &cqlType{id: cqlVarint}, in: json.Number("-128"), want: json.Number("-128")},
+		{typ: &cqlType{id: cqlBlob}, in: map[string]interface{}{"base64": "//4="}, want: map[string]interface{}{"base64": "//4="}},
+		{typ: &cqlType{id: cqlBlob}, in: "ab", want: map[string]interface{}{"base64": "YWI="}},
+		{typ: text, in: nil, want: nil},
+		{
+			typ:  &cqlType{id: cqlList, elems: []*cqlType{{id: cqlInt}}},
+			in:   []interface{}{json.Number("1"), json.Number("2")},
+			want: []interface{}{int32(1), int32(2)},
+		},
+		{
+			typ:  &cqlType{id: cqlSet, elems: []*cqlType{text}},
+			in:   []interface{}{"a"},
+			want: []interface{}{"a"},
+		},
+		{
+			typ:  &cqlType{id: cqlMap, elems: []*cqlType{text, {id: cqlBigint}}},
+			in:   map[string]interface{}{"a": json.Number("1")},
+			want: map[string]interface{}{"a": int64(1)},
+		},
+		{
+			typ:  &cqlType{id: cqlMap, elems: []*cqlType{{id: cqlInt}, text}},
+			in:   map[string]interface{}{"1": "a"},
+			want: map[string]interface{}{"1": "a"},
+		},
+		{
+			typ:  &cqlType{id: cqlMap, elems: []*cqlType{{id: cqlUUID}, text}},
+			in:   map[string]interface{}{"123e4567-e89b-12d3-a456-426655440000": "a"},
+			want: map[string]interface{}{"123e4567-e89b-12d3-a456-426655440000": "a"},
+		},
+	}
+
+	for _, tt := range tests {
+		bs, err := encodeCQLValue(tt.typ, tt.in)
+		require.NoError(t, err, "encodeCQLValue(%v, %v) failed", tt.typ, tt.in)
+
+		got, err := decodeCQLValue(tt.typ, bs)
+		require.NoError(t, err, "decodeCQLValue(%v) failed", tt.typ)
+		assert.Equal(t, tt.want, got, "Unexpected round trip for %v %v", tt.typ, tt.in)
+	}
+}
+
+func TestCQLDecodeOnly(t *testing.T) {
+	tests := []struct {
+		typ  *cqlType
+		bs   []byte
+		want interface{}
+	}{
+		{typ: &cqlType{id: cqlDecimal}, bs: []byte{0, 0, 0, 2, 0x30, 0x39}, want: json.Number("12345e-2")},
+		{typ: &cqlType{id: cqlTime}, bs: []byte{0, 0, 3, 98, 212, 23, 174, 1}, want: "01:02:03.000000001"},
+		{typ: &cqlType{id: cqlDuration}, bs: []byte{1, 2}, want: map[string]interface{}{"base64": "AQI="}},
+		{
+			typ:  &cqlType{id: cqlTuple, elems: []*cqlType{{id: cqlVarchar}, {id: cqlBoolean}}},
+			bs:   []byte{0, 0, 0, 1, 'a', 0xff, 0xff, 0xff, 0xff},
+			want: []interface{}{"a", nil},
+		},
+		{
+			// The value has fewer fields than the type, as the field was added later.
+			typ:  &cqlType{id: cqlUDT, fields: []string{"street", "zip"}, elems: []*cqlType{{id: cqlVarchar}, {id: cqlInt}}},
+			bs:   []byte{0, 0, 0, 1, 'x'},
+			want: map[string]interface{}{"street": "x"},
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := decodeCQLValue(tt.typ, tt.bs)
+		if assert.NoError(t, err, "decodeCQLValue(%v) failed", tt.typ) {
+			assert.Equal(t, tt.want, got, "Unexpected value for %v", tt.typ)
+		}
+	}
+}
+
+func TestCQLValueErrors(t *testing.T) {
+	tests := []struct {
+		typ    *cqlType
+		in     interface{}
+		errMsg string
+	}{
+		{typ: &cqlType{id: cqlVarchar}, in: json.Number("1"), errMsg: "cannot use 1 (json.Number) as CQL varchar"},
+		{typ: &cqlType{id: cqlTinyint}, in: json.Number("300"), errMsg: "invalid CQL tinyint 300"},
+		{typ: &cqlType{id: cqlUUID}, in: "not-a-uuid", errMsg: `invalid UUID "not-a-uuid"`},
+		{typ: &cqlType{id: cqlInet}, in: "host", errMsg: `invalid IP address "host"`},
+		{typ: &cqlType{id: cqlDuration}, in: "1h", errMsg: "CQL duration is not supported for bind values"},
+		{typ: &cqlType{id: cqlList, elems: []*cqlType{{id: cqlInt}}}, in: []interface{}{"a"}, errMsg: "as CQL int"},
+	}
+
+	for _, tt := range tests {
+		_, err := encodeCQLValue(tt.typ, tt.in)
+		if assert.Error(t, err, "encodeCQLValue(%v, %v) should fail", tt.typ, tt.in) {
+			assert.Contains(t, err.Error(), tt.errMsg, "Unexpected error for %v", tt.typ)
+		}
+	}
+
+	_, err := decodeCQLValue(&cqlType{id: cqlInt}, []byte{1})
+	assert.EqualError(t, err, "invalid int value with 1 bytes", "Unexpected decode error")
+}
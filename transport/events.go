@@ -0,0 +1,82 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"fmt"
+	"time"
+)
+
+// ConnectionEventType is the type of a connection lifecycle event.
+type ConnectionEventType int
+
+// The list of connection events reported by transports.
+const (
+	// ConnectionOpened is reported when a new connection to a peer is made.
+	ConnectionOpened ConnectionEventType = iota + 1
+
+	// ConnectionClosed is reported when a connection to a peer is closed.
+	ConnectionClosed
+
+	// ConnectionReset is reported when a call fails due to a network error.
+	ConnectionReset
+
+	// PeerBusy is reported when a peer rejects a call as it's busy.
+	PeerBusy
+
+	// ConnectionClosedAtShutdown is reported for each connection that is
+	// still open when the transport is closed.
+	ConnectionClosedAtShutdown
+)
+
+func (t ConnectionEventType) String() string {
+	switch t {
+	case ConnectionOpened:
+		return "opened"
+	case ConnectionClosed:
+		return "closed"
+	case ConnectionReset:
+		return "reset"
+	case PeerBusy:
+		return "busy"
+	case ConnectionClosedAtShutdown:
+		return "closed at shutdown"
+	}
+	return fmt.Sprintf("ConnectionEventType(%d)", int(t))
+}
+
+// ConnectionEvent is a connection lifecycle event for a peer.
+type ConnectionEvent struct {
+	Type ConnectionEventType
+	Peer string
+}
+
+// TLSHandshake is a TLS handshake made when connecting to a peer.
+type TLSHandshake struct {
+	Peer string
+
+	// Resumed is set if the handshake resumed an earlier session, rather
+	// than making a full handshake.
+	Resumed bool
+
+	// Duration is how long the handshake took, excluding the TCP connect.
+	Duration time.Duration
+}
@@ -22,21 +22,39 @@ package transport
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"math/rand"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/net/context"
 )
 
 type httpTransport struct {
-	urls           []string
-	source, target string
-	client         *http.Client
+	// opts are the options that requests are created with.
+	opts HTTPOptions
+
+	maxBodyBytes int64
+	maxBuffered  int64
+	pool         *BufferPool
+	client       *http.Client
+
+	// sessionCache stores TLS sessions so they can be resumed, unless
+	// session tickets are disabled. It's replaced when the client
+	// certificate changes from sessionCert.
+	mu           sync.Mutex
+	sessionCache tls.ClientSessionCache
+	sessionCert  *tls.Certificate
+
+	// rootCAs overrides the system's root CAs, and is only set by tests.
+	rootCAs *x509.CertPool
 }
 
 // HTTPOptions are used to create a HTTP transport.
@@ -44,8 +62,95 @@ type HTTPOptions struct {
 	URLs          []string
 	SourceService string
 	TargetService string
+
+	// Dial is used to create connections. If nil, net.Dial is used.
+	Dial func(network, addr string) (net.Conn, error)
+
+	// Host overrides the Host header, which defaults to the URL's host.
+	Host string
+
+	// ServerName overrides the TLS server name (SNI), which defaults to
+	// the URL's host.
+	ServerName string
+
+	// PreserveHeaderCase sends request headers with the exact casing
+	// given, rather than canonicalizing them. HTTP/2 always lowercases
+	// header names, so this only affects HTTP/1.x requests.
+	PreserveHeaderCase bool
+
+	// NoFollowRedirects stops HTTP redirects from being followed, so that
+	// redirect responses fail the call. By default, redirects are followed,
+	// up to MaxRedirects hops.
+	NoFollowRedirects bool
+
+	// MaxRedirects is the maximum number of redirects that are followed.
+	// If 0, up to 10 redirects are followed.
+	MaxRedirects int
+
+	// PreserveRedirectMethod keeps the method and body when following 301,
+	// 302 and 303 redirects, which otherwise switch to a GET without a body.
+	PreserveRedirectMethod bool
+
+	// ExpectContinue sends an "Expect: 100-continue" header with request
+	// bodies, so the body is only sent once the server responds with
+	// 100 Continue, or after ExpectContinueTimeout.
+	ExpectContinue bool
+
+	// ExpectContinueTimeout is how long to wait for a 100 Continue before
+	// sending the body anyway. If 0, the timeout is 1 second.
+	ExpectContinueTimeout time.Duration
+
+	// Chunked sends request bodies using chunked transfer encoding, rather
+	// than with a Content-Length.
+	Chunked bool
+
+	// Jar stores cookies set by responses and adds them to later requests.
+	// If nil, cookies are ignored.
+	Jar http.CookieJar
+
+	// NewConnectionPerRequest makes each request on a new connection that
+	// is closed once the response is read, rather than reusing connections.
+	NewConnectionPerRequest bool
+
+	// SessionTicketsDisabled disables TLS session tickets, so each new
+	// connection makes a full handshake. Otherwise, sessions are resumed
+	// when reconnecting to the same server.
+	SessionTicketsDisabled bool
+
+	// OnTLSHandshake is called for each TLS handshake, if set.
+	OnTLSHandshake func(TLSHandshake)
+
+	// ClientCertificate returns the certificate presented to servers that
+	// request one, if set. It's called for each new connection, so the
+	// certificate can change during a run.
+	ClientCertificate func() (*tls.Certificate, error)
+
+	// MaxResponseBytes limits the size of response bodies. If 0, there is no limit.
+	MaxResponseBytes int64
+
+	// MaxBufferedBytes limits how much of each response body is kept in memory.
+	// The rest of the body is discarded and the response is marked as Truncated.
+	MaxBufferedBytes int64
+
+	// BufferPool is used to read response bodies, if set. Responses must be
+	// released using Response.Release once they are no longer used.
+	BufferPool *BufferPool
+}
+
+// Redirect is a HTTP redirect that was followed to make a call.
+type Redirect struct {
+	// StatusCode is the status code of the redirect response.
+	StatusCode int
+
+	// URL is the URL that the redirect was followed to.
+	URL string
 }
 
+const (
+	defaultMaxRedirects          = 10
+	defaultExpectContinueTimeout = time.Second
+)
+
 var (
 	errNoURLs        = errors.New("specify at least one URL")
 	errMissingTarget = errors.New("specify target service name")
@@ -60,41 +165,231 @@ func HTTP(opts HTTPOptions) (Transport, error) {
 		return nil, errMissingTarget
 	}
 
-	return &httpTransport{
-		urls:   opts.URLs,
-		source: opts.SourceService,
-		target: opts.TargetService,
-		// Use independent HTTP clients for each transport.
-		client: &http.Client{
-			Transport: &http.Transport{},
-		},
-	}, nil
+	var expectContinueTimeout time.Duration
+	if opts.ExpectContinue {
+		expectContinueTimeout = opts.ExpectContinueTimeout
+		if expectContinueTimeout <= 0 {
+			expectContinueTimeout = defaultExpectContinueTimeout
+		}
+	}
+
+	h := &httpTransport{
+		opts: opts,
+
+		maxBodyBytes: opts.MaxResponseBytes,
+		maxBuffered:  opts.MaxBufferedBytes,
+		pool:         opts.BufferPool,
+	}
+	if !opts.SessionTicketsDisabled {
+		h.sessionCache = tls.NewLRUClientSessionCache(0)
+	}
+
+	ht := &http.Transport{
+		Dial:                  opts.Dial,
+		TLSClientConfig:       h.tlsConfig(opts.ServerName, h.sessionCache),
+		ExpectContinueTimeout: expectContinueTimeout,
+		DisableKeepAlives:     opts.NewConnectionPerRequest,
+	}
+	if opts.OnTLSHandshake != nil || opts.ClientCertificate != nil {
+		ht.DialTLS = h.dialTLS
+	}
+
+	// Use independent HTTP clients for each transport.
+	h.client = &http.Client{
+		Transport:     ht,
+		Jar:           opts.Jar,
+		CheckRedirect: checkRedirect(opts),
+	}
+	return h, nil
 }
 
-func (h *httpTransport) newReq(ctx context.Context, r *Request) (*http.Request, error) {
-	url := h.urls[rand.Intn(len(h.urls))]
+// tlsConfig returns the TLS configuration for connections to serverName.
+// If serverName is empty, net/http uses the URL's host.
+func (h *httpTransport) tlsConfig(serverName string, sessionCache tls.ClientSessionCache) *tls.Config {
+	return &tls.Config{
+		ServerName:             serverName,
+		ClientSessionCache:     sessionCache,
+		SessionTicketsDisabled: h.opts.SessionTicketsDisabled,
+		RootCAs:                h.rootCAs,
+	}
+}
 
-	// TODO: We should envelope Thrift paylods here.
-	req, err := http.NewRequest("POST", url, bytes.NewReader(r.Body))
+// dialTLS connects to addr and makes the TLS handshake, so the handshake
+// can use the current client certificate and be reported to OnTLSHandshake.
+func (h *httpTransport) dialTLS(network, addr string) (net.Conn, error) {
+	dial := h.opts.Dial
+	if dial == nil {
+		dial = net.Dial
+	}
+
+	serverName := h.opts.ServerName
+	if serverName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		serverName = host
+	}
+
+	var cert *tls.Certificate
+	if h.opts.ClientCertificate != nil {
+		var err error
+		if cert, err = h.opts.ClientCertificate(); err != nil {
+			return nil, fmt.Errorf("failed to get client certificate: %v", err)
+		}
+	}
+
+	config := h.tlsConfig(serverName, h.sessionCacheFor(cert))
+	if cert != nil {
+		config.Certificates = []tls.Certificate{*cert}
+	}
+
+	conn, err := dial(network, addr)
 	if err != nil {
 		return nil, err
 	}
 
+	start := time.Now()
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if h.opts.OnTLSHandshake != nil {
+		h.opts.OnTLSHandshake(TLSHandshake{
+			Peer:     addr,
+			Resumed:  tlsConn.ConnectionState().DidResume,
+			Duration: time.Since(start),
+		})
+	}
+	return tlsConn, nil
+}
+
+// sessionCacheFor returns the session cache to use with the client
+// certificate cert. Cached sessions are discarded when the certificate
+// changes, as resumed sessions keep the certificate they were created with.
+func (h *httpTransport) sessionCacheFor(cert *tls.Certificate) tls.ClientSessionCache {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.sessionCache != nil && cert != h.sessionCert {
+		h.sessionCert = cert
+		h.sessionCache = tls.NewLRUClientSessionCache(0)
+	}
+	return h.sessionCache
+}
+
+func checkRedirect(opts HTTPOptions) func(*http.Request, []*http.Request) error {
+	if opts.NoFollowRedirects {
+		return func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+
+	maxRedirects := opts.MaxRedirects
+	if maxRedirects <= 0 {
+		maxRedirects = defaultMaxRedirects
+	}
+
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) > maxRedirects {
+			return fmt.Errorf("stopped after %v redirects", maxRedirects)
+		}
+
+		if opts.PreserveRedirectMethod {
+			return preserveMethod(req, via[0])
+		}
+		return nil
+	}
+}
+
+// bodyHeaders are removed by net/http once a redirect switches to a GET.
+var bodyHeaders = []string{"Content-Encoding", "Content-Language", "Content-Location", "Content-Type"}
+
+// preserveMethod restores the original method, body and body headers after
+// net/http switched to a GET for a 301, 302 or 303. Once switched, the body
+// is dropped for every later redirect, so this is done for each redirect.
+func preserveMethod(req, orig *http.Request) error {
+	req.Method = orig.Method
+	if orig.GetBody != nil && (req.Body == nil || req.Body == http.NoBody) {
+		body, err := orig.GetBody()
+		if err != nil {
+			return err
+		}
+		req.Body = body
+		req.GetBody = orig.GetBody
+		req.ContentLength = orig.ContentLength
+	}
+
+	for _, hdr := range bodyHeaders {
+		if vals, ok := orig.Header[hdr]; ok && req.Header.Get(hdr) == "" {
+			req.Header[hdr] = vals
+		}
+	}
+	return nil
+}
+
+// redirectChain returns the redirects that were followed to get resp.
+func redirectChain(resp *http.Response) []Redirect {
+	var chain []Redirect
+	for req := resp.Request; req != nil && req.Response != nil; req = req.Response.Request {
+		chain = append([]Redirect{{StatusCode: req.Response.StatusCode, URL: req.URL.String()}}, chain...)
+	}
+	return chain
+}
+
+func (h *httpTransport) newReq(ctx context.Context, r *Request) (*http.Request, error) {
+	url := h.opts.URLs[rand.Intn(len(h.opts.URLs))]
+
 	timeout := time.Second
 	if deadline, ok := ctx.Deadline(); ok {
 		timeout = deadline.Sub(time.Now())
 	}
+	if r.TTL > 0 && r.TTL < timeout {
+		timeout = r.TTL
+	}
+
+	return NewHTTPRequest(h.opts, url, r, timeout)
+}
+
+// NewHTTPRequest returns the HTTP request that a HTTP transport created
+// with opts makes to url for r, with the given timeout.
+func NewHTTPRequest(opts HTTPOptions, url string, r *Request, timeout time.Duration) (*http.Request, error) {
+	// TODO: We should envelope Thrift paylods here.
+	req, err := http.NewRequest("POST", url, bytes.NewReader(r.Body))
+	if err != nil {
+		return nil, err
+	}
+	if opts.Host != "" {
+		req.Host = opts.Host
+	}
 
 	// TODO: We shouldn't always set YARPC headers, bit maybe have a flag to enable these.
-	req.Header.Add("RPC-Service", h.target)
+	req.Header.Add("RPC-Service", opts.TargetService)
 	req.Header.Add("RPC-Procedure", r.Method)
-	req.Header.Add("RPC-Caller", h.source)
+	req.Header.Add("RPC-Caller", opts.SourceService)
 	req.Header.Add("Context-TTL-MS", strconv.Itoa(int(timeout/time.Millisecond)))
 
 	for hdr, val := range r.Headers {
+		if opts.PreserveHeaderCase {
+			// net/http writes header map keys as-is, so bypass Add which
+			// would canonicalize the name.
+			req.Header[hdr] = append(req.Header[hdr], val)
+			continue
+		}
 		req.Header.Add(hdr, val)
 	}
 
+	if opts.ExpectContinue && len(r.Body) > 0 {
+		req.Header.Set("Expect", "100-continue")
+	}
+	if opts.Chunked && len(r.Body) > 0 {
+		// An unknown length makes net/http use chunked encoding.
+		req.ContentLength = -1
+		req.TransferEncoding = []string{"chunked"}
+	}
+
 	return req, nil
 }
 
@@ -103,28 +398,55 @@ func (h *httpTransport) Call(ctx context.Context, r *Request) (*Response, error)
 	if err != nil {
 		return nil, err
 	}
+	setCallPeer(ctx, req.URL.String())
 
 	resp, err := h.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, ThrottledError{
+			Message:    fmt.Sprintf("HTTP call got non-success response code: %v", resp.StatusCode),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
+	}
+	if loc := resp.Header.Get("Location"); loc != "" && resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		return nil, fmt.Errorf("HTTP call got redirect response code: %v to %v", resp.StatusCode, loc)
+	}
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		return nil, fmt.Errorf("HTTP call got non-success response code: %v", resp.StatusCode)
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
+	buf := h.pool.get()
+	body, truncated, err := readBody(resp.Body, buf, h.maxBodyBytes, h.maxBuffered)
 	if err != nil {
+		h.pool.put(buf)
 		return nil, err
 	}
 
 	headers := make(map[string]string)
-	for headerKey := range resp.Header {
+	for headerKey, values := range resp.Header {
+		// Repeated headers such as Server-Timing are combined, except for
+		// Set-Cookie, which can't be combined.
+		if len(values) > 1 && headerKey != "Set-Cookie" {
+			headers[headerKey] = strings.Join(values, ", ")
+			continue
+		}
 		headers[headerKey] = resp.Header.Get(headerKey)
 	}
 
 	return &Response{
 		Headers: headers,
 		Body:    body,
+		Peer:    req.URL.String(),
+
+		Redirects: redirectChain(resp),
+		TLS:       resp.TLS,
+
+		Truncated: truncated,
+
+		buf:  buf,
+		pool: h.pool,
 	}, nil
 }
@@ -21,12 +21,23 @@
 package transport
 
 import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"io"
 	"io/ioutil"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -200,5 +211,438 @@ func TestHTTPCall(t *testing.T) {
 
 		assert.Equal(t, "ok", got.Headers["Custom-Header"], "Header mismatch")
 		assert.Equal(t, lastReq.body, tt.r.Body, "Body mismatch")
+		assert.Equal(t, svr.URL+"/rpc", got.Peer, "Peer mismatch")
+	}
+}
+
+func TestHTTPHostOverrides(t *testing.T) {
+	var gotHost string
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHost = r.Host
+	}))
+	defer svr.Close()
+
+	transport, err := HTTP(HTTPOptions{
+		URLs:          []string{svr.URL + "/rpc"},
+		SourceService: "source",
+		TargetService: "target",
+		Host:          "svc.example.com",
+		ServerName:    "sni.example.com",
+	})
+	require.NoError(t, err, "Failed to create HTTP transport")
+
+	tlsConfig := transport.(*httpTransport).client.Transport.(*http.Transport).TLSClientConfig
+	if assert.NotNil(t, tlsConfig, "Missing TLS config") {
+		assert.Equal(t, "sni.example.com", tlsConfig.ServerName, "TLS server name mismatch")
+	}
+
+	_, err = transport.Call(context.Background(), &Request{Method: "method"})
+	require.NoError(t, err, "Call failed")
+	assert.Equal(t, "svc.example.com", gotHost, "Host header mismatch")
+}
+
+func TestHTTPRepeatedResponseHeaders(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Server-Timing", "db;dur=10")
+		w.Header().Add("Server-Timing", "app;dur=20")
+		w.Header().Add("Set-Cookie", "a=1")
+		w.Header().Add("Set-Cookie", "b=2")
+	}))
+	defer svr.Close()
+
+	transport, err := HTTP(HTTPOptions{
+		URLs:          []string{svr.URL + "/rpc"},
+		SourceService: "source",
+		TargetService: "target",
+	})
+	require.NoError(t, err, "Failed to create HTTP transport")
+
+	res, err := transport.Call(context.Background(), &Request{Method: "method"})
+	require.NoError(t, err, "Call failed")
+	assert.Equal(t, "db;dur=10, app;dur=20", res.Headers["Server-Timing"], "Repeated headers should be combined")
+	assert.Equal(t, "a=1", res.Headers["Set-Cookie"], "Set-Cookie should not be combined")
+}
+
+func TestHTTPNewConnectionPerRequest(t *testing.T) {
+	tests := []struct {
+		perRequest bool
+		wantConns  int
+	}{
+		{perRequest: false, wantConns: 1},
+		{perRequest: true, wantConns: 3},
+	}
+
+	for _, tt := range tests {
+		var (
+			mu    sync.Mutex
+			conns = make(map[string]bool)
+		)
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			conns[r.RemoteAddr] = true
+			mu.Unlock()
+		}))
+
+		transport, err := HTTP(HTTPOptions{
+			URLs:                    []string{svr.URL + "/rpc"},
+			SourceService:           "source",
+			TargetService:           "target",
+			NewConnectionPerRequest: tt.perRequest,
+		})
+		require.NoError(t, err, "Failed to create HTTP transport")
+
+		for i := 0; i < 3; i++ {
+			_, err := transport.Call(context.Background(), &Request{Method: "method"})
+			require.NoError(t, err, "Call failed")
+		}
+		svr.Close()
+
+		mu.Lock()
+		assert.Len(t, conns, tt.wantConns, "perRequest %v: unexpected number of connections", tt.perRequest)
+		mu.Unlock()
+	}
+}
+
+func TestHTTPTLSSessionResumption(t *testing.T) {
+	svr := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer svr.Close()
+
+	cert, err := x509.ParseCertificate(svr.TLS.Certificates[0].Certificate[0])
+	require.NoError(t, err, "Failed to parse server certificate")
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(cert)
+
+	tests := []struct {
+		ticketsDisabled bool
+		wantResumed     []bool
+	}{
+		{ticketsDisabled: false, wantResumed: []bool{false, true, true}},
+		{ticketsDisabled: true, wantResumed: []bool{false, false, false}},
+	}
+
+	for _, tt := range tests {
+		var resumed []bool
+		transport, err := HTTP(HTTPOptions{
+			URLs:                    []string{svr.URL + "/rpc"},
+			SourceService:           "source",
+			TargetService:           "target",
+			NewConnectionPerRequest: true,
+			SessionTicketsDisabled:  tt.ticketsDisabled,
+			OnTLSHandshake: func(h TLSHandshake) {
+				assert.Equal(t, svr.Listener.Addr().String(), h.Peer, "Unexpected handshake peer")
+				assert.True(t, h.Duration > 0, "Handshake duration should be set")
+				resumed = append(resumed, h.Resumed)
+			},
+		})
+		require.NoError(t, err, "Failed to create HTTP transport")
+		transport.(*httpTransport).rootCAs = rootCAs
+
+		for range tt.wantResumed {
+			res, err := transport.Call(context.Background(), &Request{Method: "method"})
+			require.NoError(t, err, "Call failed")
+			if assert.NotNil(t, res.TLS, "Response should have the TLS state") {
+				assert.Equal(t, cert, res.TLS.PeerCertificates[0], "Unexpected server certificate")
+			}
+		}
+		assert.Equal(t, tt.wantResumed, resumed, "ticketsDisabled %v: unexpected resumed handshakes", tt.ticketsDisabled)
+	}
+}
+
+func newTestClientCert(t *testing.T, name string) *tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "GenerateKey failed")
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err, "CreateCertificate failed")
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestHTTPClientCertificateRotation(t *testing.T) {
+	var gotNames []string
+	svr := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotNames = append(gotNames, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	svr.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	svr.StartTLS()
+	defer svr.Close()
+
+	cert, err := x509.ParseCertificate(svr.TLS.Certificates[0].Certificate[0])
+	require.NoError(t, err, "Failed to parse server certificate")
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(cert)
+
+	var (
+		clientCert = newTestClientCert(t, "old")
+		resumed    []bool
+	)
+	transport, err := HTTP(HTTPOptions{
+		URLs:                    []string{svr.URL + "/rpc"},
+		SourceService:           "source",
+		TargetService:           "target",
+		NewConnectionPerRequest: true,
+		ClientCertificate: func() (*tls.Certificate, error) {
+			return clientCert, nil
+		},
+		OnTLSHandshake: func(h TLSHandshake) {
+			resumed = append(resumed, h.Resumed)
+		},
+	})
+	require.NoError(t, err, "Failed to create HTTP transport")
+	transport.(*httpTransport).rootCAs = rootCAs
+
+	call := func() {
+		_, err := transport.Call(context.Background(), &Request{Method: "method"})
+		require.NoError(t, err, "Call failed")
+	}
+
+	call()
+	call()
+	clientCert = newTestClientCert(t, "new")
+	call()
+	call()
+
+	assert.Equal(t, []string{"old", "old", "new", "new"}, gotNames, "Unexpected client certificates")
+	assert.Equal(t, []bool{false, true, false, true}, resumed, "Sessions should not be resumed with a new certificate")
+}
+
+func TestHTTPPreserveHeaderCase(t *testing.T) {
+	tests := []struct {
+		preserve bool
+		want     string
+	}{
+		{preserve: false, want: "X-Legacy-Header: v"},
+		{preserve: true, want: "x-LEGACY-header: v"},
+	}
+
+	for _, tt := range tests {
+		// Use a raw listener since net/http servers canonicalize header names.
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err, "Listen failed")
+
+		gotLines := make(chan []string, 1)
+		go func() {
+			conn, err := ln.Accept()
+			if err != nil {
+				close(gotLines)
+				return
+			}
+			defer conn.Close()
+
+			var lines []string
+			r := bufio.NewReader(conn)
+			for {
+				line, err := r.ReadString('\n')
+				line = strings.TrimRight(line, "\r\n")
+				if err != nil || line == "" {
+					break
+				}
+				lines = append(lines, line)
+			}
+			io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\nConnection: close\r\n\r\n")
+			gotLines <- lines
+		}()
+
+		transport, err := HTTP(HTTPOptions{
+			URLs:               []string{"http://" + ln.Addr().String() + "/rpc"},
+			SourceService:      "source",
+			TargetService:      "target",
+			PreserveHeaderCase: tt.preserve,
+		})
+		require.NoError(t, err, "Failed to create HTTP transport")
+
+		_, err = transport.Call(context.Background(), &Request{
+			Method:  "method",
+			Headers: map[string]string{"x-LEGACY-header": "v"},
+		})
+		ln.Close()
+		require.NoError(t, err, "Call failed")
+		assert.Contains(t, <-gotLines, tt.want, "preserve %v: header casing mismatch", tt.preserve)
+	}
+}
+
+func TestHTTPRedirects(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/a", http.RedirectHandler("/b", http.StatusFound))
+	mux.Handle("/b", http.RedirectHandler("/c", http.StatusTemporaryRedirect))
+	mux.HandleFunc("/c", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		io.WriteString(w, r.Method+":"+r.Header.Get("Content-Type")+":"+string(body))
+	})
+	svr := httptest.NewServer(mux)
+	defer svr.Close()
+
+	tests := []struct {
+		msg           string
+		opts          HTTPOptions
+		wantBody      string
+		wantRedirects []Redirect
+		wantErr       string
+	}{
+		{
+			msg:     "redirects not followed",
+			opts:    HTTPOptions{NoFollowRedirects: true},
+			wantErr: "HTTP call got redirect response code: 302 to /b",
+		},
+		{
+			msg:      "redirects followed by default",
+			wantBody: "GET::",
+			wantRedirects: []Redirect{
+				{StatusCode: http.StatusFound, URL: svr.URL + "/b"},
+				{StatusCode: http.StatusTemporaryRedirect, URL: svr.URL + "/c"},
+			},
+		},
+		{
+			msg:      "follow redirects preserving method",
+			opts:     HTTPOptions{PreserveRedirectMethod: true},
+			wantBody: "POST:text/plain:body",
+			wantRedirects: []Redirect{
+				{StatusCode: http.StatusFound, URL: svr.URL + "/b"},
+				{StatusCode: http.StatusTemporaryRedirect, URL: svr.URL + "/c"},
+			},
+		},
+		{
+			msg:     "too many redirects",
+			opts:    HTTPOptions{MaxRedirects: 1},
+			wantErr: "stopped after 1 redirects",
+		},
+	}
+
+	for _, tt := range tests {
+		opts := tt.opts
+		opts.URLs = []string{svr.URL + "/a"}
+		opts.SourceService = "source"
+		opts.TargetService = "target"
+		transport, err := HTTP(opts)
+		require.NoError(t, err, "%v: failed to create HTTP transport", tt.msg)
+
+		res, err := transport.Call(context.Background(), &Request{
+			Method:  "method",
+			Headers: map[string]string{"Content-Type": "text/plain"},
+			Body:    []byte("body"),
+		})
+		if tt.wantErr != "" {
+			if assert.Error(t, err, "%v: expected error", tt.msg) {
+				assert.Contains(t, err.Error(), tt.wantErr, "%v: unexpected error", tt.msg)
+			}
+			continue
+		}
+
+		require.NoError(t, err, "%v: call failed", tt.msg)
+		assert.Equal(t, tt.wantBody, string(res.Body), "%v: unexpected body", tt.msg)
+		assert.Equal(t, tt.wantRedirects, res.Redirects, "%v: unexpected redirects", tt.msg)
+		assert.Equal(t, svr.URL+"/a", res.Peer, "%v: peer should be the original URL", tt.msg)
+	}
+}
+
+func TestHTTPExpectContinueChunked(t *testing.T) {
+	type gotRequest struct {
+		expect           string
+		transferEncoding []string
+		contentLength    int64
+	}
+	gotRequests := make(chan gotRequest, 1)
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotRequests <- gotRequest{r.Header.Get("Expect"), r.TransferEncoding, r.ContentLength}
+		if r.URL.Path == "/reject" {
+			// Rejecting without reading the body means 100 Continue is never sent.
+			w.WriteHeader(http.StatusExpectationFailed)
+			return
+		}
+		io.Copy(w, r.Body)
+	}))
+	defer svr.Close()
+
+	tests := []struct {
+		msg     string
+		path    string
+		opts    HTTPOptions
+		want    gotRequest
+		wantErr string
+	}{
+		{
+			msg:  "defaults",
+			want: gotRequest{contentLength: 4},
+		},
+		{
+			msg:  "chunked",
+			opts: HTTPOptions{Chunked: true},
+			want: gotRequest{transferEncoding: []string{"chunked"}, contentLength: -1},
+		},
+		{
+			msg:  "expect continue",
+			opts: HTTPOptions{ExpectContinue: true},
+			want: gotRequest{expect: "100-continue", contentLength: 4},
+		},
+		{
+			msg:     "expect continue rejected",
+			path:    "/reject",
+			opts:    HTTPOptions{ExpectContinue: true, ExpectContinueTimeout: time.Minute},
+			want:    gotRequest{expect: "100-continue", contentLength: 4},
+			wantErr: "non-success response code: 417",
+		},
+	}
+
+	for _, tt := range tests {
+		opts := tt.opts
+		opts.URLs = []string{svr.URL + tt.path}
+		opts.SourceService = "source"
+		opts.TargetService = "target"
+		transport, err := HTTP(opts)
+		require.NoError(t, err, "%v: failed to create HTTP transport", tt.msg)
+
+		res, err := transport.Call(context.Background(), &Request{Method: "method", Body: []byte("body")})
+		assert.Equal(t, tt.want, <-gotRequests, "%v: unexpected request", tt.msg)
+		if tt.wantErr != "" {
+			if assert.Error(t, err, "%v: expected error", tt.msg) {
+				assert.Contains(t, err.Error(), tt.wantErr, "%v: unexpected error", tt.msg)
+			}
+			continue
+		}
+
+		require.NoError(t, err, "%v: call failed", tt.msg)
+		assert.Equal(t, "body", string(res.Body), "%v: unexpected body", tt.msg)
+	}
+}
+
+func TestHTTPMaxResponseBytes(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "0123456789")
+	}))
+	defer svr.Close()
+
+	tests := []struct {
+		max    int64
+		errMsg string
+	}{
+		{max: 0},
+		{max: 10},
+		{max: 9, errMsg: "exceeded the maximum size of 9 bytes"},
+	}
+
+	for _, tt := range tests {
+		transport, err := HTTP(HTTPOptions{
+			URLs:             []string{svr.URL},
+			TargetService:    "target",
+			MaxResponseBytes: tt.max,
+		})
+		require.NoError(t, err, "Failed to create HTTP transport")
+
+		res, err := transport.Call(context.Background(), &Request{Method: "method"})
+		if tt.errMsg != "" {
+			if assert.Error(t, err, "Call with max %v should fail", tt.max) {
+				assert.Contains(t, err.Error(), tt.errMsg, "Unexpected error with max %v", tt.max)
+			}
+			continue
+		}
+
+		if assert.NoError(t, err, "Call with max %v failed", tt.max) {
+			assert.Equal(t, "0123456789", string(res.Body), "Body mismatch with max %v", tt.max)
+		}
 	}
 }
@@ -21,17 +21,28 @@
 package transport
 
 import (
+	"bytes"
+	"crypto/tls"
 	"time"
 
 	"golang.org/x/net/context"
 )
 
-// Request is the fields used to make an RPC.
+// Request is the fields used to make an RPC. Requests may be reused across
+// calls, so transports must not modify them.
 type Request struct {
 	Method  string
 	Timeout time.Duration
 	Headers map[string]string
 	Body    []byte
+
+	// ShardKey is used to choose a peer when using consistent hashing.
+	ShardKey string
+
+	// TTL is the deadline propagated to the service, if it should be shorter
+	// than the time left on the call's context. For TChannel, the TTL is
+	// also the call's deadline, as TChannel sends the context's deadline.
+	TTL time.Duration
 }
 
 // Response represents the result of an RPC.
@@ -39,6 +50,27 @@ type Response struct {
 	Headers map[string]string
 	Body    []byte
 	Trace   string
+
+	// TraceSampled is set if the call's trace was sampled.
+	TraceSampled bool
+
+	// Peer is the peer that handled the call.
+	Peer string
+
+	// Redirects are the HTTP redirects that were followed, in order.
+	Redirects []Redirect
+
+	// TLS is the state of the TLS connection the response was received on,
+	// or nil if the call was not made over TLS.
+	TLS *tls.ConnectionState
+
+	// Truncated is set if Body only contains the start of the response
+	// body, as the transport limits how much of the body is kept in memory.
+	Truncated bool
+
+	// buf and pool are set if the body was read into a pooled buffer.
+	buf  *bytes.Buffer
+	pool *BufferPool
 }
 
 // Transport defines the interface for the underlying transport over which
@@ -0,0 +1,413 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// KafkaOptions are used to create a Kafka transport.
+type KafkaOptions struct {
+	// URLs are the bootstrap brokers, as kafka://host:port.
+	URLs []string
+
+	// ClientID identifies the producer to the brokers.
+	ClientID string
+
+	// Dial is used to create connections. If nil, net.Dial is used.
+	Dial func(network, addr string) (net.Conn, error)
+
+	// Acks is the number of acknowledgements the leader waits for before
+	// responding: 0 for none, 1 for the leader, or -1 for all in-sync replicas.
+	Acks int16
+
+	// Key returns the key to produce each request with. If nil, messages
+	// have no key and are spread across partitions.
+	Key func(r *Request) ([]byte, error)
+
+	// MaxResponseBytes limits the size of broker responses. If 0, there is no limit.
+	MaxResponseBytes int64
+}
+
+var (
+	errNoKafkaTopic      = errors.New("specify the Kafka topic as the method")
+	errKafkaAcks         = errors.New("Kafka acks must be 0, 1 or -1 (all)")
+	errKafkaResponseSize = errors.New("Kafka response exceeds the maximum response size")
+)
+
+// KafkaError is returned for error codes returned by brokers.
+type KafkaError int16
+
+var kafkaErrorNames = map[KafkaError]string{
+	2:  "CORRUPT_MESSAGE",
+	3:  "UNKNOWN_TOPIC_OR_PARTITION",
+	5:  "LEADER_NOT_AVAILABLE",
+	6:  "NOT_LEADER_OR_FOLLOWER",
+	7:  "REQUEST_TIMED_OUT",
+	10: "MESSAGE_TOO_LARGE",
+	17: "INVALID_TOPIC_EXCEPTION",
+	19: "NOT_ENOUGH_REPLICAS",
+	20: "NOT_ENOUGH_REPLICAS_AFTER_APPEND",
+	29: "TOPIC_AUTHORIZATION_FAILED",
+	35: "UNSUPPORTED_VERSION",
+}
+
+func (e KafkaError) Error() string {
+	if name, ok := kafkaErrorNames[e]; ok {
+		return fmt.Sprintf("Kafka error %v (%v)", name, int16(e))
+	}
+	return fmt.Sprintf("Kafka error %v", int16(e))
+}
+
+// staleMetadata returns whether the error means the topic's partitions or
+// leaders have changed since the metadata was fetched.
+func (e KafkaError) staleMetadata() bool {
+	return e == 3 || e == 5 || e == 6
+}
+
+type kafkaTopic struct {
+	// partitions are sorted by ID, and leaders maps a partition to the
+	// address of its leader.
+	partitions []int32
+	leaders    map[int32]string
+}
+
+type kafkaTransport struct {
+	bootstrap    []string
+	clientID     string
+	acks         int16
+	key          func(r *Request) ([]byte, error)
+	pool         *connPool
+	maxBodyBytes int64
+
+	correlationID int32
+	next          uint32
+
+	mu     sync.Mutex
+	topics map[string]*kafkaTopic
+}
+
+// Kafka returns a transport that produces each request's body as a message
+// to the topic given by the method. Responses contain the partition and
+// offset of the message once it is acknowledged.
+func Kafka(opts KafkaOptions) (Transport, error) {
+	if len(opts.URLs) == 0 {
+		return nil, errNoURLs
+	}
+	if opts.Acks < -1 || opts.Acks > 1 {
+		return nil, errKafkaAcks
+	}
+
+	bootstrap := make([]string, len(opts.URLs))
+	for i, s := range opts.URLs {
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme != "kafka" || u.Host == "" {
+			return nil, fmt.Errorf("invalid Kafka URL %q, expected kafka://host:port", s)
+		}
+		bootstrap[i] = u.Host
+	}
+
+	return &kafkaTransport{
+		bootstrap:    bootstrap,
+		clientID:     opts.ClientID,
+		acks:         opts.Acks,
+		key:          opts.Key,
+		pool:         newConnPool(opts.Dial),
+		maxBodyBytes: opts.MaxResponseBytes,
+		topics:       make(map[string]*kafkaTopic),
+	}, nil
+}
+
+// roundTrip sends a request to addr, and returns the response body after the
+// correlation ID. If expectResponse is false, no response is read.
+func (t *kafkaTransport) roundTrip(ctx context.Context, addr string, apiKey, apiVersion int16, body []byte, expectResponse bool) (*wireReader, error) {
+	conn, err := t.pool.get(addr, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	correlationID := atomic.AddInt32(&t.correlationID, 1)
+	done := conn.watch(ctx)
+	res, err := t.exchange(conn, kafkaRequest(apiKey, apiVersion, correlationID, t.clientID, body), correlationID, expectResponse)
+	done()
+	if err != nil {
+		// The connection is in an unknown state after I/O errors.
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	t.pool.put(addr, conn)
+	return res, nil
+}
+
+func (t *kafkaTransport) exchange(conn *bufConn, req []byte, correlationID int32, expectResponse bool) (*wireReader, error) {
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+	if !expectResponse {
+		return nil, nil
+	}
+
+	var header [8]byte
+	if _, err := io.ReadFull(conn.r, header[:]); err != nil {
+		return nil, err
+	}
+	size := int64(int32(binary.BigEndian.Uint32(header[:4]))) - 4
+	if size < 0 {
+		return nil, errShortResponse
+	}
+	if t.maxBodyBytes > 0 && size > t.maxBodyBytes {
+		return nil, errKafkaResponseSize
+	}
+	if got := int32(binary.BigEndian.Uint32(header[4:])); got != correlationID {
+		return nil, fmt.Errorf("Kafka response has correlation ID %v, expected %v", got, correlationID)
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(conn.r, body); err != nil {
+		return nil, err
+	}
+	return &wireReader{buf: body}, nil
+}
+
+// metadata returns the partitions and leaders of a topic, fetching them
+// from a bootstrap broker the first time the topic is used.
+func (t *kafkaTransport) metadata(ctx context.Context, topic string) (*kafkaTopic, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if meta, ok := t.topics[topic]; ok {
+		return meta, nil
+	}
+
+	req := &wireWriter{}
+	req.int32(1)
+	req.string(topic)
+
+	addr := t.bootstrap[rand.Intn(len(t.bootstrap))]
+	r, err := t.roundTrip(ctx, addr, kafkaMetadataKey, kafkaMetadataVersion, req.Bytes(), true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metadata for Kafka topic %v: %v", topic, err)
+	}
+
+	meta, err := parseKafkaMetadata(r, topic)
+	if err != nil {
+		return nil, err
+	}
+	t.topics[topic] = meta
+	return meta, nil
+}
+
+func (t *kafkaTransport) invalidate(topic string) {
+	t.mu.Lock()
+	delete(t.topics, topic)
+	t.mu.Unlock()
+}
+
+func parseKafkaMetadata(r *wireReader, topic string) (*kafkaTopic, error) {
+	brokers := make(map[int32]string)
+	for i, n := 0, r.arrayLen(); i < n; i++ {
+		id := r.int32()
+		host := r.string()
+		port := r.int32()
+		r.string() // rack
+		brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	r.int32() // controller ID
+
+	var meta *kafkaTopic
+	for i, n := 0, r.arrayLen(); i < n; i++ {
+		topicErr := KafkaError(r.int16())
+		name := r.string()
+		r.int8() // is internal
+
+		t := &kafkaTopic{leaders: make(map[int32]string)}
+		for j, m := 0, r.arrayLen(); j < m; j++ {
+			r.int16() // partition error code
+			partition := r.int32()
+			leader := r.int32()
+			for k, l := 0, r.arrayLen(); k < l; k++ {
+				r.int32() // replica
+			}
+			for k, l := 0, r.arrayLen(); k < l; k++ {
+				r.int32() // in-sync replica
+			}
+
+			t.partitions = append(t.partitions, partition)
+			if addr, ok := brokers[leader]; ok {
+				t.leaders[partition] = addr
+			}
+		}
+
+		if r.err == nil && name == topic {
+			if topicErr != 0 {
+				return nil, fmt.Errorf("failed to get metadata for Kafka topic %v: %v", topic, topicErr)
+			}
+			meta = t
+		}
+	}
+
+	if r.err != nil {
+		return nil, fmt.Errorf("failed to parse Kafka metadata: %v", r.err)
+	}
+	if meta == nil || len(meta.partitions) == 0 {
+		return nil, fmt.Errorf("Kafka topic %v has no partitions", topic)
+	}
+	sort.Sort(int32s(meta.partitions))
+	return meta, nil
+}
+
+type int32s []int32
+
+func (s int32s) Len() int           { return len(s) }
+func (s int32s) Less(i, j int) bool { return s[i] < s[j] }
+func (s int32s) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// choosePartition uses the key's hash if there's a key, and otherwise
+// spreads messages across partitions.
+func (t *kafkaTransport) choosePartition(meta *kafkaTopic, key []byte) int32 {
+	if key != nil {
+		return meta.partitions[kafkaPartition(key, len(meta.partitions))]
+	}
+	next := atomic.AddUint32(&t.next, 1)
+	return meta.partitions[int(next%uint32(len(meta.partitions)))]
+}
+
+func (t *kafkaTransport) Call(ctx context.Context, r *Request) (*Response, error) {
+	topic := strings.TrimSpace(r.Method)
+	if topic == "" {
+		return nil, errNoKafkaTopic
+	}
+
+	var key []byte
+	if t.key != nil {
+		var err error
+		if key, err = t.key(r); err != nil {
+			return nil, err
+		}
+	}
+
+	meta, err := t.metadata(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	partition := t.choosePartition(meta, key)
+	addr, ok := meta.leaders[partition]
+	if !ok {
+		t.invalidate(topic)
+		return nil, fmt.Errorf("partition %v of Kafka topic %v has no leader", partition, topic)
+	}
+	setCallPeer(ctx, "kafka://"+addr)
+
+	timeout := time.Second
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = deadline.Sub(time.Now())
+	}
+
+	req := &wireWriter{}
+	req.int16(-1) // transactional ID
+	req.int16(t.acks)
+	req.int32(int32(timeout / time.Millisecond))
+	req.int32(1)
+	req.string(topic)
+	req.int32(1)
+	req.int32(partition)
+	req.bytes(kafkaRecordBatch(key, r.Body, r.Headers, time.Now()))
+
+	res, err := t.roundTrip(ctx, addr, kafkaProduceKey, kafkaProduceVersion, req.Bytes(), t.acks != 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without acknowledgements, there is no offset.
+	offset := int64(-1)
+	if res != nil {
+		if offset, err = parseKafkaProduce(res); err != nil {
+			if kafkaErr, ok := err.(KafkaError); ok && kafkaErr.staleMetadata() {
+				t.invalidate(topic)
+			}
+			return nil, err
+		}
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"topic":     topic,
+		"partition": partition,
+		"offset":    offset,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{
+		Body: body,
+		Peer: "kafka://" + addr,
+	}, nil
+}
+
+// parseKafkaProduce returns the offset of the message in a produce response
+// for a single partition.
+func parseKafkaProduce(r *wireReader) (int64, error) {
+	var (
+		errCode KafkaError
+		offset  int64
+	)
+	for i, n := 0, r.arrayLen(); i < n; i++ {
+		r.string() // topic
+		for j, m := 0, r.arrayLen(); j < m; j++ {
+			r.int32() // partition
+			errCode = KafkaError(r.int16())
+			offset = r.int64()
+			r.int64() // log append time
+		}
+	}
+	r.int32() // throttle time
+
+	if r.err != nil {
+		return 0, fmt.Errorf("failed to parse Kafka produce response: %v", r.err)
+	}
+	if errCode != 0 {
+		return 0, errCode
+	}
+	return offset, nil
+}
@@ -0,0 +1,359 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeKafka is a broker that leads every partition of the "events" topic,
+// and records the messages produced to it.
+type fakeKafka struct {
+	t  *testing.T
+	ln net.Listener
+
+	mu       sync.Mutex
+	metadata int
+	produced map[int32][]testKafkaRecord
+	acks     []int16
+}
+
+func newFakeKafka(t *testing.T) *fakeKafka {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Listen failed")
+
+	k := &fakeKafka{t: t, ln: ln, produced: make(map[int32][]testKafkaRecord)}
+	go k.serve()
+	return k
+}
+
+func (k *fakeKafka) url() string {
+	return "kafka://" + k.ln.Addr().String()
+}
+
+func (k *fakeKafka) serve() {
+	for {
+		conn, err := k.ln.Accept()
+		if err != nil {
+			return
+		}
+		go k.handle(conn)
+	}
+}
+
+func (k *fakeKafka) handle(conn net.Conn) {
+	defer conn.Close()
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		req := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return
+		}
+
+		r := &wireReader{buf: req}
+		apiKey := r.int16()
+		r.int16() // API version
+		correlationID := r.int32()
+		r.string() // client ID
+
+		w := &wireWriter{}
+		w.int32(0)
+		w.int32(correlationID)
+		switch apiKey {
+		case kafkaMetadataKey:
+			k.writeMetadata(r, w)
+		case kafkaProduceKey:
+			if !k.produce(r, w) {
+				continue
+			}
+		}
+
+		res := w.Bytes()
+		binary.BigEndian.PutUint32(res, uint32(len(res)-4))
+		conn.Write(res)
+	}
+}
+
+func (k *fakeKafka) writeMetadata(r *wireReader, w *wireWriter) {
+	k.mu.Lock()
+	k.metadata++
+	k.mu.Unlock()
+
+	host, portStr, _ := net.SplitHostPort(k.ln.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	w.int32(1)
+	w.int32(0)
+	w.string(host)
+	w.int32(int32(port))
+	w.int16(-1) // rack
+	w.int32(0)  // controller
+
+	topic := (&wireReader{buf: r.buf[4:]}).string()
+	w.int32(1)
+	switch topic {
+	case "events", "slow":
+		w.int16(0)
+		w.string(topic)
+		w.int8(0)
+		w.int32(2)
+		for p := int32(0); p < 2; p++ {
+			w.int16(0)
+			w.int32(p)
+			w.int32(0) // leader
+			w.int32(0) // replicas
+			w.int32(0) // in-sync replicas
+		}
+	case "noleader":
+		w.int16(0)
+		w.string(topic)
+		w.int8(0)
+		w.int32(1)
+		w.int16(5)
+		w.int32(0)
+		w.int32(-1)
+		w.int32(0)
+		w.int32(0)
+	default:
+		w.int16(3)
+		w.string(topic)
+		w.int8(0)
+		w.int32(0)
+	}
+}
+
+// produce records the message, and returns whether a response should be sent.
+func (k *fakeKafka) produce(r *wireReader, w *wireWriter) bool {
+	r.int16() // transactional ID
+	acks := r.int16()
+	r.int32() // timeout
+	r.int32() // topics
+	topic := r.string()
+	r.int32() // partitions
+	partition := r.int32()
+	batch := r.next(int(r.int32()))
+	record := parseTestRecord(k.t, batch)
+
+	if topic == "slow" {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	k.mu.Lock()
+	k.acks = append(k.acks, acks)
+	offset := int64(len(k.produced[partition]))
+	k.produced[partition] = append(k.produced[partition], record)
+	k.mu.Unlock()
+
+	if acks == 0 {
+		return false
+	}
+
+	w.int32(1)
+	w.string(topic)
+	w.int32(1)
+	w.int32(partition)
+	if string(record.value) == "reject" {
+		w.int16(6)
+	} else {
+		w.int16(0)
+	}
+	w.int64(offset)
+	w.int64(-1)
+	w.int32(0) // throttle time
+	return true
+}
+
+func TestKafkaConstructor(t *testing.T) {
+	tests := []struct {
+		opts   KafkaOptions
+		errMsg string
+	}{
+		{errMsg: errNoURLs.Error()},
+		{opts: KafkaOptions{URLs: []string{"kafka://localhost:9092"}}},
+		{opts: KafkaOptions{URLs: []string{"kafka://localhost:9092"}, Acks: -1}},
+		{opts: KafkaOptions{URLs: []string{"kafka://localhost:9092"}, Acks: 2}, errMsg: errKafkaAcks.Error()},
+		{opts: KafkaOptions{URLs: []string{"http://localhost:9092"}}, errMsg: "invalid Kafka URL"},
+	}
+
+	for _, tt := range tests {
+		_, err := Kafka(tt.opts)
+		if tt.errMsg == "" {
+			assert.NoError(t, err, "Kafka(%+v) failed", tt.opts)
+			continue
+		}
+		if assert.Error(t, err, "Kafka(%+v) should fail", tt.opts) {
+			assert.Contains(t, err.Error(), tt.errMsg, "Unexpected error for %+v", tt.opts)
+		}
+	}
+}
+
+func TestKafkaProduce(t *testing.T) {
+	k := newFakeKafka(t)
+	defer k.ln.Close()
+
+	transport, err := Kafka(KafkaOptions{URLs: []string{k.url()}, Acks: -1})
+	require.NoError(t, err, "Failed to create Kafka transport")
+
+	for i := 0; i < 4; i++ {
+		res, err := transport.Call(context.Background(), &Request{
+			Method:  "events",
+			Headers: map[string]string{"h": "v"},
+			Body:    []byte(`{"i":` + strconv.Itoa(i) + `}`),
+		})
+		require.NoError(t, err, "Call failed")
+		assert.Equal(t, k.url(), res.Peer, "Unexpected peer")
+
+		// Messages without keys alternate between the partitions.
+		want := `{"topic":"events","partition":` + strconv.Itoa((i+1)%2) + `,"offset":` + strconv.Itoa(i/2) + `}`
+		assert.JSONEq(t, want, string(res.Body), "Unexpected response")
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	assert.Equal(t, 1, k.metadata, "Metadata should be cached")
+	assert.Equal(t, []int16{-1, -1, -1, -1}, k.acks, "Unexpected acks")
+	assert.Equal(t, testKafkaRecord{
+		value:   []byte(`{"i":0}`),
+		headers: map[string]string{"h": "v"},
+	}, k.produced[1][0], "Unexpected record")
+}
+
+func TestKafkaProduceKey(t *testing.T) {
+	k := newFakeKafka(t)
+	defer k.ln.Close()
+
+	transport, err := Kafka(KafkaOptions{
+		URLs: []string{k.url()},
+		Acks: 1,
+		Key: func(r *Request) ([]byte, error) {
+			return r.Body, nil
+		},
+	})
+	require.NoError(t, err, "Failed to create Kafka transport")
+
+	for _, key := range []string{"foobar", "foobar", "abc"} {
+		_, err := transport.Call(context.Background(), &Request{Method: "events", Body: []byte(key)})
+		require.NoError(t, err, "Call failed")
+	}
+
+	// Messages with the same key use the same partition.
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	partition := kafkaPartition([]byte("foobar"), 2)
+	if assert.Len(t, k.produced[int32(partition)], 2, "Unexpected messages for partition %v", partition) {
+		assert.Equal(t, []byte("foobar"), k.produced[int32(partition)][0].key, "Unexpected key")
+	}
+}
+
+func TestKafkaProduceNoAcks(t *testing.T) {
+	k := newFakeKafka(t)
+	defer k.ln.Close()
+
+	transport, err := Kafka(KafkaOptions{URLs: []string{k.url()}, Acks: 0})
+	require.NoError(t, err, "Failed to create Kafka transport")
+
+	for i := 0; i < 2; i++ {
+		res, err := transport.Call(context.Background(), &Request{Method: "events", Body: []byte("v")})
+		require.NoError(t, err, "Call failed")
+		assert.JSONEq(t, `{"topic":"events","partition":`+strconv.Itoa((i+1)%2)+`,"offset":-1}`, string(res.Body), "Unexpected response")
+	}
+}
+
+func TestKafkaProduceErrors(t *testing.T) {
+	k := newFakeKafka(t)
+	defer k.ln.Close()
+
+	transport, err := Kafka(KafkaOptions{URLs: []string{k.url()}, Acks: 1})
+	require.NoError(t, err, "Failed to create Kafka transport")
+
+	tests := []struct {
+		msg    string
+		topic  string
+		body   string
+		errMsg string
+	}{
+		{msg: "no topic", topic: " ", errMsg: errNoKafkaTopic.Error()},
+		{msg: "unknown topic", topic: "unknown", errMsg: "Kafka error UNKNOWN_TOPIC_OR_PARTITION (3)"},
+		{msg: "no leader", topic: "noleader", errMsg: "partition 0 of Kafka topic noleader has no leader"},
+		{msg: "error code", topic: "events", body: "reject", errMsg: "Kafka error NOT_LEADER_OR_FOLLOWER (6)"},
+	}
+
+	for _, tt := range tests {
+		_, err := transport.Call(context.Background(), &Request{Method: tt.topic, Body: []byte(tt.body)})
+		if assert.Error(t, err, "%v: expected error", tt.msg) {
+			assert.Contains(t, err.Error(), tt.errMsg, "%v: unexpected error", tt.msg)
+		}
+	}
+
+	// Errors for stale metadata cause it to be fetched again.
+	k.mu.Lock()
+	before := k.metadata
+	k.mu.Unlock()
+	_, err = transport.Call(context.Background(), &Request{Method: "events", Body: []byte("ok")})
+	require.NoError(t, err, "Call failed")
+	k.mu.Lock()
+	assert.Equal(t, before+1, k.metadata, "Metadata should be fetched after NOT_LEADER_OR_FOLLOWER")
+	k.mu.Unlock()
+}
+
+func TestKafkaProduceTimeout(t *testing.T) {
+	k := newFakeKafka(t)
+	defer k.ln.Close()
+
+	transport, err := Kafka(KafkaOptions{URLs: []string{k.url()}, Acks: 1})
+	require.NoError(t, err, "Failed to create Kafka transport")
+
+	// Fetch the metadata before the call that times out.
+	_, err = transport.Call(context.Background(), &Request{Method: "slow", Body: []byte("v")})
+	require.NoError(t, err, "Call failed")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = transport.Call(ctx, &Request{Method: "slow", Body: []byte("v")})
+	assert.Error(t, err, "Call should time out")
+}
+
+func TestKafkaMaxResponseBytes(t *testing.T) {
+	k := newFakeKafka(t)
+	defer k.ln.Close()
+
+	transport, err := Kafka(KafkaOptions{URLs: []string{k.url()}, Acks: 1, MaxResponseBytes: 10})
+	require.NoError(t, err, "Failed to create Kafka transport")
+
+	_, err = transport.Call(context.Background(), &Request{Method: "events", Body: []byte("v")})
+	if assert.Error(t, err, "Call should fail") {
+		assert.Contains(t, err.Error(), errKafkaResponseSize.Error(), "Unexpected error")
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"time"
+)
+
+// Kafka API keys and the versions used. Produce v3 is the oldest version
+// supported by current brokers, and uses the v2 record batch format.
+const (
+	kafkaProduceKey      = 0
+	kafkaProduceVersion  = 3
+	kafkaMetadataKey     = 3
+	kafkaMetadataVersion = 1
+)
+
+var kafkaCastagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// varint writes a zigzag-encoded varint, as used in Kafka records.
+func (w *wireWriter) varint(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	w.Write(b[:binary.PutVarint(b[:], v)])
+}
+
+// varintBytes writes a varint length followed by the bytes, using a length
+// of -1 for nil.
+func (w *wireWriter) varintBytes(bs []byte) {
+	if bs == nil {
+		w.varint(-1)
+		return
+	}
+	w.varint(int64(len(bs)))
+	w.Write(bs)
+}
+
+// kafkaRequest returns a size-prefixed request with the given header and body.
+func kafkaRequest(apiKey, apiVersion int16, correlationID int32, clientID string, body []byte) []byte {
+	w := &wireWriter{}
+	w.int32(0)
+	w.int16(apiKey)
+	w.int16(apiVersion)
+	w.int32(correlationID)
+	w.string(clientID)
+	w.Write(body)
+
+	bs := w.Bytes()
+	binary.BigEndian.PutUint32(bs, uint32(len(bs)-4))
+	return bs
+}
+
+// kafkaRecordBatch encodes a record batch (magic v2) containing a single record.
+func kafkaRecordBatch(key, value []byte, headers map[string]string, now time.Time) []byte {
+	record := &wireWriter{}
+	record.int8(0)   // attributes
+	record.varint(0) // timestamp delta
+	record.varint(0) // offset delta
+	record.varintBytes(key)
+	record.varintBytes(value)
+	record.varint(int64(len(headers)))
+	for k, v := range headers {
+		record.varintBytes([]byte(k))
+		record.varintBytes([]byte(v))
+	}
+
+	// The CRC covers everything from the attributes to the end of the batch.
+	timestamp := now.UnixNano() / int64(time.Millisecond)
+	crcd := &wireWriter{}
+	crcd.int16(0) // attributes
+	crcd.int32(0) // last offset delta
+	crcd.int64(timestamp)
+	crcd.int64(timestamp)
+	crcd.int64(-1) // producer ID
+	crcd.int16(-1) // producer epoch
+	crcd.int32(-1) // base sequence
+	crcd.int32(1)  // number of records
+	crcd.varint(int64(record.Len()))
+	crcd.Write(record.Bytes())
+
+	batch := &wireWriter{}
+	batch.int64(0) // base offset
+	batch.int32(int32(4 + 1 + 4 + crcd.Len()))
+	batch.int32(-1) // partition leader epoch
+	batch.int8(2)   // magic
+	batch.int32(int32(crc32.Checksum(crcd.Bytes(), kafkaCastagnoli)))
+	batch.Write(crcd.Bytes())
+	return batch.Bytes()
+}
+
+// kafkaPartition returns the partition for a key using murmur2, the same as
+// the default partitioner of the Java client, so keys map to the same
+// partitions as messages produced by other services.
+func kafkaPartition(key []byte, partitions int) int {
+	return int(kafkaMurmur2(key)&0x7fffffff) % partitions
+}
+
+func kafkaMurmur2(data []byte) int32 {
+	const (
+		seed = uint32(0x9747b28c)
+		m    = uint32(0x5bd1e995)
+		r    = 24
+	)
+
+	length := len(data)
+	h := seed ^ uint32(length)
+	for i := 0; i+4 <= length; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+
+	tail := data[length&^3:]
+	switch len(tail) {
+	case 3:
+		h ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(tail[0])
+		h *= m
+	}
+
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKafkaMurmur2(t *testing.T) {
+	// Test vectors from the Java client, so keys map to the same partitions.
+	tests := map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"abc":                        479470107,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+	}
+
+	for key, want := range tests {
+		assert.Equal(t, want, kafkaMurmur2([]byte(key)), "Unexpected hash for %q", key)
+	}
+}
+
+type testKafkaRecord struct {
+	key     []byte
+	value   []byte
+	headers map[string]string
+}
+
+func readTestVarint(r *wireReader) int64 {
+	n, size := binary.Varint(r.buf)
+	if size <= 0 {
+		r.err = errShortResponse
+		return 0
+	}
+	r.buf = r.buf[size:]
+	return n
+}
+
+func readTestVarintBytes(r *wireReader) []byte {
+	n := readTestVarint(r)
+	if n < 0 {
+		return nil
+	}
+	return r.next(int(n))
+}
+
+// parseTestRecord checks the record batch, and returns its only record.
+func parseTestRecord(t *testing.T, batch []byte) testKafkaRecord {
+	r := &wireReader{buf: batch}
+	assert.Equal(t, int64(0), r.int64(), "Unexpected base offset")
+	assert.Equal(t, int(r.int32()), len(r.buf), "Unexpected batch length")
+	r.int32() // partition leader epoch
+	assert.Equal(t, int8(2), r.int8(), "Unexpected magic")
+	crc := uint32(r.int32())
+	assert.Equal(t, crc32.Checksum(r.buf, crc32.MakeTable(crc32.Castagnoli)), crc, "Unexpected CRC")
+
+	r.next(2 + 4 + 8 + 8 + 8 + 2 + 4)
+	require.Equal(t, int32(1), r.int32(), "Expected a single record")
+
+	assert.Equal(t, int(readTestVarint(r)), len(r.buf), "Unexpected record length")
+	r.int8()          // attributes
+	readTestVarint(r) // timestamp delta
+	readTestVarint(r) // offset delta
+
+	record := testKafkaRecord{
+		key:     readTestVarintBytes(r),
+		value:   readTestVarintBytes(r),
+		headers: make(map[string]string),
+	}
+	for i, n := 0, int(readTestVarint(r)); i < n; i++ {
+		k := readTestVarintBytes(r)
+		record.headers[string(k)] = string(readTestVarintBytes(r))
+	}
+
+	require.NoError(t, r.err, "Failed to parse record batch")
+	assert.Empty(t, r.buf, "Unexpected data after the record")
+	return record
+}
+
+func TestKafkaRecordBatch(t *testing.T) {
+	batch := kafkaRecordBatch([]byte("key"), []byte(`{"a":1}`), map[string]string{"h": "v"}, time.Unix(1, 0))
+	assert.Equal(t, testKafkaRecord{
+		key:     []byte("key"),
+		value:   []byte(`{"a":1}`),
+		headers: map[string]string{"h": "v"},
+	}, parseTestRecord(t, batch), "Unexpected record")
+
+	batch = kafkaRecordBatch(nil, []byte("v"), nil, time.Now())
+	assert.Equal(t, testKafkaRecord{
+		value:   []byte("v"),
+		headers: map[string]string{},
+	}, parseTestRecord(t, batch), "Unexpected record without a key")
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// maxBytesReader returns an error once more than max bytes are read.
+type maxBytesReader struct {
+	r         io.Reader
+	max       int64
+	remaining int64
+}
+
+func (m *maxBytesReader) Read(p []byte) (int, error) {
+	n, err := m.r.Read(p)
+	m.remaining -= int64(n)
+	if m.remaining < 0 {
+		return n, fmt.Errorf("response body exceeded the maximum size of %v bytes", m.max)
+	}
+	return n, err
+}
+
+// readBody reads the response body from r into buf. It returns an error if the
+// body is larger than maxBytes, and only keeps the first maxBuffered bytes in
+// memory, discarding the rest, in which case truncated is true. A limit of 0
+// means no limit.
+func readBody(r io.Reader, buf *bytes.Buffer, maxBytes, maxBuffered int64) (body []byte, truncated bool, err error) {
+	if maxBytes > 0 {
+		r = &maxBytesReader{r: r, max: maxBytes, remaining: maxBytes}
+	}
+
+	if maxBuffered <= 0 {
+		if _, err := buf.ReadFrom(r); err != nil {
+			return nil, false, err
+		}
+		return buf.Bytes(), false, nil
+	}
+
+	if _, err := io.CopyN(buf, r, maxBuffered); err != nil {
+		if err == io.EOF {
+			return buf.Bytes(), false, nil
+		}
+		return nil, false, err
+	}
+
+	discarded, err := io.Copy(ioutil.Discard, r)
+	if err != nil {
+		return nil, false, err
+	}
+	return buf.Bytes(), discarded > 0, nil
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadBody(t *testing.T) {
+	const body = "0123456789"
+
+	tests := []struct {
+		maxBytes      int64
+		maxBuffered   int64
+		want          string
+		wantTruncated bool
+		errMsg        string
+	}{
+		{want: body},
+		{maxBytes: 10, want: body},
+		{maxBytes: 9, errMsg: "exceeded the maximum size of 9 bytes"},
+		{maxBuffered: 10, want: body},
+		{maxBuffered: 20, want: body},
+		{maxBuffered: 4, want: "0123", wantTruncated: true},
+		{maxBytes: 10, maxBuffered: 4, want: "0123", wantTruncated: true},
+		{maxBytes: 9, maxBuffered: 4, errMsg: "exceeded the maximum size of 9 bytes"},
+		{maxBytes: 3, maxBuffered: 4, errMsg: "exceeded the maximum size of 3 bytes"},
+	}
+
+	for _, tt := range tests {
+		got, truncated, err := readBody(strings.NewReader(body), &bytes.Buffer{}, tt.maxBytes, tt.maxBuffered)
+		if tt.errMsg != "" {
+			if assert.Error(t, err, "readBody(%v, %v) should fail", tt.maxBytes, tt.maxBuffered) {
+				assert.Contains(t, err.Error(), tt.errMsg, "Unexpected error for readBody(%v, %v)", tt.maxBytes, tt.maxBuffered)
+			}
+			continue
+		}
+
+		if assert.NoError(t, err, "readBody(%v, %v) failed", tt.maxBytes, tt.maxBuffered) {
+			assert.Equal(t, tt.want, string(got), "readBody(%v, %v) body mismatch", tt.maxBytes, tt.maxBuffered)
+			assert.Equal(t, tt.wantTruncated, truncated, "readBody(%v, %v) truncated mismatch", tt.maxBytes, tt.maxBuffered)
+		}
+	}
+}
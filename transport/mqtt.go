@@ -0,0 +1,364 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// MQTTOptions are used to create a MQTT transport.
+type MQTTOptions struct {
+	// URLs are the brokers to publish to, as mqtt://[user:password@]host:port.
+	URLs []string
+
+	// ClientID is the prefix of the client ID used by each connection.
+	ClientID string
+
+	// Dial is used to create connections. If nil, net.Dial is used.
+	Dial func(network, addr string) (net.Conn, error)
+
+	// QoS is the quality of service that messages are published with.
+	QoS byte
+
+	// NoWait returns once a message is sent, rather than waiting for the
+	// broker to acknowledge QoS 1 and 2 messages.
+	NoWait bool
+
+	// MaxResponseBytes limits the size of packets from the broker. If 0, there is no limit.
+	MaxResponseBytes int64
+}
+
+// MQTT 3.1.1 packet types, as the high nibble of the first byte.
+const (
+	mqttConnect = 0x10
+	mqttConnack = 0x20
+	mqttPublish = 0x30
+	mqttPuback  = 0x40
+	mqttPubrec  = 0x50
+	mqttPubrel  = 0x62 // PUBREL has a required flag.
+	mqttPubcomp = 0x70
+)
+
+var (
+	errNoMQTTTopic      = errors.New("specify the MQTT topic as the method")
+	errMQTTQoS          = errors.New("MQTT QoS must be 0, 1 or 2")
+	errMQTTResponseSize = errors.New("MQTT packet exceeds the maximum response size")
+	errMQTTLength       = errors.New("invalid MQTT remaining length")
+)
+
+var mqttConnackErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+type mqttPeer struct {
+	addr     string
+	user     string
+	password string
+	hasUser  bool
+}
+
+type mqttTransport struct {
+	peers        []mqttPeer
+	clientID     string
+	qos          byte
+	noWait       bool
+	pool         *connPool
+	maxBodyBytes int64
+
+	packetID uint32
+}
+
+// MQTT returns a transport that publishes each request's body as a message
+// to the topic given by the method.
+func MQTT(opts MQTTOptions) (Transport, error) {
+	if len(opts.URLs) == 0 {
+		return nil, errNoURLs
+	}
+	if opts.QoS > 2 {
+		return nil, errMQTTQoS
+	}
+
+	peers := make([]mqttPeer, len(opts.URLs))
+	for i, s := range opts.URLs {
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme != "mqtt" || u.Host == "" {
+			return nil, fmt.Errorf("invalid MQTT URL %q, expected mqtt://host:port", s)
+		}
+
+		peers[i] = mqttPeer{addr: u.Host}
+		if u.User != nil {
+			peers[i].hasUser = true
+			peers[i].user = u.User.Username()
+			peers[i].password, _ = u.User.Password()
+		}
+	}
+
+	clientID := opts.ClientID
+	if clientID == "" {
+		clientID = "yab"
+	}
+
+	return &mqttTransport{
+		peers:        peers,
+		clientID:     clientID,
+		qos:          opts.QoS,
+		noWait:       opts.NoWait,
+		pool:         newConnPool(opts.Dial),
+		maxBodyBytes: opts.MaxResponseBytes,
+	}, nil
+}
+
+func writeMQTTString(w *wireWriter, s string) {
+	w.int16(int16(len(s)))
+	w.WriteString(s)
+}
+
+// mqttPacket returns a packet with the given first byte and body, using the
+// variable length encoding for the remaining length.
+func mqttPacket(header byte, body []byte) []byte {
+	w := &wireWriter{}
+	w.WriteByte(header)
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		w.WriteByte(b)
+		if n == 0 {
+			break
+		}
+	}
+	w.Write(body)
+	return w.Bytes()
+}
+
+// readMQTTPacket returns the first byte and body of the next packet.
+func readMQTTPacket(r *bufio.Reader, maxBytes int64) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var length int64
+	for i, multiplier := 0, int64(1); ; i, multiplier = i+1, multiplier*128 {
+		if i == 4 {
+			return 0, nil, errMQTTLength
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int64(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	if maxBytes > 0 && length > maxBytes {
+		return 0, nil, errMQTTResponseSize
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+// setupConn connects to the broker with a unique client ID, since brokers
+// disconnect existing clients that use the same ID.
+func (t *mqttTransport) setupConn(peer mqttPeer) func(*bufConn) error {
+	return func(conn *bufConn) error {
+		w := &wireWriter{}
+		writeMQTTString(w, "MQTT")
+		w.int8(4) // protocol level for 3.1.1
+
+		flags := byte(0x02) // clean session
+		if peer.hasUser {
+			flags |= 0x80
+			if peer.password != "" {
+				flags |= 0x40
+			}
+		}
+		w.WriteByte(flags)
+		w.int16(0) // no keep alive, as idle connections don't send pings
+
+		writeMQTTString(w, fmt.Sprintf("%v-%x", t.clientID, rand.Int63()))
+		if peer.hasUser {
+			writeMQTTString(w, peer.user)
+			if peer.password != "" {
+				writeMQTTString(w, peer.password)
+			}
+		}
+
+		conn.SetDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Write(mqttPacket(mqttConnect, w.Bytes())); err != nil {
+			return err
+		}
+		header, body, err := readMQTTPacket(conn.r, t.maxBodyBytes)
+		if err != nil {
+			return fmt.Errorf("failed to connect to MQTT broker: %v", err)
+		}
+		if header != mqttConnack || len(body) != 2 {
+			return fmt.Errorf("failed to connect to MQTT broker, got packet type 0x%02x", header)
+		}
+		if code := body[1]; code != 0 {
+			if msg, ok := mqttConnackErrors[code]; ok {
+				return fmt.Errorf("MQTT broker refused connection: %v", msg)
+			}
+			return fmt.Errorf("MQTT broker refused connection with code %v", code)
+		}
+
+		if t.noWait {
+			// Acknowledgements are discarded, so they don't fill up the
+			// socket's buffers. The goroutine exits once the connection is closed.
+			conn.SetDeadline(time.Time{})
+			go io.Copy(ioutil.Discard, conn.r)
+		}
+		return nil
+	}
+}
+
+// nextPacketID returns a non-zero packet ID.
+func (t *mqttTransport) nextPacketID() uint16 {
+	for {
+		if id := uint16(atomic.AddUint32(&t.packetID, 1)); id != 0 {
+			return id
+		}
+	}
+}
+
+// awaitAck reads packets until the packet of the given type with the ID,
+// ignoring acknowledgements for earlier packets.
+func (t *mqttTransport) awaitAck(conn *bufConn, ackType byte, id uint16) error {
+	for {
+		header, body, err := readMQTTPacket(conn.r, t.maxBodyBytes)
+		if err != nil {
+			return err
+		}
+		if header&0xf0 == ackType&0xf0 && len(body) >= 2 && binary.BigEndian.Uint16(body) == id {
+			return nil
+		}
+	}
+}
+
+func (t *mqttTransport) publish(conn *bufConn, topic string, payload []byte) error {
+	w := &wireWriter{}
+	writeMQTTString(w, topic)
+
+	var id uint16
+	if t.qos > 0 {
+		id = t.nextPacketID()
+		w.int16(int16(id))
+	}
+	w.Write(payload)
+
+	if _, err := conn.Write(mqttPacket(mqttPublish|t.qos<<1, w.Bytes())); err != nil {
+		return err
+	}
+	if t.noWait {
+		return nil
+	}
+
+	switch t.qos {
+	case 1:
+		return t.awaitAck(conn, mqttPuback, id)
+	case 2:
+		if err := t.awaitAck(conn, mqttPubrec, id); err != nil {
+			return err
+		}
+		rel := &wireWriter{}
+		rel.int16(int16(id))
+		if _, err := conn.Write(mqttPacket(mqttPubrel, rel.Bytes())); err != nil {
+			return err
+		}
+		return t.awaitAck(conn, mqttPubcomp, id)
+	}
+	return nil
+}
+
+func (t *mqttTransport) Call(ctx context.Context, r *Request) (*Response, error) {
+	topic := strings.TrimSpace(r.Method)
+	if topic == "" {
+		return nil, errNoMQTTTopic
+	}
+
+	peer := t.peers[rand.Intn(len(t.peers))]
+	setCallPeer(ctx, "mqtt://"+peer.addr)
+	conn, err := t.pool.get(peer.addr, t.setupConn(peer))
+	if err != nil {
+		return nil, err
+	}
+
+	if t.noWait {
+		// Reads have no deadline, since they only discard acknowledgements.
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetWriteDeadline(deadline)
+		}
+		err = t.publish(conn, topic, r.Body)
+	} else {
+		done := conn.watch(ctx)
+		err = t.publish(conn, topic, r.Body)
+		done()
+	}
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	t.pool.put(peer.addr, conn)
+
+	body, err := json.Marshal(map[string]interface{}{
+		"topic": topic,
+		"qos":   t.qos,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Response{
+		Body: body,
+		Peer: "mqtt://" + peer.addr,
+	}, nil
+}
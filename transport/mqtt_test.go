@@ -0,0 +1,284 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeMQTTMessage struct {
+	topic   string
+	qos     byte
+	payload string
+}
+
+// fakeMQTT is a broker that records published messages.
+type fakeMQTT struct {
+	ln net.Listener
+
+	mu        sync.Mutex
+	clientIDs []string
+	users     []string
+	messages  []fakeMQTTMessage
+	pubrels   int
+}
+
+func newFakeMQTT(t *testing.T) *fakeMQTT {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Listen failed")
+
+	b := &fakeMQTT{ln: ln}
+	go b.serve()
+	return b
+}
+
+func (b *fakeMQTT) url() string {
+	return "mqtt://" + b.ln.Addr().String()
+}
+
+// waitForMessages waits for QoS 0 messages, which are not acknowledged.
+func (b *fakeMQTT) waitForMessages(n int) {
+	for i := 0; i < 100; i++ {
+		b.mu.Lock()
+		got := len(b.messages)
+		b.mu.Unlock()
+		if got >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (b *fakeMQTT) serve() {
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(conn)
+	}
+}
+
+func (b *fakeMQTT) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	ack := func(header byte, id []byte) {
+		conn.Write(mqttPacket(header, id))
+	}
+
+	for {
+		header, body, err := readMQTTPacket(r, 0)
+		if err != nil {
+			return
+		}
+
+		switch header & 0xf0 {
+		case mqttConnect:
+			p := &wireReader{buf: body}
+			p.string() // protocol name
+			p.int8()   // level
+			flags := byte(p.int8())
+			p.int16() // keep alive
+			clientID := p.string()
+			var user string
+			if flags&0x80 != 0 {
+				user = p.string()
+			}
+			if flags&0x40 != 0 {
+				user += ":" + p.string()
+			}
+
+			b.mu.Lock()
+			b.clientIDs = append(b.clientIDs, clientID)
+			b.users = append(b.users, user)
+			b.mu.Unlock()
+
+			if strings.HasSuffix(user, ":wrong") {
+				ack(mqttConnack, []byte{0, 4})
+				return
+			}
+			ack(mqttConnack, []byte{0, 0})
+		case mqttPublish:
+			qos := (header >> 1) & 0x03
+			p := &wireReader{buf: body}
+			topic := p.string()
+			var id []byte
+			if qos > 0 {
+				id = p.next(2)
+			}
+
+			b.mu.Lock()
+			b.messages = append(b.messages, fakeMQTTMessage{topic, qos, string(p.buf)})
+			b.mu.Unlock()
+
+			if topic == "slow" {
+				time.Sleep(100 * time.Millisecond)
+			}
+			switch qos {
+			case 1:
+				// Send an acknowledgement for another packet first, which is ignored.
+				other := make([]byte, 2)
+				binary.BigEndian.PutUint16(other, binary.BigEndian.Uint16(id)+100)
+				ack(mqttPuback, other)
+				ack(mqttPuback, id)
+			case 2:
+				ack(mqttPubrec, id)
+			}
+		case mqttPubrel & 0xf0:
+			b.mu.Lock()
+			b.pubrels++
+			b.mu.Unlock()
+			ack(mqttPubcomp, body)
+		}
+	}
+}
+
+func TestMQTTConstructor(t *testing.T) {
+	tests := []struct {
+		opts   MQTTOptions
+		errMsg string
+	}{
+		{errMsg: errNoURLs.Error()},
+		{opts: MQTTOptions{URLs: []string{"mqtt://localhost:1883"}, QoS: 2}},
+		{opts: MQTTOptions{URLs: []string{"mqtt://localhost:1883"}, QoS: 3}, errMsg: errMQTTQoS.Error()},
+		{opts: MQTTOptions{URLs: []string{"tcp://localhost:1883"}}, errMsg: "invalid MQTT URL"},
+	}
+
+	for _, tt := range tests {
+		_, err := MQTT(tt.opts)
+		if tt.errMsg == "" {
+			assert.NoError(t, err, "MQTT(%+v) failed", tt.opts)
+			continue
+		}
+		if assert.Error(t, err, "MQTT(%+v) should fail", tt.opts) {
+			assert.Contains(t, err.Error(), tt.errMsg, "Unexpected error for %+v", tt.opts)
+		}
+	}
+}
+
+func TestMQTTPublish(t *testing.T) {
+	for _, qos := range []byte{0, 1, 2} {
+		b := newFakeMQTT(t)
+
+		transport, err := MQTT(MQTTOptions{URLs: []string{b.url()}, ClientID: "yab-test", QoS: qos})
+		require.NoError(t, err, "Failed to create MQTT transport")
+
+		for i := 0; i < 2; i++ {
+			res, err := transport.Call(context.Background(), &Request{Method: "sensors/1", Body: []byte(`{"temp":20}`)})
+			require.NoError(t, err, "QoS %v: Call failed", qos)
+			assert.JSONEq(t, `{"topic":"sensors/1","qos":`+string('0'+qos)+`}`, string(res.Body), "QoS %v: unexpected body", qos)
+			assert.Equal(t, b.url(), res.Peer, "QoS %v: unexpected peer", qos)
+		}
+
+		b.ln.Close()
+		b.waitForMessages(2)
+		b.mu.Lock()
+		assert.Equal(t, []fakeMQTTMessage{
+			{"sensors/1", qos, `{"temp":20}`},
+			{"sensors/1", qos, `{"temp":20}`},
+		}, b.messages, "QoS %v: unexpected messages", qos)
+		if assert.Len(t, b.clientIDs, 1, "QoS %v: connections should be reused", qos) {
+			assert.True(t, strings.HasPrefix(b.clientIDs[0], "yab-test-"), "QoS %v: unexpected client ID", qos)
+		}
+		if qos == 2 {
+			assert.Equal(t, 2, b.pubrels, "QoS 2 messages should be released")
+		}
+		b.mu.Unlock()
+	}
+}
+
+func TestMQTTNoWait(t *testing.T) {
+	b := newFakeMQTT(t)
+	defer b.ln.Close()
+
+	transport, err := MQTT(MQTTOptions{URLs: []string{b.url()}, QoS: 1, NoWait: true})
+	require.NoError(t, err, "Failed to create MQTT transport")
+
+	// The broker is slow to acknowledge messages, which calls don't wait for.
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err := transport.Call(context.Background(), &Request{Method: "slow", Body: []byte("v")})
+		require.NoError(t, err, "Call failed")
+	}
+	assert.True(t, time.Since(start) < 100*time.Millisecond, "Calls should not wait for acknowledgements")
+}
+
+func TestMQTTAuth(t *testing.T) {
+	b := newFakeMQTT(t)
+	defer b.ln.Close()
+
+	transport, err := MQTT(MQTTOptions{URLs: []string{"mqtt://device:secret@" + b.ln.Addr().String()}})
+	require.NoError(t, err, "Failed to create MQTT transport")
+	_, err = transport.Call(context.Background(), &Request{Method: "t"})
+	require.NoError(t, err, "Call failed")
+
+	transport, err = MQTT(MQTTOptions{URLs: []string{"mqtt://device:wrong@" + b.ln.Addr().String()}})
+	require.NoError(t, err, "Failed to create MQTT transport")
+	_, err = transport.Call(context.Background(), &Request{Method: "t"})
+	assert.EqualError(t, err, "MQTT broker refused connection: bad user name or password", "Unexpected error")
+
+	_, err = transport.Call(context.Background(), &Request{Method: " "})
+	assert.Equal(t, errNoMQTTTopic, err, "Unexpected error without a topic")
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	assert.Equal(t, []string{"device:secret", "device:wrong"}, b.users, "Unexpected users")
+}
+
+func TestMQTTTimeout(t *testing.T) {
+	b := newFakeMQTT(t)
+	defer b.ln.Close()
+
+	transport, err := MQTT(MQTTOptions{URLs: []string{b.url()}, QoS: 1})
+	require.NoError(t, err, "Failed to create MQTT transport")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = transport.Call(ctx, &Request{Method: "slow"})
+	assert.Error(t, err, "Call should time out")
+}
+
+func TestMQTTPacketLength(t *testing.T) {
+	for _, n := range []int{0, 127, 128, 16383, 16384, 2097152} {
+		packet := mqttPacket(mqttPublish, make([]byte, n))
+		header, body, err := readMQTTPacket(bufio.NewReader(strings.NewReader(string(packet))), 0)
+		require.NoError(t, err, "readMQTTPacket(%v) failed", n)
+		assert.Equal(t, byte(mqttPublish), header, "Unexpected header")
+		assert.Len(t, body, n, "Unexpected body length")
+	}
+
+	_, _, err := readMQTTPacket(bufio.NewReader(strings.NewReader("\x30\xff\xff\xff\xff\x01")), 0)
+	assert.Equal(t, errMQTTLength, err, "Lengths over 4 bytes should fail")
+
+	_, _, err = readMQTTPacket(bufio.NewReader(strings.NewReader("\x30\x05hello")), 4)
+	assert.Equal(t, errMQTTResponseSize, err, "Packets over the limit should fail")
+}
@@ -0,0 +1,222 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// PipeOptions are used to create a pipe transport.
+type PipeOptions struct {
+	// Command is the handler to run, and its arguments.
+	Command []string
+
+	// Stderr receives the handler's stderr. If nil, os.Stderr is used.
+	Stderr io.Writer
+
+	// MaxResponseBytes limits the size of response frames. If 0, there is no limit.
+	MaxResponseBytes int64
+}
+
+var (
+	errNoPipeCommand   = errors.New("specify the command to run as pipe://command")
+	errPipeFrameSize   = errors.New("pipe response exceeds the maximum response size")
+	errPipeHeaderValue = errors.New("pipe response headers should be a JSON object of strings")
+)
+
+type pipeTransport struct {
+	opts PipeOptions
+
+	// mu serializes calls, as the handler processes one request at a time.
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+// Pipe returns a transport that runs a handler as a subprocess, and makes
+// calls by writing requests to its stdin and reading responses from its
+// stdout. Each frame is a big-endian uint32 length followed by the data.
+// Requests are 3 frames: the method, the headers as a JSON object, and the
+// body. Responses are 2 frames: the headers as a JSON object, and the body.
+//
+// The handler is started on the first call, and restarted if a call fails.
+// Handlers should exit once stdin is closed.
+func Pipe(opts PipeOptions) (Transport, error) {
+	if len(opts.Command) == 0 {
+		return nil, errNoPipeCommand
+	}
+	if opts.Stderr == nil {
+		opts.Stderr = os.Stderr
+	}
+	return &pipeTransport{opts: opts}, nil
+}
+
+// ParsePipeURL returns the command for a pipe://command peer. The command
+// is split on whitespace, so arguments can't contain spaces.
+func ParsePipeURL(s string) ([]string, error) {
+	if !strings.HasPrefix(s, "pipe://") {
+		return nil, fmt.Errorf("invalid pipe URL %q, expected pipe://command", s)
+	}
+	command := strings.Fields(strings.TrimPrefix(s, "pipe://"))
+	if len(command) == 0 {
+		return nil, errNoPipeCommand
+	}
+	return command, nil
+}
+
+func (t *pipeTransport) start() error {
+	cmd := exec.Command(t.opts.Command[0], t.opts.Command[1:]...)
+	cmd.Stderr = t.opts.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start pipe command: %v", err)
+	}
+
+	t.cmd = cmd
+	t.stdin = stdin
+	t.stdout = bufio.NewReader(stdout)
+	return nil
+}
+
+// stop closes stdin and kills the handler, returning how it exited.
+func (t *pipeTransport) stop() error {
+	t.stdin.Close()
+	t.cmd.Process.Kill()
+	err := t.cmd.Wait()
+	t.cmd = nil
+	return err
+}
+
+func (t *pipeTransport) Call(ctx context.Context, r *Request) (*Response, error) {
+	peer := "pipe://" + strings.Join(t.opts.Command, " ")
+	setCallPeer(ctx, peer)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.cmd == nil {
+		if err := t.start(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Reads from the handler can't be interrupted, so the handler is
+	// killed if the context is cancelled, which closes its stdout.
+	done := make(chan struct{})
+	process := t.cmd.Process
+	go func() {
+		select {
+		case <-ctx.Done():
+			process.Kill()
+		case <-done:
+		}
+	}()
+
+	res, err := t.roundTrip(r)
+	close(done)
+	if err != nil {
+		exitErr := t.stop()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			if exitErr != nil {
+				return nil, fmt.Errorf("pipe command exited: %v", exitErr)
+			}
+			return nil, errors.New("pipe command exited")
+		}
+		return nil, err
+	}
+
+	res.Peer = peer
+	return res, nil
+}
+
+func (t *pipeTransport) roundTrip(r *Request) (*Response, error) {
+	headers := r.Headers
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	headersJSON, err := json.Marshal(headers)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &wireWriter{}
+	w.bytes([]byte(r.Method))
+	w.bytes(headersJSON)
+	w.bytes(r.Body)
+	if _, err := t.stdin.Write(w.Bytes()); err != nil {
+		return nil, err
+	}
+
+	resHeaders, err := t.readFrame()
+	if err != nil {
+		return nil, err
+	}
+	body, err := t.readFrame()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Response{Body: body}
+	if len(resHeaders) > 0 {
+		if err := json.Unmarshal(resHeaders, &res.Headers); err != nil {
+			return nil, errPipeHeaderValue
+		}
+	}
+	return res, nil
+}
+
+func (t *pipeTransport) readFrame() ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(t.stdout, size[:]); err != nil {
+		return nil, err
+	}
+
+	n := binary.BigEndian.Uint32(size[:])
+	if t.opts.MaxResponseBytes > 0 && int64(n) > t.opts.MaxResponseBytes {
+		return nil, errPipeFrameSize
+	}
+	frame := make([]byte, n)
+	_, err := io.ReadFull(t.stdout, frame)
+	return frame, err
+}
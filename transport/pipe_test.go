@@ -0,0 +1,165 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const pipeHandlerEnv = "YAB_TEST_PIPE_HANDLER"
+
+// TestPipeHandler is not a test, it's the handler run by the pipe transport
+// in other tests. It echoes the method, headers and body, and the method
+// can control its behaviour.
+func TestPipeHandler(t *testing.T) {
+	if os.Getenv(pipeHandlerEnv) == "" {
+		return
+	}
+	defer os.Exit(0)
+
+	r := bufio.NewReader(os.Stdin)
+	readFrame := func() []byte {
+		var size [4]byte
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			os.Exit(0)
+		}
+		frame := make([]byte, binary.BigEndian.Uint32(size[:]))
+		io.ReadFull(r, frame)
+		return frame
+	}
+
+	for {
+		method, headers, body := string(readFrame()), readFrame(), readFrame()
+		switch method {
+		case "exit":
+			os.Exit(3)
+		case "slow":
+			time.Sleep(time.Second)
+		case "badHeaders":
+			headers = []byte("[]")
+		}
+
+		w := &wireWriter{}
+		w.bytes(headers)
+		w.bytes(append([]byte(method+":"), body...))
+		os.Stdout.Write(w.Bytes())
+	}
+}
+
+func newTestPipe(t *testing.T, opts PipeOptions) Transport {
+	opts.Command = []string{"env", pipeHandlerEnv + "=1", os.Args[0], "-test.run=TestPipeHandler"}
+	transport, err := Pipe(opts)
+	require.NoError(t, err, "Failed to create pipe transport")
+	return transport
+}
+
+func TestPipeConstructor(t *testing.T) {
+	tests := []struct {
+		url     string
+		command []string
+		errMsg  string
+	}{
+		{url: "pipe://handler", command: []string{"handler"}},
+		{url: "pipe://./bin/handler  --port 0", command: []string{"./bin/handler", "--port", "0"}},
+		{url: "pipe:// ", errMsg: errNoPipeCommand.Error()},
+		{url: "exec://handler", errMsg: "invalid pipe URL"},
+	}
+
+	for _, tt := range tests {
+		command, err := ParsePipeURL(tt.url)
+		if tt.errMsg != "" {
+			if assert.Error(t, err, "ParsePipeURL(%v) should fail", tt.url) {
+				assert.Contains(t, err.Error(), tt.errMsg, "Unexpected error for %v", tt.url)
+			}
+			continue
+		}
+		if assert.NoError(t, err, "ParsePipeURL(%v) failed", tt.url) {
+			assert.Equal(t, tt.command, command, "Unexpected command for %v", tt.url)
+		}
+	}
+
+	_, err := Pipe(PipeOptions{})
+	assert.Equal(t, errNoPipeCommand, err, "Pipe without a command should fail")
+}
+
+func TestPipeCall(t *testing.T) {
+	transport := newTestPipe(t, PipeOptions{})
+
+	for i := 0; i < 3; i++ {
+		res, err := transport.Call(context.Background(), &Request{
+			Method:  "Svc::echo",
+			Headers: map[string]string{"k": "v"},
+			Body:    []byte{0, 1, 2},
+		})
+		require.NoError(t, err, "Call failed")
+		assert.Equal(t, map[string]string{"k": "v"}, res.Headers, "Unexpected headers")
+		assert.Equal(t, append([]byte("Svc::echo:"), 0, 1, 2), res.Body, "Unexpected body")
+		assert.True(t, strings.HasPrefix(res.Peer, "pipe://env "), "Unexpected peer %v", res.Peer)
+	}
+
+	_, err := transport.Call(context.Background(), &Request{Method: "badHeaders"})
+	assert.Equal(t, errPipeHeaderValue, err, "Unexpected error for invalid headers")
+
+	_, err = transport.Call(context.Background(), &Request{Method: "exit"})
+	assert.EqualError(t, err, "pipe command exited: exit status 3", "Unexpected error when the handler exits")
+
+	// The handler is restarted after failures.
+	res, err := transport.Call(context.Background(), &Request{Method: "echo"})
+	require.NoError(t, err, "Call after the handler exited failed")
+	assert.Equal(t, "echo:", string(res.Body), "Unexpected body")
+	assert.Equal(t, map[string]string{}, res.Headers, "Requests without headers should send an empty object")
+}
+
+func TestPipeLimits(t *testing.T) {
+	transport := newTestPipe(t, PipeOptions{MaxResponseBytes: 10})
+
+	_, err := transport.Call(context.Background(), &Request{Method: "echo", Body: bytes.Repeat([]byte("a"), 20)})
+	assert.Equal(t, errPipeFrameSize, err, "Large responses should fail")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = transport.Call(ctx, &Request{Method: "slow"})
+	assert.Equal(t, context.DeadlineExceeded, err, "Slow calls should time out")
+	assert.True(t, time.Since(start) < 500*time.Millisecond, "Cancelled calls should not wait for the handler")
+}
+
+func TestPipeStartFailure(t *testing.T) {
+	transport, err := Pipe(PipeOptions{Command: []string{"/does/not/exist"}})
+	require.NoError(t, err, "Failed to create pipe transport")
+
+	_, err = transport.Call(context.Background(), &Request{Method: "echo"})
+	if assert.Error(t, err, "Call should fail") {
+		assert.Contains(t, err.Error(), "failed to start pipe command", "Unexpected error")
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"bytes"
+	"sync"
+)
+
+// BufferPool is a pool of buffers used to read response bodies, to reduce
+// allocations when making many calls.
+type BufferPool struct {
+	pool sync.Pool
+}
+
+// NewBufferPool returns a new BufferPool.
+func NewBufferPool() *BufferPool {
+	return &BufferPool{
+		pool: sync.Pool{
+			New: func() interface{} { return &bytes.Buffer{} },
+		},
+	}
+}
+
+// get returns an empty buffer. If the pool is nil, a new buffer is returned.
+func (p *BufferPool) get() *bytes.Buffer {
+	if p == nil {
+		return &bytes.Buffer{}
+	}
+	return p.pool.Get().(*bytes.Buffer)
+}
+
+// put returns the buffer to the pool.
+func (p *BufferPool) put(buf *bytes.Buffer) {
+	if p == nil || buf == nil {
+		return
+	}
+	buf.Reset()
+	p.pool.Put(buf)
+}
+
+// Release returns the buffer used for the response body to the pool it
+// was read from, if any. The response body must not be used after Release.
+func (r *Response) Release() {
+	if r == nil || r.pool == nil {
+		return
+	}
+
+	r.pool.put(r.buf)
+	r.Body = nil
+	r.buf = nil
+	r.pool = nil
+}
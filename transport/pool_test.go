@@ -0,0 +1,73 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func TestBufferPoolNil(t *testing.T) {
+	var pool *BufferPool
+	buf := pool.get()
+	require.NotNil(t, buf, "nil pool should return a new buffer")
+	pool.put(buf)
+
+	var res *Response
+	res.Release()
+
+	res = &Response{Body: []byte("body")}
+	res.Release()
+	assert.Equal(t, []byte("body"), res.Body, "Release should not modify unpooled responses")
+}
+
+func TestHTTPBufferPool(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Header.Get("body"))
+	}))
+	defer svr.Close()
+
+	pool := NewBufferPool()
+	transport, err := HTTP(HTTPOptions{
+		URLs:          []string{svr.URL},
+		TargetService: "target",
+		BufferPool:    pool,
+	})
+	require.NoError(t, err, "Failed to create HTTP transport")
+
+	for _, body := range []string{"first response", "second"} {
+		res, err := transport.Call(context.Background(), &Request{
+			Method:  "method",
+			Headers: map[string]string{"body": body},
+		})
+		require.NoError(t, err, "Call failed")
+		assert.Equal(t, body, string(res.Body), "Body mismatch")
+
+		res.Release()
+		assert.Nil(t, res.Body, "Body should be cleared after Release")
+	}
+}
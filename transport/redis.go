@@ -0,0 +1,364 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/context"
+)
+
+// RedisOptions are used to create a Redis transport.
+type RedisOptions struct {
+	// URLs are the peers to call, as redis://[[user]:password@]host:port[/db].
+	URLs []string
+
+	// Dial is used to create connections. If nil, net.Dial is used.
+	Dial func(network, addr string) (net.Conn, error)
+
+	// MaxResponseBytes limits the size of replies, including the nested values
+	// of arrays and the protocol framing. If 0, there is no limit.
+	MaxResponseBytes int64
+}
+
+// Limits on Redis replies, which apply even without MaxResponseBytes, so that
+// an invalid reply cannot make yab allocate unbounded memory or recurse
+// without limit.
+const (
+	// maxRedisBulkLength is Redis's default proto-max-bulk-len.
+	maxRedisBulkLength = 512 << 20
+
+	maxRedisArrayLength = 1 << 24
+	maxRedisDepth       = 32
+
+	// redisArrayPrealloc limits the items allocated for an array up front,
+	// so the length of an array has to be backed by its items.
+	redisArrayPrealloc = 1024
+)
+
+var (
+	errNoRedisCommand   = errors.New("specify the Redis command as the method")
+	errRedisArgs        = errors.New("Redis arguments should be a JSON list of strings, numbers or booleans")
+	errRedisReplyTooBig = errors.New("Redis reply exceeds the maximum response size")
+	errRedisReplyDepth  = fmt.Errorf("Redis reply has more than %v levels of nested arrays", maxRedisDepth)
+)
+
+// RedisError is returned for Redis error replies.
+type RedisError string
+
+func (e RedisError) Error() string {
+	return "Redis error: " + string(e)
+}
+
+type redisPeer struct {
+	addr     string
+	user     string
+	password string
+	db       string
+}
+
+type redisTransport struct {
+	peers        []redisPeer
+	pool         *connPool
+	maxBodyBytes int64
+}
+
+// Redis returns a transport that sends commands to Redis-compatible services
+// using RESP. Calls use the method as the command, and the body as a JSON list
+// of arguments, and reply with the JSON representation of the Redis reply.
+func Redis(opts RedisOptions) (Transport, error) {
+	if len(opts.URLs) == 0 {
+		return nil, errNoURLs
+	}
+
+	peers := make([]redisPeer, len(opts.URLs))
+	for i, u := range opts.URLs {
+		peer, err := parseRedisURL(u)
+		if err != nil {
+			return nil, err
+		}
+		peers[i] = peer
+	}
+
+	return &redisTransport{
+		peers:        peers,
+		pool:         newConnPool(opts.Dial),
+		maxBodyBytes: opts.MaxResponseBytes,
+	}, nil
+}
+
+func parseRedisURL(s string) (redisPeer, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return redisPeer{}, err
+	}
+	if u.Scheme != "redis" || u.Host == "" {
+		return redisPeer{}, fmt.Errorf("invalid Redis URL %q, expected redis://host:port", s)
+	}
+
+	peer := redisPeer{addr: u.Host, db: strings.Trim(u.Path, "/")}
+	if u.User != nil {
+		peer.user = u.User.Username()
+		peer.password, _ = u.User.Password()
+	}
+	if peer.db != "" {
+		if _, err := strconv.Atoi(peer.db); err != nil {
+			return redisPeer{}, fmt.Errorf("invalid Redis database %q in %v", peer.db, s)
+		}
+	}
+	return peer, nil
+}
+
+// redisCommand returns the command and arguments for a request. The method may
+// contain multiple words, such as "CONFIG GET", which are the first arguments.
+func redisCommand(r *Request) ([]string, error) {
+	args := strings.Fields(r.Method)
+	if len(args) == 0 {
+		return nil, errNoRedisCommand
+	}
+
+	body := bytes.TrimSpace(r.Body)
+	if len(body) == 0 || bytes.Equal(body, []byte("null")) || bytes.Equal(body, []byte("{}")) {
+		return args, nil
+	}
+
+	var values []interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return nil, errRedisArgs
+	}
+
+	for _, v := range values {
+		switch v := v.(type) {
+		case string:
+			args = append(args, v)
+		case json.Number:
+			args = append(args, v.String())
+		case bool:
+			args = append(args, strconv.FormatBool(v))
+		default:
+			return nil, errRedisArgs
+		}
+	}
+	return args, nil
+}
+
+func writeRedisCommand(w io.Writer, args []string) error {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(buf, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// setupConn authenticates and selects the database on new connections.
+func (t *redisTransport) setupConn(peer redisPeer) func(*bufConn) error {
+	return func(conn *bufConn) error {
+		var setup [][]string
+		if peer.user != "" {
+			setup = append(setup, []string{"AUTH", peer.user, peer.password})
+		} else if peer.password != "" {
+			setup = append(setup, []string{"AUTH", peer.password})
+		}
+		if peer.db != "" {
+			setup = append(setup, []string{"SELECT", peer.db})
+		}
+
+		for _, args := range setup {
+			if _, err := t.roundTrip(conn, args); err != nil {
+				return fmt.Errorf("failed to run %v on new connection: %v", args[0], err)
+			}
+		}
+		return nil
+	}
+}
+
+func (t *redisTransport) roundTrip(conn *bufConn, args []string) (interface{}, error) {
+	if err := writeRedisCommand(conn, args); err != nil {
+		return nil, err
+	}
+	return readRedisReply(conn.r, t.maxBodyBytes)
+}
+
+func (t *redisTransport) Call(ctx context.Context, r *Request) (*Response, error) {
+	args, err := redisCommand(r)
+	if err != nil {
+		return nil, err
+	}
+
+	peer := t.peers[rand.Intn(len(t.peers))]
+	setCallPeer(ctx, "redis://"+peer.addr)
+	conn, err := t.pool.get(peer.addr, t.setupConn(peer))
+	if err != nil {
+		return nil, err
+	}
+
+	done := conn.watch(ctx)
+	reply, err := t.roundTrip(conn, args)
+	done()
+	if _, ok := err.(RedisError); err != nil && !ok {
+		// The connection is in an unknown state after I/O errors.
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	t.pool.put(peer.addr, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(reply)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{
+		Body: body,
+		Peer: "redis://" + peer.addr,
+	}, nil
+}
+
+// readRedisReply reads a RESP reply. Simple strings and bulk strings are
+// returned as strings, or using the binary representation if they are not
+// valid UTF-8, integers as int64, arrays as lists, and null replies as nil.
+// Error replies are returned as a RedisError. If maxBytes is set, replies
+// that are larger in total fail with errRedisReplyTooBig.
+func readRedisReply(r *bufio.Reader, maxBytes int64) (interface{}, error) {
+	rr := &redisReplyReader{r: r, maxBytes: maxBytes}
+	return rr.value(0)
+}
+
+// redisReplyReader reads a single reply, tracking the bytes read across all
+// of the reply's values.
+type redisReplyReader struct {
+	r        *bufio.Reader
+	maxBytes int64
+	read     int64
+}
+
+// add counts n more bytes of the reply, and fails if the reply is too big.
+func (rr *redisReplyReader) add(n int64) error {
+	rr.read += n
+	if rr.maxBytes > 0 && rr.read > rr.maxBytes {
+		return errRedisReplyTooBig
+	}
+	return nil
+}
+
+func (rr *redisReplyReader) value(depth int) (interface{}, error) {
+	line, err := rr.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if err := rr.add(int64(len(line))); err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("invalid Redis reply: %q", line)
+	}
+	kind, line := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return line, nil
+	case '-':
+		return nil, RedisError(line)
+	case ':':
+		return strconv.ParseInt(line, 10, 64)
+	case '$':
+		n, err := strconv.ParseInt(line, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Redis bulk string length: %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		if n > maxRedisBulkLength {
+			return nil, fmt.Errorf("Redis bulk string length %v exceeds the maximum of %v", n, maxRedisBulkLength)
+		}
+		if err := rr.add(n + 2); err != nil {
+			return nil, err
+		}
+
+		bs := make([]byte, n+2)
+		if _, err := io.ReadFull(rr.r, bs); err != nil {
+			return nil, err
+		}
+		if bs[n] != '\r' || bs[n+1] != '\n' {
+			return nil, fmt.Errorf("invalid Redis bulk string terminator: %q", bs[n:])
+		}
+		bs = bs[:n]
+		if utf8.Valid(bs) {
+			return string(bs), nil
+		}
+		return map[string]interface{}{"base64": base64.StdEncoding.EncodeToString(bs)}, nil
+	case '*':
+		n, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Redis array length: %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		if n > maxRedisArrayLength {
+			return nil, fmt.Errorf("Redis array length %v exceeds the maximum of %v", n, maxRedisArrayLength)
+		}
+		if depth >= maxRedisDepth {
+			return nil, errRedisReplyDepth
+		}
+
+		// Errors inside arrays, such as in EXEC replies, are returned as values.
+		prealloc := n
+		if prealloc > redisArrayPrealloc {
+			prealloc = redisArrayPrealloc
+		}
+		items := make([]interface{}, 0, prealloc)
+		for i := 0; i < n; i++ {
+			item, err := rr.value(depth + 1)
+			if redisErr, ok := err.(RedisError); ok {
+				item, err = map[string]interface{}{"error": string(redisErr)}, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("unknown Redis reply type %q", kind)
+}
@@ -0,0 +1,337 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRedis is a RESP server that replies to commands with canned replies,
+// and records the commands it receives.
+type fakeRedis struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	commands []string
+	conns    int
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Listen failed")
+
+	s := &fakeRedis{ln: ln}
+	go s.serve()
+	return s
+}
+
+func (s *fakeRedis) url() string {
+	return "redis://" + s.ln.Addr().String()
+}
+
+func (s *fakeRedis) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+func (s *fakeRedis) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns++
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readFakeCommand(r)
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.commands = append(s.commands, strings.Join(args, " "))
+		s.mu.Unlock()
+
+		var reply string
+		switch strings.ToUpper(args[0]) {
+		case "PING":
+			reply = "+PONG\r\n"
+		case "AUTH", "SELECT":
+			reply = "+OK\r\n"
+		case "GET":
+			if args[1] == "missing" {
+				reply = "$-1\r\n"
+			} else {
+				reply = "$3\r\nbar\r\n"
+			}
+		case "INCRBY":
+			reply = ":" + args[2] + "\r\n"
+		case "LRANGE":
+			reply = "*3\r\n$1\r\na\r\n:2\r\n*1\r\n-ERR nested\r\n"
+		case "DUMP":
+			reply = "$2\r\n\xff\xfe\r\n"
+		case "SLOW":
+			time.Sleep(100 * time.Millisecond)
+			reply = "+OK\r\n"
+		default:
+			reply = "-ERR unknown command '" + args[0] + "'\r\n"
+		}
+		conn.Write([]byte(reply))
+	}
+}
+
+func readFakeCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		if _, err := r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSuffix(arg, "\r\n")
+	}
+	return args, nil
+}
+
+func TestRedisConstructor(t *testing.T) {
+	tests := []struct {
+		urls   []string
+		errMsg string
+	}{
+		{errMsg: errNoURLs.Error()},
+		{urls: []string{"redis://localhost:6379"}},
+		{urls: []string{"redis://:secret@localhost:6379/2"}},
+		{urls: []string{"http://localhost:6379"}, errMsg: "invalid Redis URL"},
+		{urls: []string{"redis://localhost:6379/db"}, errMsg: "invalid Redis database"},
+	}
+
+	for _, tt := range tests {
+		_, err := Redis(RedisOptions{URLs: tt.urls})
+		if tt.errMsg == "" {
+			assert.NoError(t, err, "Redis(%v) failed", tt.urls)
+			continue
+		}
+		if assert.Error(t, err, "Redis(%v) should fail", tt.urls) {
+			assert.Contains(t, err.Error(), tt.errMsg, "Unexpected error for %v", tt.urls)
+		}
+	}
+}
+
+func TestRedisCall(t *testing.T) {
+	s := newFakeRedis(t)
+	defer s.ln.Close()
+
+	// The limit applies to the whole reply, and is large enough for every reply.
+	transport, err := Redis(RedisOptions{URLs: []string{s.url()}, MaxResponseBytes: 64})
+	require.NoError(t, err, "Failed to create Redis transport")
+
+	tests := []struct {
+		method  string
+		body    string
+		want    string
+		wantCmd string
+		errMsg  string
+	}{
+		{method: "PING", body: "{}", want: `"PONG"`, wantCmd: "PING"},
+		{method: "GET", body: `["foo"]`, want: `"bar"`, wantCmd: "GET foo"},
+		{method: "GET", body: `["missing"]`, want: `null`, wantCmd: "GET missing"},
+		{method: "INCRBY", body: `["n", 5]`, want: `5`, wantCmd: "INCRBY n 5"},
+		{method: "LRANGE", body: `["l", 0, -1]`, want: `["a",2,[{"error":"ERR nested"}]]`, wantCmd: "LRANGE l 0 -1"},
+		{method: "DUMP", body: `["k"]`, want: `{"base64":"//4="}`, wantCmd: "DUMP k"},
+		{method: "CONFIG GET", body: `["maxmemory"]`, errMsg: "Redis error: ERR unknown command 'CONFIG'", wantCmd: "CONFIG GET maxmemory"},
+		{method: "SET", body: `{"key": "value"}`, errMsg: errRedisArgs.Error()},
+		{method: "SET", body: `[["nested"]]`, errMsg: errRedisArgs.Error()},
+		{method: " ", errMsg: errNoRedisCommand.Error()},
+	}
+
+	for _, tt := range tests {
+		before := len(s.received())
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		res, err := transport.Call(ctx, &Request{Method: tt.method, Body: []byte(tt.body)})
+		cancel()
+
+		if tt.wantCmd != "" {
+			received := s.received()
+			if assert.Len(t, received, before+1, "%v: expected a command", tt.method) {
+				assert.Equal(t, tt.wantCmd, received[before], "%v: unexpected command", tt.method)
+			}
+		}
+
+		if tt.errMsg != "" {
+			if assert.Error(t, err, "%v: expected error", tt.method) {
+				assert.Contains(t, err.Error(), tt.errMsg, "%v: unexpected error", tt.method)
+			}
+			continue
+		}
+
+		if assert.NoError(t, err, "%v: Call failed", tt.method) {
+			assert.JSONEq(t, tt.want, string(res.Body), "%v: unexpected body", tt.method)
+			assert.Equal(t, s.url(), res.Peer, "%v: unexpected peer", tt.method)
+		}
+	}
+
+	// Error replies leave the connection usable, so a single connection is used.
+	s.mu.Lock()
+	assert.Equal(t, 1, s.conns, "Connections should be reused")
+	s.mu.Unlock()
+}
+
+func TestRedisAuthSelect(t *testing.T) {
+	s := newFakeRedis(t)
+	defer s.ln.Close()
+
+	url := "redis://user:secret@" + s.ln.Addr().String() + "/2"
+	transport, err := Redis(RedisOptions{URLs: []string{url}})
+	require.NoError(t, err, "Failed to create Redis transport")
+
+	for i := 0; i < 2; i++ {
+		_, err := transport.Call(context.Background(), &Request{Method: "PING"})
+		require.NoError(t, err, "Call failed")
+	}
+	assert.Equal(t, []string{"AUTH user secret", "SELECT 2", "PING", "PING"}, s.received(),
+		"Connection setup should only run once")
+}
+
+func TestRedisTimeout(t *testing.T) {
+	s := newFakeRedis(t)
+	defer s.ln.Close()
+
+	transport, err := Redis(RedisOptions{URLs: []string{s.url()}})
+	require.NoError(t, err, "Failed to create Redis transport")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = transport.Call(ctx, &Request{Method: "SLOW"})
+	assert.Error(t, err, "Call should time out")
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	_, err = transport.Call(ctx, &Request{Method: "SLOW"})
+	assert.Equal(t, context.Canceled, err, "Call should be cancelled")
+
+	// Connections are closed after a timeout, so later calls use a new connection.
+	res, err := transport.Call(context.Background(), &Request{Method: "PING"})
+	require.NoError(t, err, "Call failed")
+	assert.Equal(t, `"PONG"`, string(res.Body), "Unexpected body")
+}
+
+func TestReadRedisReplyLimits(t *testing.T) {
+	tests := []struct {
+		msg      string
+		reply    string
+		maxBytes int64
+		errMsg   string
+	}{
+		{
+			msg:    "bulk string too long",
+			reply:  "$536870913\r\n",
+			errMsg: "Redis bulk string length 536870913 exceeds the maximum of 536870912",
+		},
+		{
+			msg:    "array too long",
+			reply:  "*16777217\r\n",
+			errMsg: "Redis array length 16777217 exceeds the maximum of 16777216",
+		},
+		{
+			msg:    "arrays nested too deeply",
+			reply:  strings.Repeat("*1\r\n", maxRedisDepth+1) + ":1\r\n",
+			errMsg: errRedisReplyDepth.Error(),
+		},
+		{
+			// The length is within the limit, but the items are missing.
+			msg:    "array length without items",
+			reply:  "*16777216\r\n:1\r\n",
+			errMsg: "EOF",
+		},
+		{
+			// Each bulk string is within the limit, but the whole reply is not.
+			msg:      "array of bulk strings too big",
+			reply:    "*3\r\n" + strings.Repeat("$3\r\nfoo\r\n", 3),
+			maxBytes: 20,
+			errMsg:   errRedisReplyTooBig.Error(),
+		},
+		{
+			msg:    "bulk string without CRLF",
+			reply:  "$3\r\nfooXY",
+			errMsg: `invalid Redis bulk string terminator: "XY"`,
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := readRedisReply(bufio.NewReader(strings.NewReader(tt.reply)), tt.maxBytes)
+		if assert.Error(t, err, "%v: expected error", tt.msg) {
+			assert.Contains(t, err.Error(), tt.errMsg, "%v: unexpected error", tt.msg)
+		}
+	}
+
+	// Nesting up to the limit is allowed.
+	reply := strings.Repeat("*1\r\n", maxRedisDepth) + ":1\r\n"
+	_, err := readRedisReply(bufio.NewReader(strings.NewReader(reply)), 0)
+	assert.NoError(t, err, "Expected arrays nested up to the limit to be read")
+
+	// Replies up to the maximum size are allowed.
+	reply = "*3\r\n" + strings.Repeat("$3\r\nfoo\r\n", 3)
+	got, err := readRedisReply(bufio.NewReader(strings.NewReader(reply)), int64(len(reply)))
+	assert.NoError(t, err, "Expected replies up to the maximum size to be read")
+	assert.Equal(t, []interface{}{"foo", "foo", "foo"}, got, "Unexpected reply")
+}
+
+func TestRedisMaxResponseBytes(t *testing.T) {
+	s := newFakeRedis(t)
+	defer s.ln.Close()
+
+	transport, err := Redis(RedisOptions{URLs: []string{s.url()}, MaxResponseBytes: 2})
+	require.NoError(t, err, "Failed to create Redis transport")
+
+	_, err = transport.Call(context.Background(), &Request{Method: "GET", Body: []byte(`["foo"]`)})
+	assert.Equal(t, errRedisReplyTooBig, err, "Call should fail for large replies")
+}
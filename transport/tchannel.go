@@ -27,6 +27,8 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/uber/tchannel-go"
 	"github.com/uber/tchannel-go/thrift"
@@ -38,8 +40,25 @@ import (
 const rawHeadersKey = "_raw_"
 
 type tchan struct {
-	sc          *tchannel.SubChannel
-	callOptions *tchannel.CallOptions
+	ch           *tchannel.Channel
+	sc           *tchannel.SubChannel
+	callOptions  *tchannel.CallOptions
+	maxBodyBytes int64
+	maxBuffered  int64
+	pool         *BufferPool
+
+	// connectTimeout limits how long connecting to a peer can take, if set.
+	connectTimeout time.Duration
+
+	// onEvent is called for connection events, if set. The outbound
+	// connections to each peer are tracked to detect when they change.
+	onEvent  func(ConnectionEvent)
+	mu       sync.Mutex
+	outbound map[string]int
+
+	// newChannel creates a channel to the peers for each call, if set, so
+	// every call establishes a new connection.
+	newChannel func() (*tchannel.Channel, error)
 }
 
 // TChannelOptions are used to create a TChannel transport.
@@ -65,6 +84,30 @@ type TChannelOptions struct {
 	// TransportOpts are a list of options, mostly used to add or override
 	// TChannel's transport headers.
 	TransportOpts map[string]string
+
+	// MaxResponseBytes limits the size of response bodies. If 0, there is no limit.
+	MaxResponseBytes int64
+
+	// MaxBufferedBytes limits how much of each response body is kept in memory.
+	// The rest of the body is discarded and the response is marked as Truncated.
+	MaxBufferedBytes int64
+
+	// BufferPool is used to read response bodies, if set. Responses must be
+	// released using Response.Release once they are no longer used.
+	BufferPool *BufferPool
+
+	// ConnectTimeout limits how long connecting to a peer can take. If 0,
+	// connecting is only limited by the call's timeout.
+	ConnectTimeout time.Duration
+
+	// OnConnectionEvent is called for connection events, if set. Connections
+	// opened and closed are detected when the peer is next called, and any
+	// still open are reported as closed at shutdown when the transport is closed.
+	OnConnectionEvent func(ConnectionEvent)
+
+	// NewConnectionPerRequest makes each call on a new connection that is
+	// closed once the call completes, rather than reusing connections.
+	NewConnectionPerRequest bool
 }
 
 // TChannel returns a Transport that calls a TChannel service.
@@ -85,18 +128,26 @@ func TChannel(opts TChannelOptions) (Transport, error) {
 	}
 	processName := fmt.Sprintf("%v@%v:%v[%v]", os.Getenv("USER"), hostname, os.Args[0], os.Getpid())
 
-	// TODO: set trace sample rate to 1 for the initial request.
-	ch, err := tchannel.NewChannel(callerName, &tchannel.ChannelOptions{
-		Logger:          tchannel.NewLevelLogger(tchannel.SimpleLogger, level),
-		ProcessName:     processName,
-		TraceSampleRate: &opts.TraceSampleRate,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to create TChannel: %v", err)
+	newChannel := func() (*tchannel.Channel, error) {
+		// TODO: set trace sample rate to 1 for the initial request.
+		ch, err := tchannel.NewChannel(callerName, &tchannel.ChannelOptions{
+			Logger:          tchannel.NewLevelLogger(tchannel.SimpleLogger, level),
+			ProcessName:     processName,
+			TraceSampleRate: &opts.TraceSampleRate,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create TChannel: %v", err)
+		}
+
+		for _, hp := range opts.HostPorts {
+			ch.Peers().Add(hp)
+		}
+		return ch, nil
 	}
 
-	for _, hp := range opts.HostPorts {
-		ch.Peers().Add(hp)
+	ch, err := newChannel()
+	if err != nil {
+		return nil, err
 	}
 
 	callOpts := &tchannel.CallOptions{
@@ -104,32 +155,173 @@ func TChannel(opts TChannelOptions) (Transport, error) {
 	}
 	applyTChanOptions(callOpts, opts.TransportOpts)
 
-	return &tchan{
-		sc:          ch.GetSubChannel(opts.TargetService),
-		callOptions: callOpts,
-	}, nil
+	t := &tchan{
+		ch:             ch,
+		sc:             ch.GetSubChannel(opts.TargetService),
+		callOptions:    callOpts,
+		maxBodyBytes:   opts.MaxResponseBytes,
+		maxBuffered:    opts.MaxBufferedBytes,
+		pool:           opts.BufferPool,
+		onEvent:        opts.OnConnectionEvent,
+		connectTimeout: opts.ConnectTimeout,
+		outbound:       make(map[string]int),
+	}
+	if opts.NewConnectionPerRequest {
+		t.newChannel = newChannel
+	}
+	return t, nil
 }
 
 func (t *tchan) Call(ctx context.Context, r *Request) (*Response, error) {
-	call, err := t.sc.BeginCall(ctx, r.Method, t.callOptions)
+	var (
+		sc   = t.sc
+		peer *tchannel.Peer
+		err  error
+	)
+	if r.TTL > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.TTL)
+		defer cancel()
+	}
+	if t.newChannel != nil {
+		ch, err := t.newChannel()
+		if err != nil {
+			return nil, err
+		}
+		sc = ch.GetSubChannel(t.sc.ServiceName())
+		defer func() { t.closeChannel(ch, peer) }()
+	}
+
+	// Choose the peer explicitly so that we can report which peer was used.
+	peer, err = sc.Peers().Get(nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin call failed: %v", err)
+	}
+	setCallPeer(ctx, peer.HostPort())
+
+	if t.connectTimeout > 0 {
+		if err := t.connect(ctx, peer); err != nil {
+			return nil, fmt.Errorf("connect failed: %v", err)
+		}
+	}
+
+	call, err := peer.BeginCall(ctx, sc.ServiceName(), r.Method, t.callOptions)
+	t.observeConnections(peer)
 	if err != nil {
+		t.observeError(peer, err)
 		return nil, fmt.Errorf("begin call failed: %v", err)
 	}
 
 	if err := t.writeArgs(call, r); err != nil {
+		t.observeError(peer, err)
 		return nil, err
 	}
 
 	res, err := t.readResponse(call)
 	if err != nil {
+		t.observeError(peer, err)
 		return nil, err
 	}
 
 	span := tchannel.CurrentSpan(ctx)
 	res.Trace = fmt.Sprintf("%x", span.TraceID())
+	res.TraceSampled = span.TracingEnabled()
+	res.Peer = peer.HostPort()
 	return res, nil
 }
 
+// Close closes the channel, and reports the outbound connections that were
+// observed as open as closed at shutdown.
+func (t *tchan) Close() error {
+	t.ch.Close()
+
+	t.mu.Lock()
+	outbound := t.outbound
+	t.outbound = make(map[string]int)
+	t.mu.Unlock()
+
+	if t.onEvent == nil {
+		return nil
+	}
+	for hostPort, n := range outbound {
+		for ; n > 0; n-- {
+			t.onEvent(ConnectionEvent{Type: ConnectionClosedAtShutdown, Peer: hostPort})
+		}
+	}
+	return nil
+}
+
+// connect ensures there's a connection to peer, limiting how long a new
+// connection can take to the connect timeout.
+func (t *tchan) connect(ctx context.Context, peer *tchannel.Peer) error {
+	ctx, cancel := context.WithTimeout(ctx, t.connectTimeout)
+	defer cancel()
+
+	_, err := peer.GetConnection(ctx)
+	return err
+}
+
+// closeChannel closes a channel created for a single call, and reports the
+// connections to peer as closed, since the channel is not observed again.
+func (t *tchan) closeChannel(ch *tchannel.Channel, peer *tchannel.Peer) {
+	var outbound int
+	if peer != nil {
+		_, outbound = peer.NumConnections()
+	}
+	ch.Close()
+
+	if t.onEvent == nil {
+		return
+	}
+	for ; outbound > 0; outbound-- {
+		t.onEvent(ConnectionEvent{Type: ConnectionClosed, Peer: peer.HostPort()})
+	}
+}
+
+// observeConnections reports any change in the number of outbound
+// connections to peer since it was last observed.
+func (t *tchan) observeConnections(peer *tchannel.Peer) {
+	if t.onEvent == nil {
+		return
+	}
+
+	_, outbound := peer.NumConnections()
+	if t.newChannel != nil {
+		// Each call uses a new channel, so all of its connections are new.
+		for i := 0; i < outbound; i++ {
+			t.onEvent(ConnectionEvent{Type: ConnectionOpened, Peer: peer.HostPort()})
+		}
+		return
+	}
+
+	t.mu.Lock()
+	last := t.outbound[peer.HostPort()]
+	t.outbound[peer.HostPort()] = outbound
+	t.mu.Unlock()
+
+	for ; last < outbound; last++ {
+		t.onEvent(ConnectionEvent{Type: ConnectionOpened, Peer: peer.HostPort()})
+	}
+	for ; last > outbound; last-- {
+		t.onEvent(ConnectionEvent{Type: ConnectionClosed, Peer: peer.HostPort()})
+	}
+}
+
+// observeError reports connection events for calls that failed due to the
+// connection or a busy peer.
+func (t *tchan) observeError(peer *tchannel.Peer, err error) {
+	if t.onEvent == nil {
+		return
+	}
+
+	switch tchannel.GetSystemErrorCode(err) {
+	case tchannel.ErrCodeNetwork:
+		t.onEvent(ConnectionEvent{Type: ConnectionReset, Peer: peer.HostPort()})
+	case tchannel.ErrCodeBusy:
+		t.onEvent(ConnectionEvent{Type: PeerBusy, Peer: peer.HostPort()})
+	}
+}
+
 func (t *tchan) readResponse(call *tchannel.OutboundCall) (*Response, error) {
 	response := call.Response()
 
@@ -168,14 +360,27 @@ func (t *tchan) readResponse(call *tchannel.OutboundCall) (*Response, error) {
 		return nil, annotateError("failed to read response headers", err)
 	}
 
-	var responseBytes []byte
-	if err := tchannel.NewArgReader(response.Arg3Reader()).Read(&responseBytes); err != nil {
+	var (
+		responseBytes []byte
+		truncated     bool
+	)
+	buf := t.pool.get()
+	if err := readHelper(response.Arg3Reader, func(r tchannel.ArgReader) error {
+		var err error
+		responseBytes, truncated, err = readBody(r, buf, t.maxBodyBytes, t.maxBuffered)
+		return err
+	}); err != nil {
+		t.pool.put(buf)
 		return nil, annotateError("failed to read response body", err)
 	}
 
 	return &Response{
-		Headers: headers,
-		Body:    responseBytes,
+		Headers:   headers,
+		Body:      responseBytes,
+		Truncated: truncated,
+
+		buf:  buf,
+		pool: t.pool,
 	}, nil
 }
 
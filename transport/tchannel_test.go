@@ -23,6 +23,9 @@ package transport
 import (
 	"bytes"
 	"encoding/json"
+	"io"
+	"net"
+	"sync"
 	"testing"
 	"time"
 
@@ -195,6 +198,30 @@ func TestTChannelCallSuccessRaw(t *testing.T) {
 	}
 }
 
+func TestTChannelMaxResponseBytes(t *testing.T) {
+	svr, transport := setupServerAndTransport(t, func(opts *TChannelOptions) {
+		opts.MaxResponseBytes = 3
+	})
+	defer svr.Close()
+
+	testutils.RegisterFunc(svr, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{Arg3: args.Arg3}, nil
+	})
+
+	ctx, cancel := tchannel.NewContext(time.Second)
+	defer cancel()
+
+	res, err := transport.Call(ctx, &Request{Method: "echo", Body: []byte{1, 2, 3}})
+	if assert.NoError(t, err, "Call within the limit failed") {
+		assert.Equal(t, []byte{1, 2, 3}, res.Body, "Response body mismatch")
+	}
+
+	_, err = transport.Call(ctx, &Request{Method: "echo", Body: []byte{1, 2, 3, 4}})
+	if assert.Error(t, err, "Call over the limit should fail") {
+		assert.Contains(t, err.Error(), "exceeded the maximum size of 3 bytes", "Unexpected error")
+	}
+}
+
 func TestTChannelCallError(t *testing.T) {
 	ctx, cancel := tchannel.NewContext(time.Second)
 	defer cancel()
@@ -223,6 +250,174 @@ func TestTChannelCallError(t *testing.T) {
 	}
 }
 
+func TestTChannelConnectionEvents(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []ConnectionEvent
+	)
+	svr, transport := setupServerAndTransport(t, func(opts *TChannelOptions) {
+		opts.OnConnectionEvent = func(e ConnectionEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, e)
+		}
+	})
+	defer svr.Close()
+
+	getEvents := func() []ConnectionEvent {
+		mu.Lock()
+		defer mu.Unlock()
+		got := events
+		events = nil
+		return got
+	}
+
+	hostPort := svr.PeerInfo().HostPort
+	testutils.RegisterEcho(svr, nil)
+	testutils.RegisterFunc(svr, "busy", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return nil, tchannel.ErrServerBusy
+	})
+
+	call := func(method string) error {
+		ctx, cancel := tchannel.NewContext(time.Second)
+		defer cancel()
+		_, err := transport.Call(ctx, &Request{Method: method})
+		return err
+	}
+
+	require.NoError(t, call("echo"), "echo failed")
+	assert.Equal(t, []ConnectionEvent{{ConnectionOpened, hostPort}}, getEvents(), "first call should open a connection")
+
+	require.NoError(t, call("echo"), "echo failed")
+	assert.Empty(t, getEvents(), "connection should be reused")
+
+	require.Error(t, call("busy"), "busy should fail")
+	assert.Equal(t, []ConnectionEvent{{PeerBusy, hostPort}}, getEvents(), "busy error should be reported")
+
+	// Calls may fail with a network error before the close is observed.
+	svr.Close()
+	closed := ConnectionEvent{ConnectionClosed, hostPort}
+	var got []ConnectionEvent
+	if !assert.True(t, testutils.WaitFor(time.Second, func() bool {
+		call("echo")
+		got = append(got, getEvents()...)
+		return len(got) > 0 && got[len(got)-1] == closed
+	}), "closed connection should be reported, got %v", got) {
+		return
+	}
+	for _, e := range got[:len(got)-1] {
+		assert.Equal(t, ConnectionEvent{ConnectionReset, hostPort}, e, "unexpected events after server close")
+	}
+}
+
+func TestTChannelNewConnectionPerRequest(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []ConnectionEvent
+	)
+	svr, transport := setupServerAndTransport(t, func(opts *TChannelOptions) {
+		opts.NewConnectionPerRequest = true
+		opts.OnConnectionEvent = func(e ConnectionEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, e)
+		}
+	})
+	defer svr.Close()
+
+	hostPort := svr.PeerInfo().HostPort
+	testutils.RegisterEcho(svr, nil)
+
+	for i := 0; i < 3; i++ {
+		ctx, cancel := tchannel.NewContext(time.Second)
+		_, err := transport.Call(ctx, &Request{Method: "echo"})
+		cancel()
+		require.NoError(t, err, "echo failed")
+	}
+
+	opened := ConnectionEvent{ConnectionOpened, hostPort}
+	closed := ConnectionEvent{ConnectionClosed, hostPort}
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []ConnectionEvent{opened, closed, opened, closed, opened, closed}, events,
+		"each call should open and close a connection")
+}
+
+func TestTChannelCloseReportsConnections(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []ConnectionEvent
+	)
+	svr, transport := setupServerAndTransport(t, func(opts *TChannelOptions) {
+		opts.OnConnectionEvent = func(e ConnectionEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, e)
+		}
+	})
+	defer svr.Close()
+
+	hostPort := svr.PeerInfo().HostPort
+	testutils.RegisterEcho(svr, nil)
+
+	ctx, cancel := tchannel.NewContext(time.Second)
+	defer cancel()
+	_, err := transport.Call(ctx, &Request{Method: "echo"})
+	require.NoError(t, err, "echo failed")
+
+	closer, ok := transport.(io.Closer)
+	require.True(t, ok, "TChannel transport should be an io.Closer")
+	require.NoError(t, closer.Close(), "Close failed")
+
+	opened := ConnectionEvent{ConnectionOpened, hostPort}
+	closed := ConnectionEvent{ConnectionClosedAtShutdown, hostPort}
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []ConnectionEvent{opened, closed}, events, "Close should report open connections as closed at shutdown")
+}
+
+func TestTChannelConnectTimeout(t *testing.T) {
+	// The listener accepts connections, but never completes the TChannel handshake.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Listen failed")
+	defer ln.Close()
+
+	transport, err := TChannel(TChannelOptions{
+		SourceService:  "yab",
+		TargetService:  "svc",
+		HostPorts:      []string{ln.Addr().String()},
+		Encoding:       "raw",
+		ConnectTimeout: 50 * time.Millisecond,
+	})
+	require.NoError(t, err, "Failed to create TChannel transport")
+
+	ctx, cancel := tchannel.NewContext(5 * time.Second)
+	defer cancel()
+
+	start := time.Now()
+	_, err = transport.Call(ctx, &Request{Method: "echo"})
+	require.Error(t, err, "Call should fail")
+	assert.Contains(t, err.Error(), "connect failed", "unexpected error")
+	assert.True(t, time.Since(start) < time.Second, "call should fail after the connect timeout, not the call timeout")
+}
+
+func TestConnectionEventTypeString(t *testing.T) {
+	tests := []struct {
+		t    ConnectionEventType
+		want string
+	}{
+		{ConnectionOpened, "opened"},
+		{ConnectionClosed, "closed"},
+		{ConnectionReset, "reset"},
+		{PeerBusy, "busy"},
+		{ConnectionEventType(0), "ConnectionEventType(0)"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.t.String(), "unexpected String for %d", int(tt.t))
+	}
+}
+
 func TestTChannelCallOptions(t *testing.T) {
 	tests := []struct {
 		opts       map[string]string
@@ -0,0 +1,357 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/thriftrw/thriftrw-go/protocol"
+	"github.com/thriftrw/thriftrw-go/wire"
+	"golang.org/x/net/context"
+)
+
+// ThriftOptions are used to create a transport for Apache Thrift servers.
+type ThriftOptions struct {
+	// URLs are the servers to call, as
+	// thrift://[user:password@]host:port[?multiplexed=true].
+	URLs []string
+
+	// Dial is used to create connections. If nil, net.Dial is used.
+	Dial func(network, addr string) (net.Conn, error)
+
+	// MaxResponseBytes limits the size of response frames. If 0, there is no limit.
+	MaxResponseBytes int64
+}
+
+// Thrift binary protocol message types, and SASL negotiation statuses.
+const (
+	thriftVersion1     = 0x80010000
+	thriftVersionMask  = 0xffff0000
+	thriftCall         = 1
+	thriftReply        = 2
+	thriftException    = 3
+	thriftSASLStart    = 1
+	thriftSASLOK       = 2
+	thriftSASLBad      = 3
+	thriftSASLError    = 4
+	thriftSASLComplete = 5
+)
+
+var (
+	errNoThriftMethod    = errors.New("specify the Thrift method as Service::method")
+	errThriftFrameSize   = errors.New("Thrift response exceeds the maximum response size")
+	errThriftMessageType = errors.New("unexpected Thrift message type")
+)
+
+// ThriftApplicationError is returned for TApplicationException responses.
+type ThriftApplicationError struct {
+	Type    int32
+	Message string
+}
+
+var thriftApplicationErrorNames = map[int32]string{
+	0:  "unknown",
+	1:  "unknown method",
+	2:  "invalid message type",
+	3:  "wrong method name",
+	4:  "bad sequence ID",
+	5:  "missing result",
+	6:  "internal error",
+	7:  "protocol error",
+	8:  "invalid transform",
+	9:  "invalid protocol",
+	10: "unsupported client type",
+}
+
+func (e ThriftApplicationError) Error() string {
+	if name, ok := thriftApplicationErrorNames[e.Type]; ok {
+		return fmt.Sprintf("Thrift application exception (%v): %v", name, e.Message)
+	}
+	return fmt.Sprintf("Thrift application exception %v: %v", e.Type, e.Message)
+}
+
+type thriftPeer struct {
+	addr        string
+	user        string
+	password    string
+	sasl        bool
+	multiplexed bool
+}
+
+type thriftTransport struct {
+	peers        []thriftPeer
+	pool         *connPool
+	maxBodyBytes int64
+}
+
+// Thrift returns a transport that calls Apache Thrift servers using the
+// framed transport and the binary protocol, authenticating with SASL PLAIN
+// if the URL has credentials. Request and response bodies are the argument
+// and result structs, as with other transports.
+func Thrift(opts ThriftOptions) (Transport, error) {
+	if len(opts.URLs) == 0 {
+		return nil, errNoURLs
+	}
+
+	peers := make([]thriftPeer, len(opts.URLs))
+	for i, u := range opts.URLs {
+		peer, err := parseThriftURL(u)
+		if err != nil {
+			return nil, err
+		}
+		peers[i] = peer
+	}
+
+	return &thriftTransport{
+		peers:        peers,
+		pool:         newConnPool(opts.Dial),
+		maxBodyBytes: opts.MaxResponseBytes,
+	}, nil
+}
+
+func parseThriftURL(s string) (thriftPeer, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return thriftPeer{}, err
+	}
+	if u.Scheme != "thrift" || u.Host == "" {
+		return thriftPeer{}, fmt.Errorf("invalid Thrift URL %q, expected thrift://host:port", s)
+	}
+
+	peer := thriftPeer{addr: u.Host}
+	if u.User != nil {
+		peer.sasl = true
+		peer.user = u.User.Username()
+		peer.password, _ = u.User.Password()
+	}
+
+	query := u.Query()
+	if m := query.Get("multiplexed"); m != "" {
+		if peer.multiplexed, err = strconv.ParseBool(m); err != nil {
+			return thriftPeer{}, fmt.Errorf("invalid multiplexed value %q in %v", m, s)
+		}
+	}
+	switch mech := strings.ToLower(query.Get("sasl")); mech {
+	case "":
+	case "plain":
+		peer.sasl = true
+	case "gssapi", "kerberos":
+		return thriftPeer{}, fmt.Errorf("Kerberos SASL is not supported for %v, only PLAIN", s)
+	default:
+		return thriftPeer{}, fmt.Errorf("unknown SASL mechanism %q in %v", mech, s)
+	}
+	return peer, nil
+}
+
+// messageName returns the name of the method in the message envelope. The
+// method is Service::method, and multiplexed servers use Service:method.
+func (p thriftPeer) messageName(method string) (string, error) {
+	parts := strings.SplitN(method, "::", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", errNoThriftMethod
+	}
+	if p.multiplexed {
+		return parts[0] + ":" + parts[1], nil
+	}
+	return parts[1], nil
+}
+
+// setupConn runs the SASL PLAIN negotiation on new connections if required.
+func (t *thriftTransport) setupConn(peer thriftPeer) func(*bufConn) error {
+	if !peer.sasl {
+		return nil
+	}
+
+	return func(conn *bufConn) error {
+		w := &wireWriter{}
+		writeSASLMessage(w, thriftSASLStart, []byte("PLAIN"))
+		writeSASLMessage(w, thriftSASLComplete, []byte("\x00"+peer.user+"\x00"+peer.password))
+		if _, err := conn.Write(w.Bytes()); err != nil {
+			return err
+		}
+
+		var header [5]byte
+		if _, err := io.ReadFull(conn.r, header[:]); err != nil {
+			return err
+		}
+		payload, err := readN(conn.r, binary.BigEndian.Uint32(header[1:]), t.maxBodyBytes)
+		if err != nil {
+			return err
+		}
+
+		switch header[0] {
+		case thriftSASLComplete:
+			return nil
+		case thriftSASLBad, thriftSASLError:
+			return fmt.Errorf("SASL authentication failed: %s", payload)
+		}
+		return fmt.Errorf("unexpected SASL status %v", header[0])
+	}
+}
+
+func writeSASLMessage(w *wireWriter, status int8, payload []byte) {
+	w.int8(status)
+	w.bytes(payload)
+}
+
+// readN reads n bytes, failing if n is over the limit.
+func readN(r io.Reader, n uint32, maxBytes int64) ([]byte, error) {
+	if maxBytes > 0 && int64(n) > maxBytes {
+		return nil, errThriftFrameSize
+	}
+	bs := make([]byte, n)
+	_, err := io.ReadFull(r, bs)
+	return bs, err
+}
+
+func (t *thriftTransport) Call(ctx context.Context, r *Request) (*Response, error) {
+	peer := t.peers[rand.Intn(len(t.peers))]
+	setCallPeer(ctx, "thrift://"+peer.addr)
+	name, err := peer.messageName(r.Method)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := t.pool.get(peer.addr, t.setupConn(peer))
+	if err != nil {
+		return nil, err
+	}
+
+	done := conn.watch(ctx)
+	body, err := t.call(conn, name, r.Body)
+	done()
+	if _, ok := err.(ThriftApplicationError); err != nil && !ok {
+		// The connection is in an unknown state after I/O errors.
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	t.pool.put(peer.addr, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{
+		Body: body,
+		Peer: "thrift://" + peer.addr,
+	}, nil
+}
+
+// call writes a framed call message and returns the result struct from the
+// reply.
+func (t *thriftTransport) call(conn *bufConn, name string, args []byte) ([]byte, error) {
+	msg := &wireWriter{}
+	msg.int32(0) // frame length
+	writeThriftMessageHeader(msg, thriftCall, name)
+	msg.Write(args)
+
+	frame := msg.Bytes()
+	binary.BigEndian.PutUint32(frame, uint32(len(frame)-4))
+	if _, err := conn.Write(frame); err != nil {
+		return nil, err
+	}
+
+	var size [4]byte
+	if _, err := io.ReadFull(conn.r, size[:]); err != nil {
+		return nil, err
+	}
+	reply, err := readN(conn.r, binary.BigEndian.Uint32(size[:]), t.maxBodyBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	msgType, body, err := parseThriftMessage(reply, name)
+	if err != nil {
+		return nil, err
+	}
+	switch msgType {
+	case thriftReply:
+		return body, nil
+	case thriftException:
+		return nil, parseThriftApplicationError(body)
+	}
+	return nil, errThriftMessageType
+}
+
+// writeThriftMessageHeader writes a strict message envelope. Calls are made
+// one at a time on each connection, so the sequence ID is always 0.
+func writeThriftMessageHeader(w *wireWriter, msgType byte, name string) {
+	version := uint32(thriftVersion1 | uint32(msgType))
+	w.int32(int32(version))
+	w.bytes([]byte(name))
+	w.int32(0)
+}
+
+// parseThriftMessage returns the type and body of a message, which may use
+// the strict or the older non-strict envelope.
+func parseThriftMessage(msg []byte, name string) (byte, []byte, error) {
+	r := &wireReader{buf: msg}
+
+	var msgType byte
+	var gotName []byte
+	if version := r.int32(); version < 0 {
+		if uint32(version)&thriftVersionMask != thriftVersion1 {
+			return 0, nil, fmt.Errorf("unknown Thrift protocol version %#x", uint32(version))
+		}
+		msgType = byte(version)
+		gotName = r.bytes()
+	} else {
+		gotName = r.next(int(version))
+		msgType = byte(r.int8())
+	}
+	r.int32() // sequence ID
+	if r.err != nil {
+		return 0, nil, r.err
+	}
+	if string(gotName) != name {
+		return 0, nil, fmt.Errorf("Thrift reply for %q does not match call to %q", gotName, name)
+	}
+	return msgType, r.buf, nil
+}
+
+func parseThriftApplicationError(body []byte) error {
+	v, err := protocol.Binary.Decode(bytes.NewReader(body), wire.TStruct)
+	if err != nil {
+		return err
+	}
+
+	var appErr ThriftApplicationError
+	for _, f := range v.GetStruct().Fields {
+		switch {
+		case f.ID == 1 && f.Value.Type() == wire.TBinary:
+			appErr.Message = f.Value.GetString()
+		case f.ID == 2 && f.Value.Type() == wire.TI32:
+			appErr.Type = f.Value.GetI32()
+		}
+	}
+	return appErr
+}
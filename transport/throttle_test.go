@@ -0,0 +1,90 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2016, 4, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		v    string
+		want time.Duration
+	}{
+		{"", 0},
+		{"0", 0},
+		{"5", 5 * time.Second},
+		{"-1", 0},
+		{"Fri, 01 Apr 2016 12:00:30 GMT", 30 * time.Second},
+		{"Fri, 01 Apr 2016 11:00:00 GMT", 0},
+		{"soon", 0},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, parseRetryAfter(tt.v, now), "parseRetryAfter(%q) mismatch", tt.v)
+	}
+}
+
+func TestHTTPThrottled(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if v := r.Header.Get("retry-after"); v != "" {
+			w.Header().Set("Retry-After", v)
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer svr.Close()
+
+	transport, err := HTTP(HTTPOptions{
+		URLs:          []string{svr.URL + "/rpc"},
+		SourceService: "source",
+		TargetService: "target",
+	})
+	require.NoError(t, err, "Failed to create HTTP transport")
+
+	tests := []struct {
+		retryAfter string
+		want       time.Duration
+	}{
+		{"", 0},
+		{"2", 2 * time.Second},
+	}
+
+	for _, tt := range tests {
+		_, err := transport.Call(context.Background(), &Request{
+			Method:  "method",
+			Headers: map[string]string{"retry-after": tt.retryAfter},
+		})
+		require.Error(t, err, "Call should fail")
+		assert.Equal(t, ThrottledError{
+			Message:    "HTTP call got non-success response code: 429",
+			RetryAfter: tt.want,
+		}, err, "Unexpected error for Retry-After %q", tt.retryAfter)
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var errShortResponse = errors.New("response is too short")
+
+// wireWriter encodes the primitives used by binary protocols such as Kafka
+// and CQL. All integers are big-endian, and strings have an int16 length.
+type wireWriter struct {
+	bytes.Buffer
+}
+
+func (w *wireWriter) int8(v int8) {
+	w.WriteByte(byte(v))
+}
+
+func (w *wireWriter) int16(v int16) {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], uint16(v))
+	w.Write(b[:])
+}
+
+func (w *wireWriter) int32(v int32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(v))
+	w.Write(b[:])
+}
+
+func (w *wireWriter) int64(v int64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(v))
+	w.Write(b[:])
+}
+
+func (w *wireWriter) string(s string) {
+	w.int16(int16(len(s)))
+	w.WriteString(s)
+}
+
+func (w *wireWriter) bytes(bs []byte) {
+	w.int32(int32(len(bs)))
+	w.Write(bs)
+}
+
+// wireReader decodes the primitives written by wireWriter. Once the input
+// is too short, all reads return zero values and err is set.
+type wireReader struct {
+	buf []byte
+	err error
+}
+
+func (r *wireReader) next(n int) []byte {
+	if r.err != nil || n < 0 || len(r.buf) < n {
+		r.err = errShortResponse
+		return nil
+	}
+	bs := r.buf[:n]
+	r.buf = r.buf[n:]
+	return bs
+}
+
+// fixed reads n bytes for a fixed-size integer, which are zero if the
+// input is too short.
+func (r *wireReader) fixed(n int) []byte {
+	if bs := r.next(n); bs != nil {
+		return bs
+	}
+	return make([]byte, n)
+}
+
+func (r *wireReader) int8() int8 {
+	return int8(r.fixed(1)[0])
+}
+
+func (r *wireReader) int16() int16 {
+	return int16(binary.BigEndian.Uint16(r.fixed(2)))
+}
+
+func (r *wireReader) int32() int32 {
+	return int32(binary.BigEndian.Uint32(r.fixed(4)))
+}
+
+func (r *wireReader) int64() int64 {
+	return int64(binary.BigEndian.Uint64(r.fixed(8)))
+}
+
+func (r *wireReader) string() string {
+	n := int(r.int16())
+	if n < 0 {
+		return ""
+	}
+	return string(r.next(n))
+}
+
+// arrayLen returns the length of an array, which is limited by the remaining
+// input so corrupt lengths can't cause large allocations.
+func (r *wireReader) arrayLen() int {
+	n := int(r.int32())
+	if n < 0 {
+		return 0
+	}
+	if n > len(r.buf) {
+		r.err = errShortResponse
+		return 0
+	}
+	return n
+}
+
+// bytes reads bytes with an int32 length, returning nil for negative lengths.
+func (r *wireReader) bytes() []byte {
+	n := int(r.int32())
+	if n < 0 {
+		return nil
+	}
+	return r.next(n)
+}
@@ -0,0 +1,39 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWireReaderShort(t *testing.T) {
+	r := &wireReader{buf: []byte{0, 1, 0}}
+	assert.Equal(t, int16(1), r.int16(), "Unexpected int16")
+	assert.Equal(t, int32(0), r.int32(), "Short reads should return zero")
+	assert.Equal(t, "", r.string(), "Short reads should return zero")
+	assert.Equal(t, errShortResponse, r.err, "Unexpected error")
+
+	r = &wireReader{buf: []byte{0, 0, 0, 100}}
+	assert.Equal(t, 0, r.arrayLen(), "Array lengths should be limited by the input")
+	assert.Equal(t, errShortResponse, r.err, "Unexpected error")
+}
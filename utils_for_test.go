@@ -39,6 +39,10 @@ const (
 type testOutput struct {
 	*bytes.Buffer
 	fatalf func(string, ...interface{})
+
+	// warnings receives the output of Warnf, if set. Otherwise, it
+	// is written to Buffer.
+	warnings *bytes.Buffer
 }
 
 func (t testOutput) Fatalf(format string, args ...interface{}) {
@@ -50,6 +54,14 @@ func (t testOutput) Printf(format string, args ...interface{}) {
 	t.WriteString(fmt.Sprintf(format, args...))
 }
 
+func (t testOutput) Warnf(format string, args ...interface{}) {
+	if t.warnings != nil {
+		t.warnings.WriteString(fmt.Sprintf(format, args...))
+		return
+	}
+	t.Printf(format, args...)
+}
+
 func getOutput(t *testing.T) (*bytes.Buffer, output) {
 	buf := &bytes.Buffer{}
 	out := testOutput{
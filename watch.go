@@ -0,0 +1,81 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/yarpc/yab/encoding"
+	"github.com/yarpc/yab/transport"
+)
+
+const watchTimeFormat = "2006-01-02 15:04:05.000"
+
+// runWatch makes the request every opts.Watch, printing each response with a
+// timestamp. Responses whose body differs from the previous response are
+// marked as changed. Failures are printed and do not stop the watch.
+func runWatch(out output, opts RequestOptions, t transport.Transport, serializer encoding.Serializer, req *transport.Request) {
+	ticker := time.NewTicker(opts.Watch)
+	defer ticker.Stop()
+
+	var last []byte
+	for i := 0; opts.WatchCount <= 0 || i < opts.WatchCount; i++ {
+		if i > 0 {
+			<-ticker.C
+		}
+
+		timestamp := time.Now().Format(watchTimeFormat)
+		response, err := makeRequest(t, req)
+		if err != nil {
+			out.Printf("[%v] Failed while making call: %v\n\n", timestamp, err)
+			continue
+		}
+
+		outSerialized, err := responseToOutput(serializer, response)
+		if err != nil {
+			out.Printf("[%v] Failed while parsing response: %v\n\n", timestamp, err)
+			continue
+		}
+
+		// The trace changes on every call, so only the body is compared.
+		body, err := json.Marshal(outSerialized["body"])
+		if err != nil {
+			out.Printf("[%v] Failed to convert body to JSON: %v\n\n", timestamp, err)
+			continue
+		}
+
+		bs, err := json.MarshalIndent(outSerialized, "", "  ")
+		if err != nil {
+			out.Printf("[%v] Failed to convert map to JSON: %v\n\n", timestamp, err)
+			continue
+		}
+
+		status := ""
+		if last != nil && !bytes.Equal(last, body) {
+			status = " (changed)"
+		}
+		last = body
+
+		out.Printf("[%v]%v\n%s\n\n", timestamp, status, bs)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yarpc/yab/encoding"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel-go/raw"
+	"golang.org/x/net/context"
+)
+
+func TestRunWatch(t *testing.T) {
+	var calls int32
+	s := newServer(t)
+	defer s.shutdown()
+	s.register("Simple::bar", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		result := byte(1)
+		if atomic.AddInt32(&calls, 1) > 2 {
+			result = 2
+		}
+
+		return &raw.Res{
+			Arg2: args.Arg2,
+			Arg3: []byte{
+				8,    /* i32 */
+				0, 0, /* field ID */
+				0, 0, 0, result,
+				0, /* STOP */
+			},
+		}, nil
+	})
+
+	m := benchmarkMethodForTest(t, "Simple::bar")
+	transport, err := getTransport(s.transportOpts(), encoding.Thrift)
+	require.NoError(t, err, "Failed to get transport")
+
+	buf, out := getOutput(t)
+	opts := RequestOptions{
+		Watch:      time.Millisecond,
+		WatchCount: 4,
+	}
+	runWatch(out, opts, transport, m.serializer, m.req)
+
+	output := buf.String()
+	assert.EqualValues(t, 4, calls, "Unexpected number of calls")
+	assert.Equal(t, 1, strings.Count(output, "(changed)"), "Expected a single change in %v", output)
+	assert.Equal(t, 2, strings.Count(output, `"result": 1`), "Unexpected output: %v", output)
+	assert.Equal(t, 2, strings.Count(output, `"result": 2`), "Unexpected output: %v", output)
+}
+
+func TestRunWatchErrors(t *testing.T) {
+	m := benchmarkMethodForTest(t, fooMethod)
+	s := newServer(t)
+	defer s.shutdown()
+
+	transport, err := getTransport(s.transportOpts(), encoding.Thrift)
+	require.NoError(t, err, "Failed to get transport")
+
+	buf, out := getOutput(t)
+	opts := RequestOptions{
+		Watch:      time.Millisecond,
+		WatchCount: 2,
+	}
+	runWatch(out, opts, transport, m.serializer, m.req)
+	assert.Equal(t, 2, strings.Count(buf.String(), "Failed while making call"), "Errors should not stop the watch")
+}